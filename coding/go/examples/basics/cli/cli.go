@@ -0,0 +1,712 @@
+// CLI Subcommands - FlagSets, environment variables and config files
+//
+// Most programs here pick a mode with a switch on os.Args[1] and give
+// each mode a flag.FlagSet of its own. This is that pattern finished:
+// a small key-value store, kv, with the structure larger tools share.
+//
+//   kv [global flags] COMMAND [command flags] [ARGS]
+//
+// This example demonstrates:
+//   - One FlagSet for the global flags and one per subcommand, from a
+//     table of commands that also generates the help text
+//   - Settings in layers: a default, overridden by the config file,
+//     by an environment variable, by a flag. fs.Visit tells which
+//     flags were given, and fs.Set applies the other layers with the
+//     flag's own parsing, so every layer is checked the same way
+//   - `kv config` to show each setting's value and where it came
+//     from, the question every layered configuration raises
+//   - A custom flag.Value that accepts one of a fixed set of values
+//   - Errors a user can act on, with exit code 2 for usage mistakes
+//     and 1 for failures, a "did you mean" for a mistyped command,
+//     and unknown keys in the config file rejected, not ignored
+//   - run(args, getenv, stdout, stderr) instead of reading os.Args and
+//     os.Getenv directly, so the tests can run the whole CLI
+//
+// Usage:
+//   go run cli.go                              # demo session
+//   go run cli.go help
+//   go run cli.go -store /tmp/kv.json put greeting hello
+//   KV_FORMAT=json go run cli.go -store /tmp/kv.json list
+//
+// Run tests:
+//   go test -v cli.go cli_test.go
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+)
+
+const prog = "kv"
+
+// ============================================================
+// 1. Settings and their layers
+// ============================================================
+
+// choice is a flag.Value that accepts only the values in allowed
+type choice struct {
+	allowed []string
+	value   *string
+}
+
+func (c choice) String() string {
+	if c.value == nil {
+		return "" // the flag package makes zero values to check defaults
+	}
+	return *c.value
+}
+
+func (c choice) Set(s string) error {
+	if !slices.Contains(c.allowed, s) {
+		return fmt.Errorf("want one of %s", strings.Join(c.allowed, ", "))
+	}
+	*c.value = s
+	return nil
+}
+
+// config is the global settings. Each is a flag, an environment
+// variable, and a key in the config file
+type config struct {
+	Store     string
+	Namespace string
+	Format    string
+	Verbose   bool
+
+	// source records where each setting's value came from
+	source map[string]string
+}
+
+// envName is the environment variable for a setting
+func envName(setting string) string {
+	return "KV_" + strings.ToUpper(setting)
+}
+
+// register defines the settings as flags on fs, with their defaults
+func (c *config) register(fs *flag.FlagSet, dir string) {
+	usage := func(setting, s string) string {
+		return fmt.Sprintf("%s ($%s)", s, envName(setting))
+	}
+	fs.StringVar(&c.Store, "store", filepath.Join(dir, "store.json"), usage("store", "the store `file`"))
+	fs.StringVar(&c.Namespace, "namespace", "", usage("namespace", "prefix for every key, for several stores in one `name`"))
+	c.Format = "text"
+	fs.Var(choice{[]string{"text", "json"}, &c.Format}, "format", usage("format", "output `format`: text or json"))
+	fs.BoolVar(&c.Verbose, "verbose", false, usage("verbose", "say what's happening, on stderr"))
+}
+
+// layer applies the config file and the environment to the settings
+// on fs that no flag set. Higher layers win: flag, then environment,
+// then file, then the default
+func (c *config) layer(fs *flag.FlagSet, file map[string]string, filePath string, getenv func(string) (string, bool)) error {
+	c.source = make(map[string]string)
+	fs.Visit(func(f *flag.Flag) { c.source[f.Name] = "flag -" + f.Name })
+
+	var errs []error
+	fs.VisitAll(func(f *flag.Flag) {
+		if f.Name == "config" || c.source[f.Name] != "" {
+			return
+		}
+		var from, v string
+		if ev, ok := getenv(envName(f.Name)); ok {
+			from, v = "$"+envName(f.Name), ev
+		} else if fv, ok := file[f.Name]; ok {
+			from, v = filePath, fv
+		} else {
+			c.source[f.Name] = "default"
+			return
+		}
+		// Set parses as the flag would: a bad value is an error
+		// whichever layer it came from
+		if err := fs.Set(f.Name, v); err != nil {
+			errs = append(errs, fmt.Errorf("%s: invalid %s %q: %v", from, f.Name, v, err))
+			return
+		}
+		c.source[f.Name] = from
+	})
+	return errors.Join(errs...)
+}
+
+// readConfigFile reads a JSON object of settings. Values can be
+// strings, numbers or booleans; a key that isn't a setting is an
+// error, as a typo would otherwise be silently ignored
+func readConfigFile(path string, fs *flag.FlagSet) (map[string]string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	vals := make(map[string]string, len(raw))
+	for _, k := range slices.Sorted(maps.Keys(raw)) {
+		if fs.Lookup(k) == nil || k == "config" {
+			return nil, fmt.Errorf("%s: unknown setting %q", path, k)
+		}
+		var s string
+		if json.Unmarshal(raw[k], &s) != nil {
+			s = string(raw[k]) // a number or bool, as written
+		}
+		vals[k] = s
+	}
+	return vals, nil
+}
+
+// ============================================================
+// 2. Commands
+// ============================================================
+
+// app is what a command runs with
+type app struct {
+	cfg    *config
+	stdout io.Writer
+	stderr io.Writer
+}
+
+// usageError is a mistake in how the command was called, as opposed to
+// a failure in running it. It exits 2 and points at the help
+type usageError struct{ msg string }
+
+func (e usageError) Error() string { return e.msg }
+
+func usagef(format string, args ...any) error {
+	return usageError{fmt.Sprintf(format, args...)}
+}
+
+// command is one subcommand. setup defines its flags on fs and returns
+// the function that runs it with the arguments left after the flags
+type command struct {
+	name  string
+	args  string // positional arguments, for the usage line
+	short string // one line, for the command list
+	long  string // for help COMMAND
+	setup func(fs *flag.FlagSet) func(a *app, args []string) error
+}
+
+var commands []command
+
+func init() {
+	// In init, not the var declaration: help refers to commands
+	commands = []command{
+		{name: "get", args: "KEY", short: "print the value of a key",
+			long: "Get prints the value of KEY. With -default, a missing key prints\nthat instead of failing.",
+			setup: func(fs *flag.FlagSet) func(*app, []string) error {
+				def := fs.String("default", "", "print `value` if the key is missing")
+				return func(a *app, args []string) error {
+					if err := wantArgs(args, "KEY"); err != nil {
+						return err
+					}
+					var hasDefault bool
+					fs.Visit(func(f *flag.Flag) { hasDefault = hasDefault || f.Name == "default" })
+					return a.get(args[0], *def, hasDefault)
+				}
+			}},
+		{name: "put", args: "KEY VALUE", short: "set a key",
+			long: "Put sets KEY to VALUE, replacing any value it had.",
+			setup: func(fs *flag.FlagSet) func(*app, []string) error {
+				ifAbsent := fs.Bool("if-absent", false, "fail if the key already has a value")
+				return func(a *app, args []string) error {
+					if err := wantArgs(args, "KEY", "VALUE"); err != nil {
+						return err
+					}
+					return a.put(args[0], args[1], *ifAbsent)
+				}
+			}},
+		{name: "del", args: "KEY...", short: "delete keys",
+			long: "Del deletes each KEY. Keys that don't exist are not an error.",
+			setup: func(fs *flag.FlagSet) func(*app, []string) error {
+				return func(a *app, args []string) error {
+					if len(args) == 0 {
+						return usagef("want at least one KEY")
+					}
+					return a.del(args)
+				}
+			}},
+		{name: "list", args: "", short: "list keys and values",
+			long: "List prints every key in the namespace with its value, in key order.",
+			setup: func(fs *flag.FlagSet) func(*app, []string) error {
+				prefix := fs.String("prefix", "", "only keys starting with `prefix`")
+				return func(a *app, args []string) error {
+					if err := wantArgs(args); err != nil {
+						return err
+					}
+					return a.list(*prefix)
+				}
+			}},
+		{name: "config", args: "", short: "show the settings and where each came from",
+			long: "Config prints each setting's value and its source: a flag, an\n" +
+				"environment variable, the config file, or the default.",
+			setup: func(fs *flag.FlagSet) func(*app, []string) error {
+				return func(a *app, args []string) error {
+					if err := wantArgs(args); err != nil {
+						return err
+					}
+					return a.showConfig()
+				}
+			}},
+		{name: "help", args: "[COMMAND]", short: "show help for kv or a command",
+			setup: func(fs *flag.FlagSet) func(*app, []string) error {
+				return func(a *app, args []string) error {
+					switch len(args) {
+					case 0:
+						printUsage(a.stdout, nil)
+						return nil
+					case 1:
+						cmd, err := lookup(args[0])
+						if err != nil {
+							return err
+						}
+						printCommandUsage(a.stdout, cmd, newFlagSet(cmd, a.stdout))
+						return nil
+					}
+					return usagef("want at most one COMMAND")
+				}
+			}},
+	}
+}
+
+// wantArgs checks args against the names of the arguments expected.
+// flag stops at the first argument that isn't a flag, so a flag after
+// the arguments arrives here as one: say so
+func wantArgs(args []string, names ...string) error {
+	if len(args) == len(names) {
+		return nil
+	}
+	for _, a := range args[min(len(names), len(args)):] {
+		if strings.HasPrefix(a, "-") {
+			return usagef("flag %s after the arguments; flags go first", a)
+		}
+	}
+	if len(names) == 0 {
+		return usagef("want no arguments, got %d", len(args))
+	}
+	return usagef("want %s, got %d arguments", strings.Join(names, " "), len(args))
+}
+
+func lookup(name string) (command, error) {
+	for _, c := range commands {
+		if c.name == name {
+			return c, nil
+		}
+	}
+	msg := fmt.Sprintf("unknown command %q", name)
+	best, bestDist := "", 3 // suggest nothing further than 2 edits away
+	for _, c := range commands {
+		if d := editDistance(name, c.name); d < bestDist {
+			best, bestDist = c.name, d
+		}
+	}
+	if best != "" {
+		msg += fmt.Sprintf("; did you mean %q?", best)
+	}
+	return command{}, usageError{msg}
+}
+
+// editDistance is the Levenshtein distance between a and b
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+// ============================================================
+// 3. Usage text, generated from the flags and commands
+// ============================================================
+
+func printUsage(w io.Writer, global *flag.FlagSet) {
+	fmt.Fprintf(w, "Usage: %s [flags] COMMAND [command flags] [ARGS]\n\n", prog)
+	fmt.Fprintf(w, "%s keeps keys and values in a JSON file.\n\nCommands:\n", prog)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, c := range commands {
+		fmt.Fprintf(tw, "  %s\t%s\n", c.name, c.short)
+	}
+	tw.Flush()
+	if global == nil {
+		global = newGlobalFlagSet(&config{}, new(string), w)
+	}
+	fmt.Fprintf(w, "\nFlags:\n")
+	global.SetOutput(w)
+	global.PrintDefaults()
+	fmt.Fprintf(w, "\nSettings come from, highest first: flags, $KV_* variables, the\n"+
+		"config file, defaults. %s config shows which. Run %s help COMMAND\n"+
+		"for a command's flags.\n", prog, prog)
+}
+
+func printCommandUsage(w io.Writer, c command, fs *flag.FlagSet) {
+	fmt.Fprintf(w, "Usage: %s [flags] %s", prog, c.name)
+	var hasFlags bool
+	fs.VisitAll(func(*flag.Flag) { hasFlags = true })
+	if hasFlags {
+		fmt.Fprint(w, " [command flags]")
+	}
+	if c.args != "" {
+		fmt.Fprint(w, " ", c.args)
+	}
+	fmt.Fprintln(w)
+	fmt.Fprintf(w, "\n%s\n", cmp.Or(c.long, c.short))
+	if hasFlags {
+		fmt.Fprintf(w, "\nCommand flags:\n")
+		fs.SetOutput(w)
+		fs.PrintDefaults()
+	}
+}
+
+func defaultDir() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "." // no home directory: work in the current one
+	}
+	return filepath.Join(dir, prog)
+}
+
+func newGlobalFlagSet(cfg *config, configPath *string, out io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(prog, flag.ContinueOnError)
+	fs.SetOutput(out)
+	dir := defaultDir()
+	fs.StringVar(configPath, "config", "", fmt.Sprintf("config `file` (default %s) ($KV_CONFIG)", filepath.Join(dir, "config.json")))
+	cfg.register(fs, dir)
+	return fs
+}
+
+func newFlagSet(c command, out io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(prog+" "+c.name, flag.ContinueOnError)
+	fs.SetOutput(out)
+	return fs
+}
+
+// ============================================================
+// 4. run: parse, layer, dispatch
+// ============================================================
+
+// run is the whole program: it returns the exit status. getenv is
+// os.LookupEnv, or a map in the tests
+func run(args []string, getenv func(string) (string, bool), stdout, stderr io.Writer) int {
+	cfg := &config{}
+	var configPath string
+	global := newGlobalFlagSet(cfg, &configPath, stderr)
+	if code, ok := parse(global, args, func() { printUsage(stderr, global) }, stderr, ""); !ok {
+		return code
+	}
+	if global.NArg() == 0 {
+		printUsage(stderr, global)
+		return 2
+	}
+
+	cmd, err := lookup(global.Arg(0))
+	if err != nil {
+		fmt.Fprintf(stderr, "%s: %v\nRun '%s help' for usage.\n", prog, err, prog)
+		return 2
+	}
+	fs := newFlagSet(cmd, stderr)
+	runCmd := cmd.setup(fs)
+	if code, ok := parse(fs, global.Args()[1:], func() { printCommandUsage(stderr, cmd, fs) }, stderr, cmd.name); !ok {
+		return code
+	}
+
+	a := &app{cfg: cfg, stdout: stdout, stderr: stderr}
+	// help works whatever state the config is in: it's how to find out
+	// what the config should be
+	if cmd.name != "help" {
+		used, err := loadConfig(cfg, global, configPath, getenv)
+		if err != nil {
+			fmt.Fprintf(stderr, "%s: %v\n", prog, err)
+			return 2
+		}
+		a.logf("config file %s, store %s", cmp.Or(used, "none"), cfg.Store)
+	}
+	err = runCmd(a, fs.Args())
+	var uerr usageError
+	switch {
+	case errors.As(err, &uerr):
+		fmt.Fprintf(stderr, "%s %s: %v\nRun '%s help %s' for usage.\n", prog, cmd.name, err, prog, cmd.name)
+		return 2
+	case err != nil:
+		fmt.Fprintf(stderr, "%s %s: %v\n", prog, cmd.name, err)
+		return 1
+	}
+	return 0
+}
+
+// parse parses args with fs. For -h it prints usage and returns exit
+// status 0; for a bad flag, which fs has already reported, a pointer
+// to the help and 2. The full usage for every typo buries the error
+func parse(fs *flag.FlagSet, args []string, usage func(), stderr io.Writer, cmd string) (code int, ok bool) {
+	fs.Usage = func() {}
+	err := fs.Parse(args)
+	switch {
+	case err == nil:
+		return 0, true
+	case errors.Is(err, flag.ErrHelp):
+		usage()
+		return 0, false
+	}
+	fmt.Fprintf(stderr, "Run '%s' for usage.\n", strings.TrimSpace(prog+" help "+cmd))
+	return 2, false
+}
+
+// loadConfig finds and reads the config file and layers it and the
+// environment under the flags, returning the file's path if there was
+// one. A file named by -config or $KV_CONFIG must exist; the default
+// one needn't
+func loadConfig(cfg *config, global *flag.FlagSet, path string, getenv func(string) (string, bool)) (string, error) {
+	explicit := path != ""
+	if !explicit {
+		path, explicit = getenv("KV_CONFIG")
+	}
+	if !explicit {
+		path = filepath.Join(defaultDir(), "config.json")
+	}
+	file, err := readConfigFile(path, global)
+	if errors.Is(err, fs.ErrNotExist) && !explicit {
+		file, err, path = nil, nil, ""
+	}
+	if err != nil {
+		return "", err
+	}
+	return path, cfg.layer(global, file, path, getenv)
+}
+
+// ============================================================
+// 5. The store
+// ============================================================
+
+func (a *app) logf(format string, args ...any) {
+	if a.cfg.Verbose {
+		fmt.Fprintf(a.stderr, prog+": "+format+"\n", args...)
+	}
+}
+
+func (a *app) key(k string) string {
+	if a.cfg.Namespace == "" {
+		return k
+	}
+	return a.cfg.Namespace + "/" + k
+}
+
+func (a *app) load() (map[string]string, error) {
+	data, err := os.ReadFile(a.cfg.Store)
+	if errors.Is(err, fs.ErrNotExist) {
+		return map[string]string{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	m := map[string]string{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("%s: %w", a.cfg.Store, err)
+	}
+	a.logf("loaded %d keys from %s", len(m), a.cfg.Store)
+	return m, nil
+}
+
+// save writes the store by write-then-rename; basics/file_io has why
+// and what this leaves out
+func (a *app) save(m map[string]string) error {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(a.cfg.Store), 0o755); err != nil {
+		return err
+	}
+	tmp := a.cfg.Store + ".tmp"
+	if err := os.WriteFile(tmp, append(data, '\n'), 0o644); err != nil {
+		return err
+	}
+	a.logf("saved %d keys to %s", len(m), a.cfg.Store)
+	return os.Rename(tmp, a.cfg.Store)
+}
+
+// ErrNotFound is returned by get for a missing key
+var ErrNotFound = errors.New("not found")
+
+func (a *app) get(k, def string, hasDefault bool) error {
+	m, err := a.load()
+	if err != nil {
+		return err
+	}
+	v, ok := m[a.key(k)]
+	if !ok && !hasDefault {
+		return fmt.Errorf("%q: %w", k, ErrNotFound)
+	}
+	if !ok {
+		v = def
+	}
+	if a.cfg.Format == "json" {
+		return json.NewEncoder(a.stdout).Encode(map[string]string{"key": k, "value": v})
+	}
+	fmt.Fprintln(a.stdout, v)
+	return nil
+}
+
+func (a *app) put(k, v string, ifAbsent bool) error {
+	m, err := a.load()
+	if err != nil {
+		return err
+	}
+	if _, ok := m[a.key(k)]; ok && ifAbsent {
+		return fmt.Errorf("%q already set", k)
+	}
+	m[a.key(k)] = v
+	return a.save(m)
+}
+
+func (a *app) del(keys []string) error {
+	m, err := a.load()
+	if err != nil {
+		return err
+	}
+	for _, k := range keys {
+		delete(m, a.key(k))
+	}
+	return a.save(m)
+}
+
+func (a *app) list(prefix string) error {
+	m, err := a.load()
+	if err != nil {
+		return err
+	}
+	out := map[string]string{}
+	for k, v := range m {
+		if name, ok := strings.CutPrefix(k, a.key("")); ok && strings.HasPrefix(name, prefix) {
+			out[name] = v
+		}
+	}
+	if a.cfg.Format == "json" {
+		enc := json.NewEncoder(a.stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(out)
+	}
+	tw := tabwriter.NewWriter(a.stdout, 0, 0, 2, ' ', 0)
+	for _, k := range slices.Sorted(maps.Keys(out)) {
+		fmt.Fprintf(tw, "%s\t%s\n", k, out[k])
+	}
+	return tw.Flush()
+}
+
+func (a *app) showConfig() error {
+	settings := [][2]string{
+		{"store", a.cfg.Store},
+		{"namespace", a.cfg.Namespace},
+		{"format", a.cfg.Format},
+		{"verbose", fmt.Sprint(a.cfg.Verbose)},
+	}
+	if a.cfg.Format == "json" {
+		type entry struct {
+			Value  string `json:"value"`
+			Source string `json:"source"`
+		}
+		out := map[string]entry{}
+		for _, s := range settings {
+			out[s[0]] = entry{s[1], a.cfg.source[s[0]]}
+		}
+		enc := json.NewEncoder(a.stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(out)
+	}
+	tw := tabwriter.NewWriter(a.stdout, 0, 0, 2, ' ', 0)
+	for _, s := range settings {
+		fmt.Fprintf(tw, "%s\t%q\t%s\n", s[0], s[1], a.cfg.source[s[0]])
+	}
+	return tw.Flush()
+}
+
+// ============================================================
+// main
+// ============================================================
+
+func main() {
+	if len(os.Args) < 2 {
+		demo()
+		return
+	}
+	os.Exit(run(os.Args[1:], os.LookupEnv, os.Stdout, os.Stderr))
+}
+
+// demo runs a session of kv commands against a temporary directory,
+// with a made-up environment so the real one doesn't leak in
+func demo() {
+	dir, err := os.MkdirTemp("", "kv-")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer os.RemoveAll(dir)
+	conf := filepath.Join(dir, "config.json")
+	os.WriteFile(conf, []byte("{}\n"), 0o644)
+	env := map[string]string{"KV_CONFIG": conf, "KV_STORE": filepath.Join(dir, "store.json")}
+
+	sh := func(vars string, args ...string) {
+		e := maps.Clone(env)
+		for _, kv := range strings.Fields(vars) {
+			k, v, _ := strings.Cut(kv, "=")
+			e[k] = v
+		}
+		line := vars + " kv"
+		for _, a := range args {
+			if a == "" || strings.ContainsAny(a, " \"") {
+				a = strconv.Quote(a)
+			}
+			line += " " + a
+		}
+		fmt.Printf("$ %s\n", strings.TrimSpace(line))
+		lookupEnv := func(k string) (string, bool) { v, ok := e[k]; return v, ok }
+		if code := run(args, lookupEnv, os.Stdout, os.Stdout); code != 0 {
+			fmt.Printf("(exit %d)\n", code)
+		}
+		fmt.Println()
+	}
+
+	fmt.Printf("(KV_CONFIG and KV_STORE point into %s throughout;\nthe config file starts as {})\n\n", dir)
+	sh("", "help")
+	sh("", "put", "greeting", "hello")
+	sh("", "put", "colour", "teal")
+	sh("", "list")
+	sh("", "get", "-default", "none", "missing")
+
+	fmt.Println("# A config file sets a namespace and JSON output")
+	os.WriteFile(conf, []byte(`{"namespace": "staging", "format": "json"}`+"\n"), 0o644)
+	sh("", "put", "greeting", "hi from staging")
+	sh("", "-verbose", "get", "greeting")
+	sh("", "list")
+	sh("", "config")
+
+	fmt.Println("# The environment beats the file; a flag beats both")
+	sh("KV_FORMAT=text", "config")
+	sh("KV_FORMAT=text", "-format", "json", "-namespace", "", "get", "greeting")
+
+	fmt.Println("# Mistakes")
+	sh("", "gte", "greeting")
+	sh("", "put", "greeting", "hey", "-if-absent")
+	sh("KV_VERBOSE=maybe", "list")
+	sh("", "-format", "yaml", "list")
+	os.WriteFile(conf, []byte(`{"namspace": "staging"}`+"\n"), 0o644)
+	sh("", "list")
+	sh("", "put", "-h")
+}
@@ -0,0 +1,284 @@
+// Testing CLI Subcommands - Run the whole program, environment and all
+//
+// run takes its arguments, environment and output as parameters, so a
+// test is one call: kv put, then kv get, with whatever environment and
+// config file the case needs, checking the exit status and both
+// outputs. Nothing touches the real environment or home directory.
+//
+// Run tests:
+//   go test -v cli.go cli_test.go
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// kvEnv is a temporary store and config file, and an environment
+// that points at them
+type kvEnv struct {
+	dir  string
+	conf string
+	env  map[string]string
+}
+
+func newKV(t *testing.T, config string) *kvEnv {
+	t.Helper()
+	dir := t.TempDir()
+	k := &kvEnv{dir: dir, conf: filepath.Join(dir, "config.json")}
+	if err := os.WriteFile(k.conf, []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	k.env = map[string]string{"KV_CONFIG": k.conf, "KV_STORE": filepath.Join(dir, "store.json")}
+	return k
+}
+
+// run runs kv with args and extra environment variables
+func (k *kvEnv) run(vars map[string]string, args ...string) (code int, stdout, stderr string) {
+	var out, errOut bytes.Buffer
+	code = run(args, func(name string) (string, bool) {
+		if v, ok := vars[name]; ok {
+			return v, true
+		}
+		v, ok := k.env[name]
+		return v, ok
+	}, &out, &errOut)
+	return code, out.String(), errOut.String()
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		name       string
+		config     string
+		vars       map[string]string
+		setup      [][]string // commands run first, which must succeed
+		args       []string
+		wantCode   int
+		wantStdout string // exact, if not empty
+		wantStderr string // substring, if not empty
+	}{
+		{name: "get", setup: [][]string{{"put", "a", "1"}}, args: []string{"get", "a"}, wantStdout: "1\n"},
+		{name: "get missing", args: []string{"get", "a"}, wantCode: 1, wantStderr: `kv get: "a": not found`},
+		{name: "get default", args: []string{"get", "-default", "", "a"}, wantStdout: "\n"},
+		{name: "get json", setup: [][]string{{"put", "a", "1"}}, args: []string{"-format", "json", "get", "a"},
+			wantStdout: `{"key":"a","value":"1"}` + "\n"},
+		{name: "put if-absent", setup: [][]string{{"put", "a", "1"}}, args: []string{"put", "-if-absent", "a", "2"},
+			wantCode: 1, wantStderr: `"a" already set`},
+		{name: "del", setup: [][]string{{"put", "a", "1"}, {"put", "b", "2"}, {"del", "a", "nope"}}, args: []string{"list"},
+			wantStdout: "b  2\n"},
+		{name: "list prefix", setup: [][]string{{"put", "ab", "1"}, {"put", "b", "2"}, {"put", "ac", "3"}},
+			args: []string{"list", "-prefix", "a"}, wantStdout: "ab  1\nac  3\n"},
+		{name: "namespaces", setup: [][]string{{"put", "a", "plain"}, {"-namespace", "ns", "put", "a", "in ns"}},
+			args: []string{"-namespace", "ns", "list"}, wantStdout: "a  in ns\n"},
+		{name: "namespace from file", config: `{"namespace": "ns"}`, setup: [][]string{{"put", "a", "1"}},
+			args: []string{"-namespace", "", "list"}, wantStdout: "ns/a  1\n"},
+
+		{name: "no command", args: nil, wantCode: 2, wantStderr: "Commands:"},
+		{name: "help", args: []string{"help"}, wantCode: 0},
+		{name: "help command", args: []string{"help", "list"}, wantCode: 0},
+		{name: "help unknown", args: []string{"help", "lst"}, wantCode: 2, wantStderr: `did you mean "list"?`},
+		{name: "-h", args: []string{"-h"}, wantCode: 0, wantStderr: "Commands:"},
+		{name: "command -h", args: []string{"get", "-h"}, wantCode: 0, wantStderr: "-default value"},
+		{name: "unknown command", args: []string{"gte", "a"}, wantCode: 2, wantStderr: `did you mean "get"?`},
+		{name: "far from any command", args: []string{"frobnicate"}, wantCode: 2, wantStderr: `unknown command "frobnicate"` + "\n"},
+		{name: "unknown flag", args: []string{"-colour", "list"}, wantCode: 2, wantStderr: "Run 'kv help' for usage"},
+		{name: "unknown command flag", args: []string{"list", "-colour"}, wantCode: 2, wantStderr: "Run 'kv help list' for usage"},
+		{name: "flag after args", args: []string{"put", "a", "b", "-if-absent"}, wantCode: 2, wantStderr: "flags go first"},
+		{name: "too many args", args: []string{"get", "a", "b"}, wantCode: 2, wantStderr: "want KEY, got 2 arguments"},
+		{name: "bad format flag", args: []string{"-format", "yaml", "list"}, wantCode: 2, wantStderr: "want one of text, json"},
+		{name: "bad format env", vars: map[string]string{"KV_FORMAT": "yaml"}, args: []string{"list"},
+			wantCode: 2, wantStderr: `$KV_FORMAT: invalid format "yaml"`},
+		{name: "bad format file", config: `{"format": "yaml"}`, args: []string{"list"},
+			wantCode: 2, wantStderr: `config.json: invalid format "yaml"`},
+		{name: "bad bool env", vars: map[string]string{"KV_VERBOSE": "maybe"}, args: []string{"list"},
+			wantCode: 2, wantStderr: "$KV_VERBOSE"},
+		{name: "unknown setting", config: `{"namspace": "x"}`, args: []string{"list"}, wantCode: 2, wantStderr: `unknown setting "namspace"`},
+		{name: "config can't name config", config: `{"config": "x"}`, args: []string{"list"}, wantCode: 2, wantStderr: `unknown setting "config"`},
+		{name: "bad JSON", config: `{"format": }`, args: []string{"list"}, wantCode: 2, wantStderr: "invalid character"},
+		{name: "help ignores a bad config", config: `{"namspace": "x"}`, args: []string{"help"}, wantCode: 0},
+		{name: "missing explicit config", vars: map[string]string{"KV_CONFIG": "/no/such/file"}, args: []string{"list"},
+			wantCode: 2, wantStderr: "no such file"},
+		{name: "verbose", vars: map[string]string{"KV_VERBOSE": "1"}, args: []string{"list"}, wantStderr: "kv: config file "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			k := newKV(t, cmp.Or(tt.config, "{}"))
+			for _, args := range tt.setup {
+				if code, _, stderr := k.run(nil, args...); code != 0 {
+					t.Fatalf("kv %s: exit %d: %s", strings.Join(args, " "), code, stderr)
+				}
+			}
+			code, stdout, stderr := k.run(tt.vars, tt.args...)
+			if code != tt.wantCode {
+				t.Errorf("exit %d, want %d; stderr:\n%s", code, tt.wantCode, stderr)
+			}
+			if tt.wantStdout != "" && stdout != tt.wantStdout {
+				t.Errorf("stdout:\n%q\nwant:\n%q", stdout, tt.wantStdout)
+			}
+			if !strings.Contains(stderr, tt.wantStderr) {
+				t.Errorf("stderr lacks %q:\n%s", tt.wantStderr, stderr)
+			}
+		})
+	}
+}
+
+// TestLayers sets the format in every combination of layers and checks
+// the highest wins, and that config reports it
+func TestLayers(t *testing.T) {
+	tests := []struct {
+		file, env, flag string
+		want, source    string
+	}{
+		{"", "", "", "text", "default"},
+		{"json", "", "", "json", "config.json"},
+		{"json", "text", "", "text", "$KV_FORMAT"},
+		{"", "json", "", "json", "$KV_FORMAT"},
+		{"text", "text", "json", "json", "flag -format"},
+		{"", "", "json", "json", "flag -format"},
+	}
+	for _, tt := range tests {
+		conf := "{}"
+		if tt.file != "" {
+			conf = `{"format": "` + tt.file + `"}`
+		}
+		k := newKV(t, conf)
+		vars := map[string]string{}
+		if tt.env != "" {
+			vars["KV_FORMAT"] = tt.env
+		}
+		// The format being tested is also the form config prints in
+		args := []string{"config"}
+		if tt.flag != "" {
+			args = append([]string{"-format", tt.flag}, args...)
+		}
+		code, stdout, stderr := k.run(vars, args...)
+		if code != 0 {
+			t.Fatalf("%+v: exit %d: %s", tt, code, stderr)
+		}
+		var got struct {
+			Format struct{ Value, Source string }
+		}
+		if tt.want == "json" {
+			if err := json.Unmarshal([]byte(stdout), &got); err != nil {
+				t.Fatalf("%+v: %v\n%s", tt, err, stdout)
+			}
+		} else {
+			for _, line := range strings.Split(stdout, "\n") {
+				if f := strings.Fields(line); len(f) == 3 && f[0] == "format" {
+					got.Format.Value, got.Format.Source = strings.Trim(f[1], `"`), f[2]
+				}
+			}
+		}
+		if got.Format.Value != tt.want || !strings.HasSuffix(got.Format.Source, tt.source) {
+			t.Errorf("file %q, env %q, flag %q: format %q from %q; want %q from %q",
+				tt.file, tt.env, tt.flag, got.Format.Value, got.Format.Source, tt.want, tt.source)
+		}
+	}
+}
+
+func TestReadConfigFile(t *testing.T) {
+	fs := newGlobalFlagSet(&config{}, new(string), nil)
+	path := filepath.Join(t.TempDir(), "c.json")
+	os.WriteFile(path, []byte(`{"verbose": true, "namespace": "n", "store": "s.json"}`), 0o644)
+	got, err := readConfigFile(path, fs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{"verbose": "true", "namespace": "n", "store": "s.json"}
+	if len(got) != len(want) {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %q, want %q", k, got[k], v)
+		}
+	}
+}
+
+func TestChoice(t *testing.T) {
+	var v string
+	c := choice{[]string{"a", "b"}, &v}
+	if err := c.Set("b"); err != nil || v != "b" {
+		t.Errorf("Set(b) = %v, value %q", err, v)
+	}
+	if err := c.Set("c"); err == nil || v != "b" {
+		t.Errorf("Set(c) = %v, value %q; want an error and no change", err, v)
+	}
+	// The flag package calls String on a zero value to tell if the
+	// default is worth printing
+	if s := (choice{}).String(); s != "" {
+		t.Errorf("zero choice = %q", s)
+	}
+}
+
+func TestWantArgs(t *testing.T) {
+	tests := []struct {
+		args  []string
+		names []string
+		want  string
+	}{
+		{[]string{"a"}, []string{"KEY"}, ""},
+		{nil, nil, ""},
+		{nil, []string{"KEY"}, "want KEY, got 0 arguments"},
+		{[]string{"a", "b"}, nil, "want no arguments, got 2"},
+		{[]string{"a", "b", "-x"}, []string{"K", "V"}, "flag -x after the arguments"},
+		{[]string{"-x"}, nil, "flag -x after the arguments"},
+	}
+	for _, tt := range tests {
+		err := wantArgs(tt.args, tt.names...)
+		var got string
+		if err != nil {
+			got = err.Error()
+			var uerr usageError
+			if !errors.As(err, &uerr) {
+				t.Errorf("wantArgs(%q) = %T, want a usageError", tt.args, err)
+			}
+		}
+		if !strings.Contains(got, tt.want) || (tt.want == "") != (err == nil) {
+			t.Errorf("wantArgs(%q, %q) = %v, want %q", tt.args, tt.names, err, tt.want)
+		}
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"get", "get", 0},
+		{"gte", "get", 2},
+		{"lst", "list", 1},
+		{"", "del", 3},
+		{"kitten", "sitting", 3},
+	}
+	for _, tt := range tests {
+		if got := editDistance(tt.a, tt.b); got != tt.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+// TestHelpCoversEverything checks the generated help names every
+// command, and every setting with its environment variable
+func TestHelpCoversEverything(t *testing.T) {
+	var out bytes.Buffer
+	printUsage(&out, nil)
+	for _, c := range commands {
+		if !strings.Contains(out.String(), "  "+c.name+" ") {
+			t.Errorf("help lacks command %s", c.name)
+		}
+	}
+	newGlobalFlagSet(&config{}, new(string), nil).VisitAll(func(f *flag.Flag) {
+		if !strings.Contains(out.String(), "-"+f.Name) || !strings.Contains(out.String(), "$"+envName(f.Name)) {
+			t.Errorf("help lacks -%s or $%s", f.Name, envName(f.Name))
+		}
+	})
+}
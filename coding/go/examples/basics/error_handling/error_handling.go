@@ -8,16 +8,41 @@
 // - Error wrapping (Go 1.13+)
 // - errors.Is and errors.As
 // - Sentinel errors
+// - Retryable vs permanent errors driving a retry loop
+// - Errors that carry a stack trace from where they originated
+// - Converting panics to errors at library and goroutine boundaries
+// - Stable error codes with a catalog of user-facing messages
+// - Collecting errors from many goroutines: first, all, or a sample
+// - Logging every link of an error chain as structured slog attributes
+// - Custom Is and As methods that match by category, not identity
+//
+// networking/http_errors.go declares errors modelled on these for the
+// API server example, and maps them to HTTP statuses.
 //
 // Usage:
 //   go run error_handling.go
+//
+// Run tests (error_handling_test.go covers the error paths):
+//   go test -v error_handling.go error_handling_test.go
 package main
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"io/fs"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
 	"os"
+	"reflect"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
 )
 
 // Sentinel errors - predefined errors for specific conditions
@@ -55,6 +80,367 @@ func (e *DatabaseError) Unwrap() error {
 	return e.Err
 }
 
+// RetryableError marks an error as transient: the same call may
+// succeed if tried again (timeouts, 503s, lock contention). Anything
+// not marked is treated as permanent.
+type RetryableError struct {
+	Err        error
+	RetryAfter time.Duration // optional server-suggested delay
+}
+
+func (e *RetryableError) Error() string {
+	return fmt.Sprintf("retryable: %v", e.Err)
+}
+
+func (e *RetryableError) Unwrap() error {
+	return e.Err
+}
+
+// TracedError records the call stack at the point an error was first
+// seen. Print it with %+v to get the frames; %v and %s print just the
+// message, so it is invisible in ordinary logs.
+type TracedError struct {
+	Err error
+	pcs []uintptr
+}
+
+// Trace wraps err with the caller's stack. Call it once, where the
+// error originates (typically right after a call into the stdlib or
+// another package). Tracing again higher up is a no-op, so the trace
+// always points at the origin rather than at the last wrapper.
+func Trace(err error) error {
+	if err == nil {
+		return nil
+	}
+	var te *TracedError
+	if errors.As(err, &te) {
+		return err // already traced: keep the original frames
+	}
+
+	pcs := make([]uintptr, 32)
+	n := runtime.Callers(2, pcs) // skip runtime.Callers and Trace itself
+	return &TracedError{Err: err, pcs: pcs[:n]}
+}
+
+func (e *TracedError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *TracedError) Unwrap() error {
+	return e.Err
+}
+
+// StackTrace resolves the captured program counters to frames. This
+// is deferred until someone asks, since most errors are never printed
+// with their stack.
+func (e *TracedError) StackTrace() []runtime.Frame {
+	var frames []runtime.Frame
+	iter := runtime.CallersFrames(e.pcs)
+	for {
+		frame, more := iter.Next()
+		frames = append(frames, frame)
+		if !more {
+			break
+		}
+	}
+	return frames
+}
+
+// Format implements fmt.Formatter so %+v prints the frames
+func (e *TracedError) Format(s fmt.State, verb rune) {
+	switch {
+	case verb == 'v' && s.Flag('+'):
+		io.WriteString(s, e.Error())
+		for _, f := range e.StackTrace() {
+			fmt.Fprintf(s, "\n    %s\n        %s:%d", f.Function, f.File, f.Line)
+		}
+	case verb == 'q':
+		fmt.Fprintf(s, "%q", e.Error())
+	default:
+		io.WriteString(s, e.Error())
+	}
+}
+
+// PanicError is a recovered panic turned into an ordinary error. The
+// stack is captured inside the deferred recover, where it still shows
+// the panicking frame.
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("recovered panic: %v", e.Value)
+}
+
+// Unwrap exposes the panic value when it was itself an error, such as
+// a runtime.Error from an out-of-range index
+func (e *PanicError) Unwrap() error {
+	if err, ok := e.Value.(error); ok {
+		return err
+	}
+	return nil
+}
+
+// ErrorCode is a stable, machine-readable identifier. Clients and
+// dashboards key off the code, so it never changes once published,
+// while the wording of messages is free to evolve.
+type ErrorCode string
+
+const (
+	CodeUserNotFound  ErrorCode = "USER_NOT_FOUND"
+	CodeQuotaExceeded ErrorCode = "QUOTA_EXCEEDED"
+	CodeInvalidEmail  ErrorCode = "INVALID_EMAIL"
+	CodeInternal      ErrorCode = "INTERNAL"
+)
+
+// messageCatalog holds client-safe templates per code. {name}
+// placeholders are filled from CodedError.Params. A real service
+// would load one catalog per locale.
+var messageCatalog = map[ErrorCode]string{
+	CodeUserNotFound:  "We couldn't find a user named {user}.",
+	CodeQuotaExceeded: "You've used all {limit} requests for this hour. Please try again after {reset}.",
+	CodeInvalidEmail:  "{email} doesn't look like a valid email address.",
+	CodeInternal:      "Something went wrong on our side. Please try again later.",
+}
+
+// CodedError separates what the client sees (Code, and the catalog
+// message rendered from Params) from what developers see (Detail and
+// the wrapped cause, which may mention tables, hosts or queries)
+type CodedError struct {
+	Code   ErrorCode
+	Params map[string]string
+	Detail string
+	Err    error
+}
+
+// Error is the developer-facing text for logs
+func (e *CodedError) Error() string {
+	msg := fmt.Sprintf("[%s] %s", e.Code, e.Detail)
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+func (e *CodedError) Unwrap() error {
+	return e.Err
+}
+
+// lookupMessage renders the catalog template for code. Unknown codes
+// and missing params fall back to safe text rather than leaking a raw
+// template or internal detail. All placeholders are replaced in one
+// pass, so a value that itself contains "{reset}" is left as it is
+// instead of being expanded or not depending on map order.
+func lookupMessage(code ErrorCode, params map[string]string) string {
+	tmpl, ok := messageCatalog[code]
+	if !ok {
+		tmpl = messageCatalog[CodeInternal]
+	}
+	fill := make([]string, 0, 2*len(params))
+	blank := make([]string, 0, 2*len(params))
+	for k, v := range params {
+		fill = append(fill, "{"+k+"}", v)
+		blank = append(blank, "{"+k+"}", "")
+	}
+	// A placeholder left in the template, not in the output, is a
+	// missing param: values may contain braces
+	if strings.Contains(strings.NewReplacer(blank...).Replace(tmpl), "{") {
+		return messageCatalog[CodeInternal]
+	}
+	return strings.NewReplacer(fill...).Replace(tmpl)
+}
+
+// UserFacing returns the code and message to send to a client for any
+// error. Errors without a code are internal by definition.
+func UserFacing(err error) (ErrorCode, string) {
+	var ce *CodedError
+	if errors.As(err, &ce) {
+		return ce.Code, lookupMessage(ce.Code, ce.Params)
+	}
+	return CodeInternal, lookupMessage(CodeInternal, nil)
+}
+
+// errorSampler keeps the first limit errors reported by concurrent
+// goroutines and only counts the rest, so a failure storm can't grow
+// memory or produce a multi-megabyte log line
+type errorSampler struct {
+	mu    sync.Mutex
+	limit int
+	errs  []error
+	total int
+}
+
+func (s *errorSampler) Add(err error) {
+	if err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.total++
+	if len(s.errs) < s.limit {
+		s.errs = append(s.errs, err)
+	}
+}
+
+// Err joins the sampled errors and notes how many were left out
+func (s *errorSampler) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.total == 0 {
+		return nil
+	}
+	errs := s.errs
+	if omitted := s.total - len(s.errs); omitted > 0 {
+		errs = append(errs[:len(errs):len(errs)], fmt.Errorf("... and %d more errors", omitted))
+	}
+	return errors.Join(errs...)
+}
+
+// Status-class sentinels. No error is ever created from these directly;
+// StatusError.Is matches them by range, so callers can ask "was it the
+// client's fault?" without listing every 4xx code.
+var (
+	ErrClientError = errors.New("client error (4xx)")
+	ErrServerError = errors.New("server error (5xx)")
+)
+
+// StatusError is a failed HTTP response from an upstream service
+type StatusError struct {
+	Code       int
+	URL        string
+	RetryAfter time.Duration // from the Retry-After header, if any
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("%s: %d %s", e.URL, e.Code, http.StatusText(e.Code))
+}
+
+// Is customizes errors.Is. By default Is compares with ==, which would
+// only match this exact pointer. Here it matches:
+//   - ErrClientError / ErrServerError by status range
+//   - any *StatusError with the same code, so a test can write
+//     errors.Is(err, &StatusError{Code: 404})
+// errors.Is walks the chain itself, so Is only judges this one link.
+func (e *StatusError) Is(target error) bool {
+	switch target {
+	case ErrClientError:
+		return e.Code >= 400 && e.Code < 500
+	case ErrServerError:
+		return e.Code >= 500
+	}
+	if t, ok := target.(*StatusError); ok {
+		return t.Code == e.Code
+	}
+	return false
+}
+
+// As customizes errors.As, letting a StatusError present itself as a
+// *RetryableError for codes that are worth retrying. The retry loop
+// and IsRetryable then work unchanged, with no explicit Retryable(...)
+// wrap at every call site. As must set target only when it returns true.
+func (e *StatusError) As(target any) bool {
+	re, ok := target.(**RetryableError)
+	if !ok {
+		return false
+	}
+	switch e.Code {
+	case http.StatusTooManyRequests, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		*re = &RetryableError{Err: e, RetryAfter: e.RetryAfter}
+		return true
+	}
+	return false
+}
+
+// ErrorChainAttr walks err's chain and returns one "error" group with
+// an entry per link: its Go type, the text it added, and the code or
+// stack if the link carries one. Log aggregators can then filter on
+// error.chain.N.type or error.chain.N.code instead of grepping a
+// single concatenated message.
+func ErrorChainAttr(err error) slog.Attr {
+	if err == nil {
+		return slog.Attr{}
+	}
+
+	var links []any
+	queue := []error{err}
+	for len(queue) > 0 {
+		e := queue[0]
+		queue = queue[1:]
+
+		var next []error
+		switch u := e.(type) {
+		case interface{ Unwrap() error }:
+			if inner := u.Unwrap(); inner != nil {
+				next = []error{inner}
+			}
+		case interface{ Unwrap() []error }:
+			next = u.Unwrap() // errors.Join and friends
+		}
+
+		attrs := []any{
+			slog.String("type", reflect.TypeOf(e).String()),
+			slog.String("msg", ownMessage(e, next)),
+		}
+		switch v := e.(type) {
+		case *CodedError:
+			attrs = append(attrs, slog.String("code", string(v.Code)))
+		case *TracedError:
+			attrs = append(attrs, slog.Any("stack", stackStrings(v, 5)))
+		}
+		links = append(links, slog.Group(fmt.Sprint(len(links)), attrs...))
+		queue = append(queue, next...)
+	}
+
+	return slog.Group("error",
+		slog.String("msg", err.Error()),
+		slog.Group("chain", links...),
+	)
+}
+
+// ownMessage strips the wrapped error's text from e's message, leaving
+// only what this link contributed ("load config" rather than the whole
+// "load config: parse x: open x: no such file")
+func ownMessage(e error, wrapped []error) string {
+	msg := e.Error()
+	if len(wrapped) != 1 {
+		return msg
+	}
+	inner := wrapped[0].Error()
+	if msg == inner {
+		return "" // transparent wrapper such as TracedError
+	}
+	return strings.TrimSuffix(strings.TrimSuffix(msg, inner), ": ")
+}
+
+// stackStrings formats at most n frames as "function file:line"
+func stackStrings(e *TracedError, n int) []string {
+	var out []string
+	for _, f := range e.StackTrace() {
+		if len(out) == n {
+			break
+		}
+		out = append(out, fmt.Sprintf("%s %s:%d", f.Function, f.File, f.Line))
+	}
+	return out
+}
+
+// Retryable wraps err as transient; nil stays nil
+func Retryable(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &RetryableError{Err: err}
+}
+
+// IsRetryable reports whether any error in the chain is marked
+// transient, so wrapping with fmt.Errorf("...: %w") keeps the mark
+func IsRetryable(err error) bool {
+	var re *RetryableError
+	return errors.As(err, &re)
+}
+
 func main() {
 	fmt.Println("=== Error Handling in Go ===")
 	fmt.Println()
@@ -160,6 +546,176 @@ func main() {
 	} else {
 		fmt.Printf("Fetched %d bytes\n", len(data))
 	}
+
+	fmt.Println()
+	fmt.Println("7. Retryable vs Permanent Errors")
+	fmt.Println("--------------------------------")
+
+	ctx := context.Background()
+
+	// Transient failures are retried with backoff until success
+	flaky := &flakyService{failuresLeft: 2}
+	err = retry(ctx, 5, 50*time.Millisecond, flaky.Call)
+	fmt.Printf("Flaky service: err=%v after %d calls\n", err, flaky.calls)
+
+	// A permanent error stops the loop on the first attempt
+	denied := &flakyService{permanent: ErrUnauthorized}
+	err = retry(ctx, 5, 50*time.Millisecond, denied.Call)
+	fmt.Printf("Denied service: err=%v after %d calls\n", err, denied.calls)
+
+	// Retries are bounded: give up and report the last error
+	down := &flakyService{failuresLeft: 100}
+	err = retry(ctx, 3, 20*time.Millisecond, down.Call)
+	fmt.Printf("Down service: err=%v after %d calls\n", err, down.calls)
+	fmt.Printf("  still retryable (caller may try later): %v\n", IsRetryable(err))
+
+	fmt.Println()
+	fmt.Println("8. Stack Traces")
+	fmt.Println("---------------")
+
+	err = loadConfig("missing.yaml")
+
+	// %v stays a one-line message, suitable for users and log lines
+	fmt.Printf("Error: %v\n", err)
+
+	// fmt.Errorf's wrapper doesn't forward %+v, so find the traced
+	// error in the chain and print it explicitly
+	var traced *TracedError
+	if errors.As(err, &traced) {
+		fmt.Printf("Trace (origin only):\n%+v\n", traced)
+	}
+
+	fmt.Println()
+	fmt.Println("9. Panics to Errors")
+	fmt.Println("-------------------")
+
+	// At a library boundary: a bug in a plugin becomes an error
+	for _, input := range []string{"a,b,c", "a"} {
+		fields, err := parseThirdField(input)
+		if err != nil {
+			fmt.Printf("parseThirdField(%q): %v\n", input, err)
+
+			var pe *PanicError
+			if errors.As(err, &pe) {
+				// The stack is there for the logs, not the user
+				fmt.Printf("  stack captured: %d bytes\n", len(pe.Stack))
+			}
+			var rtErr runtime.Error
+			if errors.As(err, &rtErr) {
+				fmt.Println("  -> a runtime.Error: this is a bug, not bad input")
+			}
+			continue
+		}
+		fmt.Printf("parseThirdField(%q) = %q\n", input, fields)
+	}
+
+	// At the top of a goroutine: an unrecovered panic there kills the
+	// whole process, so background workers report it instead
+	errs := make(chan error, 3)
+	for i := 1; i <= 3; i++ {
+		goSafe(func() { riskyJob(i) }, errs)
+	}
+	for i := 0; i < 3; i++ {
+		if err := <-errs; err != nil {
+			fmt.Printf("goroutine failed: %v\n", err)
+		} else {
+			fmt.Println("goroutine finished")
+		}
+	}
+
+	// When NOT to recover:
+	// - Inside ordinary functions as a substitute for returning errors
+	// - To hide bugs: log the stack and fix the code, don't retry
+	// - Across a whole program: a corrupted invariant is best met by
+	//   crashing and restarting clean
+
+	fmt.Println()
+	fmt.Println("10. Error Codes and Message Catalog")
+	fmt.Println("-----------------------------------")
+
+	for _, err := range []error{
+		lookupAccount("mallory"),
+		checkQuota("alice", 1000),
+		&CodedError{Code: CodeInvalidEmail, Params: map[string]string{"email": "bob@"}, Detail: "missing domain"},
+		fmt.Errorf("render page: %w", errors.New("template: nil pointer evaluating .User.Name")),
+	} {
+		code, msg := UserFacing(err)
+		fmt.Printf("Log:    %v\n", err)
+		fmt.Printf("Client: {\"code\": %q, \"message\": %q}\n\n", code, msg)
+	}
+
+	fmt.Println("11. Collecting Errors from Goroutines")
+	fmt.Println("-------------------------------------")
+
+	hosts := make([]string, 20)
+	for i := range hosts {
+		hosts[i] = fmt.Sprintf("host-%02d", i)
+	}
+
+	// First error wins: the first failure cancels the shared context,
+	// so the rest stop early. Good when any failure
+	// makes the whole operation useless (e.g. assembling one response).
+	start := time.Now()
+	err = firstError(context.Background(), hosts)
+	fmt.Printf("First error (%v): %v\n", time.Since(start).Round(10*time.Millisecond), err)
+
+	// Collect all: every task runs to completion and all failures are
+	// reported. Good for batch jobs and validation, where the caller
+	// wants the full list to fix in one go.
+	start = time.Now()
+	err = collectAll(context.Background(), hosts)
+	fmt.Printf("All errors (%v):\n%v\n", time.Since(start).Round(10*time.Millisecond), err)
+
+	// Bounded sample: like collect-all, but memory and output stay
+	// fixed no matter how many tasks fail
+	sampler := &errorSampler{limit: 3}
+	var wg sync.WaitGroup
+	for _, h := range hosts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sampler.Add(checkHost(context.Background(), h))
+		}()
+	}
+	wg.Wait()
+	fmt.Printf("Sampled errors:\n%v\n", sampler.Err())
+
+	fmt.Println()
+	fmt.Println("12. Structured Logging of Error Chains")
+	fmt.Println("--------------------------------------")
+
+	// A JSON logger as it would run in production. The handler logs the
+	// full chain for operators and sends only the catalog message to
+	// the client.
+	logger := slog.New(slog.NewJSONHandler(os.Stdout, nil))
+	handler := accountHandler(logger)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/accounts/mallory", nil))
+	fmt.Printf("Response: %d %s", rec.Code, rec.Body.String())
+
+	fmt.Println()
+	fmt.Println("13. Custom Is and As")
+	fmt.Println("--------------------")
+
+	fmt.Printf("%-6s %-6s %-6s %-6s %s\n", "Code", "4xx?", "5xx?", "404?", "Retryable")
+	for _, code := range []int{404, 429, 500, 503} {
+		err := callUpstream("https://api.example.com/items", code)
+
+		retry := "no"
+		var re *RetryableError
+		if errors.As(err, &re) { // satisfied by StatusError.As
+			retry = "yes"
+			if re.RetryAfter > 0 {
+				retry += fmt.Sprintf(" (after %v)", re.RetryAfter)
+			}
+		}
+		fmt.Printf("%-6d %-6v %-6v %-6v %s\n", code,
+			errors.Is(err, ErrClientError),
+			errors.Is(err, ErrServerError),
+			errors.Is(err, &StatusError{Code: http.StatusNotFound}),
+			retry)
+	}
 }
 
 // Basic error creation
@@ -230,3 +786,279 @@ func fetchData(url string) ([]byte, error) {
 	}
 	return []byte("simulated data"), nil
 }
+
+// flakyService fails with a retryable error failuresLeft times, or
+// always with a permanent error, before succeeding
+type flakyService struct {
+	failuresLeft int
+	permanent    error
+	calls        int
+}
+
+func (s *flakyService) Call() error {
+	s.calls++
+	if s.permanent != nil {
+		return fmt.Errorf("call service: %w", s.permanent)
+	}
+	if s.failuresLeft > 0 {
+		s.failuresLeft--
+		return fmt.Errorf("call service: %w", Retryable(errors.New("503 service unavailable")))
+	}
+	return nil
+}
+
+// retry calls op until it succeeds, returns a permanent error, or runs
+// out of attempts. The wait doubles each time, with jitter so many
+// clients don't retry in lockstep, and honours RetryAfter when set.
+// A baseDelay of zero retries at once, which is handy in tests.
+func retry(ctx context.Context, attempts int, baseDelay time.Duration, op func() error) error {
+	var err error
+	delay := baseDelay
+
+	for attempt := 1; attempt <= attempts; attempt++ {
+		err = op()
+		if err == nil {
+			return nil
+		}
+
+		// The classification decides the control flow
+		if !IsRetryable(err) {
+			return fmt.Errorf("permanent failure on attempt %d: %w", attempt, err)
+		}
+		if attempt == attempts {
+			break
+		}
+
+		// rand.Int63n panics on 0, so a zero delay gets no jitter
+		var wait time.Duration
+		if delay > 0 {
+			wait = delay/2 + time.Duration(rand.Int63n(int64(delay)))
+		}
+		var re *RetryableError
+		if errors.As(err, &re) && re.RetryAfter > 0 {
+			wait = re.RetryAfter
+		}
+		fmt.Printf("  attempt %d failed (%v), retrying in %v\n",
+			attempt, err, wait.Round(time.Millisecond))
+
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return fmt.Errorf("retry aborted: %w", ctx.Err())
+		}
+		delay *= 2
+	}
+
+	return fmt.Errorf("gave up after %d attempts: %w", attempts, err)
+}
+
+// loadConfig -> parseConfig -> readConfigFile. Only the lowest level
+// calls Trace; the others add context with fmt.Errorf as usual.
+func loadConfig(path string) error {
+	if err := parseConfig(path); err != nil {
+		return fmt.Errorf("load config: %w", err)
+	}
+	return nil
+}
+
+func parseConfig(path string) error {
+	data, err := readConfigFile(path)
+	if err != nil {
+		// Trace here would be a no-op: the error already has a trace.
+		// Adding traces at every level is the usual mistake - it costs
+		// a runtime.Callers per layer and buries the real origin.
+		return fmt.Errorf("parse %s: %w", path, Trace(err))
+	}
+	if strings.TrimSpace(string(data)) == "" {
+		// A new error is an origin too, so it gets its own trace
+		return Trace(fmt.Errorf("parse %s: empty config", path))
+	}
+	return nil
+}
+
+func readConfigFile(path string) ([]byte, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		// The origin: the error crosses from the stdlib into our code
+		return nil, Trace(err)
+	}
+	return data, nil
+}
+
+// safeCall runs fn and turns a panic into a *PanicError. The named
+// result is what lets the deferred function replace the return value.
+func safeCall(fn func() error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{Value: r, Stack: debug.Stack()}
+		}
+	}()
+	return fn()
+}
+
+// goSafe starts fn in a goroutine and sends exactly one value on errs:
+// nil on success or a *PanicError if fn panicked
+func goSafe(fn func(), errs chan<- error) {
+	go func() {
+		errs <- safeCall(func() error {
+			fn()
+			return nil
+		})
+	}()
+}
+
+// parseThirdField is the public boundary of a "library" whose
+// internals panic on bad input instead of returning an error
+func parseThirdField(input string) (string, error) {
+	var field string
+	err := safeCall(func() error {
+		field = strings.Split(input, ",")[2] // panics if there are fewer fields
+		return nil
+	})
+	return field, err
+}
+
+func riskyJob(id int) {
+	if id == 2 {
+		var counts map[string]int
+		counts["boom"]++ // assignment to entry in nil map
+	}
+	time.Sleep(10 * time.Millisecond)
+}
+
+// lookupAccount wraps a low-level sentinel in a coded error: the log
+// keeps the query detail, the client gets the catalog message
+func lookupAccount(name string) error {
+	_, err := findUser(name)
+	if errors.Is(err, ErrNotFound) {
+		return &CodedError{
+			Code:   CodeUserNotFound,
+			Params: map[string]string{"user": name},
+			Detail: "SELECT id FROM accounts WHERE name = $1 returned no rows",
+			Err:    err,
+		}
+	}
+	return err
+}
+
+func checkQuota(user string, limit int) error {
+	reset := time.Date(2024, 1, 1, 15, 0, 0, 0, time.UTC)
+	return fmt.Errorf("handle request: %w", &CodedError{
+		Code:   CodeQuotaExceeded,
+		Params: map[string]string{"limit": fmt.Sprint(limit), "reset": reset.Format(time.Kitchen)},
+		Detail: fmt.Sprintf("user %s hit rate limiter bucket api:%s", user, user),
+	})
+}
+
+// callUpstream simulates an HTTP call that failed with code
+func callUpstream(url string, code int) error {
+	se := &StatusError{Code: code, URL: url}
+	if code == http.StatusTooManyRequests {
+		se.RetryAfter = 2 * time.Second
+	}
+	return fmt.Errorf("sync inventory: %w", se)
+}
+
+// checkHost fails for every third host after a short delay, or gives
+// up early if ctx is cancelled
+func checkHost(ctx context.Context, host string) error {
+	var n int
+	fmt.Sscanf(host, "host-%d", &n)
+
+	select {
+	case <-time.After(time.Duration(20+n*10) * time.Millisecond):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if n%3 == 0 {
+		return fmt.Errorf("check %s: %w", host, os.ErrDeadlineExceeded)
+	}
+	return nil
+}
+
+// firstError returns the first failure; the other checks see their
+// context cancelled and return without finishing. This is what
+// golang.org/x/sync/errgroup.WithContext does: only the first error is
+// kept, under a mutex, and keeping it cancels the rest.
+func firstError(ctx context.Context, hosts []string) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		mu    sync.Mutex
+		first error
+		wg    sync.WaitGroup
+	)
+	for _, h := range hosts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := checkHost(ctx, h); err != nil {
+				mu.Lock()
+				if first == nil {
+					first = err
+					cancel()
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return first
+}
+
+// collectAll runs every check and joins all failures. The slice is
+// shared, so appends are guarded by a mutex.
+func collectAll(ctx context.Context, hosts []string) error {
+	var (
+		mu   sync.Mutex
+		errs []error
+		wg   sync.WaitGroup
+	)
+	for _, h := range hosts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := checkHost(ctx, h); err != nil {
+				mu.Lock()
+				errs = append(errs, err)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...) // nil if errs is empty
+}
+
+// accountHandler is a demo endpoint whose failures are logged with
+// ErrorChainAttr and answered with UserFacing
+func accountHandler(logger *slog.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := strings.TrimPrefix(r.URL.Path, "/accounts/")
+		if err := loadAccountProfile(name); err != nil {
+			logger.ErrorContext(r.Context(), "request failed",
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				ErrorChainAttr(err),
+			)
+
+			code, msg := UserFacing(err)
+			status := http.StatusInternalServerError
+			if code == CodeUserNotFound {
+				status = http.StatusNotFound
+			}
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(status)
+			fmt.Fprintf(w, "{\"code\": %q, \"message\": %q}\n", code, msg)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func loadAccountProfile(name string) error {
+	if err := lookupAccount(name); err != nil {
+		return fmt.Errorf("load profile %q: %w", name, Trace(err))
+	}
+	return nil
+}
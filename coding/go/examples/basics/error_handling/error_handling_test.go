@@ -0,0 +1,383 @@
+// Testing Error Paths - Tests for the error handling examples
+//
+// Error paths deserve the same coverage as happy paths. These tests
+// show the usual techniques:
+// - Compare with errors.Is, never with == or by matching err.Error()
+// - Extract typed errors with errors.As and assert on their fields
+// - Check the shape of a wrapped chain, not just its final message
+//
+// Run tests:
+//   go test -v error_handling.go error_handling_test.go
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+	"testing"
+	"time"
+)
+
+// chainDepth counts the links in err's Unwrap chain, err included
+func chainDepth(err error) int {
+	depth := 0
+	for err != nil {
+		depth++
+		err = errors.Unwrap(err)
+	}
+	return depth
+}
+
+func TestFindUser(t *testing.T) {
+	tests := []struct {
+		name     string
+		username string
+		want     string
+		wantErr  error
+	}{
+		{"existing user", "bob", "Bob Smith", nil},
+		{"another user", "carol", "Carol Jones", nil},
+		{"unknown user", "alice", "", ErrNotFound},
+		{"empty name", "", "", ErrNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := findUser(tt.username)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("findUser(%q) error = %v, want %v", tt.username, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("findUser(%q) = %q, want %q", tt.username, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidateEmail(t *testing.T) {
+	tests := []struct {
+		name      string
+		email     string
+		wantField string // empty means no error expected
+	}{
+		{"valid", "user@example.com", ""},
+		{"too short", "a@b", "email"},
+		{"leading at", "@example.com", "email"},
+		{"empty", "", "email"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateEmail(tt.email)
+			if tt.wantField == "" {
+				if err != nil {
+					t.Fatalf("validateEmail(%q) = %v, want nil", tt.email, err)
+				}
+				return
+			}
+
+			var valErr *ValidationError
+			if !errors.As(err, &valErr) {
+				t.Fatalf("validateEmail(%q) = %v (%T), want *ValidationError", tt.email, err, err)
+			}
+			if valErr.Field != tt.wantField {
+				t.Errorf("Field = %q, want %q", valErr.Field, tt.wantField)
+			}
+			if valErr.Message == "" {
+				t.Error("Message is empty")
+			}
+		})
+	}
+}
+
+func TestErrorChains(t *testing.T) {
+	tests := []struct {
+		name      string
+		err       error
+		wantIs    []error
+		wantNotIs []error
+		wantDepth int
+	}{
+		{
+			name:      "database error wraps sentinel",
+			err:       performDatabaseOperation(),
+			wantIs:    []error{ErrNotFound},
+			wantNotIs: []error{ErrUnauthorized, ErrInvalidInput},
+			wantDepth: 3, // fmt wrapper -> *DatabaseError -> ErrNotFound
+		},
+		{
+			name:      "file error wraps fs.ErrNotExist",
+			err:       processFile("does-not-exist.txt"),
+			wantIs:    []error{fs.ErrNotExist},
+			wantNotIs: []error{ErrNotFound},
+			wantDepth: 3, // fmt wrapper -> *fs.PathError -> syscall.Errno
+		},
+		{
+			name:      "retryable keeps its cause",
+			err:       fmt.Errorf("call: %w", Retryable(fmt.Errorf("dial: %w", ErrUnauthorized))),
+			wantIs:    []error{ErrUnauthorized},
+			wantDepth: 4,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, target := range tt.wantIs {
+				if !errors.Is(tt.err, target) {
+					t.Errorf("errors.Is(%v, %v) = false, want true", tt.err, target)
+				}
+			}
+			for _, target := range tt.wantNotIs {
+				if errors.Is(tt.err, target) {
+					t.Errorf("errors.Is(%v, %v) = true, want false", tt.err, target)
+				}
+			}
+			if got := chainDepth(tt.err); got != tt.wantDepth {
+				t.Errorf("chain depth = %d, want %d", got, tt.wantDepth)
+			}
+		})
+	}
+}
+
+func TestDatabaseErrorAs(t *testing.T) {
+	err := performDatabaseOperation()
+
+	var dbErr *DatabaseError
+	if !errors.As(err, &dbErr) {
+		t.Fatalf("errors.As(%v, *DatabaseError) = false", err)
+	}
+	if dbErr.Operation != "SELECT" || dbErr.Table != "users" {
+		t.Errorf("got %s on %s, want SELECT on users", dbErr.Operation, dbErr.Table)
+	}
+
+	// A type that isn't in the chain must not match
+	var valErr *ValidationError
+	if errors.As(err, &valErr) {
+		t.Errorf("errors.As matched *ValidationError in %v", err)
+	}
+}
+
+func TestIsRetryable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil", nil, false},
+		{"plain", ErrNotFound, false},
+		{"retryable", Retryable(ErrNotFound), true},
+		{"wrapped retryable", fmt.Errorf("fetch: %w", Retryable(ErrNotFound)), true},
+		{"joined", errors.Join(ErrInvalidInput, Retryable(ErrNotFound)), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsRetryable(tt.err); got != tt.want {
+				t.Errorf("IsRetryable(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+
+	if Retryable(nil) != nil {
+		t.Error("Retryable(nil) != nil")
+	}
+}
+
+func TestRetryZeroDelay(t *testing.T) {
+	// A zero base delay means "retry at once", not a panic in the jitter
+	calls := 0
+	err := retry(context.Background(), 3, 0, func() error {
+		calls++
+		return Retryable(errors.New("flaky"))
+	})
+	if calls != 3 || err == nil || !IsRetryable(err) {
+		t.Errorf("retry made %d calls and returned %v; want 3 calls and the retryable error", calls, err)
+	}
+}
+
+func TestTraceKeepsOrigin(t *testing.T) {
+	first := Trace(ErrNotFound)
+	again := Trace(fmt.Errorf("outer: %w", first))
+
+	var te *TracedError
+	if !errors.As(again, &te) {
+		t.Fatal("traced error lost")
+	}
+	if te != first {
+		t.Error("Trace replaced the original trace instead of keeping it")
+	}
+	if !errors.Is(again, ErrNotFound) {
+		t.Error("Trace hid the wrapped sentinel")
+	}
+	if Trace(nil) != nil {
+		t.Error("Trace(nil) != nil")
+	}
+}
+
+func TestSafeCall(t *testing.T) {
+	tests := []struct {
+		name      string
+		fn        func() error
+		wantPanic bool
+		wantIs    error
+	}{
+		{"success", func() error { return nil }, false, nil},
+		{"returned error", func() error { return ErrInvalidInput }, false, ErrInvalidInput},
+		{"panic with value", func() error { panic("boom") }, true, nil},
+		{"panic with error", func() error { panic(ErrAlreadyExists) }, true, ErrAlreadyExists},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := safeCall(tt.fn)
+
+			var pe *PanicError
+			if got := errors.As(err, &pe); got != tt.wantPanic {
+				t.Fatalf("got PanicError = %v, want %v (err = %v)", got, tt.wantPanic, err)
+			}
+			if tt.wantIs != nil && !errors.Is(err, tt.wantIs) {
+				t.Errorf("errors.Is(%v, %v) = false", err, tt.wantIs)
+			}
+			if tt.wantPanic && len(pe.Stack) == 0 {
+				t.Error("PanicError has no stack")
+			}
+		})
+	}
+}
+
+func TestUserFacing(t *testing.T) {
+	tests := []struct {
+		name     string
+		err      error
+		wantCode ErrorCode
+		wantMsg  string
+	}{
+		{
+			name:     "coded error",
+			err:      lookupAccount("mallory"),
+			wantCode: CodeUserNotFound,
+			wantMsg:  "We couldn't find a user named mallory.",
+		},
+		{
+			name:     "wrapped coded error",
+			err:      checkQuota("alice", 10),
+			wantCode: CodeQuotaExceeded,
+		},
+		{
+			name:     "missing param falls back",
+			err:      &CodedError{Code: CodeInvalidEmail},
+			wantCode: CodeInvalidEmail,
+			wantMsg:  messageCatalog[CodeInternal],
+		},
+		{
+			// Filled in one pass: the value's {reset} is not a placeholder
+			name:     "param containing a placeholder",
+			err:      &CodedError{Code: CodeQuotaExceeded, Params: map[string]string{"limit": "{reset}", "reset": "noon"}},
+			wantCode: CodeQuotaExceeded,
+			wantMsg:  "You've used all {reset} requests for this hour. Please try again after noon.",
+		},
+		{
+			name:     "braces in a value are not a missing param",
+			err:      &CodedError{Code: CodeInvalidEmail, Params: map[string]string{"email": "{x}@example.com"}},
+			wantCode: CodeInvalidEmail,
+			wantMsg:  "{x}@example.com doesn't look like a valid email address.",
+		},
+		{
+			name:     "uncoded error is internal",
+			err:      errors.New("pq: relation \"accounts\" does not exist"),
+			wantCode: CodeInternal,
+			wantMsg:  messageCatalog[CodeInternal],
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, msg := UserFacing(tt.err)
+			if code != tt.wantCode {
+				t.Errorf("code = %s, want %s", code, tt.wantCode)
+			}
+			if tt.wantMsg != "" && msg != tt.wantMsg {
+				t.Errorf("message = %q, want %q", msg, tt.wantMsg)
+			}
+			// Developer detail must never reach the client
+			var ce *CodedError
+			if errors.As(tt.err, &ce) && ce.Detail != "" && strings.Contains(msg, ce.Detail) {
+				t.Errorf("message %q leaks detail %q", msg, ce.Detail)
+			}
+		})
+	}
+}
+
+func TestErrorSampler(t *testing.T) {
+	s := &errorSampler{limit: 2}
+	if s.Err() != nil {
+		t.Fatalf("empty sampler Err() = %v, want nil", s.Err())
+	}
+
+	for i := 0; i < 5; i++ {
+		s.Add(fmt.Errorf("task %d: %w", i, ErrInvalidInput))
+	}
+	s.Add(nil) // ignored
+
+	err := s.Err()
+	if !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("errors.Is(%v, ErrInvalidInput) = false", err)
+	}
+	if !strings.Contains(err.Error(), "and 3 more") {
+		t.Errorf("Err() = %q, want it to mention 3 omitted errors", err)
+	}
+}
+
+func TestFirstError(t *testing.T) {
+	hosts := []string{"host-01", "host-02", "host-03", "host-30"}
+	start := time.Now()
+	err := firstError(context.Background(), hosts)
+	// host-03 fails at 50ms; host-30 would take 320ms but is cancelled
+	if err == nil || !strings.Contains(err.Error(), "host-03") {
+		t.Errorf("firstError = %v, want host-03's failure", err)
+	}
+	if errors.Is(err, context.Canceled) {
+		t.Errorf("firstError = %v: a cancelled check replaced the first error", err)
+	}
+	if d := time.Since(start); d > 250*time.Millisecond {
+		t.Errorf("firstError took %v: the slow check wasn't cancelled", d)
+	}
+	if err := firstError(context.Background(), []string{"host-01", "host-02"}); err != nil {
+		t.Errorf("no failures: firstError = %v", err)
+	}
+}
+
+func TestStatusErrorIsAs(t *testing.T) {
+	tests := []struct {
+		code      int
+		wantIs    []error
+		wantNotIs []error
+		retryable bool
+	}{
+		{404, []error{ErrClientError, &StatusError{Code: 404}}, []error{ErrServerError, &StatusError{Code: 500}}, false},
+		{429, []error{ErrClientError}, []error{ErrServerError}, true},
+		{500, []error{ErrServerError}, []error{ErrClientError}, false},
+		{503, []error{ErrServerError, &StatusError{Code: 503}}, []error{ErrClientError}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.code), func(t *testing.T) {
+			err := callUpstream("http://test", tt.code)
+			for _, target := range tt.wantIs {
+				if !errors.Is(err, target) {
+					t.Errorf("errors.Is(%v, %v) = false, want true", err, target)
+				}
+			}
+			for _, target := range tt.wantNotIs {
+				if errors.Is(err, target) {
+					t.Errorf("errors.Is(%v, %v) = true, want false", err, target)
+				}
+			}
+			if got := IsRetryable(err); got != tt.retryable {
+				t.Errorf("IsRetryable(%v) = %v, want %v", err, got, tt.retryable)
+			}
+		})
+	}
+}
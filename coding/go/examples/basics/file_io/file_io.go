@@ -0,0 +1,594 @@
+// File I/O - Reading, writing and replacing files safely
+//
+// os.ReadFile and os.WriteFile are right for small files and wrong in
+// four common situations: a file too big to hold in memory, many
+// small writes, a file that readers may be reading while it's
+// replaced, and a file that several writers update.
+//
+// This example demonstrates:
+//   - Reading a large file a line at a time with bufio.Scanner, and
+//     the 64 KB line limit that stops it without a word unless Err is
+//     checked. Raising the limit with Buffer; a custom SplitFunc
+//   - Buffered writes: why a bufio.Writer needs Flush, why its errors
+//     only show up there, and why Close's error matters too
+//   - Replacing a file atomically: write a temporary file in the same
+//     directory, Sync, rename. A reader sees the old file or the new
+//     one, never half of either; os.WriteFile can't promise that
+//   - Locking: what rename doesn't solve (two read-modify-write
+//     updaters lose updates), a portable lock file, and its stale-lock
+//     problem
+//   - Temporary files and directories, and cleaning them up
+//
+// networking/file_transfer.go and networking/url_shortener.go save
+// their state by writing path+".tmp" and renaming it; WriteFileAtomic
+// is that with the steps they leave out.
+//
+// Usage:
+//   go run file_io.go
+//
+// Run tests:
+//   go test -v file_io.go file_io_test.go
+//   go test -run=^$ -bench=. -benchmem file_io.go file_io_test.go
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"iter"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ============================================================
+// 1. Reading line by line
+// ============================================================
+
+// countLines counts the lines in r and measures the longest, holding
+// one line at a time however big r is. A line longer than maxLine
+// stops the scan with bufio.ErrTooLong
+func countLines(r io.Reader, maxLine int) (lines, longest int, err error) {
+	sc := bufio.NewScanner(r)
+	// The buffer grows as needed up to the max, which must leave room
+	// for the newline, hence the +1. Without this call the max is
+	// bufio.MaxScanTokenSize, 64 KB. The initial buffer's capacity is a
+	// max too, whichever is larger, so it mustn't exceed this one
+	limit := maxLine + 1
+	sc.Buffer(make([]byte, 0, min(64<<10, limit)), limit)
+	for sc.Scan() {
+		lines++
+		longest = max(longest, len(sc.Bytes())) // Bytes: no copy, unlike Text
+	}
+	// Scan returns false at the end and on an error alike. Only Err
+	// tells them apart; without it a scan cut short looks finished
+	return lines, longest, sc.Err()
+}
+
+// scanNull is a SplitFunc for NUL-separated records, as written by
+// find -print0: file names can hold newlines but not NUL. A SplitFunc
+// returns how far to advance and the token, or 0, nil, nil to ask for
+// more data
+func scanNull(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+	if atEOF && len(data) > 0 {
+		return len(data), data, nil // the last record, unterminated
+	}
+	return 0, nil, nil
+}
+
+// ============================================================
+// 2. Buffered writing
+// ============================================================
+
+// writeLines writes lines to path through a bufio.Writer. Its writes
+// don't fail one at a time: the first error is kept, every later
+// write does nothing and returns it, and Flush returns it too. So the
+// loop needn't check each write, but Flush and Close must be checked
+func writeLines(path string, lines iter.Seq[string]) (err error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// Close can fail where Write didn't: on NFS, or with a full
+		// disk, it may be the first to hear the data didn't land
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}()
+	w := bufio.NewWriter(f)
+	for l := range lines {
+		w.WriteString(l)
+		w.WriteByte('\n')
+	}
+	return w.Flush()
+}
+
+// logLines yields n lines of a plausible access log
+func logLines(n int) iter.Seq[string] {
+	return func(yield func(string) bool) {
+		start := time.Date(2026, 10, 16, 9, 0, 0, 0, time.UTC)
+		for i := range n {
+			l := fmt.Sprintf("%s INFO req=%06d path=/api/v1/items/%d status=%d dur=%dms",
+				start.Add(time.Duration(i)*time.Millisecond).Format(time.RFC3339Nano), i, i%977, 200+i%7*50, i%89)
+			if !yield(l) {
+				return
+			}
+		}
+	}
+}
+
+// failAfter is a Writer that takes n bytes and then fails, like a
+// disk filling up
+type failAfter struct{ n int }
+
+func (f *failAfter) Write(p []byte) (int, error) {
+	if len(p) > f.n {
+		w := f.n
+		f.n = 0
+		return w, errors.New("no space left on device")
+	}
+	f.n -= len(p)
+	return len(p), nil
+}
+
+// ============================================================
+// 3. Replacing a file atomically
+// ============================================================
+
+// WriteFileAtomic replaces path with what write writes. Readers see
+// the old file or the new one, never part of either, and a crash at
+// any point leaves one of the two. If write fails, path is untouched
+func WriteFileAtomic(path string, perm fs.FileMode, write func(io.Writer) error) (err error) {
+	// Next to path, because rename is only atomic within a filesystem
+	// and os.TempDir is often another. A random name, so two writers
+	// don't share a temporary file; a leading dot, so globs skip it
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			tmp.Close()
+			os.Remove(tmp.Name())
+		}
+	}()
+
+	w := bufio.NewWriter(tmp)
+	if err := write(w); err != nil {
+		return err
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil { // CreateTemp makes 0600
+		return err
+	}
+	// Without Sync, a crash soon after the rename can leave the new name
+	// on a file whose data never reached the disk: an empty file where
+	// the old one was
+	if err := tmp.Sync(); err != nil {
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return err
+	}
+	// The rename is a change to the directory, which needs its own Sync
+	// to survive a crash
+	return syncDir(dir)
+}
+
+func syncDir(dir string) error {
+	if runtime.GOOS == "windows" {
+		return nil // directories can't be opened for syncing there
+	}
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+// tornReads has a goroutine rewrite path with replace for d, switching
+// between two contents of the same size, while it reads path and
+// checks that each read is one content, whole. Returns the number of
+// reads, and of torn ones
+func tornReads(path string, d time.Duration, replace func(path string, data []byte) error) (reads, torn int) {
+	a := bytes.Repeat([]byte("a"), 256<<10)
+	b := bytes.Repeat([]byte("b"), 256<<10)
+	replace(path, a)
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+			data := a
+			if i%2 == 1 {
+				data = b
+			}
+			replace(path, data)
+		}
+	}()
+	for deadline := time.Now().Add(d); time.Now().Before(deadline); {
+		got, err := os.ReadFile(path)
+		reads++
+		if err != nil || !bytes.Equal(got, a) && !bytes.Equal(got, b) {
+			torn++
+		}
+	}
+	close(done)
+	wg.Wait()
+	return reads, torn
+}
+
+// ============================================================
+// 4. Locking
+// ============================================================
+//
+// Rename makes each write atomic, but not a read-modify-write: two
+// updaters both read n and both write n+1. They need a lock.
+//
+// The OS locks, flock(2) and fcntl(2) on Unix and LockFileEx on
+// Windows, are released by the kernel when the holder dies, which is
+// what a lock should do. But the standard library has no portable API
+// for them (syscall.Flock is Unix only), Unix locks are advisory - a
+// process that doesn't ask isn't stopped - and fcntl locks have traps:
+// closing any descriptor of the file drops the process's lock on it.
+//
+// A lock file is the portable alternative: O_EXCL makes creating it
+// succeed for exactly one process, on any OS and filesystem. What it
+// can't do is notice that its holder has died.
+
+// ErrLocked is returned when another holder has the lock
+var ErrLocked = errors.New("locked")
+
+// Lockfile is a lock held by the existence of a file
+type Lockfile struct{ path string }
+
+// TryLock takes the lock at path, or returns ErrLocked. A lock file
+// older than stale is taken to be left by a holder that died, and is
+// taken over
+func TryLock(path string, stale time.Duration) (*Lockfile, error) {
+	for range 2 {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if err == nil {
+			// For whoever finds it: who to look for
+			fmt.Fprintf(f, "%d\n", os.Getpid())
+			return &Lockfile{path}, f.Close()
+		}
+		if !errors.Is(err, fs.ErrExist) {
+			return nil, err
+		}
+		st, err := os.Stat(path)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			continue // unlocked in between: try again
+		case err != nil:
+			return nil, err
+		case time.Since(st.ModTime()) < stale:
+			return nil, ErrLocked
+		}
+		// Abandoned, by the look of it. Two processes can both decide so
+		// and both remove it, the second removing the lock the first has
+		// just taken: stale must be far longer than any holder takes
+		os.Remove(path)
+	}
+	return nil, ErrLocked
+}
+
+// Lock waits up to wait for the lock at path
+func Lock(path string, stale, wait time.Duration) (*Lockfile, error) {
+	deadline := time.Now().Add(wait)
+	for {
+		l, err := TryLock(path, stale)
+		if !errors.Is(err, ErrLocked) || time.Now().After(deadline) {
+			return l, err
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// Unlock releases the lock
+func (l *Lockfile) Unlock() error {
+	return os.Remove(l.path)
+}
+
+// increment adds one to the number in path. Each write is atomic; the
+// read-then-write is not
+func increment(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	n, _ := strconv.Atoi(strings.TrimSpace(string(b)))
+	return WriteFileAtomic(path, 0o644, func(w io.Writer) error {
+		_, err := fmt.Fprintln(w, n+1)
+		return err
+	})
+}
+
+// incrementAll runs workers goroutines that each increment path n
+// times, under the lock at lockPath if it isn't empty. Returns the
+// final count
+func incrementAll(path, lockPath string, workers, n int) (int, error) {
+	os.Remove(path)
+	errs := make(chan error, workers)
+	for range workers {
+		go func() {
+			for range n {
+				if lockPath == "" {
+					if err := increment(path); err != nil {
+						errs <- err
+						return
+					}
+					continue
+				}
+				l, err := Lock(lockPath, time.Minute, 10*time.Second)
+				if err != nil {
+					errs <- err
+					return
+				}
+				err = increment(path)
+				l.Unlock()
+				if err != nil {
+					errs <- err
+					return
+				}
+			}
+			errs <- nil
+		}()
+	}
+	var err error
+	for range workers {
+		err = errors.Join(err, <-errs)
+	}
+	b, rerr := os.ReadFile(path)
+	got, _ := strconv.Atoi(strings.TrimSpace(string(b)))
+	return got, errors.Join(err, rerr)
+}
+
+// ============================================================
+// 5. Temporary files and directories
+// ============================================================
+
+// temps shows what CreateTemp and MkdirTemp make, and leaves nothing
+// behind in dir
+func temps(dir string) {
+	// The last * in the pattern becomes a random string, so the
+	// extension can stay at the end
+	f, _ := os.CreateTemp(dir, "report-*.csv")
+	sub, _ := os.MkdirTemp(dir, "job-")
+	fmt.Printf("  CreateTemp(dir, %q)  %s, mode %v\n", "report-*.csv", filepath.Base(f.Name()), mode(f.Name()))
+	fmt.Printf("  MkdirTemp(dir, %q)          %s, mode %v\n", "job-", filepath.Base(sub), mode(sub))
+
+	// Close before Remove: Windows won't remove an open file
+	f.Close()
+	os.Remove(f.Name())
+	os.RemoveAll(sub)
+	left, _ := os.ReadDir(dir)
+	fmt.Printf("  after Remove and RemoveAll: %d entries left\n", len(left))
+}
+
+func mode(path string) fs.FileMode {
+	st, err := os.Stat(path)
+	if err != nil {
+		return 0
+	}
+	return st.Mode()
+}
+
+// ============================================================
+// main
+// ============================================================
+
+// allocated returns the bytes allocated by fn
+func allocated(fn func()) uint64 {
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	fn()
+	runtime.ReadMemStats(&after)
+	return after.TotalAlloc - before.TotalAlloc
+}
+
+func main() {
+	// Defers don't run on os.Exit, so the work is in run, and the temp
+	// directory is removed before main exits, whatever happened
+	if err := run(); err != nil {
+		fmt.Println("error:", err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	dir, err := os.MkdirTemp("", "file-io-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	fmt.Println("=== 1. Reading line by line ===")
+	logPath := filepath.Join(dir, "access.log")
+	const nLines = 300_000
+	if err := writeLines(logPath, func(yield func(string) bool) {
+		for i, l := range enumerate(logLines(nLines)) {
+			if i == nLines/2 {
+				// A request body someone logged whole
+				l += " body=" + strings.Repeat("x", 100<<10)
+			}
+			if !yield(l) {
+				return
+			}
+		}
+	}); err != nil {
+		return err
+	}
+	st, _ := os.Stat(logPath)
+	fmt.Printf("  %s: %d lines, %.1f MB, one of them 100 KB\n", filepath.Base(logPath), nLines, float64(st.Size())/(1<<20))
+
+	f, _ := os.Open(logPath)
+	lines, _, err := countLines(f, bufio.MaxScanTokenSize)
+	f.Close()
+	fmt.Printf("  default 64 KB limit: %7d lines, then err %v\n", lines, err)
+
+	var longest int
+	f, _ = os.Open(logPath)
+	mem := allocated(func() { lines, longest, err = countLines(f, 1<<20) })
+	f.Close()
+	fmt.Printf("  1 MB limit:          %7d lines, longest %d, err %v; allocated %d KB\n", lines, longest, err, mem>>10)
+	mem = allocated(func() {
+		data, _ := os.ReadFile(logPath)
+		lines = len(strings.Split(strings.TrimSuffix(string(data), "\n"), "\n"))
+	})
+	fmt.Printf("  ReadFile and Split:  %7d lines; allocated %d MB\n", lines, mem>>20)
+
+	sc := bufio.NewScanner(strings.NewReader("a.txt\x00with\nnewline.txt\x00last.txt"))
+	sc.Split(scanNull)
+	var names []string
+	for sc.Scan() {
+		names = append(names, sc.Text())
+	}
+	fmt.Printf("  scanNull:            %q\n", names)
+
+	fmt.Println()
+	fmt.Println("=== 2. Buffered writing ===")
+	out := slices.Collect(logLines(100_000))
+	for _, buffered := range []bool{false, true} {
+		p := filepath.Join(dir, "out.log")
+		f, err := os.Create(p)
+		if err != nil {
+			return err
+		}
+		var w io.Writer = f
+		bw := bufio.NewWriter(f)
+		if buffered {
+			w = bw
+		}
+		start := time.Now()
+		for _, l := range out {
+			io.WriteString(w, l)
+			io.WriteString(w, "\n")
+		}
+		bw.Flush()
+		took := time.Since(start)
+		f.Close()
+		// Unbuffered, every WriteString is a system call
+		fmt.Printf("  %d lines, buffered %-5v: %v\n", len(out), buffered, took.Round(time.Millisecond))
+	}
+
+	// Forgetting Flush: the last partial buffer never reaches the file
+	p := filepath.Join(dir, "noflush.log")
+	f, _ = os.Create(p)
+	w := bufio.NewWriter(f)
+	var want int
+	for l := range logLines(1000) {
+		n, _ := w.WriteString(l + "\n")
+		want += n
+	}
+	f.Close() // no w.Flush()
+	fmt.Printf("  without Flush: wrote %d bytes, file has %d\n", want, fileSize(p))
+
+	// A failing write: the error waits in the buffer until it fills,
+	// then every write after returns it, and Flush does too
+	w = bufio.NewWriterSize(&failAfter{n: 10_000}, 4096)
+	firstErr := -1
+	for i := range 200 {
+		if _, err := w.WriteString(strings.Repeat("z", 99) + "\n"); err != nil && firstErr < 0 {
+			firstErr = i
+		}
+	}
+	fmt.Printf("  disk full at write 100: writes up to %d returned nil, write %d failed; Flush: %v\n",
+		firstErr-1, firstErr, w.Flush())
+
+	fmt.Println()
+	fmt.Println("=== 3. Replacing a file atomically ===")
+	cfg := filepath.Join(dir, "config.json")
+	reads, torn := tornReads(cfg, 300*time.Millisecond, func(path string, data []byte) error {
+		return os.WriteFile(path, data, 0o644)
+	})
+	fmt.Printf("  os.WriteFile:    %5d reads, %5d torn (empty or half written)\n", reads, torn)
+	reads, torn = tornReads(cfg, 300*time.Millisecond, func(path string, data []byte) error {
+		return WriteFileAtomic(path, 0o644, func(w io.Writer) error {
+			_, err := w.Write(data)
+			return err
+		})
+	})
+	fmt.Printf("  WriteFileAtomic: %5d reads, %5d torn\n", reads, torn)
+
+	err = WriteFileAtomic(cfg, 0o644, func(w io.Writer) error {
+		io.WriteString(w, `{"half": `)
+		return errors.New("encoder failed")
+	})
+	b, _ := os.ReadFile(cfg)
+	left, _ := filepath.Glob(filepath.Join(dir, ".config.json.tmp-*"))
+	fmt.Printf("  a failed write:  %v; file still %d bytes of %q, %d temporary files left\n",
+		err, len(b), b[:1], len(left))
+
+	fmt.Println()
+	fmt.Println("=== 4. Locking ===")
+	counter, lockPath := filepath.Join(dir, "counter"), filepath.Join(dir, "counter.lock")
+	got, err := incrementAll(counter, "", 4, 50)
+	fmt.Printf("  4 workers x 50 increments, no lock: %3d (err %v)\n", got, err)
+	got, err = incrementAll(counter, lockPath, 4, 50)
+	fmt.Printf("  4 workers x 50 increments, locked:  %3d (err %v)\n", got, err)
+
+	l, _ := TryLock(lockPath, time.Minute)
+	_, err = TryLock(lockPath, time.Minute)
+	fmt.Printf("  held, and tried again: %v\n", err)
+	// The holder "dies" without unlocking; an hour later...
+	old := time.Now().Add(-time.Hour)
+	os.Chtimes(l.path, old, old)
+	l2, err := TryLock(lockPath, time.Minute)
+	fmt.Printf("  an hour-old lock:      taken over, err %v\n", err)
+	l2.Unlock()
+
+	fmt.Println()
+	fmt.Println("=== 5. Temporary files and directories ===")
+	tmpDir := filepath.Join(dir, "scratch")
+	os.Mkdir(tmpDir, 0o755)
+	temps(tmpDir)
+	return nil
+}
+
+// enumerate numbers the values of seq
+func enumerate[V any](seq iter.Seq[V]) iter.Seq2[int, V] {
+	return func(yield func(int, V) bool) {
+		i := 0
+		for v := range seq {
+			if !yield(i, v) {
+				return
+			}
+			i++
+		}
+	}
+}
+
+func fileSize(path string) int64 {
+	st, err := os.Stat(path)
+	if err != nil {
+		return -1
+	}
+	return st.Size()
+}
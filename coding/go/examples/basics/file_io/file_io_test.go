@@ -0,0 +1,300 @@
+// Testing File I/O - The edges of reading, writing and replacing
+//
+// The failures here are the quiet ones: a scan that stops at a long
+// line, a write whose error only Flush reports, a temporary file left
+// behind. Each test works in t.TempDir, which the testing package
+// removes when the test ends, pass or fail.
+//
+// Run tests:
+//   go test -v file_io.go file_io_test.go
+//   go test -run=^$ -bench=. -benchmem file_io.go file_io_test.go
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCountLines(t *testing.T) {
+	tests := []struct {
+		name        string
+		input       string
+		maxLine     int
+		wantLines   int
+		wantLongest int
+		wantErr     error
+	}{
+		{"empty", "", 10, 0, 0, nil},
+		{"no final newline", "ab\ncde", 10, 2, 3, nil},
+		{"CRLF", "ab\r\ncde\r\n", 10, 2, 3, nil}, // \r is dropped
+		{"blank lines", "\n\n\n", 10, 3, 0, nil},
+		{"line at the limit", "0123456789\nab\n", 10, 2, 10, nil},
+		{"line over the limit", "ab\n0123456789x\nab\n", 10, 1, 2, bufio.ErrTooLong},
+		{"100 KB line", strings.Repeat("x", 100<<10) + "\n", 1 << 20, 1, 100 << 10, nil},
+		{"100 KB line, default limit", strings.Repeat("x", 100<<10) + "\n", bufio.MaxScanTokenSize, 0, 0, bufio.ErrTooLong},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			lines, longest, err := countLines(strings.NewReader(tt.input), tt.maxLine)
+			if lines != tt.wantLines || longest != tt.wantLongest || !errors.Is(err, tt.wantErr) {
+				t.Errorf("countLines = %d, %d, %v; want %d, %d, %v",
+					lines, longest, err, tt.wantLines, tt.wantLongest, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestScanNull(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{"", nil},
+		{"a\x00b\x00", []string{"a", "b"}},
+		{"a\x00b", []string{"a", "b"}},
+		{"\x00\x00", []string{"", ""}},
+		{"new\nline\x00", []string{"new\nline"}},
+	}
+	for _, tt := range tests {
+		// A one-byte reader makes the scanner ask for more data between
+		// every byte: the 0, nil, nil path
+		sc := bufio.NewScanner(&oneByte{strings.NewReader(tt.input)})
+		sc.Split(scanNull)
+		var got []string
+		for sc.Scan() {
+			got = append(got, sc.Text())
+		}
+		if sc.Err() != nil || !slices.Equal(got, tt.want) {
+			t.Errorf("scanNull(%q) = %q, %v; want %q", tt.input, got, sc.Err(), tt.want)
+		}
+	}
+}
+
+type oneByte struct{ r io.Reader }
+
+func (o *oneByte) Read(p []byte) (int, error) {
+	return o.r.Read(p[:min(1, len(p))])
+}
+
+func TestWriteLines(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.log")
+	want := slices.Collect(logLines(10_000)) // well past one buffer
+	if err := writeLines(path, slices.Values(want)); err != nil {
+		t.Fatal(err)
+	}
+	f, _ := os.Open(path)
+	defer f.Close()
+	sc := bufio.NewScanner(f)
+	var got []string
+	for sc.Scan() {
+		got = append(got, sc.Text())
+	}
+	if !slices.Equal(got, want) {
+		t.Errorf("read back %d lines, want the %d written", len(got), len(want))
+	}
+
+	if err := writeLines(filepath.Join(t.TempDir(), "no", "such", "dir"), slices.Values(want)); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("writeLines into a missing directory = %v", err)
+	}
+}
+
+func TestBufferedErrorIsSticky(t *testing.T) {
+	w := bufio.NewWriterSize(&failAfter{n: 100}, 16)
+	var errs int
+	for range 20 {
+		if _, err := w.WriteString("0123456789"); err != nil {
+			errs++
+		}
+	}
+	// The first 10 writes fit; after the one that fails, all do
+	if errs == 0 || errs > 10 {
+		t.Errorf("%d of 20 writes failed", errs)
+	}
+	if err := w.Flush(); err == nil {
+		t.Error("Flush after a failed write = nil")
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "config.json")
+	write := func(s string) func(io.Writer) error {
+		return func(w io.Writer) error {
+			_, err := io.WriteString(w, s)
+			return err
+		}
+	}
+
+	if err := WriteFileAtomic(path, 0o640, write(`{"v":1}`)); err != nil {
+		t.Fatal(err)
+	}
+	if err := WriteFileAtomic(path, 0o640, write(`{"v":2}`)); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(path); string(b) != `{"v":2}` {
+		t.Errorf("after two writes: %q", b)
+	}
+	if runtime.GOOS != "windows" {
+		if m := mode(path).Perm(); m != 0o640 {
+			t.Errorf("mode %v, want 0640", m)
+		}
+	}
+
+	// A failed write leaves the old file and no temporary
+	err := WriteFileAtomic(path, 0o640, func(w io.Writer) error {
+		io.WriteString(w, `{"v":`)
+		return errors.New("boom")
+	})
+	if err == nil || err.Error() != "boom" {
+		t.Errorf("WriteFileAtomic(failing write) = %v", err)
+	}
+	if b, _ := os.ReadFile(path); string(b) != `{"v":2}` {
+		t.Errorf("after a failed write: %q", b)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 1 {
+		t.Errorf("%d entries in the directory, want just the file", len(entries))
+	}
+}
+
+func TestNoTornReads(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "f")
+	reads, torn := tornReads(path, 100*time.Millisecond, func(path string, data []byte) error {
+		return WriteFileAtomic(path, 0o644, func(w io.Writer) error {
+			_, err := w.Write(data)
+			return err
+		})
+	})
+	if reads == 0 || torn != 0 {
+		t.Errorf("WriteFileAtomic: %d of %d reads torn", torn, reads)
+	}
+}
+
+func TestTryLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lock")
+	l, err := TryLock(path, time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := TryLock(path, time.Minute); !errors.Is(err, ErrLocked) {
+		t.Errorf("second TryLock = %v, want ErrLocked", err)
+	}
+	start := time.Now()
+	if _, err := Lock(path, time.Minute, 20*time.Millisecond); !errors.Is(err, ErrLocked) || time.Since(start) < 20*time.Millisecond {
+		t.Errorf("Lock on a held lock = %v after %v", err, time.Since(start))
+	}
+	if err := l.Unlock(); err != nil {
+		t.Fatal(err)
+	}
+	l, err = TryLock(path, time.Minute)
+	if err != nil {
+		t.Fatalf("TryLock after Unlock = %v", err)
+	}
+
+	old := time.Now().Add(-2 * time.Minute)
+	os.Chtimes(path, old, old)
+	if _, err := TryLock(path, time.Minute); err != nil {
+		t.Errorf("TryLock on a stale lock = %v", err)
+	}
+
+	if _, err := TryLock(filepath.Join(t.TempDir(), "no", "dir", "lock"), time.Minute); err == nil || errors.Is(err, ErrLocked) {
+		t.Errorf("TryLock in a missing directory = %v", err)
+	}
+}
+
+func TestIncrementAllLocked(t *testing.T) {
+	dir := t.TempDir()
+	got, err := incrementAll(filepath.Join(dir, "n"), filepath.Join(dir, "n.lock"), 4, 25)
+	if err != nil || got != 100 {
+		t.Errorf("incrementAll, locked = %d, %v; want 100", got, err)
+	}
+}
+
+// ============================================================
+// Benchmarks
+// ============================================================
+
+// BenchmarkWrite is 1000 short lines to a file. Unbuffered, each line
+// is a system call; buffered, a few dozen for all of them
+func BenchmarkWrite(b *testing.B) {
+	lines := slices.Collect(logLines(1000))
+	for _, buffered := range []bool{false, true} {
+		name := "unbuffered"
+		if buffered {
+			name = "buffered"
+		}
+		b.Run(name, func(b *testing.B) {
+			f, err := os.Create(filepath.Join(b.TempDir(), "out"))
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer f.Close()
+			for b.Loop() {
+				f.Seek(0, io.SeekStart)
+				var w io.Writer = f
+				bw := bufio.NewWriter(f)
+				if buffered {
+					w = bw
+				}
+				for _, l := range lines {
+					io.WriteString(w, l)
+					io.WriteString(w, "\n")
+				}
+				bw.Flush()
+			}
+		})
+	}
+}
+
+var sinkInt int
+
+// BenchmarkReadLines counts the lines of a 2.5 MB file. The scanner
+// reuses one buffer; ReadFile and Split allocate the file and then a
+// string header per line
+func BenchmarkReadLines(b *testing.B) {
+	path := filepath.Join(b.TempDir(), "log")
+	if err := writeLines(path, logLines(30_000)); err != nil {
+		b.Fatal(err)
+	}
+	b.Run("Scanner", func(b *testing.B) {
+		for b.Loop() {
+			f, _ := os.Open(path)
+			sinkInt, _, _ = countLines(f, 1<<20)
+			f.Close()
+		}
+	})
+	b.Run("ReadFile+Split", func(b *testing.B) {
+		for b.Loop() {
+			data, _ := os.ReadFile(path)
+			sinkInt = len(strings.Split(string(data), "\n"))
+		}
+	})
+}
+
+// BenchmarkReplace is the price of atomicity: the temporary file, two
+// Syncs and a rename, against os.WriteFile, for 4 KB
+func BenchmarkReplace(b *testing.B) {
+	path := filepath.Join(b.TempDir(), "f")
+	data := make([]byte, 4<<10)
+	b.Run("WriteFile", func(b *testing.B) {
+		for b.Loop() {
+			os.WriteFile(path, data, 0o644)
+		}
+	})
+	b.Run("WriteFileAtomic", func(b *testing.B) {
+		for b.Loop() {
+			WriteFileAtomic(path, 0o644, func(w io.Writer) error {
+				_, err := w.Write(data)
+				return err
+			})
+		}
+	})
+}
@@ -0,0 +1,558 @@
+// Generics in Go - Type parameters from constraints to compiled code
+//
+// A type parameter lets one function or type work over many element
+// types while the compiler still checks every use. Go 1.18 added them;
+// later releases widened inference and added iterators to range over.
+//
+// This example demonstrates:
+// - Constraints: any, comparable, cmp.Ordered, type sets with ~, and
+//   constraints that mix a type set with methods
+// - comparable's runtime catch: interface types satisfy it, and can
+//   still panic when compared
+// - Generic data structures: a Stack and a Set, and why some of their
+//   operations have to be functions instead of methods
+// - Map, Filter and Reduce over slices, and lazy versions over
+//   iter.Seq that stop as soon as the consumer does
+// - Type inference: what it works out, and the cases where you must
+//   write the type arguments yourself
+// - What instantiation costs: one copy of the code per GC shape, and
+//   a dictionary for everything that varies within a shape
+//
+// interfaces/interfaces.go covers when to use a type parameter and
+// when an interface, and how the two mix.
+//
+// Usage:
+//   go run generics.go
+//
+// Run tests (generics_test.go benchmarks the instantiation costs):
+//   go test -v generics.go generics_test.go
+//   go test -run=^$ -bench=. generics.go generics_test.go
+//
+// List the instantiations the compiler made:
+//   go build -o /tmp/generics generics.go && go tool nm /tmp/generics | grep 'go.shape'
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"iter"
+	"maps"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// ============================================================
+// 1. Constraints
+// ============================================================
+
+// Integer, Float and Number are type sets. The ~ admits every type
+// whose underlying type is listed, so Celsius below is a Float. A
+// type-set interface can only be used as a constraint, never as the
+// type of a variable
+type Integer interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64 |
+		~uint | ~uint8 | ~uint16 | ~uint32 | ~uint64 | ~uintptr
+}
+
+type Float interface {
+	~float32 | ~float64
+}
+
+type Number interface {
+	Integer | Float
+}
+
+// Sum works for any Number: + is allowed because every type in the
+// set supports it
+func Sum[N Number](nums []N) N {
+	var total N
+	for _, n := range nums {
+		total += n
+	}
+	return total
+}
+
+// exactInt has no ~: only int itself is in its set
+type exactInt interface{ int }
+
+func sumExact[N exactInt](nums []N) N {
+	var total N
+	for _, n := range nums {
+		total += n
+	}
+	return total
+}
+
+// Celsius is a float64 with a String method
+type Celsius float64
+
+func (c Celsius) String() string { return strconv.FormatFloat(float64(c), 'f', 1, 64) + "°C" }
+
+// Reading needs both: arithmetic from the type set, and a String
+// method. Only named types with that method qualify; plain float64
+// does not
+type Reading interface {
+	~float64
+	String() string
+}
+
+// Mean returns the average, as the same type it was given
+func Mean[R Reading](rs []R) R {
+	var total R
+	for _, r := range rs {
+		total += r
+	}
+	return total / R(len(rs))
+}
+
+// Max takes at least one value, so there is always an answer.
+// cmp.Ordered is every type that supports < : integers, floats and
+// strings
+func Max[T cmp.Ordered](first T, rest ...T) T {
+	for _, v := range rest {
+		if v > first {
+			first = v
+		}
+	}
+	return first
+}
+
+// Index needs only ==, which comparable provides
+func Index[T comparable](s []T, v T) int {
+	for i, x := range s {
+		if x == v {
+			return i
+		}
+	}
+	return -1
+}
+
+// ============================================================
+// 2. Generic data structures
+// ============================================================
+
+// Stack is a last-in, first-out stack. The zero value is an empty
+// stack ready to use
+type Stack[T any] struct {
+	items []T
+}
+
+func (s *Stack[T]) Push(v T) {
+	s.items = append(s.items, v)
+}
+
+// Pop removes and returns the top item, or the zero value and false
+// if the stack is empty
+func (s *Stack[T]) Pop() (T, bool) {
+	var zero T
+	if len(s.items) == 0 {
+		return zero, false
+	}
+	top := len(s.items) - 1
+	v := s.items[top]
+	s.items[top] = zero // don't keep what it points to alive
+	s.items = s.items[:top]
+	return v, true
+}
+
+// Peek returns the top item without removing it
+func (s *Stack[T]) Peek() (T, bool) {
+	if len(s.items) == 0 {
+		var zero T
+		return zero, false
+	}
+	return s.items[len(s.items)-1], true
+}
+
+func (s *Stack[T]) Len() int { return len(s.items) }
+
+// Set is an unordered collection of distinct values. Its elements must
+// be comparable because they are map keys
+type Set[T comparable] map[T]struct{}
+
+// NewSet returns a set holding vs
+func NewSet[T comparable](vs ...T) Set[T] {
+	s := make(Set[T], len(vs))
+	s.Add(vs...)
+	return s
+}
+
+func (s Set[T]) Add(vs ...T) {
+	for _, v := range vs {
+		s[v] = struct{}{}
+	}
+}
+
+func (s Set[T]) Remove(v T) { delete(s, v) }
+
+func (s Set[T]) Has(v T) bool {
+	_, ok := s[v]
+	return ok
+}
+
+func (s Set[T]) Len() int { return len(s) }
+
+// Union returns a new set with the elements of both
+func (s Set[T]) Union(o Set[T]) Set[T] {
+	u := maps.Clone(s)
+	if u == nil {
+		u = Set[T]{}
+	}
+	maps.Copy(u, o)
+	return u
+}
+
+// Intersect returns a new set with the elements in both
+func (s Set[T]) Intersect(o Set[T]) Set[T] {
+	if len(o) < len(s) {
+		s, o = o, s // walk the smaller one
+	}
+	in := Set[T]{}
+	for v := range s {
+		if o.Has(v) {
+			in.Add(v)
+		}
+	}
+	return in
+}
+
+// All yields the elements in no particular order
+func (s Set[T]) All() iter.Seq[T] {
+	return maps.Keys(s)
+}
+
+// Sorted is a function, not a method: a method can't narrow its type's
+// constraint from comparable to cmp.Ordered, and can't declare type
+// parameters of its own, so a Set[T].Map(f) returning a Set[U] is out
+// too
+func Sorted[T cmp.Ordered](s Set[T]) []T {
+	return slices.Sorted(s.All())
+}
+
+// ============================================================
+// 3. Map, Filter, Reduce
+// ============================================================
+
+// Map returns f applied to every element
+func Map[T, U any](s []T, f func(T) U) []U {
+	out := make([]U, 0, len(s))
+	for _, v := range s {
+		out = append(out, f(v))
+	}
+	return out
+}
+
+// Filter returns the elements for which keep is true
+func Filter[T any](s []T, keep func(T) bool) []T {
+	var out []T
+	for _, v := range s {
+		if keep(v) {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// Reduce folds s into one value, starting from init. The accumulator
+// can be a different type from the elements
+func Reduce[T, A any](s []T, init A, f func(A, T) A) A {
+	acc := init
+	for _, v := range s {
+		acc = f(acc, v)
+	}
+	return acc
+}
+
+// The slice versions do all the work up front, and build a slice at
+// every step. These take and return iter.Seq: nothing runs until
+// something ranges over the result, and each element goes through the
+// whole chain before the next is produced
+
+// MapSeq is Map over a sequence
+func MapSeq[T, U any](seq iter.Seq[T], f func(T) U) iter.Seq[U] {
+	return func(yield func(U) bool) {
+		for v := range seq {
+			if !yield(f(v)) {
+				return
+			}
+		}
+	}
+}
+
+// FilterSeq is Filter over a sequence
+func FilterSeq[T any](seq iter.Seq[T], keep func(T) bool) iter.Seq[T] {
+	return func(yield func(T) bool) {
+		for v := range seq {
+			if keep(v) && !yield(v) {
+				return
+			}
+		}
+	}
+}
+
+// Take yields the first n elements of seq, then stops it
+func Take[T any](seq iter.Seq[T], n int) iter.Seq[T] {
+	return func(yield func(T) bool) {
+		if n <= 0 {
+			return
+		}
+		i := 0
+		for v := range seq {
+			if !yield(v) {
+				return
+			}
+			if i++; i == n {
+				return
+			}
+		}
+	}
+}
+
+// Naturals yields 1, 2, 3, ... for as long as anyone asks
+func Naturals() iter.Seq[int] {
+	return func(yield func(int) bool) {
+		for n := 1; yield(n); n++ {
+		}
+	}
+}
+
+// ============================================================
+// 4. Type inference and its limits
+// ============================================================
+
+// Zero has T only in its result. Inference works from arguments, so
+// there is nothing to infer T from: Zero[int]() is the only way
+func Zero[T any]() T {
+	var zero T
+	return zero
+}
+
+// Convert puts To first on purpose: type arguments are given left to
+// right, so Convert[int](x) names To and leaves From to be inferred
+// from x
+func Convert[To, From Number](v From) To {
+	return To(v)
+}
+
+// Path is a named slice type with a method
+type Path []string
+
+func (p Path) String() string { return "/" + strings.Join(p, "/") }
+
+// reverseLoose takes []T, so it returns a plain []T: a Path passed in
+// comes back as a []string, without its String method
+func reverseLoose[T any](s []T) []T {
+	out := slices.Clone(s)
+	slices.Reverse(out)
+	return out
+}
+
+// Reverse takes S ~[]E instead, the way the slices package does: S is
+// inferred as Path, E as string, and a Path comes back
+func Reverse[S ~[]E, E any](s S) S {
+	out := slices.Clone(s)
+	slices.Reverse(out)
+	return out
+}
+
+// ============================================================
+// 5. Instantiation: GC shapes and dictionaries
+// ============================================================
+
+// Go doesn't compile a copy of a generic function for every type
+// argument, nor one copy for all of them. It compiles one per GC
+// shape: types with the same underlying type share a shape, and so do
+// all pointer types. Whatever differs between types of one shape -
+// their methods, their type descriptors - the shared code looks up in
+// a dictionary passed as a hidden argument.
+
+// codeAddr returns the address of the compiled instantiation it runs
+// in. noinline keeps it from being copied into its caller, which would
+// make every call report the caller's address
+//
+//go:noinline
+func codeAddr[T any](T) uintptr {
+	pc, _, _, _ := runtime.Caller(0)
+	return runtime.FuncForPC(pc).Entry()
+}
+
+type MyInt int
+
+type point struct{ X, Y int }
+
+type vector struct{ X, Y int }
+
+// shapeRow is one type argument and the code codeAddr ran for it
+type shapeRow struct {
+	typ  string
+	addr uintptr
+}
+
+// shapes calls codeAddr with a spread of type arguments
+func shapes() []shapeRow {
+	return []shapeRow{
+		{"int", codeAddr(0)},
+		{"MyInt", codeAddr(MyInt(0))},
+		{"int64", codeAddr(int64(0))},
+		{"string", codeAddr("")},
+		{"point", codeAddr(point{})},
+		{"vector", codeAddr(vector{})},
+		{"*point", codeAddr(&point{})},
+		{"*strings.Builder", codeAddr(&strings.Builder{})},
+		{"[]int", codeAddr([]int(nil))},
+		{"any", codeAddr(any(0))},
+	}
+}
+
+// ============================================================
+// main
+// ============================================================
+
+func main() {
+	fmt.Println("=== 1. Constraints ===")
+
+	ints := []int{3, 1, 4, 1, 5}
+	temps := []Celsius{21.5, 19, 23.25}
+	fmt.Printf("Sum(ints):             %d\n", Sum(ints))
+	fmt.Printf("Sum(temps):            %v   (~float64 admits Celsius)\n", Sum(temps))
+	fmt.Printf("sumExact(ints):        %d\n", sumExact(ints))
+	// sumExact([]MyInt{1, 2})  // MyInt does not satisfy exactInt
+	fmt.Printf("Mean(temps):           %v   (a Celsius, printed by its own String)\n", Mean(temps))
+	// Mean([]float64{1, 2})    // float64 does not satisfy Reading (missing method String)
+	// var n Number             // cannot use type Number outside a type constraint
+	fmt.Printf("Max(3, 9, 2):          %d\n", Max(3, 9, 2))
+	fmt.Printf("Max(\"pear\", \"fig\"):    %q\n", Max("pear", "fig"))
+	fmt.Printf("Index(words, \"b\"):     %d\n", Index([]string{"a", "b", "c"}, "b"))
+
+	// Since Go 1.20 interface types satisfy comparable, so this compiles.
+	// But == on two interfaces holding slices panics, at run time
+	mixed := []any{1, "two", []int{3}}
+	fmt.Printf("Index(mixed, \"two\"):   %d\n", Index(mixed, any("two")))
+	fmt.Printf("Index(mixed, a slice):  %v\n", safely(func() any { return Index(mixed, any([]int{3})) }))
+
+	fmt.Println()
+	fmt.Println("=== 2. Generic data structures ===")
+
+	var stack Stack[string] // zero value is ready
+	for _, tok := range strings.Fields("( [ { } ] )") {
+		if top, ok := stack.Peek(); ok && strings.Contains("()[]{}", top+tok) {
+			stack.Pop()
+			continue
+		}
+		stack.Push(tok)
+	}
+	fmt.Printf("brackets balanced:     %v\n", stack.Len() == 0)
+
+	var calls Stack[func() string]
+	calls.Push(func() string { return "first pushed" })
+	calls.Push(func() string { return "last pushed" })
+	f, _ := calls.Pop()
+	fmt.Printf("Stack of funcs pops:   %s\n", f())
+	_, ok := new(Stack[int]).Pop()
+	fmt.Printf("Pop on empty:          ok=%v\n", ok)
+
+	go1 := NewSet("maps", "slices", "iter", "cmp")
+	used := NewSet("fmt", "slices", "strings", "maps")
+	fmt.Printf("union:                 %v\n", Sorted(go1.Union(used)))
+	fmt.Printf("intersect:             %v\n", Sorted(go1.Intersect(used)))
+	fmt.Printf("Has(\"iter\"):           %v\n", go1.Has("iter"))
+	fmt.Printf("Set[point]:            %d distinct\n", NewSet(point{1, 2}, point{1, 2}, point{2, 1}).Len())
+	// Sorted(NewSet(point{})) // point does not satisfy cmp.Ordered
+	// Set[[]int]{}            // []int does not satisfy comparable
+
+	fmt.Println()
+	fmt.Println("=== 3. Map, Filter, Reduce ===")
+
+	words := strings.Fields("the quick brown fox jumps over the lazy dog")
+	fmt.Printf("Map(words, ToUpper):   %v\n", Map(words, strings.ToUpper))
+	fmt.Printf("Filter(len > 4):       %v\n", Filter(words, func(w string) bool { return len(w) > 4 }))
+	lengths := Reduce(words, map[int]int{}, func(acc map[int]int, w string) map[int]int {
+		acc[len(w)]++
+		return acc
+	})
+	fmt.Printf("Reduce into map:       %v (words by length)\n", lengths)
+	fmt.Printf("Reduce to total:       %d letters\n", Reduce(words, 0, func(n int, w string) int { return n + len(w) }))
+
+	// The lazy chain runs over an endless sequence and still stops:
+	// Take tells the chain to stop after three, so nothing past 15 is
+	// ever produced, and only the odd numbers up to it are squared
+	squared := 0
+	odd := FilterSeq(Naturals(), func(n int) bool { return n%2 == 1 })
+	squares := MapSeq(odd, func(n int) int { squared++; return n * n })
+	var got []int
+	for v := range Take(FilterSeq(squares, func(n int) bool { return n%3 == 0 }), 3) {
+		got = append(got, v)
+	}
+	fmt.Printf("odd squares ÷ 3:       %v, after squaring %d numbers\n", got, squared)
+
+	fmt.Println()
+	fmt.Println("=== 4. Type inference and its limits ===")
+
+	// Inferred from the arguments: nothing to write
+	fmt.Printf("Max(1, 2.5):           %v   (untyped constants: T is float64)\n", Max(1, 2.5))
+	// n := 1; Max(n, 2.5)  // 2.5 (untyped float constant) truncated to int
+
+	// Nothing to infer from: T appears only in the result
+	fmt.Printf("Zero[int]():           %d\n", Zero[int]())
+	fmt.Printf("Zero[*point]():        %v\n", Zero[*point]())
+	// var n int = Zero()   // in call to Zero, cannot infer T
+
+	// Partial: To is given, From is inferred from the argument
+	x := 3.7
+	fmt.Printf("Convert[int](3.7):     %d\n", Convert[int](x))
+	fmt.Printf("Convert[Celsius](40):  %v\n", Convert[Celsius](40))
+
+	// A generic function used as a value needs its type arguments -
+	// unless the type it is assigned or passed to supplies them
+	// g := Max             // cannot use generic function Max without instantiation
+	g := Max[int]
+	var h func(float64, ...float64) float64 = Max // inferred from h's type
+	fmt.Printf("Max[int] / via var:    %d / %v\n", g(1, 2), h(1, 2))
+	fmt.Printf("Map(ints, Convert[float64]): %T   (From = int inferred)\n", Map(ints, Convert[float64]))
+
+	// []T against S ~[]E: the looser signature loses the named type
+	p := Path{"usr", "local", "bin"}
+	fmt.Printf("reverseLoose(p):       %v  %T\n", reverseLoose(p), reverseLoose(p))
+	fmt.Printf("Reverse(p):            %v  %T\n", Reverse(p), Reverse(p))
+
+	fmt.Println()
+	fmt.Println("=== 5. Instantiation: GC shapes and dictionaries ===")
+
+	rows := shapes()
+	label := map[uintptr]string{}
+	for _, r := range rows {
+		if _, ok := label[r.addr]; !ok {
+			label[r.addr] = string(rune('A' + len(label)))
+		}
+	}
+	fmt.Printf("%d type arguments, %d compiled copies of codeAddr:\n", len(rows), len(label))
+	for _, r := range rows {
+		fmt.Printf("  %-18s copy %s\n", r.typ, label[r.addr])
+	}
+	fmt.Println("  int and MyInt share a copy, and so do point and vector, because")
+	fmt.Println("  their underlying types match. Every pointer type shares one.")
+	fmt.Println("  int and int64 don't: on a 64-bit machine they are the same size,")
+	fmt.Println("  but distinct underlying types are distinct shapes.")
+	fmt.Println()
+	fmt.Println("  What that costs at run time:")
+	fmt.Println("  - Operators (+, <, ==) on a type parameter are compiled for the")
+	fmt.Println("    shape, so Sum[int] runs as fast as a hand-written loop.")
+	fmt.Println("  - A method call through a type parameter is looked up in the")
+	fmt.Println("    dictionary: an indirect call that can't be inlined, which is")
+	fmt.Println("    what an interface method call costs too.")
+	fmt.Println("  - Unless the generic function itself is inlined into its caller:")
+	fmt.Println("    then the compiler knows T there, and the call is direct.")
+	fmt.Println("  go test -bench=. generics.go generics_test.go puts numbers on it.")
+}
+
+// safely runs f and returns its result, or the panic it raised
+func safely(f func() any) (v any) {
+	defer func() {
+		if r := recover(); r != nil {
+			v = fmt.Sprintf("panic: %v", r)
+		}
+	}()
+	return f()
+}
@@ -0,0 +1,280 @@
+// Testing Generic Code - One test body, many type arguments
+//
+// A generic function is only checked for the instantiations something
+// uses. The tests run the same assertions over several type arguments,
+// including named types and pointers, with a generic helper.
+//
+// The benchmarks put numbers on section 5 of generics.go: operators
+// on a type parameter cost what they cost in concrete code; a method
+// call through one costs what an interface call does.
+//
+// Run tests:
+//   go test -v generics.go generics_test.go
+//   go test -run=^$ -bench=. generics.go generics_test.go
+//
+// See which calls the compiler inlined or devirtualized:
+//   go test -gcflags=-m -run=^$ -bench=Method generics.go generics_test.go 2>&1 | grep -E 'inlin|devirtualiz'
+package main
+
+import (
+	"slices"
+	"testing"
+)
+
+// checkStack pushes vs onto an empty stack and checks they pop off in
+// reverse. The same body runs for every T it is instantiated with
+func checkStack[T comparable](t *testing.T, vs ...T) {
+	t.Helper()
+	var s Stack[T]
+	for _, v := range vs {
+		s.Push(v)
+	}
+	if s.Len() != len(vs) {
+		t.Fatalf("Stack[%T].Len() = %d, want %d", vs[0], s.Len(), len(vs))
+	}
+	for i := len(vs) - 1; i >= 0; i-- {
+		if top, _ := s.Peek(); top != vs[i] {
+			t.Errorf("Stack[%T].Peek() = %v, want %v", vs[0], top, vs[i])
+		}
+		if v, ok := s.Pop(); !ok || v != vs[i] {
+			t.Errorf("Stack[%T].Pop() = %v, %v; want %v, true", vs[0], v, ok, vs[i])
+		}
+	}
+	if v, ok := s.Pop(); ok || v != *new(T) {
+		t.Errorf("Stack[%T].Pop() on empty = %v, %v; want zero, false", vs[0], v, ok)
+	}
+}
+
+func TestStack(t *testing.T) {
+	checkStack(t, 1, 2, 3)
+	checkStack(t, "a", "b")
+	checkStack(t, Celsius(-40), Celsius(100))
+	checkStack(t, point{1, 2}, point{3, 4})
+	checkStack(t, &point{}, &point{}) // distinct pointers, equal points
+}
+
+func TestStackPopClearsSlot(t *testing.T) {
+	var s Stack[*point]
+	s.Push(&point{1, 2})
+	s.Pop()
+	if backing := s.items[:1]; backing[0] != nil {
+		t.Errorf("popped slot still holds %v", backing[0])
+	}
+}
+
+func TestSet(t *testing.T) {
+	a := NewSet(1, 2, 3, 3)
+	b := NewSet(3, 4)
+	if a.Len() != 3 {
+		t.Errorf("NewSet(1, 2, 3, 3).Len() = %d, want 3", a.Len())
+	}
+	if got := Sorted(a.Union(b)); !slices.Equal(got, []int{1, 2, 3, 4}) {
+		t.Errorf("Union = %v", got)
+	}
+	if got := Sorted(a.Intersect(b)); !slices.Equal(got, []int{3}) {
+		t.Errorf("Intersect = %v", got)
+	}
+	a.Remove(1)
+	if a.Has(1) || !a.Has(2) {
+		t.Errorf("after Remove(1): %v", Sorted(a))
+	}
+	var empty Set[string]
+	if got := empty.Union(NewSet("x")); !got.Has("x") {
+		t.Errorf("nil set Union = %v", got)
+	}
+}
+
+func TestConstraints(t *testing.T) {
+	if got := Sum([]Celsius{1.5, 2.5}); got != 4 {
+		t.Errorf("Sum(Celsius) = %v", got)
+	}
+	if got := Sum([]uint8{200, 100}); got != 44 {
+		t.Errorf("Sum(uint8) = %d, want 44: it wraps like any uint8 sum", got)
+	}
+	if got := Mean([]Celsius{10, 20, 30}); got.String() != "20.0°C" {
+		t.Errorf("Mean = %v", got)
+	}
+	if got := Max("b", "c", "a"); got != "c" {
+		t.Errorf("Max = %q", got)
+	}
+	if got := Index([]point{{1, 1}, {2, 2}}, point{2, 2}); got != 1 {
+		t.Errorf("Index(point) = %d", got)
+	}
+}
+
+func TestComparableCanPanic(t *testing.T) {
+	// Compiles, because any satisfies comparable, but the comparison
+	// itself panics
+	got := safely(func() any { return Index([]any{[]int{1}}, any([]int{1})) })
+	if s, ok := got.(string); !ok || s != "panic: runtime error: comparing uncomparable type []int" {
+		t.Errorf("Index over slices in any = %v, want a panic", got)
+	}
+}
+
+func TestMapFilterReduce(t *testing.T) {
+	words := []string{"go", "generic", "types"}
+	if got := Map(words, func(w string) int { return len(w) }); !slices.Equal(got, []int{2, 7, 5}) {
+		t.Errorf("Map = %v", got)
+	}
+	if got := Filter(words, func(w string) bool { return len(w) > 2 }); !slices.Equal(got, []string{"generic", "types"}) {
+		t.Errorf("Filter = %v", got)
+	}
+	if got := Filter([]int{1, 3}, func(n int) bool { return n%2 == 0 }); got != nil {
+		t.Errorf("Filter keeping nothing = %#v, want nil", got)
+	}
+	if got := Reduce(words, "", func(acc, w string) string { return acc + w[:1] }); got != "ggt" {
+		t.Errorf("Reduce = %q", got)
+	}
+}
+
+func TestSeqIsLazy(t *testing.T) {
+	// Each stage counts the elements it saw. Taking 2 even numbers
+	// must stop the endless source at 4
+	seen, mapped := 0, 0
+	src := MapSeq(Naturals(), func(n int) int { seen++; return n })
+	even := FilterSeq(src, func(n int) bool { return n%2 == 0 })
+	halves := MapSeq(even, func(n int) int { mapped++; return n / 2 })
+	got := slices.Collect(Take(halves, 2))
+	if !slices.Equal(got, []int{1, 2}) || seen != 4 || mapped != 2 {
+		t.Errorf("got %v after %d produced and %d mapped; want [1 2], 4, 2", got, seen, mapped)
+	}
+	if got := slices.Collect(Take(Naturals(), 0)); got != nil {
+		t.Errorf("Take 0 = %v", got)
+	}
+}
+
+func TestInference(t *testing.T) {
+	if got := Convert[int](2.9); got != 2 {
+		t.Errorf("Convert[int](2.9) = %d", got)
+	}
+	p := Path{"a", "b"}
+	var rev Path = Reverse(p) // compiles only because S is Path
+	if rev.String() != "/b/a" || p.String() != "/a/b" {
+		t.Errorf("Reverse(%v) = %v, and the original is now %v", Path{"a", "b"}, rev, p)
+	}
+}
+
+func TestShapes(t *testing.T) {
+	addr := map[string]uintptr{}
+	for _, r := range shapes() {
+		addr[r.typ] = r.addr
+	}
+	same := [][2]string{{"int", "MyInt"}, {"point", "vector"}, {"*point", "*strings.Builder"}}
+	for _, p := range same {
+		if addr[p[0]] != addr[p[1]] {
+			t.Errorf("%s and %s run different code; they share a GC shape", p[0], p[1])
+		}
+	}
+	differ := [][2]string{{"int", "int64"}, {"int", "string"}, {"point", "*point"}, {"int", "any"}}
+	for _, p := range differ {
+		if addr[p[0]] == addr[p[1]] {
+			t.Errorf("%s and %s run the same code; their shapes differ", p[0], p[1])
+		}
+	}
+}
+
+// ============================================================
+// Benchmarks
+// ============================================================
+
+var sink int
+
+func sumInts(nums []int) int {
+	total := 0
+	for _, n := range nums {
+		total += n
+	}
+	return total
+}
+
+// BenchmarkSum is + on a type parameter against the same loop written
+// for int. Sum[int] is compiled for the int shape, so they should run
+// at the same speed
+func BenchmarkSum(b *testing.B) {
+	nums := make([]int, 1024)
+	for i := range nums {
+		nums[i] = i
+	}
+	b.Run("concrete", func(b *testing.B) {
+		for b.Loop() {
+			sink = sumInts(nums)
+		}
+	})
+	b.Run("generic", func(b *testing.B) {
+		for b.Loop() {
+			sink = Sum(nums)
+		}
+	})
+}
+
+// sizer is a constraint, and an interface, with one method
+type sizer interface{ Size() int }
+
+type blob struct{ n int }
+
+func (b blob) Size() int { return b.n }
+
+func sizeConcrete(bs []blob) int {
+	total := 0
+	for _, b := range bs {
+		total += b.Size() // inlined
+	}
+	return total
+}
+
+func sizeInterface(ss []sizer) int {
+	total := 0
+	for _, s := range ss {
+		total += s.Size() // dynamic dispatch
+	}
+	return total
+}
+
+// sizeGeneric is kept out of line, as a generic function bigger than
+// this usually would be: inlined into a caller, T would be known there
+// and the call direct again
+//
+//go:noinline
+func sizeGeneric[S sizer](ss []S) int {
+	total := 0
+	for _, s := range ss {
+		total += s.Size() // through the dictionary
+	}
+	return total
+}
+
+// BenchmarkMethod is a method call through a type parameter. Expect
+// concrete well ahead; generic-value, generic-pointer and interface
+// together, because all three make an indirect call that can't be
+// inlined. A type parameter buys type safety here, not speed
+func BenchmarkMethod(b *testing.B) {
+	const n = 1024
+	vals := make([]blob, n)
+	ptrs := make([]*blob, n)
+	ifaces := make([]sizer, n)
+	for i := range n {
+		vals[i] = blob{i}
+		ptrs[i] = &vals[i]
+		ifaces[i] = vals[i]
+	}
+	b.Run("concrete", func(b *testing.B) {
+		for b.Loop() {
+			sink = sizeConcrete(vals)
+		}
+	})
+	b.Run("generic-value", func(b *testing.B) {
+		for b.Loop() {
+			sink = sizeGeneric(vals)
+		}
+	})
+	b.Run("generic-pointer", func(b *testing.B) {
+		for b.Loop() {
+			sink = sizeGeneric(ptrs)
+		}
+	})
+	b.Run("interface", func(b *testing.B) {
+		for b.Loop() {
+			sink = sizeInterface(ifaces)
+		}
+	})
+}
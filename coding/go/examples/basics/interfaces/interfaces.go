@@ -11,14 +11,42 @@
 // - Interface composition
 // - Empty interface (any)
 // - Type assertions and type switches
+// - Generics vs interfaces: when to use which, and how they mix
+// - Sorting with sort.Interface, sort.Slice and slices.SortFunc
+// - Implementing io.Reader and io.Writer, and the io.Copy fast paths
+// - Dependency injection: code depends on a small interface, tests
+//   pass a hand-written fake (see interfaces_test.go)
+// - The typed-nil pitfall: a nil pointer in an interface is not nil
+// - A plugin registry: shape constructors register themselves by
+//   name in init(), the way database/sql drivers and image formats do
+// - json.Marshaler, json.Unmarshaler and encoding.TextMarshaler:
+//   how encoding packages find and call your methods, and decoding
+//   a []Shape with a "type" discriminator field
 //
 // Usage:
 //   go run interfaces.go
+//
+// Run tests:
+//   go test -v interfaces.go interfaces_test.go
 package main
 
 import (
+	"bufio"
+	"cmp"
+	"encoding"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"maps"
 	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 )
 
 // Shape interface - any type with these methods is a Shape
@@ -40,8 +68,8 @@ type PrintableShape interface {
 
 // Rectangle implements Shape and Stringer
 type Rectangle struct {
-	Width  float64
-	Height float64
+	Width  float64 `json:"width"`
+	Height float64 `json:"height"`
 }
 
 func (r Rectangle) Area() float64 {
@@ -58,7 +86,7 @@ func (r Rectangle) String() string {
 
 // Circle implements Shape and Stringer
 type Circle struct {
-	Radius float64
+	Radius float64 `json:"radius"`
 }
 
 func (c Circle) Area() float64 {
@@ -75,7 +103,9 @@ func (c Circle) String() string {
 
 // Triangle implements Shape
 type Triangle struct {
-	A, B, C float64 // Side lengths
+	A float64 `json:"a"` // Side lengths
+	B float64 `json:"b"`
+	C float64 `json:"c"`
 }
 
 func (t Triangle) Area() float64 {
@@ -88,6 +118,489 @@ func (t Triangle) Perimeter() float64 {
 	return t.A + t.B + t.C
 }
 
+// ByArea implements sort.Interface, the classic way to make a
+// collection sortable: three methods and sort.Sort does the rest
+type ByArea []Shape
+
+func (a ByArea) Len() int           { return len(a) }
+func (a ByArea) Less(i, j int) bool { return a[i].Area() < a[j].Area() }
+func (a ByArea) Swap(i, j int)      { a[i], a[j] = a[j], a[i] }
+
+// rot13Reader wraps another Reader and rotates letters as they pass
+// through. Like most Readers it transforms data in place in the
+// caller's buffer and never holds more than one chunk.
+type rot13Reader struct {
+	r io.Reader
+}
+
+func (r rot13Reader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	for i, b := range p[:n] {
+		switch {
+		case b >= 'a' && b <= 'z':
+			p[i] = 'a' + (b-'a'+13)%26
+		case b >= 'A' && b <= 'Z':
+			p[i] = 'A' + (b-'A'+13)%26
+		}
+	}
+	return n, err // return n even with an error: callers must use both
+}
+
+// countingWriter passes writes through and counts bytes and calls
+type countingWriter struct {
+	w     io.Writer
+	bytes int64
+	calls int
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.bytes += int64(n)
+	c.calls++
+	return n, err
+}
+
+// repeatReader produces n copies of b. It also implements io.WriterTo,
+// which io.Copy prefers over Read: the source writes everything in one
+// call instead of being drained through a 32KB intermediate buffer.
+type repeatReader struct {
+	b byte
+	n int
+}
+
+func (r *repeatReader) Read(p []byte) (int, error) {
+	if r.n == 0 {
+		return 0, io.EOF
+	}
+	n := min(len(p), r.n)
+	for i := range p[:n] {
+		p[i] = r.b
+	}
+	r.n -= n
+	return n, nil
+}
+
+func (r *repeatReader) WriteTo(w io.Writer) (int64, error) {
+	n, err := w.Write([]byte(strings.Repeat(string(r.b), r.n)))
+	r.n -= n
+	return int64(n), err
+}
+
+// ShapeRepository is what the report needs from storage - one method.
+// It is declared here, next to its consumer, not next to the
+// implementations: Go interfaces belong to the code that uses them.
+type ShapeRepository interface {
+	ListShapes() ([]Shape, error)
+}
+
+// fileShapeRepository is the production implementation. It reads one
+// shape per line: "rectangle W H", "circle R" or "triangle A B C".
+type fileShapeRepository struct {
+	path string
+}
+
+func (r fileShapeRepository) ListShapes() ([]Shape, error) {
+	f, err := os.Open(r.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var shapes []Shape
+	sc := bufio.NewScanner(f)
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		s, err := parseShape(text)
+		if err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", r.path, line, err)
+		}
+		shapes = append(shapes, s)
+	}
+	return shapes, sc.Err()
+}
+
+// parseShape turns "circle 7" into Circle{Radius: 7}
+func parseShape(text string) (Shape, error) {
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return nil, errors.New("empty shape")
+	}
+	nums := make([]float64, len(fields)-1)
+	for i, f := range fields[1:] {
+		v, err := strconv.ParseFloat(f, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad number %q", f)
+		}
+		nums[i] = v
+	}
+
+	switch {
+	case fields[0] == "rectangle" && len(nums) == 2:
+		return Rectangle{Width: nums[0], Height: nums[1]}, nil
+	case fields[0] == "circle" && len(nums) == 1:
+		return Circle{Radius: nums[0]}, nil
+	case fields[0] == "triangle" && len(nums) == 3:
+		return Triangle{A: nums[0], B: nums[1], C: nums[2]}, nil
+	}
+	return nil, fmt.Errorf("unknown shape %q", text)
+}
+
+// ErrNoShapes is returned when there is nothing to report on
+var ErrNoShapes = errors.New("no shapes")
+
+// ReportGenerator summarizes whatever its repository returns. It
+// doesn't know or care whether that's a file, a database or a fake.
+type ReportGenerator struct {
+	repo ShapeRepository
+}
+
+// NewReportGenerator injects the dependency through the constructor
+func NewReportGenerator(repo ShapeRepository) *ReportGenerator {
+	return &ReportGenerator{repo: repo}
+}
+
+// Generate writes a summary of all shapes to w
+func (g *ReportGenerator) Generate(w io.Writer) error {
+	shapes, err := g.repo.ListShapes()
+	if err != nil {
+		return fmt.Errorf("generate report: %w", err)
+	}
+	if len(shapes) == 0 {
+		return fmt.Errorf("generate report: %w", ErrNoShapes)
+	}
+
+	counts := map[string]int{}
+	for _, s := range shapes {
+		counts[shapeKind(s)]++
+	}
+	kinds := slices.Sorted(maps.Keys(counts))
+
+	fmt.Fprintf(w, "Shapes:     %d\n", len(shapes))
+	for _, k := range kinds {
+		fmt.Fprintf(w, "  %-10s %d\n", k+":", counts[k])
+	}
+	fmt.Fprintf(w, "Total area: %.2f\n", TotalArea(shapes))
+	fmt.Fprintf(w, "Largest:    %s (%.2f)\n", shapeKind(Largest(shapes)), Largest(shapes).Area())
+	return nil
+}
+
+// ShapeError reports why a shape is invalid
+type ShapeError struct {
+	Kind   string
+	Reason string
+}
+
+func (e *ShapeError) Error() string {
+	return fmt.Sprintf("invalid %s: %s", e.Kind, e.Reason)
+}
+
+// checkShape is the concrete-typed helper: returning *ShapeError is
+// fine here, a nil pointer is a perfectly good "no problem"
+func checkShape(s Shape) *ShapeError {
+	if r, ok := s.(Rectangle); ok && (r.Width <= 0 || r.Height <= 0) {
+		return &ShapeError{Kind: "rectangle", Reason: "sides must be positive"}
+	}
+	if c, ok := s.(Circle); ok && c.Radius <= 0 {
+		return &ShapeError{Kind: "circle", Reason: "radius must be positive"}
+	}
+	if t, ok := s.(Triangle); ok && (t.A+t.B <= t.C || t.A+t.C <= t.B || t.B+t.C <= t.A) {
+		return &ShapeError{Kind: "triangle", Reason: "violates the triangle inequality"}
+	}
+	return nil
+}
+
+// validateShapeBroken has the bug: it returns a *ShapeError through
+// the error interface. An interface is a (type, value) pair, and
+// (*ShapeError, nil) is not the nil interface (nil, nil), so callers
+// see err != nil even for valid shapes.
+func validateShapeBroken(s Shape) error {
+	return checkShape(s) // BUG: typed nil becomes a non-nil error
+}
+
+// validateShape is the fix: convert at the boundary and return a
+// literal nil when there's no error
+func validateShape(s Shape) error {
+	if err := checkShape(s); err != nil {
+		return err
+	}
+	return nil
+}
+
+// ShapeFactory builds a Shape from named numeric parameters, e.g.
+// {"radius": 7}. Every plugin provides one.
+type ShapeFactory func(params map[string]float64) (Shape, error)
+
+// The registry maps a shape name to its factory. It is written from
+// init() functions and read afterwards, but the mutex keeps it safe if
+// a plugin registers later - database/sql guards its drivers the same way.
+var (
+	registryMu sync.RWMutex
+	registry   = map[string]ShapeFactory{}
+)
+
+// RegisterShape makes a shape available by name. Like sql.Register it
+// panics on a nil factory or a duplicate name: both are programming
+// errors that should fail at startup, not on the first request.
+func RegisterShape(name string, factory ShapeFactory) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+	if factory == nil {
+		panic("shapes: RegisterShape factory is nil for " + name)
+	}
+	if _, dup := registry[name]; dup {
+		panic("shapes: RegisterShape called twice for " + name)
+	}
+	registry[name] = factory
+}
+
+// RegisteredShapes lists the registered names in sorted order
+func RegisteredShapes() []string {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+	return slices.Sorted(maps.Keys(registry))
+}
+
+// ErrUnknownShape is returned for a "type" nobody registered
+var ErrUnknownShape = errors.New("unknown shape type")
+
+// NewShape instantiates a shape from a config map such as
+// {"type": "circle", "radius": 7}. The "type" key picks the factory;
+// every other key must be a number and is passed along as a parameter.
+// NewShape itself knows nothing about circles or rectangles.
+func NewShape(config map[string]any) (Shape, error) {
+	name, ok := config["type"].(string)
+	if !ok {
+		return nil, fmt.Errorf("shape config: missing \"type\" string")
+	}
+
+	registryMu.RLock()
+	factory, ok := registry[name]
+	registryMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("shape config: %w %q", ErrUnknownShape, name)
+	}
+
+	params := make(map[string]float64, len(config)-1)
+	for k, v := range config {
+		if k == "type" {
+			continue
+		}
+		switch n := v.(type) {
+		case float64:
+			params[k] = n
+		case int:
+			params[k] = float64(n)
+		default:
+			return nil, fmt.Errorf("shape config: %s: %q must be a number, got %T", name, k, v)
+		}
+	}
+
+	s, err := factory(params)
+	if err != nil {
+		return nil, fmt.Errorf("shape config: %s: %w", name, err)
+	}
+	return s, nil
+}
+
+// requireParams fetches the named parameters, failing on any missing
+func requireParams(params map[string]float64, names ...string) ([]float64, error) {
+	vals := make([]float64, len(names))
+	for i, n := range names {
+		v, ok := params[n]
+		if !ok {
+			return nil, fmt.Errorf("missing parameter %q", n)
+		}
+		vals[i] = v
+	}
+	return vals, nil
+}
+
+// The built-in shapes register themselves. In a real project each
+// would live in its own package, and importing it for side effects
+// (import _ "example.com/shapes/circle") is what enables it.
+func init() {
+	RegisterShape("rectangle", func(p map[string]float64) (Shape, error) {
+		v, err := requireParams(p, "width", "height")
+		if err != nil {
+			return nil, err
+		}
+		return Rectangle{Width: v[0], Height: v[1]}, nil
+	})
+	RegisterShape("circle", func(p map[string]float64) (Shape, error) {
+		v, err := requireParams(p, "radius")
+		if err != nil {
+			return nil, err
+		}
+		return Circle{Radius: v[0]}, nil
+	})
+	RegisterShape("triangle", func(p map[string]float64) (Shape, error) {
+		v, err := requireParams(p, "a", "b", "c")
+		if err != nil {
+			return nil, err
+		}
+		return Triangle{A: v[0], B: v[1], C: v[2]}, nil
+	})
+}
+
+// A second init() plays the part of a third-party plugin: "square"
+// becomes available without touching NewShape or the code above
+func init() {
+	RegisterShape("square", func(p map[string]float64) (Shape, error) {
+		v, err := requireParams(p, "side")
+		if err != nil {
+			return nil, err
+		}
+		return Rectangle{Width: v[0], Height: v[0]}, nil
+	})
+}
+
+// Compile-time checks: the encoding packages look these interfaces up
+// with type assertions at run time, so a typo in a method signature
+// fails silently unless something like this catches it
+var (
+	_ json.Marshaler           = Rectangle{}
+	_ json.Unmarshaler         = (*Rectangle)(nil)
+	_ encoding.TextMarshaler   = Circle{}
+	_ encoding.TextUnmarshaler = (*Circle)(nil)
+)
+
+// MarshalJSON adds the "type" discriminator. The local type plain has
+// Rectangle's fields but none of its methods; marshaling a Rectangle
+// here instead would call MarshalJSON again and recurse forever.
+func (r Rectangle) MarshalJSON() ([]byte, error) {
+	type plain Rectangle
+	return json.Marshal(struct {
+		Type string `json:"type"`
+		plain
+	}{"rectangle", plain(r)})
+}
+
+// UnmarshalJSON needs a pointer receiver: it has to modify r
+func (r *Rectangle) UnmarshalJSON(data []byte) error {
+	if err := checkKind(data, "rectangle"); err != nil {
+		return err
+	}
+	type plain Rectangle
+	return json.Unmarshal(data, (*plain)(r))
+}
+
+func (c Circle) MarshalJSON() ([]byte, error) {
+	type plain Circle
+	return json.Marshal(struct {
+		Type string `json:"type"`
+		plain
+	}{"circle", plain(c)})
+}
+
+func (c *Circle) UnmarshalJSON(data []byte) error {
+	if err := checkKind(data, "circle"); err != nil {
+		return err
+	}
+	type plain Circle
+	return json.Unmarshal(data, (*plain)(c))
+}
+
+func (t Triangle) MarshalJSON() ([]byte, error) {
+	type plain Triangle
+	return json.Marshal(struct {
+		Type string `json:"type"`
+		plain
+	}{"triangle", plain(t)})
+}
+
+func (t *Triangle) UnmarshalJSON(data []byte) error {
+	if err := checkKind(data, "triangle"); err != nil {
+		return err
+	}
+	type plain Triangle
+	return json.Unmarshal(data, (*plain)(t))
+}
+
+// MarshalText uses the same one-line format as the shapes file, so
+// "circle 7" works as a map key, a flag value or a log field
+func (r Rectangle) MarshalText() ([]byte, error) {
+	return fmt.Appendf(nil, "rectangle %g %g", r.Width, r.Height), nil
+}
+
+func (r *Rectangle) UnmarshalText(text []byte) error {
+	return unmarshalShapeText(text, r)
+}
+
+func (c Circle) MarshalText() ([]byte, error) {
+	return fmt.Appendf(nil, "circle %g", c.Radius), nil
+}
+
+func (c *Circle) UnmarshalText(text []byte) error {
+	return unmarshalShapeText(text, c)
+}
+
+func (t Triangle) MarshalText() ([]byte, error) {
+	return fmt.Appendf(nil, "triangle %g %g %g", t.A, t.B, t.C), nil
+}
+
+func (t *Triangle) UnmarshalText(text []byte) error {
+	return unmarshalShapeText(text, t)
+}
+
+// checkKind decodes only the discriminator and rejects a mismatch, so
+// {"type":"circle"} can't silently become a zero Rectangle
+func checkKind(data []byte, want string) error {
+	var head struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(data, &head); err != nil {
+		return err
+	}
+	if head.Type != want {
+		return fmt.Errorf("decode %s: got type %q", want, head.Type)
+	}
+	return nil
+}
+
+// unmarshalShapeText parses text with parseShape and stores the result
+// in dst, which must point to the same concrete type
+func unmarshalShapeText[S Shape](text []byte, dst *S) error {
+	s, err := parseShape(string(text))
+	if err != nil {
+		return err
+	}
+	v, ok := s.(S)
+	if !ok {
+		return fmt.Errorf("decode %T: got %q", *dst, text)
+	}
+	*dst = v
+	return nil
+}
+
+// ShapeList is a []Shape that can be decoded. json.Unmarshal can't
+// fill a Shape on its own - it's an interface, so there is no way to
+// know which concrete type to allocate. UnmarshalJSON decodes each
+// element into a config map and lets NewShape pick the factory by its
+// "type" field, so any registered shape decodes, "square" included,
+// and ShapeList never names a concrete type.
+type ShapeList []Shape
+
+func (l *ShapeList) UnmarshalJSON(data []byte) error {
+	var configs []map[string]any
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return err
+	}
+
+	shapes := make(ShapeList, 0, len(configs))
+	for i, config := range configs {
+		s, err := NewShape(config)
+		if err != nil {
+			return fmt.Errorf("shape %d: %w", i, err)
+		}
+		shapes = append(shapes, s)
+	}
+	*l = shapes
+	return nil
+}
+
 func main() {
 	fmt.Println("=== Interfaces Demo ===")
 	fmt.Println()
@@ -157,6 +670,284 @@ func main() {
 
 	// Triangle doesn't implement Stringer, so it's not a PrintableShape
 	// var ps2 PrintableShape = Triangle{3, 4, 5}  // Won't compile!
+
+	fmt.Println()
+	fmt.Println("=== Generics vs Interfaces ===")
+
+	// Interface version: one compiled function, dynamic dispatch per
+	// call, and the result comes back as a Shape
+	fmt.Printf("TotalArea (interface):    %.2f\n", TotalArea(shapes))
+
+	// Generic version: the same computation, but S is fixed per call
+	// site. A []Circle can be passed directly - no copying into a
+	// []Shape first - and Largest returns a Circle, not a Shape.
+	circles := []Circle{{Radius: 1}, {Radius: 3}, {Radius: 2}}
+	fmt.Printf("TotalAreaOf ([]Circle):   %.2f\n", TotalAreaOf(circles))
+	biggest := Largest(circles)
+	fmt.Printf("Largest circle radius:    %.2f (no type assertion needed)\n", biggest.Radius)
+
+	// The interface version can't do that: it needs a []Shape, and the
+	// answer has to be asserted back to Circle
+	asShapes := make([]Shape, len(circles))
+	for i, c := range circles {
+		asShapes[i] = c
+	}
+	if c, ok := LargestShape(asShapes).(Circle); ok {
+		fmt.Printf("LargestShape, asserted:   %.2f\n", c.Radius)
+	}
+
+	// Interop: an interface type satisfies its own constraint, so a
+	// generic function instantiated with S = Shape handles a mixed
+	// slice exactly like the interface version
+	fmt.Printf("TotalAreaOf ([]Shape):    %.2f\n", TotalAreaOf(shapes))
+	fmt.Printf("Largest of mixed shapes:  %v\n", Largest(shapes))
+
+	// Type-set constraints have no interface equivalent: + isn't a
+	// method, so only a constraint listing the types can allow it
+	fmt.Printf("Sum of ints:              %d\n", Sum([]int{3, 4, 5}))
+	fmt.Printf("Sum of perimeters:        %.2f\n", Sum(Map(shapes, Shape.Perimeter)))
+
+	// Rules of thumb:
+	// - Values of different types in one collection -> interface
+	//   (a []S holds one type; only an interface mixes them)
+	// - Same algorithm over many element types, result keeps its type
+	//   -> generic (containers, Map/Filter, Max, Sum)
+	// - Behavior varies per type -> interface methods; only the data
+	//   type varies -> type parameter
+	// - Start with an interface; reach for generics when you catch
+	//   yourself writing type assertions or copying into []Shape
+
+	fmt.Println()
+	fmt.Println("=== Sorting ===")
+
+	// Two pairs of equal areas (16 and 6) to show stable ordering
+	unsorted := []Shape{
+		Rectangle{Width: 2, Height: 8},
+		Circle{Radius: 2},
+		Triangle{A: 3, B: 4, C: 5},
+		Rectangle{Width: 4, Height: 4},
+		Rectangle{Width: 1, Height: 6},
+		Circle{Radius: 1},
+	}
+
+	// 1. sort.Interface: define a named type with Len/Less/Swap.
+	// sort.Reverse wraps any sort.Interface to flip Less.
+	byArea := slices.Clone(unsorted)
+	sort.Sort(ByArea(byArea))
+	printSorted("sort.Sort(ByArea)", byArea)
+	sort.Sort(sort.Reverse(ByArea(byArea)))
+	printSorted("sort.Reverse(ByArea)", byArea)
+
+	// 2. sort.Slice: no named type, just a less func over indexes
+	byPerimeter := slices.Clone(unsorted)
+	sort.Slice(byPerimeter, func(i, j int) bool {
+		return byPerimeter[i].Perimeter() < byPerimeter[j].Perimeter()
+	})
+	printSorted("sort.Slice(perimeter)", byPerimeter)
+
+	// 3. slices.SortFunc (Go 1.21+): generic, compares elements rather
+	// than indexes, and returns an int like cmp.Compare. Preferred in
+	// new code - it's faster and harder to get wrong.
+	sorted := slices.Clone(unsorted)
+	slices.SortFunc(sorted, func(a, b Shape) int {
+		return cmp.Compare(a.Area(), b.Area())
+	})
+	printSorted("slices.SortFunc(area)", sorted)
+
+	// Stable sorts keep equal elements in their input order. With the
+	// unstable sorts above, 2x8 and 4x4 (both area 16) may come out
+	// either way; SortStableFunc guarantees 2x8 stays first.
+	stable := slices.Clone(unsorted)
+	slices.SortStableFunc(stable, func(a, b Shape) int {
+		return cmp.Compare(a.Area(), b.Area())
+	})
+	printSorted("slices.SortStableFunc", stable)
+
+	// Multi-key ordering: by kind, then largest area first, then by
+	// perimeter. cmp.Or returns the first non-zero comparison.
+	multi := slices.Clone(unsorted)
+	slices.SortFunc(multi, func(a, b Shape) int {
+		return cmp.Or(
+			cmp.Compare(shapeKind(a), shapeKind(b)),
+			cmp.Compare(b.Area(), a.Area()), // b first: descending
+			cmp.Compare(a.Perimeter(), b.Perimeter()),
+		)
+	})
+	printSorted("kind, -area, perimeter", multi)
+
+	fmt.Println()
+	fmt.Println("=== io.Reader and io.Writer ===")
+
+	// One method each, so anything can be a source or a sink, and
+	// wrappers compose: strings.Reader -> rot13 -> MultiWriter(stdout, counter)
+	counter := &countingWriter{w: io.Discard}
+	out := io.MultiWriter(os.Stdout, counter)
+
+	secret := rot13Reader{strings.NewReader("Uryyb, Tbcure!\n")}
+	if _, err := io.Copy(out, secret); err != nil {
+		fmt.Println("copy failed:", err)
+	}
+	fmt.Printf("counter saw %d bytes in %d write(s)\n", counter.bytes, counter.calls)
+
+	// Applying rot13 twice gets the original back - readers stack
+	twice := rot13Reader{rot13Reader{strings.NewReader("round trip")}}
+	data, _ := io.ReadAll(twice)
+	fmt.Printf("rot13(rot13(x)) = %q\n", data)
+
+	// io.Copy fast paths: if src implements io.WriterTo, io.Copy calls
+	// src.WriteTo(dst); else if dst implements io.ReaderFrom, it calls
+	// dst.ReadFrom(src). Only otherwise does it loop with a buffer.
+	const size = 100_000
+
+	fast := &countingWriter{w: io.Discard}
+	io.Copy(fast, &repeatReader{b: 'x', n: size})
+	fmt.Printf("with WriterTo:    %d bytes in %d write(s)\n", fast.bytes, fast.calls)
+
+	// Wrapping hides every method but Read, forcing the buffered loop
+	slow := &countingWriter{w: io.Discard}
+	io.Copy(slow, struct{ io.Reader }{&repeatReader{b: 'x', n: size}})
+	fmt.Printf("Read loop only:   %d bytes in %d write(s)\n", slow.bytes, slow.calls)
+
+	// The same trick on the destination side: *os.File implements
+	// ReaderFrom (using sendfile/copy_file_range where the OS allows),
+	// and so does *bytes.Buffer. Embedding a Writer in a struct to add
+	// a method silently loses these - watch for it in hot paths.
+	for _, w := range []io.Writer{os.Stdout, counter} {
+		_, ok := w.(io.ReaderFrom)
+		fmt.Printf("%-22T implements io.ReaderFrom: %v\n", w, ok)
+	}
+
+	fmt.Println()
+	fmt.Println("=== Dependency Injection ===")
+
+	// Production wiring: the real, file-backed repository
+	dir, err := os.MkdirTemp("", "shapes-")
+	if err != nil {
+		fmt.Println("temp dir:", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "shapes.txt")
+	content := "# one shape per line\nrectangle 10 5\ncircle 7\ntriangle 3 4 5\ncircle 1\n"
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		fmt.Println("write shapes:", err)
+		return
+	}
+
+	report := NewReportGenerator(fileShapeRepository{path: path})
+	if err := report.Generate(os.Stdout); err != nil {
+		fmt.Println("Error:", err)
+	}
+
+	// The same generator against a missing file: errors flow through
+	// the interface like any other return value
+	missing := NewReportGenerator(fileShapeRepository{path: filepath.Join(dir, "nope.txt")})
+	if err := missing.Generate(os.Stdout); err != nil {
+		fmt.Println("Error:", err)
+	}
+
+	// In tests, any type with a ListShapes method will do - no mock
+	// framework, no generated code. See interfaces_test.go.
+
+	fmt.Println()
+	fmt.Println("=== Typed Nil Pitfall ===")
+
+	valid := Circle{Radius: 1}
+
+	err = validateShapeBroken(valid)
+	fmt.Printf("broken: err != nil is %v, err prints as %v, dynamic type %T\n", err != nil, err, err)
+
+	err = validateShape(valid)
+	fmt.Printf("fixed:  err != nil is %v, err prints as %v, dynamic type %T\n", err != nil, err, err)
+
+	err = validateShape(Triangle{A: 1, B: 2, C: 10})
+	fmt.Printf("invalid shape: %v\n", err)
+
+	// The same trap with any interface, not just error
+	var rect *Rectangle
+	var shape Shape = rect
+	fmt.Printf("nil *Rectangle in a Shape: shape == nil is %v\n", shape == nil)
+
+	// How to avoid it:
+	// - Functions that return error should declare their error results
+	//   as error, never as *MyError, and return a literal nil
+	// - Don't assign a possibly-nil pointer to an interface variable
+	//   (var err error = p) - test p for nil first
+	// - Reflection can detect a typed nil, but needing it means the
+	//   bug is upstream; fix the function that returns it
+
+	fmt.Println()
+	fmt.Println("=== Plugin Registry ===")
+
+	// Every init() has run before main, so the registry is populated
+	fmt.Printf("registered: %s\n", strings.Join(RegisteredShapes(), ", "))
+
+	// Config as it might arrive from a YAML or JSON file
+	configs := []map[string]any{
+		{"type": "rectangle", "width": 4, "height": 2.5},
+		{"type": "circle", "radius": 3},
+		{"type": "square", "side": 5},
+		{"type": "hexagon", "side": 1},
+		{"type": "circle"},
+	}
+	for _, cfg := range configs {
+		s, err := NewShape(cfg)
+		if err != nil {
+			fmt.Println("  Error:", err)
+			continue
+		}
+		fmt.Printf("  %-28v area %.2f\n", s, s.Area())
+	}
+
+	// Registering the same name twice is a startup bug, so it panics
+	func() {
+		defer func() { fmt.Println("duplicate registration:", recover()) }()
+		RegisterShape("circle", func(map[string]float64) (Shape, error) { return Circle{}, nil })
+	}()
+
+	fmt.Println()
+	fmt.Println("=== Marshaler Interfaces ===")
+
+	// json.Marshal finds MarshalJSON through each element's dynamic
+	// type, so a []Shape encodes with no help
+	encoded, err := json.Marshal(shapes)
+	if err != nil {
+		fmt.Println("marshal:", err)
+		return
+	}
+	fmt.Printf("json:    %s\n", encoded)
+
+	// Decoding is the hard direction: into a plain []Shape it fails...
+	var naive []Shape
+	err = json.Unmarshal(encoded, &naive)
+	fmt.Printf("[]Shape: %v\n", err)
+
+	// ...but ShapeList hands each "type" to the registry
+	var decoded ShapeList
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		fmt.Println("unmarshal:", err)
+		return
+	}
+	for _, s := range decoded {
+		fmt.Printf("  decoded %-8s area %.2f\n", shapeKind(s), s.Area())
+	}
+
+	var wrong Rectangle
+	err = json.Unmarshal([]byte(`{"type":"circle","radius":2}`), &wrong)
+	fmt.Printf("circle into Rectangle: %v\n", err)
+
+	// TextMarshaler is what encoding/json uses for map keys (and what
+	// flag.TextVar and slog use for values). Without it, a struct
+	// can't be a JSON object key at all.
+	labels := map[Circle]string{{Radius: 1}: "small", {Radius: 10}: "large"}
+	keyed, _ := json.Marshal(labels)
+	fmt.Printf("map key: %s\n", keyed)
+
+	var back map[Circle]string
+	if err := json.Unmarshal(keyed, &back); err == nil {
+		fmt.Printf("decoded: %v\n", back)
+	}
 }
 
 // printShapeInfo accepts any Shape
@@ -185,3 +976,88 @@ func describeShape(s Shape) {
 		fmt.Printf("Unknown shape: %T\n", v)
 	}
 }
+
+// TotalArea sums areas through the Shape interface
+func TotalArea(shapes []Shape) float64 {
+	total := 0.0
+	for _, s := range shapes {
+		total += s.Area()
+	}
+	return total
+}
+
+// LargestShape returns the shape with the biggest area, as a Shape
+func LargestShape(shapes []Shape) Shape {
+	var best Shape
+	for _, s := range shapes {
+		if best == nil || s.Area() > best.Area() {
+			best = s
+		}
+	}
+	return best
+}
+
+// TotalAreaOf is TotalArea with a type parameter: S can be any
+// concrete shape type, or Shape itself
+func TotalAreaOf[S Shape](shapes []S) float64 {
+	total := 0.0
+	for _, s := range shapes {
+		total += s.Area()
+	}
+	return total
+}
+
+// Largest returns the element with the biggest area, keeping its type.
+// It panics on an empty slice, like slices.Max.
+func Largest[S Shape](shapes []S) S {
+	best := shapes[0]
+	for _, s := range shapes[1:] {
+		if s.Area() > best.Area() {
+			best = s
+		}
+	}
+	return best
+}
+
+// Number is a type-set constraint: it can only be used as a
+// constraint, never as the type of a variable
+type Number interface {
+	~int | ~int64 | ~float64
+}
+
+// Sum adds numbers of any Number type
+func Sum[N Number](nums []N) N {
+	var total N
+	for _, n := range nums {
+		total += n
+	}
+	return total
+}
+
+// Map applies f to every element; the method expression
+// Shape.Perimeter is a func(Shape) float64, so it fits directly
+func Map[T, U any](in []T, f func(T) U) []U {
+	out := make([]U, len(in))
+	for i, v := range in {
+		out[i] = f(v)
+	}
+	return out
+}
+
+// shapeKind returns the type name without the package, e.g. "Circle"
+func shapeKind(s Shape) string {
+	name := fmt.Sprintf("%T", s)
+	return name[strings.LastIndexByte(name, '.')+1:]
+}
+
+// printSorted prints one line per sort: kind and area of each shape
+func printSorted(label string, shapes []Shape) {
+	parts := make([]string, len(shapes))
+	for i, s := range shapes {
+		parts[i] = fmt.Sprintf("%s %.1f", shapeKind(s), s.Area())
+		if r, ok := s.(Rectangle); ok {
+			parts[i] = fmt.Sprintf("Rect %gx%g %.1f", r.Width, r.Height, r.Area())
+		}
+	}
+	fmt.Printf("%-24s %s\n", label+":", strings.Join(parts, ", "))
+}
@@ -0,0 +1,456 @@
+// Testing with Interfaces - Fakes instead of mock frameworks
+//
+// ReportGenerator depends on ShapeRepository, not on a file. Because
+// interfaces are satisfied implicitly, a test can declare its own
+// tiny type with a ListShapes method and pass it in - the production
+// code never has to know the fake exists.
+//
+// The benchmarks at the end put numbers on "interfaces are slow":
+// the same Area() loop over a concrete slice, through the Shape
+// interface, and through a generic constraint.
+//
+// Run tests:
+//   go test -v interfaces.go interfaces_test.go
+//   go test -run=^$ -bench=Area -benchmem interfaces.go interfaces_test.go
+//
+// See what the compiler inlined and devirtualized:
+//   go test -gcflags=-m -run=^$ -bench=Area interfaces.go interfaces_test.go 2>&1 | grep -E 'inlin|devirtualiz'
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// fakeRepo is a hand-written test double: canned shapes or an error
+type fakeRepo struct {
+	shapes []Shape
+	err    error
+	calls  int
+}
+
+func (f *fakeRepo) ListShapes() ([]Shape, error) {
+	f.calls++
+	return f.shapes, f.err
+}
+
+// Compile-time checks that both implementations satisfy the interface
+var (
+	_ ShapeRepository = (*fakeRepo)(nil)
+	_ ShapeRepository = fileShapeRepository{}
+)
+
+func TestReportGenerator(t *testing.T) {
+	errDown := errors.New("database is down")
+
+	tests := []struct {
+		name     string
+		repo     *fakeRepo
+		wantErr  error
+		wantText []string
+	}{
+		{
+			name: "mixed shapes",
+			repo: &fakeRepo{shapes: []Shape{
+				Rectangle{Width: 2, Height: 3},
+				Circle{Radius: 1},
+				Rectangle{Width: 1, Height: 1},
+			}},
+			wantText: []string{
+				"Shapes:     3",
+				"Circle:    1",
+				"Rectangle: 2",
+				"Total area: 10.14",
+				"Largest:    Rectangle (6.00)",
+			},
+		},
+		{
+			name:    "repository error is wrapped",
+			repo:    &fakeRepo{err: errDown},
+			wantErr: errDown,
+		},
+		{
+			name:    "empty repository",
+			repo:    &fakeRepo{},
+			wantErr: ErrNoShapes,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			err := NewReportGenerator(tt.repo).Generate(&out)
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Generate() error = %v, want %v", err, tt.wantErr)
+			}
+			if tt.repo.calls != 1 {
+				t.Errorf("ListShapes called %d times, want 1", tt.repo.calls)
+			}
+			for _, want := range tt.wantText {
+				if !strings.Contains(out.String(), want) {
+					t.Errorf("report missing %q:\n%s", want, out.String())
+				}
+			}
+		})
+	}
+}
+
+// The real implementation gets its own test against a temp file
+func TestFileShapeRepository(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []Shape
+		wantErr string
+	}{
+		{
+			name:    "all kinds",
+			content: "rectangle 2 3\n# comment\n\ncircle 1.5\ntriangle 3 4 5\n",
+			want:    []Shape{Rectangle{2, 3}, Circle{1.5}, Triangle{3, 4, 5}},
+		},
+		{
+			name:    "unknown shape reports line",
+			content: "circle 1\nhexagon 2\n",
+			wantErr: ":2: unknown shape",
+		},
+		{
+			name:    "bad number",
+			content: "circle one\n",
+			wantErr: `bad number "one"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "shapes.txt")
+			if err := os.WriteFile(path, []byte(tt.content), 0o644); err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := fileShapeRepository{path: path}.ListShapes()
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("ListShapes() error = %v, want it to contain %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ListShapes() error = %v", err)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d shapes, want %d", len(got), len(tt.want))
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("shape %d = %v, want %v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestFileShapeRepositoryMissingFile(t *testing.T) {
+	repo := fileShapeRepository{path: filepath.Join(t.TempDir(), "missing.txt")}
+	if _, err := repo.ListShapes(); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("ListShapes() error = %v, want os.ErrNotExist", err)
+	}
+}
+
+// TestTypedNil pins down the surprising behavior so it can't be
+// "fixed" by accident in the demo, and checks the real fix works
+func TestTypedNil(t *testing.T) {
+	valid := Rectangle{Width: 1, Height: 1}
+
+	// The concrete helper returns a nil pointer...
+	if p := checkShape(valid); p != nil {
+		t.Fatalf("checkShape(valid) = %v, want nil", p)
+	}
+
+	// ...which becomes a non-nil error once stored in an interface
+	if err := validateShapeBroken(valid); err == nil {
+		t.Error("validateShapeBroken(valid) == nil; typed nil should be non-nil")
+	}
+
+	if err := validateShape(valid); err != nil {
+		t.Errorf("validateShape(valid) = %v (%T), want nil", err, err)
+	}
+
+	tests := []struct {
+		shape    Shape
+		wantKind string
+	}{
+		{Rectangle{Width: 0, Height: 1}, "rectangle"},
+		{Circle{Radius: -1}, "circle"},
+		{Triangle{A: 1, B: 1, C: 5}, "triangle"},
+	}
+	for _, tt := range tests {
+		err := validateShape(tt.shape)
+		var se *ShapeError
+		if !errors.As(err, &se) {
+			t.Errorf("validateShape(%v) = %v, want *ShapeError", tt.shape, err)
+			continue
+		}
+		if se.Kind != tt.wantKind {
+			t.Errorf("validateShape(%v).Kind = %q, want %q", tt.shape, se.Kind, tt.wantKind)
+		}
+	}
+}
+
+func TestNewShape(t *testing.T) {
+	tests := []struct {
+		name    string
+		config  map[string]any
+		want    Shape
+		wantErr bool
+	}{
+		{"rectangle", map[string]any{"type": "rectangle", "width": 2, "height": 3.5}, Rectangle{Width: 2, Height: 3.5}, false},
+		{"circle", map[string]any{"type": "circle", "radius": 1.0}, Circle{Radius: 1}, false},
+		{"plugin from second init", map[string]any{"type": "square", "side": 4}, Rectangle{Width: 4, Height: 4}, false},
+		{"missing type", map[string]any{"radius": 1}, nil, true},
+		{"missing parameter", map[string]any{"type": "triangle", "a": 3, "b": 4}, nil, true},
+		{"non-numeric parameter", map[string]any{"type": "circle", "radius": "big"}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewShape(tt.config)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("NewShape() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("NewShape() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := NewShape(map[string]any{"type": "hexagon"}); !errors.Is(err, ErrUnknownShape) {
+		t.Errorf("NewShape(hexagon) error = %v, want ErrUnknownShape", err)
+	}
+}
+
+func TestRegisterShapeDuplicatePanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("RegisterShape with a duplicate name did not panic")
+		}
+	}()
+	RegisterShape("circle", func(map[string]float64) (Shape, error) { return Circle{}, nil })
+}
+
+func TestShapeListJSONRoundTrip(t *testing.T) {
+	in := ShapeList{
+		Rectangle{Width: 2, Height: 3},
+		Circle{Radius: 1.5},
+		Triangle{A: 3, B: 4, C: 5},
+	}
+
+	data, err := json.Marshal(in)
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+
+	var out ShapeList
+	if err := json.Unmarshal(data, &out); err != nil {
+		t.Fatalf("Unmarshal(%s) error = %v", data, err)
+	}
+	if len(out) != len(in) {
+		t.Fatalf("decoded %d shapes, want %d", len(out), len(in))
+	}
+	for i := range in {
+		if out[i] != in[i] {
+			t.Errorf("shape %d = %v, want %v", i, out[i], in[i])
+		}
+	}
+}
+
+func TestShapeListUnknownType(t *testing.T) {
+	var out ShapeList
+	err := json.Unmarshal([]byte(`[{"type":"circle","radius":1},{"type":"hexagon"}]`), &out)
+	if !errors.Is(err, ErrUnknownShape) {
+		t.Errorf("Unmarshal() error = %v, want ErrUnknownShape", err)
+	}
+}
+
+func TestShapeListEmpty(t *testing.T) {
+	tests := []struct {
+		json    string
+		wantErr bool
+	}{
+		{`[]`, false},
+		{``, true},
+		{`[{}]`, true},
+		{`[{"type":""}]`, true},
+		{`[{"type":"  "}]`, true},
+	}
+	for _, tt := range tests {
+		var out ShapeList
+		err := json.Unmarshal([]byte(tt.json), &out)
+		if (err != nil) != tt.wantErr || len(out) != 0 {
+			t.Errorf("Unmarshal(%q) = %v, %v; want no shapes, error %v", tt.json, out, err, tt.wantErr)
+		}
+	}
+}
+
+func TestShapeListUsesRegistry(t *testing.T) {
+	// "square" has no type of its own and no case anywhere: only its
+	// registered factory knows how to build it
+	var out ShapeList
+	if err := json.Unmarshal([]byte(`[{"type":"square","side":2}]`), &out); err != nil {
+		t.Fatalf("Unmarshal() error = %v", err)
+	}
+	if want := (Rectangle{Width: 2, Height: 2}); len(out) != 1 || out[0] != want {
+		t.Errorf("decoded %v, want [%v]", out, want)
+	}
+}
+
+func TestShapeText(t *testing.T) {
+	c := Circle{Radius: 2.5}
+	text, err := c.MarshalText()
+	if err != nil || string(text) != "circle 2.5" {
+		t.Fatalf("MarshalText() = %q, %v; want \"circle 2.5\"", text, err)
+	}
+
+	var got Circle
+	if err := got.UnmarshalText(text); err != nil || got != c {
+		t.Errorf("UnmarshalText(%q) = %v, %v; want %v", text, got, err, c)
+	}
+
+	// Text for a different shape must not decode into a Circle
+	if err := got.UnmarshalText([]byte("rectangle 1 2")); err == nil {
+		t.Error("UnmarshalText(rectangle) into Circle succeeded, want error")
+	}
+
+	// Nor must empty text, which is what a "" map key hands over
+	for _, text := range []string{"", "  \t"} {
+		if err := new(Circle).UnmarshalText([]byte(text)); err == nil {
+			t.Errorf("UnmarshalText(%q) succeeded, want error", text)
+		}
+		key, _ := json.Marshal(text)
+		var m map[Circle]string
+		if err := json.Unmarshal([]byte(`{`+string(key)+`:"x"}`), &m); err == nil {
+			t.Errorf("map key %s decoded to %v, want error", key, m)
+		}
+	}
+}
+
+// sink keeps results alive so the compiler can't delete the loops
+var sink float64
+
+// The loops live in their own functions rather than inside b.Loop():
+// the compiler deliberately keeps calls in a b.Loop body from being
+// inlined, which would hide exactly the effect being measured.
+
+// sumConcrete calls Rectangle.Area directly; it gets inlined away
+func sumConcrete(rects []Rectangle) float64 {
+	total := 0.0
+	for _, r := range rects {
+		total += r.Area()
+	}
+	return total
+}
+
+// areaNoInline is Rectangle.Area with inlining switched off: the cost
+// of a plain, statically known call
+//
+//go:noinline
+func areaNoInline(r Rectangle) float64 {
+	return r.Width * r.Height
+}
+
+func sumNoInline(rects []Rectangle) float64 {
+	total := 0.0
+	for _, r := range rects {
+		total += areaNoInline(r)
+	}
+	return total
+}
+
+// sumDevirtualized stores each Rectangle in a Shape and calls through
+// it. The compiler can see the dynamic type is always Rectangle, so it
+// replaces the indirect call with a direct one and then inlines it -
+// -gcflags=-m reports "devirtualizing s.Area". Profile-guided
+// optimization (go build -pgo) does the same for call sites whose
+// target is merely likely rather than provable.
+func sumDevirtualized(rects []Rectangle) float64 {
+	total := 0.0
+	for _, r := range rects {
+		var s Shape = r
+		total += s.Area()
+	}
+	return total
+}
+
+// BenchmarkArea sums Area() over 1024 shapes per iteration:
+//   concrete           inlined, no call at all
+//   concrete-noinline  a real call, but a direct one
+//   interface          an indirect call through the itab
+//   interface-mixed    the same, but the target changes per element
+//   generic-concrete   S = Rectangle, but methods are still called
+//                      through the GC-shape dictionary, i.e. indirectly
+//   generic-interface  S = Shape, so it's the interface case again
+//   devirtualized      an interface call the compiler turned back into concrete
+// Expect concrete and devirtualized to run several times faster than
+// the rest, which cluster together; generics do not buy speed here.
+// What costs time is losing inlining, not the indirect call itself -
+// a few nanoseconds that only matter in a tight loop doing little else.
+func BenchmarkArea(b *testing.B) {
+	const n = 1024
+	rects := make([]Rectangle, n)
+	shapes := make([]Shape, n)
+	mixed := make([]Shape, n)
+	for i := range n {
+		rects[i] = Rectangle{Width: float64(i), Height: 2}
+		shapes[i] = rects[i]
+		switch i % 3 {
+		case 0:
+			mixed[i] = rects[i]
+		case 1:
+			mixed[i] = Circle{Radius: float64(i)}
+		default:
+			mixed[i] = Triangle{A: 3, B: 4, C: 5}
+		}
+	}
+
+	b.Run("concrete", func(b *testing.B) {
+		for b.Loop() {
+			sink = sumConcrete(rects)
+		}
+	})
+	b.Run("concrete-noinline", func(b *testing.B) {
+		for b.Loop() {
+			sink = sumNoInline(rects)
+		}
+	})
+	b.Run("interface", func(b *testing.B) {
+		for b.Loop() {
+			sink = TotalArea(shapes)
+		}
+	})
+	// Triangle.Area calls math.Sqrt, so part of this gap is the work
+	// itself; the rest is the branch predictor missing the call target
+	b.Run("interface-mixed", func(b *testing.B) {
+		for b.Loop() {
+			sink = TotalArea(mixed)
+		}
+	})
+	b.Run("generic-concrete", func(b *testing.B) {
+		for b.Loop() {
+			sink = TotalAreaOf(rects)
+		}
+	})
+	b.Run("generic-interface", func(b *testing.B) {
+		for b.Loop() {
+			sink = TotalAreaOf(shapes)
+		}
+	})
+	b.Run("devirtualized", func(b *testing.B) {
+		for b.Loop() {
+			sink = sumDevirtualized(rects)
+		}
+	})
+}
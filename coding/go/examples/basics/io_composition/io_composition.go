@@ -0,0 +1,605 @@
+// io Composition - Pipes, tees, multi-writers, limits and sections
+//
+// Almost everything in Go that moves bytes does it through io.Reader
+// and io.Writer: files, sockets, HTTP bodies, gzip, hashes. The io
+// package adds small adapters that plug them together, so a stream can
+// be hashed, compressed, capped, logged and copied in one pass without
+// ever being held in memory.
+//
+// This example runs an upload server and client in one process:
+//   - Upload: the client gzips a file on the fly into the request
+//     body through an io.Pipe, hashing the original with a TeeReader,
+//     and sends the hash in an HTTP trailer, the one place it can go
+//     when the body is streamed. The server caps the bytes it accepts
+//     before and after decompressing, and writes the file and its
+//     hash at once with a MultiWriter
+//   - Chunked upload: the client sends parts of one file in parallel,
+//     each an io.SectionReader over it, and retries a part that fails
+//     by reading its section again. The server writes each part at
+//     its offset with an io.OffsetWriter
+//   - Proxy: a handler streams a file from upstream to the client,
+//     counting it and logging its first bytes as it goes
+//
+// And the pitfalls of each adapter, shown first on their own: a
+// LimitReader that truncates without a word, a Pipe with no buffer,
+// a MultiWriter that gives up at the first short write.
+//
+// Usage:
+//   go run io_composition.go
+//
+// Run tests:
+//   go test -v io_composition.go io_composition_test.go
+//   go test -run=^$ -bench=. io_composition.go io_composition_test.go
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ============================================================
+// Small adapters the io package doesn't have
+// ============================================================
+
+// ErrTooLarge is returned by a reader from limited when its source has
+// more than the limit
+var ErrTooLarge = errors.New("too large")
+
+// limited is io.LimitReader that tells the difference between a stream
+// that ended and one that was cut off: after n bytes it checks for one
+// more, and returns ErrTooLarge if there is one. io.LimitReader just
+// returns io.EOF, and a truncated upload looks like a complete one
+func limited(r io.Reader, n int64) io.Reader {
+	return io.MultiReader(io.LimitReader(r, n), overflow{r})
+}
+
+// overflow is what limited reads once the limit is used up
+type overflow struct{ r io.Reader }
+
+func (o overflow) Read([]byte) (int, error) {
+	var one [1]byte
+	for {
+		n, err := o.r.Read(one[:])
+		if n > 0 {
+			return 0, ErrTooLarge
+		}
+		if err != nil {
+			return 0, err // io.EOF: the stream fit exactly
+		}
+	}
+}
+
+// headWriter keeps the first n bytes written to it and drops the rest.
+// It reports every write as complete, even the dropped ones: a
+// MultiWriter stops at the first writer that writes short, and a log
+// filling up must not stop the stream it is logging
+type headWriter struct {
+	buf bytes.Buffer
+	n   int
+}
+
+func (h *headWriter) Write(p []byte) (int, error) {
+	if room := h.n - h.buf.Len(); room > 0 {
+		h.buf.Write(p[:min(room, len(p))])
+	}
+	return len(p), nil
+}
+
+// counter is a Writer that only counts. In a MultiWriter it measures
+// the stream; with atomics it can be read while the copy runs
+type counter struct{ n atomic.Int64 }
+
+func (c *counter) Write(p []byte) (int, error) {
+	c.n.Add(int64(len(p)))
+	return len(p), nil
+}
+
+// ============================================================
+// The server
+// ============================================================
+
+const hashTrailer = "X-Content-Sha256"
+
+type server struct {
+	dir     string
+	maxWire int64 // bytes of request body, compressed
+	maxSize int64 // bytes of file, once decompressed
+	// failAt, if not -1, is the offset of a chunk to fail halfway
+	// through, once, as a crash or a dropped connection would
+	failAt atomic.Int64
+	log    io.Writer
+	mu     sync.Mutex // serializes creating chunked files
+}
+
+func newServer(dir string, log io.Writer) *server {
+	s := &server{dir: dir, maxWire: 1 << 20, maxSize: 4 << 20, log: log}
+	s.failAt.Store(-1)
+	return s
+}
+
+func (s *server) routes(upstream string) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("PUT /files/{name}", s.putFile)
+	mux.HandleFunc("PUT /chunks/{name}", s.putChunk)
+	mux.HandleFunc("GET /files/{name}", s.getFile)
+	mux.HandleFunc("GET /proxy/{name}", func(w http.ResponseWriter, r *http.Request) {
+		s.proxy(w, r, upstream)
+	})
+	return mux
+}
+
+func (s *server) path(r *http.Request) string {
+	return filepath.Join(s.dir, filepath.Base(r.PathValue("name")))
+}
+
+// putFile stores a gzipped body. Nothing is held in memory: the body is
+// decompressed, written to a temporary file and hashed in one copy,
+// and the file only takes its name once the trailer's hash matches
+func (s *server) putFile(w http.ResponseWriter, r *http.Request) {
+	// Two limits: on the wire, and after gzip. The second is what stops
+	// a few KB of compressed zeros from filling the disk
+	zr, err := gzip.NewReader(limited(r.Body, s.maxWire))
+	if err != nil {
+		http.Error(w, "gzip: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	tmp, err := os.CreateTemp(s.dir, "upload-*")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer os.Remove(tmp.Name()) // a no-op once renamed
+	defer tmp.Close()
+
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(tmp, h), limited(zr, s.maxSize))
+	if err == nil {
+		// The trailer arrives after the body, and is only there once the
+		// body has been read to its end, past the gzip stream
+		_, err = io.Copy(io.Discard, limited(r.Body, s.maxWire))
+	}
+	switch {
+	case errors.Is(err, ErrTooLarge):
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	case err != nil:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	got := hex.EncodeToString(h.Sum(nil))
+	if want := r.Trailer.Get(hashTrailer); got != want {
+		http.Error(w, fmt.Sprintf("sha256 %.12s, trailer says %.12s", got, want), http.StatusUnprocessableEntity)
+		return
+	}
+	if err := tmp.Close(); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if err := os.Rename(tmp.Name(), s.path(r)); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	fmt.Fprintf(w, "stored %d bytes, sha256 %.12s", n, got)
+}
+
+// putChunk writes the body at ?offset= in the named file. Chunks can
+// arrive in any order and at once: each writes only its own range
+func (s *server) putChunk(w http.ResponseWriter, r *http.Request) {
+	off, err := strconv.ParseInt(r.URL.Query().Get("offset"), 10, 64)
+	if err != nil || off < 0 || r.ContentLength < 0 || off+r.ContentLength > s.maxSize {
+		http.Error(w, "need an offset and a Content-Length within the size limit", http.StatusBadRequest)
+		return
+	}
+	s.mu.Lock()
+	f, err := os.OpenFile(s.path(r), os.O_WRONLY|os.O_CREATE, 0o644)
+	s.mu.Unlock()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+
+	body := limited(r.Body, r.ContentLength)
+	if s.failAt.CompareAndSwap(off, -1) {
+		body = io.LimitReader(body, r.ContentLength/2)
+	}
+	// OffsetWriter turns WriteAt into Write, starting at off: the writer
+	// side of what SectionReader does for reading
+	n, err := io.Copy(io.NewOffsetWriter(f, off), body)
+	if err == nil && n != r.ContentLength {
+		err = fmt.Errorf("got %d of %d bytes", n, r.ContentLength)
+	}
+	if err != nil {
+		http.Error(w, fmt.Sprintf("chunk at %d: %v", off, err), http.StatusServiceUnavailable)
+		return
+	}
+	fmt.Fprintf(w, "%d bytes at %d", n, off)
+}
+
+// getFile serves a stored file. http.ServeContent handles Range
+// requests by seeking the file, so a client can fetch any part of it
+func (s *server) getFile(w http.ResponseWriter, r *http.Request) {
+	f, err := os.Open(s.path(r))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+	st, err := f.Stat()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	http.ServeContent(w, r, st.Name(), st.ModTime(), f)
+}
+
+// proxy streams a file from upstream to the client. Alongside, a
+// MultiWriter counts the bytes and keeps the first few for the log,
+// so the log line costs no second pass and no buffering
+func (s *server) proxy(w http.ResponseWriter, r *http.Request, upstream string) {
+	resp, err := http.Get(upstream + "/files/" + r.PathValue("name"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		http.Error(w, resp.Status, resp.StatusCode)
+		return
+	}
+	w.Header().Set("Content-Type", resp.Header.Get("Content-Type"))
+
+	head := &headWriter{n: 48}
+	var count counter
+	crc := crc32.NewIEEE()
+	start := time.Now()
+	_, err = io.Copy(io.MultiWriter(w, head, &count, crc), resp.Body)
+	fmt.Fprintf(s.log, "  proxy log: %s %d bytes in %v, crc32 %08x, err %v, head %q\n",
+		r.PathValue("name"), count.n.Load(), time.Since(start).Round(time.Millisecond), crc.Sum32(), err, head.buf.String())
+}
+
+// ============================================================
+// The client
+// ============================================================
+
+// upload PUTs src to url, gzipped, without reading it all first. The
+// request wants a Reader for its body, but gzip is a Writer: an
+// io.Pipe joins them, with the gzip end running in its own goroutine.
+// Returns the sha256 of src and the bytes sent on the wire
+func upload(url string, src io.Reader) (sum string, wire int64, err error) {
+	pr, pw := io.Pipe()
+	req, err := http.NewRequest(http.MethodPut, url, pr)
+	if err != nil {
+		return "", 0, err
+	}
+	// Announced now, filled in once the body is done: the transport
+	// reads trailers after the body has returned io.EOF
+	req.Trailer = http.Header{hashTrailer: nil}
+
+	h := sha256.New()
+	var sent counter
+	go func() {
+		zw := gzip.NewWriter(io.MultiWriter(pw, &sent))
+		// Every byte gzip reads from src, the tee writes to h
+		_, err := io.Copy(zw, io.TeeReader(src, h))
+		if err == nil {
+			err = zw.Close()
+		}
+		if err == nil {
+			req.Trailer.Set(hashTrailer, hex.EncodeToString(h.Sum(nil)))
+		}
+		// CloseWithError(nil) is Close. With an error, the transport's
+		// next Read returns it and the request fails, instead of sending
+		// a body that looks complete and isn't
+		pw.CloseWithError(err)
+	}()
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		pr.CloseWithError(err) // unblock the goroutine if it is mid-write
+		return "", 0, err
+	}
+	defer resp.Body.Close()
+	msg, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		return "", sent.n.Load(), fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return hex.EncodeToString(h.Sum(nil)), sent.n.Load(), nil
+}
+
+// uploadChunks PUTs f to url in up to parts parts, all at once, and
+// retries each part up to tries times. Each part's body is a
+// SectionReader: its own offset into f, so they don't interfere, and a
+// retry is a Seek back to the start of the section
+func uploadChunks(url string, f io.ReaderAt, size int64, parts, tries int, log io.Writer) error {
+	chunk := max(1, (size+int64(parts)-1)/int64(parts))
+	var errs []error
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for i, off := 0, int64(0); off < size; i, off = i+1, off+chunk {
+		// A SectionReader's n is not checked: past the end it reads
+		// short, and negative it claims a size near 1<<63. Keep it in range
+		sec := io.NewSectionReader(f, off, min(chunk, size-off))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for try := 1; ; try++ {
+				err := putSection(fmt.Sprintf("%s?offset=%d", url, off), sec)
+				if err == nil {
+					return
+				}
+				fmt.Fprintf(log, "  part %d, try %d: %v\n", i, try, err)
+				if try == tries {
+					mu.Lock()
+					errs = append(errs, err)
+					mu.Unlock()
+					return
+				}
+				sec.Seek(0, io.SeekStart)
+			}
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+func putSection(url string, sec *io.SectionReader) error {
+	req, err := http.NewRequest(http.MethodPut, url, sec)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = sec.Size() // a SectionReader knows; no chunked encoding needed
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// ============================================================
+// The pieces on their own
+// ============================================================
+
+// failAfter is a Writer that takes n bytes and then fails
+type failAfter struct{ n int }
+
+func (f *failAfter) Write(p []byte) (int, error) {
+	if len(p) > f.n {
+		w := f.n
+		f.n = 0
+		return w, errors.New("disk full")
+	}
+	f.n -= len(p)
+	return len(p), nil
+}
+
+func pieces() {
+	// LimitReader: the copy ends quietly at the limit, and nothing says
+	// there was more. limited says so
+	src := "0123456789"
+	var out strings.Builder
+	n, err := io.Copy(&out, io.LimitReader(strings.NewReader(src), 4))
+	fmt.Printf("LimitReader(4):      copied %d %q, err %v\n", n, out.String(), err)
+	out.Reset()
+	n, err = io.Copy(&out, limited(strings.NewReader(src), 4))
+	fmt.Printf("limited(4):          copied %d %q, err %v\n", n, out.String(), err)
+
+	// SectionReader: a window onto a ReaderAt with its own offset. Two
+	// sections over one reader read independently
+	ra := strings.NewReader("header|body-of-the-record|trailer")
+	body := io.NewSectionReader(ra, 7, 18)
+	tail := io.NewSectionReader(ra, 26, 7)
+	b1, _ := io.ReadAll(body)
+	b2, _ := io.ReadAll(tail)
+	body.Seek(5, io.SeekStart)
+	b3, _ := io.ReadAll(body)
+	fmt.Printf("SectionReader:       %q and %q; after Seek(5) %q\n", b1, b2, b3)
+
+	// TeeReader: whatever is read through it is written to the side
+	var seen strings.Builder
+	tee := io.TeeReader(strings.NewReader("only what is read"), &seen)
+	io.CopyN(io.Discard, tee, 9)
+	fmt.Printf("TeeReader:           read 9, the tee saw %q\n", seen.String())
+
+	// MultiWriter: one write goes to every writer in order, and stops at
+	// the first that fails - the writers after it never see the bytes
+	var first, last strings.Builder
+	mw := io.MultiWriter(&first, &failAfter{n: 3}, &last)
+	_, err = io.WriteString(mw, "abcdef")
+	fmt.Printf("MultiWriter:         err %v; first got %q, last got %q\n", err, first.String(), last.String())
+
+	// Pipe: no buffer at all. A Write blocks until Reads have taken all
+	// of it, so writer and reader must be in different goroutines
+	pr, pw := io.Pipe()
+	wrote := make(chan time.Duration)
+	go func() {
+		start := time.Now()
+		pw.Write([]byte("hello"))
+		wrote <- time.Since(start)
+		pw.CloseWithError(errors.New("producer failed"))
+	}()
+	time.Sleep(20 * time.Millisecond)
+	got := make([]byte, 5)
+	io.ReadFull(pr, got)
+	took := <-wrote
+	_, err = pr.Read(got)
+	fmt.Printf("Pipe:                Write waited %v for the reader; next Read: %v\n",
+		took.Round(10*time.Millisecond), err)
+}
+
+// ============================================================
+// main
+// ============================================================
+
+// makeFile writes a CSV of roughly size bytes: text, so gzip has
+// something to do
+func makeFile(path string, size int) (int64, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	var c counter
+	w := io.MultiWriter(f, &c)
+	io.WriteString(w, "id,sensor,reading\n")
+	for i := 0; c.n.Load() < int64(size); i++ {
+		fmt.Fprintf(w, "%d,sensor-%02d,%.3f\n", i, i%16, float64(i%1000)/7)
+	}
+	return c.n.Load(), f.Close()
+}
+
+func fileSHA256(r io.Reader) string {
+	h := sha256.New()
+	io.Copy(h, r)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func main() {
+	fmt.Println("=== The pieces, and their pitfalls ===")
+	pieces()
+
+	dir, err := os.MkdirTemp("", "io-composition-")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer os.RemoveAll(dir)
+	srcDir, stored := filepath.Join(dir, "client"), filepath.Join(dir, "server")
+	os.Mkdir(srcDir, 0o755)
+	os.Mkdir(stored, 0o755)
+
+	s := newServer(stored, os.Stdout)
+	ts := httptest.NewUnstartedServer(nil)
+	ts.Config.Handler = s.routes("http://" + ts.Listener.Addr().String())
+	ts.Start()
+	defer ts.Close()
+
+	src := filepath.Join(srcDir, "readings.csv")
+	size, err := makeFile(src, 2<<20)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+
+	fmt.Println()
+	fmt.Println("=== Upload: gzip through a pipe, hash in a tee, check in a trailer ===")
+	f, _ := os.Open(src)
+	start := time.Now()
+	sum, wire, err := upload(ts.URL+"/files/readings.csv", f)
+	f.Close()
+	if err != nil {
+		fmt.Println("upload:", err)
+		return
+	}
+	fmt.Printf("  sent %d bytes as %d gzipped in %v, sha256 %.12s\n",
+		size, wire, time.Since(start).Round(time.Millisecond), sum)
+	sf, _ := os.Open(filepath.Join(stored, "readings.csv"))
+	fmt.Printf("  server's copy: sha256 %.12s\n", fileSHA256(sf))
+	sf.Close()
+
+	// The same file, but the server's limit on decompressed bytes is
+	// below its size: rejected mid-stream, and nothing is kept
+	s.maxSize = 1 << 20
+	f, _ = os.Open(src)
+	_, wire, err = upload(ts.URL+"/files/big.csv", f)
+	f.Close()
+	s.maxSize = 4 << 20
+	_, statErr := os.Stat(filepath.Join(stored, "big.csv"))
+	fmt.Printf("  over the size limit: %v\n    (%d bytes had gone on the wire; file kept: %v)\n",
+		err, wire, statErr == nil)
+
+	// A gzip bomb: 64 MB of zeros is 64 KB compressed, well under the
+	// wire limit. The limit after decompression is what catches it
+	_, _, err = upload(ts.URL+"/files/bomb", io.LimitReader(zeros{}, 64<<20))
+	fmt.Printf("  64 MB of zeros:    %v\n", err)
+
+	// A source that fails partway: the pipe carries the error to the
+	// transport, so the server sees a broken body, not a short file
+	_, _, err = upload(ts.URL+"/files/broken", io.MultiReader(strings.NewReader("id,sensor\n"), errReader{}))
+	fmt.Printf("  source fails:      %v\n", err)
+
+	fmt.Println()
+	fmt.Println("=== Chunked upload: four SectionReaders, one OffsetWriter each ===")
+	s.failAt.Store((size + 3) / 4) // part 1 fails halfway, once
+	f, _ = os.Open(src)
+	start = time.Now()
+	err = uploadChunks(ts.URL+"/chunks/parts.csv", f, size, 4, 3, os.Stdout)
+	if err != nil {
+		fmt.Println("  chunks:", err)
+		f.Close()
+		return
+	}
+	took := time.Since(start)
+	local := fileSHA256(io.NewSectionReader(f, 0, size))
+	resp, err := http.Get(ts.URL + "/files/parts.csv")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	remote := fileSHA256(resp.Body)
+	resp.Body.Close()
+	fmt.Printf("  %d bytes in 4 parts in %v; sha256 local %.12s, server %.12s\n",
+		size, took.Round(time.Millisecond), local, remote)
+
+	// Range requests: ServeContent seeks the file; the client checks the
+	// bytes against the same window of its own copy
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/files/parts.csv", nil)
+	req.Header.Set("Range", "bytes=1000000-1000039")
+	resp, err = http.DefaultClient.Do(req)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	part, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	mine, _ := io.ReadAll(io.NewSectionReader(f, 1000000, 40))
+	f.Close()
+	fmt.Printf("  Range 1000000-1000039: %s, %q, same as local: %v\n",
+		resp.Status, part, bytes.Equal(part, mine))
+
+	fmt.Println()
+	fmt.Println("=== Proxy: stream to the client, count and log on the side ===")
+	resp, err = http.Get(ts.URL + "/proxy/readings.csv")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	n, _ := io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	fmt.Printf("  client received %d bytes\n", n)
+}
+
+// zeros is an endless Reader of zero bytes, like /dev/zero
+type zeros struct{}
+
+func (zeros) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+// errReader fails every Read
+type errReader struct{}
+
+func (errReader) Read([]byte) (int, error) {
+	return 0, errors.New("disk read error")
+}
@@ -0,0 +1,346 @@
+// Testing io Composition - Every way an upload can end
+//
+// A pipeline of readers and writers has as many ways to end as it has
+// stages: the source fails, a limit is hit, the hash disagrees, the
+// connection drops halfway. Each test drives the real server through
+// httptest and checks both what the client is told and what is left on
+// the server's disk. Run them with -race: the pipe, the trailer and
+// the parallel chunks all cross goroutines.
+//
+// Run tests:
+//   go test -v -race io_composition.go io_composition_test.go
+//   go test -run=^$ -bench=. -benchmem io_composition.go io_composition_test.go
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLimited(t *testing.T) {
+	tests := []struct {
+		src     string
+		n       int64
+		want    string
+		wantErr error
+	}{
+		{"abc", 5, "abc", nil},
+		{"abcde", 5, "abcde", nil}, // exactly the limit is fine
+		{"abcdef", 5, "abcde", ErrTooLarge},
+		{"", 0, "", nil},
+		{"a", 0, "", ErrTooLarge},
+	}
+	for _, tt := range tests {
+		got, err := io.ReadAll(limited(strings.NewReader(tt.src), tt.n))
+		if string(got) != tt.want || !errors.Is(err, tt.wantErr) {
+			t.Errorf("limited(%q, %d) = %q, %v; want %q, %v", tt.src, tt.n, got, err, tt.want, tt.wantErr)
+		}
+	}
+
+	// An error from the source is passed on, not mistaken for the end
+	_, err := io.ReadAll(limited(errReader{}, 5))
+	if err == nil || errors.Is(err, ErrTooLarge) {
+		t.Errorf("limited(failing source) = %v", err)
+	}
+}
+
+func TestHeadWriter(t *testing.T) {
+	head := &headWriter{n: 4}
+	var all bytes.Buffer
+	mw := io.MultiWriter(head, &all)
+	for _, s := range []string{"ab", "cdef", "ghij"} {
+		if n, err := io.WriteString(mw, s); n != len(s) || err != nil {
+			t.Fatalf("Write(%q) = %d, %v", s, n, err)
+		}
+	}
+	if head.buf.String() != "abcd" || all.String() != "abcdefghij" {
+		t.Errorf("head %q, all %q", head.buf.String(), all.String())
+	}
+}
+
+// startServer runs a server storing into a fresh directory
+func startServer(t *testing.T) (*server, *httptest.Server) {
+	t.Helper()
+	s := newServer(t.TempDir(), io.Discard)
+	ts := httptest.NewUnstartedServer(nil)
+	ts.Config.Handler = s.routes("http://" + ts.Listener.Addr().String())
+	ts.Start()
+	t.Cleanup(ts.Close)
+	return s, ts
+}
+
+func sha(b []byte) string {
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:])
+}
+
+// csv is test data that compresses the way the demo's does
+func csv(n int) []byte {
+	var b bytes.Buffer
+	for i := 0; b.Len() < n; i++ {
+		b.WriteString("42,sensor-07,")
+		b.WriteByte(byte('0' + i%10))
+		b.WriteByte('\n')
+	}
+	return b.Bytes()[:n]
+}
+
+func TestUpload(t *testing.T) {
+	s, ts := startServer(t)
+	data := csv(300 << 10)
+	sum, wire, err := upload(ts.URL+"/files/a.csv", bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sum != sha(data) {
+		t.Errorf("upload returned sha256 %s, want %s", sum, sha(data))
+	}
+	if wire <= 0 || wire >= int64(len(data)) {
+		t.Errorf("%d bytes on the wire for %d of csv; want fewer, gzipped", wire, len(data))
+	}
+	stored, err := os.ReadFile(filepath.Join(s.dir, "a.csv"))
+	if err != nil || !bytes.Equal(stored, data) {
+		t.Errorf("stored %d bytes (%v), want the %d uploaded", len(stored), err, len(data))
+	}
+}
+
+// put sends body as a raw request, for the cases upload would never
+// produce: a wrong trailer, a body that isn't gzip
+func put(t *testing.T, url string, body []byte, trailer string) *http.Response {
+	t.Helper()
+	// MultiReader hides the body's length, so it goes chunked and can
+	// carry the trailer
+	req, _ := http.NewRequest(http.MethodPut, url, io.MultiReader(bytes.NewReader(body)))
+	req.Trailer = http.Header{hashTrailer: {trailer}}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	return resp
+}
+
+func gzipped(b []byte) []byte {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	zw.Write(b)
+	zw.Close()
+	return buf.Bytes()
+}
+
+func TestUploadRejected(t *testing.T) {
+	s, ts := startServer(t)
+	s.maxWire, s.maxSize = 64<<10, 256<<10
+	data := csv(100 << 10)
+	zdata := gzipped(data)
+	// Hex digests hardly compress: 200 KB of them is over maxWire gzipped
+	var noise bytes.Buffer
+	for i := 0; noise.Len() < 200<<10; i++ {
+		noise.WriteString(sha([]byte{byte(i), byte(i >> 8)}))
+	}
+
+	tests := []struct {
+		name   string
+		body   []byte
+		hash   string
+		status int
+	}{
+		{"wrong hash", zdata, sha([]byte("something else")), http.StatusUnprocessableEntity},
+		{"no hash", zdata, "", http.StatusUnprocessableEntity},
+		{"not gzip", data, sha(data), http.StatusBadRequest},
+		{"truncated gzip", zdata[:len(zdata)/2], sha(data), http.StatusBadRequest},
+		{"over the size limit", gzipped(csv(300 << 10)), "", http.StatusRequestEntityTooLarge},
+		{"bomb", gzipped(make([]byte, 8<<20)), "", http.StatusRequestEntityTooLarge},
+		{"over the wire limit", gzipped(noise.Bytes()), "", http.StatusRequestEntityTooLarge},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := put(t, ts.URL+"/files/x", tt.body, tt.hash)
+			if resp.StatusCode != tt.status {
+				t.Errorf("status %d, want %d", resp.StatusCode, tt.status)
+			}
+			// Nothing is left behind: no file, no temporary
+			if left, _ := os.ReadDir(s.dir); len(left) != 0 {
+				t.Errorf("left %d files on the server", len(left))
+			}
+		})
+	}
+}
+
+func TestUploadSourceFails(t *testing.T) {
+	s, ts := startServer(t)
+	src := io.MultiReader(bytes.NewReader(csv(50<<10)), errReader{})
+	if _, _, err := upload(ts.URL+"/files/x", src); err == nil || !strings.Contains(err.Error(), "disk read error") {
+		t.Errorf("upload(failing source) = %v, want the source's error", err)
+	}
+	if left, _ := os.ReadDir(s.dir); len(left) != 0 {
+		t.Errorf("left %d files on the server", len(left))
+	}
+}
+
+func TestUploadChunks(t *testing.T) {
+	tests := []struct {
+		name    string
+		size    int
+		parts   int
+		failAt  int64
+		tries   int
+		wantErr bool
+	}{
+		{"one part", 10 << 10, 1, -1, 1, false},
+		{"uneven parts", 100<<10 + 3, 4, -1, 1, false},
+		{"more parts than bytes", 3, 8, -1, 1, false}, // empty sections
+		{"retried", 100 << 10, 4, 25 << 10, 2, false},
+		{"out of tries", 100 << 10, 4, 25 << 10, 1, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, ts := startServer(t)
+			s.failAt.Store(tt.failAt)
+			data := csv(tt.size)
+			var log strings.Builder
+			err := uploadChunks(ts.URL+"/chunks/c.csv", bytes.NewReader(data), int64(len(data)), tt.parts, tt.tries, &log)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("uploadChunks = %v, want error %v\n%s", err, tt.wantErr, log.String())
+			}
+			if tt.wantErr {
+				return
+			}
+			stored, _ := os.ReadFile(filepath.Join(s.dir, "c.csv"))
+			if !bytes.Equal(stored, data) {
+				t.Errorf("stored %d bytes, differ from the %d sent", len(stored), len(data))
+			}
+			if tt.failAt >= 0 && !strings.Contains(log.String(), "try 1") {
+				t.Errorf("no failed try logged:\n%s", log.String())
+			}
+		})
+	}
+}
+
+func TestPutChunkChecks(t *testing.T) {
+	s, ts := startServer(t)
+	s.maxSize = 1 << 10
+	for _, tt := range []struct {
+		url  string
+		body io.Reader
+	}{
+		{"/chunks/c", bytes.NewReader(make([]byte, 100))},           // no offset
+		{"/chunks/c?offset=-1", bytes.NewReader(make([]byte, 100))}, // negative
+		{"/chunks/c?offset=1000", bytes.NewReader(make([]byte, 100))},
+		{"/chunks/c?offset=0", strings.NewReader("x")},               // fine
+		{"/chunks/c?offset=0", io.MultiReader(bytes.NewReader(nil))}, // no Content-Length
+	} {
+		req, _ := http.NewRequest(http.MethodPut, ts.URL+tt.url, tt.body)
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		want := http.StatusBadRequest
+		if req.ContentLength == 1 {
+			want = http.StatusOK
+		}
+		if resp.StatusCode != want {
+			t.Errorf("PUT %s, Content-Length %d: status %d, want %d", tt.url, req.ContentLength, resp.StatusCode, want)
+		}
+	}
+}
+
+func TestRangeAndProxy(t *testing.T) {
+	s, ts := startServer(t)
+	var log strings.Builder
+	s.log = &log
+	data := csv(64 << 10)
+	if err := os.WriteFile(filepath.Join(s.dir, "f.csv"), data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	req, _ := http.NewRequest(http.MethodGet, ts.URL+"/files/f.csv", nil)
+	req.Header.Set("Range", "bytes=1000-1099")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	want, _ := io.ReadAll(io.NewSectionReader(bytes.NewReader(data), 1000, 100))
+	if resp.StatusCode != http.StatusPartialContent || !bytes.Equal(got, want) {
+		t.Errorf("Range: %s %q, want 206 %q", resp.Status, got, want)
+	}
+
+	resp, err = http.Get(ts.URL + "/proxy/f.csv")
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ = io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if !bytes.Equal(got, data) {
+		t.Errorf("proxy sent %d bytes, want the %d stored", len(got), len(data))
+	}
+	if !strings.Contains(log.String(), "f.csv 65536 bytes") || !strings.Contains(log.String(), `head "42,sensor-07,0\n`) {
+		t.Errorf("proxy log: %s", log.String())
+	}
+
+	if resp, _ := http.Get(ts.URL + "/proxy/missing"); resp.StatusCode != http.StatusNotFound {
+		t.Errorf("proxy of a missing file: %s", resp.Status)
+	}
+}
+
+// ============================================================
+// Benchmarks
+// ============================================================
+
+// BenchmarkCopy is what each stage costs on 1 MB. plain is almost
+// free: io.Copy sees that bytes.Reader has WriteTo and hands it the
+// whole slice. Wrapping it in a tee hides WriteTo, so io.Copy falls
+// back to a 32 KB buffer and real copying - still cheap. A pipe adds a
+// goroutine handoff per write; sha256 and gzip are where the time goes
+func BenchmarkCopy(b *testing.B) {
+	data := csv(1 << 20)
+	b.SetBytes(int64(len(data)))
+	b.Run("plain", func(b *testing.B) {
+		for b.Loop() {
+			io.Copy(io.Discard, bytes.NewReader(data))
+		}
+	})
+	b.Run("tee+multi", func(b *testing.B) {
+		var c counter
+		head := &headWriter{n: 64}
+		for b.Loop() {
+			io.Copy(io.MultiWriter(io.Discard, &c, head), io.TeeReader(bytes.NewReader(data), io.Discard))
+		}
+	})
+	b.Run("pipe", func(b *testing.B) {
+		for b.Loop() {
+			pr, pw := io.Pipe()
+			go func() {
+				_, err := io.Copy(pw, bytes.NewReader(data))
+				pw.CloseWithError(err)
+			}()
+			io.Copy(io.Discard, pr)
+		}
+	})
+	b.Run("sha256", func(b *testing.B) {
+		for b.Loop() {
+			io.Copy(io.Discard, io.TeeReader(bytes.NewReader(data), sha256.New()))
+		}
+	})
+	b.Run("gzip", func(b *testing.B) {
+		zw := gzip.NewWriter(io.Discard)
+		for b.Loop() {
+			zw.Reset(io.Discard)
+			io.Copy(zw, bytes.NewReader(data))
+			zw.Close()
+		}
+	})
+}
@@ -0,0 +1,659 @@
+// Advanced JSON - Custom codecs, deferred decoding, streams and numbers
+//
+// encoding/json maps JSON onto Go types by reflection, and gets the
+// simple cases right with nothing but struct tags. This example is
+// about the rest: wire formats that don't match the Go types, payloads
+// whose type is only known from a field inside them, documents too big
+// to hold in memory, and numbers that float64 can't carry.
+//
+// The running example is a feed of webhook events, as a payment
+// provider sends them:
+//
+//   {"id":"evt_1","type":"payment.succeeded","created":1760000000,
+//    "data":{"payment_id":"pay_1","amount":19.99,"currency":"EUR"}}
+//
+// This example demonstrates:
+// - MarshalJSON and UnmarshalJSON for types whose wire form differs:
+//   a duration as "1m30s" or as seconds, a time as Unix seconds
+// - The local-type trick for decoding with defaults and validation,
+//   strict decoding that rejects unknown fields, and omitzero
+// - json.RawMessage: decode the envelope first, and the payload later
+//   or never
+// - Polymorphic payloads: a registry keyed by the "type" field, and
+//   unknown types kept as raw bytes so they survive a round trip
+// - json.Decoder.Token: stream an array of any length in constant
+//   memory, and report where in the input a bad element is
+// - Numbers: the precision float64 loses, UseNumber, the ",string"
+//   option, and money that never goes through a float
+//
+// interfaces/interfaces.go covers the Marshaler interfaces themselves
+// and TextMarshaler for map keys.
+//
+// Usage:
+//   go run json.go
+//
+// Run tests:
+//   go test -v json.go json_test.go
+//   go test -run=^$ -bench=. -benchmem json.go json_test.go
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ============================================================
+// 1. Custom MarshalJSON and UnmarshalJSON
+// ============================================================
+
+// Duration is a time.Duration that is written as "1m30s". It reads
+// that, and also a bare number of seconds, as older clients send it
+type Duration time.Duration
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	if string(b) == "null" {
+		return nil // by convention null leaves the value alone
+	}
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		v, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("duration: %w", err)
+		}
+		*d = Duration(v)
+		return nil
+	}
+	var secs float64
+	if err := json.Unmarshal(b, &secs); err != nil {
+		return fmt.Errorf("duration: want a string like \"1m30s\" or seconds, got %s", b)
+	}
+	*d = Duration(secs * float64(time.Second))
+	return nil
+}
+
+// UnixTime is a time written as whole seconds since 1970, the way most
+// webhook APIs send it. Embedding time.Time keeps its methods; the
+// two below replace the RFC 3339 ones it would otherwise promote
+type UnixTime struct {
+	time.Time
+}
+
+func (t UnixTime) MarshalJSON() ([]byte, error) {
+	return strconv.AppendInt(nil, t.Unix(), 10), nil
+}
+
+func (t *UnixTime) UnmarshalJSON(b []byte) error {
+	if string(b) == "null" {
+		return nil
+	}
+	secs, err := strconv.ParseInt(string(b), 10, 64)
+	if err != nil {
+		return fmt.Errorf("unix time: want whole seconds, got %s", b)
+	}
+	t.Time = time.Unix(secs, 0).UTC()
+	return nil
+}
+
+// RetryPolicy is part of a webhook endpoint's config. A field missing
+// from the JSON keeps its default; a policy that makes no sense is an
+// error at decode time, not a surprise later
+type RetryPolicy struct {
+	Attempts int      `json:"attempts"`
+	Backoff  Duration `json:"backoff"`
+	// omitzero (Go 1.24) leaves out a zero value of any type, structs
+	// included. omitempty never omits a struct, so a zero time.Time
+	// would be written as "0001-01-01T00:00:00Z"
+	Paused time.Time `json:"paused,omitzero"`
+}
+
+// UnmarshalJSON decodes into a local type with RetryPolicy's fields
+// but not its methods. Decoding into *RetryPolicy itself would call
+// this method again, forever. It decodes strictly itself: a caller's
+// DisallowUnknownFields doesn't reach into the decoder started here
+func (p *RetryPolicy) UnmarshalJSON(b []byte) error {
+	type plain RetryPolicy
+	v := plain{Attempts: 3, Backoff: Duration(time.Second)} // the defaults
+	if err := decodeStrict(b, &v); err != nil {
+		return fmt.Errorf("retry policy: %w", err)
+	}
+	if v.Attempts < 1 || v.Attempts > 10 {
+		return fmt.Errorf("retry policy: attempts %d, want 1 to 10", v.Attempts)
+	}
+	*p = RetryPolicy(v)
+	return nil
+}
+
+// Endpoint is where to deliver webhooks, and how hard to try
+type Endpoint struct {
+	URL   string      `json:"url"`
+	Retry RetryPolicy `json:"retry"`
+}
+
+// decodeStrict decodes one value from data into v, rejecting fields v
+// has no place for. A typo in a config file is then an error instead
+// of a setting silently ignored. Only for input you own: a feed from
+// someone else will add fields, and must not break when it does
+func decodeStrict(data []byte, v any) error {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		return err
+	}
+	if dec.More() {
+		return errors.New("unexpected data after the value")
+	}
+	return nil
+}
+
+// ============================================================
+// 2. Deferred decoding with json.RawMessage
+// ============================================================
+
+// envelope is the part of an event that is the same for every type.
+// Data is kept as the raw bytes of the payload, still undecoded,
+// because its shape depends on Type
+type envelope struct {
+	ID      string          `json:"id"`
+	Type    string          `json:"type"`
+	Created UnixTime        `json:"created"`
+	Data    json.RawMessage `json:"data"`
+}
+
+// ============================================================
+// 3. Polymorphic payloads
+// ============================================================
+
+// Payload is an event's data. Type is the discriminator written in the
+// envelope's "type" field
+type Payload interface {
+	Type() string
+}
+
+type PaymentSucceeded struct {
+	PaymentID string `json:"payment_id"`
+	Amount    Money  `json:"amount"`
+	Currency  string `json:"currency"`
+}
+
+type RefundIssued struct {
+	RefundID  string `json:"refund_id"`
+	PaymentID string `json:"payment_id"`
+	Amount    Money  `json:"amount"`
+	Reason    string `json:"reason,omitempty"`
+}
+
+type CustomerCreated struct {
+	CustomerID int64  `json:"customer_id,string"` // see section 5
+	Email      string `json:"email"`
+}
+
+// Unknown is a payload of a type this program doesn't know. It keeps
+// the raw bytes, so the event can still be stored or forwarded
+type Unknown struct {
+	Kind string
+	Raw  json.RawMessage
+}
+
+func (PaymentSucceeded) Type() string { return "payment.succeeded" }
+func (RefundIssued) Type() string     { return "refund.issued" }
+func (CustomerCreated) Type() string  { return "customer.created" }
+func (u Unknown) Type() string        { return u.Kind }
+
+// payloadTypes maps a discriminator to a new value to decode into.
+// Adding a type is one line here; nothing else switches on the name
+var payloadTypes = map[string]func() Payload{
+	"payment.succeeded": func() Payload { return new(PaymentSucceeded) },
+	"refund.issued":     func() Payload { return new(RefundIssued) },
+	"customer.created":  func() Payload { return new(CustomerCreated) },
+}
+
+// Event is an envelope with its payload decoded: *PaymentSucceeded,
+// *RefundIssued, *CustomerCreated or *Unknown
+type Event struct {
+	ID      string
+	Created UnixTime
+	Payload Payload
+}
+
+func (e *Event) UnmarshalJSON(b []byte) error {
+	var env envelope
+	if err := json.Unmarshal(b, &env); err != nil {
+		return err
+	}
+	if env.Type == "" {
+		return fmt.Errorf("event %q: no type", env.ID)
+	}
+	p, err := decodePayload(env.Type, env.Data)
+	if err != nil {
+		return fmt.Errorf("event %q: %w", env.ID, err)
+	}
+	*e = Event{ID: env.ID, Created: env.Created, Payload: p}
+	return nil
+}
+
+// decodePayload decodes data as the payload type registered for typ
+func decodePayload(typ string, data json.RawMessage) (Payload, error) {
+	newPayload, ok := payloadTypes[typ]
+	if !ok {
+		// RawMessage's own UnmarshalJSON copied these bytes, so keeping
+		// them doesn't pin the whole input buffer
+		return &Unknown{Kind: typ, Raw: data}, nil
+	}
+	p := newPayload()
+	if err := json.Unmarshal(data, p); err != nil {
+		return nil, fmt.Errorf("%s: %w", typ, err)
+	}
+	return p, nil
+}
+
+// MarshalJSON writes the envelope back, with the type taken from the
+// payload. An Unknown payload goes out as the bytes it came in as
+func (e Event) MarshalJSON() ([]byte, error) {
+	env := envelope{ID: e.ID, Type: e.Payload.Type(), Created: e.Created}
+	if u, ok := e.Payload.(*Unknown); ok {
+		env.Data = u.Raw
+	} else {
+		data, err := json.Marshal(e.Payload)
+		if err != nil {
+			return nil, err
+		}
+		env.Data = data
+	}
+	return json.Marshal(env)
+}
+
+// ============================================================
+// 4. Streaming with json.Decoder.Token
+// ============================================================
+
+// streamEvents reads a page of the feed, {"events":[...], ...}, and
+// calls fn with each event as soon as it is decoded. Only one event is
+// in memory at a time, however long the array. Other keys are skipped
+func streamEvents(r io.Reader, fn func(Event) error) (int, error) {
+	dec := json.NewDecoder(r)
+	if err := expectDelim(dec, '{'); err != nil {
+		return 0, err
+	}
+	n := 0
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return n, err
+		}
+		if key := tok.(string); key != "events" {
+			// Decoding into a RawMessage is the easy way to skip a value.
+			// It buffers that value, which is fine for a cursor or a count
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return n, fmt.Errorf("%s: %w", key, err)
+			}
+			continue
+		}
+		if err := expectDelim(dec, '['); err != nil {
+			return n, err
+		}
+		for dec.More() {
+			var e Event
+			if err := dec.Decode(&e); err != nil {
+				return n, fmt.Errorf("event %d, before byte %d: %w", n, dec.InputOffset(), err)
+			}
+			if err := fn(e); err != nil {
+				return n, err
+			}
+			n++
+		}
+		if err := expectDelim(dec, ']'); err != nil {
+			return n, err
+		}
+	}
+	return n, expectDelim(dec, '}')
+}
+
+// expectDelim reads the next token and checks it is want
+func expectDelim(dec *json.Decoder, want json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if d, ok := tok.(json.Delim); !ok || d != want {
+		return fmt.Errorf("at byte %d: want %v, got %v", dec.InputOffset(), want, tok)
+	}
+	return nil
+}
+
+// writeFeed writes a page of n events: a cursor, then the array. It
+// writes as it goes, so a reader on the other end of a pipe can start
+// before it finishes
+func writeFeed(w io.Writer, n int) error {
+	if _, err := io.WriteString(w, `{"next":"cursor_2","events":[`); err != nil {
+		return err
+	}
+	created := UnixTime{time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)}
+	for i := range n {
+		e := Event{ID: fmt.Sprintf("evt_%d", i), Created: created}
+		switch i % 3 {
+		case 0:
+			e.Payload = &PaymentSucceeded{PaymentID: fmt.Sprintf("pay_%d", i), Amount: Money(100 + i%9900), Currency: "EUR"}
+		case 1:
+			e.Payload = &RefundIssued{RefundID: fmt.Sprintf("re_%d", i), PaymentID: fmt.Sprintf("pay_%d", i-1), Amount: Money(50)}
+		default:
+			e.Payload = &CustomerCreated{CustomerID: int64(i), Email: fmt.Sprintf("user%d@example.com", i)}
+		}
+		b, err := json.Marshal(e)
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			b = append([]byte{','}, b...)
+		}
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, `],"count":`+strconv.Itoa(n)+`}`)
+	return err
+}
+
+// liveHeap is the heap in use after a full collection: what is still
+// reachable, not garbage waiting to be collected
+func liveHeap() uint64 {
+	runtime.GC()
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+	return ms.HeapAlloc
+}
+
+// ============================================================
+// 5. Numbers
+// ============================================================
+
+// Money is an amount in cents. It is written as a JSON number in whole
+// units, 19.99, and read from that number's text, so it never goes
+// through a float64 and never rounds
+type Money int64
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	sign, c := "", int64(m)
+	if c < 0 {
+		sign, c = "-", -c
+	}
+	return fmt.Appendf(nil, "%s%d.%02d", sign, c/100, c%100), nil
+}
+
+func (m *Money) UnmarshalJSON(b []byte) error {
+	s := string(b)
+	if s == "null" {
+		return nil
+	}
+	if strings.HasPrefix(s, `"`) {
+		return fmt.Errorf("money: want a number, got %s", s)
+	}
+	if strings.ContainsAny(s, "eE") {
+		return fmt.Errorf("money: want a plain decimal, got %s", s)
+	}
+	neg := strings.HasPrefix(s, "-")
+	whole, frac, _ := strings.Cut(strings.TrimPrefix(s, "-"), ".")
+	if len(frac) > 2 {
+		return fmt.Errorf("money: %s has fractions of a cent", s)
+	}
+	cents, err := strconv.ParseInt(whole+(frac + "00")[:2], 10, 64)
+	if err != nil {
+		return fmt.Errorf("money: %w", err)
+	}
+	if neg {
+		cents = -cents
+	}
+	*m = Money(cents)
+	return nil
+}
+
+// decodeAny decodes data into an any, with or without UseNumber
+func decodeAny(data string, useNumber bool) (any, error) {
+	dec := json.NewDecoder(strings.NewReader(data))
+	if useNumber {
+		dec.UseNumber()
+	}
+	var v any
+	err := dec.Decode(&v)
+	return v, err
+}
+
+// ============================================================
+// main
+// ============================================================
+
+func main() {
+	fmt.Println("=== 1. Custom MarshalJSON and UnmarshalJSON ===")
+
+	for _, in := range []string{
+		`{"attempts":5,"backoff":"1m30s"}`,
+		`{"backoff":2.5}`,
+		`{}`,
+		`{"attempts":0}`,
+		`{"backoff":"soon"}`,
+	} {
+		var p RetryPolicy
+		if err := json.Unmarshal([]byte(in), &p); err != nil {
+			fmt.Printf("  %-34s error: %v\n", in, err)
+			continue
+		}
+		out, _ := json.Marshal(p)
+		fmt.Printf("  %-34s -> %s\n", in, out)
+	}
+	fmt.Println("  Missing fields keep their defaults; backoff reads either form")
+	fmt.Println("  and is always written as a string; a zero paused is left out.")
+
+	fmt.Println()
+	for _, in := range []string{
+		`{"url":"https://example.com/hook","retry":{"atempts":5}}`,
+		`{"ulr":"https://example.com/hook","retry":{}}`,
+	} {
+		var ep Endpoint
+		fmt.Printf("  %s\n", in)
+		fmt.Printf("    decodeStrict:   %v\n", decodeStrict([]byte(in), &ep))
+		err := json.Unmarshal([]byte(in), &ep)
+		fmt.Printf("    json.Unmarshal: %v, url %q\n", err, ep.URL)
+	}
+	fmt.Println("  A typo inside retry is caught either way, because RetryPolicy is")
+	fmt.Println("  strict itself. One in Endpoint's own keys only under decodeStrict.")
+
+	fmt.Println()
+	fmt.Println("=== 2. Deferred decoding with json.RawMessage ===")
+
+	raw := `{"id":"evt_1","type":"payment.succeeded","created":1760000000,` +
+		`"data":{"payment_id":"pay_1","amount":19.99,"currency":"EUR"}}`
+	var env envelope
+	if err := json.Unmarshal([]byte(raw), &env); err != nil {
+		fmt.Println("  envelope:", err)
+		return
+	}
+	fmt.Printf("  pass 1: id=%s type=%s created=%s\n", env.ID, env.Type, env.Created.Format(time.RFC3339))
+	fmt.Printf("          data still raw: %s\n", env.Data)
+	var pay PaymentSucceeded
+	if err := json.Unmarshal(env.Data, &pay); err != nil {
+		fmt.Println("  data:", err)
+		return
+	}
+	fmt.Printf("  pass 2: %+v\n", pay)
+	fmt.Println("  A router can read pass 1 for every event, and pay for pass 2 only")
+	fmt.Println("  for the types it handles (BenchmarkDecode measures the saving).")
+
+	fmt.Println()
+	fmt.Println("=== 3. Polymorphic payloads ===")
+
+	feed := `[
+		{"id":"evt_1","type":"payment.succeeded","created":1760000000,"data":{"payment_id":"pay_1","amount":19.99,"currency":"EUR"}},
+		{"id":"evt_2","type":"refund.issued","created":1760000060,"data":{"refund_id":"re_1","payment_id":"pay_1","amount":5}},
+		{"id":"evt_3","type":"customer.created","created":1760000120,"data":{"customer_id":"9007199254740993","email":"ada@example.com"}},
+		{"id":"evt_4","type":"dispute.opened","created":1760000180,"data":{"dispute_id":"dp_1","evidence":{"due":1760600000}}}
+	]`
+	var events []Event
+	if err := json.Unmarshal([]byte(feed), &events); err != nil {
+		fmt.Println("  decode:", err)
+		return
+	}
+	for _, e := range events {
+		switch p := e.Payload.(type) {
+		case *PaymentSucceeded:
+			fmt.Printf("  %s payment %s of %s %s\n", e.ID, p.PaymentID, mustJSON(p.Amount), p.Currency)
+		case *RefundIssued:
+			fmt.Printf("  %s refund %s of %s against %s\n", e.ID, p.RefundID, mustJSON(p.Amount), p.PaymentID)
+		case *CustomerCreated:
+			fmt.Printf("  %s customer %d <%s>\n", e.ID, p.CustomerID, p.Email)
+		case *Unknown:
+			fmt.Printf("  %s unknown type %q, kept as %d raw bytes\n", e.ID, p.Kind, len(p.Raw))
+		}
+	}
+	out, _ := json.Marshal(events[3])
+	fmt.Printf("  re-encoded: %s\n", out)
+
+	var bad Event
+	err := json.Unmarshal([]byte(`{"id":"evt_5","type":"refund.issued","data":{"amount":"5"}}`), &bad)
+	fmt.Printf("  bad payload: %v\n", err)
+
+	fmt.Println()
+	fmt.Println("=== 4. Streaming with json.Decoder.Token ===")
+
+	// What Token sees: delimiters, keys and values, one at a time
+	dec := json.NewDecoder(strings.NewReader(`{"next":null,"events":[{"id":"evt_1"}],"count":1.0}`))
+	var toks []string
+	for {
+		tok, err := dec.Token()
+		if err != nil {
+			break // io.EOF
+		}
+		if s, ok := tok.(string); ok {
+			toks = append(toks, strconv.Quote(s))
+		} else {
+			toks = append(toks, fmt.Sprintf("%T(%v)", tok, tok))
+		}
+	}
+	fmt.Printf("  tokens: %s\n", strings.Join(toks, " "))
+	fmt.Println("  Decode in the middle of that turns the next value, here an event,")
+	fmt.Println("  into a struct; Token resumes after it.")
+
+	const n = 200_000
+	var page bytes.Buffer
+	writeFeed(&page, n)
+	fmt.Printf("\n  A page of %d events, %.1f MB:\n", n, float64(page.Len())/(1<<20))
+
+	base := liveHeap()
+	start := time.Now()
+	var whole struct {
+		Events []Event `json:"events"`
+	}
+	if err := json.Unmarshal(page.Bytes(), &whole); err != nil {
+		fmt.Println("  unmarshal:", err)
+		return
+	}
+	took := time.Since(start)
+	held := liveHeap() - base
+	fmt.Printf("  json.Unmarshal: %7v, %6.1f MB live afterwards, for %d events\n",
+		took.Round(time.Millisecond), float64(held)/(1<<20), len(whole.Events))
+	whole.Events = nil
+
+	// Here the reader is the same page, for a fair race. It could as well
+	// be a file or a response body, which is never in memory in full
+	base = liveHeap()
+	var total Money
+	start = time.Now()
+	count, err := streamEvents(bytes.NewReader(page.Bytes()), func(e Event) error {
+		if p, ok := e.Payload.(*PaymentSucceeded); ok {
+			total += p.Amount
+		}
+		return nil
+	})
+	took = time.Since(start)
+	if err != nil {
+		fmt.Println("  stream:", err)
+		return
+	}
+	// Sample the live heap on a second pass: a GC per sample would swamp
+	// the timing above
+	var peak uint64
+	i := 0
+	streamEvents(bytes.NewReader(page.Bytes()), func(Event) error {
+		if i++; i%20_000 == 0 {
+			if h := liveHeap(); h > base {
+				peak = max(peak, h-base)
+			}
+		}
+		return nil
+	})
+	fmt.Printf("  streamEvents:   %7v, %6.1f KB live at most,   for %d events\n",
+		took.Round(time.Millisecond), float64(peak)/(1<<10), count)
+	fmt.Printf("  (payments in the page: %s; the page itself is not counted)\n", mustJSON(total))
+
+	// A bad element is reported with its position in the stream
+	broken := `{"events":[{"id":"evt_1","type":"refund.issued","data":{}},{"id":"evt_2","type":}]}`
+	_, err = streamEvents(strings.NewReader(broken), func(Event) error { return nil })
+	fmt.Printf("  broken stream:  %v\n", err)
+
+	fmt.Println()
+	fmt.Println("=== 5. Numbers ===")
+
+	// Into any, every number becomes a float64: 53 bits of mantissa
+	const id = `{"id":9007199254740993,"price":1.10}`
+	v, _ := decodeAny(id, false)
+	f := v.(map[string]any)["id"].(float64)
+	fmt.Printf("  into any:        id %T %.0f -> int64 %d (off by one)\n", f, f, int64(f))
+	reenc, _ := json.Marshal(v)
+	fmt.Printf("                   re-encoded: %s\n", reenc)
+
+	v, _ = decodeAny(id, true)
+	num := v.(map[string]any)["id"].(json.Number)
+	exact, _ := num.Int64()
+	fmt.Printf("  UseNumber:       id %T %q -> int64 %d\n", num, num, exact)
+	reenc, _ = json.Marshal(v)
+	fmt.Printf("                   re-encoded: %s (the text, unchanged)\n", reenc)
+
+	// Into a typed field, integers are parsed as integers: no loss. The
+	// problem is any, map[string]any, and float64 fields
+	var typed struct {
+		ID int64 `json:"id"`
+	}
+	json.Unmarshal([]byte(id), &typed)
+	fmt.Printf("  into int64:      %d\n", typed.ID)
+
+	// JavaScript reads every number as a float64 too, so APIs send big
+	// IDs as strings. The ",string" option converts both ways
+	cust, _ := json.Marshal(CustomerCreated{CustomerID: 1 << 60, Email: "x@example.com"})
+	fmt.Printf("  \",string\":       %s\n", cust)
+	fmt.Printf("  largest exact float64 integer: %d\n", int64(1)<<53)
+
+	// Amounts: 0.29 has no exact float64, and truncating to cents loses one
+	var asFloat struct {
+		Amount float64 `json:"amount"`
+	}
+	var asMoney struct {
+		Amount Money `json:"amount"`
+	}
+	const amount = `{"amount":0.29}`
+	json.Unmarshal([]byte(amount), &asFloat)
+	json.Unmarshal([]byte(amount), &asMoney)
+	fmt.Printf("  0.29 as float64: %.17g -> int(x*100) = %d cents\n", asFloat.Amount, int(asFloat.Amount*100))
+	fmt.Printf("  0.29 as Money:   %d cents\n", asMoney.Amount)
+	fmt.Printf("  math.Round fixes this one, but not sums of many: 0.1+0.2 = %.17g\n", 0.1+0.2)
+	var m Money
+	fmt.Printf("  Money rejects 0.295: %v\n", json.Unmarshal([]byte("0.295"), &m))
+}
+
+// mustJSON marshals v for printing
+func mustJSON(v any) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "!" + err.Error()
+	}
+	return string(b)
+}
@@ -0,0 +1,370 @@
+// Testing JSON Codecs - Round trips, exact bytes and the error paths
+//
+// A custom codec is two functions that have to agree. The tests decode
+// what was encoded and compare, check the exact bytes where the wire
+// format is a contract, and feed in every kind of bad input the
+// decoders are meant to reject.
+//
+// Run tests:
+//   go test -v json.go json_test.go
+//   go test -run=^$ -bench=. -benchmem json.go json_test.go
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestDuration(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    time.Duration
+		wantErr bool
+	}{
+		{`"1m30s"`, 90 * time.Second, false},
+		{`"250ms"`, 250 * time.Millisecond, false},
+		{`2.5`, 2500 * time.Millisecond, false},
+		{`0`, 0, false},
+		{`"soon"`, 0, true},
+		{`true`, 0, true},
+	}
+	for _, tt := range tests {
+		var d Duration
+		err := json.Unmarshal([]byte(tt.in), &d)
+		if (err != nil) != tt.wantErr || time.Duration(d) != tt.want {
+			t.Errorf("Unmarshal(%s) = %v, %v; want %v, error %v", tt.in, time.Duration(d), err, tt.want, tt.wantErr)
+		}
+	}
+
+	d := Duration(time.Hour + time.Second)
+	if b, _ := json.Marshal(d); string(b) != `"1h0m1s"` {
+		t.Errorf("Marshal = %s", b)
+	}
+	if err := json.Unmarshal([]byte(`null`), &d); err != nil || time.Duration(d) != time.Hour+time.Second {
+		t.Errorf("null changed the value to %v (%v)", time.Duration(d), err)
+	}
+}
+
+func TestUnixTime(t *testing.T) {
+	in := UnixTime{time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)}
+	b, err := json.Marshal(in)
+	if err != nil || string(b) != "1792152000" {
+		t.Fatalf("Marshal = %s, %v", b, err)
+	}
+	var out UnixTime
+	if err := json.Unmarshal(b, &out); err != nil || !out.Equal(in.Time) {
+		t.Errorf("round trip = %v, %v", out, err)
+	}
+	if err := json.Unmarshal([]byte(`"2026-10-16T12:00:00Z"`), &out); err == nil {
+		t.Error("RFC 3339 string accepted; the wire format is seconds")
+	}
+}
+
+func TestRetryPolicy(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    RetryPolicy
+		wantErr string
+	}{
+		{`{}`, RetryPolicy{Attempts: 3, Backoff: Duration(time.Second)}, ""},
+		{`{"attempts":7}`, RetryPolicy{Attempts: 7, Backoff: Duration(time.Second)}, ""},
+		{`{"backoff":"5s"}`, RetryPolicy{Attempts: 3, Backoff: Duration(5 * time.Second)}, ""},
+		{`{"attempts":0}`, RetryPolicy{}, "attempts 0"},
+		{`{"attempts":11}`, RetryPolicy{}, "attempts 11"},
+		{`{"atempts":5}`, RetryPolicy{}, `unknown field "atempts"`},
+		{`{"backoff":[1]}`, RetryPolicy{}, "duration"},
+	}
+	for _, tt := range tests {
+		var p RetryPolicy
+		err := json.Unmarshal([]byte(tt.in), &p)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Unmarshal(%s) error = %v, want one mentioning %q", tt.in, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || p != tt.want {
+			t.Errorf("Unmarshal(%s) = %+v, %v; want %+v", tt.in, p, err, tt.want)
+		}
+	}
+}
+
+func TestOmitzero(t *testing.T) {
+	p := RetryPolicy{Attempts: 1, Backoff: Duration(time.Second)}
+	if b, _ := json.Marshal(p); strings.Contains(string(b), "paused") {
+		t.Errorf("zero Paused written: %s", b)
+	}
+	p.Paused = time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	if b, _ := json.Marshal(p); !strings.Contains(string(b), `"paused":"2026-01-01T00:00:00Z"`) {
+		t.Errorf("Paused missing: %s", b)
+	}
+}
+
+func TestDecodeStrict(t *testing.T) {
+	var ep Endpoint
+	if err := decodeStrict([]byte(`{"url":"https://x","retry":{}}`), &ep); err != nil || ep.URL != "https://x" {
+		t.Errorf("valid config: %+v, %v", ep, err)
+	}
+	for _, in := range []string{
+		`{"ulr":"https://x"}`,
+		`{"url":"https://x"} {"url":"https://y"}`,
+	} {
+		if err := decodeStrict([]byte(in), &ep); err == nil {
+			t.Errorf("decodeStrict(%s) accepted it", in)
+		}
+	}
+}
+
+func TestEventRoundTrip(t *testing.T) {
+	// Compact input, keys in the order MarshalJSON writes them: the bytes
+	// out must equal the bytes in, whatever the payload type
+	for _, in := range []string{
+		`{"id":"evt_1","type":"payment.succeeded","created":1760000000,"data":{"payment_id":"pay_1","amount":19.99,"currency":"EUR"}}`,
+		`{"id":"evt_2","type":"refund.issued","created":1760000060,"data":{"refund_id":"re_1","payment_id":"pay_1","amount":-0.05,"reason":"damaged"}}`,
+		`{"id":"evt_3","type":"customer.created","created":1760000120,"data":{"customer_id":"9007199254740993","email":"ada@example.com"}}`,
+		`{"id":"evt_4","type":"dispute.opened","created":1760000180,"data":{"z":1,"a":[true,null],"n":1.50}}`,
+	} {
+		var e Event
+		if err := json.Unmarshal([]byte(in), &e); err != nil {
+			t.Errorf("Unmarshal: %v\n%s", err, in)
+			continue
+		}
+		out, err := json.Marshal(e)
+		if err != nil || string(out) != in {
+			t.Errorf("round trip changed the event (%v):\n in: %s\nout: %s", err, in, out)
+		}
+	}
+}
+
+func TestEventPayloadTypes(t *testing.T) {
+	var events []Event
+	err := json.Unmarshal([]byte(`[
+		{"id":"a","type":"payment.succeeded","data":{"amount":1}},
+		{"id":"b","type":"refund.issued","data":{"amount":2}},
+		{"id":"c","type":"customer.created","data":{"customer_id":"3"}},
+		{"id":"d","type":"new.kind","data":{"x":4}}
+	]`), &events)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p, ok := events[0].Payload.(*PaymentSucceeded); !ok || p.Amount != 100 {
+		t.Errorf("a: %#v", events[0].Payload)
+	}
+	if p, ok := events[1].Payload.(*RefundIssued); !ok || p.Amount != 200 {
+		t.Errorf("b: %#v", events[1].Payload)
+	}
+	if p, ok := events[2].Payload.(*CustomerCreated); !ok || p.CustomerID != 3 {
+		t.Errorf("c: %#v", events[2].Payload)
+	}
+	if p, ok := events[3].Payload.(*Unknown); !ok || p.Type() != "new.kind" || string(p.Raw) != `{"x":4}` {
+		t.Errorf("d: %#v", events[3].Payload)
+	}
+}
+
+func TestEventErrors(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{`{"id":"e","data":{}}`, `event "e": no type`},
+		{`{"id":"e","type":"customer.created","data":{"customer_id":3}}`, `event "e": customer.created:`},
+		{`{"id":"e","type":"payment.succeeded","data":[]}`, `event "e": payment.succeeded:`},
+		{`{"id":"e","type":"payment.succeeded","created":"today"}`, "unix time"},
+	}
+	for _, tt := range tests {
+		var e Event
+		err := json.Unmarshal([]byte(tt.in), &e)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Unmarshal(%s) error = %v, want one containing %q", tt.in, err, tt.want)
+		}
+	}
+}
+
+func TestUnknownRawIsACopy(t *testing.T) {
+	in := []byte(`{"id":"e","type":"x","data":{"k":"v"}}`)
+	var e Event
+	if err := json.Unmarshal(in, &e); err != nil {
+		t.Fatal(err)
+	}
+	copy(in, bytes.Repeat([]byte("#"), len(in))) // reuse the buffer, as a reader would
+	if raw := string(e.Payload.(*Unknown).Raw); raw != `{"k":"v"}` {
+		t.Errorf("Raw changed with the input buffer: %s", raw)
+	}
+}
+
+func TestStreamEvents(t *testing.T) {
+	var page bytes.Buffer
+	if err := writeFeed(&page, 1000); err != nil {
+		t.Fatal(err)
+	}
+	var ids []string
+	n, err := streamEvents(&page, func(e Event) error {
+		ids = append(ids, e.ID)
+		return nil
+	})
+	if err != nil || n != 1000 || ids[0] != "evt_0" || ids[999] != "evt_999" {
+		t.Fatalf("streamed %d events, %v; first %q", n, err, ids[0])
+	}
+
+	// The events must agree with a plain Unmarshal of the same page
+	page.Reset()
+	writeFeed(&page, 30)
+	var whole struct {
+		Events []Event `json:"events"`
+	}
+	if err := json.Unmarshal(page.Bytes(), &whole); err != nil {
+		t.Fatal(err)
+	}
+	i := 0
+	streamEvents(bytes.NewReader(page.Bytes()), func(e Event) error {
+		a, _ := json.Marshal(e)
+		b, _ := json.Marshal(whole.Events[i])
+		if !bytes.Equal(a, b) {
+			t.Errorf("event %d: streamed %s, unmarshaled %s", i, a, b)
+		}
+		i++
+		return nil
+	})
+
+	errStop := errors.New("stop")
+	n, err = streamEvents(strings.NewReader(`{"events":[{"id":"a","type":"x"},{"id":"b","type":"x"}]}`),
+		func(Event) error { return errStop })
+	if n != 0 || !errors.Is(err, errStop) {
+		t.Errorf("callback error: %d, %v", n, err)
+	}
+}
+
+func TestStreamEventsErrors(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{`[]`, "want {"},
+		{`{"events":{}}`, "want ["},
+		{`{"events":[{"id":"a","type":"x"},{"id":"b"}]}`, `event 1, before byte`},
+		{`{"events":[{"id":"a","type":"x"}`, "end of JSON input"},
+		{`{"events":[]}`, ""},
+		{`{"next":{"deep":[1,2,{"x":null}]},"events":[],"count":0}`, ""},
+	}
+	for _, tt := range tests {
+		_, err := streamEvents(strings.NewReader(tt.in), func(Event) error { return nil })
+		if tt.want == "" {
+			if err != nil {
+				t.Errorf("streamEvents(%s) = %v", tt.in, err)
+			}
+		} else if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("streamEvents(%s) = %v, want an error containing %q", tt.in, err, tt.want)
+		}
+	}
+}
+
+func TestMoney(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Money
+		wantErr bool
+	}{
+		{`19.99`, 1999, false},
+		{`0.29`, 29, false},
+		{`5`, 500, false},
+		{`5.5`, 550, false},
+		{`-0.05`, -5, false},
+		{`0.295`, 0, true},
+		{`"5.00"`, 0, true},
+		{`1e2`, 0, true},
+		{`92233720368547758.08`, 0, true}, // overflows int64 cents
+	}
+	for _, tt := range tests {
+		var m Money
+		err := json.Unmarshal([]byte(tt.in), &m)
+		if (err != nil) != tt.wantErr || m != tt.want {
+			t.Errorf("Unmarshal(%s) = %d, %v; want %d, error %v", tt.in, m, err, tt.want, tt.wantErr)
+		}
+	}
+	for m, want := range map[Money]string{1999: "19.99", 5: "0.05", -150: "-1.50", 0: "0.00"} {
+		if b, _ := json.Marshal(m); string(b) != want {
+			t.Errorf("Marshal(%d) = %s, want %s", m, b, want)
+		}
+	}
+}
+
+func TestUseNumber(t *testing.T) {
+	const in = `{"id":9007199254740993}`
+	v, _ := decodeAny(in, false)
+	if f := v.(map[string]any)["id"].(float64); int64(f) == 9007199254740993 {
+		t.Error("float64 held 2^53+1 exactly; the precision demo is wrong")
+	}
+	v, _ = decodeAny(in, true)
+	n, err := v.(map[string]any)["id"].(json.Number).Int64()
+	if err != nil || n != 9007199254740993 {
+		t.Errorf("UseNumber: %d, %v", n, err)
+	}
+	if b, _ := json.Marshal(v); string(b) != in {
+		t.Errorf("re-encoded %s, want %s", b, in)
+	}
+}
+
+// ============================================================
+// Benchmarks
+// ============================================================
+
+// BenchmarkDecode is the saving from deferred decoding: a router that
+// reads only the envelope of each event, against decoding every
+// payload too
+func BenchmarkDecode(b *testing.B) {
+	var page bytes.Buffer
+	writeFeed(&page, 1000)
+	var raw struct {
+		Events []json.RawMessage `json:"events"`
+	}
+	json.Unmarshal(page.Bytes(), &raw)
+
+	b.Run("envelope", func(b *testing.B) {
+		for b.Loop() {
+			for _, r := range raw.Events {
+				var env envelope
+				if err := json.Unmarshal(r, &env); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+	b.Run("event", func(b *testing.B) {
+		for b.Loop() {
+			for _, r := range raw.Events {
+				var e Event
+				if err := json.Unmarshal(r, &e); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+}
+
+// BenchmarkPage is a whole page both ways. Streaming pays a little for
+// its Token calls. What it saves is live memory, which B/op doesn't
+// show: that counts what was allocated, not what was held at once.
+// The demo in main measures that
+func BenchmarkPage(b *testing.B) {
+	var page bytes.Buffer
+	writeFeed(&page, 1000)
+	b.Run("Unmarshal", func(b *testing.B) {
+		for b.Loop() {
+			var whole struct {
+				Events []Event `json:"events"`
+			}
+			if err := json.Unmarshal(page.Bytes(), &whole); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("streamEvents", func(b *testing.B) {
+		for b.Loop() {
+			if _, err := streamEvents(bytes.NewReader(page.Bytes()), func(Event) error { return nil }); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,715 @@
+// Reflection in Go - Inspecting and changing values whose type is only known at run time
+//
+// The reflect package is how encoding/json, fmt and text/template work
+// on types they have never seen. A reflect.Type describes a type: its
+// kind, fields, tags and methods. A reflect.Value holds a value of
+// that type and can read it, and sometimes set it.
+//
+// This example demonstrates:
+// - Walking struct fields: names, types, kinds, tags with options,
+//   embedded structs and unexported fields
+// - A pretty-printer for any value, including unexported fields,
+//   maps in key order, redacted secrets and pointer cycles
+// - A struct-to-map converter driven by `map:"name,omitempty"` tags,
+//   and its inverse, which needs reflect's rules for setting values
+// - Settability: which Values can be set, and why the rest can't
+// - The cost: reflection against the code a generator would write,
+//   and the per-type cache that makes reflection affordable
+//
+// The generated code is in this file, between the BEGIN and END
+// GENERATED markers. reflection_test.go fails if it is stale.
+//
+// Usage:
+//   go run reflection.go
+//   go run reflection.go -gen   # print the generated ToMap code for User
+//
+// Run tests:
+//   go test -v reflection.go reflection_test.go
+//   go test -run=^$ -bench=. -benchmem reflection.go reflection_test.go
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"go/format"
+	"io"
+	"os"
+	"reflect"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// ============================================================
+// The types everything below works on
+// ============================================================
+
+// Audit is embedded in User, so its fields are promoted: user.Version
+type Audit struct {
+	CreatedBy string `map:"created_by"`
+	Version   int    `map:"version"`
+}
+
+type Address struct {
+	Street string `map:"street"`
+	City   string `map:"city"`
+	Zip    string `map:"zip,omitempty"`
+}
+
+// User has a field of most kinds the converter handles, and two it
+// must leave alone: Password, tagged out, and logins, unexported
+type User struct {
+	Audit
+	ID       int64    `map:"id"`
+	Name     string   `map:"name"`
+	Email    string   `map:"email,omitempty"`
+	Admin    bool     `map:"admin,omitempty"`
+	Score    float64  `map:"score"`
+	Tags     []string `map:"tags,omitempty"`
+	Address  Address  `map:"address"`
+	Billing  *Address `map:"billing,omitempty"`
+	Password string   `map:"-" pretty:"secret"`
+	logins   int
+}
+
+// ============================================================
+// 1. Walking struct fields and tags
+// ============================================================
+
+// tagOptions splits a tag value like "email,omitempty" into the name
+// and the options, the convention encoding/json set for everyone
+func tagOptions(tag string) (name string, opts []string) {
+	name, rest, _ := strings.Cut(tag, ",")
+	if rest != "" {
+		opts = strings.Split(rest, ",")
+	}
+	return name, opts
+}
+
+// describeFields writes one line per field of struct type t, and of
+// the structs embedded in it
+func describeFields(w io.Writer, t reflect.Type) {
+	fmt.Fprintf(w, "  %-16s %-13s %-7s %-8s %-18s %s\n", "field", "type", "kind", "exported", "map tag", "index")
+	for _, f := range reflect.VisibleFields(t) {
+		tag, ok := f.Tag.Lookup("map")
+		switch {
+		case !ok:
+			tag = "(none)"
+		case tag == "":
+			tag = `(empty)`
+		}
+		name := f.Name
+		if f.Anonymous {
+			name += " (embedded)"
+		} else if len(f.Index) > 1 {
+			name = "  ." + name // promoted from an embedded struct
+		}
+		fmt.Fprintf(w, "  %-16s %-13s %-7s %-8v %-18s %v\n", name, f.Type, f.Type.Kind(), f.IsExported(), tag, f.Index)
+	}
+}
+
+// ============================================================
+// 2. A pretty-printer for any value
+// ============================================================
+
+var stringerType = reflect.TypeFor[fmt.Stringer]()
+
+// Pretty formats v with one field or element per line. It shows
+// unexported fields, prints maps in key order, replaces fields tagged
+// `pretty:"secret"` with ***, skips `pretty:"-"`, and marks a pointer
+// it is already inside as a cycle instead of following it forever
+func Pretty(v any) string {
+	p := printer{inside: map[uintptr]bool{}}
+	p.value(reflect.ValueOf(v), 0)
+	return p.b.String()
+}
+
+type printer struct {
+	b      strings.Builder
+	inside map[uintptr]bool // pointers on the path from the root
+}
+
+func (p *printer) indent(depth int) {
+	p.b.WriteString(strings.Repeat("  ", depth))
+}
+
+func (p *printer) value(v reflect.Value, depth int) {
+	// A Value read from an unexported field can't be turned back into
+	// an interface, so its String method can't be called. The kind
+	// getters below (v.Int, v.String, ...) still work on it
+	if v.IsValid() && v.CanInterface() && v.Type().Implements(stringerType) &&
+		(v.Kind() != reflect.Pointer || !v.IsNil()) {
+		p.b.WriteString(v.Interface().(fmt.Stringer).String())
+		return
+	}
+
+	switch v.Kind() {
+	case reflect.Invalid:
+		p.b.WriteString("nil")
+	case reflect.Pointer:
+		if v.IsNil() {
+			p.b.WriteString("nil")
+			return
+		}
+		if p.inside[v.Pointer()] {
+			fmt.Fprintf(&p.b, "&<cycle to %s>", v.Type().Elem())
+			return
+		}
+		p.inside[v.Pointer()] = true
+		p.b.WriteString("&")
+		p.value(v.Elem(), depth)
+		delete(p.inside, v.Pointer())
+	case reflect.Interface:
+		p.value(v.Elem(), depth) // Elem of a nil interface is Invalid: "nil"
+	case reflect.Struct:
+		p.b.WriteString(v.Type().String() + "{\n")
+		for i := range v.NumField() {
+			f := v.Type().Field(i)
+			tag := f.Tag.Get("pretty")
+			if tag == "-" {
+				continue
+			}
+			p.indent(depth + 1)
+			p.b.WriteString(f.Name + ": ")
+			if tag == "secret" && !v.Field(i).IsZero() {
+				p.b.WriteString("***")
+			} else {
+				p.value(v.Field(i), depth+1)
+			}
+			p.b.WriteString(",\n")
+		}
+		p.indent(depth)
+		p.b.WriteString("}")
+	case reflect.Map:
+		if v.IsNil() {
+			p.b.WriteString("nil")
+			return
+		}
+		// Range order is random; sort by how each key prints
+		type entry struct {
+			key string
+			val reflect.Value
+		}
+		var entries []entry
+		for it := v.MapRange(); it.Next(); {
+			sub := printer{inside: p.inside}
+			sub.value(it.Key(), 0)
+			entries = append(entries, entry{sub.b.String(), it.Value()})
+		}
+		slices.SortFunc(entries, func(a, b entry) int { return strings.Compare(a.key, b.key) })
+		p.b.WriteString(v.Type().String() + "{\n")
+		for _, e := range entries {
+			p.indent(depth + 1)
+			p.b.WriteString(e.key + ": ")
+			p.value(e.val, depth+1)
+			p.b.WriteString(",\n")
+		}
+		p.indent(depth)
+		p.b.WriteString("}")
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			p.b.WriteString("nil")
+			return
+		}
+		if v.Len() == 0 {
+			p.b.WriteString(v.Type().String() + "{}")
+			return
+		}
+		p.b.WriteString(v.Type().String() + "{\n")
+		for i := range v.Len() {
+			p.indent(depth + 1)
+			p.value(v.Index(i), depth+1)
+			p.b.WriteString(",\n")
+		}
+		p.indent(depth)
+		p.b.WriteString("}")
+	case reflect.String:
+		p.b.WriteString(strconv.Quote(v.String()))
+	case reflect.Bool:
+		p.b.WriteString(strconv.FormatBool(v.Bool()))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		p.b.WriteString(strconv.FormatInt(v.Int(), 10))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		p.b.WriteString(strconv.FormatUint(v.Uint(), 10))
+	case reflect.Float32, reflect.Float64:
+		p.b.WriteString(strconv.FormatFloat(v.Float(), 'g', -1, v.Type().Bits()))
+	case reflect.Complex64, reflect.Complex128:
+		p.b.WriteString(strconv.FormatComplex(v.Complex(), 'g', -1, v.Type().Bits()))
+	default: // chan, func, unsafe.Pointer: nothing readable inside
+		fmt.Fprintf(&p.b, "%s(%#x)", v.Type(), v.Pointer())
+	}
+}
+
+// ============================================================
+// 3. Struct to map, and back
+// ============================================================
+
+// field is one entry in a struct's conversion plan: everything about
+// the field that can be worked out from its type alone
+type field struct {
+	index     []int // for Value.FieldByIndex; longer than 1 if promoted
+	name      string
+	omitEmpty bool
+	nested    bool // a struct or *struct, converted to a map of its own
+}
+
+// planFor works out the conversion plan for struct type t. Embedded
+// structs without a tag are flattened: their fields are listed under
+// their own names, as promoted fields
+func planFor(t reflect.Type) []field {
+	var plan []field
+	for _, f := range reflect.VisibleFields(t) {
+		tag, tagged := f.Tag.Lookup("map")
+		if !f.IsExported() || tag == "-" {
+			continue
+		}
+		if f.Anonymous && !tagged && f.Type.Kind() == reflect.Struct {
+			continue // its fields come next in VisibleFields
+		}
+		name, opts := tagOptions(tag)
+		if name == "" {
+			name = f.Name
+		}
+		ft := f.Type
+		if ft.Kind() == reflect.Pointer {
+			ft = ft.Elem()
+		}
+		plan = append(plan, field{
+			index:     f.Index,
+			name:      name,
+			omitEmpty: slices.Contains(opts, "omitempty"),
+			nested:    ft.Kind() == reflect.Struct,
+		})
+	}
+	return plan
+}
+
+// plans caches planFor by type. The tags of a type never change, so
+// this is parsed once per type, not once per call; encoding/json keeps
+// a cache like it
+var plans sync.Map // reflect.Type -> []field
+
+func cachedPlan(t reflect.Type) []field {
+	if p, ok := plans.Load(t); ok {
+		return p.([]field)
+	}
+	p, _ := plans.LoadOrStore(t, planFor(t))
+	return p.([]field)
+}
+
+// ErrNotStruct is returned for a value that isn't a struct or a
+// pointer to one
+var ErrNotStruct = errors.New("not a struct")
+
+// ToMap converts a struct, or a pointer to one, to a map keyed by the
+// `map` tag names. Nested structs become nested maps. omitempty leaves
+// out zero strings, numbers and bools, nil pointers, and empty slices
+// and maps; a struct is never left out, as with encoding/json
+func ToMap(v any) (map[string]any, error) {
+	return toMap(reflect.ValueOf(v), cachedPlan)
+}
+
+func toMap(v reflect.Value, plan func(reflect.Type) []field) (map[string]any, error) {
+	if v.Kind() == reflect.Pointer && !v.IsNil() {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return nil, fmt.Errorf("ToMap %s: %w", v.Type(), ErrNotStruct)
+	}
+	fields := plan(v.Type())
+	m := make(map[string]any, len(fields))
+	for _, f := range fields {
+		fv := v.FieldByIndex(f.index)
+		if f.omitEmpty && isEmpty(fv) {
+			continue
+		}
+		switch {
+		case f.nested && fv.Kind() == reflect.Pointer && fv.IsNil():
+			m[f.name] = nil // an untyped nil, not a (*Address)(nil)
+		case f.nested:
+			sub, err := toMap(fv, plan)
+			if err != nil {
+				return nil, err
+			}
+			m[f.name] = sub
+		default:
+			m[f.name] = fv.Interface()
+		}
+	}
+	return m, nil
+}
+
+func isEmpty(v reflect.Value) bool {
+	switch v.Kind() {
+	case reflect.Slice, reflect.Map, reflect.String:
+		return v.Len() == 0
+	case reflect.Pointer, reflect.Interface:
+		return v.IsNil()
+	case reflect.Struct:
+		return false
+	default:
+		return v.IsZero()
+	}
+}
+
+// FromMap sets the fields of the struct dst points to from m, the
+// inverse of ToMap. A value that isn't the field's type is converted
+// if it is a number going into a number field and fits, the way a
+// float64 from JSON has to go into an int64. Keys with no field are
+// ignored
+func FromMap(m map[string]any, dst any) error {
+	v := reflect.ValueOf(dst)
+	// Only through a pointer can the fields be set: ValueOf(struct)
+	// holds a copy, and setting the copy would change nothing
+	if v.Kind() != reflect.Pointer || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("FromMap into %T: want a non-nil pointer to a struct", dst)
+	}
+	return fromMap(m, v.Elem())
+}
+
+func fromMap(m map[string]any, v reflect.Value) error {
+	for _, f := range cachedPlan(v.Type()) {
+		val, ok := m[f.name]
+		if !ok {
+			continue
+		}
+		fv := v.FieldByIndex(f.index) // settable: v is, and the field is exported
+		if val == nil {
+			fv.SetZero()
+			continue
+		}
+		if f.nested {
+			sub, ok := val.(map[string]any)
+			if !ok {
+				return fmt.Errorf("%s: want a map, got %T", f.name, val)
+			}
+			if fv.Kind() == reflect.Pointer {
+				fv.Set(reflect.New(fv.Type().Elem()))
+				fv = fv.Elem()
+			}
+			if err := fromMap(sub, fv); err != nil {
+				return fmt.Errorf("%s.%w", f.name, err)
+			}
+			continue
+		}
+		if err := setValue(fv, reflect.ValueOf(val)); err != nil {
+			return fmt.Errorf("%s: %w", f.name, err)
+		}
+	}
+	return nil
+}
+
+// setValue sets dst to src, converting between numeric kinds when the
+// value survives the trip
+func setValue(dst, src reflect.Value) error {
+	if src.Type().AssignableTo(dst.Type()) {
+		dst.Set(src)
+		return nil
+	}
+	if !isNumber(src.Kind()) || !isNumber(dst.Kind()) {
+		return fmt.Errorf("can't set %s from %s", dst.Type(), src.Type())
+	}
+	conv := src.Convert(dst.Type())
+	if back := conv.Convert(src.Type()); !back.Equal(src) {
+		return fmt.Errorf("%v doesn't fit in %s", src, dst.Type())
+	}
+	dst.Set(conv)
+	return nil
+}
+
+func isNumber(k reflect.Kind) bool {
+	return reflect.Int <= k && k <= reflect.Float64
+}
+
+// ============================================================
+// 4. Settability
+// ============================================================
+
+// settability tries to set a series of Values and reports what
+// happened to each
+func settability(w io.Writer) {
+	try := func(what string, v reflect.Value, set func(reflect.Value)) {
+		result := "ok"
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					result = fmt.Sprint("panic: ", r)
+				}
+			}()
+			set(v)
+		}()
+		fmt.Fprintf(w, "  %-30s CanAddr %-5v CanSet %-5v %s\n", what, v.CanAddr(), v.CanSet(), result)
+	}
+	setInt := func(v reflect.Value) { v.SetInt(42) }
+
+	n := 1
+	try("ValueOf(n)", reflect.ValueOf(n), setInt)
+	try("ValueOf(&n).Elem()", reflect.ValueOf(&n).Elem(), setInt)
+	fmt.Fprintf(w, "  %-30s n is now %d\n", "", n)
+
+	u := User{}
+	try("ValueOf(u).Field(ID)", reflect.ValueOf(u).FieldByName("ID"), setInt)
+	try("ValueOf(&u).Elem().Field(ID)", reflect.ValueOf(&u).Elem().FieldByName("ID"), setInt)
+	try("... .Field(logins)", reflect.ValueOf(&u).Elem().FieldByName("logins"), setInt)
+
+	// A copy of a slice shares its array, so its elements are the
+	// caller's too, and addressable
+	s := []int{1, 2}
+	try("ValueOf(s).Index(0)", reflect.ValueOf(s).Index(0), setInt)
+	fmt.Fprintf(w, "  %-30s s is now %v\n", "", s)
+
+	m := map[string]int{"a": 1}
+	try("ValueOf(m).MapIndex(a)", reflect.ValueOf(m).MapIndex(reflect.ValueOf("a")), setInt)
+	reflect.ValueOf(m).SetMapIndex(reflect.ValueOf("a"), reflect.ValueOf(42))
+	fmt.Fprintf(w, "  %-30s SetMapIndex instead: m is now %v\n", "", m)
+
+	var i any = 1
+	try("ValueOf(&i).Elem().Elem()", reflect.ValueOf(&i).Elem().Elem(), setInt)
+}
+
+// ============================================================
+// 5. The generated alternative
+// ============================================================
+
+// genToMap writes what a code generator would for ToMap on struct type
+// t, and on the structs it contains: straight-line code with the
+// field names, tags and omitempty checks worked out in advance. It
+// reads the same plan ToMap does, so the two can't disagree
+func genToMap(t reflect.Type) ([]byte, error) {
+	var b strings.Builder
+	done := map[reflect.Type]bool{}
+	var gen func(t reflect.Type)
+	gen = func(t reflect.Type) {
+		done[t] = true
+		var nested []reflect.Type
+		fmt.Fprintf(&b, "\n// %s is ToMap for %s, without reflection\n", genName(t), t.Name())
+		fmt.Fprintf(&b, "func %s(v *%s) map[string]any {\n", genName(t), t.Name())
+		plan := planFor(t)
+		fmt.Fprintf(&b, "m := make(map[string]any, %d)\n", len(plan))
+		for _, f := range plan {
+			sf := t.FieldByIndex(f.index)
+			expr := "v." + sf.Name
+			name := strconv.Quote(f.name)
+			switch {
+			case f.nested && sf.Type.Kind() == reflect.Pointer:
+				nested = append(nested, sf.Type.Elem())
+				fmt.Fprintf(&b, "if %s != nil {\nm[%s] = %s(%s)\n}", expr, name, genName(sf.Type.Elem()), expr)
+				if !f.omitEmpty {
+					fmt.Fprintf(&b, " else {\nm[%s] = nil\n}", name)
+				}
+				b.WriteString("\n")
+			case f.nested:
+				nested = append(nested, sf.Type)
+				fmt.Fprintf(&b, "m[%s] = %s(&%s)\n", name, genName(sf.Type), expr)
+			case f.omitEmpty:
+				fmt.Fprintf(&b, "if %s {\nm[%s] = %s\n}\n", notEmpty(expr, sf.Type.Kind()), name, expr)
+			default:
+				fmt.Fprintf(&b, "m[%s] = %s\n", name, expr)
+			}
+		}
+		b.WriteString("return m\n}\n")
+		for _, n := range nested {
+			if !done[n] {
+				gen(n)
+			}
+		}
+	}
+	gen(t)
+	return format.Source([]byte(b.String()))
+}
+
+// genName is the generated function's name: userToMap for User
+func genName(t reflect.Type) string {
+	r := []rune(t.Name())
+	r[0] = unicode.ToLower(r[0])
+	return string(r) + "ToMap"
+}
+
+// notEmpty is the Go expression that is true when expr, of kind k, is
+// not empty: the generated form of !isEmpty
+func notEmpty(expr string, k reflect.Kind) string {
+	switch k {
+	case reflect.Slice, reflect.Map, reflect.String:
+		return "len(" + expr + ") > 0"
+	case reflect.Pointer, reflect.Interface:
+		return expr + " != nil"
+	case reflect.Bool:
+		return expr
+	default:
+		return expr + " != 0"
+	}
+}
+
+// BEGIN GENERATED by go run reflection.go -gen
+
+// userToMap is ToMap for User, without reflection
+func userToMap(v *User) map[string]any {
+	m := make(map[string]any, 10)
+	m["created_by"] = v.CreatedBy
+	m["version"] = v.Version
+	m["id"] = v.ID
+	m["name"] = v.Name
+	if len(v.Email) > 0 {
+		m["email"] = v.Email
+	}
+	if v.Admin {
+		m["admin"] = v.Admin
+	}
+	m["score"] = v.Score
+	if len(v.Tags) > 0 {
+		m["tags"] = v.Tags
+	}
+	m["address"] = addressToMap(&v.Address)
+	if v.Billing != nil {
+		m["billing"] = addressToMap(v.Billing)
+	}
+	return m
+}
+
+// addressToMap is ToMap for Address, without reflection
+func addressToMap(v *Address) map[string]any {
+	m := make(map[string]any, 3)
+	m["street"] = v.Street
+	m["city"] = v.City
+	if len(v.Zip) > 0 {
+		m["zip"] = v.Zip
+	}
+	return m
+}
+
+// END GENERATED
+
+// ============================================================
+// main
+// ============================================================
+
+func sampleUser() User {
+	return User{
+		Audit:    Audit{CreatedBy: "signup", Version: 3},
+		ID:       1001,
+		Name:     "Ada",
+		Email:    "ada@example.com",
+		Score:    97.5,
+		Tags:     []string{"beta", "staff"},
+		Address:  Address{Street: "12 Analytical Way", City: "London"},
+		Password: "hunter2",
+		logins:   7,
+	}
+}
+
+// node makes a cycle for the pretty-printer to notice
+type node struct {
+	Name string
+	Next *node
+}
+
+func main() {
+	gen := flag.Bool("gen", false, "print the generated ToMap code for User and exit")
+	flag.Parse()
+	if *gen {
+		src, err := genToMap(reflect.TypeFor[User]())
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		os.Stdout.Write(src)
+		return
+	}
+
+	fmt.Println("=== 1. Walking struct fields and tags ===")
+
+	t := reflect.TypeFor[User]()
+	fmt.Printf("Type %s: kind %s, %d fields declared, %d visible\n",
+		t, t.Kind(), t.NumField(), len(reflect.VisibleFields(t)))
+	describeFields(os.Stdout, t)
+	pw, _ := t.FieldByName("Password")
+	fmt.Printf("Password's whole tag: %s\n", pw.Tag)
+	fmt.Printf("  Tag.Get(\"pretty\") = %q, Tag.Get(\"json\") = %q\n", pw.Tag.Get("pretty"), pw.Tag.Get("json"))
+	_, ok := pw.Tag.Lookup("json")
+	fmt.Printf("  Lookup tells absent from empty: json present = %v\n", ok)
+
+	fmt.Println()
+	fmt.Println("=== 2. A pretty-printer for any value ===")
+
+	u := sampleUser()
+	fmt.Println(Pretty(u))
+
+	ring := &node{Name: "a"}
+	ring.Next = &node{Name: "b", Next: ring}
+	fmt.Println(Pretty(map[string]any{
+		"ring":     ring,
+		"counts":   map[int]bool{3: true, 1: false, 2: true},
+		"timeout":  3 * time.Second, // a Stringer
+		"nothing":  nil,
+		"empty":    []int{},
+		"matrix":   [2][2]int{{1, 2}, {3, 4}},
+		"callback": (func())(nil),
+	}))
+
+	fmt.Println()
+	fmt.Println("=== 3. Struct to map, and back ===")
+
+	m, err := ToMap(&u)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(Pretty(m))
+	fmt.Println("email and tags are there and admin isn't: omitempty. No password:")
+	fmt.Println(`map:"-". No logins: unexported. Audit's fields are flattened in.`)
+	_, err = ToMap(42)
+	fmt.Printf("ToMap(42): %v\n", err)
+
+	// Values the way a JSON decoder hands them over: every number a
+	// float64
+	in := map[string]any{
+		"id": float64(2002), "name": "Grace", "version": float64(1),
+		"address": map[string]any{"city": "Arlington"},
+		"billing": map[string]any{"street": "1 Navy Yard", "city": "Washington"},
+		"unknown": "ignored",
+	}
+	var back User
+	if err := FromMap(in, &back); err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Printf("FromMap: id %d, name %s, version %d, city %s, billing %s\n",
+		back.ID, back.Name, back.Version, back.Address.City, back.Billing.Street)
+	fmt.Printf("FromMap id 2.5:      %v\n", FromMap(map[string]any{"id": 2.5}, &back))
+	fmt.Printf("FromMap name 7:      %v\n", FromMap(map[string]any{"name": 7}, &back))
+	fmt.Printf("FromMap into User{}: %v\n", FromMap(in, back))
+
+	fmt.Println()
+	fmt.Println("=== 4. Settability ===")
+
+	// A Value can be set only if it is addressable - it refers to a
+	// variable, not a copy - and wasn't reached through an unexported
+	// field. ValueOf(x) is always a copy; ValueOf(&x).Elem() is x
+	settability(os.Stdout)
+
+	fmt.Println()
+	fmt.Println("=== 5. The cost, against generated code ===")
+
+	const n = 200_000
+	run := func(name string, f func()) {
+		start := time.Now()
+		for range n {
+			f()
+		}
+		fmt.Printf("  %-22s %6.0f ns/op\n", name, float64(time.Since(start).Nanoseconds())/n)
+	}
+	v := reflect.ValueOf(&u)
+	run("ToMap, plan per call", func() { toMap(v, planFor) })
+	run("ToMap, cached plan", func() { ToMap(&u) })
+	run("generated userToMap", func() { userToMap(&u) })
+	fmt.Println("  Reading the tags on every call is the expensive part; a cache")
+	fmt.Println("  per type removes most of it. What's left is reflect's own work")
+	fmt.Println("  per field and an allocation per value boxed by Interface().")
+	fmt.Println("  The generated code knows the fields at compile time, but the")
+	fmt.Println("  boxing into map[string]any it can't avoid.")
+	fmt.Println("  go test -bench=. -benchmem reflection.go reflection_test.go")
+}
@@ -0,0 +1,264 @@
+// Testing Reflection - Hold the reflective code to the generated code
+//
+// Reflection fails at run time, on types the author didn't try. The
+// tests run ToMap over users with every optional field set and unset
+// and compare it with the generated userToMap, which the compiler has
+// checked. TestGeneratedIsCurrent keeps that generated code honest.
+//
+// Run tests:
+//   go test -v reflection.go reflection_test.go
+//   go test -run=^$ -bench=. -benchmem reflection.go reflection_test.go
+package main
+
+import (
+	"errors"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestTagOptions(t *testing.T) {
+	tests := []struct {
+		tag      string
+		wantName string
+		wantOpts []string
+	}{
+		{"id", "id", nil},
+		{"email,omitempty", "email", []string{"omitempty"}},
+		{",omitempty", "", []string{"omitempty"}},
+		{"a,b,c", "a", []string{"b", "c"}},
+		{"", "", nil},
+	}
+	for _, tt := range tests {
+		name, opts := tagOptions(tt.tag)
+		if name != tt.wantName || !slices.Equal(opts, tt.wantOpts) {
+			t.Errorf("tagOptions(%q) = %q, %q; want %q, %q", tt.tag, name, opts, tt.wantName, tt.wantOpts)
+		}
+	}
+}
+
+func TestPretty(t *testing.T) {
+	u := sampleUser()
+	got := Pretty(u)
+	for _, want := range []string{
+		"  logins: 7,\n",               // unexported, read without Interface()
+		"  Password: ***,\n",           // redacted
+		"    CreatedBy: \"signup\",\n", // embedded struct, indented
+		"  Billing: nil,\n",
+	} {
+		if !strings.Contains(got, want) {
+			t.Errorf("Pretty(user) lacks %q:\n%s", want, got)
+		}
+	}
+	if strings.Contains(got, "hunter2") {
+		t.Error("Pretty(user) printed the password")
+	}
+
+	ring := &node{Name: "a"}
+	ring.Next = &node{Name: "b", Next: ring}
+	if got := Pretty(ring); !strings.Contains(got, "Next: &<cycle to main.node>") {
+		t.Errorf("Pretty(ring):\n%s", got)
+	}
+
+	// The same pointer twice, side by side, is not a cycle
+	shared := &node{Name: "s"}
+	if got := Pretty([]*node{shared, shared}); strings.Contains(got, "cycle") {
+		t.Errorf("Pretty(shared pointers) saw a cycle:\n%s", got)
+	}
+
+	if got := Pretty(map[string]int{"b": 2, "a": 1, "c": 3}); got != "map[string]int{\n  \"a\": 1,\n  \"b\": 2,\n  \"c\": 3,\n}" {
+		t.Errorf("Pretty(map) not in key order:\n%s", got)
+	}
+	for v, want := range map[any]string{nil: "nil", 1.5: "1.5", "x": `"x"`} {
+		if got := Pretty(v); got != want {
+			t.Errorf("Pretty(%#v) = %s, want %s", v, got, want)
+		}
+	}
+}
+
+// users covers every optional field both set and unset
+func users() []User {
+	full := sampleUser()
+	full.Admin = true
+	full.Billing = &Address{Street: "1 Billing Rd", City: "Leeds", Zip: "LS1"}
+	return []User{{}, sampleUser(), full}
+}
+
+func TestToMapMatchesGenerated(t *testing.T) {
+	for _, u := range users() {
+		got, err := ToMap(&u)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := userToMap(&u); !reflect.DeepEqual(got, want) {
+			t.Errorf("ToMap(%+v):\n got  %v\n want %v", u, got, want)
+		}
+		byValue, _ := ToMap(u)
+		if !reflect.DeepEqual(byValue, got) {
+			t.Errorf("ToMap(User) and ToMap(*User) differ")
+		}
+	}
+}
+
+func TestToMapNotStruct(t *testing.T) {
+	for _, v := range []any{42, "s", []User{}, (*User)(nil)} {
+		if _, err := ToMap(v); !errors.Is(err, ErrNotStruct) {
+			t.Errorf("ToMap(%#v) = %v, want ErrNotStruct", v, err)
+		}
+	}
+}
+
+func TestGeneratedIsCurrent(t *testing.T) {
+	src, err := os.ReadFile("reflection.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	const begin, end = "// BEGIN GENERATED by go run reflection.go -gen\n", "// END GENERATED"
+	_, rest, ok1 := strings.Cut(string(src), begin)
+	committed, _, ok2 := strings.Cut(rest, end)
+	if !ok1 || !ok2 {
+		t.Fatal("GENERATED markers not found in reflection.go")
+	}
+	want, err := genToMap(reflect.TypeFor[User]())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.TrimSpace(committed) != strings.TrimSpace(string(want)) {
+		t.Errorf("generated code is stale; replace it with the output of go run reflection.go -gen:\n%s", want)
+	}
+}
+
+func TestFromMapRoundTrip(t *testing.T) {
+	for _, u := range users() {
+		m, _ := ToMap(&u)
+		var back User
+		if err := FromMap(m, &back); err != nil {
+			t.Fatalf("FromMap(%v): %v", m, err)
+		}
+		// What ToMap leaves out can't come back
+		u.Password, u.logins = "", 0
+		if !reflect.DeepEqual(back, u) {
+			t.Errorf("round trip:\n got  %+v\n want %+v", back, u)
+		}
+	}
+}
+
+func TestFromMap(t *testing.T) {
+	var u User
+	err := FromMap(map[string]any{
+		"id":      float64(7), // a JSON number, converted
+		"version": int8(2),    // any integer kind
+		"score":   3,          // int into float64
+		"tags":    []string{"x"},
+		"billing": map[string]any{"city": "York"},
+		"logins":  5, // no such key in the plan: ignored
+	}, &u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if u.ID != 7 || u.Version != 2 || u.Score != 3 || u.Tags[0] != "x" || u.Billing.City != "York" || u.logins != 0 {
+		t.Errorf("FromMap = %+v", u)
+	}
+	if err := FromMap(map[string]any{"billing": nil}, &u); err != nil || u.Billing != nil {
+		t.Errorf("billing: nil left %v (%v)", u.Billing, err)
+	}
+}
+
+func TestFromMapErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		m    map[string]any
+		dst  any
+		want string
+	}{
+		{"fraction into int", map[string]any{"id": 1.5}, &User{}, "id: 1.5 doesn't fit in int64"},
+		{"too big", map[string]any{"id": 1e19}, &User{}, "doesn't fit"},
+		{"wrong type", map[string]any{"name": 1}, &User{}, "name: can't set string from int"},
+		{"nested wrong", map[string]any{"address": "London"}, &User{}, "address: want a map"},
+		{"nested field", map[string]any{"address": map[string]any{"city": 1}}, &User{}, "address.city:"},
+		{"not a pointer", map[string]any{}, User{}, "want a non-nil pointer"},
+		{"nil pointer", map[string]any{}, (*User)(nil), "want a non-nil pointer"},
+		{"not a struct", map[string]any{}, new(int), "want a non-nil pointer to a struct"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := FromMap(tt.m, tt.dst)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("FromMap = %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestPlanIsCached(t *testing.T) {
+	typ := reflect.TypeFor[User]()
+	a, b := cachedPlan(typ), cachedPlan(typ)
+	if &a[0] != &b[0] {
+		t.Error("cachedPlan built the plan twice")
+	}
+	if !reflect.DeepEqual(a, planFor(typ)) {
+		t.Error("cached plan differs from a fresh one")
+	}
+}
+
+// ============================================================
+// Benchmarks
+// ============================================================
+
+var sinkMap map[string]any
+
+// BenchmarkToMap is reflection against generated code, for the same
+// result. plan-per-call reads the tags every time, as naive reflective
+// code does; cached is ToMap; generated is userToMap
+func BenchmarkToMap(b *testing.B) {
+	u := users()[2]
+	v := reflect.ValueOf(&u)
+	b.Run("plan-per-call", func(b *testing.B) {
+		for b.Loop() {
+			sinkMap, _ = toMap(v, planFor)
+		}
+	})
+	b.Run("cached", func(b *testing.B) {
+		for b.Loop() {
+			sinkMap, _ = ToMap(&u)
+		}
+	})
+	b.Run("generated", func(b *testing.B) {
+		for b.Loop() {
+			sinkMap = userToMap(&u)
+		}
+	})
+}
+
+var sinkInt int64
+
+// BenchmarkFieldAccess is one field read four ways. FieldByName
+// searches the fields by name on every call, which is why the plan
+// stores indexes
+func BenchmarkFieldAccess(b *testing.B) {
+	u := sampleUser()
+	v := reflect.ValueOf(&u).Elem()
+	idx := reflect.TypeFor[User]().Field(1).Index
+	b.Run("direct", func(b *testing.B) {
+		for b.Loop() {
+			sinkInt = u.ID
+		}
+	})
+	b.Run("Field(i)", func(b *testing.B) {
+		for b.Loop() {
+			sinkInt = v.Field(1).Int()
+		}
+	})
+	b.Run("FieldByIndex", func(b *testing.B) {
+		for b.Loop() {
+			sinkInt = v.FieldByIndex(idx).Int()
+		}
+	})
+	b.Run("FieldByName", func(b *testing.B) {
+		for b.Loop() {
+			sinkInt = v.FieldByName("ID").Int()
+		}
+	})
+}
@@ -0,0 +1,357 @@
+// Regular Expressions - RE2 in Go, and when to use strings instead
+//
+// Go's regexp package is RE2: a match takes time linear in the input,
+// whatever the pattern, so a pattern from a user can't hang a server.
+// The price is the features that need backtracking - backreferences,
+// lookahead - and speed: for fixed formats, strings.Cut and friends
+// are several times faster. Use regexp for patterns that vary, and
+// strings for formats that don't.
+//
+// This example demonstrates:
+//   - MustCompile for patterns written in the source, Compile for
+//     patterns from outside, and QuoteMeta for text to match literally
+//   - Named capture groups, read by name with SubexpIndex, and telling
+//     an empty group from one that didn't take part
+//   - ReplaceAllString with ${name} templates (and the $1x trap), and
+//     ReplaceAllStringFunc for replacements that need code
+//   - Matching over a reader: line by line with bufio.Scanner, and what
+//     FindReaderIndex does to the reader
+//   - The RE2 guarantee: (a+)+b against a backtracking matcher, which
+//     takes 2^n steps, and what RE2 refuses to compile
+//   - Parsing the same log format with a regexp and with strings, and
+//     benchmarks of both
+//
+// Usage:
+//   go run regexp.go
+//
+// Run tests:
+//   go test -v regexp.go regexp_test.go
+//   go test -run=^$ -bench=. -benchmem regexp.go regexp_test.go
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ============================================================
+// 1. Compile and MustCompile
+// ============================================================
+
+// A pattern in the source is compiled once, at startup, with
+// MustCompile: if it's wrong, the program can't work and should say so
+// before it does anything. Compiling inside a function that runs per
+// request costs a compile per request
+var logLineRE = regexp.MustCompile(
+	`^(?P<ip>\S+) \S+ (?P<user>\S+) \[(?P<time>[^\]]+)\] ` +
+		`"(?P<method>[A-Z]+) (?P<path>\S+) HTTP/[0-9.]+" ` +
+		`(?P<status>\d{3}) (?P<size>\d+|-)(?: |$)`)
+
+// Indexes into the submatch slice, looked up once by name
+var (
+	ipIdx     = logLineRE.SubexpIndex("ip")
+	userIdx   = logLineRE.SubexpIndex("user")
+	timeIdx   = logLineRE.SubexpIndex("time")
+	methodIdx = logLineRE.SubexpIndex("method")
+	pathIdx   = logLineRE.SubexpIndex("path")
+	statusIdx = logLineRE.SubexpIndex("status")
+	sizeIdx   = logLineRE.SubexpIndex("size")
+)
+
+// compileFilter compiles a pattern that came from outside the program,
+// from a flag, a config file, a search box. That's an error to report,
+// not a panic
+func compileFilter(pattern string, literal bool) (*regexp.Regexp, error) {
+	if literal {
+		// QuoteMeta escapes every metacharacter: "1.5" matches "1.5" and
+		// not "105"
+		pattern = regexp.QuoteMeta(pattern)
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("bad filter: %w", err)
+	}
+	return re, nil
+}
+
+// ============================================================
+// 2. Named groups: parsing a log line
+// ============================================================
+
+// LogLine is one line of an access log in Common Log Format:
+//
+//	203.0.113.9 - alice [16/Oct/2026:14:30:00 +0000] "GET /x HTTP/1.1" 200 512
+type LogLine struct {
+	IP     string
+	User   string // "" for "-"
+	Time   time.Time
+	Method string
+	Path   string
+	Status int
+	Size   int64 // -1 for "-"
+}
+
+const clfTime = "02/Jan/2006:15:04:05 -0700"
+
+var ErrBadLine = errors.New("not a log line")
+
+// parseRegexp parses a log line with logLineRE
+func parseRegexp(line string) (LogLine, error) {
+	m := logLineRE.FindStringSubmatch(line)
+	if m == nil {
+		return LogLine{}, ErrBadLine
+	}
+	return makeLogLine(m[ipIdx], m[userIdx], m[timeIdx], m[methodIdx], m[pathIdx], m[statusIdx], m[sizeIdx])
+}
+
+// parseStrings parses the same format with strings.Cut. It is longer,
+// and has to be as strict as the regexp by hand, but it doesn't
+// compile anything or run an automaton
+func parseStrings(line string) (LogLine, error) {
+	ip, rest, ok1 := strings.Cut(line, " ")
+	ident, rest, ok2 := strings.Cut(rest, " ") // identd, always "-"
+	user, rest, ok3 := strings.Cut(rest, " [")
+	ts, rest, ok4 := strings.Cut(rest, `] "`)
+	req, rest, ok5 := strings.Cut(rest, `" `)
+	if !ok1 || !ok2 || !ok3 || !ok4 || !ok5 || ip == "" || ident == "" || user == "" || strings.Contains(user, " ") {
+		return LogLine{}, ErrBadLine
+	}
+	method, req, ok1 := strings.Cut(req, " ")
+	path, proto, ok2 := strings.Cut(req, " ")
+	version, isHTTP := strings.CutPrefix(proto, "HTTP/")
+	if !ok1 || !ok2 || !isUpper(method) || path == "" || !isHTTP || strings.Trim(version, "0123456789.") != "" || version == "" {
+		return LogLine{}, ErrBadLine
+	}
+	status, rest, _ := strings.Cut(rest, " ")
+	size, _, _ := strings.Cut(rest, " ")
+	if len(status) != 3 || !isDigits(status) || size != "-" && !isDigits(size) {
+		return LogLine{}, ErrBadLine
+	}
+	return makeLogLine(ip, user, ts, method, path, status, size)
+}
+
+func isUpper(s string) bool {
+	return s != "" && strings.Trim(s, "ABCDEFGHIJKLMNOPQRSTUVWXYZ") == ""
+}
+
+func isDigits(s string) bool {
+	return s != "" && strings.Trim(s, "0123456789") == ""
+}
+
+func makeLogLine(ip, user, ts, method, path, status, size string) (LogLine, error) {
+	t, err := time.Parse(clfTime, ts)
+	if err != nil {
+		return LogLine{}, fmt.Errorf("%w: %v", ErrBadLine, err)
+	}
+	l := LogLine{IP: ip, User: user, Time: t, Method: method, Path: path, Size: -1}
+	if l.User == "-" {
+		l.User = ""
+	}
+	l.Status, _ = strconv.Atoi(status)
+	if size != "-" {
+		if l.Size, err = strconv.ParseInt(size, 10, 64); err != nil {
+			return LogLine{}, fmt.Errorf("%w: size: %v", ErrBadLine, err)
+		}
+	}
+	return l, nil
+}
+
+// versionRE has an optional group. FindStringSubmatch can't tell a
+// group that matched nothing from one that didn't take part; the
+// index form can: -1 means it didn't
+var versionRE = regexp.MustCompile(`^v(\d+)\.(\d+)(?:\.(\d+))?(-(\w*))?$`)
+
+// ============================================================
+// 3. Replacing
+// ============================================================
+
+// tokenRE finds secrets in query strings
+var tokenRE = regexp.MustCompile(`([?&](?:token|api_key|password)=)[^&\s"]*`)
+
+// emailRE is good enough for redacting logs, which is not the same as
+// validating addresses
+var emailRE = regexp.MustCompile(`\b([A-Za-z0-9._%+-])[A-Za-z0-9._%+-]*@([A-Za-z0-9.-]+\.[A-Za-z]{2,})\b`)
+
+// redact hides secrets and email addresses in a log line. Tokens are
+// a template replacement: ${1} is the "token=" kept in front. Emails
+// need a function, to keep the first letter and domain
+func redact(line string) string {
+	line = tokenRE.ReplaceAllString(line, "${1}REDACTED")
+	return emailRE.ReplaceAllStringFunc(line, func(addr string) string {
+		// The func gets the whole match, not the groups; match again
+		// for them
+		m := emailRE.FindStringSubmatch(addr)
+		return m[1] + "***@" + m[2]
+	})
+}
+
+// ============================================================
+// 4. Matching over a reader
+// ============================================================
+
+// grep calls fn with each line of r that re matches, and its number.
+// Line by line, memory is one line however long r is, and no match
+// can span two lines - which for log files is what's wanted
+func grep(r io.Reader, re *regexp.Regexp, fn func(n int, line string)) error {
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		if re.Match(sc.Bytes()) { // Match on the bytes: no string made for lines that miss
+			fn(n, sc.Text())
+		}
+	}
+	return sc.Err()
+}
+
+// countingReader counts the bytes read through it
+type countingReader struct {
+	r io.RuneReader
+	n int
+}
+
+func (c *countingReader) ReadRune() (rune, int, error) {
+	r, size, err := c.r.ReadRune()
+	c.n += size
+	return r, size, err
+}
+
+// ============================================================
+// 5. The RE2 guarantee
+// ============================================================
+
+// backtrack matches (a+)+b against s the way a backtracking engine
+// does - Perl, PCRE, Java, JavaScript, Python - counting the steps.
+// When there's no b, it tries every way of splitting the a's between
+// the inner and outer +, about 2^n steps for n a's
+func backtrack(s string, steps *int) bool {
+	// group matches one or more a's from i, then either another group
+	// or the b
+	var group func(i int) bool
+	group = func(i int) bool {
+		for j := i + 1; j <= len(s) && s[j-1] == 'a'; j++ {
+			*steps++
+			if j < len(s) && s[j] == 'b' || group(j) {
+				return true
+			}
+		}
+		return false
+	}
+	return group(0)
+}
+
+// ============================================================
+// main
+// ============================================================
+
+var sampleLog = `203.0.113.9 - alice [16/Oct/2026:14:30:00 +0000] "GET /api/v1/items/42?token=s3cr3t HTTP/1.1" 200 512 "-" "curl/8.4"
+198.51.100.7 - - [16/Oct/2026:14:30:01 +0000] "POST /login HTTP/1.1" 401 - "-" "Mozilla/5.0"
+203.0.113.9 - alice [16/Oct/2026:14:30:02 +0000] "GET /reset?email=alice.smith@example.com&api_key=k-123 HTTP/1.1" 302 0
+garbage line
+192.0.2.44 - bob [16/Oct/2026:14:30:03 +0000] "DELETE /api/v1/items/42 HTTP/2.0" 500 73
+`
+
+func main() {
+	fmt.Println("=== 1. Compile and MustCompile ===")
+	for _, p := range []string{`status=5\d\d`, `(unclosed`, `a{2,1}`, `\1`} {
+		_, err := compileFilter(p, false)
+		fmt.Printf("  %-25s err: %v\n", fmt.Sprintf("Compile(%q)", p), err)
+	}
+	lit, _ := compileFilter("1.5", true)
+	fmt.Printf("  QuoteMeta(\"1.5\") = %q; matches \"105\": %v, \"1.5\": %v\n",
+		lit.String(), lit.MatchString("105"), lit.MatchString("1.5"))
+
+	fmt.Println()
+	fmt.Println("=== 2. Named groups ===")
+	fmt.Printf("  groups: %q\n", logLineRE.SubexpNames()[1:])
+	for line := range strings.Lines(sampleLog) {
+		line = strings.TrimSuffix(line, "\n")
+		l, err := parseRegexp(line)
+		if err != nil {
+			fmt.Printf("  %-38q %v\n", line, err)
+			continue
+		}
+		fmt.Printf("  %-14s %-7q %-6s %-26.26s %d %5d\n", l.IP, l.User, l.Method, l.Path, l.Status, l.Size)
+	}
+	for _, v := range []string{"v1.2.3-rc1", "v1.2", "v1.2-", "v1.2.x"} {
+		m := versionRE.FindStringSubmatch(v)
+		idx := versionRE.FindStringSubmatchIndex(v)
+		if m == nil {
+			fmt.Printf("  %-10s no match\n", v)
+			continue
+		}
+		// Groups 3 and 5: the patch and the pre-release label
+		fmt.Printf("  %-10s patch %q (took part: %-5v) pre %q (took part: %v)\n",
+			v, m[3], idx[6] >= 0, m[5], idx[10] >= 0)
+	}
+
+	fmt.Println()
+	fmt.Println("=== 3. Replacing ===")
+	for line := range strings.Lines(sampleLog) {
+		if r := redact(line); r != line {
+			fmt.Printf("  %s", r)
+		}
+	}
+	// $1x is read as the group named "1x", which doesn't exist: it
+	// expands to nothing. ${1}x is group 1 then an x
+	re := regexp.MustCompile(`(\w+)@`)
+	fmt.Printf("  $1x:   %q\n", re.ReplaceAllString("bob@host", "$1x@"))
+	fmt.Printf("  ${1}x: %q\n", re.ReplaceAllString("bob@host", "${1}x@"))
+	fmt.Printf("  literal: %q\n", re.ReplaceAllLiteralString("bob@host", "$1@"))
+
+	fmt.Println()
+	fmt.Println("=== 4. Over a reader ===")
+	errs := regexp.MustCompile(`" 5\d\d `)
+	grep(strings.NewReader(sampleLog), errs, func(n int, line string) {
+		fmt.Printf("  line %d: %.60s...\n", n, line)
+	})
+	// FindReaderIndex finds the first match in a RuneReader, but reads
+	// past it, how far is unspecified: the reader can't be used to
+	// carry on from the end of the match
+	cr := &countingReader{r: bufio.NewReader(strings.NewReader(sampleLog))}
+	loc := regexp.MustCompile(`POST \S+`).FindReaderIndex(cr)
+	fmt.Printf("  FindReaderIndex: match at %v, but %d of %d bytes read\n", loc, cr.n, len(sampleLog))
+
+	fmt.Println()
+	fmt.Println("=== 5. The RE2 guarantee: (a+)+b against aaa...a ===")
+	evil := regexp.MustCompile(`(a+)+b`)
+	fmt.Println("      n   backtracking steps      time   regexp time")
+	for _, n := range []int{10, 15, 20, 25} {
+		s := strings.Repeat("a", n)
+		steps := 0
+		start := time.Now()
+		backtrack(s, &steps)
+		bt := time.Since(start)
+		start = time.Now()
+		evil.MatchString(s)
+		fmt.Printf("  %5d %20d %9v %13v\n", n, steps, bt.Round(time.Microsecond), time.Since(start).Round(time.Microsecond))
+	}
+	long := strings.Repeat("a", 1<<20)
+	start := time.Now()
+	evil.MatchString(long)
+	fmt.Printf("  regexp with n = 1M: %v; backtracking: about 2^1048576 steps\n", time.Since(start).Round(time.Millisecond))
+	for _, p := range []string{`(\w+) \1`, `foo(?=bar)`, `(?<!x)y`} {
+		_, err := regexp.Compile(p)
+		fmt.Printf("  not in RE2: %-12s %v\n", p, err)
+	}
+
+	fmt.Println()
+	fmt.Println("=== 6. regexp or strings ===")
+	line, _, _ := strings.Cut(sampleLog, "\n")
+	const n = 100_000
+	for _, p := range []struct {
+		name  string
+		parse func(string) (LogLine, error)
+	}{{"regexp", parseRegexp}, {"strings", parseStrings}} {
+		start := time.Now()
+		for range n {
+			p.parse(line)
+		}
+		fmt.Printf("  %-8s %v per line\n", p.name, time.Since(start)/n)
+	}
+	fmt.Println("  (go test -bench=. for the full comparison)")
+}
@@ -0,0 +1,268 @@
+// Testing Regular Expressions - Two parsers, one format
+//
+// parseRegexp and parseStrings must accept and reject exactly the same
+// lines, or the benchmark comparing them compares different things.
+// TestParsersAgree runs both over good lines and every way a line can
+// be malformed. The rest pin the replacement and group behaviour the
+// example describes.
+//
+// Run tests:
+//   go test -v regexp.go regexp_test.go
+//   go test -run=^$ -bench=. -benchmem regexp.go regexp_test.go
+package main
+
+import (
+	"errors"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+)
+
+const goodLine = `203.0.113.9 - alice [16/Oct/2026:14:30:00 +0000] "GET /api/v1/items/42?token=s3cr3t HTTP/1.1" 200 512 "-" "curl/8.4"`
+
+func TestParsersAgree(t *testing.T) {
+	tests := []struct {
+		name string
+		line string
+		ok   bool
+	}{
+		{"full", goodLine, true},
+		{"no referer or agent", `1.2.3.4 - - [16/Oct/2026:14:30:00 +0000] "GET / HTTP/1.0" 200 0`, true},
+		{"size -", `1.2.3.4 - bob [16/Oct/2026:14:30:00 -0700] "POST /x HTTP/2.0" 401 -`, true},
+		{"empty", ``, false},
+		{"garbage", `garbage line`, false},
+		{"leading space", ` 1.2.3.4 - - [16/Oct/2026:14:30:00 +0000] "GET / HTTP/1.0" 200 0`, false},
+		{"no identd", `1.2.3.4  - [16/Oct/2026:14:30:00 +0000] "GET / HTTP/1.0" 200 0`, false},
+		{"no brackets", `1.2.3.4 - - 16/Oct/2026:14:30:00 +0000 "GET / HTTP/1.0" 200 0`, false},
+		{"bad time", `1.2.3.4 - - [16/Okt/2026:14:30:00 +0000] "GET / HTTP/1.0" 200 0`, false},
+		{"lowercase method", `1.2.3.4 - - [16/Oct/2026:14:30:00 +0000] "get / HTTP/1.0" 200 0`, false},
+		{"space in path", `1.2.3.4 - - [16/Oct/2026:14:30:00 +0000] "GET /a b HTTP/1.0" 200 0`, false},
+		{"not HTTP", `1.2.3.4 - - [16/Oct/2026:14:30:00 +0000] "GET / FTP/1.0" 200 0`, false},
+		{"bad version", `1.2.3.4 - - [16/Oct/2026:14:30:00 +0000] "GET / HTTP/x" 200 0`, false},
+		{"two-digit status", `1.2.3.4 - - [16/Oct/2026:14:30:00 +0000] "GET / HTTP/1.0" 20 0`, false},
+		{"size not a number", `1.2.3.4 - - [16/Oct/2026:14:30:00 +0000] "GET / HTTP/1.0" 200 12abc`, false},
+		{"no size", `1.2.3.4 - - [16/Oct/2026:14:30:00 +0000] "GET / HTTP/1.0" 200`, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			re, reErr := parseRegexp(tt.line)
+			st, stErr := parseStrings(tt.line)
+			if (reErr == nil) != tt.ok || (stErr == nil) != tt.ok {
+				t.Fatalf("regexp err %v, strings err %v; want ok %v", reErr, stErr, tt.ok)
+			}
+			if !tt.ok {
+				if !errors.Is(reErr, ErrBadLine) || !errors.Is(stErr, ErrBadLine) {
+					t.Errorf("errors %v, %v; want ErrBadLine", reErr, stErr)
+				}
+				return
+			}
+			if re != st {
+				t.Errorf("parsers differ:\n regexp  %+v\n strings %+v", re, st)
+			}
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	got, err := parseRegexp(goodLine)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := LogLine{
+		IP: "203.0.113.9", User: "alice", Time: time.Date(2026, 10, 16, 14, 30, 0, 0, time.UTC),
+		Method: "GET", Path: "/api/v1/items/42?token=s3cr3t", Status: 200, Size: 512,
+	}
+	if !got.Time.Equal(want.Time) {
+		t.Errorf("time %v, want %v", got.Time, want.Time)
+	}
+	got.Time = want.Time
+	if got != want {
+		t.Errorf("parseRegexp = %+v\nwant %+v", got, want)
+	}
+}
+
+func TestCompileFilter(t *testing.T) {
+	tests := []struct {
+		pattern string
+		literal bool
+		input   string
+		match   bool
+		wantErr bool
+	}{
+		{`5\d\d`, false, "status 503", true, false},
+		{`1.5`, false, "105", true, false},
+		{`1.5`, true, "105", false, false},
+		{`a+(b)`, true, "a+(b)", true, false},
+		{`(`, false, "", false, true},
+		{`(`, true, "(", true, false}, // literal: nothing to get wrong
+	}
+	for _, tt := range tests {
+		re, err := compileFilter(tt.pattern, tt.literal)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("compileFilter(%q, %v) err %v", tt.pattern, tt.literal, err)
+			continue
+		}
+		if err == nil && re.MatchString(tt.input) != tt.match {
+			t.Errorf("compileFilter(%q, %v) on %q: match %v", tt.pattern, tt.literal, tt.input, !tt.match)
+		}
+	}
+}
+
+func TestVersionGroups(t *testing.T) {
+	tests := []struct {
+		v          string
+		patch, pre string
+		hasPatch   bool
+		hasPre     bool
+	}{
+		{"v1.2.3-rc1", "3", "rc1", true, true},
+		{"v1.2", "", "", false, false},
+		{"v1.2-", "", "", false, true}, // pre-release there, and empty
+		{"v1.2.0", "0", "", true, false},
+	}
+	for _, tt := range tests {
+		m := versionRE.FindStringSubmatch(tt.v)
+		idx := versionRE.FindStringSubmatchIndex(tt.v)
+		if m == nil {
+			t.Errorf("%s: no match", tt.v)
+			continue
+		}
+		if m[3] != tt.patch || m[5] != tt.pre || (idx[6] >= 0) != tt.hasPatch || (idx[10] >= 0) != tt.hasPre {
+			t.Errorf("%s: patch %q (%v), pre %q (%v)", tt.v, m[3], idx[6] >= 0, m[5], idx[10] >= 0)
+		}
+	}
+}
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{"GET /x?token=abc HTTP/1.1", "GET /x?token=REDACTED HTTP/1.1"},
+		{"/x?a=1&api_key=k-1&b=2", "/x?a=1&api_key=REDACTED&b=2"},
+		{"/x?password=", "/x?password=REDACTED"},
+		{"/x?notatoken=abc", "/x?notatoken=abc"}, // must follow ? or &
+		{"mail alice.smith@example.com now", "mail a***@example.com now"},
+		{"two: a@b.io, cc@dd.org", "two: a***@b.io, c***@dd.org"},
+		{"not an address: a@b", "not an address: a@b"},
+		{"nothing to hide", "nothing to hide"},
+	}
+	for _, tt := range tests {
+		if got := redact(tt.in); got != tt.want {
+			t.Errorf("redact(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestReplaceTemplates(t *testing.T) {
+	re := regexp.MustCompile(`(?P<user>\w+)@(?P<host>\w+)`)
+	tests := []struct {
+		tmpl, want string
+	}{
+		{"$1x", ""}, // the group "1x", which doesn't exist
+		{"${1}x", "bobx"},
+		{"$host/$user", "srv/bob"},
+		{"${host}_${user}", "srv_bob"}, // $host_ would be the group "host_"
+		{"$$1", "$1"},
+	}
+	for _, tt := range tests {
+		if got := re.ReplaceAllString("bob@srv", tt.tmpl); got != tt.want {
+			t.Errorf("ReplaceAllString(%q) = %q, want %q", tt.tmpl, got, tt.want)
+		}
+	}
+}
+
+func TestGrep(t *testing.T) {
+	var got []int
+	err := grep(strings.NewReader(sampleLog), regexp.MustCompile(`" [45]\d\d `), func(n int, _ string) {
+		got = append(got, n)
+	})
+	if err != nil || len(got) != 2 || got[0] != 2 || got[1] != 5 {
+		t.Errorf("grep = %v, %v; want lines 2 and 5", got, err)
+	}
+}
+
+func TestBacktrack(t *testing.T) {
+	for n := 1; n <= 16; n++ {
+		s := strings.Repeat("a", n)
+		steps := 0
+		if backtrack(s, &steps) {
+			t.Errorf("backtrack(%d a's) matched", n)
+		}
+		if want := 1<<n - 1; steps != want {
+			t.Errorf("backtrack(%d a's): %d steps, want %d", n, steps, want)
+		}
+		// With the b, the first try succeeds: one step per a
+		steps = 0
+		if !backtrack(s+"b", &steps) || steps != n {
+			t.Errorf("backtrack(%d a's and b): %d steps", n, steps)
+		}
+		if evil := regexp.MustCompile(`(a+)+b`); evil.MatchString(s) || !evil.MatchString(s+"b") {
+			t.Errorf("regexp disagrees with backtrack at n=%d", n)
+		}
+	}
+}
+
+// ============================================================
+// Benchmarks
+// ============================================================
+
+var (
+	sinkLine LogLine
+	sinkBool bool
+)
+
+// BenchmarkParse is one log line, both ways. The regexp runs a
+// submatch automaton over the line; strings.Cut is an IndexByte per
+// field
+func BenchmarkParse(b *testing.B) {
+	b.Run("regexp", func(b *testing.B) {
+		for b.Loop() {
+			sinkLine, _ = parseRegexp(goodLine)
+		}
+	})
+	b.Run("strings", func(b *testing.B) {
+		for b.Loop() {
+			sinkLine, _ = parseStrings(goodLine)
+		}
+	})
+}
+
+// BenchmarkMatch is a yes/no question, which is cheaper than a parse
+// for both. For a literal, regexp finds the literal prefix and uses
+// strings.Index itself, but still pays its own overhead
+func BenchmarkMatch(b *testing.B) {
+	literal := regexp.MustCompile(`HTTP/1\.1`)
+	class := regexp.MustCompile(`" 5\d\d `)
+	b.Run("regexp-literal", func(b *testing.B) {
+		for b.Loop() {
+			sinkBool = literal.MatchString(goodLine)
+		}
+	})
+	b.Run("strings.Contains", func(b *testing.B) {
+		for b.Loop() {
+			sinkBool = strings.Contains(goodLine, "HTTP/1.1")
+		}
+	})
+	b.Run("regexp-class", func(b *testing.B) {
+		for b.Loop() {
+			sinkBool = class.MatchString(goodLine)
+		}
+	})
+}
+
+// BenchmarkCompile is the cost of regexp.MustCompile inside the
+// function that uses it, against a package-level variable
+func BenchmarkCompile(b *testing.B) {
+	b.Run("per-call", func(b *testing.B) {
+		for b.Loop() {
+			sinkBool = regexp.MustCompile(`(a+)+b`).MatchString("aaab")
+		}
+	})
+	evil := regexp.MustCompile(`(a+)+b`)
+	b.Run("once", func(b *testing.B) {
+		for b.Loop() {
+			sinkBool = evil.MatchString("aaab")
+		}
+	})
+}
@@ -0,0 +1,286 @@
+// tablegen - Generate a table-driven test skeleton for a function
+//
+// Writing the struct, the loop and the t.Run boilerplate by hand is
+// the tedious part of a table-driven test. tablegen reads a function
+// signature and writes that part for you, leaving only the cases:
+//
+//   func TestDivide(t *testing.T) {
+//       tests := []struct {
+//           name    string
+//           a       float64
+//           b       float64
+//           want    float64
+//           wantErr bool
+//       }{
+//           // TODO: add test cases
+//       }
+//       ...
+//
+// The signature comes either from a Go source file (-func, looked up
+// in -in) or directly from -sig. Under go generate, -in defaults to
+// $GOFILE, so a directive in the file that declares the function is
+// all it takes:
+//
+//   //go:generate go run github.com/bellistech/labs/coding/go/examples/basics/table_driven_test/cmd/tablegen -func Divide -o divide_gen_test.go
+//
+// Usage:
+//   go run ./cmd/tablegen -in testable/testable.go -func FizzBuzz
+//   go run ./cmd/tablegen -pkg calc -sig 'func Clamp(v, lo, hi int) int'
+//   go generate ./...
+//
+// testdata/divide_test.golden is this tool's own output for Divide,
+// kept up to date by the directive below and checked by main_test.go.
+//
+//go:generate go run . -in ../../testable/testable.go -func Divide -o testdata/divide_test.golden
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// field is one column of the test table
+type field struct {
+	Name string // struct field name, e.g. "a" or "want"
+	Type string // Go type as written in source
+	Arg  string // how the field is passed in the call, e.g. "tt.a" or "tt.xs..."
+}
+
+// testSpec is everything the template needs
+type testSpec struct {
+	Package string
+	Func    string
+	Inputs  []field
+	Wants   []field // results except a trailing error
+	HasErr  bool
+}
+
+func main() {
+	in := flag.String("in", os.Getenv("GOFILE"), "Go source file declaring the function (default $GOFILE)")
+	name := flag.String("func", "", "name of the function to generate a test for")
+	sig := flag.String("sig", "", `signature to use instead of -in/-func, e.g. "func Add(a, b int) int"`)
+	pkg := flag.String("pkg", "", "package clause for the output (default: from -in, or $GOPACKAGE)")
+	out := flag.String("o", "", "output file (default stdout)")
+	flag.Parse()
+
+	src, err := generate(*in, *name, *sig, *pkg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "tablegen:", err)
+		os.Exit(1)
+	}
+
+	if *out == "" {
+		os.Stdout.Write(src)
+		return
+	}
+	if err := os.WriteFile(*out, src, 0o644); err != nil {
+		fmt.Fprintln(os.Stderr, "tablegen:", err)
+		os.Exit(1)
+	}
+}
+
+// generate finds the signature, builds a testSpec and renders it
+func generate(in, name, sig, pkg string) ([]byte, error) {
+	var decl *ast.FuncDecl
+	var err error
+	switch {
+	case sig != "":
+		decl, err = parseSignature(sig)
+	case name != "" && in != "":
+		var filePkg string
+		decl, filePkg, err = findFunc(in, name)
+		if pkg == "" {
+			pkg = filePkg
+		}
+	default:
+		return nil, errors.New("need -sig, or -func with -in (or $GOFILE)")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if pkg == "" {
+		pkg = cmpOr(os.Getenv("GOPACKAGE"), "main")
+	}
+
+	spec, err := buildSpec(decl, pkg)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if err := testTemplate.Execute(&buf, spec); err != nil {
+		return nil, err
+	}
+	// gofmt the result so alignment is right however the template
+	// spaced things, and so a template bug shows up as an error here
+	return format.Source(buf.Bytes())
+}
+
+// parseSignature parses "func Name(params) results" on its own. A
+// function declaration without a body is valid Go syntax (it's how
+// assembly functions are declared), so the parser accepts it.
+func parseSignature(sig string) (*ast.FuncDecl, error) {
+	f, err := parser.ParseFile(token.NewFileSet(), "sig.go", "package p\n"+sig, 0)
+	if err != nil {
+		return nil, fmt.Errorf("parse signature: %w", err)
+	}
+	for _, d := range f.Decls {
+		if fd, ok := d.(*ast.FuncDecl); ok {
+			return fd, nil
+		}
+	}
+	return nil, errors.New("parse signature: no function found")
+}
+
+// findFunc parses a source file and returns the named top-level function
+func findFunc(path, name string) (*ast.FuncDecl, string, error) {
+	f, err := parser.ParseFile(token.NewFileSet(), path, nil, parser.SkipObjectResolution)
+	if err != nil {
+		return nil, "", err
+	}
+	for _, d := range f.Decls {
+		if fd, ok := d.(*ast.FuncDecl); ok && fd.Recv == nil && fd.Name.Name == name {
+			return fd, f.Name.Name, nil
+		}
+	}
+	return nil, "", fmt.Errorf("%s: no function %s", path, name)
+}
+
+// buildSpec turns parameters into input fields and results into want
+// fields. Unnamed parameters become arg0, arg1...; a trailing error
+// result becomes the wantErr flag instead of a want field.
+func buildSpec(decl *ast.FuncDecl, pkg string) (testSpec, error) {
+	if decl.Recv != nil {
+		return testSpec{}, fmt.Errorf("%s is a method; only functions are supported", decl.Name.Name)
+	}
+	if decl.Type.TypeParams != nil {
+		return testSpec{}, fmt.Errorf("%s is generic; instantiate it in a -sig instead", decl.Name.Name)
+	}
+
+	spec := testSpec{Package: pkg, Func: decl.Name.Name}
+
+	for _, p := range fieldList(decl.Type.Params) {
+		name := p.name
+		if name == "" || name == "_" {
+			name = fmt.Sprintf("arg%d", len(spec.Inputs))
+		}
+		f := field{Name: name, Type: p.typ, Arg: "tt." + name}
+		if rest, ok := strings.CutPrefix(p.typ, "..."); ok {
+			f.Type = "[]" + rest
+			f.Arg += "..."
+		}
+		spec.Inputs = append(spec.Inputs, f)
+	}
+
+	results := fieldList(decl.Type.Results)
+	if n := len(results); n > 0 && results[n-1].typ == "error" {
+		spec.HasErr = true
+		results = results[:n-1]
+	}
+	for i, r := range results {
+		name := "want"
+		if len(results) > 1 {
+			name = fmt.Sprintf("want%d", i)
+		}
+		spec.Wants = append(spec.Wants, field{Name: name, Type: r.typ})
+	}
+	return spec, nil
+}
+
+type param struct{ name, typ string }
+
+// fieldList flattens "a, b float64" into two params with the same type
+func fieldList(fl *ast.FieldList) []param {
+	if fl == nil {
+		return nil
+	}
+	var out []param
+	for _, f := range fl.List {
+		typ := exprString(f.Type)
+		if len(f.Names) == 0 {
+			out = append(out, param{typ: typ})
+			continue
+		}
+		for _, n := range f.Names {
+			out = append(out, param{name: n.Name, typ: typ})
+		}
+	}
+	return out
+}
+
+// exprString prints a type expression back as source
+func exprString(e ast.Expr) string {
+	var buf bytes.Buffer
+	format.Node(&buf, token.NewFileSet(), e)
+	return buf.String()
+}
+
+func cmpOr(s, fallback string) string {
+	if s != "" {
+		return s
+	}
+	return fallback
+}
+
+// Results are compared with reflect.DeepEqual so the skeleton works
+// for slices and maps too; switch to == or cmp.Diff as you see fit
+var testTemplate = template.Must(template.New("test").Parse(`// Code generated by tablegen; edit freely once you've added cases.
+
+package {{.Package}}
+
+import (
+{{- if .Wants}}
+	"reflect"
+{{- end}}
+	"testing"
+)
+
+func Test{{.Func}}(t *testing.T) {
+	tests := []struct {
+		name string
+{{- range .Inputs}}
+		{{.Name}} {{.Type}}
+{{- end}}
+{{- range .Wants}}
+		{{.Name}} {{.Type}}
+{{- end}}
+{{- if .HasErr}}
+		wantErr bool
+{{- end}}
+	}{
+		// TODO: add test cases
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			{{range $i, $w := .Wants}}{{if $i}}, {{end}}got{{slice $w.Name 4}}{{end}}
+			{{- if .HasErr}}{{if .Wants}}, {{end}}err{{end}}
+			{{- if or .Wants .HasErr}} := {{end}}{{.Func}}({{range $i, $in := .Inputs}}{{if $i}}, {{end}}{{$in.Arg}}{{end}})
+{{- if .HasErr}}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("{{.Func}}() error = %v, wantErr %v", err, tt.wantErr)
+			}
+{{- if .Wants}}
+			if err != nil {
+				return
+			}
+{{- end}}
+{{- end}}
+{{- range .Wants}}
+			if !reflect.DeepEqual(got{{slice .Name 4}}, tt.{{.Name}}) {
+				t.Errorf("{{$.Func}}() {{with slice .Name 4}}got{{.}} {{end}}= %v, want %v", got{{slice .Name 4}}, tt.{{.Name}})
+			}
+{{- end}}
+		})
+	}
+}
+`))
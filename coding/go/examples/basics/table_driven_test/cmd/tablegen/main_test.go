@@ -0,0 +1,95 @@
+// tablegen tests - Golden files for generated code
+//
+// The expected output of a code generator is easiest to review as a
+// file: testdata/divide_test.golden is exactly what tablegen writes
+// for Divide. After an intentional change to the template, refresh
+// it and review the diff:
+//   go generate ./cmd/tablegen
+//   git diff cmd/tablegen/testdata
+//
+// Run tests:
+//   go test -v ./cmd/tablegen
+package main
+
+import (
+	"go/parser"
+	"go/token"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestGenerateGolden(t *testing.T) {
+	got, err := generate("../../testable/testable.go", "Divide", "", "")
+	if err != nil {
+		t.Fatalf("generate: %v", err)
+	}
+	want, err := os.ReadFile("testdata/divide_test.golden")
+	if err != nil {
+		t.Fatalf("read golden: %v", err)
+	}
+	if string(got) != string(want) {
+		t.Errorf("output differs from testdata/divide_test.golden; run go generate if the change is intended\ngot:\n%s", got)
+	}
+}
+
+func TestGenerateSignatures(t *testing.T) {
+	tests := []struct {
+		name     string
+		sig      string
+		wantText []string
+		wantErr  bool
+	}{
+		{
+			name:     "shared parameter type",
+			sig:      "func Add(a, b int) int",
+			wantText: []string{"a    int", "b    int", "want int", "got := Add(tt.a, tt.b)"},
+		},
+		{
+			name:     "variadic becomes a slice",
+			sig:      "func Join(sep string, parts ...string) string",
+			wantText: []string{"parts []string", "Join(tt.sep, tt.parts...)"},
+		},
+		{
+			name:     "unnamed parameters and several results",
+			sig:      "func Cut(string, string) (string, string, bool)",
+			wantText: []string{"arg0  string", "want2 bool", "got0, got1, got2 := Cut(tt.arg0, tt.arg1)"},
+		},
+		{
+			name:     "error only",
+			sig:      "func Validate(v any) error",
+			wantText: []string{"wantErr bool", "err := Validate(tt.v)"},
+		},
+		{
+			name:    "methods are rejected",
+			sig:     "func (s *Server) Start() error",
+			wantErr: true,
+		},
+		{
+			name:    "not a signature",
+			sig:     "func (",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src, err := generate("", "", tt.sig, "demo")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("generate(%q) error = %v, wantErr %v", tt.sig, err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			// The output must at least be valid Go
+			if _, err := parser.ParseFile(token.NewFileSet(), "gen_test.go", src, 0); err != nil {
+				t.Fatalf("generated code doesn't parse: %v\n%s", err, src)
+			}
+			for _, want := range tt.wantText {
+				if !strings.Contains(string(src), want) {
+					t.Errorf("output missing %q:\n%s", want, src)
+				}
+			}
+		})
+	}
+}
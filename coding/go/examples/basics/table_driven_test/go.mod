@@ -0,0 +1,3 @@
+module github.com/bellistech/labs/coding/go/examples/basics/table_driven_test
+
+go 1.25
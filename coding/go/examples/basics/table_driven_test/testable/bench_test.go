@@ -0,0 +1,136 @@
+// Benchmarks - Measuring the functions under test
+//
+// Run benchmarks:
+//   go test -run=^$ -bench=. ./testable
+//   go test -run=^$ -bench=IsPalindrome -benchmem ./testable
+package testable
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// Benchmark conventions used below:
+// - Name sub-benchmarks key=value (len=27, kind=palindrome) so
+//   benchstat can group and compare them across runs:
+//     go test -run=^$ -bench=. -count=10 > old.txt
+//     (change code)
+//     go test -run=^$ -bench=. -count=10 > new.txt
+//     benchstat old.txt new.txt
+// - Keep setup out of the timed region: b.ResetTimer after one-off
+//   setup, b.StopTimer/b.StartTimer around per-iteration setup
+// - Store results in a package-level sink so the compiler can't
+//   discard the call being measured
+// - b.ReportAllocs reports allocs/op even without -benchmem
+// - b.ReportMetric adds custom units next to ns/op
+
+// benchSink receives benchmark results; see the conventions above
+var benchSink any
+
+func BenchmarkAdd(b *testing.B) {
+	var r int
+	for i := 0; i < b.N; i++ {
+		r = Add(i, 200) // i, not a constant: constant inputs get folded away
+	}
+	benchSink = r
+}
+
+// makePalindrome builds a palindrome of n letters
+func makePalindrome(n int) string {
+	half := strings.Repeat("abcdefghij", n/20+1)[:n/2]
+	mid := ""
+	if n%2 == 1 {
+		mid = "z"
+	}
+	runes := []rune(half)
+	slices.Reverse(runes)
+	return half + mid + string(runes)
+}
+
+func BenchmarkIsPalindrome(b *testing.B) {
+	cases := []struct {
+		kind  string
+		input string
+	}{
+		{"palindrome", "a"},
+		{"palindrome", "racecar"},
+		{"palindrome", "A man a plan a canal Panama"},
+		{"palindrome", makePalindrome(1000)},
+		// Fails on the first comparison, but still pays for cleaning
+		// the whole string first - the benchmark makes that visible
+		{"mismatch", "x" + makePalindrome(999)},
+	}
+
+	for _, c := range cases {
+		b.Run(fmt.Sprintf("kind=%s/len=%d", c.kind, len(c.input)), func(b *testing.B) {
+			b.ReportAllocs()
+			var r bool
+			for i := 0; i < b.N; i++ {
+				r = IsPalindrome(c.input)
+			}
+			benchSink = r
+
+			// Custom metrics: input size per op, and cost per character,
+			// which should stay flat if IsPalindrome is linear
+			b.ReportMetric(float64(len(c.input)), "chars/op")
+			b.ReportMetric(float64(b.Elapsed().Nanoseconds())/float64(b.N*len(c.input)), "ns/char")
+		})
+	}
+}
+
+func BenchmarkIsPalindromeSetup(b *testing.B) {
+	// One-off setup: building a 1MB input is far slower than anything
+	// measured below. ResetTimer zeroes the clock and the alloc counts.
+	input := makePalindrome(1 << 20)
+	b.ResetTimer()
+
+	var r bool
+	for i := 0; i < b.N; i++ {
+		r = IsPalindrome(input)
+	}
+	benchSink = r
+	b.SetBytes(int64(len(input))) // also prints MB/s
+}
+
+func BenchmarkCountPalindromes(b *testing.B) {
+	dir := b.TempDir()
+	for _, lines := range []int{10, 1000} {
+		b.Run(fmt.Sprintf("lines=%d", lines), func(b *testing.B) {
+			b.ReportAllocs()
+			content := strings.Repeat("racecar\nhello\n", lines/2)
+			path := filepath.Join(dir, fmt.Sprintf("in-%d.txt", lines))
+
+			var n int
+			for i := 0; i < b.N; i++ {
+				// Per-iteration setup, excluded from the timing. StopTimer
+				// and StartTimer are not free, so use this only when the
+				// setup really must be repeated; otherwise hoist it out.
+				b.StopTimer()
+				if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+					b.Fatal(err)
+				}
+				b.StartTimer()
+
+				var err error
+				if n, err = CountPalindromes(path); err != nil {
+					b.Fatal(err)
+				}
+			}
+			benchSink = n
+			b.ReportMetric(float64(lines), "lines/op")
+		})
+	}
+}
+
+// Go 1.24 added b.Loop, which does the bookkeeping above for you:
+// setup before the loop is excluded automatically, and the loop body
+// is kept from being optimized away, so no sink is needed:
+//
+//	input := makePalindrome(1 << 20)
+//	for b.Loop() {
+//		IsPalindrome(input)
+//	}
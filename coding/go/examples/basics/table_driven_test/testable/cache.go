@@ -0,0 +1,85 @@
+package testable
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Cache holds string values that expire ttl after they were set.
+// Expiry is decided by the injected Clock, never by time.Now(), so
+// tests can jump an hour ahead without waiting an hour.
+type Cache struct {
+	clock Clock
+	ttl   time.Duration
+
+	mu    sync.Mutex
+	items map[string]cacheItem
+}
+
+type cacheItem struct {
+	value   string
+	expires time.Time
+}
+
+// NewCache returns an empty cache; pass RealClock{} in production
+func NewCache(clock Clock, ttl time.Duration) *Cache {
+	return &Cache{clock: clock, ttl: ttl, items: make(map[string]cacheItem)}
+}
+
+// Set stores value under key, resetting its expiry
+func (c *Cache) Set(key, value string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.items[key] = cacheItem{value: value, expires: c.clock.Now().Add(c.ttl)}
+}
+
+// Get returns the value for key, or false if it is missing or expired.
+// An entry is expired from the instant now reaches its expiry time.
+func (c *Cache) Get(key string) (string, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	item, ok := c.items[key]
+	if !ok || !c.clock.Now().Before(item.expires) {
+		return "", false
+	}
+	return item.value, true
+}
+
+// Len counts stored entries, including expired ones not yet swept
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.items)
+}
+
+// Sweep deletes expired entries and reports how many it removed
+func (c *Cache) Sweep() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.clock.Now()
+	removed := 0
+	for k, item := range c.items {
+		if !now.Before(item.expires) {
+			delete(c.items, k)
+			removed++
+		}
+	}
+	return removed
+}
+
+// RunSweeper calls Sweep every interval until ctx is cancelled. It
+// uses a real time.Ticker, which an injected Clock can't fake - see
+// cache_test.go for how testing/synctest handles that.
+func (c *Cache) RunSweeper(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.Sweep()
+		}
+	}
+}
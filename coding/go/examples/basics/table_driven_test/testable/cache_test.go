@@ -0,0 +1,112 @@
+// Testing Time - Injected clocks and testing/synctest
+//
+// time.Sleep in a test is slow when the wait is long and flaky when
+// it's short. Two ways to take real time out of the picture:
+// - Inject a Clock (see mocking_test.go) and move it by hand. Works
+//   for any code that asks "what time is it?".
+// - Run the test in a testing/synctest bubble (Go 1.25+). Inside it
+//   time.Now, time.Sleep, timers and tickers use a fake clock that
+//   jumps forward whenever every goroutine in the bubble is blocked.
+//   Works even for code that creates its own timers, like RunSweeper.
+//
+// Run tests:
+//   go test -v -run 'TestCache' ./testable
+package testable
+
+import (
+	"context"
+	"testing"
+	"testing/synctest"
+	"time"
+)
+
+func TestCacheExpiry(t *testing.T) {
+	const ttl = time.Minute
+
+	tests := []struct {
+		name    string
+		advance time.Duration
+		wantOK  bool
+	}{
+		{"fresh", 0, true},
+		{"just before expiry", ttl - time.Nanosecond, true},
+		{"exactly at expiry", ttl, false},
+		{"long after", 24 * time.Hour, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := &fakeClock{now: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+			c := NewCache(clock, ttl)
+			c.Set("k", "v")
+
+			clock.Advance(tt.advance) // instant, however large
+
+			got, ok := c.Get("k")
+			if ok != tt.wantOK {
+				t.Fatalf("Get after %v: ok = %v; want %v", tt.advance, ok, tt.wantOK)
+			}
+			if ok && got != "v" {
+				t.Errorf("Get = %q; want %q", got, "v")
+			}
+		})
+	}
+}
+
+func TestCacheSetResetsExpiry(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	c := NewCache(clock, time.Minute)
+
+	c.Set("k", "v1")
+	clock.Advance(50 * time.Second)
+	c.Set("k", "v2")
+	clock.Advance(50 * time.Second) // 100s after the first Set
+
+	if got, ok := c.Get("k"); !ok || got != "v2" {
+		t.Errorf("Get = %q, %v; want v2, true", got, ok)
+	}
+	if n := c.Sweep(); n != 0 {
+		t.Errorf("Sweep removed %d; want 0", n)
+	}
+}
+
+func TestCacheSweeper(t *testing.T) {
+	// Everything inside the bubble sees fake time starting at
+	// midnight UTC 2000-01-01. This test "waits" over a minute and
+	// finishes in microseconds.
+	synctest.Test(t, func(t *testing.T) {
+		c := NewCache(RealClock{}, time.Minute)
+		ctx, cancel := context.WithCancel(t.Context())
+		defer cancel()
+		go c.RunSweeper(ctx, 10*time.Second)
+
+		c.Set("a", "1")
+		time.Sleep(30 * time.Second)
+		c.Set("b", "2")
+
+		// At 59s nothing has expired. synctest.Wait blocks until every
+		// other goroutine in the bubble is durably blocked, so the
+		// sweeper has finished whatever tick it was handling.
+		time.Sleep(29 * time.Second)
+		synctest.Wait()
+		if n := c.Len(); n != 2 {
+			t.Fatalf("at 59s Len = %d; want 2", n)
+		}
+
+		// The tick at 60s removes "a"; "b" lives until 90s
+		time.Sleep(2 * time.Second)
+		synctest.Wait()
+		if n := c.Len(); n != 1 {
+			t.Fatalf("at 61s Len = %d; want 1", n)
+		}
+
+		time.Sleep(30 * time.Second)
+		synctest.Wait()
+		if n := c.Len(); n != 0 {
+			t.Fatalf("at 91s Len = %d; want 0", n)
+		}
+		// synctest.Test waits for every goroutine in the bubble to
+		// exit, so a sweeper left running would deadlock it; the
+		// deferred cancel stops it first
+	})
+}
@@ -0,0 +1,44 @@
+package testable
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// RacyCounter is broken on purpose: c.n++ is a read, an add and a
+// write, and two goroutines can interleave them and lose an update.
+// go test -race reports it; see race_test.go.
+type RacyCounter struct {
+	n int
+}
+
+func (c *RacyCounter) Inc()       { c.n++ }
+func (c *RacyCounter) Value() int { return c.n }
+
+// MutexCounter fixes it with a lock around every access, reads too:
+// an unlocked read of n is still a race even if writes are locked
+type MutexCounter struct {
+	mu sync.Mutex
+	n  int
+}
+
+func (c *MutexCounter) Inc() {
+	c.mu.Lock()
+	c.n++
+	c.mu.Unlock()
+}
+
+func (c *MutexCounter) Value() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.n
+}
+
+// AtomicCounter fixes it without a lock; fine for a single value, but
+// a mutex is needed once several fields must change together
+type AtomicCounter struct {
+	n atomic.Int64
+}
+
+func (c *AtomicCounter) Inc()       { c.n.Add(1) }
+func (c *AtomicCounter) Value() int { return int(c.n.Load()) }
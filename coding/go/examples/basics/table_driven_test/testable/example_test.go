@@ -0,0 +1,51 @@
+// Examples - Tests that double as documentation
+//
+// Example functions are compiled, run and checked against their
+// // Output: comment, and godoc shows them next to the function they
+// name. This file is package testable_test, an external test package:
+// it sees only exported identifiers, exactly like an importer.
+//
+// Run tests:
+//   go test -run Example -v ./testable
+package testable_test
+
+import (
+	"fmt"
+
+	"github.com/bellistech/labs/coding/go/examples/basics/table_driven_test/testable"
+)
+
+func ExampleAdd() {
+	fmt.Println(testable.Add(2, 3))
+	// Output: 5
+}
+
+func ExampleIsPalindrome() {
+	fmt.Println(testable.IsPalindrome("racecar"))
+	fmt.Println(testable.IsPalindrome("hello"))
+	// Output:
+	// true
+	// false
+}
+
+func ExampleFizzBuzz() {
+	for i := 1; i <= 15; i++ {
+		fmt.Println(testable.FizzBuzz(i))
+	}
+	// Output:
+	// 1
+	// 2
+	// Fizz
+	// 4
+	// Buzz
+	// Fizz
+	// 7
+	// 8
+	// Fizz
+	// Buzz
+	// 11
+	// Fizz
+	// 13
+	// 14
+	// FizzBuzz
+}
@@ -0,0 +1,126 @@
+// Test Fixtures - TestMain, setup, teardown and t.Cleanup
+//
+// Two levels of lifecycle:
+// - TestMain runs once per test binary. It builds fixtures that are
+//   expensive or shared (here: a directory of input files), calls
+//   m.Run(), then tears everything down.
+// - t.Cleanup registers teardown for one test or subtest. Cleanups
+//   run in reverse order when that test finishes, even if it failed,
+//   and unlike defer they can be registered from helper functions.
+//
+// A package has at most one TestMain, and it wraps every test in the
+// package - the other _test.go files here run inside it too.
+//
+// Run tests:
+//   go test -v -run TestCountPalindromes ./testable
+package testable
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fixtureRoot is set once by TestMain and read-only afterwards, so
+// tests can use it in parallel without locking
+var fixtureRoot string
+
+// fixtureFiles are written into fixtureRoot before any test runs
+var fixtureFiles = map[string]string{
+	"palindromes.txt": "racecar\nhello\nNever odd or even\n\nMadam\n",
+	"none.txt":        "go\ntest\n",
+	"empty.txt":       "",
+}
+
+// fixturePath returns the path of a shared fixture file. Tests go
+// through this accessor instead of building paths themselves.
+func fixturePath(t *testing.T, name string) string {
+	t.Helper()
+	if _, ok := fixtureFiles[name]; !ok {
+		t.Fatalf("no fixture named %q", name)
+	}
+	return filepath.Join(fixtureRoot, name)
+}
+
+func TestMain(m *testing.M) {
+	// Setup. There is no *testing.T here, so failures are reported
+	// by hand and the process exits non-zero.
+	dir, err := os.MkdirTemp("", "fixtures-")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "setup:", err)
+		os.Exit(1)
+	}
+	for name, content := range fixtureFiles {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644); err != nil {
+			fmt.Fprintln(os.Stderr, "setup:", err)
+			os.RemoveAll(dir)
+			os.Exit(1)
+		}
+	}
+	fixtureRoot = dir
+
+	code := m.Run()
+
+	// Teardown. os.Exit skips deferred calls, which is why this isn't
+	// a defer: it has to run before the exit.
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// writeTempFile creates a per-test file. t.TempDir registers its own
+// cleanup, and the extra t.Cleanup shows how a helper can attach
+// teardown to whichever test called it.
+func writeTempFile(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "input.txt")
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("write %s: %v", path, err)
+	}
+	t.Cleanup(func() {
+		t.Logf("cleanup: %s", filepath.Base(path))
+	})
+	return path
+}
+
+func TestCountPalindromes(t *testing.T) {
+	t.Run("shared fixtures", func(t *testing.T) {
+		tests := []struct {
+			file string
+			want int
+		}{
+			{"palindromes.txt", 3},
+			{"none.txt", 0},
+			{"empty.txt", 0},
+		}
+		for _, tt := range tests {
+			t.Run(tt.file, func(t *testing.T) {
+				t.Parallel() // safe: the fixtures are never written to
+				got, err := CountPalindromes(fixturePath(t, tt.file))
+				if err != nil {
+					t.Fatalf("CountPalindromes(%s): %v", tt.file, err)
+				}
+				if got != tt.want {
+					t.Errorf("CountPalindromes(%s) = %d; want %d", tt.file, got, tt.want)
+				}
+			})
+		}
+	})
+
+	t.Run("per-test file", func(t *testing.T) {
+		path := writeTempFile(t, "level\nrotor\nkayak\n")
+		got, err := CountPalindromes(path)
+		if err != nil {
+			t.Fatalf("CountPalindromes: %v", err)
+		}
+		if got != 3 {
+			t.Errorf("CountPalindromes = %d; want 3", got)
+		}
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		if _, err := CountPalindromes(filepath.Join(fixtureRoot, "missing.txt")); !os.IsNotExist(err) {
+			t.Errorf("CountPalindromes(missing) error = %v; want not-exist", err)
+		}
+	})
+}
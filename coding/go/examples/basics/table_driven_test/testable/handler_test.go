@@ -0,0 +1,159 @@
+// Testing HTTP Handlers - net/http/httptest
+//
+// A handler is just a function of (ResponseWriter, *Request), so it
+// can be tested without a port or a running server:
+// - httptest.NewRecorder: call ServeHTTP directly and inspect what
+//   was written. Fast, no network - use it for most handler tests.
+// - httptest.NewServer: a real server on a loopback port. Use it when
+//   the client side matters: redirects, timeouts, middleware, TLS.
+//
+// The handler lives in this file so the example stays self-contained;
+// the same tests work against the handlers in
+// networking/http_api_server.go.
+//
+// Run tests:
+//   go test -v -run 'TestPalindrome(Handler|Server)' ./testable
+package testable
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// palindromeResponse is the JSON body palindromeHandler returns
+type palindromeResponse struct {
+	Input      string `json:"input"`
+	Palindrome bool   `json:"palindrome"`
+}
+
+// palindromeHandler serves GET /palindrome?s=racecar
+func palindromeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	s := r.URL.Query().Get("s")
+	if s == "" {
+		http.Error(w, `missing query parameter "s"`, http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(palindromeResponse{Input: s, Palindrome: IsPalindrome(s)})
+}
+
+func TestPalindromeHandler(t *testing.T) {
+	tests := []struct {
+		name        string
+		method      string
+		target      string
+		wantStatus  int
+		wantHeader  map[string]string
+		wantBody    *palindromeResponse // nil: body isn't JSON
+		wantContain string
+	}{
+		{
+			name:       "palindrome",
+			method:     http.MethodGet,
+			target:     "/palindrome?s=racecar",
+			wantStatus: http.StatusOK,
+			wantHeader: map[string]string{"Content-Type": "application/json"},
+			wantBody:   &palindromeResponse{Input: "racecar", Palindrome: true},
+		},
+		{
+			name:       "not a palindrome, URL-encoded input",
+			method:     http.MethodGet,
+			target:     "/palindrome?s=hello+world",
+			wantStatus: http.StatusOK,
+			wantBody:   &palindromeResponse{Input: "hello world", Palindrome: false},
+		},
+		{
+			name:        "missing parameter",
+			method:      http.MethodGet,
+			target:      "/palindrome",
+			wantStatus:  http.StatusBadRequest,
+			wantContain: "missing query parameter",
+		},
+		{
+			name:       "wrong method",
+			method:     http.MethodPost,
+			target:     "/palindrome?s=racecar",
+			wantStatus: http.StatusMethodNotAllowed,
+			wantHeader: map[string]string{"Allow": "GET"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// NewRequest from httptest panics instead of returning an
+			// error, which is what you want in a test
+			req := httptest.NewRequest(tt.method, tt.target, nil)
+			rec := httptest.NewRecorder()
+
+			palindromeHandler(rec, req)
+
+			res := rec.Result()
+			if res.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d; want %d (body %q)", res.StatusCode, tt.wantStatus, rec.Body)
+			}
+			for k, want := range tt.wantHeader {
+				if got := res.Header.Get(k); got != want {
+					t.Errorf("header %s = %q; want %q", k, got, want)
+				}
+			}
+			if tt.wantContain != "" && !strings.Contains(rec.Body.String(), tt.wantContain) {
+				t.Errorf("body = %q; want it to contain %q", rec.Body, tt.wantContain)
+			}
+			if tt.wantBody != nil {
+				// Decode and compare structs rather than comparing raw
+				// JSON strings, which breaks on field order or spacing
+				var got palindromeResponse
+				if err := json.NewDecoder(res.Body).Decode(&got); err != nil {
+					t.Fatalf("decode body: %v", err)
+				}
+				if got != *tt.wantBody {
+					t.Errorf("body = %+v; want %+v", got, *tt.wantBody)
+				}
+			}
+		})
+	}
+}
+
+func TestPalindromeServer(t *testing.T) {
+	// Route through a real mux and a real listener, as a client would
+	mux := http.NewServeMux()
+	mux.HandleFunc("/palindrome", palindromeHandler)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	tests := []struct {
+		path       string
+		wantStatus int
+	}{
+		{"/palindrome?s=Madam", http.StatusOK},
+		{"/palindrome", http.StatusBadRequest},
+		{"/nope", http.StatusNotFound},
+	}
+
+	// srv.Client() is preconfigured for this server (and trusts its
+	// certificate when using NewTLSServer)
+	client := srv.Client()
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			res, err := client.Get(srv.URL + tt.path)
+			if err != nil {
+				t.Fatalf("GET %s: %v", tt.path, err)
+			}
+			defer res.Body.Close()
+
+			if res.StatusCode != tt.wantStatus {
+				t.Errorf("GET %s status = %d; want %d", tt.path, res.StatusCode, tt.wantStatus)
+			}
+		})
+	}
+}
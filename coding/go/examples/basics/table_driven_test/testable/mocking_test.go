@@ -0,0 +1,128 @@
+// Mocking with Interfaces - Hand-written fakes and a fake clock
+//
+// RemindOverdue depends on two small interfaces instead of calling
+// time.Now() and an email client directly. Tests substitute:
+// - fakeClock: returns whatever time the test set, so "overdue" is
+//   deterministic and no test ever sleeps
+// - recordingNotifier: remembers every call, and can be told to fail
+//   for particular recipients
+//
+// Each fake is a few lines. Because interfaces are satisfied
+// implicitly, no mock generator or framework is involved.
+//
+// Run tests:
+//   go test -v -run TestRemindOverdue ./testable
+package testable
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+// fakeClock is frozen at now until the test moves it
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time { return c.now }
+
+func (c *fakeClock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+// notification is one recorded call to Notify
+type notification struct {
+	to, msg string
+}
+
+// recordingNotifier records calls and fails for recipients in failFor
+type recordingNotifier struct {
+	calls   []notification
+	failFor map[string]error
+}
+
+func (n *recordingNotifier) Notify(to, msg string) error {
+	n.calls = append(n.calls, notification{to, msg})
+	return n.failFor[to] // nil for anyone not listed
+}
+
+// Compile-time checks that the fakes still fit the interfaces
+var (
+	_ Clock    = (*fakeClock)(nil)
+	_ Notifier = (*recordingNotifier)(nil)
+	_ Clock    = RealClock{}
+)
+
+func TestRemindOverdue(t *testing.T) {
+	start := time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)
+	tasks := []Task{
+		{Name: "deploy", Owner: "ana", Due: start.Add(-2 * time.Hour)},
+		{Name: "review", Owner: "bo", Due: start.Add(-30 * time.Minute)},
+		{Name: "report", Owner: "cy", Due: start.Add(time.Hour)},
+	}
+	errSMTP := errors.New("smtp: connection refused")
+
+	tests := []struct {
+		name      string
+		advance   time.Duration
+		failFor   map[string]error
+		wantSent  int
+		wantCalls []notification
+		wantErr   error
+	}{
+		{
+			name:     "two overdue",
+			wantSent: 2,
+			wantCalls: []notification{
+				{"ana", `"deploy" is overdue by 2h0m0s`},
+				{"bo", `"review" is overdue by 30m0s`},
+			},
+		},
+		{
+			name:     "clock moves past the last due date",
+			advance:  90 * time.Minute,
+			wantSent: 3,
+			wantCalls: []notification{
+				{"ana", `"deploy" is overdue by 3h30m0s`},
+				{"bo", `"review" is overdue by 2h0m0s`},
+				{"cy", `"report" is overdue by 30m0s`},
+			},
+		},
+		{
+			name:     "failure for one recipient doesn't stop the others",
+			failFor:  map[string]error{"ana": errSMTP},
+			wantSent: 1,
+			wantCalls: []notification{
+				{"ana", `"deploy" is overdue by 2h0m0s`},
+				{"bo", `"review" is overdue by 30m0s`},
+			},
+			wantErr: errSMTP,
+		},
+		{
+			name:    "nothing overdue yet",
+			advance: -3 * time.Hour,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clock := &fakeClock{now: start}
+			clock.Advance(tt.advance)
+			notifier := &recordingNotifier{failFor: tt.failFor}
+
+			sent, err := RemindOverdue(clock, notifier, tasks)
+
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("RemindOverdue() error = %v; want %v", err, tt.wantErr)
+			}
+			if sent != tt.wantSent {
+				t.Errorf("RemindOverdue() sent = %d; want %d", sent, tt.wantSent)
+			}
+			// Assert on the recorded calls: who was notified, with what,
+			// and in which order
+			if !slices.Equal(notifier.calls, tt.wantCalls) {
+				t.Errorf("Notify calls:\n got  %q\n want %q", notifier.calls, tt.wantCalls)
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+// Parallel Subtests - t.Parallel() in table-driven tests
+//
+// Calling t.Parallel() inside a subtest pauses it until the parent
+// test function returns, then runs all paused siblings together.
+// That one rule explains both the speedup and the classic bug:
+// a parallel subtest reads its loop variable after the loop is over.
+//
+// Run tests:
+//   go test -v -race -run 'Parallel|LoopVariable' ./testable
+package testable
+
+import (
+	"slices"
+	"sync"
+	"testing"
+)
+
+// recorder is a fixture shared by parallel subtests. Every subtest
+// writes to it at the same time, so it needs its own lock - run with
+// -race and delete the mutex to watch the detector complain.
+type recorder struct {
+	mu   sync.Mutex
+	seen []string
+}
+
+func (r *recorder) record(s string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.seen = append(r.seen, s)
+}
+
+func (r *recorder) values() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Sorted(slices.Values(r.seen))
+}
+
+var palindromeCases = []struct {
+	input    string
+	expected bool
+}{
+	{"racecar", true},
+	{"hello", false},
+	{"Never odd or even", true},
+	{"ab", false},
+}
+
+func TestIsPalindromeParallel(t *testing.T) {
+	for _, tt := range palindromeCases {
+		// Since Go 1.22 each iteration gets a fresh tt, so the closure
+		// below captures this case, not "whatever tt is when it runs".
+		// Before 1.22 you needed tt := tt here; you'll still see that
+		// line in older code and it's now harmless but redundant.
+		t.Run(tt.input, func(t *testing.T) {
+			t.Parallel() // returns immediately; the body resumes later
+
+			if got := IsPalindrome(tt.input); got != tt.expected {
+				t.Errorf("IsPalindrome(%q) = %v; want %v", tt.input, got, tt.expected)
+			}
+		})
+	}
+	// Falling off the end here is what releases the parallel subtests
+}
+
+func TestLoopVariableCapture(t *testing.T) {
+	want := []string{"Never odd or even", "ab", "hello", "racecar"}
+
+	t.Run("per-iteration variable", func(t *testing.T) {
+		rec := &recorder{}
+		// A group subtest: t.Run on it only returns after all of its
+		// parallel children finish, so rec is complete afterwards
+		t.Run("group", func(t *testing.T) {
+			for _, tt := range palindromeCases {
+				t.Run(tt.input, func(t *testing.T) {
+					t.Parallel()
+					rec.record(tt.input)
+				})
+			}
+		})
+
+		if got := rec.values(); !slices.Equal(got, want) {
+			t.Errorf("subtests saw %q; want every case once %q", got, want)
+		}
+	})
+
+	t.Run("shared variable (pre-1.22 bug)", func(t *testing.T) {
+		rec := &recorder{}
+		t.Run("group", func(t *testing.T) {
+			// One variable for the whole loop reproduces the old
+			// semantics. Every subtest pauses at t.Parallel(), the loop
+			// finishes, and only then do they all read tc - which by
+			// now holds the last case.
+			var tc struct {
+				input    string
+				expected bool
+			}
+			for i := range palindromeCases {
+				tc = palindromeCases[i]
+				t.Run(tc.input, func(t *testing.T) {
+					t.Parallel()
+					rec.record(tc.input)
+				})
+			}
+		})
+
+		last := palindromeCases[len(palindromeCases)-1].input
+		for _, got := range rec.values() {
+			if got != last {
+				t.Errorf("subtest saw %q; the bug means every subtest sees %q", got, last)
+			}
+		}
+		// Four subtests ran, four passed, and three cases were never
+		// tested. Nothing fails - that's what makes this bug nasty.
+	})
+}
@@ -0,0 +1,88 @@
+// Race Detector Tests - Making data races reproducible
+//
+// The race detector only reports races that actually happen during
+// the run, so a test has to make the conflicting accesses overlap.
+// stress starts many goroutines, holds them at a barrier, and
+// releases them together to maximize contention.
+//
+// The fixed counters pass with and without -race. The racy one is
+// skipped unless asked for, so go test -race ./... stays green:
+//   go test -race -v -run TestCounter ./testable                   # pass
+//   RACE_DEMO=1 go test -race -v -run TestRacyCounter ./testable   # "WARNING: DATA RACE"
+//
+// Without -race the racy test may still fail by losing increments,
+// but only sometimes. -race turns "sometimes" into "every time".
+package testable
+
+import (
+	"os"
+	"runtime"
+	"sync"
+	"testing"
+)
+
+// counter is what every implementation under test provides
+type counter interface {
+	Inc()
+	Value() int
+}
+
+// stress runs fn iterations times on each of goroutines goroutines,
+// all starting at the same moment
+func stress(t *testing.T, goroutines, iterations int, fn func()) {
+	t.Helper()
+	start := make(chan struct{})
+	var wg sync.WaitGroup
+	for range goroutines {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start // barrier: nobody runs until everybody is ready
+			for i := range iterations {
+				fn()
+				if i%64 == 0 {
+					runtime.Gosched() // shuffle the interleavings a bit
+				}
+			}
+		}()
+	}
+	close(start)
+	wg.Wait()
+}
+
+func TestCounter(t *testing.T) {
+	const goroutines, iterations = 16, 1000
+
+	tests := []struct {
+		name string
+		c    counter
+	}{
+		{"mutex", &MutexCounter{}},
+		{"atomic", &AtomicCounter{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stress(t, goroutines, iterations, tt.c.Inc)
+			if got, want := tt.c.Value(), goroutines*iterations; got != want {
+				t.Errorf("Value() = %d; want %d", got, want)
+			}
+		})
+	}
+}
+
+func TestRacyCounter(t *testing.T) {
+	if os.Getenv("RACE_DEMO") == "" {
+		t.Skip("deliberately racy; set RACE_DEMO=1 and run with -race to see the report")
+	}
+
+	const goroutines, iterations = 16, 1000
+	c := &RacyCounter{}
+	stress(t, goroutines, iterations, c.Inc)
+
+	// With -race the test has already failed by here, whatever the
+	// count. Without it, this catches lost updates when they happen.
+	if got, want := c.Value(), goroutines*iterations; got != want {
+		t.Errorf("Value() = %d; want %d (lost %d increments)", got, want, want-got)
+	}
+}
@@ -0,0 +1,148 @@
+// Table-Driven Tests - The Go testing idiom
+//
+// Each test is a slice of cases and one loop that runs them as
+// subtests. These tests live in package testable itself, so they
+// could reach unexported identifiers too; example_test.go shows the
+// external, package testable_test view.
+//
+// Run tests:
+//   go test -v ./testable
+//   go test -run 'TestDivide/division_by_zero' -v ./testable
+package testable
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestAdd(t *testing.T) {
+	// Table of test cases
+	tests := []struct {
+		name     string // Test case name
+		a, b     int    // Inputs
+		expected int    // Expected output
+	}{
+		{"positive numbers", 2, 3, 5},
+		{"negative numbers", -2, -3, -5},
+		{"mixed signs", -2, 3, 1},
+		{"with zero", 5, 0, 5},
+		{"both zero", 0, 0, 0},
+		{"large numbers", 1000000, 2000000, 3000000},
+	}
+	
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := Add(tt.a, tt.b)
+			if result != tt.expected {
+				t.Errorf("Add(%d, %d) = %d; want %d",
+					tt.a, tt.b, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestDivide(t *testing.T) {
+	tests := []struct {
+		name      string
+		a, b      float64
+		expected  float64
+		wantError bool
+	}{
+		{"simple division", 10, 2, 5, false},
+		{"division with decimals", 7, 2, 3.5, false},
+		{"division by zero", 10, 0, 0, true},
+		{"zero dividend", 0, 5, 0, false},
+		{"negative numbers", -10, 2, -5, false},
+		{"both negative", -10, -2, 5, false},
+	}
+	
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := Divide(tt.a, tt.b)
+			
+			if tt.wantError {
+				if err == nil {
+					t.Errorf("Divide(%v, %v) expected error, got nil",
+						tt.a, tt.b)
+				}
+				return
+			}
+			
+			if err != nil {
+				t.Errorf("Divide(%v, %v) unexpected error: %v",
+					tt.a, tt.b, err)
+				return
+			}
+			
+			if result != tt.expected {
+				t.Errorf("Divide(%v, %v) = %v; want %v",
+					tt.a, tt.b, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestIsPalindrome(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected bool
+	}{
+		{"racecar", true},
+		{"hello", false},
+		{"A man a plan a canal Panama", true},
+		{"Was it a car or a cat I saw", true},
+		{"", true},
+		{"a", true},
+		{"ab", false},
+		{"Madam", true},
+		{"Never odd or even", true},
+	}
+	
+	for _, tt := range tests {
+		// Use input as test name (truncated if too long)
+		name := tt.input
+		if len(name) > 20 {
+			name = name[:20] + "..."
+		}
+		if name == "" {
+			name = "empty string"
+		}
+		
+		t.Run(name, func(t *testing.T) {
+			result := IsPalindrome(tt.input)
+			if result != tt.expected {
+				t.Errorf("IsPalindrome(%q) = %v; want %v",
+					tt.input, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestFizzBuzz(t *testing.T) {
+	tests := []struct {
+		n        int
+		expected string
+	}{
+		{1, "1"},
+		{2, "2"},
+		{3, "Fizz"},
+		{4, "4"},
+		{5, "Buzz"},
+		{6, "Fizz"},
+		{10, "Buzz"},
+		{15, "FizzBuzz"},
+		{30, "FizzBuzz"},
+		{45, "FizzBuzz"},
+		{7, "7"},
+	}
+	
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("n=%d", tt.n), func(t *testing.T) {
+			result := FizzBuzz(tt.n)
+			if result != tt.expected {
+				t.Errorf("FizzBuzz(%d) = %q; want %q",
+					tt.n, result, tt.expected)
+			}
+		})
+	}
+}
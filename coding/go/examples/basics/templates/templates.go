@@ -0,0 +1,422 @@
+// Templates - text/template for reports, html/template for pages
+//
+// The two packages share a syntax and an API and differ in one thing:
+// html/template knows it is writing HTML. It reads the page as it
+// executes, and escapes each value for where it lands: element text,
+// an attribute, a URL, JavaScript, CSS. text/template writes values as
+// they are, which is right for a console report and an injection hole
+// in a web page.
+//
+// This example renders one service status report both ways:
+//   - Parsing: template.Must for templates known at compile time,
+//     errors with line numbers, missingkey=error, and executing into
+//     a buffer so a failure halfway doesn't send half a page
+//   - FuncMap: functions registered before Parse, pipelines, and a
+//     function returning an error to stop execution
+//   - range/with/else, $ and variables, {{- -}} trimming, and the
+//     sub-template that can only see the dot it's given
+//   - Nested templates: define and template for parts, block for a
+//     layout's overridable sections, and Clone to make each page from
+//     one parsed layout
+//   - Escaping: the same template text, with hostile data, through
+//     both packages; what each context does; template.HTML and the
+//     hole it opens when used on input
+//   - A handler serving the pages, rendered to a buffer first
+//
+// networking/file_server.go renders its directory listings the same
+// way; this is the long form of what it does.
+//
+// Usage:
+//   go run templates.go               # console report, escaping, pages
+//   go run templates.go -serve :8080  # serve the pages
+//
+// Run tests:
+//   go test -v templates.go templates_test.go
+//   go test -run=^$ -bench=. -benchmem templates.go templates_test.go
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// ============================================================
+// Data
+// ============================================================
+
+type Report struct {
+	Env       string
+	Generated time.Time
+	Services  []Service
+}
+
+type Service struct {
+	Name      string
+	Owner     string // free text, from the service catalogue
+	URL       string // status page, from the service catalogue
+	Uptime    float64
+	P99       time.Duration
+	Incidents []Incident
+}
+
+// Healthy is a method the templates call like a field
+func (s Service) Healthy() bool {
+	return s.Uptime >= 0.999 && s.P99 < 500*time.Millisecond
+}
+
+type Incident struct {
+	Title    string // free text, typed by whoever opened it
+	Severity int
+	Opened   time.Time
+	Resolved *time.Time // nil while open
+}
+
+func sampleReport() Report {
+	now := time.Date(2026, 10, 16, 14, 30, 0, 0, time.UTC)
+	resolved := now.Add(-3 * time.Hour)
+	return Report{
+		Env:       "production",
+		Generated: now,
+		Services: []Service{
+			{Name: "checkout", Owner: "payments", URL: "https://status.example.com/checkout",
+				Uptime: 0.9993, P99: 212 * time.Millisecond},
+			{Name: "search", Owner: `"><img src=x onerror=alert(1)>`, URL: "javascript:alert(document.cookie)",
+				Uptime: 0.9871, P99: 1340 * time.Millisecond,
+				Incidents: []Incident{
+					{Title: `Index lag <script>alert("pwned")</script>`, Severity: 2, Opened: now.Add(-95 * time.Minute)},
+					{Title: "Shard 4 & 5 rebalancing", Severity: 3, Opened: now.Add(-26 * time.Hour), Resolved: &resolved},
+				}},
+			{Name: "auth", Owner: "identity", URL: "https://status.example.com/auth",
+				Uptime: 1, P99: 48 * time.Millisecond},
+		},
+	}
+}
+
+// ============================================================
+// 1. Functions
+// ============================================================
+
+// funcs is shared by both packages: a FuncMap is a map[string]any in
+// each, and the two convert. Functions must be added before Parse,
+// which checks every name it sees
+var funcs = map[string]any{
+	"upper": strings.ToUpper,
+	"pad": func(width int, s string) string {
+		return fmt.Sprintf("%-*s", width, s)
+	},
+	"pct": func(f float64) (string, error) {
+		// A second, error, result stops execution with that error
+		if f < 0 || f > 1 {
+			return "", fmt.Errorf("pct: %v is not a fraction", f)
+		}
+		return fmt.Sprintf("%.2f%%", f*100), nil
+	},
+	"ms": func(d time.Duration) string {
+		return fmt.Sprintf("%dms", d.Milliseconds())
+	},
+	"ago": func(t, now time.Time) string {
+		return strings.TrimSuffix(now.Sub(t).Round(time.Minute).String(), "0s")
+	},
+	"sev": func(n int) string {
+		return fmt.Sprintf("SEV%d", n)
+	},
+	// dict builds a map from pairs, so one template can hand another
+	// more than one value: {{template "x" dict "A" .a "B" .b}}
+	"dict": func(kv ...any) (map[string]any, error) {
+		if len(kv)%2 != 0 {
+			return nil, errors.New("dict: odd number of arguments")
+		}
+		m := make(map[string]any, len(kv)/2)
+		for i := 0; i < len(kv); i += 2 {
+			k, ok := kv[i].(string)
+			if !ok {
+				return nil, fmt.Errorf("dict: key %v is not a string", kv[i])
+			}
+			m[k] = kv[i+1]
+		}
+		return m, nil
+	},
+}
+
+// ============================================================
+// 2. A console report with text/template
+// ============================================================
+
+// The report is three templates in one source: define names each.
+// incident is handed a dict, because inside a template $ is the data
+// that template was executed with, not the report: the incident alone
+// can't know the report's time
+const reportSrc = `
+{{- define "report" -}}
+Status of {{upper .Env}} at {{.Generated.Format "15:04 MST"}}
+{{range .Services}}{{template "service" dict "S" . "Now" $.Generated}}
+{{- else}}  (no services)
+{{end -}}
+{{len .Services}} services, {{with unhealthy .Services}}{{len .}} unhealthy{{else}}all healthy{{end}}
+{{end}}
+
+{{- define "service" -}}
+{{with .S -}}
+  {{pad 10 .Name}} {{if .Healthy}}ok  {{else}}FAIL{{end}}  up {{pct .Uptime | printf "%7s"}}  p99 {{ms .P99 | printf "%6s"}}
+{{- end}}
+{{range .S.Incidents}}    {{template "incident" dict "I" . "Now" $.Now}}
+{{end -}}
+{{end}}
+
+{{- define "incident" -}}
+{{sev .I.Severity}} {{.I.Title}} - {{with .I.Resolved}}resolved{{else}}open {{ago .I.Opened .Now}}{{end}}
+{{- end}}`
+
+var reportTmpl = template.Must(template.New("report").
+	Funcs(funcs).
+	Funcs(template.FuncMap{"unhealthy": unhealthy}).
+	Option("missingkey=error").
+	Parse(reportSrc))
+
+func unhealthy(ss []Service) []Service {
+	var out []Service
+	for _, s := range ss {
+		if !s.Healthy() {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// ============================================================
+// 3. Pages with html/template: a layout and its blocks
+// ============================================================
+
+// layoutSrc is the frame every page shares. Each block is a define
+// with a default body, executed in place; a page replaces the body by
+// defining a template of the same name
+const layoutSrc = `<!doctype html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>{{block "title" .}}Status{{end}} - {{.Env}}</title>
+</head>
+<body>
+<header><a href="/">{{.Env}}</a> at {{.Generated.Format "15:04 MST"}}</header>
+<main>
+{{block "content" .}}<p>Nothing here.</p>{{end}}
+</main>
+{{/* A Go value in a script is written as a JavaScript literal, JSON
+     with </script> and the like escaped. A JavaScript comment here
+     would be stripped: html/template removes comments it parses */ -}}
+<script>const services = {{names .Services}};</script>
+</body>
+</html>
+`
+
+const indexSrc = `
+{{- define "title"}}All services{{end}}
+{{- define "content" -}}
+<table>
+<tr><th>Service</th><th>Owner</th><th>Uptime</th><th>p99</th></tr>
+{{- range .Services}}
+<tr class="{{if .Healthy}}ok{{else}}fail{{end}}">
+  <td><a href="/services/{{.Name}}">{{.Name}}</a></td>
+  <td title="{{.Owner}}">{{.Owner}}</td>
+  <td><span class="bar" style="width: {{pct .Uptime}}">{{pct .Uptime}}</span></td>
+  <td>{{ms .P99}}</td>
+</tr>
+{{- end}}
+</table>
+{{end}}`
+
+const serviceSrc = `
+{{- define "title"}}{{.Service.Name}}{{end}}
+{{- define "content" -}}
+{{with .Service -}}
+<h1>{{.Name}}</h1>
+<p><a href="{{.URL}}">Status page</a>, owned by {{.Owner}}</p>
+{{range .Incidents -}}
+<article>
+  <h2>{{sev .Severity}}: {{.Title}}</h2>
+  <p>{{with .Resolved}}Resolved {{.Format "15:04"}}{{else}}Open since {{.Opened.Format "15:04"}}{{end}}</p>
+</article>
+{{else -}}
+<p>No incidents.</p>
+{{end -}}
+{{end -}}
+{{end}}`
+
+var (
+	layout = htmltemplate.Must(htmltemplate.New("layout").
+		Funcs(funcs).
+		Funcs(htmltemplate.FuncMap{"names": names}).
+		Parse(layoutSrc))
+	// Each page is a Clone of the layout with its own blocks parsed
+	// in. Without Clone, the second page's "content" would replace the
+	// first's in the one shared set
+	indexPage   = page(indexSrc)
+	servicePage = page(serviceSrc)
+)
+
+func page(src string) *htmltemplate.Template {
+	return htmltemplate.Must(htmltemplate.Must(layout.Clone()).Parse(src))
+}
+
+func names(ss []Service) []string {
+	var out []string
+	for _, s := range ss {
+		out = append(out, s.Name)
+	}
+	return out
+}
+
+// servicePageData is what servicePage runs with: the layout needs the
+// report's fields, the content needs the one service
+type servicePageData struct {
+	Report
+	Service Service
+}
+
+// ============================================================
+// 4. The handler
+// ============================================================
+
+// render executes t into a buffer, and only writes it if it all
+// worked. Executing straight into w would send the page up to the
+// error, with a 200 status already gone
+func render(w http.ResponseWriter, t *htmltemplate.Template, data any) {
+	var buf bytes.Buffer
+	if err := t.ExecuteTemplate(&buf, "layout", data); err != nil {
+		log.Printf("render %s: %v", t.Name(), err)
+		http.Error(w, "template error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(buf.Bytes())
+}
+
+func handler(report func() Report) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		render(w, indexPage, report())
+	})
+	mux.HandleFunc("GET /services/{name}", func(w http.ResponseWriter, r *http.Request) {
+		rep := report()
+		for _, s := range rep.Services {
+			if s.Name == r.PathValue("name") {
+				render(w, servicePage, servicePageData{rep, s})
+				return
+			}
+		}
+		http.NotFound(w, r)
+	})
+	return mux
+}
+
+// ============================================================
+// 5. Escaping, side by side
+// ============================================================
+
+// snippetSrc puts values in five contexts: element text, a quoted
+// attribute, a URL, a script and a style attribute
+const snippetSrc = `<p title="{{.Owner}}">{{.Title}}</p>
+<a href="{{.URL}}">status</a>
+<script>var title = {{.Title}};</script>
+<div style="color: {{.Color}}"></div>`
+
+type snippetData struct{ Owner, Title, URL, Color string }
+
+var hostileSnippet = snippetData{
+	Owner: `"><img src=x onerror=alert(1)>`,
+	Title: `</script><script>alert("pwned")</script>`,
+	URL:   "javascript:alert(document.cookie)",
+	Color: "red; background: url(https://evil.example/x)",
+}
+
+// highlightUnsafe marks up a search term in s by wrapping it in <b>,
+// and returns template.HTML so the tags survive. But s is input: its
+// own tags survive too
+func highlightUnsafe(s, term string) htmltemplate.HTML {
+	return htmltemplate.HTML(strings.ReplaceAll(s, term, "<b>"+term+"</b>"))
+}
+
+// highlight escapes s first, so the only markup is the markup added
+// here. template.HTML is a promise that the string is safe; the code
+// that makes it has to keep the promise
+func highlight(s, term string) htmltemplate.HTML {
+	esc, escTerm := htmltemplate.HTMLEscapeString(s), htmltemplate.HTMLEscapeString(term)
+	return htmltemplate.HTML(strings.ReplaceAll(esc, escTerm, "<b>"+escTerm+"</b>"))
+}
+
+// ============================================================
+// main
+// ============================================================
+
+func main() {
+	serve := flag.String("serve", "", "serve the pages on this `address` instead of printing")
+	flag.Parse()
+	if *serve != "" {
+		log.Printf("serving on http://%s/", *serve)
+		log.Fatal(http.ListenAndServe(*serve, handler(sampleReport)))
+	}
+
+	fmt.Println("=== 1. Console report (text/template) ===")
+	if err := reportTmpl.ExecuteTemplate(os.Stdout, "report", sampleReport()); err != nil {
+		fmt.Println("error:", err)
+	}
+
+	fmt.Println()
+	fmt.Println("=== 2. Errors: at parse time, and at execution ===")
+	_, err := template.New("bad").Parse("line 1\n{{if .X}}\nno end")
+	fmt.Printf("  unclosed if:        %v\n", err)
+	_, err = template.New("bad").Parse("{{nosuchfunc .}}")
+	fmt.Printf("  unknown function:   %v\n", err)
+	bad := sampleReport()
+	bad.Services[0].Uptime = 1.5
+	err = reportTmpl.ExecuteTemplate(io.Discard, "report", bad)
+	fmt.Printf("  function's error:   %v\n", err)
+	m := template.Must(template.New("m").Option("missingkey=error").Parse("{{.colour}}"))
+	err = m.Execute(io.Discard, map[string]string{"color": "red"})
+	fmt.Printf("  missingkey=error:   %v\n", err)
+	err = template.Must(template.New("m").Parse("{{.colour}}")).Execute(os.Stdout, map[string]string{"color": "red"})
+	fmt.Printf("   <- the default: a missing key prints that, err %v\n", err)
+
+	fmt.Println()
+	fmt.Println("=== 3. The same template, hostile data ===")
+	fmt.Println("--- text/template:")
+	template.Must(template.New("s").Parse(snippetSrc)).Execute(os.Stdout, hostileSnippet)
+	fmt.Println()
+	fmt.Println("--- html/template:")
+	htmltemplate.Must(htmltemplate.New("s").Parse(snippetSrc)).Execute(os.Stdout, hostileSnippet)
+	fmt.Println()
+	fmt.Println("--- template.HTML, made from input:")
+	h := htmltemplate.Must(htmltemplate.New("h").Parse("<li>{{.}}</li>\n"))
+	input := `red <img src=x onerror=alert(1)> shoes`
+	h.Execute(os.Stdout, highlightUnsafe(input, "red"))
+	h.Execute(os.Stdout, highlight(input, "red"))
+
+	fmt.Println()
+	fmt.Println("=== 4. Pages from a layout, served ===")
+	ts := httptest.NewServer(handler(sampleReport))
+	defer ts.Close()
+	for _, path := range []string{"/", "/services/search", "/services/nope"} {
+		resp, err := http.Get(ts.URL + path)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		fmt.Printf("--- GET %s: %s, %s\n", path, resp.Status, resp.Header.Get("Content-Type"))
+		if path == "/services/search" {
+			fmt.Print(string(body))
+		}
+	}
+}
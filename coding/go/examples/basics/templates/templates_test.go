@@ -0,0 +1,293 @@
+// Testing Templates - Hostile data in, nothing executable out
+//
+// Templates fail at run time, on data the author didn't try. The tests
+// render every page with the sample report, whose catalogue entries and
+// incident titles are attacks, and check that none survives
+// html/template. They also pin the behaviour a refactor could lose:
+// the layout shared by every page, a 500 instead of half a page.
+//
+// Run tests:
+//   go test -v templates.go templates_test.go
+//   go test -run=^$ -bench=. -benchmem templates.go templates_test.go
+package main
+
+import (
+	"bytes"
+	htmltemplate "html/template"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"text/template"
+	"time"
+)
+
+func TestFuncs(t *testing.T) {
+	call := func(src string, data any) (string, error) {
+		tm, err := template.New("t").Funcs(funcs).Parse(src)
+		if err != nil {
+			return "", err
+		}
+		var b strings.Builder
+		err = tm.Execute(&b, data)
+		return b.String(), err
+	}
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		src     string
+		data    any
+		want    string
+		wantErr string
+	}{
+		{`{{pct .}}`, 0.99931, "99.93%", ""},
+		{`{{pct .}}`, 1.0, "100.00%", ""},
+		{`{{pct .}}`, -0.1, "", "not a fraction"},
+		{`{{ms .}}`, 1500 * time.Microsecond, "1ms", ""},
+		{`[{{pad 5 .}}]`, "ab", "[ab   ]", ""},
+		{`[{{pad 2 .}}]`, "abcd", "[abcd]", ""}, // never truncates
+		{`{{sev .}}`, 1, "SEV1", ""},
+		{`{{with dict "a" 1 "b" "x"}}{{.a}}{{.b}}{{end}}`, nil, "1x", ""},
+		{`{{dict "a"}}`, nil, "", "odd number"},
+		{`{{dict 1 2}}`, nil, "", "key 1 is not a string"},
+		{`{{. | upper | printf "%q"}}`, "go", `"GO"`, ""},
+	}
+	for _, tt := range tests {
+		got, err := call(tt.src, tt.data)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s with %v: err %v, want %q", tt.src, tt.data, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("%s with %v = %q, %v; want %q", tt.src, tt.data, got, err, tt.want)
+		}
+	}
+	// ago's result is a duration, without the trailing 0s
+	if got, _ := call(`{{ago .A .B}}`, map[string]time.Time{"A": now, "B": now.Add(95 * time.Minute)}); got != "1h35m" {
+		t.Errorf("ago = %q, want 1h35m", got)
+	}
+}
+
+func TestConsoleReport(t *testing.T) {
+	var b strings.Builder
+	if err := reportTmpl.ExecuteTemplate(&b, "report", sampleReport()); err != nil {
+		t.Fatal(err)
+	}
+	want := `Status of PRODUCTION at 14:30 UTC
+checkout   ok    up  99.93%  p99  212ms
+search     FAIL  up  98.71%  p99 1340ms
+    SEV2 Index lag <script>alert("pwned")</script> - open 1h35m
+    SEV3 Shard 4 & 5 rebalancing - resolved
+auth       ok    up 100.00%  p99   48ms
+3 services, 1 unhealthy
+`
+	if got := b.String(); got != want {
+		t.Errorf("report:\n%s\nwant:\n%s", got, want)
+	}
+
+	b.Reset()
+	if err := reportTmpl.ExecuteTemplate(&b, "report", Report{Env: "dev"}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), "(no services)\n0 services, all healthy") {
+		t.Errorf("empty report:\n%s", b.String())
+	}
+}
+
+func TestExecutionErrors(t *testing.T) {
+	bad := sampleReport()
+	bad.Services[2].Uptime = 2
+	var b strings.Builder
+	err := reportTmpl.ExecuteTemplate(&b, "report", bad)
+	if err == nil || !strings.Contains(err.Error(), "2 is not a fraction") {
+		t.Errorf("err = %v", err)
+	}
+	// Execution stops at the error, with the output so far written
+	if !strings.Contains(b.String(), "checkout") || strings.Contains(b.String(), "services,") {
+		t.Errorf("output before the error:\n%s", b.String())
+	}
+}
+
+// attacks are the strings in the sample report that must never reach
+// a page as they are
+var attacks = []string{
+	`<script>alert("pwned")`,
+	`<img src=x onerror`,
+	`javascript:alert`,
+}
+
+func get(t *testing.T, h http.Handler, path string) *httptest.ResponseRecorder {
+	t.Helper()
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+	return w
+}
+
+func TestPages(t *testing.T) {
+	h := handler(sampleReport)
+	tests := []struct {
+		path     string
+		status   int
+		title    string
+		contains []string
+	}{
+		{"/", 200, "<title>All services - production</title>", []string{
+			`<tr class="fail">`, `href="/services/search"`, `style="width: 98.71%"`,
+		}},
+		{"/services/search", 200, "<title>search - production</title>", []string{
+			`<a href="#ZgotmplZ">`, "Shard 4 &amp; 5", "Open since 12:55", "Resolved 11:30",
+		}},
+		{"/services/auth", 200, "<title>auth - production</title>", []string{
+			`<a href="https://status.example.com/auth">`, "<p>No incidents.</p>",
+		}},
+		{"/services/nope", 404, "", nil},
+		{"/nope", 404, "", nil},
+	}
+	for _, tt := range tests {
+		w := get(t, h, tt.path)
+		body := w.Body.String()
+		if w.Code != tt.status {
+			t.Errorf("GET %s: %d, want %d", tt.path, w.Code, tt.status)
+			continue
+		}
+		if tt.status != 200 {
+			continue
+		}
+		// Every page is the layout with its own blocks
+		for _, want := range append([]string{tt.title, `<header><a href="/">production</a>`,
+			`const services = ["checkout","search","auth"];`}, tt.contains...) {
+			if !strings.Contains(body, want) {
+				t.Errorf("GET %s lacks %q", tt.path, want)
+			}
+		}
+		for _, a := range attacks {
+			if strings.Contains(body, a) {
+				t.Errorf("GET %s contains %q unescaped", tt.path, a)
+			}
+		}
+		if ct := w.Header().Get("Content-Type"); ct != "text/html; charset=utf-8" {
+			t.Errorf("GET %s: Content-Type %q", tt.path, ct)
+		}
+	}
+}
+
+// TestPagesIndependent checks Clone kept the pages apart: parsing the
+// service page's content must not have replaced the index page's
+func TestPagesIndependent(t *testing.T) {
+	var b bytes.Buffer
+	if err := indexPage.ExecuteTemplate(&b, "layout", sampleReport()); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), "<table>") || strings.Contains(b.String(), "<h1>") {
+		t.Error("index page renders the service page's content")
+	}
+	b.Reset()
+	if err := layout.ExecuteTemplate(&b, "layout", sampleReport()); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(b.String(), "<p>Nothing here.</p>") || !strings.Contains(b.String(), "<title>Status - ") {
+		t.Error("the layout's own blocks were overwritten")
+	}
+}
+
+func TestRenderError(t *testing.T) {
+	defer log.SetOutput(log.Writer())
+	log.SetOutput(io.Discard)
+	bad := func() Report {
+		r := sampleReport()
+		r.Services[2].Uptime = -1 // the last row fails
+		return r
+	}
+	w := get(t, handler(bad), "/")
+	if w.Code != http.StatusInternalServerError {
+		t.Errorf("status %d, want 500", w.Code)
+	}
+	if strings.Contains(w.Body.String(), "<table>") {
+		t.Errorf("half a page was sent:\n%s", w.Body.String())
+	}
+}
+
+func TestEscapingContexts(t *testing.T) {
+	var text, html strings.Builder
+	template.Must(template.New("s").Parse(snippetSrc)).Execute(&text, hostileSnippet)
+	htmltemplate.Must(htmltemplate.New("s").Parse(snippetSrc)).Execute(&html, hostileSnippet)
+
+	// text/template passes every attack through: that's the point of
+	// showing it
+	for _, a := range []string{`<img src=x onerror`, `href="javascript:`, `</script><script>`, `url(https://evil`} {
+		if !strings.Contains(text.String(), a) {
+			t.Errorf("text/template output lacks %q", a)
+		}
+	}
+	for _, want := range []string{
+		`title="&#34;&gt;&lt;img`,          // attribute: quotes and brackets escaped
+		`<a href="#ZgotmplZ">`,             // URL: unsafe scheme replaced
+		`var title = "\u003c/script\u003e`, // script: a JS string, </script> escaped
+		`style="color: ZgotmplZ"`,          // CSS: not a plain value, replaced
+	} {
+		if !strings.Contains(html.String(), want) {
+			t.Errorf("html/template output lacks %q:\n%s", want, html.String())
+		}
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	h := htmltemplate.Must(htmltemplate.New("h").Parse("{{.}}"))
+	input := `red <img src=x onerror=alert(1)> & "red"`
+	var b strings.Builder
+	h.Execute(&b, highlight(input, "red"))
+	want := `<b>red</b> &lt;img src=x onerror=alert(1)&gt; &amp; &#34;<b>red</b>&#34;`
+	if b.String() != want {
+		t.Errorf("highlight = %s\nwant        %s", b.String(), want)
+	}
+	b.Reset()
+	h.Execute(&b, highlightUnsafe(input, "red"))
+	if !strings.Contains(b.String(), "<img src=x onerror") {
+		t.Error("highlightUnsafe is no longer unsafe: the example's point is gone")
+	}
+}
+
+// ============================================================
+// Benchmarks
+// ============================================================
+
+// BenchmarkExecute is the same page through both packages. The
+// escaping is worked out once, at the first Execute, so each run only
+// pays for escaping the values
+func BenchmarkExecute(b *testing.B) {
+	data := sampleReport()
+	textPage := template.Must(template.Must(template.New("layout").Funcs(funcs).
+		Funcs(template.FuncMap{"names": names}).Parse(layoutSrc)).Parse(indexSrc))
+	b.Run("text", func(b *testing.B) {
+		for b.Loop() {
+			textPage.ExecuteTemplate(io.Discard, "layout", data)
+		}
+	})
+	b.Run("html", func(b *testing.B) {
+		for b.Loop() {
+			indexPage.ExecuteTemplate(io.Discard, "layout", data)
+		}
+	})
+}
+
+// BenchmarkParse is the cost of parsing the page on every request
+// instead of once at startup
+func BenchmarkParse(b *testing.B) {
+	data := sampleReport()
+	b.Run("once", func(b *testing.B) {
+		for b.Loop() {
+			indexPage.ExecuteTemplate(io.Discard, "layout", data)
+		}
+	})
+	b.Run("per-request", func(b *testing.B) {
+		for b.Loop() {
+			l := htmltemplate.Must(htmltemplate.New("layout").Funcs(funcs).
+				Funcs(htmltemplate.FuncMap{"names": names}).Parse(layoutSrc))
+			p := htmltemplate.Must(l.Parse(indexSrc))
+			p.ExecuteTemplate(io.Discard, "layout", data)
+		}
+	})
+}
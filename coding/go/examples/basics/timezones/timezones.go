@@ -0,0 +1,451 @@
+// Time and Timezones - Layouts, DST, the monotonic clock and timers
+//
+// Most time bugs in Go services come from a handful of facts: a layout
+// is a reference date, not a pattern language; a time without a zone
+// is UTC; a day in a zone with DST isn't always 24 hours; time.Now
+// carries a second clock that == compares; and Truncate works on
+// absolute time, not on the clock on the wall. Each section here shows
+// one of them going wrong and the way to write it instead.
+//
+// This example demonstrates:
+//   - time.Parse layouts from the reference time, ParseInLocation for
+//     timestamps without an offset, and the zone-abbreviation trap
+//   - Loading locations, wall-clock times that don't exist or exist
+//     twice around a DST change, and what time.Date does with them
+//   - AddDate against Add(24 * time.Hour), a daily schedule that
+//     survives DST, and counting calendar days
+//   - The monotonic clock reading: what uses it, what strips it, and
+//     why == on times is a bug
+//   - Tickers and timers: stopping them, Reset, dropped ticks, and a
+//     debouncer built on AfterFunc
+//   - Truncate and Round on times and durations, and the start of a
+//     local day
+//
+// Locations come from the system's zoneinfo. A binary that must run
+// where there is none (scratch containers, some Windows hosts) imports
+// time/tzdata to embed the database, about 450KB.
+//
+// Usage:
+//   go run timezones.go
+//
+// Run tests:
+//   go test -v timezones.go timezones_test.go
+//   go test -run=^$ -bench=. -benchmem timezones.go timezones_test.go
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+)
+
+// ============================================================
+// 1. Parsing and layouts
+// ============================================================
+
+// A layout is the reference time, Mon Jan 2 15:04:05 MST 2006, written
+// the way the input writes it: 01 is the month, 02 the day, 15 the hour
+// on a 24-hour clock and 03 on a 12-hour one. Anything else in the
+// layout is matched literally, so "YYYY-MM-DD" parses nothing
+
+// timestampLayouts are the formats parseTimestamp accepts, most
+// common first. The last two have no offset, so they are read in the
+// location the caller says they were written in
+var timestampLayouts = []string{
+	time.RFC3339, // fractional seconds are accepted too
+	"02/Jan/2006:15:04:05 -0700",
+	time.DateTime,
+	time.DateOnly,
+}
+
+var ErrBadTimestamp = errors.New("unrecognised timestamp")
+
+// parseTimestamp parses s in any of timestampLayouts. A timestamp
+// without an offset is taken to be in loc: time.Parse would say UTC,
+// which is only right if the writer was in UTC
+func parseTimestamp(s string, loc *time.Location) (time.Time, error) {
+	for _, layout := range timestampLayouts {
+		if t, err := time.ParseInLocation(layout, s, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("%w: %q", ErrBadTimestamp, s)
+}
+
+// ============================================================
+// 2. Locations and DST
+// ============================================================
+
+// mustLoad loads a location by its IANA name. Names, not abbreviations:
+// "EST" is a fixed offset that never observes DST, and "IST" is three
+// different zones
+func mustLoad(name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		panic(err)
+	}
+	return loc
+}
+
+// resolve returns the instants at which clocks in loc read the given
+// date and time. Normally there is one. In the hour skipped when clocks
+// go forward there are none, and in the hour repeated when they go
+// back there are two, earliest first. time.Date returns one instant in
+// every case, and doesn't say which case it was in.
+//
+// It assumes at most one change of offset within 12 hours either side,
+// which holds for every zone in use
+func resolve(loc *time.Location, year int, month time.Month, day, hour, min int) []time.Time {
+	wall := time.Date(year, month, day, hour, min, 0, 0, time.UTC)
+	near := time.Date(year, month, day, hour, min, 0, 0, loc)
+	var ts []time.Time
+	for _, d := range []time.Duration{-12 * time.Hour, 12 * time.Hour} {
+		_, offset := near.Add(d).Zone()
+		t := wall.Add(-time.Duration(offset) * time.Second).In(loc)
+		if sameWall(t, wall) && !slices.ContainsFunc(ts, t.Equal) {
+			ts = append(ts, t)
+		}
+	}
+	slices.SortFunc(ts, time.Time.Compare)
+	return ts
+}
+
+// sameWall reports whether t's clock in its own location reads the
+// same as wall's in UTC
+func sameWall(t, wall time.Time) bool {
+	y, mo, d := t.Date()
+	h, mi, s := t.Clock()
+	return time.Date(y, mo, d, h, mi, s, t.Nanosecond(), time.UTC).Equal(wall)
+}
+
+// at is the instant a job scheduled for the given local time runs. In
+// a repeated hour it runs the first time round, and in a skipped hour
+// it runs as the clocks jump, at the time they would have read had
+// they not: 02:30 becomes 03:30. time.Date, for New York, goes back to
+// 01:30 instead, which is before the run that was due earlier
+func at(loc *time.Location, year int, month time.Month, day, hour, min int) time.Time {
+	if ts := resolve(loc, year, month, day, hour, min); len(ts) > 0 {
+		return ts[0]
+	}
+	// In the gap: the wall time with the offset from before the change
+	near := time.Date(year, month, day, hour, min, 0, 0, loc)
+	_, before := near.Add(-12 * time.Hour).Zone()
+	return time.Date(year, month, day, hour, min, 0, 0, time.UTC).
+		Add(-time.Duration(before) * time.Second).In(loc)
+}
+
+// nextDaily returns the first run of a daily job at hour:min in loc
+// strictly after after. It steps by calendar day, never by 24 hours:
+// across a DST change 24 hours from 09:00 is 08:00 or 10:00
+func nextDaily(after time.Time, loc *time.Location, hour, min int) time.Time {
+	y, m, d := after.In(loc).Date()
+	for {
+		if t := at(loc, y, m, d, hour, min); t.After(after) {
+			return t
+		}
+		// time.Date normalises the 32nd of a month to the 1st of the next
+		d++
+	}
+}
+
+// daysBetween counts calendar days from a's date to b's, each in its
+// own location. Dividing b.Sub(a) by 24 hours is off by one whenever
+// the range crosses a 23-hour day
+func daysBetween(a, b time.Time) int {
+	ay, am, ad := a.Date()
+	by, bm, bd := b.Date()
+	// In UTC every day is 24 hours, so the division is exact
+	da := time.Date(ay, am, ad, 0, 0, 0, 0, time.UTC)
+	db := time.Date(by, bm, bd, 0, 0, 0, 0, time.UTC)
+	return int(db.Sub(da) / (24 * time.Hour))
+}
+
+// ============================================================
+// 3. The monotonic clock
+// ============================================================
+
+// time.Now reads two clocks: the wall clock, which NTP and people can
+// set backwards, and a monotonic clock, which only goes forward. Sub,
+// Since, Until, Before and After use the monotonic readings when both
+// times have one, so a measurement can't come out negative when the
+// wall clock is stepped. Anything that changes how the wall time is
+// read - UTC, In, Local, Round, Truncate - drops the reading, and so
+// does serialising. And == compares it, along with the location: use
+// Equal to compare instants
+
+// measure times fn the right way: both ends straight from time.Now
+func measure(fn func()) time.Duration {
+	start := time.Now()
+	fn()
+	return time.Since(start)
+}
+
+// hasMonotonic reports whether t carries a monotonic clock reading.
+// Round(0) strips it and nothing else, so the two differ under ==
+func hasMonotonic(t time.Time) bool {
+	return t != t.Round(0)
+}
+
+// instantKey is a map key for the instant t. Times as keys compare
+// with ==, so the same instant with a different location or a
+// monotonic reading is a different key. UTC drops both
+func instantKey(t time.Time) time.Time {
+	return t.UTC()
+}
+
+// ============================================================
+// 4. Tickers and timers
+// ============================================================
+
+// Since Go 1.23 a timer or ticker nobody refers to is garbage
+// collected even if it wasn't stopped, and Stop and Reset guarantee no
+// stale value is received afterwards, so the old drain-the-channel
+// dance is gone. Stop still matters: a ticker in a goroutine that
+// lives on keeps firing until stopped, and defer t.Stop() says when it
+// is done
+
+// poll calls fn every interval until ctx is done. A ticker's channel
+// holds one tick: if fn takes longer than interval, the ticks in
+// between are dropped, not queued, so poll never runs to catch up
+func poll(ctx context.Context, interval time.Duration, fn func(time.Time)) error {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case now := <-t.C:
+			// When ctx is done and a tick is waiting too, select picks
+			// either: without this check a slow fn runs again, and
+			// again, half the time
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			fn(now)
+		}
+	}
+}
+
+// collect receives from events until none has arrived for idle, or
+// the channel is closed. One timer is Reset per event: time.After in
+// the select would make a new timer every time round the loop
+func collect(events <-chan string, idle time.Duration) []string {
+	var got []string
+	t := time.NewTimer(idle)
+	defer t.Stop()
+	for {
+		select {
+		case e, ok := <-events:
+			if !ok {
+				return got
+			}
+			got = append(got, e)
+			t.Reset(idle)
+		case <-t.C:
+			return got
+		}
+	}
+}
+
+// debouncer runs fn once things have been quiet for wait: a burst of
+// Triggers runs it once, wait after the last. Typical for reloading a
+// config file that an editor writes in several steps
+type debouncer struct {
+	mu    sync.Mutex
+	wait  time.Duration
+	fn    func()
+	timer *time.Timer
+}
+
+func newDebouncer(wait time.Duration, fn func()) *debouncer {
+	return &debouncer{wait: wait, fn: fn}
+}
+
+// Trigger starts the wait, or starts it again
+func (d *debouncer) Trigger() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.timer == nil {
+		// AfterFunc runs fn in its own goroutine, with no channel to read
+		d.timer = time.AfterFunc(d.wait, d.fn)
+		return
+	}
+	// Reset on an AfterFunc timer that has already fired schedules fn
+	// again, which is what a Trigger after the run should do
+	d.timer.Reset(d.wait)
+}
+
+// Stop cancels a pending run. It reports whether there was one
+func (d *debouncer) Stop() bool {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.timer != nil && d.timer.Stop()
+}
+
+// ============================================================
+// 5. Truncating and rounding
+// ============================================================
+
+// Time.Truncate and Round work on the time since the zero time, as
+// if in UTC. Truncating to an hour is the local hour only where the
+// offset is a whole number of hours, and truncating to 24 hours is
+// midnight UTC, shown in whatever location t has. For windows of
+// absolute time - metrics buckets - that's what's wanted; for local
+// days, use startOfDay
+
+// startOfDay is midnight at the start of t's day in t's location. On
+// the few days a zone changes offset at midnight, that midnight
+// doesn't exist, and time.Date moves it to the first instant that does
+func startOfDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, t.Location())
+}
+
+// bucket is the start of the window of the given size t falls into,
+// counted in absolute time, so every host puts an instant in the same
+// bucket whatever its zone
+func bucket(t time.Time, size time.Duration) time.Time {
+	return t.Truncate(size)
+}
+
+// ============================================================
+// main
+// ============================================================
+
+func main() {
+	ny := mustLoad("America/New_York")
+	kolkata := mustLoad("Asia/Kolkata")
+
+	fmt.Println("=== 1. Parsing and layouts ===")
+	for _, s := range []string{
+		"2026-10-16T14:30:00.25+02:00",
+		"16/Oct/2026:14:30:00 -0700",
+		"2026-10-16 14:30:00",
+		"2026-10-16",
+		"10/16/2026",
+	} {
+		t, err := parseTimestamp(s, ny)
+		if err != nil {
+			fmt.Printf("  %-30s %v\n", s, err)
+			continue
+		}
+		fmt.Printf("  %-30s %s = %s\n", s, t.Format(time.RFC3339Nano), t.UTC().Format(time.RFC3339Nano))
+	}
+	for _, c := range []struct{ layout, input string }{
+		{"2006-02-01", "2026-10-16"},                          // month and day swapped
+		{"2006-01-02 03:04", "2026-10-16 14:30"},              // 12-hour clock
+		{"YYYY-MM-DD", "2026-10-16"},                          // not a layout
+		{"2006-01-02T15:04:05Z", "2026-10-16T14:30:00+02:00"}, // literal Z
+	} {
+		_, err := time.Parse(c.layout, c.input)
+		fmt.Printf("  Parse(%q): %v\n", c.layout, err)
+	}
+	// A literal Z in a layout used to format prints Z whatever the zone
+	noon := time.Date(2026, 10, 16, 12, 0, 0, 0, ny)
+	fmt.Printf("  noon in New York as \"...05Z\": %s (a lie), as RFC3339: %s\n",
+		noon.Format("2006-01-02T15:04:05Z"), noon.Format(time.RFC3339))
+	// An abbreviation the local zone doesn't use parses as offset 0,
+	// with the name kept: it looks right and is hours out. Where the
+	// local zone is New York, the same input is -0500
+	est, _ := time.Parse("2006-01-02 15:04 MST", "2026-10-16 12:00 EST")
+	fmt.Printf("  \"12:00 EST\" parsed here: %s, which is %s\n", est, est.UTC())
+
+	fmt.Println()
+	fmt.Println("=== 2. Locations and DST ===")
+	for _, c := range []struct {
+		what      string
+		m         time.Month
+		day, hour int
+	}{
+		{"spring forward, 02:30", time.March, 8, 2},
+		{"fall back, 01:30", time.November, 1, 1},
+		{"ordinary day, 01:30", time.October, 16, 1},
+	} {
+		ts := resolve(ny, 2026, c.m, c.day, c.hour, 30)
+		fmt.Printf("  %-22s %d instant(s) %v\n", c.what+":", len(ts), ts)
+		fmt.Printf("  %-22s time.Date: %s, at: %s\n", "",
+			time.Date(2026, c.m, c.day, c.hour, 30, 0, 0, ny), at(ny, 2026, c.m, c.day, c.hour, 30))
+	}
+	sat := time.Date(2026, 3, 7, 9, 0, 0, 0, ny)
+	fmt.Printf("  Sat 09:00 + 24h:        %s\n", sat.Add(24*time.Hour).Format("Mon 15:04 MST"))
+	fmt.Printf("  Sat 09:00 + AddDate(1): %s\n", sat.AddDate(0, 0, 1).Format("Mon 15:04 MST"))
+	run := time.Date(2026, 3, 6, 12, 0, 0, 0, ny)
+	fmt.Print("  daily 02:30 job:")
+	for range 4 {
+		run = nextDaily(run, ny, 2, 30)
+		fmt.Print("  ", run.Format("Jan 2 15:04 MST"))
+	}
+	fmt.Println()
+	a, b := time.Date(2026, 3, 7, 0, 0, 0, 0, ny), time.Date(2026, 3, 9, 0, 0, 0, 0, ny)
+	fmt.Printf("  Mar 7 to Mar 9: Sub/24h says %d, daysBetween says %d\n",
+		int(b.Sub(a)/(24*time.Hour)), daysBetween(a, b))
+
+	fmt.Println()
+	fmt.Println("=== 3. The monotonic clock ===")
+	now := time.Now()
+	fmt.Printf("  time.Now():  %s\n", now)
+	fmt.Printf("  has a monotonic reading: Now %v, UTC() %v, Round(0) %v, Add(1s) %v\n",
+		hasMonotonic(now), hasMonotonic(now.UTC()), hasMonotonic(now.Round(0)), hasMonotonic(now.Add(time.Second)))
+	data, _ := json.Marshal(now)
+	var decoded time.Time
+	json.Unmarshal(data, &decoded)
+	fmt.Printf("  after a JSON round trip: == %v, Equal %v\n", decoded == now, decoded.Equal(now))
+	seen := map[time.Time]bool{now: true, instantKey(now): true}
+	fmt.Printf("  map keys: now and now.UTC() are %d keys; by instantKey: %v\n",
+		len(seen), instantKey(decoded) == instantKey(now.In(ny)))
+	fmt.Printf("  measure(sleep 20ms): %v\n", measure(func() { time.Sleep(20 * time.Millisecond) }).Round(time.Millisecond))
+
+	fmt.Println()
+	fmt.Println("=== 4. Tickers and timers ===")
+	ctx, cancel := context.WithTimeout(context.Background(), 210*time.Millisecond)
+	var fast, slow int
+	poll(ctx, 20*time.Millisecond, func(time.Time) { fast++ })
+	cancel()
+	ctx, cancel = context.WithTimeout(context.Background(), 210*time.Millisecond)
+	poll(ctx, 20*time.Millisecond, func(time.Time) { slow++; time.Sleep(50 * time.Millisecond) })
+	cancel()
+	fmt.Printf("  20ms ticker for 210ms: %d calls, or %d when each call takes 50ms\n", fast, slow)
+
+	events := make(chan string)
+	go func() {
+		for _, e := range []string{"a", "b", "c"} {
+			events <- e
+			time.Sleep(10 * time.Millisecond)
+		}
+		time.Sleep(100 * time.Millisecond)
+		events <- "late"
+	}()
+	fmt.Printf("  collect with 50ms idle: %q\n", collect(events, 50*time.Millisecond))
+	<-events // the late one, so the goroutine ends
+
+	var mu sync.Mutex
+	runs := 0
+	d := newDebouncer(30*time.Millisecond, func() { mu.Lock(); runs++; mu.Unlock() })
+	for range 5 {
+		d.Trigger()
+		time.Sleep(5 * time.Millisecond)
+	}
+	time.Sleep(60 * time.Millisecond)
+	mu.Lock()
+	fmt.Printf("  5 triggers 5ms apart, debounced at 30ms: %d run(s)\n", runs)
+	mu.Unlock()
+
+	fmt.Println()
+	fmt.Println("=== 5. Truncating and rounding ===")
+	t := time.Date(2026, 10, 16, 10, 45, 30, 500_000_000, kolkata)
+	fmt.Printf("  %s in Kolkata (+05:30)\n", t.Format("15:04:05.0"))
+	fmt.Printf("  Truncate(time.Hour):     %s\n", t.Truncate(time.Hour).Format("Jan 2 15:04"))
+	fmt.Printf("  Truncate(24*time.Hour):  %s\n", t.Truncate(24*time.Hour).Format("Jan 2 15:04"))
+	fmt.Printf("  startOfDay:              %s\n", startOfDay(t).Format("Jan 2 15:04"))
+	fmt.Printf("  Round(time.Second):      %s (halves round away from zero)\n", t.Round(time.Second).Format("15:04:05"))
+	fmt.Printf("  bucket(5m): %s, the same instant as %s\n",
+		bucket(t, 5*time.Minute).Format("15:04"), bucket(t.UTC(), 5*time.Minute).Format("15:04 UTC"))
+	for _, dur := range []time.Duration{1234567 * time.Microsecond, -1500 * time.Microsecond, 90 * time.Minute} {
+		fmt.Printf("  %-12v Round(ms) %-8v Truncate(s) %-8v Round(h) %v\n",
+			dur, dur.Round(time.Millisecond), dur.Truncate(time.Second), dur.Round(time.Hour))
+	}
+}
@@ -0,0 +1,452 @@
+// Testing Time and Timezones - Fixed dates, real zones, loose clocks
+//
+// The DST tests use fixed dates in real zones: New York, with the
+// usual hour, and Lord Howe Island, whose clocks move by 30 minutes.
+// Nothing here reads the local zone, so the tests pass on a machine
+// set to any of them. The timer tests measure real time and allow it
+// to run late - CI machines are slow - but never early.
+//
+// Run tests:
+//   go test -v timezones.go timezones_test.go
+//   go test -run=^$ -bench=. -benchmem timezones.go timezones_test.go
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+var (
+	newYork  = mustLoad("America/New_York")
+	lordHowe = mustLoad("Australia/Lord_Howe")
+	kolkata  = mustLoad("Asia/Kolkata")
+)
+
+func TestParseTimestamp(t *testing.T) {
+	tests := []struct {
+		in   string
+		want time.Time
+	}{
+		{"2026-10-16T14:30:00Z", time.Date(2026, 10, 16, 14, 30, 0, 0, time.UTC)},
+		{"2026-10-16T14:30:00.25+02:00", time.Date(2026, 10, 16, 12, 30, 0, 250e6, time.UTC)},
+		{"16/Oct/2026:14:30:00 -0700", time.Date(2026, 10, 16, 21, 30, 0, 0, time.UTC)},
+		// No offset: in New York, not UTC
+		{"2026-10-16 14:30:00", time.Date(2026, 10, 16, 18, 30, 0, 0, time.UTC)},
+		{"2026-01-16 14:30:00", time.Date(2026, 1, 16, 19, 30, 0, 0, time.UTC)},
+		{"2026-10-16", time.Date(2026, 10, 16, 4, 0, 0, 0, time.UTC)},
+	}
+	for _, tt := range tests {
+		got, err := parseTimestamp(tt.in, newYork)
+		if err != nil || !got.Equal(tt.want) {
+			t.Errorf("parseTimestamp(%q) = %v, %v; want %v", tt.in, got, err, tt.want)
+		}
+	}
+	for _, in := range []string{"", "10/16/2026", "2026-10-16T14:30", "2026-13-01", "2026-02-30", "2026-10-16 25:00:00"} {
+		if _, err := parseTimestamp(in, newYork); !errors.Is(err, ErrBadTimestamp) {
+			t.Errorf("parseTimestamp(%q) err %v, want ErrBadTimestamp", in, err)
+		}
+	}
+}
+
+// TestAbbreviation pins the trap: an abbreviation that isn't the
+// local zone's is kept as a name, at offset 0
+func TestAbbreviation(t *testing.T) {
+	got, err := time.ParseInLocation("2006-01-02 15:04 MST", "2026-10-16 12:00 IST", newYork)
+	if err != nil {
+		t.Fatal(err)
+	}
+	name, offset := got.Zone()
+	if name != "IST" || offset != 0 {
+		t.Errorf("zone %s%+d, want IST+0", name, offset)
+	}
+	// A name the location does use gets its offset
+	got, _ = time.ParseInLocation("2006-01-02 15:04 MST", "2026-01-16 12:00 EST", newYork)
+	if _, offset := got.Zone(); offset != -5*3600 {
+		t.Errorf("EST in New York: offset %d", offset)
+	}
+}
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		name      string
+		loc       *time.Location
+		m         time.Month
+		day, h, i int
+		want      []string // UTC, earliest first
+	}{
+		{"NY ordinary", newYork, time.October, 16, 9, 0, []string{"13:00"}},
+		{"NY gap", newYork, time.March, 8, 2, 30, nil},
+		{"NY gap edge", newYork, time.March, 8, 3, 0, []string{"07:00"}},
+		{"NY before gap", newYork, time.March, 8, 1, 59, []string{"06:59"}},
+		{"NY overlap", newYork, time.November, 1, 1, 30, []string{"05:30", "06:30"}},
+		{"NY after overlap", newYork, time.November, 1, 2, 0, []string{"07:00"}},
+		{"Lord Howe gap", lordHowe, time.October, 4, 2, 15, nil},
+		{"Lord Howe overlap", lordHowe, time.April, 5, 1, 45, []string{"14:45", "15:15"}},
+		{"Kolkata", kolkata, time.March, 8, 2, 30, []string{"21:00"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, ts := range resolve(tt.loc, 2026, tt.m, tt.day, tt.h, tt.i) {
+				got = append(got, ts.UTC().Format("15:04"))
+				if h, m, _ := ts.Clock(); h != tt.h || m != tt.i {
+					t.Errorf("%v reads %02d:%02d", ts, h, m)
+				}
+			}
+			if len(got) != len(tt.want) || len(got) > 0 && (got[0] != tt.want[0] || got[len(got)-1] != tt.want[len(tt.want)-1]) {
+				t.Errorf("resolve = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAt(t *testing.T) {
+	tests := []struct {
+		loc       *time.Location
+		m         time.Month
+		day, h, i int
+		want      string
+	}{
+		{newYork, time.March, 8, 2, 30, "2026-03-08T03:30:00-04:00"},    // gap: as the clocks jump
+		{newYork, time.November, 1, 1, 30, "2026-11-01T01:30:00-04:00"}, // overlap: first time round
+		{lordHowe, time.October, 4, 2, 15, "2026-10-04T02:45:00+11:00"},
+	}
+	for _, tt := range tests {
+		if got := at(tt.loc, 2026, tt.m, tt.day, tt.h, tt.i).Format(time.RFC3339); got != tt.want {
+			t.Errorf("at(%s, %v %d %02d:%02d) = %s, want %s", tt.loc, tt.m, tt.day, tt.h, tt.i, got, tt.want)
+		}
+	}
+}
+
+func TestNextDaily(t *testing.T) {
+	tests := []struct {
+		name  string
+		after time.Time
+		h, m  int
+		want  []string
+	}{
+		{"across spring forward", time.Date(2026, 3, 6, 12, 0, 0, 0, newYork), 2, 30,
+			[]string{"Mar 7 02:30 EST", "Mar 8 03:30 EDT", "Mar 9 02:30 EDT"}},
+		{"across fall back, once", time.Date(2026, 10, 31, 12, 0, 0, 0, newYork), 1, 30,
+			[]string{"Nov 1 01:30 EDT", "Nov 2 01:30 EST"}},
+		{"same wall time every day", time.Date(2026, 3, 7, 10, 0, 0, 0, newYork), 9, 0,
+			[]string{"Mar 8 09:00 EDT", "Mar 9 09:00 EDT"}},
+		{"later today", time.Date(2026, 10, 16, 8, 0, 0, 0, newYork), 9, 0,
+			[]string{"Oct 16 09:00 EDT"}},
+		{"exactly now is not after", time.Date(2026, 10, 16, 9, 0, 0, 0, newYork), 9, 0,
+			[]string{"Oct 17 09:00 EDT"}},
+		{"end of month", time.Date(2026, 10, 31, 10, 0, 0, 0, newYork), 9, 0,
+			[]string{"Nov 1 09:00 EST"}},
+		// after in another zone: it's already Oct 17 in New York's terms
+		{"after in UTC", time.Date(2026, 10, 17, 3, 0, 0, 0, time.UTC), 22, 0,
+			[]string{"Oct 17 22:00 EDT"}},
+	}
+	for _, tt := range tests {
+		run := tt.after
+		for i, want := range tt.want {
+			run = nextDaily(run, newYork, tt.h, tt.m)
+			if got := run.Format("Jan 2 15:04 MST"); got != want {
+				t.Errorf("%s: run %d = %s, want %s", tt.name, i, got, want)
+				break
+			}
+		}
+	}
+}
+
+func TestDaysBetween(t *testing.T) {
+	day := func(loc *time.Location, m time.Month, d, h int) time.Time {
+		return time.Date(2026, m, d, h, 0, 0, 0, loc)
+	}
+	tests := []struct {
+		a, b time.Time
+		want int
+	}{
+		{day(newYork, time.March, 7, 0), day(newYork, time.March, 9, 0), 2},       // 47 hours
+		{day(newYork, time.October, 31, 0), day(newYork, time.November, 2, 0), 2}, // 49 hours
+		{day(newYork, time.March, 9, 0), day(newYork, time.March, 7, 0), -2},
+		{day(newYork, time.October, 16, 23), day(newYork, time.October, 17, 1), 1},
+		{day(newYork, time.October, 16, 1), day(newYork, time.October, 16, 23), 0},
+		{day(time.UTC, time.December, 31, 0), day(time.UTC, time.January, 1, 0).AddDate(1, 0, 0), 1},
+		// Each date in its own zone: 23:00 in New York is already the
+		// next day in UTC
+		{day(newYork, time.October, 16, 23), day(newYork, time.October, 16, 23).UTC(), 1},
+	}
+	for _, tt := range tests {
+		if got := daysBetween(tt.a, tt.b); got != tt.want {
+			t.Errorf("daysBetween(%v, %v) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestMonotonic(t *testing.T) {
+	now := time.Now()
+	tests := []struct {
+		name string
+		t    time.Time
+		want bool
+	}{
+		{"Now", now, true},
+		{"Add", now.Add(time.Hour), true},
+		{"AddDate", now.AddDate(0, 0, 1), false}, // goes through time.Date
+		{"UTC", now.UTC(), false},
+		{"In", now.In(newYork), false},
+		{"Round(0)", now.Round(0), false},
+		{"Truncate", now.Truncate(time.Second), false},
+		{"Date", time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), false},
+	}
+	for _, tt := range tests {
+		if got := hasMonotonic(tt.t); got != tt.want {
+			t.Errorf("%s: hasMonotonic = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	data, err := json.Marshal(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded time.Time
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded == now || !decoded.Equal(now) {
+		t.Errorf("JSON round trip: == %v, Equal %v", decoded == now, decoded.Equal(now))
+	}
+	keys := map[time.Time]int{}
+	for _, v := range []time.Time{now, now.In(newYork), now.UTC(), decoded} {
+		keys[instantKey(v)]++
+	}
+	if len(keys) != 1 {
+		t.Errorf("instantKey gave %d keys for one instant", len(keys))
+	}
+
+	if d := measure(func() { time.Sleep(10 * time.Millisecond) }); d < 10*time.Millisecond {
+		t.Errorf("measure = %v, want at least 10ms", d)
+	}
+}
+
+func TestPoll(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 105*time.Millisecond)
+	defer cancel()
+	var calls []time.Time
+	err := poll(ctx, 10*time.Millisecond, func(now time.Time) { calls = append(calls, now) })
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("err %v", err)
+	}
+	// Ticks can be late or dropped, never early, so at most 10
+	if len(calls) == 0 || len(calls) > 10 {
+		t.Errorf("%d calls in 105ms at 10ms", len(calls))
+	}
+	for i := 1; i < len(calls); i++ {
+		if d := calls[i].Sub(calls[i-1]); d < 9*time.Millisecond {
+			t.Errorf("ticks %d and %d %v apart", i-1, i, d)
+		}
+	}
+
+	// A slow fn: the ticks it misses are dropped, not queued up, and
+	// none is taken once ctx is done. Calls start at 5, 35, 65 and 95ms
+	ctx, cancel = context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	slow := 0
+	poll(ctx, 5*time.Millisecond, func(time.Time) { slow++; time.Sleep(30 * time.Millisecond) })
+	if slow > 4 {
+		t.Errorf("slow fn called %d times in 100ms", slow)
+	}
+}
+
+func TestCollect(t *testing.T) {
+	events := make(chan string)
+	go func() {
+		for _, e := range []string{"a", "b", "c"} {
+			events <- e
+		}
+		close(events)
+	}()
+	if got := collect(events, time.Second); len(got) != 3 {
+		t.Errorf("closed channel: %q", got)
+	}
+
+	start := time.Now()
+	if got := collect(make(chan string), 20*time.Millisecond); len(got) != 0 {
+		t.Errorf("nothing sent: %q", got)
+	}
+	if d := time.Since(start); d < 20*time.Millisecond {
+		t.Errorf("returned after %v, before the idle timeout", d)
+	}
+}
+
+func TestDebouncer(t *testing.T) {
+	var runs atomic.Int32
+	d := newDebouncer(20*time.Millisecond, func() { runs.Add(1) })
+	start := time.Now()
+	for range 5 {
+		d.Trigger()
+		time.Sleep(2 * time.Millisecond)
+	}
+	for runs.Load() == 0 && time.Since(start) < time.Second {
+		time.Sleep(time.Millisecond)
+	}
+	// The wait starts again at each Trigger: the run is 20ms after the last
+	if d := time.Since(start); d < 28*time.Millisecond {
+		t.Errorf("ran after %v, before the burst had been quiet for 20ms", d)
+	}
+	time.Sleep(40 * time.Millisecond)
+	if n := runs.Load(); n != 1 {
+		t.Errorf("burst ran fn %d times, want 1", n)
+	}
+
+	// After a run, a Trigger schedules another; Stop cancels it
+	d.Trigger()
+	if !d.Stop() {
+		t.Error("Stop found nothing pending")
+	}
+	time.Sleep(40 * time.Millisecond)
+	if n := runs.Load(); n != 1 {
+		t.Errorf("stopped trigger ran: %d runs", n)
+	}
+	if d.Stop() || newDebouncer(time.Second, nil).Stop() {
+		t.Error("Stop with nothing pending reported true")
+	}
+}
+
+func TestTruncate(t *testing.T) {
+	tests := []struct {
+		name string
+		got  time.Time
+		want string
+	}{
+		{"Truncate hour, Kolkata", time.Date(2026, 10, 16, 10, 45, 0, 0, kolkata).Truncate(time.Hour), "10:30"},
+		{"Truncate day, Kolkata", time.Date(2026, 10, 16, 10, 45, 0, 0, kolkata).Truncate(24 * time.Hour), "05:30"},
+		{"Truncate hour, New York", time.Date(2026, 10, 16, 10, 45, 0, 0, newYork).Truncate(time.Hour), "10:00"},
+		{"startOfDay, Kolkata", startOfDay(time.Date(2026, 10, 16, 3, 0, 0, 0, kolkata)), "Oct 16 00:00"},
+		{"startOfDay, spring forward", startOfDay(time.Date(2026, 3, 8, 12, 0, 0, 0, newYork)), "Mar 8 00:00"},
+		{"Round half", time.Date(2026, 1, 1, 0, 0, 0, 500e6, time.UTC).Round(time.Second), "00:00:01"},
+	}
+	for _, tt := range tests {
+		layout := "15:04"
+		switch {
+		case len(tt.want) > 8:
+			layout = "Jan 2 15:04"
+		case len(tt.want) == 8:
+			layout = time.TimeOnly
+		}
+		if got := tt.got.Format(layout); got != tt.want {
+			t.Errorf("%s = %s, want %s", tt.name, got, tt.want)
+		}
+	}
+
+	// A day in the spring-forward week that starts at midnight is 23
+	// hours long
+	sod := startOfDay(time.Date(2026, 3, 8, 12, 0, 0, 0, newYork))
+	if d := startOfDay(sod.AddDate(0, 0, 1)).Sub(sod); d != 23*time.Hour {
+		t.Errorf("Mar 8 in New York is %v long", d)
+	}
+
+	// bucket counts in absolute time: the same instant, the same bucket,
+	// whatever the zone
+	in := time.Date(2026, 10, 16, 10, 47, 0, 0, kolkata)
+	for _, loc := range []*time.Location{time.UTC, newYork, kolkata, lordHowe} {
+		if b := bucket(in.In(loc), 5*time.Minute); !b.Equal(time.Date(2026, 10, 16, 5, 15, 0, 0, time.UTC)) {
+			t.Errorf("bucket in %s = %v", loc, b.UTC())
+		}
+	}
+}
+
+func TestDurationRounding(t *testing.T) {
+	tests := []struct {
+		got, want time.Duration
+	}{
+		{(1234567 * time.Microsecond).Round(time.Millisecond), 1235 * time.Millisecond},
+		{(1500 * time.Microsecond).Round(time.Millisecond), 2 * time.Millisecond},
+		{(-1500 * time.Microsecond).Round(time.Millisecond), -2 * time.Millisecond}, // away from zero
+		{(-1500 * time.Microsecond).Truncate(time.Millisecond), -time.Millisecond},  // towards zero
+		{(90 * time.Minute).Round(time.Hour), 2 * time.Hour},
+		{(89 * time.Minute).Truncate(time.Hour), time.Hour},
+		{time.Hour.Round(0), time.Hour},
+	}
+	for i, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("case %d: %v, want %v", i, tt.got, tt.want)
+		}
+	}
+}
+
+// ============================================================
+// Benchmarks
+// ============================================================
+
+var (
+	sinkTime time.Time
+	sinkDur  time.Duration
+)
+
+// BenchmarkParse is a timestamp in the first layout parseTimestamp
+// tries, and in the last: each miss costs a failed parse and the
+// error it allocates
+func BenchmarkParse(b *testing.B) {
+	b.Run("Parse", func(b *testing.B) {
+		for b.Loop() {
+			sinkTime, _ = time.Parse(time.RFC3339, "2026-10-16T14:30:00Z")
+		}
+	})
+	b.Run("first-layout", func(b *testing.B) {
+		for b.Loop() {
+			sinkTime, _ = parseTimestamp("2026-10-16T14:30:00Z", newYork)
+		}
+	})
+	b.Run("last-layout", func(b *testing.B) {
+		for b.Loop() {
+			sinkTime, _ = parseTimestamp("2026-10-16", newYork)
+		}
+	})
+}
+
+// BenchmarkNow is the cost of reading the clocks, and of converting to
+// a location, which looks up the zone's offset at that instant
+func BenchmarkNow(b *testing.B) {
+	b.Run("Now", func(b *testing.B) {
+		for b.Loop() {
+			sinkTime = time.Now()
+		}
+	})
+	b.Run("Since", func(b *testing.B) {
+		start := time.Now()
+		for b.Loop() {
+			sinkDur = time.Since(start)
+		}
+	})
+	b.Run("Now.In", func(b *testing.B) {
+		for b.Loop() {
+			sinkTime = time.Now().In(newYork)
+		}
+	})
+}
+
+// BenchmarkTimer is a select with a timeout, run in a loop: a new timer
+// from time.After each time round, or one timer Reset
+func BenchmarkTimer(b *testing.B) {
+	ready := make(chan struct{})
+	close(ready)
+	b.Run("time.After", func(b *testing.B) {
+		for b.Loop() {
+			select {
+			case <-ready:
+			case <-time.After(time.Minute):
+			}
+		}
+	})
+	b.Run("Reset", func(b *testing.B) {
+		t := time.NewTimer(time.Minute)
+		defer t.Stop()
+		for b.Loop() {
+			t.Reset(time.Minute)
+			select {
+			case <-ready:
+			case <-t.C:
+			}
+		}
+	})
+}
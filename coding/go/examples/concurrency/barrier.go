@@ -0,0 +1,294 @@
+// Barrier - Phased execution where nobody starts phase n+1 early
+//
+// Some parallel work comes in rounds: every worker computes its part of
+// step n from the state at step n-1, and none may start step n+1 until
+// all have finished step n, or it reads a neighbour's half-written
+// cells. sync.WaitGroup waits for goroutines to finish; a barrier is
+// for goroutines that keep going, meeting at the end of every phase.
+//
+// Two cyclic (reusable) barriers:
+// - Barrier, on sync.Cond. The last goroutine to arrive starts a new
+//   generation and broadcasts; the others sleep until the generation
+//   they arrived in is over. Checking the generation rather than a
+//   count is what makes reuse safe: a fast goroutine can arrive at the
+//   next phase before a slow one has woken from this one
+// - ChanBarrier, on a channel closed to release each phase and then
+//   replaced. A channel can sit in a select, so Wait takes a context;
+//   a sync.Cond can't be waited on with a timeout at all
+//
+// Both take an action that the last arrival runs before releasing the
+// rest: the place for "swap the buffers" or "check convergence", which
+// must happen exactly once per phase, between phases.
+//
+// The demo is 1D heat diffusion split across workers, each owning a
+// strip of cells and reading its neighbours' edges, checked against a
+// sequential run.
+//
+// Usage:
+//   go run barrier.go
+//   go test -race -v barrier.go barrier_test.go
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ============================================================
+// Barrier on sync.Cond
+// ============================================================
+
+type Barrier struct {
+	parties int
+	action  func()
+
+	mu         sync.Mutex
+	cond       *sync.Cond
+	arrived    int
+	generation uint64
+}
+
+// NewBarrier returns a barrier for parties goroutines. action, if not
+// nil, runs once per phase in the last goroutine to arrive, before any
+// is released
+func NewBarrier(parties int, action func()) *Barrier {
+	if parties < 1 {
+		panic("barrier: parties must be at least 1")
+	}
+	b := &Barrier{parties: parties, action: action}
+	b.cond = sync.NewCond(&b.mu)
+	return b
+}
+
+// Wait blocks until all parties have called it for this phase. It
+// reports true to exactly one of them, the last to arrive, which is
+// also the one that ran the action
+func (b *Barrier) Wait() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	gen := b.generation
+	b.arrived++
+	if b.arrived == b.parties {
+		if b.action != nil {
+			b.action()
+		}
+		b.arrived = 0
+		b.generation++
+		b.cond.Broadcast()
+		return true
+	}
+	// Not `for b.arrived > 0`: by the time this goroutine wakes, the
+	// next phase may already have arrivals
+	for gen == b.generation {
+		b.cond.Wait()
+	}
+	return false
+}
+
+// ============================================================
+// Barrier on a channel
+// ============================================================
+
+type ChanBarrier struct {
+	parties int
+	action  func()
+
+	mu      sync.Mutex
+	arrived int
+	release chan struct{} // closed when this phase completes
+}
+
+func NewChanBarrier(parties int, action func()) *ChanBarrier {
+	if parties < 1 {
+		panic("barrier: parties must be at least 1")
+	}
+	return &ChanBarrier{parties: parties, action: action, release: make(chan struct{})}
+}
+
+// Wait is Barrier.Wait that gives up when ctx is done. A goroutine that
+// gives up takes back its arrival, so the phase still needs a full set;
+// if the phase completed as it gave up, it counts as having made it
+func (b *ChanBarrier) Wait(ctx context.Context) (bool, error) {
+	b.mu.Lock()
+	b.arrived++
+	if b.arrived == b.parties {
+		if b.action != nil {
+			b.action()
+		}
+		b.arrived = 0
+		close(b.release)
+		b.release = make(chan struct{})
+		b.mu.Unlock()
+		return true, nil
+	}
+	release := b.release
+	b.mu.Unlock()
+
+	select {
+	case <-release:
+		return false, nil
+	case <-ctx.Done():
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		select {
+		case <-release: // lost the race to the last arrival: we made it
+			return false, nil
+		default:
+			b.arrived--
+			return false, ctx.Err()
+		}
+	}
+}
+
+// ============================================================
+// Demo: heat diffusion in strips
+// ============================================================
+
+// step computes cells [lo, hi) of next from cur. The ends of the rod
+// are held at fixed temperatures
+func step(cur, next []float64, lo, hi int) {
+	for i := lo; i < hi; i++ {
+		if i == 0 || i == len(cur)-1 {
+			next[i] = cur[i]
+			continue
+		}
+		next[i] = cur[i] + 0.25*(cur[i-1]-2*cur[i]+cur[i+1])
+	}
+}
+
+func newRod(n int) []float64 {
+	rod := make([]float64, n)
+	rod[0], rod[n-1] = 100, 0
+	rod[n/2] = 300 // a hot spot in the middle
+	return rod
+}
+
+func sequential(n, steps int) []float64 {
+	cur, next := newRod(n), make([]float64, n)
+	for range steps {
+		step(cur, next, 0, n)
+		cur, next = next, cur
+	}
+	return cur
+}
+
+// parallel runs the same simulation with one goroutine per strip.
+// Workers read cur and write their strip of next; the barrier's action
+// swaps the two, once, while every worker is stopped at the barrier.
+// newWait builds either barrier around that action and returns its
+// Wait. snap, if set, sees cur every k steps
+func parallel(n, steps, workers int, newWait func(action func()) func(), snap func(step int, cur []float64), k int) []float64 {
+	cur, next := newRod(n), make([]float64, n)
+	done := 0
+	wait := newWait(func() {
+		cur, next = next, cur
+		done++
+		if snap != nil && done%k == 0 {
+			snap(done, cur)
+		}
+	})
+	var wg sync.WaitGroup
+	for w := range workers {
+		lo, hi := w*n/workers, (w+1)*n/workers
+		wg.Go(func() {
+			for range steps {
+				// cur and next are read here and written only by the
+				// action, which runs while every worker is parked
+				step(cur, next, lo, hi)
+				wait()
+			}
+		})
+	}
+	wg.Wait()
+	return cur
+}
+
+func condWait(parties int) func(action func()) func() {
+	return func(action func()) func() {
+		b := NewBarrier(parties, action)
+		return func() { b.Wait() }
+	}
+}
+
+func chanWait(parties int) func(action func()) func() {
+	return func(action func()) func() {
+		b := NewChanBarrier(parties, action)
+		return func() { b.Wait(context.Background()) }
+	}
+}
+
+// heat draws a rod as a row of shades
+func heat(cur []float64) string {
+	const shades = " .:-=+*#%@"
+	var sb strings.Builder
+	for _, t := range cur {
+		i := int(t / 100 * float64(len(shades)-1))
+		sb.WriteByte(shades[min(max(i, 0), len(shades)-1)])
+	}
+	return sb.String()
+}
+
+func main() {
+	const n, steps, workers = 64, 400, 4
+
+	fmt.Printf("=== %d cells, %d steps, %d workers of %d cells each ===\n", n, steps, workers, n/workers)
+	got := parallel(n, steps, workers, condWait(workers), func(s int, cur []float64) {
+		fmt.Printf("  step %3d |%s|\n", s, heat(cur))
+	}, 50)
+	want := sequential(n, steps)
+	fmt.Printf("  sync.Cond barrier matches sequential: %v\n", slices.Equal(got, want))
+	got = parallel(n, steps, workers, chanWait(workers), nil, 0)
+	fmt.Printf("  channel barrier matches sequential:   %v\n", slices.Equal(got, want))
+
+	fmt.Println("\n=== Phase trace: 3 workers, random work, 3 phases ===")
+	var mu sync.Mutex
+	var trace []string
+	log := func(s string) {
+		mu.Lock()
+		trace = append(trace, s)
+		mu.Unlock()
+	}
+	phase := 1
+	b := NewBarrier(3, func() {
+		log(fmt.Sprintf("--- phase %d complete ---", phase))
+		phase++
+	})
+	var wg sync.WaitGroup
+	for w := range 3 {
+		wg.Go(func() {
+			rng := rand.New(rand.NewSource(int64(w)))
+			for p := 1; p <= 3; p++ {
+				time.Sleep(time.Duration(rng.Intn(20)) * time.Millisecond)
+				log(fmt.Sprintf("worker %d finished phase %d", w, p))
+				if b.Wait() {
+					log(fmt.Sprintf("worker %d arrived last", w))
+				}
+			}
+		})
+	}
+	wg.Wait()
+	for _, s := range trace {
+		fmt.Println("  " + s)
+	}
+
+	fmt.Println("\n=== ChanBarrier: a worker gives up ===")
+	cb := NewChanBarrier(3, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_, err := cb.Wait(ctx)
+	fmt.Printf("  alone at the barrier, Wait with a 20ms deadline: %v\n", err)
+	wg = sync.WaitGroup{}
+	for w := range 3 {
+		wg.Go(func() {
+			if last, _ := cb.Wait(context.Background()); last {
+				fmt.Printf("  then 3 arrive, worker %d last: the abandoned arrival was taken back\n", w)
+			}
+		})
+	}
+	wg.Wait()
+}
@@ -0,0 +1,179 @@
+// Barrier Tests - Reuse across many phases, one last arrival, cancellation
+//
+// The reuse test is the one that matters: a barrier that works once but
+// lets a fast goroutine lap a slow one on the second phase passes any
+// single-phase test. Each phase here has goroutines arrive in a random
+// order, and each checks on release that every other has arrived.
+//
+// Usage:
+//   go test -race -v barrier.go barrier_test.go
+//   go test -run=^$ -bench=. barrier.go barrier_test.go
+package main
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"runtime"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waiter is either barrier, reduced to Wait
+type waiter func() bool
+
+var barriers = []struct {
+	name string
+	make func(parties int, action func()) waiter
+}{
+	{"cond", func(parties int, action func()) waiter {
+		return NewBarrier(parties, action).Wait
+	}},
+	{"chan", func(parties int, action func()) waiter {
+		b := NewChanBarrier(parties, action)
+		return func() bool {
+			last, _ := b.Wait(context.Background())
+			return last
+		}
+	}},
+}
+
+func TestReuseAcrossPhases(t *testing.T) {
+	const parties, phases = 8, 500
+	for _, bb := range barriers {
+		t.Run(bb.name, func(t *testing.T) {
+			arrivals := make([]atomic.Int32, phases) // per phase
+			var lasts, actions atomic.Int32
+			wait := bb.make(parties, func() { actions.Add(1) })
+
+			var wg sync.WaitGroup
+			for w := range parties {
+				wg.Go(func() {
+					rng := rand.New(rand.NewSource(int64(w)))
+					for p := range phases {
+						if rng.Intn(4) == 0 {
+							runtime.Gosched()
+						}
+						arrivals[p].Add(1)
+						if wait() {
+							lasts.Add(1)
+						}
+						// Released: everyone has arrived for this phase,
+						// and nobody can have arrived for the one after
+						// next, since that needs us
+						if n := arrivals[p].Load(); n != parties {
+							t.Errorf("phase %d: released with %d of %d arrived", p, n, parties)
+							return
+						}
+						if p+2 < phases {
+							if n := arrivals[p+2].Load(); n != 0 {
+								t.Errorf("phase %d: %d already at phase %d", p, n, p+2)
+								return
+							}
+						}
+					}
+				})
+			}
+			wg.Wait()
+			if lasts.Load() != phases || actions.Load() != phases {
+				t.Errorf("%d last arrivals, %d actions; want %d of each", lasts.Load(), actions.Load(), phases)
+			}
+		})
+	}
+}
+
+func TestActionRunsBeforeRelease(t *testing.T) {
+	for _, bb := range barriers {
+		t.Run(bb.name, func(t *testing.T) {
+			var phase atomic.Int32
+			wait := bb.make(4, func() { phase.Add(1) })
+			var wg sync.WaitGroup
+			for range 4 {
+				wg.Go(func() {
+					for p := range int32(50) {
+						wait()
+						if got := phase.Load(); got < p+1 {
+							t.Errorf("released into phase %d before its action ran", p)
+						}
+					}
+				})
+			}
+			wg.Wait()
+		})
+	}
+}
+
+func TestSingleParty(t *testing.T) {
+	for _, bb := range barriers {
+		wait := bb.make(1, nil)
+		for range 3 {
+			if !wait() {
+				t.Errorf("%s: a lone party is always last", bb.name)
+			}
+		}
+	}
+}
+
+func TestChanBarrierCancel(t *testing.T) {
+	b := NewChanBarrier(2, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := b.Wait(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Wait = %v, want DeadlineExceeded", err)
+	}
+	// The abandoned arrival was taken back: one more arrival alone must
+	// not complete the phase
+	released := make(chan bool)
+	go func() {
+		last, _ := b.Wait(context.Background())
+		released <- last
+	}()
+	select {
+	case <-released:
+		t.Fatal("phase completed with one of two parties")
+	case <-time.After(20 * time.Millisecond):
+	}
+	if last, err := b.Wait(context.Background()); !last || err != nil {
+		t.Errorf("second arrival: last %v, err %v; want true, nil", last, err)
+	}
+	if last := <-released; last {
+		t.Error("both arrivals reported last")
+	}
+}
+
+func TestHeatMatchesSequential(t *testing.T) {
+	want := sequential(40, 200)
+	for _, workers := range []int{1, 3, 8} {
+		for _, w := range []func(int) func(func()) func(){condWait, chanWait} {
+			if got := parallel(40, 200, workers, w(workers), nil, 0); !slices.Equal(got, want) {
+				t.Errorf("%d workers: differs from sequential", workers)
+			}
+		}
+	}
+}
+
+// ============================================================
+// Benchmarks
+// ============================================================
+
+// BenchmarkPhase is the cost of one phase for 4 goroutines doing
+// nothing but meeting: the overhead a phase's work must dwarf
+func BenchmarkPhase(b *testing.B) {
+	for _, bb := range barriers {
+		b.Run(bb.name, func(b *testing.B) {
+			wait := bb.make(4, nil)
+			var wg sync.WaitGroup
+			for range 4 {
+				wg.Go(func() {
+					for range b.N {
+						wait()
+					}
+				})
+			}
+			wg.Wait()
+		})
+	}
+}
@@ -0,0 +1,286 @@
+// Package batch coalesces items submitted from many goroutines into
+// batches, for sinks where each write has a fixed cost that dwarfs the
+// cost per item.
+//
+// An fsync, a database round trip and a network call to a log service
+// all cost about the same for one item as for a hundred. Writing each
+// item alone pays that cost every time; a Batcher pays it once per
+// batch. A batch is flushed when the first of these happens:
+//   - MaxItems: it is full. Under load, batches fill before they age
+//     and the sink sees as few, large writes as it can.
+//   - MaxAge: its oldest item has waited that long. Under light load
+//     this bounds the latency that batching adds. If the flusher is
+//     busy then, the batch stays open and keeps filling until it is
+//     free: sealing it would only make it wait in line, and smaller.
+//   - Close.
+//
+// A single flusher goroutine writes the batches in order. If it falls
+// behind, sealed batches queue up behind it, until Limit items are
+// held. Add then blocks (backpressure) rather than letting memory grow
+// without bound while the sink is slow.
+//
+// Add is fire and forget, for log lines and metrics. Do also waits for
+// its item's batch to be written and returns the flush's error. That
+// is group commit: each caller waits for a durable write, and every
+// caller in the batch shares its cost.
+package batch
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrClosed is returned by Add and Do after Close
+var ErrClosed = errors.New("batch: closed")
+
+// Config tunes a Batcher. Zero fields take the defaults noted
+type Config struct {
+	MaxItems int           // flush at this many items (100)
+	MaxAge   time.Duration // flush when the oldest has waited this long (10ms)
+	// Limit is how many items may be held, in the open batch, waiting
+	// for the flusher or being flushed, before Add blocks (4*MaxItems)
+	Limit int
+}
+
+func (c *Config) defaults() {
+	if c.MaxItems <= 0 {
+		c.MaxItems = 100
+	}
+	if c.MaxAge <= 0 {
+		c.MaxAge = 10 * time.Millisecond
+	}
+	if c.Limit <= 0 {
+		c.Limit = 4 * c.MaxItems
+	}
+	c.Limit = max(c.Limit, c.MaxItems)
+}
+
+// Stats counts what the Batcher has done since New
+type Stats struct {
+	Items, Batches     uint64
+	BySize, ByAge      uint64 // why batches were flushed; the rest by Close
+	Waited             uint64 // Adds that blocked on Limit
+	FlushErrors        uint64
+	FlushTime          time.Duration // total spent in the flush func
+	Largest, HighWater int           // biggest batch; most items held at once
+	Held               int           // items held now
+}
+
+// batch is a group of items flushed together, and where Do waits for
+// the result
+type batch[T any] struct {
+	items []T
+	done  chan struct{} // closed once flushed, when err is set
+	err   error
+	timer *time.Timer
+	// expired is set when MaxAge passed while the flusher was busy: it
+	// takes the batch as soon as it is free
+	expired bool
+}
+
+// Batcher is safe for concurrent use
+type Batcher[T any] struct {
+	cfg   Config
+	flush func([]T) error
+
+	mu       sync.Mutex
+	open     *batch[T]   // nil until the first Add after a seal
+	sealed   []*batch[T] // waiting for the flusher, in order
+	held     int         // items in open, sealed and the one being flushed
+	flushing bool
+	closed   bool
+	stats    Stats
+	// freed is closed, and replaced, when a flush makes room, to wake
+	// every blocked Add; freeWaits says there is one, so a Batcher that
+	// never fills up doesn't make a channel per flush
+	freed     chan struct{}
+	freeWaits bool
+
+	ready chan struct{} // cap 1: there are sealed batches
+	done  chan struct{} // the flusher has exited
+}
+
+// New starts a Batcher that passes each batch to flush, one batch at a
+// time. flush owns the slice; it may keep it
+func New[T any](cfg Config, flush func([]T) error) *Batcher[T] {
+	cfg.defaults()
+	b := &Batcher[T]{
+		cfg:   cfg,
+		flush: flush,
+		freed: make(chan struct{}),
+		ready: make(chan struct{}, 1),
+		done:  make(chan struct{}),
+	}
+	go b.flusher()
+	return b
+}
+
+// Add submits v and returns once it is in a batch, without waiting for
+// the flush. It blocks while Limit items are held, until the flusher
+// makes room or ctx is done
+func (b *Batcher[T]) Add(ctx context.Context, v T) error {
+	_, err := b.add(ctx, v)
+	return err
+}
+
+// Do submits v and waits for its batch to be flushed, returning the
+// flush's error. If ctx is done first Do returns its error, but v has
+// been submitted, and will still be flushed
+func (b *Batcher[T]) Do(ctx context.Context, v T) error {
+	bt, err := b.add(ctx, v)
+	if err != nil {
+		return err
+	}
+	select {
+	case <-bt.done:
+		return bt.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (b *Batcher[T]) add(ctx context.Context, v T) (*batch[T], error) {
+	waited := false
+	b.mu.Lock()
+	for {
+		if b.closed {
+			b.mu.Unlock()
+			return nil, ErrClosed
+		}
+		if b.held < b.cfg.Limit {
+			break
+		}
+		if !waited {
+			waited = true
+			b.stats.Waited++
+		}
+		freed := b.freed
+		b.freeWaits = true
+		b.mu.Unlock()
+		select {
+		case <-freed:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		b.mu.Lock()
+	}
+	defer b.mu.Unlock()
+
+	bt := b.open
+	if bt == nil {
+		bt = &batch[T]{items: make([]T, 0, b.cfg.MaxItems), done: make(chan struct{})}
+		bt.timer = time.AfterFunc(b.cfg.MaxAge, func() { b.expire(bt) })
+		b.open = bt
+	}
+	bt.items = append(bt.items, v)
+	b.held++
+	b.stats.Items++
+	b.stats.HighWater = max(b.stats.HighWater, b.held)
+	if len(bt.items) == b.cfg.MaxItems {
+		b.stats.BySize++
+		b.seal()
+	}
+	return bt, nil
+}
+
+// expire seals bt if its age is up and it is still open
+func (b *Batcher[T]) expire(bt *batch[T]) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.open != bt {
+		return // sealed by size or Close meanwhile; the timer lost the race
+	}
+	if b.flushing || len(b.sealed) > 0 {
+		bt.expired = true
+		return
+	}
+	b.stats.ByAge++
+	b.seal()
+}
+
+// seal hands the open batch to the flusher; b.mu held
+func (b *Batcher[T]) seal() {
+	b.open.timer.Stop()
+	b.sealed = append(b.sealed, b.open)
+	b.open = nil
+	select {
+	case b.ready <- struct{}{}:
+	default: // already signalled
+	}
+}
+
+func (b *Batcher[T]) flusher() {
+	defer close(b.done)
+	for range b.ready {
+		for {
+			b.mu.Lock()
+			if len(b.sealed) == 0 && b.open != nil && b.open.expired {
+				// Came of age while we were busy, and has been filling since
+				b.stats.ByAge++
+				b.seal()
+			}
+			if len(b.sealed) == 0 {
+				b.flushing = false
+				b.mu.Unlock()
+				break
+			}
+			bt := b.sealed[0]
+			b.sealed = b.sealed[1:]
+			b.flushing = true
+			b.mu.Unlock()
+
+			start := time.Now()
+			bt.err = b.flush(bt.items)
+			took := time.Since(start)
+			close(bt.done)
+
+			b.mu.Lock()
+			b.held -= len(bt.items)
+			b.stats.Batches++
+			b.stats.FlushTime += took
+			b.stats.Largest = max(b.stats.Largest, len(bt.items))
+			if bt.err != nil {
+				b.stats.FlushErrors++
+			}
+			b.wake()
+			b.mu.Unlock()
+		}
+	}
+}
+
+// wake wakes every Add blocked on Limit; b.mu held
+func (b *Batcher[T]) wake() {
+	if b.freeWaits {
+		close(b.freed)
+		b.freed = make(chan struct{})
+		b.freeWaits = false
+	}
+}
+
+// Close flushes what is held, waits for it to be written, and stops
+// the flusher. Blocked and later Adds return ErrClosed. Calling Close
+// again waits for the first to finish
+func (b *Batcher[T]) Close() {
+	b.mu.Lock()
+	if !b.closed {
+		b.closed = true
+		if b.open != nil {
+			b.seal()
+		}
+		close(b.ready) // the flusher drains what is sealed, then exits
+		b.wake()       // blocked Adds, to see closed
+	}
+	b.mu.Unlock()
+	<-b.done
+}
+
+// Stats returns a snapshot of the counters
+func (b *Batcher[T]) Stats() Stats {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s := b.stats
+	s.Held = b.held
+	return s
+}
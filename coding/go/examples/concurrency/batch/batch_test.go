@@ -0,0 +1,318 @@
+package batch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// recorder is a flush func that keeps every batch
+type recorder struct {
+	mu      sync.Mutex
+	batches [][]int
+}
+
+func (r *recorder) flush(items []int) error {
+	r.mu.Lock()
+	r.batches = append(r.batches, items)
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *recorder) sizes() []int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var s []int
+	for _, b := range r.batches {
+		s = append(s, len(b))
+	}
+	return s
+}
+
+func (r *recorder) all() []int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return slices.Concat(r.batches...)
+}
+
+func TestFlushBySize(t *testing.T) {
+	var r recorder
+	b := New(Config{MaxItems: 10, MaxAge: time.Hour}, r.flush)
+	ctx := context.Background()
+	for i := range 35 {
+		if err := b.Add(ctx, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	b.Close()
+	if got, want := r.sizes(), []int{10, 10, 10, 5}; !slices.Equal(got, want) {
+		t.Errorf("batch sizes %v, want %v", got, want)
+	}
+	want := make([]int, 35)
+	for i := range want {
+		want[i] = i
+	}
+	if got := r.all(); !slices.Equal(got, want) {
+		t.Errorf("items flushed out of order: %v", got)
+	}
+	if s := b.Stats(); s.BySize != 3 || s.ByAge != 0 || s.Batches != 4 || s.Items != 35 {
+		t.Errorf("stats %+v", s)
+	}
+}
+
+func TestFlushByAge(t *testing.T) {
+	// Light load: one item never fills a batch, so its age flushes it
+	const age = 20 * time.Millisecond
+	var r recorder
+	b := New(Config{MaxItems: 1000, MaxAge: age}, r.flush)
+	defer b.Close()
+	start := time.Now()
+	if err := b.Do(context.Background(), 1); err != nil {
+		t.Fatal(err)
+	}
+	if waited := time.Since(start); waited < age || waited > age+time.Second {
+		t.Errorf("Do returned after %v, want about %v", waited, age)
+	}
+	if s := b.Stats(); s.ByAge != 1 || s.BySize != 0 {
+		t.Errorf("stats %+v, want one batch by age", s)
+	}
+}
+
+func TestAgeWaitsForBusyFlusher(t *testing.T) {
+	// A batch that comes of age while the flusher is busy keeps filling,
+	// and goes as one batch when the flusher is free, not as many small
+	// ones queued behind it
+	gate := make(chan struct{})
+	var r recorder
+	b := New(Config{MaxItems: 10, MaxAge: 5 * time.Millisecond}, func(items []int) error {
+		<-gate
+		return r.flush(items)
+	})
+	ctx := context.Background()
+	for i := range 13 {
+		b.Add(ctx, i) // a full batch, stuck in the flusher, and 3 more
+	}
+	time.Sleep(20 * time.Millisecond) // well past MaxAge
+	for i := 13; i < 16; i++ {
+		b.Add(ctx, i)
+	}
+	gate <- struct{}{}
+	gate <- struct{}{}
+	b.Close()
+	if got, want := r.sizes(), []int{10, 6}; !slices.Equal(got, want) {
+		t.Errorf("batch sizes %v, want %v", got, want)
+	}
+	if s := b.Stats(); s.ByAge != 1 {
+		t.Errorf("%d batches by age, want 1", s.ByAge)
+	}
+}
+
+func TestConcurrentAdds(t *testing.T) {
+	// Every item from every goroutine is flushed exactly once, in
+	// batches no bigger than MaxItems
+	const goroutines, each, maxItems = 8, 2000, 64
+	var r recorder
+	b := New(Config{MaxItems: maxItems, MaxAge: time.Millisecond, Limit: 256}, r.flush)
+	var wg sync.WaitGroup
+	for g := range goroutines {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range each {
+				b.Add(context.Background(), g*each+i)
+			}
+		}()
+	}
+	wg.Wait()
+	b.Close()
+
+	got := r.all()
+	slices.Sort(got)
+	for i, v := range got {
+		if v != i {
+			t.Fatalf("item %d missing or duplicated (found %d)", i, v)
+		}
+	}
+	if len(got) != goroutines*each {
+		t.Fatalf("flushed %d items, want %d", len(got), goroutines*each)
+	}
+	if s := b.Stats(); s.Largest > maxItems || s.HighWater > 256 {
+		t.Errorf("largest batch %d, high water %d", s.Largest, s.HighWater)
+	}
+}
+
+func TestBackpressure(t *testing.T) {
+	// The flusher is stuck on its first batch. Adds fill the Limit and
+	// then block, until the flusher makes room
+	gate := make(chan struct{})
+	b := New(Config{MaxItems: 10, MaxAge: time.Hour, Limit: 20}, func([]int) error {
+		<-gate
+		return nil
+	})
+	ctx := context.Background()
+	for i := range 20 {
+		if err := b.Add(ctx, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	short, cancel := context.WithTimeout(ctx, 30*time.Millisecond)
+	defer cancel()
+	if err := b.Add(short, 20); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Add past Limit = %v, want DeadlineExceeded", err)
+	}
+
+	added := make(chan error)
+	go func() { added <- b.Add(ctx, 21) }()
+	select {
+	case err := <-added:
+		t.Fatalf("Add past Limit returned %v while the flusher was stuck", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	gate <- struct{}{} // one batch written: room for 10
+	if err := <-added; err != nil {
+		t.Fatal(err)
+	}
+	if s := b.Stats(); s.Waited != 2 || s.HighWater != 20 {
+		t.Errorf("waited %d, high water %d; want 2, 20", s.Waited, s.HighWater)
+	}
+	close(gate)
+	b.Close()
+}
+
+func TestDoSharesTheFlushError(t *testing.T) {
+	errDisk := errors.New("disk full")
+	b := New(Config{MaxItems: 4, MaxAge: time.Hour}, func([]int) error { return errDisk })
+	defer b.Close()
+	errs := make(chan error, 4)
+	for i := range 4 {
+		go func() { errs <- b.Do(context.Background(), i) }()
+	}
+	for range 4 {
+		if err := <-errs; !errors.Is(err, errDisk) {
+			t.Errorf("Do = %v, want %v", err, errDisk)
+		}
+	}
+	if s := b.Stats(); s.FlushErrors != 1 || s.Batches != 1 {
+		t.Errorf("stats %+v, want one failed batch", s)
+	}
+}
+
+func TestClose(t *testing.T) {
+	// Close flushes the open batch, wakes blocked Adds with ErrClosed,
+	// and refuses later ones
+	gate := make(chan struct{})
+	var r recorder
+	b := New(Config{MaxItems: 5, MaxAge: time.Hour, Limit: 5}, func(items []int) error {
+		<-gate
+		return r.flush(items)
+	})
+	ctx := context.Background()
+	for i := range 5 {
+		b.Add(ctx, i)
+	}
+	blocked := make(chan error)
+	go func() { blocked <- b.Add(ctx, 5) }()
+	time.Sleep(10 * time.Millisecond)
+
+	closed := make(chan struct{})
+	go func() {
+		b.Close()
+		close(closed)
+	}()
+	if err := <-blocked; !errors.Is(err, ErrClosed) {
+		t.Errorf("blocked Add = %v, want ErrClosed", err)
+	}
+	close(gate)
+	<-closed
+	if err := b.Add(ctx, 6); !errors.Is(err, ErrClosed) {
+		t.Errorf("Add after Close = %v, want ErrClosed", err)
+	}
+	if got := r.all(); !slices.Equal(got, []int{0, 1, 2, 3, 4}) {
+		t.Errorf("flushed %v", got)
+	}
+	b.Close() // twice is fine
+}
+
+// ============================================================
+// Benchmarks
+// ============================================================
+
+// BenchmarkAdd is the Batcher's own overhead, with a sink that costs
+// nothing
+func BenchmarkAdd(b *testing.B) {
+	bt := New(Config{MaxItems: 256, Limit: 4096}, func([]int) error { return nil })
+	defer bt.Close()
+	ctx := context.Background()
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			bt.Add(ctx, 1)
+		}
+	})
+	b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "items/s")
+}
+
+// sink is a write with a fixed cost, like an fsync, and a small cost
+// per item
+func sink(items int) {
+	time.Sleep(100*time.Microsecond + time.Duration(items)*100*time.Nanosecond)
+}
+
+// BenchmarkDurableWrite is goroutines that each need their item written
+// before they go on: one write per item under a mutex, against group
+// commit through Do. Reports throughput and each write's latency. With
+// one goroutine batching only adds MaxAge to every write; with many,
+// the unbatched writes queue for the mutex and group commit wins both
+// throughput and latency
+func BenchmarkDurableWrite(b *testing.B) {
+	for _, goroutines := range []int{1, 16, 128} {
+		b.Run(fmt.Sprintf("unbatched/goroutines-%d", goroutines), func(b *testing.B) {
+			var mu sync.Mutex
+			measure(b, goroutines, func() error {
+				mu.Lock()
+				defer mu.Unlock()
+				sink(1)
+				return nil
+			})
+		})
+		b.Run(fmt.Sprintf("batched/goroutines-%d", goroutines), func(b *testing.B) {
+			bt := New(Config{MaxItems: 128, MaxAge: time.Millisecond}, func(items []int) error {
+				sink(len(items))
+				return nil
+			})
+			defer bt.Close()
+			ctx := context.Background()
+			measure(b, goroutines, func() error { return bt.Do(ctx, 1) })
+		})
+	}
+}
+
+// measure runs write b.N times across goroutines and reports items/s
+// and latency percentiles
+func measure(b *testing.B, goroutines int, write func() error) {
+	lat := make([][]time.Duration, goroutines)
+	var wg sync.WaitGroup
+	b.ResetTimer()
+	for g := range goroutines {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := g; i < b.N; i += goroutines {
+				start := time.Now()
+				write()
+				lat[g] = append(lat[g], time.Since(start))
+			}
+		}()
+	}
+	wg.Wait()
+	b.StopTimer()
+	all := slices.Concat(lat...)
+	slices.Sort(all)
+	b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "items/s")
+	b.ReportMetric(float64(all[len(all)/2].Microseconds()), "p50-µs")
+	b.ReportMetric(float64(all[len(all)*99/100].Microseconds()), "p99-µs")
+}
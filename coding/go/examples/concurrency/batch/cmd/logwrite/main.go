@@ -0,0 +1,238 @@
+// logwrite - Durable log writes, one fsync each against group commit
+//
+// Many goroutines write log lines that must be on disk before they go
+// on, as an audit log or a database's write-ahead log requires. The
+// disk is simulated: every write costs a fixed fsync (2ms) plus a
+// little per line, whether it carries one line or a thousand. With
+// -file, the lines go to a real file and each write is a real fsync.
+//
+// Part one runs three ways for the same length of time:
+//
+//   unbatched  each line is its own write, under a mutex
+//   Do         lines go through a Batcher; each waits for its batch
+//   Add        the same, but nobody waits: fire and forget
+//
+// Part two holds the writers to a steady rate and makes the disk stall
+// for 300ms, sampling the lines the Batcher holds every 50ms.
+//
+// Things to look for:
+// - Unbatched, throughput is one line per fsync however many writers
+//   there are, and each writer's latency is the length of the queue
+// - Do makes fewer writes than unbatched, but each carries a line from
+//   every writer, so throughput multiplies and latency falls to an
+//   fsync or two
+// - During the stall the Batcher fills to its Limit and then Adds
+//   block: memory stays bounded, and the writers slow down instead.
+//   Once the disk recovers, full batches drain the backlog quickly
+//
+// Usage:
+//   go run ./cmd/logwrite
+//   go run ./cmd/logwrite -writers 256 -file /tmp/log
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bellistech/labs/coding/go/examples/concurrency/batch"
+)
+
+// ============================================================
+// The disk
+// ============================================================
+
+type disk struct {
+	fsync   time.Duration
+	f       *os.File // nil: simulated
+	writes  atomic.Int64
+	stalled atomic.Int64 // unix nanos until which writes hang
+}
+
+func (d *disk) write(lines []string) error {
+	d.writes.Add(1)
+	if until := time.Unix(0, d.stalled.Load()); time.Now().Before(until) {
+		time.Sleep(time.Until(until))
+	}
+	if d.f == nil {
+		time.Sleep(d.fsync + time.Duration(len(lines))*time.Microsecond)
+		return nil
+	}
+	if _, err := d.f.WriteString(strings.Join(lines, "")); err != nil {
+		return err
+	}
+	return d.f.Sync()
+}
+
+func (d *disk) stall(length time.Duration) {
+	d.stalled.Store(time.Now().Add(length).UnixNano())
+}
+
+// ============================================================
+// Part one: throughput and latency
+// ============================================================
+
+type result struct {
+	lines, writes int64
+	lat           []time.Duration
+}
+
+// hammer runs writers that each call write in a loop until length is up
+func hammer(writers int, length time.Duration, write func(line string) error) result {
+	lats := make([][]time.Duration, writers)
+	var lines atomic.Int64
+	end := time.Now().Add(length)
+	var wg sync.WaitGroup
+	for w := range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; time.Now().Before(end); i++ {
+				start := time.Now()
+				if err := write(fmt.Sprintf("writer %d line %d\n", w, i)); err != nil {
+					fmt.Println(err)
+					return
+				}
+				lats[w] = append(lats[w], time.Since(start))
+				lines.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	all := slices.Concat(lats...)
+	slices.Sort(all)
+	return result{lines: lines.Load(), lat: all}
+}
+
+func (r result) print(name string, length time.Duration) {
+	pct := func(p float64) time.Duration {
+		if len(r.lat) == 0 {
+			return 0
+		}
+		return r.lat[int(p*float64(len(r.lat)-1))]
+	}
+	fmt.Printf("  %-10s %9.0f %8d %8.1f %10v %10v\n", name, float64(r.lines)/length.Seconds(), r.writes,
+		float64(r.lines)/float64(max(r.writes, 1)), pct(0.5).Round(time.Microsecond), pct(0.99).Round(time.Microsecond))
+}
+
+func partOne(d *disk, writers int, length time.Duration, cfg batch.Config) {
+	fsync := d.fsync.String()
+	if d.f != nil {
+		fsync = "real, to " + d.f.Name()
+	}
+	fmt.Printf("=== %d writers for %v each way; fsync %s ===\n", writers, length, fsync)
+	fmt.Printf("  %-10s %9s %8s %8s %10s %10s\n", "", "lines/s", "writes", "per write", "p50", "p99")
+
+	var mu sync.Mutex
+	before := d.writes.Load()
+	r := hammer(writers, length, func(line string) error {
+		mu.Lock()
+		defer mu.Unlock()
+		return d.write([]string{line})
+	})
+	r.writes = d.writes.Load() - before
+	r.print("unbatched", length)
+
+	ctx := context.Background()
+	for _, mode := range []string{"Do", "Add"} {
+		b := batch.New(cfg, d.write)
+		before := d.writes.Load()
+		var r result
+		if mode == "Do" {
+			r = hammer(writers, length, func(line string) error { return b.Do(ctx, line) })
+		} else {
+			r = hammer(writers, length, func(line string) error { return b.Add(ctx, line) })
+		}
+		b.Close()
+		r.writes = d.writes.Load() - before
+		r.print(mode, length)
+	}
+	fmt.Println("  Add's latency is only the wait to get into a batch: its lines")
+	fmt.Println("  may not be on disk yet, and a crash would lose them")
+}
+
+// ============================================================
+// Part two: the disk stalls
+// ============================================================
+
+func partTwo(d *disk, writers int, cfg batch.Config) {
+	const rate = time.Millisecond // per writer
+	fmt.Printf("\n=== %d writers, a line every %v each; the disk stalls at 300ms ===\n", writers, rate)
+	fmt.Printf("  Limit %d lines. Every 50ms, the lines held and the writers blocked in Add:\n", cfg.Limit)
+
+	b := batch.New(cfg, d.write)
+	ctx := context.Background()
+	var blocked atomic.Int64
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	for w := range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			t := time.NewTicker(rate)
+			defer t.Stop()
+			for i := 0; ; i++ {
+				select {
+				case <-stop:
+					return
+				case <-t.C:
+				}
+				blocked.Add(1)
+				b.Add(ctx, fmt.Sprintf("writer %d line %d\n", w, i))
+				blocked.Add(-1)
+			}
+		}()
+	}
+
+	start := time.Now()
+	sample := time.NewTicker(50 * time.Millisecond)
+	for i := 1; i <= 20; i++ {
+		<-sample.C
+		if i == 6 {
+			d.stall(300 * time.Millisecond)
+		}
+		s := b.Stats()
+		mark := ""
+		if until := time.Unix(0, d.stalled.Load()); time.Now().Before(until) {
+			mark = "stalled"
+		}
+		bar := strings.Repeat("#", s.Held*40/cfg.Limit)
+		fmt.Printf("  %5v %5d %-40s %3d %s\n", time.Since(start).Round(10*time.Millisecond), s.Held, bar,
+			blocked.Load(), mark)
+	}
+	sample.Stop()
+	close(stop)
+	wg.Wait()
+	b.Close()
+	s := b.Stats()
+	fmt.Printf("  %d lines in %d writes (%d full, %d by age); %d Adds waited; at most %d held\n",
+		s.Items, s.Batches, s.BySize, s.ByAge, s.Waited, s.HighWater)
+}
+
+func main() {
+	writers := flag.Int("writers", 64, "goroutines writing lines")
+	length := flag.Duration("for", time.Second, "how long to run each way in part one")
+	fsync := flag.Duration("fsync", 2*time.Millisecond, "the simulated disk's cost per write")
+	file := flag.String("file", "", "write to this file, with a real fsync per write")
+	flag.Parse()
+
+	d := &disk{fsync: *fsync}
+	if *file != "" {
+		f, err := os.OpenFile(*file, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		defer f.Close()
+		d.f = f
+	}
+	cfg := batch.Config{MaxItems: 256, MaxAge: 2 * time.Millisecond, Limit: 1024}
+	partOne(d, *writers, *length, cfg)
+	partTwo(d, *writers, cfg)
+}
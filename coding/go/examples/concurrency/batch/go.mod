@@ -0,0 +1,3 @@
+module github.com/bellistech/labs/coding/go/examples/concurrency/batch
+
+go 1.24
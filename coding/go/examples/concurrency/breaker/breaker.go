@@ -0,0 +1,265 @@
+// Package breaker is a circuit breaker: it stops calling a dependency
+// that keeps failing, so callers fail fast instead of queueing behind
+// timeouts, and the dependency gets room to recover.
+//
+//	Closed --failure rate >= FailureRate--> Open
+//	  ^                                       |
+//	  | all Probes succeed                    | Cooldown over
+//	  |                                       v
+//	  +-------------------------------- HalfOpen --a probe fails--> Open
+//
+// Closed lets everything through and counts outcomes over a rolling
+// window. Counting a rate rather than consecutive failures means one
+// success among many failures doesn't reset it, and MinRequests keeps
+// two failures out of three requests at 3am from tripping it.
+//
+// Open rejects at once with ErrOpen. After Cooldown the next request
+// moves it to HalfOpen, which lets a few probe requests through and
+// rejects the rest; if they all succeed it closes, if any fails it
+// opens again for another Cooldown.
+package breaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+type State int
+
+const (
+	Closed   State = iota // requests flow; outcomes are counted
+	Open                  // requests are rejected
+	HalfOpen              // a few probes test whether to close
+)
+
+func (s State) String() string {
+	switch s {
+	case Closed:
+		return "closed"
+	case Open:
+		return "open"
+	case HalfOpen:
+		return "half-open"
+	}
+	return fmt.Sprintf("State(%d)", int(s))
+}
+
+// ErrOpen is returned instead of making the call while the breaker is
+// open, or half-open with all its probes already out
+var ErrOpen = errors.New("breaker: circuit open")
+
+// Config tunes a Breaker. Zero fields take the defaults noted
+type Config struct {
+	// Window is how far back outcomes are counted (10s), in Buckets
+	// slices (10)
+	Window  time.Duration
+	Buckets int
+	// FailureRate in the window at which the breaker opens (0.5), once
+	// it holds at least MinRequests outcomes (20)
+	FailureRate float64
+	MinRequests int
+	// Cooldown is how long it stays open before probing (5s)
+	Cooldown time.Duration
+	// Probes is how many requests HalfOpen lets through, all of which
+	// must succeed to close (1)
+	Probes int
+	// IsFailure decides which errors count against the dependency. The
+	// default counts every error except context.Canceled: a caller
+	// giving up says nothing about the dependency's health. A 404 or a
+	// validation error usually shouldn't count either
+	IsFailure func(error) bool
+	// OnStateChange, if set, is called on every transition, with the
+	// breaker's lock held: it must not call back into the Breaker
+	OnStateChange func(from, to State)
+}
+
+func (c *Config) defaults() {
+	if c.Window <= 0 {
+		c.Window = 10 * time.Second
+	}
+	if c.Buckets <= 0 {
+		c.Buckets = 10
+	}
+	if c.FailureRate <= 0 {
+		c.FailureRate = 0.5
+	}
+	if c.MinRequests <= 0 {
+		c.MinRequests = 20
+	}
+	if c.Cooldown <= 0 {
+		c.Cooldown = 5 * time.Second
+	}
+	if c.Probes <= 0 {
+		c.Probes = 1
+	}
+	if c.IsFailure == nil {
+		c.IsFailure = defaultIsFailure
+	}
+}
+
+func defaultIsFailure(err error) bool {
+	return err != nil && !errors.Is(err, context.Canceled)
+}
+
+// Counts is a snapshot of what the breaker has seen
+type Counts struct {
+	// In the window, Closed state only
+	Successes, Failures int
+	// Since New
+	Rejected    uint64
+	Transitions uint64
+}
+
+// Breaker is safe for concurrent use
+type Breaker struct {
+	cfg Config
+	now func() time.Time
+
+	mu     sync.Mutex
+	state  State
+	window *window
+	since  time.Time // of the last transition
+	// generation changes on every transition, so the outcome of a
+	// request let through in one state can't be counted in the next:
+	// a slow request from before the breaker opened must not count as
+	// a probe, or close it
+	generation uint64
+	probesOut  int // HalfOpen: let through
+	probesOK   int // HalfOpen: succeeded
+	rejected   uint64
+	changes    uint64
+}
+
+func New(cfg Config) *Breaker {
+	return newBreaker(cfg, time.Now)
+}
+
+func newBreaker(cfg Config, now func() time.Time) *Breaker {
+	cfg.defaults()
+	return &Breaker{cfg: cfg, now: now, window: newWindow(cfg.Window, cfg.Buckets)}
+}
+
+// Allow asks to make one call. If it returns an error, don't make it.
+// Otherwise make the call and pass its error, or nil, to done, exactly
+// once. A probe that isn't reported within Cooldown counts as failed,
+// so a lost done can't leave the breaker half-open for good.
+//
+// Allow and done are the two halves of Do, for calls that don't fit in
+// a func() error, such as a response body read later
+func (b *Breaker) Allow() (done func(err error), err error) {
+	gen, err := b.allow()
+	if err != nil {
+		return nil, err
+	}
+	var once sync.Once
+	return func(err error) {
+		once.Do(func() { b.report(gen, err) })
+	}, nil
+}
+
+// Do calls fn if the breaker allows it, and records the result
+func (b *Breaker) Do(fn func() error) error {
+	gen, err := b.allow()
+	if err != nil {
+		return err
+	}
+	err = fn()
+	b.report(gen, err)
+	return err
+}
+
+// allow admits a request and returns the generation it belongs to
+func (b *Breaker) allow() (uint64, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tick(b.now())
+	switch b.state {
+	case Open:
+		b.rejected++
+		return 0, ErrOpen
+	case HalfOpen:
+		if b.probesOut >= b.cfg.Probes {
+			b.rejected++
+			return 0, ErrOpen
+		}
+		b.probesOut++
+	}
+	return b.generation, nil
+}
+
+func (b *Breaker) report(gen uint64, err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if gen != b.generation {
+		return // let through in an earlier state: stale
+	}
+	now := b.now()
+	failed := b.cfg.IsFailure(err)
+	switch b.state {
+	case Closed:
+		b.window.record(now, !failed)
+		s, f := b.window.counts(now)
+		if s+f >= b.cfg.MinRequests && float64(f) >= b.cfg.FailureRate*float64(s+f) {
+			b.setState(Open, now)
+		}
+	case HalfOpen:
+		if failed {
+			b.setState(Open, now)
+			return
+		}
+		b.probesOK++
+		if b.probesOK >= b.cfg.Probes {
+			b.setState(Closed, now)
+		}
+	}
+}
+
+// tick makes the transitions that are due to time alone; b.mu held.
+// Done lazily, when someone looks, so the breaker needs no timer
+func (b *Breaker) tick(now time.Time) {
+	if now.Sub(b.since) < b.cfg.Cooldown {
+		return
+	}
+	switch {
+	case b.state == Open:
+		b.setState(HalfOpen, now)
+	case b.state == HalfOpen && b.probesOut > 0:
+		b.setState(Open, now) // a probe never came back
+	}
+}
+
+// setState makes a transition and resets the new state's counters;
+// b.mu held
+func (b *Breaker) setState(to State, now time.Time) {
+	from := b.state
+	b.state = to
+	b.generation++
+	b.changes++
+	b.since = now
+	b.probesOut, b.probesOK = 0, 0
+	if to == Closed {
+		b.window.reset() // the failures that opened it are history
+	}
+	if b.cfg.OnStateChange != nil {
+		b.cfg.OnStateChange(from, to)
+	}
+}
+
+// State is the current state, counting an Open breaker whose cooldown
+// is over as HalfOpen
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.tick(b.now())
+	return b.state
+}
+
+func (b *Breaker) Counts() Counts {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	s, f := b.window.counts(b.now())
+	return Counts{Successes: s, Failures: f, Rejected: b.rejected, Transitions: b.changes}
+}
@@ -0,0 +1,295 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// clock stands in for time.Now so cooldowns and the rolling window
+// pass on demand. TestConcurrent moves it from the goroutines calling
+// Do, so the time is an atomic offset from a fixed start
+type clock struct {
+	start   time.Time
+	elapsed atomic.Int64 // nanoseconds
+}
+
+func newClock() *clock {
+	return &clock{start: time.Date(2025, 6, 2, 12, 0, 0, 0, time.UTC)}
+}
+
+func (c *clock) now() time.Time { return c.start.Add(time.Duration(c.elapsed.Load())) }
+
+func (c *clock) advance(d time.Duration) { c.elapsed.Add(int64(d)) }
+
+var errBackend = errors.New("backend failed")
+
+// outcomes runs one Do per character: '.' succeeds, 'x' fails
+func outcomes(b *Breaker, s string) {
+	for _, c := range s {
+		b.Do(func() error {
+			if c == 'x' {
+				return errBackend
+			}
+			return nil
+		})
+	}
+}
+
+func TestOpensOnFailureRate(t *testing.T) {
+	tests := []struct {
+		name     string
+		outcomes string
+		want     State
+	}{
+		{"all good", "..........", Closed},
+		{"too few to judge", "xxxxxxxxx", Closed}, // MinRequests is 10
+		{"half failed", ".x.x.x.x.x", Open},
+		{"just under the rate", "..x..x.x.x", Closed},
+		// One success between failures doesn't reset a rate, as it would
+		// a count of consecutive failures
+		{"interleaved", "xxxx.xxxx.", Open},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newBreaker(Config{MinRequests: 10, FailureRate: 0.5}, newClock().now)
+			outcomes(b, tt.outcomes)
+			if got := b.State(); got != tt.want {
+				t.Errorf("after %q: %v, want %v", tt.outcomes, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestWindowForgets(t *testing.T) {
+	clk := newClock()
+	b := newBreaker(Config{Window: 10 * time.Second, Buckets: 10, MinRequests: 10}, clk.now)
+	outcomes(b, "xxxxxxxxx")
+	clk.advance(10 * time.Second) // all nine fall out of the window
+	outcomes(b, "x")
+	if got := b.State(); got != Closed {
+		t.Fatalf("old failures still counted: %v", got)
+	}
+	if c := b.Counts(); c.Failures != 1 {
+		t.Errorf("Failures = %d, want 1", c.Failures)
+	}
+	// Failures 5s apart all stay in a 10s window
+	clk.advance(5 * time.Second)
+	outcomes(b, "xxxxxxxxx")
+	if got := b.State(); got != Open {
+		t.Errorf("%v, want open", got)
+	}
+}
+
+func TestHalfOpen(t *testing.T) {
+	tests := []struct {
+		name   string
+		probes int
+		// results of the probes, in the order they report
+		results string
+		want    State
+	}{
+		{"probe succeeds", 1, ".", Closed},
+		{"probe fails", 1, "x", Open},
+		{"all probes succeed", 3, "...", Closed},
+		{"one of three fails", 3, "..x", Open},
+		{"waiting on the rest", 3, "..", HalfOpen},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clk := newClock()
+			b := newBreaker(Config{MinRequests: 2, Cooldown: time.Second, Probes: tt.probes}, clk.now)
+			outcomes(b, "xx")
+			if _, err := b.Allow(); !errors.Is(err, ErrOpen) {
+				t.Fatalf("open breaker allowed a request: %v", err)
+			}
+			clk.advance(time.Second)
+
+			var dones []func(error)
+			for range tt.probes {
+				done, err := b.Allow()
+				if err != nil {
+					t.Fatalf("probe rejected: %v", err)
+				}
+				dones = append(dones, done)
+			}
+			if _, err := b.Allow(); !errors.Is(err, ErrOpen) {
+				t.Errorf("request beyond %d probes allowed", tt.probes)
+			}
+			for i, r := range tt.results {
+				if r == 'x' {
+					dones[i](errBackend)
+				} else {
+					dones[i](nil)
+				}
+			}
+			if got := b.State(); got != tt.want {
+				t.Errorf("%v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStaleOutcomeIgnored(t *testing.T) {
+	clk := newClock()
+	b := newBreaker(Config{MinRequests: 2, Cooldown: time.Second}, clk.now)
+	slow, _ := b.Allow() // let through while closed
+	outcomes(b, "xx")    // opens
+	clk.advance(time.Second)
+	probe, err := b.Allow() // half-open: the one probe
+	if err != nil {
+		t.Fatal(err)
+	}
+	slow(nil) // must not count as the probe's success
+	if got := b.State(); got != HalfOpen {
+		t.Fatalf("stale success changed the state to %v", got)
+	}
+	probe(errBackend)
+	if got := b.State(); got != Open {
+		t.Errorf("%v, want open", got)
+	}
+}
+
+func TestLostProbe(t *testing.T) {
+	clk := newClock()
+	b := newBreaker(Config{MinRequests: 1, Cooldown: time.Second}, clk.now)
+	outcomes(b, "x")
+	clk.advance(time.Second)
+	b.Allow() // a probe whose done is never called
+	clk.advance(time.Second)
+	if got := b.State(); got != Open {
+		t.Fatalf("%v, want the lost probe to count as a failure", got)
+	}
+	clk.advance(time.Second)
+	if err := b.Do(func() error { return nil }); err != nil {
+		t.Fatalf("next probe: %v", err)
+	}
+	if got := b.State(); got != Closed {
+		t.Errorf("%v, want closed", got)
+	}
+}
+
+func TestIsFailure(t *testing.T) {
+	errNotFound := errors.New("not found")
+	tests := []struct {
+		name      string
+		isFailure func(error) bool
+		err       error
+		want      State
+	}{
+		{"default counts errors", nil, errBackend, Open},
+		{"default ignores cancellation", nil, fmt.Errorf("call: %w", context.Canceled), Closed},
+		{"default counts timeouts", nil, context.DeadlineExceeded, Open},
+		{"custom ignores not found", func(err error) bool {
+			return err != nil && !errors.Is(err, errNotFound)
+		}, errNotFound, Closed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := newBreaker(Config{MinRequests: 3, IsFailure: tt.isFailure}, newClock().now)
+			for range 3 {
+				if err := b.Do(func() error { return tt.err }); err != tt.err {
+					t.Fatalf("Do returned %v, want fn's own error", err)
+				}
+			}
+			if got := b.State(); got != tt.want {
+				t.Errorf("%v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDoneCountsOnce(t *testing.T) {
+	b := newBreaker(Config{MinRequests: 2}, newClock().now)
+	done, _ := b.Allow()
+	done(errBackend)
+	done(errBackend)
+	if c := b.Counts(); c.Failures != 1 {
+		t.Errorf("Failures = %d, want 1", c.Failures)
+	}
+}
+
+func TestOnStateChange(t *testing.T) {
+	clk := newClock()
+	var got []string
+	b := newBreaker(Config{
+		MinRequests: 2,
+		Cooldown:    time.Second,
+		OnStateChange: func(from, to State) {
+			got = append(got, fmt.Sprintf("%v->%v", from, to))
+		},
+	}, clk.now)
+	outcomes(b, "xx")
+	outcomes(b, "...") // rejected
+	clk.advance(time.Second)
+	outcomes(b, "x")
+	clk.advance(time.Second)
+	outcomes(b, ".")
+
+	want := []string{"closed->open", "open->half-open", "half-open->open", "open->half-open", "half-open->closed"}
+	if !slices.Equal(got, want) {
+		t.Errorf("transitions = %v, want %v", got, want)
+	}
+	if c := b.Counts(); c.Rejected != 3 || c.Transitions != 5 {
+		t.Errorf("Counts = %+v, want 3 rejected, 5 transitions", c)
+	}
+}
+
+func TestConcurrent(t *testing.T) {
+	// Run with -race. Every Allow is either rejected or reported
+	clk := newClock()
+	b := newBreaker(Config{MinRequests: 5, FailureRate: 0.3, Cooldown: time.Millisecond, Probes: 2}, clk.now)
+	var wg sync.WaitGroup
+	for g := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range 2000 {
+				b.Do(func() error {
+					if (g+i)%3 == 0 {
+						return errBackend
+					}
+					return nil
+				})
+				if i%100 == 0 {
+					clk.advance(time.Millisecond)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if c := b.Counts(); c.Transitions == 0 || c.Rejected == 0 {
+		t.Errorf("Counts = %+v: expected the breaker to have cycled", c)
+	}
+}
+
+// ============================================================
+// Benchmarks
+// ============================================================
+
+// BenchmarkDo is the overhead a closed breaker adds to every call
+func BenchmarkDo(b *testing.B) {
+	br := New(Config{})
+	ok := func() error { return nil }
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			br.Do(ok)
+		}
+	})
+}
+
+// BenchmarkRejected is the cost of failing fast
+func BenchmarkRejected(b *testing.B) {
+	br := New(Config{MinRequests: 1, Cooldown: time.Hour})
+	br.Do(func() error { return errBackend })
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			br.Do(nil)
+		}
+	})
+}
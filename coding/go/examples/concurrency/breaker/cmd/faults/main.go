@@ -0,0 +1,202 @@
+// faults - A fault-injection harness for the circuit breaker
+//
+// A fake backend goes through a scripted incident while clients call
+// it in a loop, once with no breaker and once through one:
+//
+//   0.0s  healthy     2% errors, 5ms
+//   0.8s  outage      every call hangs until its 100ms timeout
+//   1.8s  recovering  30% errors
+//   2.4s  healthy
+//
+// Every 200ms it prints what the clients saw and what reached the
+// backend. Things to look for:
+// - Without the breaker, the outage costs every call 100ms and the
+//   backend keeps taking the full load while it is down
+// - With it, the breaker opens within a few hundred milliseconds and
+//   calls fail in microseconds; the backend sees only probes
+// - The window is short on purpose. Hanging calls come back 10 times
+//   slower than healthy ones, so failures arrive slowly, and a long
+//   window stays full of the successes from before the outage
+// - While recovering, 30% errors is under the 50% threshold, so the
+//   breaker closes again instead of flapping
+//
+// Usage:
+//   go run ./cmd/faults
+//   go run ./cmd/faults -clients 16
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bellistech/labs/coding/go/examples/concurrency/breaker"
+)
+
+// ============================================================
+// The backend
+// ============================================================
+
+type phase struct {
+	name    string
+	until   time.Duration // since the start
+	errRate float64
+	hang    bool // calls don't return until the caller times out
+}
+
+var script = []phase{
+	{"healthy", 800 * time.Millisecond, 0.02, false},
+	{"outage", 1800 * time.Millisecond, 0, true},
+	{"recovering", 2400 * time.Millisecond, 0.30, false},
+	{"healthy", 3200 * time.Millisecond, 0.02, false},
+}
+
+var errInjected = errors.New("injected failure")
+
+type backend struct {
+	start time.Time
+	calls atomic.Int64 // calls that reached it
+}
+
+func (b *backend) phase() phase {
+	elapsed := time.Since(b.start)
+	for _, p := range script {
+		if elapsed < p.until {
+			return p
+		}
+	}
+	return script[len(script)-1]
+}
+
+func (b *backend) call(ctx context.Context) error {
+	b.calls.Add(1)
+	p := b.phase()
+	if p.hang {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	select {
+	case <-time.After(5 * time.Millisecond):
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	if rand.Float64() < p.errRate {
+		return errInjected
+	}
+	return nil
+}
+
+// ============================================================
+// The clients
+// ============================================================
+
+// interval counts what happened in one reporting period
+type interval struct {
+	ok, failed, rejected atomic.Int64
+	latency              atomic.Int64 // total, in microseconds
+}
+
+func run(name string, clients int, br *breaker.Breaker) {
+	fmt.Printf("\n=== %s ===\n", name)
+	fmt.Printf("  %5s  %-10s  %-9s  %6s  %6s  %8s  %8s  %s\n",
+		"t", "backend", "breaker", "ok", "failed", "rejected", "latency", "backend calls")
+	be := &backend{start: time.Now()}
+	end := be.start.Add(script[len(script)-1].until)
+	var cur interval
+
+	call := func() error {
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		if br == nil {
+			return be.call(ctx)
+		}
+		return br.Do(func() error { return be.call(ctx) })
+	}
+
+	var wg sync.WaitGroup
+	for range clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for time.Now().Before(end) {
+				start := time.Now()
+				err := call()
+				cur.latency.Add(time.Since(start).Microseconds())
+				switch {
+				case err == nil:
+					cur.ok.Add(1)
+				case errors.Is(err, breaker.ErrOpen):
+					cur.rejected.Add(1)
+				default:
+					cur.failed.Add(1)
+				}
+				time.Sleep(10 * time.Millisecond) // think time
+			}
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+	tick := time.NewTicker(200 * time.Millisecond)
+	defer tick.Stop()
+	var lastCalls int64
+	report := func() {
+		ok, failed, rejected := cur.ok.Swap(0), cur.failed.Swap(0), cur.rejected.Swap(0)
+		lat := cur.latency.Swap(0)
+		var mean time.Duration
+		if n := ok + failed + rejected; n > 0 {
+			mean = time.Duration(lat/n) * time.Microsecond
+		}
+		state := "-"
+		if br != nil {
+			state = br.State().String()
+		}
+		calls := be.calls.Load()
+		fmt.Printf("  %4.1fs  %-10s  %-9s  %6d  %6d  %8d  %8v  %d\n",
+			time.Since(be.start).Seconds(), be.phase().name, state, ok, failed, rejected,
+			mean.Round(100*time.Microsecond), calls-lastCalls)
+		lastCalls = calls
+	}
+	for {
+		select {
+		case <-tick.C:
+			report()
+		case <-done:
+			fmt.Printf("  total backend calls: %d", be.calls.Load())
+			if br != nil {
+				fmt.Printf(", %d rejected by the breaker, %d transitions", br.Counts().Rejected, br.Counts().Transitions)
+			}
+			fmt.Println()
+			return
+		}
+	}
+}
+
+func main() {
+	clients := flag.Int("clients", 8, "concurrent clients")
+	flag.Parse()
+
+	run("No breaker", *clients, nil)
+
+	start := time.Now()
+	br := breaker.New(breaker.Config{
+		Window:      300 * time.Millisecond,
+		Buckets:     6,
+		FailureRate: 0.5,
+		MinRequests: 10,
+		Cooldown:    200 * time.Millisecond,
+		Probes:      3,
+		OnStateChange: func(from, to breaker.State) {
+			fmt.Printf("  %4.1fs  breaker %s -> %s\n", time.Since(start).Seconds(), from, to)
+		},
+	})
+	run("Breaker: 50% failures over 300ms opens it, 200ms cooldown, 3 probes", *clients, br)
+}
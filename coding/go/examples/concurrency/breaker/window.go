@@ -0,0 +1,61 @@
+package breaker
+
+import "time"
+
+// bucket counts outcomes during one slice of the window. epoch is
+// which slice, counted from the zero time, so a bucket left over from
+// an earlier lap of the ring is recognisably stale
+type bucket struct {
+	epoch     int64
+	successes int
+	failures  int
+}
+
+// window counts successes and failures over the last length of time,
+// in a ring of buckets. Old outcomes drop off a bucket at a time, so
+// the window really covers between length-width and length; more
+// buckets make it smoother and cost a little more to sum. Not safe for
+// concurrent use: the Breaker's lock covers it
+type window struct {
+	width   time.Duration
+	buckets []bucket
+}
+
+func newWindow(length time.Duration, buckets int) *window {
+	return &window{width: length / time.Duration(buckets), buckets: make([]bucket, buckets)}
+}
+
+// at returns the bucket for now, emptying it first if it is stale
+func (w *window) at(now time.Time) *bucket {
+	epoch := now.UnixNano() / int64(w.width)
+	b := &w.buckets[epoch%int64(len(w.buckets))]
+	if b.epoch != epoch {
+		*b = bucket{epoch: epoch}
+	}
+	return b
+}
+
+func (w *window) record(now time.Time, ok bool) {
+	b := w.at(now)
+	if ok {
+		b.successes++
+	} else {
+		b.failures++
+	}
+}
+
+// counts sums the buckets still inside the window
+func (w *window) counts(now time.Time) (successes, failures int) {
+	oldest := now.UnixNano()/int64(w.width) - int64(len(w.buckets)) + 1
+	for _, b := range w.buckets {
+		if b.epoch >= oldest {
+			successes += b.successes
+			failures += b.failures
+		}
+	}
+	return successes, failures
+}
+
+func (w *window) reset() {
+	clear(w.buckets)
+}
@@ -0,0 +1,356 @@
+// Concurrent BFS - Level-synchronous graph traversal with parallel workers
+//
+// Breadth-first search goes out from a source one level at a time:
+// everything one hop away, then two, and so on. Each level (the
+// frontier) is a batch of independent work, which makes BFS a good
+// exercise in structured concurrency:
+// - Split: workers claim chunks of the frontier from a shared atomic
+//   cursor, so a worker that draws hub nodes doesn't hold up the rest
+// - Deduplicate: two workers can find the same node through different
+//   parents in the same level. A concurrent visited set decides which
+//   of them owns it; only the owner records its distance and queues it
+// - Synchronize: a level ends when every worker has finished it, and
+//   the next frontier is the workers' local buffers joined together.
+//   Nothing crosses a level boundary, so no goroutine outlives its
+//   level and nothing is left running when BFS returns
+//
+// The visited set is where the contention is, so there are three to
+// compare: one mutex over a []bool; lock striping across 64 mutexes;
+// and a bitset updated with compare-and-swap, which takes no lock.
+//
+// The graph is generated: n nodes, each with edges to nearby nodes and
+// a few to random ones, like a road network with some highways. The
+// parallel result is checked against a plain sequential BFS.
+//
+// Usage:
+//   go run concurrent_bfs.go
+//   go run concurrent_bfs.go -n 2000000 -workers 8
+//   go test -race -v concurrent_bfs.go concurrent_bfs_test.go
+//   go test -run=^$ -bench=. concurrent_bfs.go concurrent_bfs_test.go
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math/rand/v2"
+	"runtime"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ============================================================
+// Graph
+// ============================================================
+
+// Graph is in compressed sparse row form: the neighbours of v are
+// edges[offsets[v]:offsets[v+1]]. Two flat slices instead of a slice
+// per node keep a million-node graph to two allocations
+type Graph struct {
+	offsets []int32
+	edges   []int32
+}
+
+func (g *Graph) Nodes() int { return len(g.offsets) - 1 }
+func (g *Graph) Edges() int { return len(g.edges) }
+
+func (g *Graph) Neighbors(v int32) []int32 {
+	return g.edges[g.offsets[v]:g.offsets[v+1]]
+}
+
+// FromAdjacency builds a Graph from a neighbour list per node
+func FromAdjacency(adj [][]int32) *Graph {
+	g := &Graph{offsets: make([]int32, 1, len(adj)+1)}
+	for _, ns := range adj {
+		g.edges = append(g.edges, ns...)
+		g.offsets = append(g.offsets, int32(len(g.edges)))
+	}
+	return g
+}
+
+// Generate makes a directed graph of n nodes. Each node links to local
+// nodes within a window of its own index, and with probability
+// far it also gets one link to a node anywhere
+func Generate(n, local int, far float64, seed uint64) *Graph {
+	rng := rand.New(rand.NewPCG(seed, seed))
+	g := &Graph{offsets: make([]int32, 1, n+1), edges: make([]int32, 0, n*(local+1))}
+	for v := range n {
+		for range local {
+			w := v + rng.IntN(64) - 32
+			if w >= 0 && w < n {
+				g.edges = append(g.edges, int32(w))
+			}
+		}
+		if rng.Float64() < far {
+			g.edges = append(g.edges, int32(rng.IntN(n)))
+		}
+		g.offsets = append(g.offsets, int32(len(g.edges)))
+	}
+	return g
+}
+
+// ============================================================
+// Sequential BFS
+// ============================================================
+
+// Unreached is the distance of a node with no path from the source
+const Unreached = -1
+
+// BFS returns every node's distance in hops from src
+func BFS(g *Graph, src int32) []int32 {
+	dist := make([]int32, g.Nodes())
+	for i := range dist {
+		dist[i] = Unreached
+	}
+	dist[src] = 0
+	queue := []int32{src}
+	for len(queue) > 0 {
+		v := queue[0]
+		queue = queue[1:]
+		for _, w := range g.Neighbors(v) {
+			if dist[w] == Unreached {
+				dist[w] = dist[v] + 1
+				queue = append(queue, w)
+			}
+		}
+	}
+	return dist
+}
+
+// ============================================================
+// Visited sets
+// ============================================================
+
+// VisitedSet is shared by every worker. TryVisit marks v and reports
+// whether this call was the one that did: of all the workers that find
+// v, exactly one gets true
+type VisitedSet interface {
+	TryVisit(v int32) bool
+}
+
+// mutexSet is the obvious version: one lock, held for a single load and
+// store, taken by every worker for every edge
+type mutexSet struct {
+	mu   sync.Mutex
+	seen []bool
+}
+
+func newMutexSet(n int) *mutexSet { return &mutexSet{seen: make([]bool, n)} }
+
+func (s *mutexSet) TryVisit(v int32) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.seen[v] {
+		return false
+	}
+	s.seen[v] = true
+	return true
+}
+
+// stripedSet guards node v with lock v%stripes, so workers only wait
+// for each other when their nodes share a stripe
+type stripedSet struct {
+	locks [64]struct {
+		sync.Mutex
+		_ [56]byte // a cache line per lock, or neighbours contend anyway
+	}
+	seen []bool
+}
+
+func newStripedSet(n int) *stripedSet { return &stripedSet{seen: make([]bool, n)} }
+
+func (s *stripedSet) TryVisit(v int32) bool {
+	l := &s.locks[v%int32(len(s.locks))]
+	l.Lock()
+	defer l.Unlock()
+	if s.seen[v] {
+		return false
+	}
+	s.seen[v] = true
+	return true
+}
+
+// bitset packs 64 nodes per word and sets a bit with compare-and-swap.
+// A plain Load first skips the CAS for nodes already visited, which by
+// the middle levels is most of them
+type bitset struct {
+	words []atomic.Uint64
+}
+
+func newBitset(n int) *bitset { return &bitset{words: make([]atomic.Uint64, (n+63)/64)} }
+
+func (s *bitset) TryVisit(v int32) bool {
+	w := &s.words[v/64]
+	bit := uint64(1) << (v % 64)
+	for {
+		old := w.Load()
+		if old&bit != 0 {
+			return false
+		}
+		// Fails if another bit in the word changed meanwhile: retry
+		if w.CompareAndSwap(old, old|bit) {
+			return true
+		}
+	}
+}
+
+// ============================================================
+// Parallel BFS
+// ============================================================
+
+// chunk is how many frontier nodes a worker claims at a time: enough
+// to make the atomic add rare, few enough to share out a small level
+const chunk = 256
+
+// Level describes one frontier, for the demo's histogram
+type Level struct {
+	Nodes int
+	Time  time.Duration
+}
+
+// ParallelBFS is BFS with each level spread over workers. It returns
+// the same distances as BFS, the size of each level, and ctx's error if
+// cancelled, which is checked between chunks
+func ParallelBFS(ctx context.Context, g *Graph, src int32, workers int, visited VisitedSet) ([]int32, []Level, error) {
+	dist := make([]int32, g.Nodes())
+	for i := range dist {
+		dist[i] = Unreached
+	}
+	visited.TryVisit(src)
+	dist[src] = 0
+	frontier := []int32{src}
+	var levels []Level
+	next := make([][]int32, workers) // per worker, reused every level
+
+	for depth := int32(1); len(frontier) > 0; depth++ {
+		start := time.Now()
+		var cursor atomic.Int64
+		var wg sync.WaitGroup
+		for w := range workers {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				local := next[w][:0]
+				for ctx.Err() == nil {
+					hi := int(cursor.Add(chunk))
+					lo := hi - chunk
+					if lo >= len(frontier) {
+						break
+					}
+					for _, v := range frontier[lo:min(hi, len(frontier))] {
+						for _, u := range g.Neighbors(v) {
+							if visited.TryVisit(u) {
+								// Only the winner writes dist[u], so the
+								// write is not shared; it happens before
+								// wg.Wait, so the next level sees it
+								dist[u] = depth
+								local = append(local, u)
+							}
+						}
+					}
+				}
+				next[w] = local
+			}()
+		}
+		wg.Wait()
+		if err := ctx.Err(); err != nil {
+			return dist, levels, err
+		}
+		levels = append(levels, Level{Nodes: len(frontier), Time: time.Since(start)})
+
+		// The next frontier is every worker's discoveries. Its order
+		// differs from run to run; the distances don't
+		frontier = frontier[:0]
+		for _, local := range next {
+			frontier = append(frontier, local...)
+		}
+	}
+	return dist, levels, nil
+}
+
+// ============================================================
+// Demo
+// ============================================================
+
+type setKind struct {
+	name string
+	make func(n int) VisitedSet
+}
+
+var setKinds = []setKind{
+	{"mutex", func(n int) VisitedSet { return newMutexSet(n) }},
+	{"striped", func(n int) VisitedSet { return newStripedSet(n) }},
+	{"atomic bitset", func(n int) VisitedSet { return newBitset(n) }},
+}
+
+func main() {
+	n := flag.Int("n", 1_000_000, "nodes")
+	workers := flag.Int("workers", runtime.GOMAXPROCS(0), "workers for the level histogram")
+	flag.Parse()
+
+	start := time.Now()
+	g := Generate(*n, 4, 0.02, 1)
+	fmt.Printf("=== %d nodes, %d edges, generated in %v ===\n", g.Nodes(), g.Edges(), time.Since(start).Round(time.Millisecond))
+
+	start = time.Now()
+	want := BFS(g, 0)
+	seqTime := time.Since(start)
+	reached := 0
+	for _, d := range want {
+		if d != Unreached {
+			reached++
+		}
+	}
+	fmt.Printf("  sequential: %v, %d nodes reached\n", seqTime.Round(time.Millisecond), reached)
+
+	fmt.Printf("\n=== Frontier per level: atomic bitset, workers=%d ===\n", *workers)
+	_, levels, _ := ParallelBFS(context.Background(), g, 0, *workers, newBitset(g.Nodes()))
+	widest := 0
+	for _, l := range levels {
+		widest = max(widest, l.Nodes)
+	}
+	for i, l := range levels {
+		if len(levels) > 24 && i%(len(levels)/24+1) != 0 && i != len(levels)-1 {
+			continue // keep it to a screen
+		}
+		bar := max(1, l.Nodes*40/widest)
+		fmt.Printf("  %4d %8d %-40s %v\n", i, l.Nodes, string(slices.Repeat([]byte{'#'}, bar)), l.Time.Round(time.Microsecond))
+	}
+	fmt.Printf("  %d levels. The narrow ones at each end are mostly overhead:\n", len(levels))
+	fmt.Println("  starting and joining workers for a handful of nodes")
+
+	fmt.Printf("\n=== Visited sets x workers (sequential: %v) ===\n", seqTime.Round(time.Millisecond))
+	fmt.Printf("  %-14s", "workers")
+	counts := []int{1, 2, 4, 8}
+	for _, w := range counts {
+		fmt.Printf(" %10d", w)
+	}
+	fmt.Println()
+	for _, k := range setKinds {
+		fmt.Printf("  %-14s", k.name)
+		for _, w := range counts {
+			start := time.Now()
+			got, _, _ := ParallelBFS(context.Background(), g, 0, w, k.make(g.Nodes()))
+			elapsed := time.Since(start)
+			mark := ""
+			if !slices.Equal(got, want) {
+				mark = " WRONG"
+			}
+			fmt.Printf(" %10v%s", elapsed.Round(time.Millisecond), mark)
+		}
+		fmt.Println()
+	}
+
+	fmt.Println()
+	if runtime.NumCPU() == 1 {
+		fmt.Println("  One CPU: extra workers only take turns, so more of them costs")
+		fmt.Println("  time. What is left to see is the cost of each set's TryVisit.")
+	} else {
+		fmt.Println("  The mutex set serialises every edge and gets slower with workers;")
+		fmt.Println("  striping spreads the lock; the bitset has none to contend for.")
+	}
+	fmt.Println("  All of them pay for synchronisation the sequential BFS never does,")
+	fmt.Println("  so it takes a few cores before any of them beat it.")
+}
@@ -0,0 +1,148 @@
+// Concurrent BFS Tests - Distances against sequential BFS, every set, under -race
+//
+// Sequential BFS is simple enough to trust, so it is the oracle: for
+// small hand-made graphs with the awkward cases (self loops, duplicate
+// edges, unreachable nodes) and for generated graphs, every visited set
+// at every worker count must give the same distances. The race
+// detector checks the claim that only the winner of TryVisit writes.
+//
+// Usage:
+//   go test -race -v concurrent_bfs.go concurrent_bfs_test.go
+//   go test -run=^$ -bench=. concurrent_bfs.go concurrent_bfs_test.go
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+func TestSequentialBFS(t *testing.T) {
+	tests := []struct {
+		name string
+		adj  [][]int32
+		want []int32
+	}{
+		{"single node", [][]int32{{}}, []int32{0}},
+		{"line", [][]int32{{1}, {2}, {3}, {}}, []int32{0, 1, 2, 3}},
+		{"star", [][]int32{{1, 2, 3}, {}, {}, {}}, []int32{0, 1, 1, 1}},
+		{"shortcut wins", [][]int32{{1, 3}, {2}, {3}, {}}, []int32{0, 1, 2, 1}},
+		{"self loops and duplicates", [][]int32{{0, 1, 1}, {1, 0}}, []int32{0, 1}},
+		{"unreachable", [][]int32{{1}, {}, {1}}, []int32{0, 1, Unreached}},
+		{"directed", [][]int32{{}, {0}}, []int32{0, Unreached}},
+	}
+	for _, tt := range tests {
+		if got := BFS(FromAdjacency(tt.adj), 0); !slices.Equal(got, tt.want) {
+			t.Errorf("%s: got %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestParallelMatchesSequential(t *testing.T) {
+	graphs := map[string]*Graph{
+		"local":   Generate(20_000, 4, 0, 1),    // long and thin: many small levels
+		"highway": Generate(20_000, 4, 0.2, 2),  // short and wide
+		"sparse":  Generate(20_000, 1, 0.05, 3), // much of it unreachable
+	}
+	for name, g := range graphs {
+		want := BFS(g, 0)
+		for _, k := range setKinds {
+			for _, workers := range []int{1, 3, 8} {
+				t.Run(fmt.Sprintf("%s/%s/%d", name, k.name, workers), func(t *testing.T) {
+					got, levels, err := ParallelBFS(context.Background(), g, 0, workers, k.make(g.Nodes()))
+					if err != nil {
+						t.Fatal(err)
+					}
+					if !slices.Equal(got, want) {
+						t.Fatal("distances differ from sequential BFS")
+					}
+					// Every reached node is in exactly one level
+					total := 0
+					for _, l := range levels {
+						total += l.Nodes
+					}
+					if reached := len(want) - count(want, Unreached); total != reached {
+						t.Errorf("levels hold %d nodes, %d were reached", total, reached)
+					}
+				})
+			}
+		}
+	}
+}
+
+func count(s []int32, v int32) int {
+	n := 0
+	for _, x := range s {
+		if x == v {
+			n++
+		}
+	}
+	return n
+}
+
+func TestTryVisitOnce(t *testing.T) {
+	// Many goroutines race for the same nodes; each node has one winner.
+	// The bitset's nodes share words, so a CAS can fail for a neighbour's
+	// bit and must retry rather than give up
+	const n, goroutines = 1000, 8
+	for _, k := range setKinds {
+		t.Run(k.name, func(t *testing.T) {
+			s := k.make(n)
+			var wins [n]atomic.Int32
+			var wg sync.WaitGroup
+			for range goroutines {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for v := range int32(n) {
+						if s.TryVisit(v) {
+							wins[v].Add(1)
+						}
+					}
+				}()
+			}
+			wg.Wait()
+			for v := range wins {
+				if w := wins[v].Load(); w != 1 {
+					t.Fatalf("node %d won %d times", v, w)
+				}
+			}
+		})
+	}
+}
+
+func TestCancel(t *testing.T) {
+	g := Generate(50_000, 4, 0, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, levels, err := ParallelBFS(ctx, g, 0, 4, newBitset(g.Nodes()))
+	if !errors.Is(err, context.Canceled) || len(levels) != 0 {
+		t.Errorf("err = %v after %d levels, want Canceled before the first ends", err, len(levels))
+	}
+}
+
+// ============================================================
+// Benchmarks
+// ============================================================
+
+func BenchmarkBFS(b *testing.B) {
+	g := Generate(200_000, 4, 0.02, 1)
+	b.Run("sequential", func(b *testing.B) {
+		for range b.N {
+			BFS(g, 0)
+		}
+	})
+	for _, k := range setKinds {
+		for _, workers := range []int{1, 4} {
+			b.Run(fmt.Sprintf("%s/workers-%d", k.name, workers), func(b *testing.B) {
+				for range b.N {
+					ParallelBFS(context.Background(), g, 0, workers, k.make(g.Nodes()))
+				}
+			})
+		}
+	}
+}
@@ -6,42 +6,82 @@
 // - Pass request-scoped values
 //
 // This example demonstrates graceful shutdown of multiple goroutines
-// using context cancellation.
+// using context cancellation, plus timeouts and deadlines.
 //
 // Usage:
-//   go run context_cancel.go
+//   go run context_cancel.go            # signal-driven shutdown
 //   (Press Ctrl+C to trigger shutdown)
+//   go run context_cancel.go timeout    # WithTimeout / WithDeadline
+//   go run context_cancel.go values     # request-scoped values
+//   go run context_cancel.go group      # first error cancels the rest
+//   go run context_cancel.go cause      # WithCancelCause: why did we stop?
+//   go run context_cancel.go heartbeat  # supervisor restarts stalled workers
+//   go run context_cancel.go afterfunc  # cleanup with context.AfterFunc
+//   go run context_cancel.go http       # client abort stops server work
+//
+// The group mode builds errgroup's first-error cancellation from the
+// standard library. The errgroup version is errgroup/errgroup.go, a
+// module of its own because golang.org/x/sync isn't in the standard
+// library.
 package main
 
 import (
+	"bufio"
 	"context"
+	"errors"
 	"fmt"
+	"log/slog"
 	"math/rand"
+	"net"
+	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"sync"
 	"syscall"
 	"time"
 )
 
 func main() {
+	mode := "signal"
+	if len(os.Args) > 1 {
+		mode = os.Args[1]
+	}
+
+	switch mode {
+	case "signal":
+		signalDemo()
+	case "timeout":
+		timeoutDemo()
+	case "values":
+		valuesDemo()
+	case "group":
+		groupDemo()
+	case "cause":
+		causeDemo()
+	case "heartbeat":
+		heartbeatDemo()
+	case "afterfunc":
+		afterFuncDemo()
+	case "http":
+		httpDemo()
+	default:
+		fmt.Println("Usage: go run context_cancel.go [signal|timeout|values|group|cause|heartbeat|afterfunc|http]")
+		os.Exit(1)
+	}
+}
+
+// signalDemo cancels every worker when the process receives Ctrl+C
+func signalDemo() {
 	fmt.Println("=== Context Cancellation Demo ===")
 	fmt.Println("Press Ctrl+C to trigger graceful shutdown")
 	fmt.Println()
 
-	// Create cancellable context
-	ctx, cancel := context.WithCancel(context.Background())
+	// Create cancellable context; the cause records why it was cancelled
+	ctx, cancel := context.WithCancelCause(context.Background())
 
 	// Handle OS signals (Ctrl+C)
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-
-	go func() {
-		sig := <-sigChan
-		fmt.Printf("\nReceived signal: %v\n", sig)
-		fmt.Println("Cancelling all workers...")
-		cancel()
-	}()
+	cancelOnSignal(cancel)
 
 	// Start workers
 	var wg sync.WaitGroup
@@ -68,9 +108,13 @@ func worker(ctx context.Context, id int, wg *sync.WaitGroup) {
 	for {
 		select {
 		case <-ctx.Done():
-			// Context cancelled - clean up and exit
+			// Context cancelled - clean up and exit. ctx.Err() only says
+			// "canceled"; context.Cause says why.
 			fmt.Printf("Worker %d stopping (processed %d items): %v\n",
 				id, count, ctx.Err())
+			if cause := context.Cause(ctx); cause != ctx.Err() {
+				fmt.Printf("Worker %d: cause: %v\n", id, cause)
+			}
 			return
 
 		case <-ticker.C:
@@ -80,3 +124,664 @@ func worker(ctx context.Context, id int, wg *sync.WaitGroup) {
 		}
 	}
 }
+
+// timeoutDemo shows the two ways a context ends on its own schedule
+// and how to tell them apart from an explicit cancel
+func timeoutDemo() {
+	fmt.Println("=== Timeouts and Deadlines ===")
+	fmt.Println()
+
+	// 1. WithTimeout: cancelled automatically after a duration
+	fmt.Println("1. WithTimeout(1.5s) - workers run until the timer fires")
+	ctx, cancel := context.WithTimeout(context.Background(), 1500*time.Millisecond)
+	runWorkers(ctx, 2)
+	cancel() // always call cancel, even after the timeout, to free the timer
+	describeErr(ctx.Err())
+
+	// 2. WithDeadline: the same thing, expressed as a wall-clock time
+	fmt.Println()
+	fmt.Println("2. WithDeadline(now+3s), cancelled explicitly after 1s")
+	deadline := time.Now().Add(3 * time.Second)
+	ctx, cancel = context.WithDeadline(context.Background(), deadline)
+	if d, ok := ctx.Deadline(); ok {
+		fmt.Printf("   Deadline in %v\n", time.Until(d).Round(100*time.Millisecond))
+	}
+	time.AfterFunc(time.Second, cancel)
+	runWorkers(ctx, 2)
+	cancel()
+	describeErr(ctx.Err())
+
+	// 3. A per-operation timeout: the error comes back from the call
+	fmt.Println()
+	fmt.Println("3. Per-operation timeout of 500ms")
+	for _, d := range []time.Duration{200 * time.Millisecond, 800 * time.Millisecond} {
+		ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+		err := slowOperation(ctx, d)
+		cancel()
+
+		fmt.Printf("   operation taking %v: ", d)
+		if err == nil {
+			fmt.Println("ok")
+			continue
+		}
+		fmt.Printf("%v\n", err)
+		describeErr(err)
+	}
+
+	// 4. A child can shorten its parent's deadline, never extend it
+	fmt.Println()
+	fmt.Println("4. Child WithTimeout(5s) under a parent WithTimeout(300ms)")
+	parent, cancelParent := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancelParent()
+	child, cancelChild := context.WithTimeout(parent, 5*time.Second)
+	defer cancelChild()
+	start := time.Now()
+	<-child.Done()
+	fmt.Printf("   child done after %v: %v\n", time.Since(start).Round(10*time.Millisecond), child.Err())
+}
+
+// runWorkers starts n workers on ctx and waits for them to stop
+func runWorkers(ctx context.Context, n int) {
+	var wg sync.WaitGroup
+	for i := 1; i <= n; i++ {
+		wg.Add(1)
+		go worker(ctx, i, &wg)
+	}
+	wg.Wait()
+}
+
+// slowOperation simulates a call that takes d unless ctx ends first.
+// It wraps ctx.Err() so callers must use errors.Is, not ==.
+func slowOperation(ctx context.Context, d time.Duration) error {
+	select {
+	case <-time.After(d):
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("slow operation: %w", ctx.Err())
+	}
+}
+
+// describeErr distinguishes a deadline from an explicit cancel
+func describeErr(err error) {
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		fmt.Println("   -> deadline exceeded: the operation ran out of time (retry or raise the timeout)")
+	case errors.Is(err, context.Canceled):
+		fmt.Println("   -> canceled: someone called cancel() (stop quietly, nobody wants the result)")
+	case err == nil:
+		fmt.Println("   -> context still active")
+	default:
+		fmt.Printf("   -> other error: %v\n", err)
+	}
+}
+
+// ctxKey is unexported, so no other package can construct a key that
+// collides with ours - even if it also uses the number 0 or a string
+// like "request_id"
+type ctxKey int
+
+const (
+	requestIDKey ctxKey = iota
+	loggerKey
+)
+
+// WithRequestID returns a child context carrying the request ID
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey, id)
+}
+
+// RequestID extracts the request ID, if any. Typed accessors like this
+// keep the type assertion in one place.
+func RequestID(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(requestIDKey).(string)
+	return id, ok
+}
+
+// WithLogger returns a child context carrying a request-scoped logger
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey, logger)
+}
+
+// Logger returns the request logger, falling back to the default so
+// callers never have to nil-check
+func Logger(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
+
+// valuesDemo threads a request ID and logger through a call chain
+// without adding parameters to every function in between
+func valuesDemo() {
+	fmt.Println("=== Request-Scoped Values ===")
+	fmt.Println()
+
+	base := slog.New(slog.NewTextHandler(os.Stdout, &slog.HandlerOptions{
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			if a.Key == slog.TimeKey {
+				return slog.Attr{} // keep the output short
+			}
+			return a
+		},
+	}))
+
+	fmt.Println("1. Propagating request ID and logger")
+	for _, id := range []string{"req-001", "req-002"} {
+		// At the edge (e.g. HTTP middleware) attach request-scoped data once
+		ctx := WithRequestID(context.Background(), id)
+		ctx = WithLogger(ctx, base.With("request_id", id))
+		handleRequest(ctx, 42)
+	}
+
+	fmt.Println()
+	fmt.Println("2. Unexported key types prevent collisions")
+	ctx := WithRequestID(context.Background(), "ours")
+	// Another package using a plain string key with the "same" name
+	ctx = context.WithValue(ctx, "request_id", "theirs") // deliberately bad: built-in key type
+	id, _ := RequestID(ctx)
+	fmt.Printf("   RequestID(ctx) = %q, ctx.Value(\"request_id\") = %q\n", id, ctx.Value("request_id"))
+
+	fmt.Println()
+	fmt.Println("3. Values are immutable: children shadow, parents never see changes")
+	parent := WithRequestID(context.Background(), "parent-id")
+	child := WithRequestID(parent, "child-id")
+	p, _ := RequestID(parent)
+	c, _ := RequestID(child)
+	fmt.Printf("   parent=%q child=%q\n", p, c)
+	// Storing a pointer (e.g. *map) to "update" a value later just moves
+	// the problem: every goroutine holding ctx now shares mutable state.
+
+	fmt.Println()
+	fmt.Println("4. Not for optional parameters")
+	// BAD: a hidden input that callers can't see in the signature
+	//   limit, _ := ctx.Value("page_size").(int)
+	// GOOD: make it a parameter; use ctx only for data that crosses
+	// API boundaries and belongs to the request (IDs, auth, tracing)
+	fmt.Println("   listUsers(ctx, pageSize) - not ctx.Value(\"page_size\")")
+	_, ok := RequestID(context.Background())
+	fmt.Printf("   missing value is reported, not zero-valued silently: ok=%v\n", ok)
+}
+
+// handleRequest -> loadUser -> queryDB: none of them take a request ID
+// or logger parameter, yet all of them log with it
+func handleRequest(ctx context.Context, userID int) {
+	Logger(ctx).Info("handling request", "user_id", userID)
+	loadUser(ctx, userID)
+}
+
+func loadUser(ctx context.Context, userID int) {
+	Logger(ctx).Info("loading user", "user_id", userID)
+	queryDB(ctx, "SELECT * FROM users WHERE id = ?")
+}
+
+func queryDB(ctx context.Context, query string) {
+	id, _ := RequestID(ctx)
+	// The ID can also be forwarded, e.g. as a SQL comment for tracing
+	Logger(ctx).Info("query", "sql", fmt.Sprintf("/* %s */ %s", id, query))
+}
+
+// errTaskFailed is what task 4 returns in the group demo
+var errTaskFailed = errors.New("disk full")
+
+// task simulates a unit of work that honours ctx. Task failID fails
+// partway through instead of finishing.
+func task(ctx context.Context, id, failID int) error {
+	// Don't start work the group no longer wants
+	if err := ctx.Err(); err != nil {
+		fmt.Printf("  task %d skipped: %v\n", id, err)
+		return err
+	}
+
+	fmt.Printf("  task %d started\n", id)
+	select {
+	case <-time.After(time.Duration(200+rand.Intn(200)) * time.Millisecond):
+	case <-ctx.Done():
+		fmt.Printf("  task %d interrupted: %v\n", id, ctx.Err())
+		return ctx.Err()
+	}
+
+	if id == failID {
+		fmt.Printf("  task %d failed\n", id)
+		return fmt.Errorf("task %d: %w", id, errTaskFailed)
+	}
+	fmt.Printf("  task %d done\n", id)
+	return nil
+}
+
+// groupDemo runs six tasks two at a time; task 4 fails and the rest
+// are cancelled
+func groupDemo() {
+	const numTasks, limit, failID = 6, 2, 4
+
+	fmt.Println("=== WaitGroup + cancel: the first error stops the group ===")
+	fmt.Println()
+
+	err := manualGroup(numTasks, limit, failID)
+	fmt.Printf("result = %v (is errTaskFailed: %v)\n", err, errors.Is(err, errTaskFailed))
+
+	// The manual version needs a WaitGroup, a cancel func, a sync.Once
+	// for the first error, and a semaphore channel for the limit -
+	// four moving parts errgroup.WithContext and SetLimit fold into Go
+	// and Wait.
+	fmt.Println()
+	fmt.Println("The same with errgroup.WithContext + SetLimit:")
+	fmt.Println("  cd errgroup && go run . limit")
+}
+
+// manualGroup reproduces errgroup semantics with primitives: the
+// first error cancels ctx, which is how the other tasks hear about it
+func manualGroup(numTasks, limit, failID int) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	sem := make(chan struct{}, limit)
+
+	for i := 1; i <= numTasks; i++ {
+		sem <- struct{}{} // acquire a slot, like SetLimit
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			if err := task(ctx, i, failID); err != nil {
+				// Only the first error is kept, and it cancels the rest
+				errOnce.Do(func() {
+					firstErr = err
+					cancel()
+				})
+			}
+		}()
+	}
+
+	wg.Wait()
+	return firstErr
+}
+
+// Causes a context can be cancelled with. Sentinel errors let workers
+// react differently, via errors.Is on context.Cause(ctx).
+var (
+	errShutdownSignal = errors.New("shutdown signal received")
+	errFatal          = errors.New("fatal worker error")
+)
+
+// cancelOnSignal cancels with a cause naming the signal on Ctrl+C
+func cancelOnSignal(cancel context.CancelCauseFunc) {
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+
+	go func() {
+		sig := <-sigChan
+		fmt.Printf("\nReceived signal: %v\n", sig)
+		fmt.Println("Cancelling all workers...")
+		cancel(fmt.Errorf("%w: %v", errShutdownSignal, sig))
+	}()
+}
+
+// causeDemo runs healthy workers next to one that hits a fatal error
+// and cancels its siblings, passing the reason along as the cause
+func causeDemo() {
+	fmt.Println("=== Cancellation Causes ===")
+	fmt.Println("Worker 3 fails after a few ticks; Ctrl+C stops everyone sooner")
+	fmt.Println()
+
+	ctx, cancel := context.WithCancelCause(context.Background())
+	defer cancel(nil) // nil cause means plain context.Canceled
+
+	cancelOnSignal(cancel)
+
+	var wg sync.WaitGroup
+	for i := 1; i <= 2; i++ {
+		wg.Add(1)
+		go worker(ctx, i, &wg)
+	}
+
+	wg.Add(1)
+	go fragileWorker(ctx, 3, cancel, &wg)
+
+	wg.Wait()
+
+	// Only the first cause sticks; later cancel calls are no-ops
+	cause := context.Cause(ctx)
+	fmt.Println()
+	fmt.Printf("ctx.Err()         = %v\n", ctx.Err())
+	fmt.Printf("context.Cause(ctx) = %v\n", cause)
+	switch {
+	case errors.Is(cause, errShutdownSignal):
+		fmt.Println("-> clean shutdown, exit 0")
+	case errors.Is(cause, errFatal):
+		fmt.Println("-> a worker failed, exit non-zero and alert")
+	}
+}
+
+// fragileWorker does a few ticks of work, then hits an error it can't
+// recover from and takes the whole group down with a descriptive cause
+func fragileWorker(ctx context.Context, id int, cancel context.CancelCauseFunc, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	fmt.Printf("Worker %d started (fragile)\n", id)
+	ticker := time.NewTicker(400 * time.Millisecond)
+	defer ticker.Stop()
+
+	for count := 1; ; count++ {
+		select {
+		case <-ctx.Done():
+			fmt.Printf("Worker %d stopping: %v\n", id, context.Cause(ctx))
+			return
+		case <-ticker.C:
+			if count == 5 {
+				err := fmt.Errorf("worker %d: %w: lost database connection on tick %d", id, errFatal, count)
+				fmt.Printf("Worker %d: %v - cancelling siblings\n", id, err)
+				cancel(err)
+				return
+			}
+			fmt.Printf("Worker %d: tick #%d\n", id, count)
+		}
+	}
+}
+
+// errStalled is the cause a supervisor cancels a silent worker with
+var errStalled = errors.New("worker stalled: no heartbeat")
+
+// heartbeat is what a worker sends to prove it is still making progress
+type heartbeat struct {
+	id         int
+	generation int
+}
+
+// supervisedWorker tracks one running worker so it can be replaced
+type supervisedWorker struct {
+	generation int
+	lastBeat   time.Time
+	cancel     context.CancelCauseFunc
+	done       chan struct{}
+}
+
+// heartbeatDemo runs workers under a supervisor that restarts any
+// worker whose heartbeats stop for longer than stallAfter
+func heartbeatDemo() {
+	const (
+		numWorkers  = 3
+		beatEvery   = 200 * time.Millisecond
+		stallAfter  = 700 * time.Millisecond
+		maxRestarts = 2
+		runFor      = 5 * time.Second
+	)
+
+	fmt.Println("=== Heartbeats and Stall Detection ===")
+	fmt.Printf("Worker 2 hangs on its 3rd tick; stall threshold %v\n", stallAfter)
+	fmt.Println()
+
+	ctx, cancel := context.WithTimeout(context.Background(), runFor)
+	defer cancel()
+
+	beats := make(chan heartbeat, numWorkers)
+	workers := make(map[int]*supervisedWorker)
+	restarts := 0
+
+	start := func(id, generation int) {
+		wctx, wcancel := context.WithCancelCause(ctx)
+		w := &supervisedWorker{
+			generation: generation,
+			lastBeat:   time.Now(),
+			cancel:     wcancel,
+			done:       make(chan struct{}),
+		}
+		workers[id] = w
+
+		// Only the first incarnation of worker 2 gets stuck
+		hangOnTick := 0
+		if id == 2 && generation == 1 {
+			hangOnTick = 3
+		}
+		go func() {
+			defer close(w.done)
+			beatingWorker(wctx, id, generation, beatEvery, hangOnTick, beats)
+		}()
+	}
+
+	for id := 1; id <= numWorkers; id++ {
+		start(id, 1)
+	}
+
+	// The supervisor loop: record beats, check for silence
+	check := time.NewTicker(stallAfter / 2)
+	defer check.Stop()
+
+	for {
+		select {
+		case hb := <-beats:
+			// Ignore late beats from a worker that was already replaced
+			if w, ok := workers[hb.id]; ok && w.generation == hb.generation {
+				w.lastBeat = time.Now()
+			}
+
+		case now := <-check.C:
+			for id, w := range workers {
+				silent := now.Sub(w.lastBeat)
+				if silent < stallAfter {
+					continue
+				}
+
+				fmt.Printf("Supervisor: worker %d silent for %v, cancelling\n",
+					id, silent.Round(10*time.Millisecond))
+				w.cancel(fmt.Errorf("%w for %v", errStalled, silent.Round(10*time.Millisecond)))
+				<-w.done // make sure the old one is gone before replacing it
+
+				if restarts == maxRestarts {
+					fmt.Printf("Supervisor: restart budget spent, giving up on worker %d\n", id)
+					delete(workers, id)
+					continue
+				}
+				restarts++
+				fmt.Printf("Supervisor: restarting worker %d (generation %d)\n", id, w.generation+1)
+				start(id, w.generation+1)
+			}
+
+		case <-ctx.Done():
+			fmt.Println()
+			fmt.Println("Supervisor: time's up, stopping all workers")
+			for _, w := range workers {
+				<-w.done
+			}
+			fmt.Printf("Restarts performed: %d\n", restarts)
+			return
+		}
+	}
+}
+
+// beatingWorker ticks and sends a heartbeat after each unit of work.
+// On hangOnTick it blocks as if stuck in a call with no timeout; only
+// cancellation frees it.
+func beatingWorker(ctx context.Context, id, generation int, every time.Duration, hangOnTick int, beats chan<- heartbeat) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+
+	for tick := 1; ; tick++ {
+		select {
+		case <-ctx.Done():
+			fmt.Printf("Worker %d.%d stopping: %v\n", id, generation, context.Cause(ctx))
+			return
+		case <-ticker.C:
+		}
+
+		if tick == hangOnTick {
+			fmt.Printf("Worker %d.%d: stuck!\n", id, generation)
+			<-ctx.Done()
+			fmt.Printf("Worker %d.%d unstuck by supervisor: %v\n", id, generation, context.Cause(ctx))
+			return
+		}
+
+		select {
+		case beats <- heartbeat{id: id, generation: generation}:
+		case <-ctx.Done():
+		}
+	}
+}
+
+// afterFuncDemo registers cleanup that runs only if a context is
+// cancelled (Go 1.21+). The function runs in its own goroutine, and
+// the returned stop func unregisters it when cleanup isn't needed.
+func afterFuncDemo() {
+	fmt.Println("=== Cleanup with context.AfterFunc ===")
+	fmt.Println()
+
+	// 1. Close and remove a temp file when the operation is cancelled
+	fmt.Println("1. Cancelled: AfterFunc closes the file")
+	ctx, cancel := context.WithCancel(context.Background())
+
+	f, err := os.CreateTemp("", "afterfunc-*.txt")
+	if err != nil {
+		fmt.Printf("   CreateTemp: %v\n", err)
+		return
+	}
+	cleaned := make(chan struct{})
+	context.AfterFunc(ctx, func() {
+		defer close(cleaned)
+		f.Close()
+		os.Remove(f.Name())
+		fmt.Printf("   cleanup ran: closed and removed %s\n", f.Name())
+	})
+
+	fmt.Fprintln(f, "partial output")
+	cancel()
+	<-cleaned // AfterFunc runs asynchronously; wait to keep the output ordered
+
+	// 2. Finished normally: stop() prevents the cleanup from running
+	fmt.Println()
+	fmt.Println("2. Completed: stop() unregisters the flush-on-cancel")
+	ctx, cancel = context.WithCancel(context.Background())
+	defer cancel()
+
+	w := bufio.NewWriter(os.Stdout)
+	stop := context.AfterFunc(ctx, func() {
+		// Best-effort flush of what we have if we're cut short
+		w.Flush()
+	})
+
+	fmt.Fprintln(w, "   buffered line written by the job")
+	if stop() {
+		// true: we unregistered it before it ran, so it's ours to finish
+		fmt.Fprintln(w, "   stop() = true: job finished, flushing normally")
+		w.Flush()
+	}
+
+	// 3. stop() after the function already started reports false
+	fmt.Println()
+	fmt.Println("3. stop() after cancellation")
+	ctx, cancel = context.WithCancel(context.Background())
+	ran := make(chan struct{})
+	stop = context.AfterFunc(ctx, func() { close(ran) })
+	cancel()
+	<-ran
+	fmt.Printf("   stop() = %v: too late, the function already ran\n", stop())
+
+	// 4. Unblock a call that knows nothing about contexts
+	fmt.Println()
+	fmt.Println("4. Interrupting a blocking Read via SetReadDeadline")
+	ctx, cancel = context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+
+	client, server := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+
+	stop = context.AfterFunc(ctx, func() {
+		// A past deadline makes the pending Read return immediately
+		client.SetReadDeadline(time.Now())
+	})
+	defer stop()
+
+	start := time.Now()
+	buf := make([]byte, 16)
+	_, err = client.Read(buf) // nobody ever writes to server
+	fmt.Printf("   Read returned after %v: %v\n", time.Since(start).Round(10*time.Millisecond), err)
+	fmt.Printf("   timeout error: %v, ctx: %v\n", errors.Is(err, os.ErrDeadlineExceeded), ctx.Err())
+}
+
+// httpDemo connects context cancellation to its most common use: the
+// server stops expensive work as soon as the client hangs up
+func httpDemo() {
+	fmt.Println("=== HTTP Request Cancellation ===")
+	fmt.Println()
+
+	// The handler reports how each request ended, so the demo can
+	// show what happened on the server side
+	outcomes := make(chan string, 1)
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/report", func(w http.ResponseWriter, r *http.Request) {
+		steps, _ := strconv.Atoi(r.URL.Query().Get("steps"))
+
+		// r.Context() is cancelled when the client disconnects, the
+		// request's HTTP/2 stream is reset, or ServeHTTP returns
+		ctx := r.Context()
+		for step := 1; step <= steps; step++ {
+			select {
+			case <-time.After(200 * time.Millisecond): // one expensive step
+				fmt.Printf("   server: finished step %d/%d\n", step, steps)
+			case <-ctx.Done():
+				outcomes <- fmt.Sprintf("stopped at step %d/%d: %v", step, steps, ctx.Err())
+				return // nobody is listening; don't waste the remaining steps
+			}
+		}
+
+		fmt.Fprintf(w, "report complete after %d steps\n", steps)
+		outcomes <- "completed all steps"
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		fmt.Printf("Listen: %v\n", err)
+		return
+	}
+	srv := &http.Server{Handler: mux}
+	go srv.Serve(ln)
+	defer srv.Close()
+
+	base := "http://" + ln.Addr().String()
+
+	// 1. A request that is allowed to finish
+	fmt.Println("1. Client waits for a 2-step report")
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	err = fetch(ctx, base+"/report?steps=2")
+	cancel()
+	fmt.Printf("   client: err=%v\n", err)
+	fmt.Printf("   server: %s\n", <-outcomes)
+
+	// 2. A request the client gives up on after 500ms
+	fmt.Println()
+	fmt.Println("2. Client gives up on a 10-step report after 500ms")
+	ctx, cancel = context.WithTimeout(context.Background(), 500*time.Millisecond)
+	start := time.Now()
+	err = fetch(ctx, base+"/report?steps=10")
+	cancel()
+	fmt.Printf("   client: gave up after %v: %v\n", time.Since(start).Round(10*time.Millisecond), err)
+	fmt.Printf("   client: deadline exceeded? %v\n", errors.Is(err, context.DeadlineExceeded))
+	fmt.Printf("   server: %s\n", <-outcomes)
+}
+
+// fetch issues a GET bound to ctx: cancelling ctx closes the
+// connection, which is what the server observes as r.Context() ending
+func fetch(ctx context.Context, url string) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body := make([]byte, 128)
+	n, _ := resp.Body.Read(body)
+	fmt.Printf("   client: %s %q\n", resp.Status, body[:n])
+	return nil
+}
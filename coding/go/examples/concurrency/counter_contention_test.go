@@ -0,0 +1,101 @@
+// Counter Contention Tests - Exact counts under -race, per-goroutine-count benchmarks
+//
+// A counter that drops increments under contention would top every
+// benchmark, so correctness is tested first, with the race detector
+// watching. The benchmarks then split b.N increments over a growing
+// number of goroutines; -cpu varies how many of them can run at once.
+//
+// Usage:
+//   go test -race -v counter_contention.go counter_contention_test.go
+//   go test -run=^$ -bench=. -cpu=1,4,8 counter_contention.go counter_contention_test.go
+package main
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestCountersExact(t *testing.T) {
+	const goroutines, each = 16, 5000
+	for _, k := range kinds {
+		t.Run(k.name, func(t *testing.T) {
+			c := k.make()
+			var wg sync.WaitGroup
+			for id := range goroutines {
+				wg.Go(func() {
+					for range each {
+						c.Inc(id)
+					}
+				})
+			}
+			wg.Wait()
+			if got := c.Load(); got != goroutines*each {
+				t.Errorf("Load = %d, want %d", got, goroutines*each)
+			}
+		})
+	}
+}
+
+func TestShardsRoundUp(t *testing.T) {
+	c := NewShardedCounter()
+	if n := len(c.shards); n&(n-1) != 0 || n < 1 {
+		t.Errorf("%d shards, want a power of two", n)
+	}
+	// Ids beyond the shard count wrap, rather than index out of range
+	c.Inc(len(c.shards) + 3)
+	c.Inc(-1)
+	if got := c.Load(); got != 2 {
+		t.Errorf("Load = %d, want 2", got)
+	}
+}
+
+func TestHammer(t *testing.T) {
+	// hammer panics if the count and the tallies disagree
+	for _, k := range kinds {
+		if r := hammer(k.make(), 4, 5*time.Millisecond); r <= 0 {
+			t.Errorf("%s: %f ops/s", k.name, r)
+		}
+	}
+}
+
+// ============================================================
+// Benchmarks
+// ============================================================
+
+func BenchmarkInc(b *testing.B) {
+	for _, k := range kinds {
+		for _, g := range []int{1, 4, 16, 64} {
+			b.Run(fmt.Sprintf("%s/goroutines-%d", k.name, g), func(b *testing.B) {
+				c := k.make()
+				var wg sync.WaitGroup
+				for id := range g {
+					n := b.N / g
+					if id < b.N%g {
+						n++
+					}
+					wg.Go(func() {
+						for range n {
+							c.Inc(id)
+						}
+					})
+				}
+				wg.Wait()
+			})
+		}
+	}
+}
+
+// BenchmarkLoad is the other side of sharding: a read costs a pass over
+// every shard
+func BenchmarkLoad(b *testing.B) {
+	for _, k := range kinds {
+		b.Run(k.name, func(b *testing.B) {
+			c := k.make()
+			for range b.N {
+				c.Load()
+			}
+		})
+	}
+}
@@ -0,0 +1,631 @@
+// Cron Scheduler - Cron expressions, a min-heap of next runs, overlap policies
+//
+// A scheduler that runs jobs on cron schedules for as long as the
+// process lives:
+// - Schedules are standard 5-field cron expressions (minute hour
+//   day-of-month month day-of-week), with an optional leading seconds
+//   field, plus @hourly, @daily, ... and @every <duration>
+// - Entries sit in a min-heap ordered by next run time. One goroutine
+//   sleeps until the earliest is due, so a thousand idle jobs cost one
+//   timer, not a thousand. Adding or removing an entry wakes it to
+//   re-check the top of the heap
+// - Each run gets its own goroutine, so a slow job never delays the
+//   others. What happens when a job is due while its previous run is
+//   still going is the job's overlap policy:
+//   - Skip:       drop this run (cleanup, cache refresh)
+//   - Queue:      run it when the previous one finishes (billing: every
+//                 run matters). A job that is always slower than its
+//                 interval grows the queue without bound
+//   - Concurrent: start it anyway (independent pings)
+// - A scheduler that falls behind (laptop asleep, GC pause) runs a job
+//   once when it wakes, not once per missed slot
+// - Stop is graceful: no new runs start, running ones get until the
+//   context's deadline to finish, then their context is canceled
+//
+// Usage:
+//   go run cron.go
+//   go test -v cron.go cron_test.go
+package main
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ============================================================
+// Schedules
+// ============================================================
+
+// Schedule gives the next run time strictly after t, or the zero time
+// if there is none
+type Schedule interface {
+	Next(t time.Time) time.Time
+}
+
+// bits is a set of small integers, one bit per value
+type bits uint64
+
+func (b bits) has(i int) bool { return b&(1<<uint(i)) != 0 }
+
+type field struct {
+	name     string
+	min, max int
+	names    map[string]int
+}
+
+var (
+	monthNames = map[string]int{"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12}
+	dayNames = map[string]int{"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6}
+
+	seconds = field{"second", 0, 59, nil}
+	minutes = field{"minute", 0, 59, nil}
+	hours   = field{"hour", 0, 23, nil}
+	dom     = field{"day of month", 1, 31, nil}
+	months  = field{"month", 1, 12, monthNames}
+	dow     = field{"day of week", 0, 7, dayNames} // 0 and 7 are both Sunday
+)
+
+// cronSchedule has a set of allowed values per field. A time matches
+// when every field's value is in its set
+type cronSchedule struct {
+	second, minute, hour, dom, month, dow bits
+	// With both day fields restricted, cron matches either one: "0 0 1
+	// * mon" is the 1st of the month and every Monday. With one of them
+	// "*", only the other counts
+	domStar, dowStar bool
+}
+
+var shorthands = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// everySchedule runs at a fixed interval from whenever it is asked
+type everySchedule time.Duration
+
+func (e everySchedule) Next(t time.Time) time.Time { return t.Add(time.Duration(e)) }
+
+// Parse reads a cron expression
+func Parse(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if d, ok := strings.CutPrefix(spec, "@every "); ok {
+		dur, err := time.ParseDuration(strings.TrimSpace(d))
+		if err != nil {
+			return nil, fmt.Errorf("cron: %q: %w", spec, err)
+		}
+		if dur < time.Second {
+			return nil, fmt.Errorf("cron: %q: interval under a second", spec)
+		}
+		return everySchedule(dur), nil
+	}
+	if expr, ok := shorthands[spec]; ok {
+		spec = expr
+	}
+	fs := strings.Fields(spec)
+	switch len(fs) {
+	case 5:
+		fs = append([]string{"0"}, fs...)
+	case 6:
+	default:
+		return nil, fmt.Errorf("cron: %q: want 5 or 6 fields, got %d", spec, len(fs))
+	}
+	var s cronSchedule
+	var err error
+	for i, f := range []struct {
+		dst *bits
+		def field
+	}{
+		{&s.second, seconds}, {&s.minute, minutes}, {&s.hour, hours},
+		{&s.dom, dom}, {&s.month, months}, {&s.dow, dow},
+	} {
+		if *f.dst, err = parseField(fs[i], f.def); err != nil {
+			return nil, fmt.Errorf("cron: %q: %w", spec, err)
+		}
+	}
+	if s.dow.has(7) {
+		s.dow |= 1 // Sunday
+	}
+	s.domStar, s.dowStar = fs[3] == "*" || fs[3] == "?", fs[5] == "*" || fs[5] == "?"
+	return &s, nil
+}
+
+// parseField reads one field: a comma-separated list of *, N, N-M, each
+// optionally followed by /step
+func parseField(s string, f field) (bits, error) {
+	var b bits
+	for part := range strings.SplitSeq(s, ",") {
+		rng, stepStr, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepStr)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("%s: bad step %q", f.name, stepStr)
+			}
+			step = n
+		}
+		lo, hi := f.min, f.max
+		switch {
+		case rng == "*" || rng == "?":
+		case strings.Contains(rng, "-"):
+			a, z, _ := strings.Cut(rng, "-")
+			var err error
+			if lo, err = f.value(a); err != nil {
+				return 0, err
+			}
+			if hi, err = f.value(z); err != nil {
+				return 0, err
+			}
+		default:
+			v, err := f.value(rng)
+			if err != nil {
+				return 0, err
+			}
+			lo = v
+			if !hasStep {
+				hi = v // "5" is just 5; "5/15" is 5, 20, 35, 50
+			}
+		}
+		if lo > hi {
+			return 0, fmt.Errorf("%s: range %q runs backwards", f.name, rng)
+		}
+		for v := lo; v <= hi; v += step {
+			b |= 1 << uint(v)
+		}
+	}
+	return b, nil
+}
+
+func (f field) value(s string) (int, error) {
+	if v, ok := f.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %q is not a number", f.name, s)
+	}
+	if v < f.min || v > f.max {
+		return 0, fmt.Errorf("%s: %d out of range %d-%d", f.name, v, f.min, f.max)
+	}
+	return v, nil
+}
+
+func (s *cronSchedule) dayMatches(t time.Time) bool {
+	d, w := s.dom.has(t.Day()), s.dow.has(int(t.Weekday()))
+	if s.domStar || s.dowStar {
+		return d && w
+	}
+	return d || w
+}
+
+// Next finds the first matching time after t by moving forward through
+// the fields from the largest: if the month doesn't match, skip to the
+// start of the next month and check again, and so on down to seconds.
+// Every skip zeroes the smaller fields, so it never passes a match. An
+// expression that can't match ("0 0 30 2 *") gives up after 5 years
+//
+// Hours, minutes and seconds are skipped with t.Add, not time.Date.
+// When the clocks fall back, time.Date picks the first of the two
+// 01:30s, which can be earlier than t, and the scheduler would loop on
+// an entry that is always due. Adding keeps every step forward in real
+// time: wall times in the repeated hour match on both passes, and the
+// ones a spring-forward skips never match
+func (s *cronSchedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+	t = t.Truncate(time.Second).Add(time.Second)
+	limit := t.Year() + 5
+	for t.Year() <= limit {
+		y, mo, d := t.Date()
+		h, mi, sec := t.Clock()
+		switch {
+		case !s.month.has(int(mo)):
+			t = time.Date(y, mo+1, 1, 0, 0, 0, 0, loc)
+		case !s.dayMatches(t):
+			t = time.Date(y, mo, d+1, 0, 0, 0, 0, loc)
+		case !s.hour.has(h):
+			t = t.Add(time.Hour - time.Duration(mi)*time.Minute - time.Duration(sec)*time.Second)
+		case !s.minute.has(mi):
+			t = t.Add(time.Minute - time.Duration(sec)*time.Second)
+		case !s.second.has(sec):
+			t = t.Add(time.Second)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// ============================================================
+// Scheduler
+// ============================================================
+
+// Policy says what to do when a job is due while it is still running
+type Policy int
+
+const (
+	Skip Policy = iota
+	Queue
+	Concurrent
+)
+
+func (p Policy) String() string {
+	return [...]string{"skip", "queue", "concurrent"}[p]
+}
+
+type Job func(ctx context.Context)
+
+type entry struct {
+	id     int
+	name   string
+	sched  Schedule
+	policy Policy
+	job    Job
+	next   time.Time
+	index  int // in the heap; -1 once removed
+
+	mu      sync.Mutex
+	running int
+	queued  int
+	started int
+	skipped int
+}
+
+// entryHeap orders entries by next run, earliest on top
+type entryHeap []*entry
+
+func (h entryHeap) Len() int           { return len(h) }
+func (h entryHeap) Less(i, j int) bool { return h[i].next.Before(h[j].next) }
+func (h entryHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index, h[j].index = i, j
+}
+func (h *entryHeap) Push(x any) {
+	e := x.(*entry)
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+func (h *entryHeap) Pop() any {
+	old := *h
+	e := old[len(old)-1]
+	old[len(old)-1] = nil
+	*h = old[:len(old)-1]
+	e.index = -1
+	return e
+}
+
+var ErrStopped = errors.New("cron: scheduler stopped")
+
+type Scheduler struct {
+	mu       sync.Mutex
+	entries  entryHeap
+	byID     map[int]*entry
+	lastID   int
+	started  bool
+	stopping bool
+
+	wake     chan struct{} // the heap's top may have changed
+	stop     chan struct{}
+	loopDone chan struct{}
+
+	// ctx is every run's context, canceled when Stop runs out of time
+	ctx    context.Context
+	cancel context.CancelFunc
+	runs   sync.WaitGroup
+
+	logf func(format string, args ...any)
+}
+
+func NewScheduler(logf func(format string, args ...any)) *Scheduler {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Scheduler{
+		byID:     map[int]*entry{},
+		wake:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		loopDone: make(chan struct{}),
+		ctx:      ctx,
+		cancel:   cancel,
+		logf:     logf,
+	}
+}
+
+// Add schedules job under spec and returns an id for Remove
+func (s *Scheduler) Add(name, spec string, policy Policy, job Job) (int, error) {
+	sched, err := Parse(spec)
+	if err != nil {
+		return 0, err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.stopping {
+		return 0, ErrStopped
+	}
+	next := sched.Next(time.Now())
+	if next.IsZero() {
+		return 0, fmt.Errorf("cron: %q never runs", spec)
+	}
+	s.lastID++
+	e := &entry{id: s.lastID, name: name, sched: sched, policy: policy, job: job, next: next}
+	s.byID[e.id] = e
+	heap.Push(&s.entries, e)
+	s.poke()
+	return e.id, nil
+}
+
+// Remove unschedules an entry. A run in progress is not interrupted
+func (s *Scheduler) Remove(id int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.byID[id]; ok {
+		delete(s.byID, id)
+		heap.Remove(&s.entries, e.index)
+		s.poke()
+	}
+}
+
+// poke wakes the loop without blocking; a wake already pending will do
+func (s *Scheduler) poke() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Start runs the scheduling loop in its own goroutine
+func (s *Scheduler) Start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.started || s.stopping {
+		return
+	}
+	s.started = true
+	go s.loop()
+}
+
+func (s *Scheduler) loop() {
+	defer close(s.loopDone)
+	timer := time.NewTimer(time.Hour)
+	defer timer.Stop()
+	for {
+		s.mu.Lock()
+		wait := time.Hour // nothing scheduled: just wait for a wake
+		if len(s.entries) > 0 {
+			wait = time.Until(s.entries[0].next)
+		}
+		s.mu.Unlock()
+		timer.Reset(wait) // since Go 1.23, Reset needs no draining
+
+		select {
+		case now := <-timer.C:
+			s.runDue(now)
+		case <-s.wake:
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+// runDue dispatches every entry whose time has come and reschedules it
+// from now, which is what skips slots missed while behind
+func (s *Scheduler) runDue(now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for len(s.entries) > 0 && !s.entries[0].next.After(now) {
+		e := s.entries[0]
+		s.dispatch(e)
+		e.next = e.sched.Next(now)
+		if e.next.IsZero() {
+			heap.Pop(&s.entries)
+			delete(s.byID, e.id)
+			continue
+		}
+		heap.Fix(&s.entries, 0)
+	}
+}
+
+// dispatch applies e's overlap policy; s.mu held
+func (s *Scheduler) dispatch(e *entry) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.running > 0 {
+		switch e.policy {
+		case Skip:
+			e.skipped++
+			s.logf("%-10s still running, skipped", e.name)
+			return
+		case Queue:
+			e.queued++
+			s.logf("%-10s still running, queued (%d waiting)", e.name, e.queued)
+			return
+		}
+	}
+	s.start(e)
+}
+
+// start runs e in a new goroutine; s.mu and e.mu held
+func (s *Scheduler) start(e *entry) {
+	e.running++
+	e.started++
+	s.runs.Add(1)
+	go func() {
+		defer s.runs.Done()
+		s.run(e)
+		// Same lock order as dispatch: s.mu, then e.mu
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		e.mu.Lock()
+		defer e.mu.Unlock()
+		e.running--
+		if e.queued > 0 && !s.stopping {
+			e.queued--
+			s.start(e)
+		}
+	}()
+}
+
+// run calls the job, keeping a panic from taking the scheduler down
+func (s *Scheduler) run(e *entry) {
+	defer func() {
+		if r := recover(); r != nil {
+			s.logf("%-10s panicked: %v", e.name, r)
+		}
+	}()
+	e.job(s.ctx)
+}
+
+// Stop stops starting runs and waits for the running ones. If ctx ends
+// first, their context is canceled, Stop waits for them to return, and
+// the error is ctx's
+func (s *Scheduler) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	if s.stopping {
+		s.mu.Unlock()
+		return ErrStopped
+	}
+	s.stopping = true
+	started := s.started
+	s.mu.Unlock()
+	close(s.stop)
+	if started {
+		<-s.loopDone
+	}
+
+	done := make(chan struct{})
+	go func() {
+		s.runs.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		s.cancel()
+		return nil
+	case <-ctx.Done():
+		s.cancel()
+		<-done
+		return ctx.Err()
+	}
+}
+
+// EntryStats is how many times an entry ran and didn't
+type EntryStats struct {
+	Name             string
+	Policy           Policy
+	Started, Skipped int
+	Queued, Running  int
+}
+
+// Stats lists the entries in the order they were added
+func (s *Scheduler) Stats() []EntryStats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	out := make([]EntryStats, 0, len(s.byID))
+	for id := 1; id <= s.lastID; id++ {
+		e, ok := s.byID[id]
+		if !ok {
+			continue
+		}
+		e.mu.Lock()
+		out = append(out, EntryStats{e.name, e.policy, e.started, e.skipped, e.queued, e.running})
+		e.mu.Unlock()
+	}
+	return out
+}
+
+// ============================================================
+// Demo
+// ============================================================
+
+func showSchedules() {
+	from := time.Date(2024, 2, 27, 22, 58, 30, 0, time.UTC) // a Tuesday
+	fmt.Printf("=== Next three runs after %s ===\n", from.Format("Mon 2006-01-02 15:04:05"))
+	for _, spec := range []string{
+		"*/15 * * * *",
+		"0 9 * * mon-fri",
+		"30 2 29 feb *",
+		"0 0 1 * mon",
+		"*/20 * * * * *",
+		"@hourly",
+		"@every 90m",
+		"0 0 30 2 *",
+		"61 * * * *",
+		"* * *",
+	} {
+		sched, err := Parse(spec)
+		if err != nil {
+			fmt.Printf("  %-18s %v\n", spec, err)
+			continue
+		}
+		var runs []string
+		t := from
+		for range 3 {
+			if t = sched.Next(t); t.IsZero() {
+				runs = append(runs, "never")
+				break
+			}
+			runs = append(runs, t.Format("Mon 01-02 15:04:05"))
+		}
+		fmt.Printf("  %-18s %s\n", spec, strings.Join(runs, " | "))
+	}
+}
+
+func main() {
+	showSchedules()
+
+	start := time.Now()
+	var logMu sync.Mutex
+	logf := func(format string, args ...any) {
+		logMu.Lock()
+		defer logMu.Unlock()
+		fmt.Printf("  %5.1fs  %s\n", time.Since(start).Seconds(), fmt.Sprintf(format, args...))
+	}
+
+	fmt.Println("\n=== A 2.5s job every second, under each overlap policy ===")
+	s := NewScheduler(logf)
+	slow := func(name string) Job {
+		return func(ctx context.Context) {
+			logf("%-10s start", name)
+			select {
+			case <-time.After(2500 * time.Millisecond):
+				logf("%-10s done", name)
+			case <-ctx.Done():
+				logf("%-10s canceled: %v", name, ctx.Err())
+			}
+		}
+	}
+	for _, p := range []Policy{Skip, Queue, Concurrent} {
+		if _, err := s.Add(p.String(), "@every 1s", p, slow(p.String())); err != nil {
+			panic(err)
+		}
+	}
+	if _, err := s.Add("panicky", "*/3 * * * * *", Skip, func(context.Context) { panic("oops") }); err != nil {
+		panic(err)
+	}
+	s.Start()
+	time.Sleep(5500 * time.Millisecond)
+
+	fmt.Println("\n=== Stop, with one second's grace ===")
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	stats := s.Stats()
+	err := s.Stop(ctx)
+	logf("stopped: %v", err)
+
+	fmt.Println("\n=== Per job, in 5.5s ===")
+	for _, st := range stats {
+		fmt.Printf("  %-10s %-10s started %d, skipped %d, still queued at stop %d\n",
+			st.Name, st.Policy, st.Started, st.Skipped, st.Queued)
+	}
+	fmt.Println("  skip:       runs only when the last run is over; half the runs are dropped")
+	fmt.Println("  queue:      drops nothing, but falls further behind with every run")
+	fmt.Println("  concurrent: keeps to the schedule, with up to three copies running at once")
+}
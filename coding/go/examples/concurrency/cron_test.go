@@ -0,0 +1,308 @@
+// Cron Scheduler Tests - Expression parsing, next-run arithmetic, overlap policies
+//
+// Next is tested against fixed times, including the awkward ones: leap
+// days, month ends, and the day-of-month/day-of-week OR rule. The
+// policy tests hold a job inside its run with a channel and dispatch it
+// again, so what each policy does is checked without racing a clock.
+//
+// Usage:
+//   go test -v cron.go cron_test.go
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		spec string
+		want string // in the error
+	}{
+		{"* * * *", "want 5 or 6 fields"},
+		{"60 * * * *", "minute: 60 out of range"},
+		{"* 24 * * *", "hour: 24 out of range"},
+		{"* * 0 * *", "day of month: 0 out of range"},
+		{"* * * 13 *", "month: 13 out of range"},
+		{"* * * * 8", "day of week: 8 out of range"},
+		{"*/0 * * * *", "bad step"},
+		{"5-1 * * * *", "runs backwards"},
+		{"* * * foo *", `"foo" is not a number`},
+		{"@every 10ms", "under a second"},
+		{"@every soon", "invalid duration"},
+	}
+	for _, tt := range tests {
+		_, err := Parse(tt.spec)
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("Parse(%q) error = %v, want one containing %q", tt.spec, err, tt.want)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	// 2024 is a leap year; Feb 27 is a Tuesday
+	from := time.Date(2024, 2, 27, 22, 58, 30, 0, time.UTC)
+	tests := []struct {
+		spec string
+		from time.Time
+		want string
+	}{
+		{"* * * * *", from, "2024-02-27 22:59:00"},
+		{"*/15 * * * *", from, "2024-02-27 23:00:00"},
+		{"*/20 * * * * *", from, "2024-02-27 22:58:40"},
+		{"0 9 * * mon-fri", from, "2024-02-28 09:00:00"},
+		{"0 9 * * 1-5", time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC), "2024-03-04 09:00:00"}, // Friday to Monday
+		{"0 0 * * 7", from, "2024-03-03 00:00:00"},                                           // 7 is Sunday too
+		{"30 2 29 feb *", from, "2024-02-29 02:30:00"},
+		{"30 2 29 feb *", time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC), "2028-02-29 02:30:00"},
+		{"0 0 31 * *", from, "2024-03-31 00:00:00"}, // skips short months
+		// Both day fields set: either matches
+		{"0 0 1 * mon", from, "2024-03-01 00:00:00"},
+		{"0 0 13 * fri", from, "2024-03-01 00:00:00"},
+		{"5/20 * * * *", from, "2024-02-27 23:05:00"},
+		{"0 0,12 * * *", from, "2024-02-28 00:00:00"},
+		{"@yearly", from, "2025-01-01 00:00:00"},
+		{"@every 90m", from, "2024-02-28 00:28:30"},
+		{"0 0 30 2 *", from, "never"},
+		// Exactly on a match: strictly after
+		{"0 0 * * *", time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), "2024-01-02 00:00:00"},
+		{"0 0 * * *", time.Date(2024, 12, 31, 23, 59, 59, 500, time.UTC), "2025-01-01 00:00:00"},
+	}
+	for _, tt := range tests {
+		sched, err := Parse(tt.spec)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.spec, err)
+		}
+		got := "never"
+		if next := sched.Next(tt.from); !next.IsZero() {
+			got = next.Format(time.DateTime)
+		}
+		if got != tt.want {
+			t.Errorf("%q from %s: got %s, want %s", tt.spec, tt.from.Format(time.DateTime), got, tt.want)
+		}
+	}
+}
+
+func TestNextDST(t *testing.T) {
+	ny, err := time.LoadLocation("America/New_York")
+	if err != nil {
+		t.Skip(err)
+	}
+	// 2025-11-02: 01:00-01:59 happens twice, EDT then EST.
+	// 2025-03-09: 02:00-02:59 doesn't happen at all
+	edt := time.Date(2025, 11, 2, 5, 59, 30, 0, time.UTC).In(ny)   // 01:59:30 EDT
+	est := time.Date(2025, 11, 2, 6, 30, 0, 0, time.UTC).In(ny)    // 01:30:00 EST
+	spring := time.Date(2025, 3, 9, 6, 59, 30, 0, time.UTC).In(ny) // 01:59:30 EST
+	tests := []struct {
+		spec string
+		from time.Time
+		want string
+	}{
+		{"0 * * * * *", edt, "2025-11-02 01:00:00 EST"},
+		{"0 45 1 * * *", est, "2025-11-02 01:45:00 EST"},
+		{"0 30 1 * * *", est, "2025-11-03 01:30:00 EST"},
+		{"0 * * * * *", spring, "2025-03-09 03:00:00 EDT"},
+		{"0 30 2 * * *", spring, "2025-03-10 02:30:00 EDT"},
+	}
+	for _, tt := range tests {
+		sched, err := Parse(tt.spec)
+		if err != nil {
+			t.Fatalf("Parse(%q): %v", tt.spec, err)
+		}
+		if got := sched.Next(tt.from).Format("2006-01-02 15:04:05 MST"); got != tt.want {
+			t.Errorf("%q from %s: got %s, want %s", tt.spec, tt.from.Format(time.DateTime+" MST"), got, tt.want)
+		}
+	}
+
+	// Every second across both changes, Next moves forward: runDue
+	// reschedules until an entry is in the future, so one that isn't
+	// would spin it forever
+	sched, _ := Parse("0 * * * * *")
+	for _, start := range []time.Time{edt, spring} {
+		for from := start.Add(-time.Hour); from.Before(start.Add(2 * time.Hour)); from = from.Add(time.Second) {
+			if next := sched.Next(from); !next.After(from) {
+				t.Fatalf("Next(%s) = %s, not after it", from, next)
+			}
+		}
+	}
+}
+
+// blocker is a job that stays in its run until released
+type blocker struct {
+	started atomic.Int32
+	release chan struct{}
+}
+
+func newBlocker() *blocker { return &blocker{release: make(chan struct{})} }
+
+func (b *blocker) job(ctx context.Context) {
+	b.started.Add(1)
+	select {
+	case <-b.release:
+	case <-ctx.Done():
+	}
+}
+
+// dispatchN makes e due n times, as the loop would
+func dispatchN(s *Scheduler, e *entry, n int) {
+	for range n {
+		s.mu.Lock()
+		s.dispatch(e)
+		s.mu.Unlock()
+	}
+}
+
+func waitFor(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	for deadline := time.Now().Add(2 * time.Second); time.Now().Before(deadline); time.Sleep(time.Millisecond) {
+		if cond() {
+			return
+		}
+	}
+	t.Fatalf("timed out waiting for %s", what)
+}
+
+func TestOverlapPolicies(t *testing.T) {
+	tests := []struct {
+		policy Policy
+		// after dispatching 3 times while the first run is blocked
+		started, skipped, queued int
+		// total runs once everything is released
+		total int
+	}{
+		{Skip, 1, 2, 0, 1},
+		{Queue, 1, 0, 2, 3},
+		{Concurrent, 3, 0, 0, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy.String(), func(t *testing.T) {
+			s := NewScheduler(t.Logf)
+			b := newBlocker()
+			id, err := s.Add("job", "@yearly", tt.policy, b.job)
+			if err != nil {
+				t.Fatal(err)
+			}
+			e := s.byID[id]
+			dispatchN(s, e, 3)
+			waitFor(t, "runs to start", func() bool { return int(b.started.Load()) == tt.started })
+
+			st := s.Stats()[0]
+			if st.Started != tt.started || st.Skipped != tt.skipped || st.Queued != tt.queued {
+				t.Errorf("while blocked: %+v, want started %d, skipped %d, queued %d",
+					st, tt.started, tt.skipped, tt.queued)
+			}
+			close(b.release) // every run, queued ones included, now returns at once
+			waitFor(t, "the queue to drain", func() bool { return int(b.started.Load()) == tt.total })
+			if err := s.Stop(context.Background()); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestStopDropsQueuedRuns(t *testing.T) {
+	s := NewScheduler(t.Logf)
+	b := newBlocker()
+	id, _ := s.Add("job", "@yearly", Queue, b.job)
+	dispatchN(s, s.byID[id], 3)
+	waitFor(t, "the first run", func() bool { return b.started.Load() == 1 })
+
+	stopped := make(chan error)
+	go func() { stopped <- s.Stop(context.Background()) }()
+	waitFor(t, "Stop to begin", func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.stopping
+	})
+	close(b.release)
+	if err := <-stopped; err != nil {
+		t.Fatal(err)
+	}
+	if n := b.started.Load(); n != 1 {
+		t.Errorf("%d runs, want the queued ones dropped at Stop", n)
+	}
+}
+
+func TestStopGraceful(t *testing.T) {
+	s := NewScheduler(t.Logf)
+	var finished atomic.Bool
+	id, _ := s.Add("job", "@yearly", Skip, func(ctx context.Context) {
+		time.Sleep(20 * time.Millisecond) // ignores ctx, but is quick
+		finished.Store(true)
+	})
+	dispatchN(s, s.byID[id], 1)
+	if err := s.Stop(context.Background()); err != nil || !finished.Load() {
+		t.Errorf("Stop = %v, finished = %v; want nil, true", err, finished.Load())
+	}
+	if _, err := s.Add("late", "@yearly", Skip, func(context.Context) {}); !errors.Is(err, ErrStopped) {
+		t.Errorf("Add after Stop: %v, want ErrStopped", err)
+	}
+	if err := s.Stop(context.Background()); !errors.Is(err, ErrStopped) {
+		t.Errorf("second Stop: %v, want ErrStopped", err)
+	}
+}
+
+func TestStopForced(t *testing.T) {
+	s := NewScheduler(t.Logf)
+	b := newBlocker() // never released: only cancellation ends it
+	id, _ := s.Add("job", "@yearly", Skip, b.job)
+	dispatchN(s, s.byID[id], 1)
+	waitFor(t, "the run", func() bool { return b.started.Load() == 1 })
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := s.Stop(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Stop = %v, want DeadlineExceeded", err)
+	}
+	// Stop returned, so the run has returned too: nothing leaks
+}
+
+func TestPanicDoesNotKillScheduler(t *testing.T) {
+	s := NewScheduler(t.Logf)
+	id, _ := s.Add("bad", "@yearly", Concurrent, func(context.Context) { panic("oops") })
+	dispatchN(s, s.byID[id], 2)
+	if err := s.Stop(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if st := s.Stats()[0]; st.Running != 0 || st.Started != 2 {
+		t.Errorf("%+v, want 2 runs, none still running", st)
+	}
+}
+
+func TestRunsOnSchedule(t *testing.T) {
+	// Real time, whole-second schedules: the slowest test here
+	if testing.Short() {
+		t.Skip("takes about two seconds")
+	}
+	var mu sync.Mutex
+	runs := map[string]int{}
+	record := func(name string) Job {
+		return func(context.Context) {
+			mu.Lock()
+			runs[name]++
+			mu.Unlock()
+		}
+	}
+	s := NewScheduler(t.Logf)
+	s.Add("every-2s", "@every 2s", Skip, record("every-2s"))
+	s.Add("every-1s", "@every 1s", Skip, record("every-1s"))
+	removed, _ := s.Add("removed", "@every 1s", Skip, record("removed"))
+	s.Remove(removed)
+	s.Start()
+	time.Sleep(2500 * time.Millisecond)
+	s.Stop(context.Background())
+
+	mu.Lock()
+	defer mu.Unlock()
+	if runs["every-1s"] != 2 || runs["every-2s"] != 1 || runs["removed"] != 0 {
+		t.Errorf("runs = %v, want every-1s twice, every-2s once, removed never", runs)
+	}
+	if len(s.Stats()) != 2 {
+		t.Errorf("Stats lists %d entries, want 2", len(s.Stats()))
+	}
+}
@@ -0,0 +1,559 @@
+// Deadlocks and Starvation - Three classic failures, how to catch each, and the fix
+//
+// Each failure is here twice, broken and fixed, and each is caught a
+// different way, because no one tool sees them all:
+// - Lock ordering: two transfers between the same accounts, in
+//   opposite directions, each holding one lock and waiting for the
+//   other. Caught by a goroutine dump: goroutines parked in
+//   [sync.Mutex.Lock] that never move. Fixed by always locking in one
+//   global order, here by account ID
+// - Channel deadlock: workers send results on an unbuffered channel
+//   that is only read after wg.Wait, which waits for the workers. The
+//   dump shows [chan send] on one side and [sync.WaitGroup.Wait] on the
+//   other. Fixed by waiting and closing in a goroutine of its own
+// - Starvation: a greedy goroutine that relocks the moment it unlocks
+//   beats a polite one to the lock nearly every time. Nothing is stuck,
+//   so there is nothing to dump; it shows as wait time, in the block
+//   profile (where goroutines waited) and the mutex profile (which
+//   Unlock made them wait). Fixed by a lock that hands over in order
+//
+// And the detector everyone meets first: "fatal error: all goroutines
+// are asleep - deadlock!". The runtime only says so when every
+// goroutine is blocked. One goroutine still sleeping on a timer, as any
+// server has, is enough to turn the crash into a silent hang. So the
+// demo runs it in a child process, with and without such a goroutine.
+//
+// The block profile has a blind spot worth knowing: it records a wait
+// when the wait ends. A deadlock's waits never end, so it never shows
+// there; the goroutine dump (/debug/pprof/goroutine?debug=1 in a
+// server) is the tool for those.
+//
+// Usage:
+//   go run deadlock.go
+//   go test -race -v deadlock.go deadlock_test.go
+//   go test -run=^$ -bench=. deadlock.go deadlock_test.go
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"runtime/pprof"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ============================================================
+// Failure 1: lock-ordering deadlock
+// ============================================================
+
+type Account struct {
+	id      int
+	mu      sync.Mutex
+	balance int
+}
+
+// check stands in for work done while holding the first lock, a fraud
+// check or an audit write. It widens the window between the two Locks;
+// without it the deadlock is rarer, not gone
+func check(*Account) { time.Sleep(10 * time.Microsecond) }
+
+// transferBroken locks from, then to. Transfers a->b and b->a at once
+// each get their first lock and wait for ever for the second
+func transferBroken(from, to *Account, amount int) {
+	from.mu.Lock()
+	defer from.mu.Unlock()
+	check(from)
+	to.mu.Lock()
+	defer to.mu.Unlock()
+	from.balance -= amount
+	to.balance += amount
+}
+
+// transferFixed locks the lower ID first, whichever way the money goes.
+// With one global order, no goroutine can hold a later lock while
+// waiting for an earlier one, so no cycle of waits can form
+func transferFixed(from, to *Account, amount int) {
+	first, second := from, to
+	if second.id < first.id {
+		first, second = second, first
+	}
+	first.mu.Lock()
+	defer first.mu.Unlock()
+	check(first)
+	second.mu.Lock()
+	defer second.mu.Unlock()
+	from.balance -= amount
+	to.balance += amount
+}
+
+// crossTransfers runs n transfers each way between a and b at once
+func crossTransfers(transfer func(from, to *Account, amount int), a, b *Account, n int) {
+	var wg sync.WaitGroup
+	for _, pair := range [][2]*Account{{a, b}, {b, a}} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range n {
+				transfer(pair[0], pair[1], 1)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// ============================================================
+// Failure 2: channel deadlock
+// ============================================================
+
+// squaresBroken waits for the workers before reading their results. The
+// channel is unbuffered, so the first worker's send waits for a reader,
+// the reader is waiting in wg.Wait, and wg.Wait is waiting for the
+// worker
+func squaresBroken(nums []int) []int {
+	results := make(chan int)
+	var wg sync.WaitGroup
+	for _, n := range nums {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results <- n * n
+		}()
+	}
+	wg.Wait()
+	close(results)
+	var out []int
+	for r := range results {
+		out = append(out, r)
+	}
+	return out
+}
+
+// squaresFixed reads while the workers run, and has a goroutine of its
+// own wait for them and close the channel, which ends the range
+func squaresFixed(nums []int) []int {
+	results := make(chan int)
+	var wg sync.WaitGroup
+	for _, n := range nums {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results <- n * n
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(results)
+	}()
+	var out []int
+	for r := range results {
+		out = append(out, r)
+	}
+	return out
+}
+
+// ============================================================
+// Failure 3: starvation
+// ============================================================
+
+// spinLock is as unfair as a lock gets. Whoever tries the CAS first
+// wins, and the goroutine that just unlocked is already running, while
+// a waiter has to be scheduled first
+type spinLock struct{ held atomic.Bool }
+
+func (l *spinLock) Lock() {
+	for !l.held.CompareAndSwap(false, true) {
+		runtime.Gosched()
+	}
+}
+
+func (l *spinLock) Unlock() { l.held.Store(false) }
+
+// ticketLock serves goroutines in the order they arrived, like the
+// numbered tickets at a deli counter. A greedy goroutine that relocks
+// at once takes a ticket behind whoever is already waiting
+type ticketLock struct {
+	next, serving atomic.Uint32
+}
+
+func (l *ticketLock) Lock() {
+	t := l.next.Add(1) - 1
+	for l.serving.Load() != t {
+		runtime.Gosched()
+	}
+}
+
+func (l *ticketLock) Unlock() { l.serving.Add(1) }
+
+// busy holds the CPU for d, as a critical section doing real work
+// would; sleeping would hand the lock's owner's CPU to the waiter
+func busy(d time.Duration) {
+	for start := time.Now(); time.Since(start) < d; {
+	}
+}
+
+type fairness struct {
+	greedy, polite int
+	waits          []time.Duration // the polite goroutine's, sorted
+}
+
+func (f fairness) pct(p float64) time.Duration {
+	if len(f.waits) == 0 {
+		return 0
+	}
+	return f.waits[int(p*float64(len(f.waits)-1))]
+}
+
+// contend runs a greedy goroutine, which relocks as soon as it unlocks,
+// against a polite one, which pauses between turns, for length
+func contend(l sync.Locker, length time.Duration) fairness {
+	var f fairness
+	var stop atomic.Bool
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for !stop.Load() {
+			l.Lock()
+			busy(50 * time.Microsecond)
+			f.greedy++
+			l.Unlock()
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for !stop.Load() {
+			time.Sleep(200 * time.Microsecond)
+			start := time.Now()
+			l.Lock()
+			f.waits = append(f.waits, time.Since(start))
+			f.polite++
+			l.Unlock()
+		}
+	}()
+	time.Sleep(length)
+	stop.Store(true)
+	wg.Wait()
+	slices.Sort(f.waits)
+	return f
+}
+
+// ============================================================
+// Detection
+// ============================================================
+
+// goroutine is one entry from a full stack dump
+type goroutine struct {
+	id    int
+	state string // "sync.Mutex.Lock", "chan send", ...
+	stack string
+}
+
+// where is the first frame in package main: the line of our code that
+// the goroutine is parked on, below the runtime and sync frames
+func (g goroutine) where() string {
+	lines := strings.Split(g.stack, "\n")
+	for i := 0; i+1 < len(lines); i += 2 {
+		if fn, ok := ours(lines[i]); ok {
+			fn, _, _ = strings.Cut(fn, "(")
+			return fn + " " + trimFrame(lines[i+1])
+		}
+	}
+	return "?"
+}
+
+// ours reports whether a frame's function is in this program, and
+// names it as in package main. Under go test a file-list package is
+// called command-line-arguments
+func ours(fn string) (string, bool) {
+	if rest, ok := strings.CutPrefix(fn, "command-line-arguments."); ok {
+		return "main." + rest, true
+	}
+	return fn, strings.HasPrefix(fn, "main.")
+}
+
+// trimFrame turns "\t/long/path/file.go:42 +0x1d" into "file.go:42"
+func trimFrame(loc string) string {
+	loc = strings.TrimSpace(loc)
+	loc, _, _ = strings.Cut(loc, " ")
+	if i := strings.LastIndex(loc, "/"); i >= 0 {
+		loc = loc[i+1:]
+	}
+	return loc
+}
+
+// goroutines parses runtime.Stack for every goroutine but the caller
+func goroutines() []goroutine {
+	buf := make([]byte, 1<<16)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+	var gs []goroutine
+	for _, b := range strings.Split(string(buf), "\n\n")[1:] {
+		header, stack, _ := strings.Cut(b, "\n")
+		rest, ok := strings.CutPrefix(header, "goroutine ")
+		if !ok {
+			continue
+		}
+		idText, state, _ := strings.Cut(rest, " [")
+		id, _ := strconv.Atoi(idText)
+		state, _, _ = strings.Cut(state, "]")
+		state, _, _ = strings.Cut(state, ",") // drop ", 2 minutes"
+		gs = append(gs, goroutine{id: id, state: state, stack: stack})
+	}
+	return gs
+}
+
+// stuck is a watchdog for a suspected deadlock: it runs fn, and if fn
+// hasn't returned after wait, it returns the goroutines started since
+// that are blocked, and leaves fn to its fate. A deadlocked goroutine
+// can't be killed, only found
+func stuck(fn func(), wait time.Duration) []goroutine {
+	before := map[int]bool{}
+	for _, g := range goroutines() {
+		before[g.id] = true
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		fn()
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-time.After(wait):
+	}
+	var gs []goroutine
+	for _, g := range goroutines() {
+		if !before[g.id] && g.state != "running" && g.state != "runnable" {
+			gs = append(gs, g)
+		}
+	}
+	return gs
+}
+
+// group collapses goroutines parked in the same state at the same line
+func group(gs []goroutine) []string {
+	counts := map[string]int{}
+	for _, g := range gs {
+		counts[fmt.Sprintf("[%s] %s", g.state, g.where())]++
+	}
+	lines := make([]string, 0, len(counts))
+	for k, n := range counts {
+		lines = append(lines, fmt.Sprintf("%3d x %s", n, k))
+	}
+	slices.Sort(lines)
+	return lines
+}
+
+// contention is one record of a block or mutex profile
+type contention struct {
+	where string
+	count int64
+	delay time.Duration
+}
+
+// profile reads a contention profile ("block" or "mutex") and totals it
+// by the first frame in package main, biggest delay first. The debug=1
+// text format is one record per stack:
+//
+//	<cycles> <count> @ 0x... 0x...
+//	#	0x47a8c5	sync.(*Mutex).Lock+0x65	/go/src/sync/mutex.go:90
+//	#	0x4a0b2f	main.contend.func2+0x8f	/src/deadlock.go:262
+func profile(name string) []contention {
+	var buf bytes.Buffer
+	pprof.Lookup(name).WriteTo(&buf, 1)
+	cyclesPerSec := 1.0
+	byWhere := map[string]*contention{}
+	var cycles, count int64
+	counted := true
+	for _, line := range strings.Split(buf.String(), "\n") {
+		if v, ok := strings.CutPrefix(line, "cycles/second="); ok {
+			cyclesPerSec, _ = strconv.ParseFloat(v, 64)
+			continue
+		}
+		if f := strings.Fields(line); len(f) > 2 && f[2] == "@" {
+			cycles, _ = strconv.ParseInt(f[0], 10, 64)
+			count, _ = strconv.ParseInt(f[1], 10, 64)
+			counted = false
+			continue
+		}
+		f := strings.Fields(line)
+		if counted || len(f) < 4 || f[0] != "#" {
+			continue
+		}
+		fn, ok := ours(f[2])
+		if !ok {
+			continue
+		}
+		fn, _, _ = strings.Cut(fn, "+")
+		where := fn + " " + trimFrame(f[3])
+		c := byWhere[where]
+		if c == nil {
+			c = &contention{where: where}
+			byWhere[where] = c
+		}
+		c.count += count
+		c.delay += time.Duration(float64(cycles) / cyclesPerSec * float64(time.Second))
+		counted = true // one frame per record
+	}
+	var out []contention
+	for _, c := range byWhere {
+		out = append(out, *c)
+	}
+	slices.SortFunc(out, func(a, b contention) int { return int(b.delay - a.delay) })
+	return out
+}
+
+// ============================================================
+// The runtime's own detector, in a child process
+// ============================================================
+
+const childEnv = "DEADLOCK_CHILD"
+
+// child runs in the re-executed binary: a send nobody will receive
+func child(kind string) {
+	if kind == "with a timer" {
+		// Any server has something like this: a metrics flush, a
+		// cache janitor. A goroutine that will wake up means not every
+		// goroutine is asleep, as far as the runtime can tell
+		go func() {
+			for {
+				time.Sleep(100 * time.Millisecond)
+			}
+		}()
+	}
+	ch := make(chan int)
+	ch <- 1
+}
+
+// runChild runs bin, a build of this program, as a child of the given
+// kind and reports how it ended: the runtime's fatal error, or killed
+// after wait
+func runChild(bin, kind string, wait time.Duration) (verdict string, detail []string) {
+	ctx, cancel := context.WithTimeout(context.Background(), wait)
+	defer cancel()
+	cmd := exec.CommandContext(ctx, bin)
+	cmd.Env = append(os.Environ(), childEnv+"="+kind)
+	out, err := cmd.CombinedOutput()
+	if ctx.Err() != nil {
+		return fmt.Sprintf("no error: still hung after %v, killed", wait), nil
+	}
+	lines := strings.Split(string(out), "\n")
+	for i, l := range lines {
+		if strings.HasPrefix(l, "goroutine ") && i+3 < len(lines) {
+			// The goroutine header, and the frame in main that blocked
+			fn, _, _ := strings.Cut(lines[i+1], "(")
+			detail = []string{l, fn + " " + trimFrame(lines[i+2])}
+			break
+		}
+	}
+	return fmt.Sprintf("%s (%v)", lines[0], err), detail
+}
+
+// ============================================================
+// Demo
+// ============================================================
+
+func main() {
+	if kind := os.Getenv(childEnv); kind != "" {
+		child(kind)
+		return
+	}
+
+	fmt.Println("=== 1. Lock ordering: 200 transfers each way between a and b ===")
+	a, b := &Account{id: 1, balance: 1000}, &Account{id: 2, balance: 1000}
+	gs := stuck(func() { crossTransfers(transferBroken, a, b, 200) }, time.Second)
+	fmt.Printf("  broken: %d goroutines stuck after 1s. The dump, grouped:\n", len(gs))
+	for _, line := range group(gs) {
+		fmt.Println("    " + line)
+	}
+	a, b = &Account{id: 1, balance: 1000}, &Account{id: 2, balance: 1000}
+	start := time.Now()
+	gs = stuck(func() { crossTransfers(transferFixed, a, b, 200) }, 10*time.Second)
+	fmt.Printf("  fixed:  done in %v, %d stuck; balances %d + %d = %d\n\n",
+		time.Since(start).Round(time.Millisecond), len(gs), a.balance, b.balance, a.balance+b.balance)
+
+	fmt.Println("=== 2. Channel deadlock: squares of 1..5 ===")
+	nums := []int{1, 2, 3, 4, 5}
+	gs = stuck(func() { squaresBroken(nums) }, 500*time.Millisecond)
+	fmt.Printf("  broken: %d goroutines stuck after 500ms:\n", len(gs))
+	for _, line := range group(gs) {
+		fmt.Println("    " + line)
+	}
+	var got []int
+	gs = stuck(func() { got = squaresFixed(nums) }, 10*time.Second)
+	slices.Sort(got)
+	fmt.Printf("  fixed:  %v, %d stuck\n\n", got, len(gs))
+
+	fmt.Println("=== The runtime's detector: an unreceived send in main, in a child process ===")
+	for _, kind := range []string{"alone", "with a timer"} {
+		verdict, detail := runChild(os.Args[0], kind, 2*time.Second)
+		fmt.Printf("  %-13s %s\n", kind+":", verdict)
+		for _, d := range detail {
+			fmt.Println("                " + d)
+		}
+	}
+	fmt.Println()
+
+	fmt.Printf("=== 3. Starvation: greedy vs polite for 300ms each (GOMAXPROCS=%d) ===\n", runtime.GOMAXPROCS(0))
+	fmt.Printf("  %-22s %8s %8s %12s %12s\n", "lock", "greedy", "polite", "polite p50", "polite max")
+	locks := []struct {
+		name string
+		l    sync.Locker
+	}{
+		{"spin (barging)", &spinLock{}},
+		{"sync.Mutex", &sync.Mutex{}},
+		{"ticket (FIFO)", &ticketLock{}},
+	}
+	for _, lk := range locks {
+		if lk.name == "sync.Mutex" {
+			// Record every blocking event and every contended Unlock;
+			// production would sample, e.g. rate 10000 and fraction 100
+			runtime.SetBlockProfileRate(1)
+			runtime.SetMutexProfileFraction(1)
+		}
+		f := contend(lk.l, 300*time.Millisecond)
+		runtime.SetBlockProfileRate(0)
+		runtime.SetMutexProfileFraction(0)
+		fmt.Printf("  %-22s %8d %8d %12v %12v\n", lk.name, f.greedy, f.polite,
+			f.pct(0.5).Round(time.Microsecond), f.pct(1).Round(time.Microsecond))
+	}
+	fmt.Println("  The spin lock goes to whoever asks first, and that is nearly always")
+	fmt.Println("  the goroutine that just let go. sync.Mutex lets a running goroutine")
+	fmt.Println("  barge in too, but once a waiter has waited 1ms it switches to")
+	fmt.Println("  starvation mode and hands the lock over directly. The ticket lock")
+	fmt.Println("  is strictly first come, first served.")
+	if runtime.GOMAXPROCS(0) == 1 {
+		fmt.Println("  On one CPU the polite goroutine only runs when the scheduler")
+		fmt.Println("  preempts the greedy one, every 10ms or so, which caps its turns")
+		fmt.Println("  whatever the lock. Its wait once it asks is the lock's doing.")
+	}
+
+	fmt.Println("\n  Block profile for the sync.Mutex run: where goroutines waited")
+	for _, c := range profile("block") {
+		fmt.Printf("    %-40s %6d waits %12v\n", c.where, c.count, c.delay.Round(time.Microsecond))
+	}
+	fmt.Println("  Mutex profile: whose Unlock kept them waiting")
+	for _, c := range profile("mutex") {
+		fmt.Printf("    %-40s %6d       %12v\n", c.where, c.count, c.delay.Round(time.Microsecond))
+	}
+	if runtime.GOMAXPROCS(0) == 1 {
+		fmt.Println("  Both count time parked in Lock. On one CPU most of the polite")
+		fmt.Println("  goroutine's wait is for the CPU, so they show less than the table.")
+	}
+	fmt.Println("  (In a server: /debug/pprof/block and /debug/pprof/mutex, once the")
+	fmt.Println("  rates are set; both are off by default)")
+}
@@ -0,0 +1,217 @@
+// Deadlocks and Starvation Tests - Fixed versions finish, broken ones are caught
+//
+// The fixed versions must finish under a watchdog, with the race
+// detector on. The broken ones are run too, on purpose: a test that
+// the detection finds them is what keeps the detection honest. Their
+// goroutines stay stuck until the test binary exits.
+//
+// Usage:
+//   go test -race -v deadlock.go deadlock_test.go
+//   go test -run=^$ -bench=. deadlock.go deadlock_test.go
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestTransferFixed(t *testing.T) {
+	// Transfers in every direction around a ring of accounts: any
+	// lock-order cycle would show up as a hang
+	accounts := make([]*Account, 4)
+	for i := range accounts {
+		accounts[i] = &Account{id: i, balance: 100}
+	}
+	gs := stuck(func() {
+		var wg sync.WaitGroup
+		for i := range accounts {
+			for _, step := range []int{1, len(accounts) - 1} { // both ways round
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					from, to := accounts[i], accounts[(i+step)%len(accounts)]
+					for range 50 {
+						transferFixed(from, to, 1)
+					}
+				}()
+			}
+		}
+		wg.Wait()
+	}, 30*time.Second)
+	if len(gs) > 0 {
+		t.Fatalf("stuck:\n%s", strings.Join(group(gs), "\n"))
+	}
+	total := 0
+	for _, a := range accounts {
+		total += a.balance
+	}
+	if total != 400 {
+		t.Errorf("total %d after transfers, want 400", total)
+	}
+}
+
+func TestDumpFindsLockOrderDeadlock(t *testing.T) {
+	a, b := &Account{id: 1}, &Account{id: 2}
+	gs := stuck(func() { crossTransfers(transferBroken, a, b, 1000) }, time.Second)
+	inLock := 0
+	for _, g := range gs {
+		if g.state == "sync.Mutex.Lock" && strings.HasPrefix(g.where(), "main.transferBroken ") {
+			inLock++
+		}
+	}
+	if inLock != 2 {
+		t.Errorf("%d goroutines stuck in transferBroken's Lock, want 2; dump:\n%s",
+			inLock, strings.Join(group(gs), "\n"))
+	}
+}
+
+func TestSquares(t *testing.T) {
+	nums := []int{1, 2, 3, 4, 5}
+	var got []int
+	if gs := stuck(func() { got = squaresFixed(nums) }, 10*time.Second); len(gs) > 0 {
+		t.Fatalf("squaresFixed stuck:\n%s", strings.Join(group(gs), "\n"))
+	}
+	slices.Sort(got)
+	if want := []int{1, 4, 9, 16, 25}; !slices.Equal(got, want) {
+		t.Errorf("squaresFixed = %v, want %v", got, want)
+	}
+
+	gs := stuck(func() { squaresBroken(nums) }, 200*time.Millisecond)
+	want := []string{
+		"  1 x [sync.WaitGroup.Wait] main.squaresBroken deadlock.go:130",
+		"  5 x [chan send] main.squaresBroken.func1 deadlock.go:127",
+	}
+	if got := group(gs); len(got) != 2 || !strings.Contains(got[0], "[sync.WaitGroup.Wait] main.squaresBroken ") ||
+		!strings.Contains(got[1], "5 x [chan send] main.squaresBroken.func1 ") {
+		t.Errorf("squaresBroken dump:\n%s\nwant like:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestRuntimeDetector(t *testing.T) {
+	// The child has to be this program, not the test binary: the
+	// testing package keeps timers of its own, and they alone are
+	// enough to stop the runtime declaring a deadlock
+	if testing.Short() {
+		t.Skip("builds the program")
+	}
+	gobin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("no go command to build the child")
+	}
+	bin := filepath.Join(t.TempDir(), "deadlock")
+	if out, err := exec.Command(gobin, "build", "-o", bin, "deadlock.go").CombinedOutput(); err != nil {
+		t.Fatalf("build: %v\n%s", err, out)
+	}
+
+	verdict, detail := runChild(bin, "alone", 10*time.Second)
+	if !strings.HasPrefix(verdict, "fatal error: all goroutines are asleep - deadlock!") {
+		t.Errorf("alone: %s", verdict)
+	}
+	if len(detail) != 2 || !strings.Contains(detail[0], "[chan send]") || !strings.HasPrefix(detail[1], "main.child ") {
+		t.Errorf("alone: detail %q, want the blocked send in main.child", detail)
+	}
+	if verdict, _ := runChild(bin, "with a timer", time.Second); !strings.HasPrefix(verdict, "no error") {
+		t.Errorf("with a timer: %s, want a hang", verdict)
+	}
+}
+
+func TestLocksExclude(t *testing.T) {
+	// Run with -race: the counter is only safe if the lock is
+	for _, l := range []sync.Locker{&spinLock{}, &ticketLock{}} {
+		n := 0
+		var wg sync.WaitGroup
+		for range 8 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for range 1000 {
+					l.Lock()
+					n++
+					l.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+		if n != 8000 {
+			t.Errorf("%T: count %d, want 8000", l, n)
+		}
+	}
+}
+
+func TestTicketLockIsFair(t *testing.T) {
+	// The polite goroutine waits at most for the greedy one's current
+	// turn, never for a run of them
+	f := contend(&ticketLock{}, 200*time.Millisecond)
+	if f.polite == 0 {
+		t.Fatal("polite goroutine never got the lock")
+	}
+	if worst := f.pct(1); worst > 10*time.Millisecond {
+		t.Errorf("polite goroutine waited up to %v for a ticket lock", worst)
+	}
+}
+
+func TestProfile(t *testing.T) {
+	runtime.SetBlockProfileRate(1)
+	defer runtime.SetBlockProfileRate(0)
+	var mu sync.Mutex
+	mu.Lock()
+	done := make(chan struct{})
+	go func() {
+		mu.Lock() // blocks until the Unlock below: one recorded wait
+		mu.Unlock()
+		close(done)
+	}()
+	time.Sleep(10 * time.Millisecond)
+	mu.Unlock()
+	<-done
+	for _, c := range profile("block") {
+		if strings.HasPrefix(c.where, "main.TestProfile.func1 ") {
+			if c.count < 1 || c.delay < 5*time.Millisecond {
+				t.Errorf("%s: %d waits, %v; want 1 of about 10ms", c.where, c.count, c.delay)
+			}
+			return
+		}
+	}
+	t.Errorf("no block profile record for the goroutine's Lock: %+v", profile("block"))
+}
+
+// ============================================================
+// Benchmarks
+// ============================================================
+
+// BenchmarkLocks is the price of each lock's fairness, alone and with
+// every goroutine after it at once
+func BenchmarkLocks(b *testing.B) {
+	locks := []struct {
+		name string
+		l    sync.Locker
+	}{
+		{"spin", &spinLock{}},
+		{"ticket", &ticketLock{}},
+		{"sync.Mutex", &sync.Mutex{}},
+	}
+	for _, lk := range locks {
+		b.Run(fmt.Sprintf("%s/uncontended", lk.name), func(b *testing.B) {
+			for range b.N {
+				lk.l.Lock()
+				lk.l.Unlock()
+			}
+		})
+		b.Run(fmt.Sprintf("%s/contended", lk.name), func(b *testing.B) {
+			b.SetParallelism(4)
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					lk.l.Lock()
+					lk.l.Unlock()
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,168 @@
+// filewatch - Debouncing and throttling a stream of file-change events
+//
+// File watchers (inotify, FSEvents, fsnotify) report every low-level
+// event, and one user action makes many: an editor's save is a write,
+// another write and a chmod; a git checkout is hundreds of files in a
+// few hundred milliseconds. Rebuilding on every event wastes work and
+// can start a build on a half-written tree.
+//
+// The demo replays the same scripted timeline against several
+// consumers and prints when each one would rebuild:
+//
+// - every event:        one rebuild per event, the baseline
+// - trailing:           once per burst, after 50ms of quiet, with every
+//                       file changed in the burst
+// - trailing + MaxWait: the same, but a long burst can't hold a rebuild
+//                       off for more than 150ms
+// - leading + trailing: react at once, then once more at the end
+// - throttle:           a status line redrawn at most every 100ms
+//
+// The events are accumulated in a set and the debounced function takes
+// the whole set: debouncing decides when, not what.
+//
+// Usage:
+//   go run ./cmd/filewatch
+package main
+
+import (
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bellistech/labs/coding/go/examples/concurrency/debounce"
+)
+
+type event struct {
+	at   time.Duration
+	path string
+}
+
+// wrapper is what Debouncer and Throttler have in common
+type wrapper interface {
+	Call(string)
+	Flush() bool
+}
+
+// timeline is the script: two editor saves (write, write, chmod), a
+// checkout, then a formatter rewriting one file a few times
+func timeline() []event {
+	ms := time.Millisecond
+	var evs []event
+	save := func(at time.Duration, path string) {
+		evs = append(evs,
+			event{at, path},
+			event{at + 1*ms, path},
+			event{at + 3*ms, path})
+	}
+	save(0, "main.go")
+	save(150*ms, "util.go")
+	for i := range 120 {
+		evs = append(evs, event{300*ms + time.Duration(i)*3*ms, fmt.Sprintf("pkg/f%03d.go", i)})
+	}
+	for i := range 5 {
+		evs = append(evs, event{800*ms + time.Duration(i)*5*ms, "main.go"})
+	}
+	return evs
+}
+
+// replay sends each event to handle at its time after start
+func replay(evs []event, start time.Time, handle func(event)) {
+	for _, ev := range evs {
+		time.Sleep(time.Until(start.Add(ev.at)))
+		handle(ev)
+	}
+}
+
+// changeSet gathers the paths changed since the last rebuild
+type changeSet struct {
+	mu    sync.Mutex
+	paths map[string]bool
+}
+
+func (c *changeSet) add(path string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.paths == nil {
+		c.paths = map[string]bool{}
+	}
+	c.paths[path] = true
+}
+
+func (c *changeSet) take() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	paths := slices.Sorted(maps.Keys(c.paths))
+	c.paths = nil
+	return paths
+}
+
+func summary(paths []string) string {
+	if len(paths) <= 3 {
+		return strings.Join(paths, " ")
+	}
+	return fmt.Sprintf("%s ... %s", strings.Join(paths[:2], " "), paths[len(paths)-1])
+}
+
+// watch runs one consumer over the timeline. newWrapper builds the
+// debouncer or throttler around the rebuild function
+func watch(name string, newWrapper func(rebuild func(string)) wrapper) {
+	fmt.Printf("\n=== %s ===\n", name)
+	evs := timeline()
+	start := time.Now()
+	var changes changeSet
+	var rebuilds atomic.Int64 // written on timer goroutines
+	w := newWrapper(func(string) {
+		paths := changes.take()
+		if len(paths) == 0 {
+			return // a leading rebuild already took these
+		}
+		fmt.Printf("  %4dms  rebuild #%d: %3d files  %s\n",
+			time.Since(start).Milliseconds(), rebuilds.Add(1), len(paths), summary(paths))
+	})
+	replay(evs, start, func(ev event) {
+		changes.add(ev.path)
+		w.Call(ev.path)
+	})
+	time.Sleep(200 * time.Millisecond) // let the trailing edge fire
+	w.Flush()
+	fmt.Printf("  %d events, %d rebuilds\n", len(evs), rebuilds.Load())
+}
+
+func main() {
+	evs := timeline()
+	fmt.Println("=== Every event ===")
+	fmt.Printf("  %d events: %d rebuilds, most of them of a half-written tree\n", len(evs), len(evs))
+
+	watch("Debounce, trailing, wait 50ms", func(f func(string)) wrapper {
+		return debounce.NewDebouncer(50*time.Millisecond, debounce.Options{Trailing: true}, f)
+	})
+	watch("Debounce, trailing, wait 50ms, MaxWait 150ms", func(f func(string)) wrapper {
+		return debounce.NewDebouncer(50*time.Millisecond, debounce.Options{Trailing: true, MaxWait: 150 * time.Millisecond}, f)
+	})
+	watch("Debounce, leading + trailing, wait 50ms", func(f func(string)) wrapper {
+		return debounce.NewDebouncer(50*time.Millisecond, debounce.Options{Leading: true, Trailing: true}, f)
+	})
+
+	fmt.Println("\n=== Throttle, leading + trailing, 100ms: a status line ===")
+	start := time.Now()
+	var mu sync.Mutex
+	seen := 0
+	status := debounce.NewThrottler(100*time.Millisecond, debounce.Options{Leading: true, Trailing: true}, func(path string) {
+		mu.Lock()
+		n := seen
+		mu.Unlock()
+		fmt.Printf("  %4dms  %3d events so far, last %s\n", time.Since(start).Milliseconds(), n, path)
+	})
+	replay(evs, start, func(ev event) {
+		mu.Lock()
+		seen++
+		mu.Unlock()
+		status.Call(ev.path)
+	})
+	time.Sleep(150 * time.Millisecond)
+	fmt.Printf("  %d events, redrawn at most every 100ms; the last redraw shows the final state\n", len(evs))
+}
@@ -0,0 +1,284 @@
+// Package debounce rate-shapes bursts of events.
+//
+//   - A Debouncer waits for a burst to end: an editor's save that arrives
+//     as write, write, chmod becomes one "file changed"; a search box
+//     queries once the user stops typing.
+//   - A Throttler lets one call through per interval however many
+//     arrive: a progress line redrawn at most 10 times a second.
+//
+// Both take Leading and Trailing edges. Leading runs on the first event
+// of a burst (responsive); Trailing runs on the last one, once things
+// are quiet (complete). With both, a burst of one event runs once, and
+// a longer burst runs at both ends.
+//
+// Time comes from a Clock, so tests can move it by hand instead of
+// sleeping; see debounce_test.go.
+package debounce
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is the part of package time the wrappers use
+type Clock interface {
+	Now() time.Time
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer is what AfterFunc returns
+type Timer interface {
+	Stop() bool
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time                            { return time.Now() }
+func (realClock) AfterFunc(d time.Duration, f func()) Timer { return time.AfterFunc(d, f) }
+
+// Options for NewDebouncer and NewThrottler. The zero value means
+// trailing edge only, on the real clock
+type Options struct {
+	Leading  bool
+	Trailing bool
+	// MaxWait bounds how long a Debouncer can put off a pending call
+	// while events keep coming. Without it, a steady stream with gaps
+	// shorter than wait never runs fn at all. Ignored by Throttler
+	MaxWait time.Duration
+	Clock   Clock
+}
+
+func (o *Options) defaults() {
+	if !o.Leading && !o.Trailing {
+		o.Trailing = true
+	}
+	if o.Clock == nil {
+		o.Clock = realClock{}
+	}
+}
+
+// gate runs fn with the latest value and keeps the bookkeeping the two
+// wrappers share: the value waiting to be delivered, and a generation
+// number so a timer that fires after being replaced does nothing. A
+// timer's Stop can lose the race with its own firing, so checking the
+// generation is the only reliable way to ignore it
+type gate[T any] struct {
+	opts Options
+	fn   func(T)
+
+	mu      sync.Mutex
+	gen     int
+	timer   Timer // nil when idle
+	pending bool
+	last    T
+
+	// fnMu keeps calls to fn from overlapping: a leading call from
+	// Call's goroutine and a trailing one from a timer could otherwise
+	// run at once
+	fnMu sync.Mutex
+}
+
+// arm replaces the timer; g.mu held
+func (g *gate[T]) arm(d time.Duration, fire func(gen int)) {
+	if g.timer != nil {
+		g.timer.Stop()
+	}
+	g.gen++
+	gen := g.gen
+	g.timer = g.opts.Clock.AfterFunc(d, func() { fire(gen) })
+}
+
+// idle stops the timer and forgets the pending value; g.mu held
+func (g *gate[T]) idle() {
+	if g.timer != nil {
+		g.timer.Stop()
+		g.timer = nil
+	}
+	g.gen++
+	g.pending = false
+	var zero T
+	g.last = zero
+}
+
+// take returns the pending value and clears it; g.mu held
+func (g *gate[T]) take() (T, bool) {
+	v, ok := g.last, g.pending
+	var zero T
+	g.last, g.pending = zero, false
+	return v, ok
+}
+
+func (g *gate[T]) run(v T) {
+	g.fnMu.Lock()
+	defer g.fnMu.Unlock()
+	g.fn(v)
+}
+
+// flush runs fn now with the pending value, if any, and goes idle
+func (g *gate[T]) flush() bool {
+	g.mu.Lock()
+	v, ok := g.take()
+	g.idle()
+	g.mu.Unlock()
+	if ok {
+		g.run(v)
+	}
+	return ok
+}
+
+func (g *gate[T]) cancel() {
+	g.mu.Lock()
+	g.idle()
+	g.mu.Unlock()
+}
+
+// ============================================================
+// Debouncer
+// ============================================================
+
+// Debouncer runs fn once per burst of calls, a burst being calls less
+// than wait apart. fn gets the value of the last call (Trailing) or the
+// first (Leading)
+type Debouncer[T any] struct {
+	gate[T]
+	wait       time.Duration
+	lastCall   time.Time
+	burstStart time.Time
+}
+
+func NewDebouncer[T any](wait time.Duration, opts Options, fn func(T)) *Debouncer[T] {
+	opts.defaults()
+	return &Debouncer[T]{gate: gate[T]{opts: opts, fn: fn}, wait: wait}
+}
+
+// Call records an event with value v
+func (d *Debouncer[T]) Call(v T) {
+	d.mu.Lock()
+	now := d.opts.Clock.Now()
+	d.lastCall = now
+	if d.timer == nil {
+		// First event of a burst
+		d.burstStart = now
+		d.arm(d.wait, d.fire)
+		if d.opts.Leading {
+			d.mu.Unlock()
+			d.run(v)
+			return
+		}
+		d.last, d.pending = v, true
+		d.mu.Unlock()
+		return
+	}
+	d.last, d.pending = v, true
+	d.arm(d.delay(now), d.fire)
+	d.mu.Unlock()
+}
+
+// delay is how long to wait from now: wait, unless MaxWait since the
+// burst started comes sooner; d.mu held
+func (d *Debouncer[T]) delay(now time.Time) time.Duration {
+	if d.opts.MaxWait <= 0 {
+		return d.wait
+	}
+	return max(0, min(d.wait, d.burstStart.Add(d.opts.MaxWait).Sub(now)))
+}
+
+func (d *Debouncer[T]) fire(gen int) {
+	d.mu.Lock()
+	if gen != d.gen {
+		d.mu.Unlock() // replaced or canceled while firing
+		return
+	}
+	now := d.opts.Clock.Now()
+	quiet := now.Sub(d.lastCall) >= d.wait
+	var v T
+	var ok bool
+	switch {
+	case quiet:
+		// The burst is over
+		if d.opts.Trailing {
+			v, ok = d.take()
+		}
+		d.idle()
+	default:
+		// MaxWait cut in: deliver what's pending and start a new burst,
+		// which is still in progress
+		v, ok = d.take()
+		d.burstStart = now
+		d.arm(d.delay(now), d.fire)
+	}
+	d.mu.Unlock()
+	if ok {
+		d.run(v)
+	}
+}
+
+// Flush runs a pending call now instead of waiting, and reports whether
+// there was one. Use it on shutdown so the last event isn't lost
+func (d *Debouncer[T]) Flush() bool { return d.flush() }
+
+// Cancel drops a pending call
+func (d *Debouncer[T]) Cancel() { d.cancel() }
+
+// ============================================================
+// Throttler
+// ============================================================
+
+// Throttler runs fn at most once per interval. Calls in between are
+// dropped, except that with Trailing the last of them runs when the
+// interval ends
+type Throttler[T any] struct {
+	gate[T]
+	interval time.Duration
+}
+
+func NewThrottler[T any](interval time.Duration, opts Options, fn func(T)) *Throttler[T] {
+	opts.defaults()
+	return &Throttler[T]{gate: gate[T]{opts: opts, fn: fn}, interval: interval}
+}
+
+// Call records an event with value v
+func (t *Throttler[T]) Call(v T) {
+	t.mu.Lock()
+	if t.timer == nil {
+		t.arm(t.interval, t.fire)
+		if t.opts.Leading {
+			t.mu.Unlock()
+			t.run(v)
+			return
+		}
+	}
+	t.last, t.pending = v, true
+	t.mu.Unlock()
+}
+
+func (t *Throttler[T]) fire(gen int) {
+	t.mu.Lock()
+	if gen != t.gen {
+		t.mu.Unlock()
+		return
+	}
+	var v T
+	var ok bool
+	if t.opts.Trailing {
+		v, ok = t.take()
+	}
+	if ok {
+		// Running now starts a new interval, or the next call could run
+		// immediately after this one
+		t.arm(t.interval, t.fire)
+	} else {
+		t.idle()
+	}
+	t.mu.Unlock()
+	if ok {
+		t.run(v)
+	}
+}
+
+// Flush runs a pending trailing call now and reports whether there was
+// one
+func (t *Throttler[T]) Flush() bool { return t.flush() }
+
+// Cancel drops a pending call and ends the current interval
+func (t *Throttler[T]) Cancel() { t.cancel() }
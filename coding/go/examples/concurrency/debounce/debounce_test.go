@@ -0,0 +1,312 @@
+package debounce
+
+import (
+	"slices"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock only moves when told to, and runs due timers itself, on the
+// goroutine that calls advance, in order of their deadlines
+type fakeClock struct {
+	mu     sync.Mutex
+	t      time.Time
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	c       *fakeClock
+	at      time.Time
+	f       func()
+	stopped bool
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{t: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.t
+}
+
+func (c *fakeClock) AfterFunc(d time.Duration, f func()) Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTimer{c: c, at: c.t.Add(d), f: f}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.c.mu.Lock()
+	defer t.c.mu.Unlock()
+	was := !t.stopped
+	t.stopped = true
+	return was
+}
+
+// advance moves time forward by d, stopping at each timer on the way so
+// that timers armed by a firing one are seen too
+func (c *fakeClock) advance(d time.Duration) {
+	c.mu.Lock()
+	end := c.t.Add(d)
+	for {
+		sort.SliceStable(c.timers, func(i, j int) bool { return c.timers[i].at.Before(c.timers[j].at) })
+		var next *fakeTimer
+		for len(c.timers) > 0 {
+			t := c.timers[0]
+			if t.stopped {
+				c.timers = c.timers[1:]
+				continue
+			}
+			if !t.at.After(end) {
+				next = t
+				c.timers = c.timers[1:]
+			}
+			break
+		}
+		if next == nil {
+			break
+		}
+		next.stopped = true
+		c.t = next.at
+		c.mu.Unlock()
+		next.f()
+		c.mu.Lock()
+	}
+	c.t = end
+	c.mu.Unlock()
+}
+
+// recorder collects fn's calls with the fake time they happened at, in
+// milliseconds since the start
+type recorder struct {
+	clk   *fakeClock
+	start time.Time
+	mu    sync.Mutex
+	calls []call
+}
+
+type call struct {
+	ms int
+	v  int
+}
+
+func newRecorder(clk *fakeClock) *recorder {
+	return &recorder{clk: clk, start: clk.Now()}
+}
+
+func (r *recorder) fn(v int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.calls = append(r.calls, call{int(r.clk.Now().Sub(r.start) / time.Millisecond), v})
+}
+
+// play calls call(v) at each of the times in ms, then lets time run on
+// long enough for anything pending to fire
+func play(clk *fakeClock, r *recorder, call func(int), at []int) {
+	for i, ms := range at {
+		clk.advance(r.start.Add(time.Duration(ms) * time.Millisecond).Sub(clk.Now()))
+		call(i)
+	}
+	clk.advance(time.Second)
+}
+
+func TestDebounce(t *testing.T) {
+	// A burst at 0-40ms, then a lone event at 200ms. wait is 50ms
+	burst := []int{0, 10, 20, 40, 200}
+	tests := []struct {
+		name string
+		opts Options
+		at   []int
+		want []call
+	}{
+		{"trailing", Options{Trailing: true}, burst,
+			[]call{{90, 3}, {250, 4}}},
+		{"zero options mean trailing", Options{}, burst,
+			[]call{{90, 3}, {250, 4}}},
+		{"leading", Options{Leading: true}, burst,
+			[]call{{0, 0}, {200, 4}}},
+		// A burst runs at both ends, a lone event only once
+		{"both", Options{Leading: true, Trailing: true}, burst,
+			[]call{{0, 0}, {90, 3}, {200, 4}}},
+		// Events every 30ms never leave a 50ms gap: only MaxWait gets
+		// anything through before they stop
+		{"steady stream", Options{}, []int{0, 30, 60, 90, 120, 150, 180},
+			[]call{{230, 6}}},
+		{"steady stream, MaxWait", Options{MaxWait: 100 * time.Millisecond}, []int{0, 30, 60, 90, 120, 150, 180},
+			[]call{{100, 3}, {200, 6}}},
+		{"leading, MaxWait", Options{Leading: true, MaxWait: 100 * time.Millisecond}, []int{0, 30, 60, 90, 120},
+			[]call{{0, 0}, {100, 3}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clk := newFakeClock()
+			tt.opts.Clock = clk
+			r := newRecorder(clk)
+			d := NewDebouncer(50*time.Millisecond, tt.opts, r.fn)
+			play(clk, r, d.Call, tt.at)
+			if !slices.Equal(r.calls, tt.want) {
+				t.Errorf("calls (ms, value) = %v, want %v", r.calls, tt.want)
+			}
+		})
+	}
+}
+
+func TestThrottle(t *testing.T) {
+	// Events every 10ms for 100ms, then one more at 300ms. interval is 50ms
+	at := []int{0, 10, 20, 30, 40, 50, 60, 70, 80, 90, 300}
+	tests := []struct {
+		name string
+		opts Options
+		want []call
+	}{
+		// Leading runs the first event of each interval; the next
+		// interval starts with the next event, not on a fixed grid
+		{"leading", Options{Leading: true},
+			[]call{{0, 0}, {50, 5}, {300, 10}}},
+		{"trailing", Options{Trailing: true},
+			[]call{{50, 4}, {100, 9}, {350, 10}}},
+		{"both", Options{Leading: true, Trailing: true},
+			[]call{{0, 0}, {50, 4}, {100, 9}, {300, 10}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			clk := newFakeClock()
+			tt.opts.Clock = clk
+			r := newRecorder(clk)
+			th := NewThrottler(50*time.Millisecond, tt.opts, r.fn)
+			play(clk, r, th.Call, at)
+			if !slices.Equal(r.calls, tt.want) {
+				t.Errorf("calls (ms, value) = %v, want %v", r.calls, tt.want)
+			}
+		})
+	}
+}
+
+func TestFlushAndCancel(t *testing.T) {
+	clk := newFakeClock()
+	r := newRecorder(clk)
+	d := NewDebouncer(50*time.Millisecond, Options{Clock: clk}, r.fn)
+
+	d.Call(1)
+	clk.advance(10 * time.Millisecond)
+	if !d.Flush() {
+		t.Error("Flush with a call pending returned false")
+	}
+	if d.Flush() {
+		t.Error("second Flush returned true")
+	}
+	d.Call(2)
+	d.Cancel()
+	clk.advance(time.Second) // the canceled timer must not fire
+	if want := []call{{10, 1}}; !slices.Equal(r.calls, want) {
+		t.Errorf("calls = %v, want %v", r.calls, want)
+	}
+
+	// After Cancel the next event starts a fresh burst
+	d.Call(3)
+	clk.advance(50 * time.Millisecond)
+	if len(r.calls) != 2 || r.calls[1].v != 3 {
+		t.Errorf("calls = %v, want a trailing call with 3", r.calls)
+	}
+}
+
+func TestThrottleFlush(t *testing.T) {
+	clk := newFakeClock()
+	r := newRecorder(clk)
+	th := NewThrottler(50*time.Millisecond, Options{Leading: true, Trailing: true, Clock: clk}, r.fn)
+	th.Call(1) // runs
+	th.Call(2) // pending
+	th.Flush() // runs 2 and ends the interval
+	th.Call(3) // so this runs at once
+	if want := []call{{0, 1}, {0, 2}, {0, 3}}; !slices.Equal(r.calls, want) {
+		t.Errorf("calls = %v, want %v", r.calls, want)
+	}
+}
+
+func TestRealClock(t *testing.T) {
+	// Run with -race: Call from many goroutines, fn from timers. A
+	// wrapper's fn must never run twice at once
+	type wrapper interface {
+		Call(int)
+		Flush() bool
+	}
+	tests := []struct {
+		name string
+		make func(fn func(int)) wrapper
+	}{
+		{"debounce", func(fn func(int)) wrapper {
+			return NewDebouncer(5*time.Millisecond, Options{Leading: true, Trailing: true, MaxWait: 10 * time.Millisecond}, fn)
+		}},
+		{"throttle", func(fn func(int)) wrapper {
+			return NewThrottler(5*time.Millisecond, Options{Leading: true, Trailing: true}, fn)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			running, calls := false, 0
+			w := tt.make(func(int) {
+				mu.Lock()
+				if running {
+					t.Error("fn calls overlap")
+				}
+				running = true
+				mu.Unlock()
+				time.Sleep(time.Millisecond)
+				mu.Lock()
+				running = false
+				calls++
+				mu.Unlock()
+			})
+			var wg sync.WaitGroup
+			for g := range 4 {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for i := range 200 {
+						w.Call(g*1000 + i)
+						if i%50 == 0 {
+							time.Sleep(time.Millisecond)
+						}
+					}
+				}()
+			}
+			wg.Wait()
+			w.Flush()
+			mu.Lock()
+			defer mu.Unlock()
+			if calls == 0 {
+				t.Error("fn never ran")
+			}
+		})
+	}
+}
+
+// ============================================================
+// Benchmarks
+// ============================================================
+
+// BenchmarkCall is the cost of an event that is absorbed, the common
+// case: a timer reset for Debouncer, nothing for Throttler
+func BenchmarkCall(b *testing.B) {
+	b.Run("debounce", func(b *testing.B) {
+		d := NewDebouncer(time.Hour, Options{}, func(int) {})
+		for i := range b.N {
+			d.Call(i)
+		}
+		d.Cancel()
+	})
+	b.Run("throttle", func(b *testing.B) {
+		th := NewThrottler(time.Hour, Options{}, func(int) {})
+		for i := range b.N {
+			th.Call(i)
+		}
+		th.Cancel()
+	})
+}
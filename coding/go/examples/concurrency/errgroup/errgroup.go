@@ -0,0 +1,488 @@
+// errgroup Patterns - Goroutines that can fail, done properly
+//
+// sync.WaitGroup answers "are they all done?". Real fan-out work also
+// needs "did any of them fail, and should the rest stop?". That is
+// golang.org/x/sync/errgroup. This example fetches items from a local
+// HTTP server, one of which always fails, and shows:
+// - The WaitGroup baseline: errors have to be collected by hand and
+//   nothing stops the remaining fetches once one has failed
+// - errgroup.WithContext + SetLimit: at most N fetches in flight, the
+//   first error cancels the context, in-flight requests abort, and
+//   Wait returns that error
+// - Collecting results without races: a slot per index, a mutex-held
+//   map, or a channel read by a collector outside the group
+// - Every error instead of the first: a plain Group plus errors.Join
+// - A pipeline (producer, workers, aggregator) as one group, so a
+//   failure anywhere tears all stages down
+// - TryGo for shedding work when the group is already full
+// - The context from WithContext is canceled once Wait returns, even
+//   on success, so it must not outlive the group
+//
+// The same first-error cancellation built by hand, from a WaitGroup, a
+// cancel func and a semaphore channel, is the group mode of
+// ../context_cancel.go; this file goes further.
+//
+// golang.org/x/sync is outside the standard library, so this example is
+// a module of its own: go.mod and go.sum pin the version.
+//
+// Usage (from this directory):
+//   go run .             # every pattern in turn
+//   go run . limit       # just one: baseline, limit, collect,
+//                        # all, pipeline, trygo, ctx
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/errgroup"
+)
+
+// ============================================================
+// A catalog server to fetch from
+// ============================================================
+
+const (
+	numItems = 20
+	badItem  = 7 // always answers 500
+)
+
+// serverStats is what the server saw, to show what each pattern
+// actually cost it
+type serverStats struct {
+	started  atomic.Int64 // requests that arrived
+	finished atomic.Int64 // requests answered in full
+	inFlight atomic.Int64
+	peak     atomic.Int64
+}
+
+func (s *serverStats) reset() {
+	s.started.Store(0)
+	s.finished.Store(0)
+	s.peak.Store(0)
+}
+
+func (s *serverStats) String() string {
+	return fmt.Sprintf("server: %d requests started, %d completed, peak %d in flight",
+		s.started.Load(), s.finished.Load(), s.peak.Load())
+}
+
+type Item struct {
+	ID    int     `json:"id"`
+	Name  string  `json:"name"`
+	Price float64 `json:"price"`
+}
+
+func startCatalog(stats *serverStats) string {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /items/{id}", func(w http.ResponseWriter, r *http.Request) {
+		stats.started.Add(1)
+		n := stats.inFlight.Add(1)
+		defer stats.inFlight.Add(-1)
+		for {
+			p := stats.peak.Load()
+			if n <= p || stats.peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+
+		id, _ := strconv.Atoi(r.PathValue("id"))
+		if id < 1 || id > numItems {
+			http.NotFound(w, r)
+			return
+		}
+		// The bad item fails fast; the rest take 50-150ms
+		delay := time.Duration(50+rand.Intn(100)) * time.Millisecond
+		if id == badItem {
+			delay = 20 * time.Millisecond
+		}
+		select {
+		case <-time.After(delay):
+		case <-r.Context().Done():
+			return // the client gave up: stop working for it
+		}
+		if id == badItem {
+			http.Error(w, "database on fire", http.StatusInternalServerError)
+			return
+		}
+		stats.finished.Add(1)
+		json.NewEncoder(w).Encode(Item{ID: id, Name: fmt.Sprintf("item-%02d", id), Price: float64(id) * 1.25})
+	})
+
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	go http.Serve(ln, mux)
+	return "http://" + ln.Addr().String()
+}
+
+var errFetch = errors.New("fetch failed")
+
+// fetch gets one item. The request carries ctx, so canceling ctx
+// aborts the request and closes the connection
+func fetch(ctx context.Context, base string, id int) (Item, error) {
+	var it Item
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf("%s/items/%d", base, id), nil)
+	if err != nil {
+		return it, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return it, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return it, fmt.Errorf("item %d: %w: %s", id, errFetch, resp.Status)
+	}
+	return it, json.NewDecoder(resp.Body).Decode(&it)
+}
+
+// ids returns 1..numItems, optionally without the bad one
+func ids(withBad bool) []int {
+	var out []int
+	for id := 1; id <= numItems; id++ {
+		if id != badItem || withBad {
+			out = append(out, id)
+		}
+	}
+	return out
+}
+
+// ============================================================
+// Patterns
+// ============================================================
+
+// baseline: the WaitGroup version. It works, but the failure of item
+// 7 changes nothing for the others, and the caller has to dig the
+// errors out of a slice afterwards
+func baseline(base string, stats *serverStats) {
+	start := time.Now()
+	items := make([]Item, numItems)
+	errs := make([]error, numItems)
+	var wg sync.WaitGroup
+	for i, id := range ids(true) {
+		wg.Go(func() {
+			items[i], errs[i] = fetch(context.Background(), base, id)
+		})
+	}
+	wg.Wait()
+
+	failed := 0
+	for _, err := range errs {
+		if err != nil {
+			failed++
+		}
+	}
+	fmt.Printf("  %d failed; all %d fetches ran to the end, unbounded, in %v\n",
+		failed, numItems, time.Since(start).Round(time.Millisecond))
+	fmt.Println(" ", stats)
+}
+
+// limited: bounded parallelism and first-error cancellation
+func limited(base string, stats *serverStats) {
+	start := time.Now()
+	g, ctx := errgroup.WithContext(context.Background())
+	g.SetLimit(4) // Go blocks while 4 are running
+
+	items := make([]Item, numItems)
+	launched := 0
+	for i, id := range ids(true) {
+		// After the first failure there is no point starting more:
+		// stop the loop, not just the goroutines
+		if ctx.Err() != nil {
+			break
+		}
+		launched++
+		g.Go(func() error {
+			it, err := fetch(ctx, base, id)
+			if err != nil {
+				return err
+			}
+			items[i] = it // own slot: no lock needed
+			return nil
+		})
+	}
+	err := g.Wait()
+
+	got := 0
+	for _, it := range items {
+		if it.ID != 0 {
+			got++
+		}
+	}
+	fmt.Printf("  Wait() = %v\n", err)
+	fmt.Printf("  launched %d of %d, %d items fetched, stopped after %v\n",
+		launched, numItems, got, time.Since(start).Round(time.Millisecond))
+	fmt.Println(" ", stats)
+	fmt.Println("  (started but not completed = canceled mid-request by the first error)")
+}
+
+// collect shows three race-free ways to gather results
+func collect(base string, stats *serverStats) {
+	want := ids(false)
+
+	// 1. Preallocated slice, one slot per goroutine. Distinct elements
+	// are distinct memory, so there is nothing to lock; order is kept
+	g, ctx := errgroup.WithContext(context.Background())
+	g.SetLimit(8)
+	bySlot := make([]Item, len(want))
+	for i, id := range want {
+		g.Go(func() (err error) {
+			bySlot[i], err = fetch(ctx, base, id)
+			return err
+		})
+	}
+	if err := g.Wait(); err != nil {
+		fmt.Println("  slots:", err)
+		return
+	}
+	fmt.Printf("  slots:   %d items, in request order: %v...\n", len(bySlot), names(bySlot[:3]))
+
+	// 2. A map needs a mutex: map writes are never safe concurrently
+	g, ctx = errgroup.WithContext(context.Background())
+	g.SetLimit(8)
+	var mu sync.Mutex
+	byID := map[int]Item{}
+	for _, id := range want {
+		g.Go(func() error {
+			it, err := fetch(ctx, base, id)
+			if err != nil {
+				return err
+			}
+			mu.Lock()
+			byID[id] = it
+			mu.Unlock()
+			return nil
+		})
+	}
+	if err := g.Wait(); err != nil {
+		fmt.Println("  map:", err)
+		return
+	}
+	fmt.Printf("  map:     %d items, keyed by id\n", len(byID))
+
+	// 3. A channel, drained by a collector that is NOT in the group.
+	// Someone has to close the channel after Wait, and the collector
+	// must run while the group does or the senders block forever
+	g, ctx = errgroup.WithContext(context.Background())
+	g.SetLimit(8)
+	results := make(chan Item)
+	var total float64
+	var arrival []int
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for it := range results {
+			total += it.Price
+			arrival = append(arrival, it.ID)
+		}
+	}()
+	for _, id := range want {
+		g.Go(func() error {
+			it, err := fetch(ctx, base, id)
+			if err != nil {
+				return err
+			}
+			select {
+			case results <- it:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+	}
+	err := g.Wait()
+	close(results)
+	<-done
+	if err != nil {
+		fmt.Println("  channel:", err)
+		return
+	}
+	fmt.Printf("  channel: %d items, total $%.2f, in arrival order: %v...\n", len(arrival), total, arrival[:6])
+	fmt.Println(" ", stats)
+}
+
+func names(items []Item) []string {
+	var out []string
+	for _, it := range items {
+		out = append(out, it.Name)
+	}
+	return out
+}
+
+// allErrors wants every failure, e.g. for a validation report. A plain
+// Group does not cancel anything; each goroutine keeps its own error
+func allErrors(base string, stats *serverStats) {
+	var g errgroup.Group
+	g.SetLimit(8)
+	list := append(ids(true), 404, 405) // two that do not exist
+	errs := make([]error, len(list))
+	for i, id := range list {
+		g.Go(func() error {
+			_, errs[i] = fetch(context.Background(), base, id)
+			return nil // report through errs, not Wait
+		})
+	}
+	g.Wait()
+	err := errors.Join(errs...)
+	fmt.Printf("  errors.Join of %d results:\n", len(list))
+	fmt.Printf("    %s\n", strings.ReplaceAll(err.Error(), "\n", "\n    "))
+	fmt.Printf("  errors.Is(err, errFetch) = %v\n", errors.Is(err, errFetch))
+	fmt.Println(" ", stats)
+}
+
+// pipeline: producer -> 3 fetchers -> aggregator, all in one group.
+// Each stage selects on ctx.Done() when it sends, so when a fetcher
+// fails, the producer and aggregator return instead of blocking
+func pipeline(base string, stats *serverStats, withBad bool) {
+	g, ctx := errgroup.WithContext(context.Background())
+	idCh := make(chan int)
+	itemCh := make(chan Item)
+
+	g.Go(func() error { // producer
+		defer close(idCh)
+		for _, id := range ids(withBad) {
+			select {
+			case idCh <- id:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		return nil
+	})
+
+	// Fetchers have their own WaitGroup so the last one out can close
+	// itemCh; the errgroup still sees each one's error
+	var fetchers sync.WaitGroup
+	for range 3 {
+		fetchers.Add(1)
+		g.Go(func() error {
+			defer fetchers.Done()
+			for id := range idCh {
+				it, err := fetch(ctx, base, id)
+				if err != nil {
+					return err
+				}
+				select {
+				case itemCh <- it:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+			return nil
+		})
+	}
+	g.Go(func() error {
+		fetchers.Wait()
+		close(itemCh)
+		return nil
+	})
+
+	var count int
+	var sum float64
+	g.Go(func() error { // aggregator
+		for it := range itemCh {
+			count++
+			sum += it.Price
+		}
+		return nil
+	})
+
+	err := g.Wait()
+	fmt.Printf("  with item %d: %-5v -> Wait() = %v; aggregated %d items ($%.2f)\n",
+		badItem, withBad, err, count, sum)
+	fmt.Println(" ", stats)
+}
+
+// tryGo accepts work only while a slot is free, like a server that
+// answers 503 instead of queueing
+func tryGo(base string, stats *serverStats) {
+	var g errgroup.Group
+	g.SetLimit(3)
+	var accepted, shed []int
+	for _, id := range ids(false) {
+		if g.TryGo(func() error {
+			_, err := fetch(context.Background(), base, id)
+			return err
+		}) {
+			accepted = append(accepted, id)
+		} else {
+			shed = append(shed, id)
+		}
+		time.Sleep(15 * time.Millisecond) // requests trickling in
+	}
+	err := g.Wait()
+	fmt.Printf("  accepted %v\n  shed     %v\n  Wait() = %v\n", accepted, shed, err)
+}
+
+// ctxLifetime: the group's context dies with the group
+func ctxLifetime(base string) {
+	g, ctx := errgroup.WithContext(context.Background())
+	g.Go(func() error {
+		_, err := fetch(ctx, base, 1)
+		return err
+	})
+	err := g.Wait()
+	fmt.Printf("  Wait() = %v, then ctx.Err() = %v\n", err, ctx.Err())
+
+	// A classic bug: reusing that ctx for follow-up work
+	_, err = fetch(ctx, base, 2)
+	fmt.Printf("  fetch with the group's ctx after Wait: %v\n", err)
+	fmt.Println("  Derive the group from a context that lives as long as the follow-up work,")
+	fmt.Println("  and use that parent (not the group's ctx) after Wait.")
+}
+
+type pattern struct {
+	name, title string
+	run         func()
+}
+
+func main() {
+	stats := &serverStats{}
+	base := startCatalog(stats)
+
+	patterns := []pattern{
+		{"baseline", "WaitGroup baseline", func() { baseline(base, stats) }},
+		{"limit", "WithContext + SetLimit(4): first error cancels", func() { limited(base, stats) }},
+		{"collect", "Collecting results", func() { collect(base, stats) }},
+		{"all", "Every error, not the first", func() { allErrors(base, stats) }},
+		{"pipeline", "A pipeline in one group", func() {
+			pipeline(base, stats, false)
+			stats.reset()
+			pipeline(base, stats, true)
+		}},
+		{"trygo", "TryGo: shed load instead of waiting", func() { tryGo(base, stats) }},
+		{"ctx", "The group's context after Wait", func() { ctxLifetime(base) }},
+	}
+
+	only := ""
+	if len(os.Args) > 1 {
+		only = os.Args[1]
+		if !slices.ContainsFunc(patterns, func(p pattern) bool { return p.name == only }) {
+			fmt.Println("Usage: go run . [baseline|limit|collect|all|pipeline|trygo|ctx]")
+			os.Exit(2)
+		}
+	}
+	for _, p := range patterns {
+		if only != "" && p.name != only {
+			continue
+		}
+		fmt.Printf("=== %s ===\n", p.title)
+		stats.reset()
+		p.run()
+		fmt.Println()
+	}
+}
@@ -0,0 +1,389 @@
+// ETL Pipeline - A file-based pipeline with real I/O
+//
+// pipeline.go shows the pattern on toy strings. This example applies
+// it to a realistic Extract-Transform-Load job:
+//
+//   [CSV file] --> [parse] --> [validate/transform x N] --+--> [out.jsonl]
+//                                                         |
+//                                                         +--> [deadletter.jsonl]
+//
+// - Extract: stream a CSV (generated on the fly) row by row
+// - Transform: validate and normalize rows on several workers
+// - Load: write good rows as JSON lines, bad rows to a dead-letter file
+//
+// Nothing is held in memory beyond the rows in flight, so the same
+// code handles a file of any size.
+//
+// Usage:
+//   go run etl_pipeline.go
+//   go run etl_pipeline.go -rows 1000000 -workers 8 -dir /tmp/etl
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// RawRow is one CSV record as read from disk
+type RawRow struct {
+	Line   int
+	Fields []string
+}
+
+// Record is a validated, normalized row ready to load
+type Record struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	AmountUSD float64   `json:"amount_usd"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// DeadLetter is a row that failed validation, kept with its reason so
+// it can be fixed and replayed later
+type DeadLetter struct {
+	Line   int      `json:"line"`
+	Fields []string `json:"fields"`
+	Reason string   `json:"reason"`
+}
+
+// outcome is what a transform worker produces: exactly one of the two
+type outcome struct {
+	record *Record
+	dead   *DeadLetter
+}
+
+var csvHeader = []string{"id", "name", "email", "amount_cents", "created_at"}
+
+func main() {
+	rows := flag.Int("rows", 100_000, "number of CSV rows to generate")
+	workers := flag.Int("workers", 4, "number of transform workers")
+	dir := flag.String("dir", "", "output directory (default: a temp dir)")
+	flag.Parse()
+
+	outDir := *dir
+	if outDir == "" {
+		tmp, err := os.MkdirTemp("", "etl-")
+		if err != nil {
+			log.Fatalf("Failed to create temp dir: %v", err)
+		}
+		outDir = tmp
+	} else if err := os.MkdirAll(outDir, 0o755); err != nil {
+		log.Fatalf("Failed to create %s: %v", outDir, err)
+	}
+
+	inPath := filepath.Join(outDir, "input.csv")
+	outPath := filepath.Join(outDir, "out.jsonl")
+	deadPath := filepath.Join(outDir, "deadletter.jsonl")
+
+	fmt.Println("=== ETL Pipeline ===")
+	fmt.Println()
+
+	start := time.Now()
+	if err := generateCSV(inPath, *rows); err != nil {
+		log.Fatalf("Failed to generate input: %v", err)
+	}
+	fmt.Printf("Generated %d rows in %v -> %s\n", *rows, time.Since(start).Round(time.Millisecond), inPath)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	start = time.Now()
+	stats, err := runETL(ctx, inPath, outPath, deadPath, *workers)
+	if err != nil {
+		log.Fatalf("ETL failed: %v", err)
+	}
+	elapsed := time.Since(start)
+
+	fmt.Printf("Processed %d rows in %v (%.0f rows/s) with %d workers\n",
+		stats.loaded+stats.dead, elapsed.Round(time.Millisecond),
+		float64(stats.loaded+stats.dead)/elapsed.Seconds(), *workers)
+	fmt.Printf("  loaded:      %d -> %s\n", stats.loaded, outPath)
+	fmt.Printf("  dead-letter: %d -> %s\n", stats.dead, deadPath)
+}
+
+// etlStats counts what the load stage wrote
+type etlStats struct {
+	loaded int
+	dead   int
+}
+
+// runETL wires extract -> transform -> load and waits for completion.
+// The first I/O error stops the pipeline and is returned.
+func runETL(ctx context.Context, inPath, outPath, deadPath string, workers int) (etlStats, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	// Any stage can report a fatal error; the first one wins
+	errCh := make(chan error, 2)
+
+	raw := extract(ctx, inPath, errCh)
+
+	// Fan out the transform step, fan the outcomes back in
+	outcomes := make(chan outcome)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			transform(ctx, raw, outcomes)
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(outcomes)
+	}()
+
+	stats, loadErr := load(outcomes, outPath, deadPath)
+	if loadErr != nil {
+		cancel()
+		// Drain so the transform workers can exit
+		for range outcomes {
+		}
+		return stats, loadErr
+	}
+
+	select {
+	case err := <-errCh:
+		return stats, err
+	default:
+		return stats, nil
+	}
+}
+
+// extract streams rows from the CSV file. The header is skipped and
+// rows with the wrong number of columns are still passed on, so the
+// transform step can dead-letter them with a reason.
+func extract(ctx context.Context, path string, errCh chan<- error) <-chan RawRow {
+	out := make(chan RawRow, 64)
+	go func() {
+		defer close(out)
+
+		f, err := os.Open(path)
+		if err != nil {
+			errCh <- fmt.Errorf("open input: %w", err)
+			return
+		}
+		defer f.Close()
+
+		r := csv.NewReader(bufio.NewReaderSize(f, 64*1024))
+		r.FieldsPerRecord = -1 // validate column count ourselves
+
+		line := 0
+		for {
+			fields, err := r.Read()
+			line++
+			if errors.Is(err, io.EOF) {
+				return
+			}
+			if err != nil {
+				var parseErr *csv.ParseError
+				if errors.As(err, &parseErr) {
+					// Malformed quoting etc. - a bad row, not a bad file
+					fields = []string{err.Error()}
+				} else {
+					errCh <- fmt.Errorf("read input: %w", err)
+					return
+				}
+			}
+			if line == 1 {
+				continue // header
+			}
+
+			select {
+			case out <- RawRow{Line: line, Fields: fields}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// transform validates and normalizes rows until in is closed
+func transform(ctx context.Context, in <-chan RawRow, out chan<- outcome) {
+	for row := range in {
+		var o outcome
+		rec, err := parseRecord(row.Fields)
+		if err != nil {
+			o.dead = &DeadLetter{Line: row.Line, Fields: row.Fields, Reason: err.Error()}
+		} else {
+			o.record = rec
+		}
+
+		select {
+		case out <- o:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// parseRecord turns CSV fields into a Record or explains why it can't
+func parseRecord(fields []string) (*Record, error) {
+	if len(fields) != len(csvHeader) {
+		return nil, fmt.Errorf("expected %d columns, got %d", len(csvHeader), len(fields))
+	}
+
+	id, err := strconv.Atoi(fields[0])
+	if err != nil || id <= 0 {
+		return nil, fmt.Errorf("invalid id %q", fields[0])
+	}
+
+	name := strings.TrimSpace(fields[1])
+	if name == "" {
+		return nil, errors.New("empty name")
+	}
+
+	email := strings.ToLower(strings.TrimSpace(fields[2]))
+	if at := strings.IndexByte(email, '@'); at < 1 || at == len(email)-1 {
+		return nil, fmt.Errorf("invalid email %q", fields[2])
+	}
+
+	cents, err := strconv.ParseInt(fields[3], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid amount %q", fields[3])
+	}
+	if cents < 0 {
+		return nil, fmt.Errorf("negative amount %d", cents)
+	}
+
+	created, err := time.Parse(time.RFC3339, fields[4])
+	if err != nil {
+		return nil, fmt.Errorf("invalid created_at %q", fields[4])
+	}
+
+	return &Record{
+		ID:        id,
+		Name:      capitalize(name),
+		Email:     email,
+		AmountUSD: float64(cents) / 100,
+		CreatedAt: created.UTC(),
+	}, nil
+}
+
+// capitalize normalizes "bOB" to "Bob" and "éMILE" to "Émile". The
+// first letter is a rune, not a byte: s[:1] would split "é" in half
+func capitalize(s string) string {
+	s = strings.ToLower(s)
+	r, n := utf8.DecodeRuneInString(s)
+	if n == 0 {
+		return s
+	}
+	return string(unicode.ToTitle(r)) + s[n:]
+}
+
+// load writes outcomes to the output and dead-letter files. It is the
+// only stage touching those files, so no locking is needed.
+func load(in <-chan outcome, outPath, deadPath string) (etlStats, error) {
+	var stats etlStats
+
+	outFile, err := os.Create(outPath)
+	if err != nil {
+		return stats, fmt.Errorf("create output: %w", err)
+	}
+	defer outFile.Close()
+
+	deadFile, err := os.Create(deadPath)
+	if err != nil {
+		return stats, fmt.Errorf("create dead-letter file: %w", err)
+	}
+	defer deadFile.Close()
+
+	outBuf := bufio.NewWriter(outFile)
+	deadBuf := bufio.NewWriter(deadFile)
+	outEnc := json.NewEncoder(outBuf)
+	deadEnc := json.NewEncoder(deadBuf)
+
+	for o := range in {
+		if o.record != nil {
+			if err := outEnc.Encode(o.record); err != nil {
+				return stats, fmt.Errorf("write output: %w", err)
+			}
+			stats.loaded++
+			continue
+		}
+		if err := deadEnc.Encode(o.dead); err != nil {
+			return stats, fmt.Errorf("write dead-letter: %w", err)
+		}
+		stats.dead++
+	}
+
+	if err := outBuf.Flush(); err != nil {
+		return stats, fmt.Errorf("flush output: %w", err)
+	}
+	if err := deadBuf.Flush(); err != nil {
+		return stats, fmt.Errorf("flush dead-letter: %w", err)
+	}
+	return stats, nil
+}
+
+// generateCSV writes rows of fake customer data, with roughly 2% of
+// rows broken in one of several ways so the dead-letter path is used
+func generateCSV(path string, rows int) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	bw := bufio.NewWriter(f)
+	w := csv.NewWriter(bw)
+
+	if err := w.Write(csvHeader); err != nil {
+		return err
+	}
+
+	names := []string{"alice", "BOB", "carol", "Dave", "eve", "frank"}
+	base := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	for i := 1; i <= rows; i++ {
+		name := names[rand.Intn(len(names))]
+		row := []string{
+			strconv.Itoa(i),
+			name,
+			fmt.Sprintf("%s%d@example.com", strings.ToLower(name), i),
+			strconv.Itoa(rand.Intn(100_000)),
+			base.Add(time.Duration(i) * time.Minute).Format(time.RFC3339),
+		}
+
+		if rand.Intn(50) == 0 {
+			switch rand.Intn(4) {
+			case 0:
+				row[2] = "not-an-email"
+			case 1:
+				row[3] = "-" + row[3]
+			case 2:
+				row[4] = "yesterday"
+			case 3:
+				row = row[:3]
+			}
+		}
+
+		if err := w.Write(row); err != nil {
+			return err
+		}
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return bw.Flush()
+}
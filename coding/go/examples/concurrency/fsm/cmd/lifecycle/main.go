@@ -0,0 +1,406 @@
+// lifecycle - A TCP server whose connections are state machines
+//
+// Each connection has one fsm.Machine, and everything that happens to
+// the connection is an event on it:
+//
+//   connecting  --hello-->             established
+//               --handshake timeout--> closed
+//   established --request--> established --done--> established
+//               --idle timeout-->      closed    (if nothing in flight)
+//               --shutdown-->          draining  (if something is)
+//               --shutdown-->          closed
+//   draining    --done-->              closed    (the last one)
+//               --grace timeout-->     closed
+//   any         --hangup-->            closed
+//
+// The events come from several goroutines at once: the connection's
+// reader, a goroutine per request, three kinds of timer, and the
+// server's shutdown. The machine runs them one at a time, so the
+// guards can read the in-flight count without a race. Entering closed
+// is the only place the socket is closed, and closed has no way out,
+// so it happens exactly once however the events interleave.
+//
+// The protocol is lines: "HELLO name", then "WORK ms" requests, which
+// may overlap; the server answers "OK ms" as each finishes.
+//
+// By default it runs a script of clients against itself and prints
+// the server's transitions alongside what the clients heard. Things to
+// look for:
+// - slowpoke never says hello, and is closed by the handshake timeout
+// - quiet does one request, then goes idle and is closed for it
+// - busy has requests in flight at shutdown: it drains, its new
+//   request is refused, and it closes when the last one is done
+// - stuck's request outlasts the grace period, and is cut off
+// - leaver hangs up mid-request; the request's done arrives after
+//   closed, and is refused
+//
+// Usage:
+//   go run ./cmd/lifecycle
+//   go run ./cmd/lifecycle -listen :7070   (then: nc localhost 7070)
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bellistech/labs/coding/go/examples/concurrency/fsm"
+)
+
+// ============================================================
+// States and events
+// ============================================================
+
+type state int
+
+const (
+	connecting state = iota
+	established
+	draining
+	closed
+)
+
+func (s state) String() string {
+	return [...]string{"connecting", "established", "draining", "closed"}[s]
+}
+
+type event int
+
+const (
+	hello event = iota
+	request
+	done
+	handshakeTimeout
+	idleTimeout
+	shutdown
+	graceTimeout
+	hangup
+)
+
+func (e event) String() string {
+	return [...]string{"hello", "request", "done", "handshake timeout",
+		"idle timeout", "shutdown", "grace timeout", "hangup"}[e]
+}
+
+// ============================================================
+// Server
+// ============================================================
+
+type server struct {
+	ln                     net.Listener
+	def                    *fsm.Def[state, event, *conn]
+	handshake, idle, grace time.Duration
+	start                  time.Time
+	ids                    atomic.Int64
+
+	mu      sync.Mutex
+	conns   map[*conn]struct{} // until they enter closed
+	closing bool
+	open    sync.WaitGroup // one per entry in conns
+}
+
+type conn struct {
+	id     int64
+	srv    *server
+	nc     net.Conn
+	m      *fsm.Machine[state, event, *conn]
+	ctx    context.Context // cancelled on closed, for its requests
+	cancel context.CancelFunc
+	wmu    sync.Mutex // the reader, requests and hooks all write
+
+	// Touched only in hooks and guards, which the machine runs one at
+	// a time: no lock needed
+	name     string
+	inflight int
+	last     time.Time   // of the last request or done
+	timer    *time.Timer // the current state's timeout
+}
+
+func (c *conn) write(format string, args ...any) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	c.nc.SetWriteDeadline(time.Now().Add(time.Second)) // a client that won't read can't stall us
+	fmt.Fprintf(c.nc, format+"\n", args...)
+}
+
+// after posts e once d has passed. Posted, not fired, since a refused
+// timeout is normal: the connection moved on before it went off
+func (c *conn) after(d time.Duration, e event) {
+	c.timer = time.AfterFunc(d, func() { c.m.Post(e) })
+}
+
+func newServer(ln net.Listener, handshake, idle, grace time.Duration, trace bool) *server {
+	s := &server{ln: ln, handshake: handshake, idle: idle, grace: grace, start: time.Now(),
+		conns: make(map[*conn]struct{})}
+	d := fsm.NewDef[state, event, *conn]()
+
+	d.Allow(connecting, hello, established, nil)
+	d.Allow(connecting, handshakeTimeout, closed, nil)
+
+	d.Allow(established, request, established, nil)
+	d.Allow(established, done, established, nil)
+	// The idle timer isn't stopped by every request, so it may go off
+	// late, or just as one arrives: the guard decides whether it counts
+	d.Allow(established, idleTimeout, closed, func(c *conn) bool {
+		return c.inflight == 0 && time.Since(c.last) >= s.idle
+	})
+	d.Allow(established, shutdown, draining, func(c *conn) bool { return c.inflight > 0 })
+	d.Allow(established, shutdown, closed, nil)
+
+	// Guards run before the hooks that count, so this done is still in
+	// the count: 1 means it is the last
+	d.Allow(draining, done, closed, func(c *conn) bool { return c.inflight == 1 })
+	d.Allow(draining, done, draining, nil)
+	d.Allow(draining, graceTimeout, closed, nil)
+
+	for _, from := range []state{connecting, established, draining} {
+		d.Allow(from, hangup, closed, nil)
+	}
+
+	// Counting happens in a hook, inside the transition, so a guard
+	// never sees a request that was let in but not yet counted
+	d.OnTransition(func(c *conn, t fsm.Transition[state, event]) {
+		switch t.Event {
+		case request:
+			c.inflight++
+			c.last = time.Now()
+		case done:
+			c.inflight--
+			c.last = time.Now()
+			if t.To == established && c.inflight == 0 {
+				c.timer.Reset(s.idle) // idle from now
+			}
+		}
+	})
+	d.OnExit(connecting, func(c *conn, _ fsm.Transition[state, event]) { c.timer.Stop() })
+	d.OnEnter(established, func(c *conn, t fsm.Transition[state, event]) {
+		c.last = time.Now()
+		c.write("WELCOME %s", c.name)
+		c.after(s.idle, idleTimeout)
+	})
+	d.OnExit(established, func(c *conn, _ fsm.Transition[state, event]) { c.timer.Stop() })
+	d.OnEnter(draining, func(c *conn, _ fsm.Transition[state, event]) {
+		c.write("DRAINING %d in flight", c.inflight)
+		c.after(s.grace, graceTimeout)
+	})
+	d.OnExit(draining, func(c *conn, _ fsm.Transition[state, event]) { c.timer.Stop() })
+	d.OnEnter(closed, func(c *conn, t fsm.Transition[state, event]) {
+		c.write("BYE %s", t.Event)
+		c.cancel()
+		c.nc.Close()
+		s.mu.Lock()
+		delete(s.conns, c)
+		s.mu.Unlock()
+		s.open.Done()
+	})
+
+	if trace {
+		d.OnTransition(func(c *conn, t fsm.Transition[state, event]) {
+			if t.From == t.To && t.To == established {
+				return // requests and dones: the client's side shows them
+			}
+			fmt.Printf("%s  server  #%d %-8s %s -%s-> %s\n", s.since(), c.id, c.name, t.From, t.Event, t.To)
+		})
+	}
+	s.def = d
+	return s
+}
+
+func (s *server) since() string {
+	return fmt.Sprintf("%6.3fs", time.Since(s.start).Seconds())
+}
+
+func (s *server) serve() {
+	for {
+		nc, err := s.ln.Accept()
+		if err != nil {
+			return // closed by shutdown
+		}
+		c := &conn{id: s.ids.Add(1), srv: s, nc: nc}
+		c.ctx, c.cancel = context.WithCancel(context.Background())
+		c.m = s.def.New(connecting, c)
+		s.mu.Lock()
+		if s.closing {
+			s.mu.Unlock()
+			nc.Close() // accepted as shutdown began
+			return
+		}
+		s.conns[c] = struct{}{}
+		s.open.Add(1)
+		s.mu.Unlock()
+		c.after(s.handshake, handshakeTimeout) // New runs no enter hooks
+		go c.read()
+	}
+}
+
+// shutdown stops accepting, tells every connection, and waits for them
+// all to close. The grace timeout bounds the wait
+func (s *server) shutdown() {
+	s.mu.Lock()
+	s.closing = true
+	conns := make([]*conn, 0, len(s.conns))
+	for c := range s.conns {
+		conns = append(conns, c)
+	}
+	s.mu.Unlock()
+	s.ln.Close()
+	for _, c := range conns {
+		c.m.Fire(shutdown) // refused by any that closed since
+	}
+	s.open.Wait()
+}
+
+func (c *conn) read() {
+	sc := bufio.NewScanner(c.nc)
+	for sc.Scan() {
+		cmd, arg, _ := strings.Cut(sc.Text(), " ")
+		switch cmd {
+		case "HELLO":
+			// Only read by hooks for the transitions hello starts, which
+			// run on this goroutine, inside this Fire
+			c.name = arg
+			if err := c.m.Fire(hello); err != nil {
+				c.write("ERR %s", c.m.State())
+			}
+		case "WORK":
+			ms, err := strconv.Atoi(arg)
+			if err != nil || ms < 0 {
+				c.write("ERR bad WORK %q", arg)
+				continue
+			}
+			if err := c.m.Fire(request); err != nil {
+				c.write("ERR %s", c.m.State())
+				continue
+			}
+			go c.work(time.Duration(ms) * time.Millisecond)
+		default:
+			c.write("ERR unknown %q", cmd)
+		}
+	}
+	c.m.Fire(hangup) // refused if the server closed it
+}
+
+func (c *conn) work(d time.Duration) {
+	select {
+	case <-time.After(d):
+		c.write("OK %d", d.Milliseconds())
+	case <-c.ctx.Done():
+	}
+	if err := c.m.Fire(done); err != nil {
+		fmt.Printf("%s  server  #%d %-8s %v\n", c.srv.since(), c.id, c.name, err)
+	}
+}
+
+// ============================================================
+// Scripted clients
+// ============================================================
+
+type step struct {
+	at   time.Duration
+	send string // "" hangs up
+}
+
+type client struct {
+	name  string
+	steps []step
+}
+
+var clients = []client{
+	{"slowpoke", nil},
+	{"quiet", []step{{0, "HELLO quiet"}, {50 * time.Millisecond, "WORK 50"}}},
+	{"busy", []step{{0, "HELLO busy"}, {100 * time.Millisecond, "WORK 700"},
+		{200 * time.Millisecond, "WORK 800"}, {700 * time.Millisecond, "WORK 10"}}},
+	{"stuck", []step{{0, "HELLO stuck"}, {100 * time.Millisecond, "WORK 5000"}}},
+	{"leaver", []step{{0, "HELLO leaver"}, {100 * time.Millisecond, "WORK 300"}, {200 * time.Millisecond, ""}}},
+}
+
+func (cl client) run(addr string, since func() string) {
+	nc, err := net.Dial("tcp", addr)
+	if err != nil {
+		fmt.Println(cl.name, err)
+		return
+	}
+	defer nc.Close()
+	heard := make(chan struct{})
+	go func() {
+		defer close(heard)
+		sc := bufio.NewScanner(nc)
+		for sc.Scan() {
+			fmt.Printf("%s  %-8s <- %s\n", since(), cl.name, sc.Text())
+		}
+	}()
+	start := time.Now()
+	for _, st := range cl.steps {
+		time.Sleep(time.Until(start.Add(st.at)))
+		if st.send == "" {
+			fmt.Printf("%s  %-8s hangs up\n", since(), cl.name)
+			return
+		}
+		if strings.HasPrefix(st.send, "WORK") {
+			fmt.Printf("%s  %-8s -> %s\n", since(), cl.name, st.send)
+		}
+		fmt.Fprintln(nc, st.send)
+	}
+	<-heard // until the server closes the connection
+}
+
+// ============================================================
+// Main
+// ============================================================
+
+func main() {
+	listen := flag.String("listen", "", "serve on this address until interrupted, instead of the script")
+	flag.Parse()
+
+	addr := *listen
+	if addr == "" {
+		addr = "127.0.0.1:0"
+	}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	var s *server
+	if *listen != "" {
+		s = newServer(ln, 10*time.Second, 30*time.Second, 5*time.Second, true)
+	} else {
+		s = newServer(ln, 300*time.Millisecond, 400*time.Millisecond, time.Second, true)
+	}
+	go s.serve()
+
+	if *listen != "" {
+		fmt.Printf("listening on %s: HELLO name, then WORK ms. Ctrl+C drains\n", ln.Addr())
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+		defer stop()
+		<-ctx.Done()
+		fmt.Println("\nshutting down")
+		s.shutdown()
+		return
+	}
+
+	fmt.Println("=== handshake 300ms, idle 400ms, grace 1s; shutdown at 600ms ===")
+	var wg sync.WaitGroup
+	for _, cl := range clients {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			cl.run(ln.Addr().String(), s.since)
+		}()
+		time.Sleep(5 * time.Millisecond) // accepted in order, so #1 is slowpoke
+	}
+	time.Sleep(time.Until(s.start.Add(600 * time.Millisecond)))
+	fmt.Printf("%s  server  shutdown\n", s.since())
+	s.shutdown()
+	fmt.Printf("%s  server  every connection closed\n", s.since())
+	wg.Wait()
+}
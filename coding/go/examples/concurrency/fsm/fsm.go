@@ -0,0 +1,228 @@
+// Package fsm is a finite state machine whose events can arrive from
+// any goroutine.
+//
+// A network connection is the usual example. Its reader sees the
+// handshake and the requests, request goroutines report when they
+// finish, timers fire for idle and grace periods, and the server
+// decides to shut down. All of these are events on one machine:
+//
+//	Connecting --hello--> Established --shutdown--> Draining --done--> Closed
+//
+// Left to themselves these goroutines race. An idle timeout fires as a
+// request arrives, or a close runs twice. A Machine serializes them.
+// One event at a time is run to completion: guard, exit hooks, the
+// state change, then enter hooks. The next event starts after that, so
+// a hook never sees a half-made transition.
+//
+// The rules live in a Def, built once and shared by every Machine made
+// from it. Each Machine carries a value of type C (typically the
+// connection) that guards and hooks receive. A Def can describe a
+// million connections while costing each one only its state.
+//
+// Hooks and guards run one at a time per machine, but on whichever
+// goroutine delivered the event. They must not call Fire on their own
+// machine: Fire waits for the turn the hook is holding. A hook that
+// wants a follow-up event Posts it instead. The event runs once the
+// current one is complete, before Fire returns.
+package fsm
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var (
+	// ErrNoTransition means the event has no transition from the
+	// current state
+	ErrNoTransition = errors.New("fsm: no transition")
+	// ErrGuarded means it has transitions, but every guard refused
+	ErrGuarded = errors.New("fsm: guards refused transition")
+)
+
+// Transition is what hooks are told about the change being made
+type Transition[S, E comparable] struct {
+	From, To S
+	Event    E
+}
+
+// Hook is called during a transition with the machine's value
+type Hook[S, E comparable, C any] func(c C, t Transition[S, E])
+
+type key[S, E comparable] struct {
+	from  S
+	event E
+}
+
+type rule[S comparable, C any] struct {
+	to    S
+	guard func(C) bool
+}
+
+// Def is a machine's rules: its transitions and hooks. Build it before
+// making machines from it; it is not safe to change once they run
+type Def[S, E comparable, C any] struct {
+	rules  map[key[S, E]][]rule[S, C]
+	enter  map[S][]Hook[S, E, C]
+	exit   map[S][]Hook[S, E, C]
+	always []Hook[S, E, C]
+}
+
+func NewDef[S, E comparable, C any]() *Def[S, E, C] {
+	return &Def[S, E, C]{
+		rules: make(map[key[S, E]][]rule[S, C]),
+		enter: make(map[S][]Hook[S, E, C]),
+		exit:  make(map[S][]Hook[S, E, C]),
+	}
+}
+
+// Allow adds a transition from one state to another on an event. If
+// guard isn't nil, the transition is only taken when it returns true.
+// Several transitions may share a state and event, so that a guard
+// can choose between them. The first one added whose guard passes is
+// taken, which makes a last, unguarded one the default
+func (d *Def[S, E, C]) Allow(from S, event E, to S, guard func(C) bool) {
+	k := key[S, E]{from, event}
+	d.rules[k] = append(d.rules[k], rule[S, C]{to, guard})
+}
+
+// OnEnter adds a hook run on entering s, after the state has changed.
+// A transition from a state to itself is internal: it runs no enter or
+// exit hooks, so an event that only updates counters stays cheap
+func (d *Def[S, E, C]) OnEnter(s S, fn Hook[S, E, C]) {
+	d.enter[s] = append(d.enter[s], fn)
+}
+
+// OnExit adds a hook run on leaving s, before the state has changed
+func (d *Def[S, E, C]) OnExit(s S, fn Hook[S, E, C]) {
+	d.exit[s] = append(d.exit[s], fn)
+}
+
+// OnTransition adds a hook run after every transition, internal ones
+// included: for tracing and metrics
+func (d *Def[S, E, C]) OnTransition(fn Hook[S, E, C]) {
+	d.always = append(d.always, fn)
+}
+
+// New makes a machine in state initial, carrying c. Initial's enter
+// hooks are not run: nothing transitioned into it
+func (d *Def[S, E, C]) New(initial S, c C) *Machine[S, E, C] {
+	return &Machine[S, E, C]{def: d, c: c, state: initial, turn: make(chan struct{}, 1)}
+}
+
+// Machine is safe for concurrent use
+type Machine[S, E comparable, C any] struct {
+	def *Def[S, E, C]
+	c   C
+	// turn is held by whichever goroutine is running transitions. A
+	// channel rather than a mutex so that Post can try to take it
+	// without waiting
+	turn chan struct{}
+
+	mu     sync.Mutex
+	state  S   // written only with turn held
+	posted []E // waiting for the turn, from posted[next] on
+	next   int
+}
+
+// State is the current state. When another goroutine may deliver an
+// event at any moment, it can be stale as soon as it is returned.
+// Checking it to decide what to do is a race; use a guard instead
+func (m *Machine[S, E, C]) State() S {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.state
+}
+
+// Fire delivers an event and waits for it to be handled. It returns
+// ErrNoTransition or ErrGuarded, wrapped, if the event was refused,
+// leaving the state as it was. Events that hooks Posted along the way
+// are handled before it returns
+func (m *Machine[S, E, C]) Fire(event E) error {
+	m.turn <- struct{}{}
+	err := m.apply(event)
+	m.drain()
+	return err
+}
+
+// Post delivers an event without waiting for it. If no other goroutine
+// is running transitions, Post handles the event, and anything it
+// leads to, before returning. Otherwise it queues the event for the
+// goroutine that is. Events are handled in the order posted.
+//
+// A refused event is dropped. That suits the events Post is for: a
+// timer firing or a follow-up from a hook, where a refusal means the
+// machine has already moved on, say, a timeout that lost to a close
+func (m *Machine[S, E, C]) Post(event E) {
+	m.mu.Lock()
+	m.posted = append(m.posted, event)
+	m.mu.Unlock()
+	select {
+	case m.turn <- struct{}{}:
+		m.drain()
+	default:
+		// Whoever holds the turn will find it: see drain
+	}
+}
+
+// drain handles posted events until there are none, then gives up the
+// turn; turn held
+func (m *Machine[S, E, C]) drain() {
+	for {
+		m.mu.Lock()
+		if m.next == len(m.posted) {
+			// Released with mu held. A Post that appends after this
+			// finds the turn free; one that appended before is seen
+			// here. Either way no event is left behind
+			<-m.turn
+			m.mu.Unlock()
+			return
+		}
+		event := m.posted[m.next]
+		m.next++
+		if m.next == len(m.posted) {
+			m.posted, m.next = m.posted[:0], 0 // reuse the array
+		}
+		m.mu.Unlock()
+		m.apply(event)
+	}
+}
+
+// apply runs one event to completion; turn held
+func (m *Machine[S, E, C]) apply(event E) error {
+	from := m.state // only written with turn held, which we have
+	rules, ok := m.def.rules[key[S, E]{from, event}]
+	if !ok {
+		return fmt.Errorf("%w: %v in state %v", ErrNoTransition, event, from)
+	}
+	var to S
+	found := false
+	for _, r := range rules {
+		if r.guard == nil || r.guard(m.c) {
+			to, found = r.to, true
+			break
+		}
+	}
+	if !found {
+		return fmt.Errorf("%w: %v in state %v", ErrGuarded, event, from)
+	}
+
+	t := Transition[S, E]{From: from, To: to, Event: event}
+	if to != from {
+		for _, fn := range m.def.exit[from] {
+			fn(m.c, t)
+		}
+	}
+	m.mu.Lock()
+	m.state = to
+	m.mu.Unlock()
+	if to != from {
+		for _, fn := range m.def.enter[to] {
+			fn(m.c, t)
+		}
+	}
+	for _, fn := range m.def.always {
+		fn(m.c, t)
+	}
+	return nil
+}
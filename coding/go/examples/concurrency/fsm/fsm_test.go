@@ -0,0 +1,261 @@
+package fsm
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+)
+
+// A turnstile: a coin unlocks it, a push lets one person through
+type turnstile struct {
+	coins, passes int
+	log           []string
+}
+
+func newTurnstile() *Def[string, string, *turnstile] {
+	d := NewDef[string, string, *turnstile]()
+	d.Allow("locked", "coin", "unlocked", nil)
+	d.Allow("unlocked", "coin", "unlocked", nil) // a wasted coin: internal
+	d.Allow("unlocked", "push", "locked", nil)
+	d.OnEnter("unlocked", func(c *turnstile, t Transition[string, string]) { c.coins++ })
+	d.OnExit("unlocked", func(c *turnstile, t Transition[string, string]) { c.passes++ })
+	d.OnTransition(func(c *turnstile, t Transition[string, string]) {
+		c.log = append(c.log, t.From+" -"+t.Event+"-> "+t.To)
+	})
+	return d
+}
+
+func TestTransitions(t *testing.T) {
+	c := &turnstile{}
+	m := newTurnstile().New("locked", c)
+	steps := []struct {
+		event string
+		want  string
+		err   error
+	}{
+		{"push", "locked", ErrNoTransition},
+		{"coin", "unlocked", nil},
+		{"coin", "unlocked", nil},
+		{"push", "locked", nil},
+		{"kick", "locked", ErrNoTransition},
+	}
+	for i, s := range steps {
+		err := m.Fire(s.event)
+		if !errors.Is(err, s.err) || (err == nil) != (s.err == nil) {
+			t.Errorf("step %d: Fire(%s) = %v, want %v", i, s.event, err, s.err)
+		}
+		if got := m.State(); got != s.want {
+			t.Errorf("step %d: state %s after %s, want %s", i, got, s.event, s.want)
+		}
+	}
+	// The second coin was internal: no enter hook, but traced
+	if c.coins != 1 || c.passes != 1 {
+		t.Errorf("coins %d, passes %d, want 1 and 1", c.coins, c.passes)
+	}
+	want := []string{"locked -coin-> unlocked", "unlocked -coin-> unlocked", "unlocked -push-> locked"}
+	if !slices.Equal(c.log, want) {
+		t.Errorf("log %q, want %q", c.log, want)
+	}
+}
+
+func TestGuardsChooseInOrder(t *testing.T) {
+	// The first transition whose guard passes wins; an unguarded last
+	// one is the default
+	type conn struct{ inflight int }
+	d := NewDef[string, string, *conn]()
+	d.Allow("open", "close", "draining", func(c *conn) bool { return c.inflight > 0 })
+	d.Allow("open", "close", "closed", nil)
+	d.Allow("draining", "done", "closed", func(c *conn) bool { return c.inflight == 0 })
+
+	for _, tt := range []struct {
+		inflight int
+		want     string
+	}{{0, "closed"}, {3, "draining"}} {
+		c := &conn{inflight: tt.inflight}
+		m := d.New("open", c)
+		m.Fire("close")
+		if got := m.State(); got != tt.want {
+			t.Errorf("close with %d in flight: %s, want %s", tt.inflight, got, tt.want)
+		}
+	}
+
+	c := &conn{inflight: 1}
+	m := d.New("draining", c)
+	if err := m.Fire("done"); !errors.Is(err, ErrGuarded) {
+		t.Errorf("done with 1 in flight: %v, want ErrGuarded", err)
+	}
+	c.inflight = 0
+	if err := m.Fire("done"); err != nil || m.State() != "closed" {
+		t.Errorf("done with none in flight: %v, state %s", err, m.State())
+	}
+}
+
+func TestHookOrder(t *testing.T) {
+	var calls []string
+	record := func(name string) Hook[int, string, struct{}] {
+		return func(_ struct{}, t Transition[int, string]) {
+			calls = append(calls, fmt.Sprintf("%s %d->%d", name, t.From, t.To))
+		}
+	}
+	d := NewDef[int, string, struct{}]()
+	d.Allow(1, "next", 2, nil)
+	d.OnExit(1, record("exit"))
+	d.OnEnter(2, record("enter"))
+	d.OnEnter(2, record("enter again"))
+	d.OnTransition(record("after"))
+	var m *Machine[int, string, struct{}]
+	d.OnExit(1, func(struct{}, Transition[int, string]) {
+		calls = append(calls, fmt.Sprintf("state during exit %d", m.State()))
+	})
+	d.OnEnter(2, func(struct{}, Transition[int, string]) {
+		calls = append(calls, fmt.Sprintf("state during enter %d", m.State()))
+	})
+	m = d.New(1, struct{}{})
+	m.Fire("next")
+	want := []string{
+		"exit 1->2", "state during exit 1",
+		"enter 1->2", "enter again 1->2", "state during enter 2",
+		"after 1->2",
+	}
+	if !slices.Equal(calls, want) {
+		t.Errorf("calls\n%q\nwant\n%q", calls, want)
+	}
+}
+
+func TestPostFromHook(t *testing.T) {
+	// Entering draining with nothing in flight posts drained. It runs
+	// after the transition into draining is complete, and before Fire
+	// returns
+	type conn struct {
+		m     *Machine[string, string, *conn]
+		trace []string
+	}
+	d := NewDef[string, string, *conn]()
+	d.Allow("open", "shutdown", "draining", nil)
+	d.Allow("draining", "drained", "closed", nil)
+	d.OnEnter("draining", func(c *conn, t Transition[string, string]) {
+		c.m.Post("drained")
+		c.trace = append(c.trace, "entered draining")
+	})
+	d.OnTransition(func(c *conn, t Transition[string, string]) {
+		c.trace = append(c.trace, t.From+"->"+t.To)
+	})
+	c := &conn{}
+	c.m = d.New("open", c)
+	if err := c.m.Fire("shutdown"); err != nil {
+		t.Fatal(err)
+	}
+	if s := c.m.State(); s != "closed" {
+		t.Errorf("state %s after Fire, want closed", s)
+	}
+	want := []string{"entered draining", "open->draining", "draining->closed"}
+	if !slices.Equal(c.trace, want) {
+		t.Errorf("trace %q, want %q", c.trace, want)
+	}
+}
+
+// counter is a machine that flips between even and odd, with hooks that
+// touch unguarded state: run under -race, concurrent use shows up if
+// transitions ever overlap
+type counter struct {
+	n       int
+	entered int
+}
+
+func newCounter() *Def[string, string, *counter] {
+	d := NewDef[string, string, *counter]()
+	d.Allow("even", "inc", "odd", nil)
+	d.Allow("odd", "inc", "even", nil)
+	d.Allow("even", "noop", "even", nil)
+	d.Allow("odd", "noop", "odd", nil)
+	d.OnEnter("odd", func(c *counter, t Transition[string, string]) { c.entered++ })
+	d.OnTransition(func(c *counter, t Transition[string, string]) {
+		if t.Event == "inc" {
+			c.n++
+		}
+	})
+	return d
+}
+
+func TestConcurrentFire(t *testing.T) {
+	const goroutines, each = 8, 1000
+	c := &counter{}
+	m := newCounter().New("even", c)
+	var wg sync.WaitGroup
+	for range goroutines {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range each {
+				if err := m.Fire("inc"); err != nil {
+					t.Error(err)
+				}
+				m.State() // readable while others fire
+			}
+		}()
+	}
+	wg.Wait()
+	if c.n != goroutines*each || c.entered != goroutines*each/2 || m.State() != "even" {
+		t.Errorf("n %d, entered odd %d, state %s; want %d, %d, even",
+			c.n, c.entered, m.State(), goroutines*each, goroutines*each/2)
+	}
+}
+
+func TestConcurrentPost(t *testing.T) {
+	// Posts from many goroutines, some while another holds the turn.
+	// None may be lost: once every Post has returned, a Fire after them
+	// finds them all handled
+	const goroutines, each = 8, 1000
+	c := &counter{}
+	m := newCounter().New("even", c)
+	var wg sync.WaitGroup
+	for g := range goroutines {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range each {
+				if (g+i)%5 == 0 {
+					m.Fire("inc")
+				} else {
+					m.Post("inc")
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	m.Fire("noop")
+	if c.n != goroutines*each {
+		t.Errorf("handled %d incs, want %d", c.n, goroutines*each)
+	}
+}
+
+// ============================================================
+// Benchmarks
+// ============================================================
+
+func BenchmarkFire(b *testing.B) {
+	m := newCounter().New("even", &counter{})
+	for range b.N {
+		m.Fire("inc")
+	}
+}
+
+func BenchmarkPost(b *testing.B) {
+	m := newCounter().New("even", &counter{})
+	for range b.N {
+		m.Post("inc")
+	}
+}
+
+// BenchmarkContended is every goroutine firing at one machine, as when a
+// connection's reader, its requests and its timers all deliver at once
+func BenchmarkContended(b *testing.B) {
+	m := newCounter().New("even", &counter{})
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			m.Fire("inc")
+		}
+	})
+}
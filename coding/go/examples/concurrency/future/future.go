@@ -0,0 +1,234 @@
+// Package future is a small async primitive: start work now, collect
+// its result later.
+//
+// Go already has the pieces (a goroutine plus a channel) and most of
+// the time they are all you need. A Future earns its keep when results
+// get composed: run A and B at once and wait for both (All), take
+// whichever replica answers first (Any), or feed A's result into the
+// next step (Then), while errors, panics and cancellation travel along
+// without hand-written plumbing each time.
+//
+//	user := future.Go(ctx, func(ctx context.Context) (User, error) { return fetchUser(ctx, id) })
+//	orders := future.Go(ctx, func(ctx context.Context) ([]Order, error) { return fetchOrders(ctx, id) })
+//	u, err := user.Await(ctx)
+//
+// A Future completes exactly once. Its result can be read any number of
+// times, from any number of goroutines.
+package future
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+)
+
+// Future is the eventual result of one piece of work
+type Future[T any] struct {
+	done   chan struct{} // closed once val and err are set
+	val    T
+	err    error
+	cancel context.CancelCauseFunc
+}
+
+// ErrCanceled is the cause passed to the work's context by Cancel
+var ErrCanceled = errors.New("future: canceled")
+
+// PanicError is what a Future fails with when its function panics. The
+// panic is recovered so it can't take the process down from a goroutine
+// nobody is watching
+type PanicError struct {
+	Value any
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("future: panic: %v", e.Value)
+}
+
+// Go runs fn in a new goroutine and returns its Future. fn's context is
+// derived from ctx and is also canceled by the Future's Cancel
+func Go[T any](ctx context.Context, fn func(context.Context) (T, error)) *Future[T] {
+	ctx, cancel := context.WithCancelCause(ctx)
+	f := &Future[T]{done: make(chan struct{}), cancel: cancel}
+	go func() {
+		defer cancel(nil) // release the context's resources
+		var (
+			v   T
+			err error
+		)
+		func() {
+			defer func() {
+				if r := recover(); r != nil {
+					err = &PanicError{Value: r, Stack: debug.Stack()}
+				}
+			}()
+			v, err = fn(ctx)
+		}()
+		f.complete(v, err)
+	}()
+	return f
+}
+
+// Resolved is a Future that has already succeeded with v
+func Resolved[T any](v T) *Future[T] {
+	f := &Future[T]{done: make(chan struct{}), cancel: func(error) {}}
+	f.complete(v, nil)
+	return f
+}
+
+// Failed is a Future that has already failed with err
+func Failed[T any](err error) *Future[T] {
+	f := &Future[T]{done: make(chan struct{}), cancel: func(error) {}}
+	var zero T
+	f.complete(zero, err)
+	return f
+}
+
+func (f *Future[T]) complete(v T, err error) {
+	f.val, f.err = v, err
+	close(f.done)
+}
+
+// Done is closed when the Future has completed, for use in a select
+func (f *Future[T]) Done() <-chan struct{} { return f.done }
+
+// Await waits for the result or for ctx to end, whichever is first. If
+// ctx ends first, Await returns ctx's error and the work carries on:
+// waiting less is not the same as canceling. Use Cancel for that
+func (f *Future[T]) Await(ctx context.Context) (T, error) {
+	select {
+	case <-f.done:
+		return f.val, f.err
+	case <-ctx.Done():
+		var zero T
+		return zero, ctx.Err()
+	}
+}
+
+// Get is Await without a way to stop waiting
+func (f *Future[T]) Get() (T, error) {
+	<-f.done
+	return f.val, f.err
+}
+
+// Peek returns the result if the Future has completed; ok is false if
+// it hasn't yet
+func (f *Future[T]) Peek() (v T, err error, ok bool) {
+	select {
+	case <-f.done:
+		return f.val, f.err, true
+	default:
+		return v, nil, false
+	}
+}
+
+// Cancel cancels the work's context with ErrCanceled. Whether and when
+// the Future completes after that is up to the work; a function that
+// honors its context returns soon with an error
+func (f *Future[T]) Cancel() {
+	f.cancel(ErrCanceled)
+}
+
+// Then runs fn on f's value once f succeeds. If f fails, fn is not
+// called and the returned Future fails with the same error. Canceling
+// the returned Future cancels fn, and f too if it is still running
+func Then[T, U any](ctx context.Context, f *Future[T], fn func(context.Context, T) (U, error)) *Future[U] {
+	next := Go(ctx, func(ctx context.Context) (U, error) {
+		v, err := f.Await(ctx)
+		if err != nil {
+			var zero U
+			if ctx.Err() != nil {
+				return zero, context.Cause(ctx)
+			}
+			return zero, err
+		}
+		return fn(ctx, v)
+	})
+	cancelNext := next.cancel
+	next.cancel = func(cause error) {
+		cancelNext(cause)
+		f.cancel(cause)
+	}
+	return next
+}
+
+// All waits for every Future and returns their values in order. The
+// first failure fails All at once with that error and cancels the
+// Futures still running, since their results can no longer be used.
+// All of nothing succeeds with an empty slice
+func All[T any](ctx context.Context, fs ...*Future[T]) *Future[[]T] {
+	return Go(ctx, func(ctx context.Context) ([]T, error) {
+		finished := watch(ctx, fs)
+		for range fs {
+			select {
+			case i := <-finished:
+				if err := fs[i].err; err != nil {
+					cancelAll(fs)
+					return nil, err
+				}
+			case <-ctx.Done():
+				cancelAll(fs)
+				return nil, context.Cause(ctx)
+			}
+		}
+		vals := make([]T, len(fs))
+		for i, f := range fs {
+			vals[i] = f.val
+		}
+		return vals, nil
+	})
+}
+
+// Any returns the value of the first Future to succeed and cancels the
+// rest. If every one fails, Any fails with all their errors joined, in
+// order. Any of nothing fails at once
+func Any[T any](ctx context.Context, fs ...*Future[T]) *Future[T] {
+	if len(fs) == 0 {
+		return Failed[T](errors.New("future: Any of no futures"))
+	}
+	return Go(ctx, func(ctx context.Context) (T, error) {
+		finished := watch(ctx, fs)
+		var zero T
+		for range fs {
+			select {
+			case i := <-finished:
+				if fs[i].err == nil {
+					cancelAll(fs)
+					return fs[i].val, nil
+				}
+			case <-ctx.Done():
+				cancelAll(fs)
+				return zero, context.Cause(ctx)
+			}
+		}
+		errs := make([]error, len(fs))
+		for i, f := range fs {
+			errs[i] = f.err
+		}
+		return zero, errors.Join(errs...)
+	})
+}
+
+// watch sends the index of each Future as it completes. The channel is
+// buffered for all of them, so the watchers never block and none is
+// left behind when the reader stops early; they also quit with ctx
+func watch[T any](ctx context.Context, fs []*Future[T]) <-chan int {
+	finished := make(chan int, len(fs))
+	for i, f := range fs {
+		go func() {
+			select {
+			case <-f.done:
+				finished <- i
+			case <-ctx.Done():
+			}
+		}()
+	}
+	return finished
+}
+
+func cancelAll[T any](fs []*Future[T]) {
+	for _, f := range fs {
+		f.Cancel()
+	}
+}
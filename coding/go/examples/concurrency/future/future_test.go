@@ -0,0 +1,270 @@
+package future
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"strconv"
+	"testing"
+	"time"
+)
+
+var errBoom = errors.New("boom")
+
+// after returns a Future that yields v (or err) after d, or fails with
+// its context's cause if canceled first
+func after[T any](d time.Duration, v T, err error) *Future[T] {
+	return Go(context.Background(), func(ctx context.Context) (T, error) {
+		select {
+		case <-time.After(d):
+			return v, err
+		case <-ctx.Done():
+			var zero T
+			return zero, context.Cause(ctx)
+		}
+	})
+}
+
+// waitGoroutines polls until the goroutine count drops back to want
+func waitGoroutines(t *testing.T, want int) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > want {
+		if time.Now().After(deadline) {
+			t.Fatalf("%d goroutines, want at most %d", runtime.NumGoroutine(), want)
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestAwait(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		name    string
+		f       *Future[int]
+		want    int
+		wantErr error
+	}{
+		{"value", after(time.Millisecond, 42, nil), 42, nil},
+		{"error", after(time.Millisecond, 0, errBoom), 0, errBoom},
+		{"resolved", Resolved(7), 7, nil},
+		{"failed", Failed[int](errBoom), 0, errBoom},
+	}
+	for _, tt := range tests {
+		got, err := tt.f.Await(ctx)
+		if got != tt.want || !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: Await = %d, %v; want %d, %v", tt.name, got, err, tt.want, tt.wantErr)
+		}
+		// A completed Future gives the same answer every time
+		if got2, err2 := tt.f.Get(); got2 != got || err2 != err {
+			t.Errorf("%s: second read = %d, %v; first was %d, %v", tt.name, got2, err2, got, err)
+		}
+	}
+}
+
+func TestAwaitTimeoutDoesNotCancel(t *testing.T) {
+	f := after(30*time.Millisecond, "done", nil)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	if _, err := f.Await(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Await with a short deadline = %v, want DeadlineExceeded", err)
+	}
+	if _, _, ok := f.Peek(); ok {
+		t.Fatal("Peek says done before the work finished")
+	}
+	if v, err := f.Get(); v != "done" || err != nil {
+		t.Errorf("work was affected by the caller giving up: %q, %v", v, err)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	f := after(time.Hour, 1, nil)
+	f.Cancel()
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if _, err := f.Await(ctx); !errors.Is(err, ErrCanceled) {
+		t.Errorf("Await after Cancel = %v, want ErrCanceled", err)
+	}
+
+	// Canceling the parent context reaches the work too
+	parent, stop := context.WithCancel(context.Background())
+	g := Go(parent, func(ctx context.Context) (int, error) {
+		<-ctx.Done()
+		return 0, ctx.Err()
+	})
+	stop()
+	if _, err := g.Get(); !errors.Is(err, context.Canceled) {
+		t.Errorf("work after parent cancel = %v, want context.Canceled", err)
+	}
+}
+
+func TestPanicBecomesError(t *testing.T) {
+	f := Go(context.Background(), func(context.Context) (int, error) {
+		var m map[string]int
+		m["x"] = 1 // nil map write
+		return 0, nil
+	})
+	_, err := f.Get()
+	var pe *PanicError
+	if !errors.As(err, &pe) || len(pe.Stack) == 0 {
+		t.Fatalf("Get = %v, want a *PanicError with a stack", err)
+	}
+}
+
+func TestThen(t *testing.T) {
+	ctx := context.Background()
+	called := false
+	itoa := func(_ context.Context, n int) (string, error) {
+		called = true
+		return strconv.Itoa(n), nil
+	}
+
+	s, err := Then(ctx, after(time.Millisecond, 12, nil), itoa).Get()
+	if s != "12" || err != nil {
+		t.Errorf("Then on success = %q, %v; want \"12\", nil", s, err)
+	}
+
+	called = false
+	_, err = Then(ctx, Failed[int](errBoom), itoa).Get()
+	if !errors.Is(err, errBoom) || called {
+		t.Errorf("Then on failure = %v (fn called: %v); want errBoom, not called", err, called)
+	}
+
+	// A chain: parse, double, format
+	parse := Go(ctx, func(context.Context) (int, error) { return strconv.Atoi("21") })
+	double := Then(ctx, parse, func(_ context.Context, n int) (int, error) { return n * 2, nil })
+	if s, _ := Then(ctx, double, itoa).Get(); s != "42" {
+		t.Errorf("chain = %q, want \"42\"", s)
+	}
+
+	// Canceling the end of a chain cancels the step still running
+	slow := after(time.Hour, 1, nil)
+	next := Then(ctx, slow, itoa)
+	next.Cancel()
+	if _, err := slow.Get(); !errors.Is(err, ErrCanceled) {
+		t.Errorf("upstream after canceling Then = %v, want ErrCanceled", err)
+	}
+	if _, err := next.Get(); !errors.Is(err, ErrCanceled) {
+		t.Errorf("Then after Cancel = %v, want ErrCanceled", err)
+	}
+}
+
+func TestAll(t *testing.T) {
+	ctx := context.Background()
+	// Results come back in argument order, not completion order
+	vals, err := All(ctx,
+		after(30*time.Millisecond, 1, nil),
+		after(10*time.Millisecond, 2, nil),
+		after(20*time.Millisecond, 3, nil),
+	).Get()
+	if err != nil || len(vals) != 3 || vals[0] != 1 || vals[1] != 2 || vals[2] != 3 {
+		t.Errorf("All = %v, %v; want [1 2 3]", vals, err)
+	}
+
+	if vals, err := All[int](ctx).Get(); err != nil || len(vals) != 0 {
+		t.Errorf("All() = %v, %v; want [], nil", vals, err)
+	}
+
+	// The first failure wins at once and cancels the slow one
+	slow := after(time.Hour, 1, nil)
+	start := time.Now()
+	_, err = All(ctx, slow, after(5*time.Millisecond, 0, errBoom)).Get()
+	if !errors.Is(err, errBoom) {
+		t.Errorf("All with a failure = %v, want errBoom", err)
+	}
+	if d := time.Since(start); d > 500*time.Millisecond {
+		t.Errorf("All took %v to fail, want about 5ms", d)
+	}
+	if _, err := slow.Get(); !errors.Is(err, ErrCanceled) {
+		t.Errorf("sibling after All failed = %v, want ErrCanceled", err)
+	}
+}
+
+func TestAny(t *testing.T) {
+	ctx := context.Background()
+	// Hedged request: the fastest replica wins, the others are canceled
+	slow := after(time.Hour, "slow", nil)
+	v, err := Any(ctx,
+		slow,
+		after(5*time.Millisecond, "", errBoom), // fails first: ignored
+		after(10*time.Millisecond, "fast", nil),
+	).Get()
+	if v != "fast" || err != nil {
+		t.Errorf("Any = %q, %v; want \"fast\", nil", v, err)
+	}
+	if _, err := slow.Get(); !errors.Is(err, ErrCanceled) {
+		t.Errorf("loser after Any = %v, want ErrCanceled", err)
+	}
+
+	errOther := errors.New("other")
+	_, err = Any(ctx, Failed[string](errBoom), after(time.Millisecond, "", errOther)).Get()
+	if !errors.Is(err, errBoom) || !errors.Is(err, errOther) {
+		t.Errorf("Any with all failing = %v, want both errors joined", err)
+	}
+
+	if _, err := Any[string](ctx).Get(); err == nil {
+		t.Error("Any() succeeded, want an error")
+	}
+}
+
+func TestCancelAllCancelsInputs(t *testing.T) {
+	a, b := after(time.Hour, 1, nil), after(time.Hour, 2, nil)
+	all := All(context.Background(), a, b)
+	all.Cancel()
+	if _, err := all.Get(); !errors.Is(err, ErrCanceled) {
+		t.Errorf("All after Cancel = %v, want ErrCanceled", err)
+	}
+	for i, f := range []*Future[int]{a, b} {
+		if _, err := f.Get(); !errors.Is(err, ErrCanceled) {
+			t.Errorf("input %d = %v, want ErrCanceled", i, err)
+		}
+	}
+}
+
+func TestNoLeaks(t *testing.T) {
+	before := runtime.NumGoroutine()
+	ctx := context.Background()
+	for range 50 {
+		All(ctx, after(time.Hour, 1, nil), Failed[int](errBoom)).Get()
+		Any(ctx, after(time.Hour, 1, nil), Resolved(2)).Get()
+		f := Then(ctx, after(time.Hour, 1, nil), func(context.Context, int) (int, error) { return 0, nil })
+		f.Cancel()
+		f.Get()
+	}
+	waitGoroutines(t, before)
+}
+
+// ============================================================
+// Benchmarks
+// ============================================================
+
+// What a Future costs over a bare goroutine and channel
+func BenchmarkGo(b *testing.B) {
+	ctx := context.Background()
+	b.Run("goroutine+chan", func(b *testing.B) {
+		b.ReportAllocs()
+		for range b.N {
+			ch := make(chan int, 1)
+			go func() { ch <- 1 }()
+			<-ch
+		}
+	})
+	b.Run("Future", func(b *testing.B) {
+		b.ReportAllocs()
+		for range b.N {
+			Go(ctx, func(context.Context) (int, error) { return 1, nil }).Get()
+		}
+	})
+}
+
+func BenchmarkAll(b *testing.B) {
+	ctx := context.Background()
+	fs := make([]*Future[int], 10)
+	b.ReportAllocs()
+	for range b.N {
+		for i := range fs {
+			fs[i] = Go(ctx, func(context.Context) (int, error) { return i, nil })
+		}
+		All(ctx, fs...).Get()
+	}
+}
@@ -0,0 +1,347 @@
+// Goroutine Leaks - Finding them, not just fixing them
+//
+// A goroutine blocked forever is never collected: its stack, and
+// everything the stack points to, stays for the life of the process.
+// One per request is a slow memory leak that no heap profile explains.
+// This example has three patterns that leak, a way to catch them, and
+// the fixed versions:
+// - Abandoned send: ask three replicas, take the first answer. The
+//   other two send on an unbuffered channel nobody reads again
+// - Ignored cancellation: a producer that doesn't watch ctx keeps
+//   blocking on a send after its consumer has stopped reading
+// - Never-closed channel: a worker that ranges over jobs waits for
+//   ever once the sender forgets to close
+//
+// The workflow is the same every time:
+//  1. Notice: runtime.NumGoroutine() climbs with traffic and never comes
+//     back down. Export it as a metric; it is the cheapest leak alarm
+//  2. Locate: dump every goroutine's stack and group the dump. A
+//     thousand goroutines parked on one line is the leak, and the
+//     "created by" frame says who started them. In a server this dump
+//     is /debug/pprof/goroutine?debug=1 from net/http/pprof
+//  3. Pin it in a test: snapshot goroutines before, check after. This
+//     file does it by hand with runtime.Stack; go.uber.org/goleak does
+//     the same with goleak.VerifyNone(t) and knows which runtime
+//     goroutines to ignore
+//  4. Fix, then watch the test and the metric go flat
+//
+// Usage:
+//   go run goroutine_leak.go
+//   go test -v goroutine_leak.go goroutine_leak_test.go
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ============================================================
+// Pattern 1: abandoned send
+// ============================================================
+
+// query stands in for a network call with uneven latency
+func query(replica string, delay time.Duration) string {
+	time.Sleep(delay)
+	return "answer from " + replica
+}
+
+var replicaDelays = map[string]time.Duration{
+	"a": 1 * time.Millisecond,
+	"b": 2 * time.Millisecond,
+	"c": 3 * time.Millisecond,
+}
+
+// firstLeaky returns the fastest replica's answer. The slower replicas
+// block on the send for ever: nobody receives again
+func firstLeaky() string {
+	ch := make(chan string)
+	for r, d := range replicaDelays {
+		go func() { ch <- query(r, d) }()
+	}
+	return <-ch
+}
+
+// firstFixed gives every replica a place to put its answer, so each
+// send completes and each goroutine exits, read or not
+func firstFixed() string {
+	ch := make(chan string, len(replicaDelays))
+	for r, d := range replicaDelays {
+		go func() { ch <- query(r, d) }()
+	}
+	return <-ch
+}
+
+// ============================================================
+// Pattern 2: ignored cancellation
+// ============================================================
+
+// idsLeaky produces IDs until... nothing: the ctx is accepted and never
+// looked at, so when the consumer stops reading, the send blocks
+func idsLeaky(ctx context.Context) <-chan int {
+	out := make(chan int)
+	go func() {
+		for i := 0; ; i++ {
+			out <- i
+		}
+	}()
+	return out
+}
+
+// idsFixed waits on the send and ctx together; cancel and it returns
+func idsFixed(ctx context.Context) <-chan int {
+	out := make(chan int)
+	go func() {
+		defer close(out)
+		for i := 0; ; i++ {
+			select {
+			case out <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// takeIDs reads n IDs and stops: the consumer side of pattern 2
+func takeIDs(gen func(context.Context) <-chan int, n int) []int {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel() // the producer's only signal that we're done
+	var ids []int
+	for id := range gen(ctx) {
+		ids = append(ids, id)
+		if len(ids) == n {
+			break
+		}
+	}
+	return ids
+}
+
+// ============================================================
+// Pattern 3: never-closed channel
+// ============================================================
+
+var errBadJob = errors.New("bad job")
+
+// sumLeaky hands jobs to a worker and stops at the first bad one. The
+// early return skips close(jobs), and the worker waits in its range for
+// ever
+func sumLeaky(nums []int) (int, error) {
+	jobs := make(chan int)
+	total := make(chan int)
+	go func() {
+		sum := 0
+		for n := range jobs {
+			sum += n
+		}
+		total <- sum
+	}()
+	for _, n := range nums {
+		if n < 0 {
+			return 0, errBadJob
+		}
+		jobs <- n
+	}
+	close(jobs)
+	return <-total, nil
+}
+
+// sumFixed closes jobs on every path, with a defer scoped to the
+// sending loop, and gives the worker's result a buffer so the error
+// path, which never reads it, doesn't strand the worker on its last
+// send instead
+func sumFixed(nums []int) (int, error) {
+	jobs := make(chan int)
+	total := make(chan int, 1)
+	go func() {
+		sum := 0
+		for n := range jobs {
+			sum += n
+		}
+		total <- sum
+	}()
+	err := func() error {
+		defer close(jobs)
+		for _, n := range nums {
+			if n < 0 {
+				return errBadJob
+			}
+			jobs <- n
+		}
+		return nil
+	}()
+	if err != nil {
+		return 0, err
+	}
+	return <-total, nil
+}
+
+// ============================================================
+// Detection
+// ============================================================
+
+// goroutine is one entry from a full stack dump
+type goroutine struct {
+	id    int
+	state string // "chan send", "select", "sleep", ...
+	stack string
+}
+
+// top is the first frame: where the goroutine is parked
+func (g goroutine) top() string {
+	fn, loc, _ := strings.Cut(g.stack, "\n")
+	return strings.TrimSpace(fn) + " " + trimFrame(loc)
+}
+
+// creator is the "created by" frame: who started it
+func (g goroutine) creator() string {
+	_, after, ok := strings.Cut(g.stack, "created by ")
+	if !ok {
+		return "?"
+	}
+	fn, loc, _ := strings.Cut(after, "\n")
+	fn, _, _ = strings.Cut(fn, " in goroutine")
+	return fn + " " + trimFrame(loc)
+}
+
+// trimFrame turns "\t/long/path/file.go:42 +0x1d" into "file.go:42"
+func trimFrame(loc string) string {
+	loc = strings.TrimSpace(loc)
+	loc, _, _ = strings.Cut(loc, " ")
+	if i := strings.LastIndex(loc, "/"); i >= 0 {
+		loc = loc[i+1:]
+	}
+	return loc
+}
+
+// goroutines parses runtime.Stack for every goroutine, skipping the
+// caller's own. It stops the world while it copies, so it is a
+// diagnostic, not something to run per request
+func goroutines() []goroutine {
+	buf := make([]byte, 1<<16)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+	blocks := strings.Split(string(buf), "\n\n")
+	var gs []goroutine
+	for _, b := range blocks[1:] { // the first is the caller
+		// "goroutine 18 [chan send]:\nmain.firstLeaky.func1()\n..."
+		header, stack, _ := strings.Cut(b, "\n")
+		rest, ok := strings.CutPrefix(header, "goroutine ")
+		if !ok {
+			continue
+		}
+		idText, state, _ := strings.Cut(rest, " [")
+		id, _ := strconv.Atoi(idText)
+		state, _, _ = strings.Cut(state, "]")
+		state, _, _ = strings.Cut(state, ",") // drop ", 2 minutes"
+		gs = append(gs, goroutine{id: id, state: state, stack: stack})
+	}
+	return gs
+}
+
+// snapshot records which goroutines exist now
+func snapshot() map[int]bool {
+	ids := map[int]bool{}
+	for _, g := range goroutines() {
+		ids[g.id] = true
+	}
+	return ids
+}
+
+// leakedSince returns goroutines started since before that are still
+// running after grace. Goroutines that are merely slow to finish get
+// the grace period to do so; a leak is one that outlives it
+func leakedSince(before map[int]bool, grace time.Duration) []goroutine {
+	deadline := time.Now().Add(grace)
+	for {
+		var extra []goroutine
+		for _, g := range goroutines() {
+			if !before[g.id] {
+				extra = append(extra, g)
+			}
+		}
+		if len(extra) == 0 || time.Now().After(deadline) {
+			return extra
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// group is step 2 of the workflow: identical stacks collapsed into one
+// line with a count, biggest first
+func group(gs []goroutine) []string {
+	counts := map[string]int{}
+	for _, g := range gs {
+		counts[fmt.Sprintf("[%s] %s, created by %s", g.state, g.top(), g.creator())]++
+	}
+	lines := make([]string, 0, len(counts))
+	for k, n := range counts {
+		lines = append(lines, fmt.Sprintf("%4d x %s", n, k))
+	}
+	slices.Sort(lines)
+	slices.Reverse(lines)
+	return lines
+}
+
+// ============================================================
+// Demo
+// ============================================================
+
+type pattern struct {
+	name         string
+	leaky, fixed func()
+}
+
+var patterns = []pattern{
+	{"abandoned send",
+		func() { firstLeaky() },
+		func() { firstFixed() }},
+	{"ignored cancellation",
+		func() { takeIDs(idsLeaky, 3) },
+		func() { takeIDs(idsFixed, 3) }},
+	{"never-closed channel",
+		func() { sumLeaky([]int{1, 2, -3, 4}) },
+		func() { sumFixed([]int{1, 2, -3, 4}) }},
+}
+
+// calls runs fn n times and reports the goroutines left over
+func calls(fn func(), n int) []goroutine {
+	before := snapshot()
+	for range n {
+		fn()
+	}
+	return leakedSince(before, 50*time.Millisecond)
+}
+
+func main() {
+	const n = 100
+	for _, p := range patterns {
+		fmt.Printf("=== %s ===\n", p.name)
+
+		start := runtime.NumGoroutine()
+		leaked := calls(p.leaky, n)
+		fmt.Printf("  1. notice: %d calls, NumGoroutine %d -> %d\n", n, start, runtime.NumGoroutine())
+		fmt.Println("  2. locate: grouped stacks of what was left behind")
+		for _, line := range group(leaked) {
+			fmt.Println("     " + line)
+		}
+
+		start = runtime.NumGoroutine()
+		leaked = calls(p.fixed, n)
+		fmt.Printf("  4. fixed:  %d calls, NumGoroutine %d -> %d, %d left behind\n\n",
+			n, start, runtime.NumGoroutine(), len(leaked))
+	}
+	fmt.Println("Step 3, the test that keeps each fix fixed, is in goroutine_leak_test.go.")
+}
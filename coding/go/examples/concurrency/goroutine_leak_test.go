@@ -0,0 +1,107 @@
+// Goroutine Leak Tests - Step 3 of the workflow: a leak pinned in a test
+//
+// checkLeaks snapshots the goroutines when a test starts and, when it
+// ends, fails the test if any new ones outlive a grace period, printing
+// their grouped stacks. It is a hand-rolled goleak.VerifyNone: the same
+// idea, without the dependency or its list of runtime goroutines to
+// ignore (diffing IDs against the snapshot makes that list unneeded
+// here).
+//
+// The fixed patterns run under checkLeaks. The leaky ones are run
+// against the detector directly, to show that it would have caught
+// them; a real suite has only the first kind.
+//
+// Usage:
+//   go test -v goroutine_leak.go goroutine_leak_test.go
+package main
+
+import (
+	"context"
+	"errors"
+	"slices"
+	"testing"
+	"time"
+)
+
+// checkLeaks fails t if goroutines started during the test are still
+// running when it ends. Call it first, so its cleanup runs last
+func checkLeaks(t *testing.T) {
+	t.Helper()
+	before := snapshot()
+	t.Cleanup(func() {
+		if leaked := leakedSince(before, 100*time.Millisecond); len(leaked) > 0 {
+			t.Errorf("%d goroutines leaked:", len(leaked))
+			for _, line := range group(leaked) {
+				t.Error(line)
+			}
+		}
+	})
+}
+
+func TestFirstFixed(t *testing.T) {
+	checkLeaks(t)
+	if got := firstFixed(); got != "answer from a" {
+		t.Errorf("got %q, want the fastest replica", got)
+	}
+}
+
+func TestIDsFixed(t *testing.T) {
+	checkLeaks(t)
+	if got := takeIDs(idsFixed, 5); !slices.Equal(got, []int{0, 1, 2, 3, 4}) {
+		t.Errorf("got %v", got)
+	}
+}
+
+func TestSumFixed(t *testing.T) {
+	checkLeaks(t)
+	if got, err := sumFixed([]int{1, 2, 3}); got != 6 || err != nil {
+		t.Errorf("sum = %d, %v; want 6", got, err)
+	}
+	if _, err := sumFixed([]int{1, -2, 3}); !errors.Is(err, errBadJob) {
+		t.Errorf("err = %v, want errBadJob", err)
+	}
+}
+
+func TestDetectorCatchesLeaks(t *testing.T) {
+	tests := []struct {
+		name  string
+		leaky func()
+		want  int    // goroutines left behind by one call
+		state string // where they are parked
+	}{
+		{"abandoned send", func() { firstLeaky() }, 2, "chan send"},
+		{"ignored cancellation", func() { takeIDs(idsLeaky, 3) }, 1, "chan send"},
+		{"never-closed channel", func() { sumLeaky([]int{-1}) }, 1, "chan receive"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			leaked := calls(tt.leaky, 1)
+			if len(leaked) != tt.want {
+				t.Fatalf("%d leaked, want %d: %v", len(leaked), tt.want, group(leaked))
+			}
+			for _, g := range leaked {
+				if g.state != tt.state {
+					t.Errorf("parked in [%s], want [%s]", g.state, tt.state)
+				}
+			}
+		})
+	}
+}
+
+func TestGraceForSlowGoroutines(t *testing.T) {
+	// Finishing late is not leaking: a goroutine that exits within the
+	// grace period is not reported
+	before := snapshot()
+	go time.Sleep(20 * time.Millisecond)
+	if leaked := leakedSince(before, time.Second); len(leaked) != 0 {
+		t.Errorf("reported %v", group(leaked))
+	}
+
+	// but one still running after it is
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { <-ctx.Done() }()
+	if leaked := leakedSince(before, 20*time.Millisecond); len(leaked) != 1 {
+		t.Errorf("%d reported, want 1", len(leaked))
+	}
+}
@@ -0,0 +1,238 @@
+// Package lru is a size-bounded, least-recently-used cache with expiry.
+//
+// Cache is the textbook design: a map from key to list node for O(1)
+// lookup, and a doubly linked list in order of use for O(1) eviction.
+// Every Get moves its entry to the front; when the cache is full, Set
+// drops the entry at the back. Entries can also carry a TTL, after
+// which they count as missing.
+//
+// A Get changes the list, so even reads need the exclusive lock and an
+// RWMutex would buy nothing. Under many goroutines that one lock is the
+// bottleneck; Sharded splits the cache into independent Caches by key
+// hash, trading exact global LRU order for parallelism.
+package lru
+
+import (
+	"sync"
+	"time"
+)
+
+// entry is a list node. The list is circular around a sentinel root,
+// so insert and remove never have to check for nil neighbours
+type entry[K comparable, V any] struct {
+	prev, next *entry[K, V]
+	key        K
+	value      V
+	expires    time.Time // zero: never
+}
+
+// Stats counts what happened to lookups and entries
+type Stats struct {
+	Hits        uint64
+	Misses      uint64 // includes expired entries found by Get
+	Evictions   uint64 // dropped to make room
+	Expirations uint64 // dropped because their TTL ran out
+}
+
+// HitRatio is Hits over all lookups, 0 before any
+func (s Stats) HitRatio() float64 {
+	if total := s.Hits + s.Misses; total > 0 {
+		return float64(s.Hits) / float64(total)
+	}
+	return 0
+}
+
+func (s *Stats) add(o Stats) {
+	s.Hits += o.Hits
+	s.Misses += o.Misses
+	s.Evictions += o.Evictions
+	s.Expirations += o.Expirations
+}
+
+// Cache holds at most capacity entries. It is safe for concurrent use
+type Cache[K comparable, V any] struct {
+	capacity int
+	ttl      time.Duration
+	now      func() time.Time
+
+	mu    sync.Mutex
+	items map[K]*entry[K, V]
+	root  entry[K, V] // root.next is the most recently used
+	stats Stats
+}
+
+// New returns a Cache of at most capacity entries. Entries added with
+// Set expire ttl after they were set; ttl 0 means they don't.
+func New[K comparable, V any](capacity int, ttl time.Duration) *Cache[K, V] {
+	return newCache[K, V](capacity, ttl, time.Now)
+}
+
+func newCache[K comparable, V any](capacity int, ttl time.Duration, now func() time.Time) *Cache[K, V] {
+	if capacity <= 0 {
+		panic("lru: capacity must be positive")
+	}
+	c := &Cache[K, V]{
+		capacity: capacity,
+		ttl:      ttl,
+		now:      now,
+		items:    make(map[K]*entry[K, V], capacity),
+	}
+	c.root.next, c.root.prev = &c.root, &c.root
+	return c
+}
+
+// ---- list operations; c.mu held ----
+
+func (c *Cache[K, V]) pushFront(e *entry[K, V]) {
+	e.prev, e.next = &c.root, c.root.next
+	e.prev.next, e.next.prev = e, e
+}
+
+func (c *Cache[K, V]) unlink(e *entry[K, V]) {
+	e.prev.next, e.next.prev = e.next, e.prev
+	e.prev, e.next = nil, nil // don't keep neighbours reachable
+}
+
+func (c *Cache[K, V]) moveToFront(e *entry[K, V]) {
+	if c.root.next == e {
+		return
+	}
+	c.unlink(e)
+	c.pushFront(e)
+}
+
+func (c *Cache[K, V]) remove(e *entry[K, V]) {
+	c.unlink(e)
+	delete(c.items, e.key)
+}
+
+func (e *entry[K, V]) expired(now time.Time) bool {
+	return !e.expires.IsZero() && !now.Before(e.expires)
+}
+
+// ---- API ----
+
+// Get returns the value for key and marks it most recently used
+func (c *Cache[K, V]) Get(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.items[key]
+	if !ok {
+		c.stats.Misses++
+		var zero V
+		return zero, false
+	}
+	if e.expired(c.now()) {
+		c.remove(e)
+		c.stats.Misses++
+		c.stats.Expirations++
+		var zero V
+		return zero, false
+	}
+	c.moveToFront(e)
+	c.stats.Hits++
+	return e.value, true
+}
+
+// Peek is Get without touching recency or stats
+func (c *Cache[K, V]) Peek(key K) (V, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.items[key]; ok && !e.expired(c.now()) {
+		return e.value, true
+	}
+	var zero V
+	return zero, false
+}
+
+// Set stores value under key with the cache's default TTL
+func (c *Cache[K, V]) Set(key K, value V) {
+	c.SetWithTTL(key, value, c.ttl)
+}
+
+// SetWithTTL stores value under key, expiring after ttl (0: never),
+// and marks it most recently used. If the cache is full the least
+// recently used entry makes room; an expired one is preferred if the
+// back of the list has one
+func (c *Cache[K, V]) SetWithTTL(key K, value V, ttl time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	var expires time.Time
+	if ttl > 0 {
+		expires = now.Add(ttl)
+	}
+	if e, ok := c.items[key]; ok {
+		e.value, e.expires = value, expires
+		c.moveToFront(e)
+		return
+	}
+	if len(c.items) >= c.capacity {
+		victim := c.root.prev
+		if victim.expired(now) {
+			c.stats.Expirations++
+		} else {
+			c.stats.Evictions++
+		}
+		c.remove(victim)
+	}
+	e := &entry[K, V]{key: key, value: value, expires: expires}
+	c.items[key] = e
+	c.pushFront(e)
+}
+
+// Delete removes key and reports whether it was there
+func (c *Cache[K, V]) Delete(key K) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.items[key]
+	if ok {
+		c.remove(e)
+	}
+	return ok
+}
+
+// Len is the number of entries, counting expired ones not yet removed
+func (c *Cache[K, V]) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.items)
+}
+
+// RemoveExpired drops every expired entry and returns how many. TTLs
+// differ per entry, so expired ones can be anywhere in the list and
+// this walks all of it; call it from a ticker, not on every request
+func (c *Cache[K, V]) RemoveExpired() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	now := c.now()
+	n := 0
+	for e := c.root.next; e != &c.root; {
+		next := e.next
+		if e.expired(now) {
+			c.remove(e)
+			n++
+		}
+		e = next
+	}
+	c.stats.Expirations += uint64(n)
+	return n
+}
+
+// Keys returns the keys from most to least recently used
+func (c *Cache[K, V]) Keys() []K {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	keys := make([]K, 0, len(c.items))
+	for e := c.root.next; e != &c.root; e = e.next {
+		keys = append(keys, e.key)
+	}
+	return keys
+}
+
+// Stats returns a snapshot of the counters
+func (c *Cache[K, V]) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.stats
+}
@@ -0,0 +1,251 @@
+package lru
+
+import (
+	"fmt"
+	"math/rand"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// ttlClock is how much time a TTL test has let pass. The cache only
+// compares instants with each other, so any epoch will do, and the
+// tests read and move it as a duration, the unit TTLs are given in
+type ttlClock struct{ elapsed time.Duration }
+
+func (c *ttlClock) now() time.Time { return time.Unix(0, 0).Add(c.elapsed) }
+
+func TestEvictsLeastRecentlyUsed(t *testing.T) {
+	c := New[string, int](3, 0)
+	c.Set("a", 1)
+	c.Set("b", 2)
+	c.Set("c", 3)
+	c.Get("a")    // a is now the most recent; b the least
+	c.Set("d", 4) // evicts b
+
+	if _, ok := c.Get("b"); ok {
+		t.Error("b should have been evicted")
+	}
+	if got, want := c.Keys(), []string{"d", "a", "c"}; !slices.Equal(got, want) {
+		t.Errorf("Keys() = %v, want %v", got, want)
+	}
+	c.Set("c", 30) // update, not insert: nothing evicted
+	if v, _ := c.Peek("c"); v != 30 || c.Len() != 3 {
+		t.Errorf("after update: c = %d, Len = %d; want 30, 3", v, c.Len())
+	}
+	if st := c.Stats(); st.Evictions != 1 {
+		t.Errorf("Evictions = %d, want 1", st.Evictions)
+	}
+}
+
+func TestPeekDoesNotPromote(t *testing.T) {
+	c := New[int, int](2, 0)
+	c.Set(1, 1)
+	c.Set(2, 2)
+	c.Peek(1)
+	c.Set(3, 3) // 1 is still the least recent
+	if _, ok := c.Peek(1); ok {
+		t.Error("Peek promoted the entry")
+	}
+	if st := c.Stats(); st.Hits+st.Misses != 0 {
+		t.Errorf("Peek counted in stats: %+v", st)
+	}
+}
+
+func TestTTL(t *testing.T) {
+	clk := &ttlClock{}
+	c := newCache[string, string](10, time.Minute, clk.now)
+	c.Set("default", "x")                      // 1 minute
+	c.SetWithTTL("short", "x", 10*time.Second) // per-entry
+	c.SetWithTTL("forever", "x", 0)
+
+	steps := []struct {
+		advance time.Duration
+		key     string
+		want    bool
+	}{
+		{9 * time.Second, "short", true},
+		{time.Second, "short", false}, // expired at exactly 10s
+		{49 * time.Second, "default", true},
+		{time.Second, "default", false},
+		{time.Hour, "forever", true},
+	}
+	for _, s := range steps {
+		clk.elapsed += s.advance
+		if _, ok := c.Get(s.key); ok != s.want {
+			t.Errorf("at %v: Get(%q) ok = %v, want %v", clk.elapsed, s.key, ok, s.want)
+		}
+	}
+	if st := c.Stats(); st.Expirations != 2 || st.Misses != 2 {
+		t.Errorf("stats = %+v, want 2 expirations and 2 misses", st)
+	}
+}
+
+func TestRemoveExpired(t *testing.T) {
+	clk := &ttlClock{}
+	c := newCache[int, int](100, 0, clk.now)
+	for i := range 10 {
+		c.SetWithTTL(i, i, time.Duration(i+1)*time.Second)
+	}
+	clk.elapsed += 5 * time.Second
+	if n := c.RemoveExpired(); n != 5 {
+		t.Errorf("RemoveExpired = %d, want 5", n)
+	}
+	if c.Len() != 5 {
+		t.Errorf("Len = %d, want 5", c.Len())
+	}
+}
+
+func TestFullCachePrefersExpiredVictim(t *testing.T) {
+	clk := &ttlClock{}
+	c := newCache[string, int](2, 0, clk.now)
+	c.SetWithTTL("old", 1, time.Second)
+	c.Set("keep", 2)
+	clk.elapsed += 2 * time.Second
+	c.Set("new", 3)
+	if st := c.Stats(); st.Expirations != 1 || st.Evictions != 0 {
+		t.Errorf("stats = %+v, want the expired entry counted as an expiration", st)
+	}
+}
+
+func TestSharded(t *testing.T) {
+	s := NewSharded[int, string](1000, 5, 0) // rounded up to 8 shards
+	if len(s.shards) != 8 {
+		t.Fatalf("%d shards, want 8", len(s.shards))
+	}
+	for i := range 500 {
+		s.Set(i, fmt.Sprint(i))
+	}
+	for i := range 500 {
+		if v, ok := s.Get(i); !ok || v != fmt.Sprint(i) {
+			t.Fatalf("Get(%d) = %q, %v", i, v, ok)
+		}
+	}
+	if !s.Delete(7) || s.Delete(7) {
+		t.Error("Delete should succeed once")
+	}
+	if st := s.Stats(); st.Hits != 500 || s.Len() != 499 {
+		t.Errorf("Hits = %d, Len = %d; want 500, 499", st.Hits, s.Len())
+	}
+}
+
+func TestConcurrent(t *testing.T) {
+	// Run with -race. The invariant: the map and the list agree
+	c := New[int, int](64, time.Millisecond)
+	var wg sync.WaitGroup
+	for g := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(int64(g)))
+			for range 5000 {
+				k := rng.Intn(200)
+				switch rng.Intn(10) {
+				case 0:
+					c.Delete(k)
+				case 1, 2, 3:
+					c.Set(k, k)
+				case 4:
+					c.RemoveExpired()
+				default:
+					if v, ok := c.Get(k); ok && v != k {
+						t.Errorf("Get(%d) = %d", k, v)
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	if n, keys := c.Len(), len(c.Keys()); n != keys || n > 64 {
+		t.Errorf("Len %d, list length %d, capacity 64", n, keys)
+	}
+}
+
+// ============================================================
+// Benchmarks
+// ============================================================
+
+// zipfKeys draws keys the way real traffic does: a few hot, a long
+// tail of cold
+func zipfKeys(n int, keyspace uint64) []int {
+	z := rand.NewZipf(rand.New(rand.NewSource(1)), 1.1, 1, keyspace-1)
+	keys := make([]int, n)
+	for i := range keys {
+		keys[i] = int(z.Uint64())
+	}
+	return keys
+}
+
+// cache is what the benchmarks need from Cache and Sharded
+type cache interface {
+	Get(int) (int, bool)
+	Set(int, int)
+	Stats() Stats
+}
+
+// BenchmarkGetOrSet is a read-through cache: Get, and Set on a miss.
+// hit% shows what sharding costs in hit ratio, ns/op what it buys
+func BenchmarkGetOrSet(b *testing.B) {
+	keys := zipfKeys(1<<16, 100_000)
+	impls := []struct {
+		name string
+		make func() cache
+	}{
+		{"mutex", func() cache { return New[int, int](10_000, 0) }},
+		{"sharded-16", func() cache { return NewSharded[int, int](10_000, 16, 0) }},
+		{"sharded-64", func() cache { return NewSharded[int, int](10_000, 64, 0) }},
+	}
+	for _, impl := range impls {
+		b.Run(impl.name, func(b *testing.B) {
+			c := impl.make()
+			b.RunParallel(func(pb *testing.PB) {
+				i := rand.Intn(len(keys))
+				for pb.Next() {
+					k := keys[i%len(keys)]
+					if _, ok := c.Get(k); !ok {
+						c.Set(k, k)
+					}
+					i++
+				}
+			})
+			b.ReportMetric(100*c.Stats().HitRatio(), "hit%")
+		})
+	}
+}
+
+// BenchmarkGetHit measures the lock alone: every key is present
+func BenchmarkGetHit(b *testing.B) {
+	for _, shards := range []int{1, 16} {
+		b.Run(fmt.Sprint("shards-", shards), func(b *testing.B) {
+			c := NewSharded[int, int](1024, shards, 0)
+			for i := range 1024 {
+				c.Set(i, i)
+			}
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					c.Get(i & 1023)
+					i++
+				}
+			})
+		})
+	}
+}
+
+// BenchmarkSyncMap is the baseline with no eviction at all. It is fast
+// on reads, but it only grows: not a cache
+func BenchmarkSyncMap(b *testing.B) {
+	keys := zipfKeys(1<<16, 100_000)
+	var m sync.Map
+	b.RunParallel(func(pb *testing.PB) {
+		i := rand.Intn(len(keys))
+		for pb.Next() {
+			k := keys[i%len(keys)]
+			if _, ok := m.Load(k); !ok {
+				m.Store(k, k)
+			}
+			i++
+		}
+	})
+}
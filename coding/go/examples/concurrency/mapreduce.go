@@ -0,0 +1,430 @@
+// Map-Reduce - Word frequencies over a directory tree
+//
+// The classic map-reduce job on one machine: count every word in every
+// text file under a directory and print the most common ones.
+//
+//   [WalkDir] --paths--> [map: count words in one file] x N --> [reduce] --> [top K]
+//
+// - filepath.WalkDir feeds paths into a channel as it finds them, so
+//   workers start before the walk is done. Binary files, .git and
+//   vendor directories are skipped
+// - A fixed number of map workers bounds open files and memory
+// - The reduce step is where the designs differ, and all four are run
+//   on the same input and checked to agree:
+//   - reducer:  workers send per-file maps to one goroutine that merges
+//   - mutex:    workers merge each file's map into one locked map
+//   - sharded:  the global map is split into 32 shards, each with its
+//               own lock, picked by a hash of the word
+//   - local:    each worker keeps its own map; they are merged once at
+//               the end, pairwise in parallel
+// - Top K with a size-K min-heap: one pass, O(n log K)
+//
+// Usage:
+//   go run mapreduce.go                                  # this directory
+//   go run mapreduce.go -dir $(go env GOROOT)/src -k 20 -workers 8
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"container/heap"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"hash/maphash"
+	"io"
+	"io/fs"
+	"log"
+	"maps"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+type Counts map[string]int
+
+// ============================================================
+// Input: walking the tree
+// ============================================================
+
+var skipDirs = map[string]bool{".git": true, "vendor": true, "node_modules": true, "testdata": true}
+
+// walk sends the path of every regular file under root and closes the
+// channel when done. Unreadable directories are counted and skipped,
+// not fatal: one permission error shouldn't lose the whole job
+func walk(ctx context.Context, root string, skipped *atomic.Int64) (<-chan string, <-chan error) {
+	paths := make(chan string, 64)
+	errc := make(chan error, 1)
+	go func() {
+		defer close(paths)
+		errc <- filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				if path == root {
+					return err // the root itself is unreadable: nothing to do
+				}
+				skipped.Add(1)
+				return nil
+			}
+			if d.IsDir() {
+				if skipDirs[d.Name()] {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			select {
+			case paths <- path:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+	}()
+	return paths, errc
+}
+
+// ============================================================
+// Map: one file to word counts
+// ============================================================
+
+// isText sniffs the first 512 bytes: a NUL byte or invalid UTF-8 means
+// binary. The same rule git and most editors use
+func isText(head []byte) bool {
+	if bytes.IndexByte(head, 0) >= 0 {
+		return false
+	}
+	// The window may end in the middle of a multi-byte rune; drop up to
+	// three trailing bytes before judging
+	for i := 0; i < 3 && len(head) > 0 && !utf8.Valid(head); i++ {
+		head = head[:len(head)-1]
+	}
+	return utf8.Valid(head)
+}
+
+// scanWords is a bufio.SplitFunc for runs of letters, lower-cased by
+// the caller. "don't" is two words and "utf8" is "utf"; good enough
+// here. A rune split across reads is left for the next call
+func scanWords(data []byte, atEOF bool) (int, []byte, error) {
+	start := 0
+	for start < len(data) {
+		if !atEOF && !utf8.FullRune(data[start:]) {
+			return start, nil, nil
+		}
+		r, size := utf8.DecodeRune(data[start:])
+		if unicode.IsLetter(r) {
+			break
+		}
+		start += size
+	}
+	for i := start; i < len(data); {
+		if !atEOF && !utf8.FullRune(data[i:]) {
+			break
+		}
+		r, size := utf8.DecodeRune(data[i:])
+		if !unicode.IsLetter(r) {
+			return i + size, data[start:i], nil
+		}
+		i += size
+	}
+	if atEOF && len(data) > start {
+		return len(data), data[start:], nil
+	}
+	return start, nil, nil // need more data
+}
+
+var errBinary = errors.New("binary file")
+
+// countFile is the map step
+func countFile(path string) (Counts, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	br := bufio.NewReaderSize(f, 64<<10)
+	head, err := br.Peek(512)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if !isText(head) {
+		return nil, errBinary
+	}
+	counts := Counts{}
+	sc := bufio.NewScanner(br)
+	sc.Split(scanWords)
+	for sc.Scan() {
+		w := sc.Bytes()
+		if len(w) < 3 {
+			continue
+		}
+		counts[string(bytes.ToLower(w))]++
+	}
+	return counts, sc.Err()
+}
+
+// ============================================================
+// Reduce: four strategies
+// ============================================================
+
+type Stats struct {
+	Files, Binary, Failed int64
+	Words                 int64
+}
+
+type job struct {
+	ctx     context.Context
+	root    string
+	workers int
+	skipped atomic.Int64
+}
+
+// mapFiles runs the walk and the map workers, calling emit with each
+// file's counts from the worker goroutine that produced them
+func (j *job) mapFiles(emit func(worker int, c Counts)) (Stats, error) {
+	paths, walkErr := walk(j.ctx, j.root, &j.skipped)
+	var files, binary, failed atomic.Int64
+	var wg sync.WaitGroup
+	for w := range j.workers {
+		wg.Go(func() {
+			for p := range paths {
+				c, err := countFile(p)
+				switch {
+				case errors.Is(err, errBinary):
+					binary.Add(1)
+				case err != nil:
+					failed.Add(1)
+				default:
+					files.Add(1)
+					emit(w, c)
+				}
+			}
+		})
+	}
+	wg.Wait()
+	return Stats{Files: files.Load(), Binary: binary.Load(), Failed: failed.Load()}, <-walkErr
+}
+
+// reduceChannel: one goroutine owns the result; no locks at all. The
+// reducer can become the bottleneck when files are small and many
+func reduceChannel(j *job) (Counts, Stats, error) {
+	results := make(chan Counts, j.workers)
+	total := Counts{}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for c := range results {
+			for w, n := range c {
+				total[w] += n
+			}
+		}
+	}()
+	st, err := j.mapFiles(func(_ int, c Counts) { results <- c })
+	close(results)
+	<-done
+	return total, st, err
+}
+
+// reduceMutex: every worker merges under one lock. Simple, and fine
+// while merging is quick next to counting; the lock is held for a
+// whole file's worth of words
+func reduceMutex(j *job) (Counts, Stats, error) {
+	var mu sync.Mutex
+	total := Counts{}
+	st, err := j.mapFiles(func(_ int, c Counts) {
+		mu.Lock()
+		for w, n := range c {
+			total[w] += n
+		}
+		mu.Unlock()
+	})
+	return total, st, err
+}
+
+// shardedCounts spreads words over shards so that workers merging
+// different words rarely wait for each other
+type shardedCounts struct {
+	seed   maphash.Seed
+	shards [32]struct {
+		sync.Mutex
+		m Counts
+		_ [48]byte // pad to a 64-byte cache line so shards don't false-share
+	}
+}
+
+func newShardedCounts() *shardedCounts {
+	s := &shardedCounts{seed: maphash.MakeSeed()}
+	for i := range s.shards {
+		s.shards[i].m = Counts{}
+	}
+	return s
+}
+
+func (s *shardedCounts) merge(c Counts) {
+	// Group by shard first so each lock is taken once per file, not
+	// once per word
+	var byShard [32][]string
+	for w := range c {
+		i := maphash.String(s.seed, w) % 32
+		byShard[i] = append(byShard[i], w)
+	}
+	for i, words := range byShard {
+		if len(words) == 0 {
+			continue
+		}
+		sh := &s.shards[i]
+		sh.Lock()
+		for _, w := range words {
+			sh.m[w] += c[w]
+		}
+		sh.Unlock()
+	}
+}
+
+func reduceSharded(j *job) (Counts, Stats, error) {
+	s := newShardedCounts()
+	st, err := j.mapFiles(func(_ int, c Counts) { s.merge(c) })
+	total := Counts{}
+	for i := range s.shards {
+		maps.Copy(total, s.shards[i].m) // shards hold disjoint words
+	}
+	return total, st, err
+}
+
+// reduceLocal: each worker adds into its own map, touched by no one
+// else, so there is no sharing at all while mapping. The cost moves to
+// the end: merging N maps, done here pairwise in log2(N) rounds
+func reduceLocal(j *job) (Counts, Stats, error) {
+	local := make([]Counts, j.workers)
+	for i := range local {
+		local[i] = Counts{}
+	}
+	st, err := j.mapFiles(func(w int, c Counts) {
+		for word, n := range c {
+			local[w][word] += n
+		}
+	})
+	for len(local) > 1 {
+		var wg sync.WaitGroup
+		half := (len(local) + 1) / 2
+		for i := range len(local) / 2 {
+			dst, src := local[i], local[i+half]
+			wg.Go(func() {
+				for w, n := range src {
+					dst[w] += n
+				}
+			})
+		}
+		wg.Wait()
+		local = local[:half]
+	}
+	return local[0], st, err
+}
+
+// ============================================================
+// Top K
+// ============================================================
+
+type WordCount struct {
+	Word  string
+	Count int
+}
+
+// minHeap keeps the K largest seen so far, smallest on top, so a new
+// word only has to beat the top to get in
+type minHeap []WordCount
+
+// ranksBelow orders by count, then alphabetically, so ties come out
+// the same on every run despite map iteration order
+func ranksBelow(a, b WordCount) bool {
+	if a.Count != b.Count {
+		return a.Count < b.Count
+	}
+	return a.Word > b.Word
+}
+
+func (h minHeap) Len() int           { return len(h) }
+func (h minHeap) Less(i, j int) bool { return ranksBelow(h[i], h[j]) }
+func (h minHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *minHeap) Push(x any)        { *h = append(*h, x.(WordCount)) }
+func (h *minHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+func topK(c Counts, k int) []WordCount {
+	h := make(minHeap, 0, k+1)
+	for w, n := range c {
+		wc := WordCount{w, n}
+		if len(h) < k {
+			heap.Push(&h, wc)
+		} else if ranksBelow(h[0], wc) {
+			h[0] = wc
+			heap.Fix(&h, 0)
+		}
+	}
+	out := make([]WordCount, len(h))
+	for i := len(h) - 1; i >= 0; i-- {
+		out[i] = heap.Pop(&h).(WordCount)
+	}
+	return out
+}
+
+// ============================================================
+// Main
+// ============================================================
+
+func main() {
+	dir := flag.String("dir", ".", "directory to scan")
+	k := flag.Int("k", 15, "how many top words to print")
+	workers := flag.Int("workers", runtime.GOMAXPROCS(0), "map workers")
+	flag.Parse()
+
+	strategies := []struct {
+		name   string
+		reduce func(*job) (Counts, Stats, error)
+	}{
+		{"reducer", reduceChannel},
+		{"mutex", reduceMutex},
+		{"sharded", reduceSharded},
+		{"local", reduceLocal},
+	}
+
+	fmt.Printf("=== Word counts under %s, %d workers, GOMAXPROCS %d ===\n", *dir, *workers, runtime.GOMAXPROCS(0))
+	var first Counts
+	for _, s := range strategies {
+		j := &job{ctx: context.Background(), root: *dir, workers: *workers}
+		start := time.Now()
+		total, st, err := s.reduce(j)
+		if err != nil {
+			log.Fatalf("%s: %v", s.name, err)
+		}
+		for _, n := range total {
+			st.Words += int64(n)
+		}
+		fmt.Printf("  %-8s %v: %d files (%d binary, %d unreadable, %d dirs skipped), %d words, %d distinct\n",
+			s.name, time.Since(start).Round(time.Millisecond), st.Files, st.Binary, st.Failed,
+			j.skipped.Load(), st.Words, len(total))
+		if first == nil {
+			first = total
+		} else if !maps.Equal(first, total) {
+			log.Fatalf("%s: result differs from %s", s.name, strategies[0].name)
+		}
+	}
+	fmt.Println("  all four strategies agree")
+	fmt.Println("  (run it twice: the first pass also pays for reading files into the page cache)")
+
+	fmt.Printf("\n=== Top %d ===\n", *k)
+	for i, wc := range topK(first, *k) {
+		fmt.Printf("  %2d. %-20s %d\n", i+1, wc.Word, wc.Count)
+	}
+}
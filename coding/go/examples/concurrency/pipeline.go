@@ -11,20 +11,53 @@
 // - ETL (Extract, Transform, Load) operations
 // - Stream processing
 //
+// Every stage takes a context and selects on ctx.Done() whenever it
+// sends, so a consumer that stops early can cancel the context and
+// every upstream goroutine exits instead of blocking forever.
+//
+// Stages that can fail emit Result[T] values, so an error travels
+// downstream to the consumer, which decides to stop the pipeline.
+//
+// Hand-wiring gets repetitive, so the Pipeline builder at the end
+// declares the same topologies fluently:
+//
+//   NewPipeline(ctx, input).Then(strings.TrimSpace).FanOut(3, strings.ToUpper).Collect()
+//
 // Usage:
 //   go run pipeline.go
+//   go run pipeline.go backpressure 0,0,0     # per-stage buffer sizes
+//   go run pipeline.go backpressure 4,4,4
 package main
 
 import (
+	"context"
 	"fmt"
+	"os"
+	"runtime"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 )
 
 func main() {
+	if len(os.Args) >= 3 && os.Args[1] == "backpressure" {
+		buffers, err := parseBuffers(os.Args[2])
+		if err != nil {
+			fmt.Printf("Error: %v\n", err)
+			os.Exit(1)
+		}
+		backpressureDemo(buffers)
+		return
+	}
+
 	fmt.Println("=== Pipeline Example ===")
 	fmt.Println()
 
+	// Cancelling ctx tears down every stage that is still running
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
 	// Create input data
 	input := []string{
 		"  hello world  ",
@@ -39,16 +72,16 @@ func main() {
 	//
 
 	// Stage 1: Generate values from slice
-	source := generate(input)
+	source := generate(ctx, input)
 
 	// Stage 2: Trim whitespace
-	trimmed := trim(source)
+	trimmed := trim(ctx, source)
 
 	// Stage 3: Convert to lowercase
-	lowered := lowercase(trimmed)
+	lowered := lowercase(ctx, trimmed)
 
 	// Stage 4: Add prefix
-	prefixed := addPrefix(lowered, ">> ")
+	prefixed := addPrefix(ctx, lowered, ">> ")
 
 	// Consume the pipeline
 	fmt.Println("Pipeline output:")
@@ -64,17 +97,17 @@ func main() {
 	// Fan-in: Multiple channels merged into one
 
 	// Generate numbers
-	numbers := generateNumbers(1, 10)
+	numbers := generateNumbers(ctx, 1, 10)
 
 	// Fan out to 3 workers that square numbers
 	workers := 3
 	channels := make([]<-chan int, workers)
 	for i := 0; i < workers; i++ {
-		channels[i] = square(numbers)
+		channels[i] = square(ctx, numbers)
 	}
 
 	// Fan in (merge results)
-	merged := fanIn(channels...)
+	merged := fanIn(ctx, channels...)
 
 	// Consume
 	fmt.Println("Squared numbers (order may vary):")
@@ -82,82 +115,467 @@ func main() {
 		fmt.Printf("%d ", n)
 	}
 	fmt.Println()
+
+	fmt.Println()
+	fmt.Println("=== Early Termination ===")
+	fmt.Println()
+
+	earlyTermination(5)
+
+	fmt.Println()
+	fmt.Println("=== Error Propagation ===")
+	fmt.Println()
+
+	errorPropagation([]string{"1", "2", "3", "four", "5", "6"})
+
+	fmt.Println()
+	fmt.Println("=== Tee and Routing ===")
+	fmt.Println()
+
+	teeAndRouteDemo()
+
+	fmt.Println()
+	fmt.Println("=== Windowed Aggregation ===")
+	fmt.Println()
+
+	windowDemo()
+
+	fmt.Println()
+	fmt.Println("=== Stage Instrumentation ===")
+	fmt.Println()
+
+	instrumentationDemo()
+
+	fmt.Println()
+	fmt.Println("=== Pipeline Builder ===")
+	fmt.Println()
+
+	builderDemo()
+
+	fmt.Println()
+	fmt.Println("=== Backpressure ===")
+	fmt.Println()
+
+	// Same slow sink, unbuffered vs buffered stages
+	backpressureDemo([]int{0, 0, 0})
+	fmt.Println()
+	backpressureDemo([]int{4, 4, 4})
+}
+
+// earlyTermination consumes only the first n results of a pipeline
+// that could produce a million, then cancels. Without ctx the
+// generator and squarers would stay blocked on send forever.
+func earlyTermination(n int) {
+	before := runtime.NumGoroutine()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	numbers := generateNumbers(ctx, 1, 1_000_000)
+	squared := fanIn(ctx, square(ctx, numbers), square(ctx, numbers))
+
+	fmt.Printf("Taking the first %d of 1,000,000 squares:\n", n)
+	for v := range take(ctx, squared, n) {
+		fmt.Printf("%d ", v)
+	}
+	fmt.Println()
+
+	fmt.Printf("Goroutines while blocked: %d (baseline %d)\n",
+		runtime.NumGoroutine(), before)
+
+	// Stop every upstream stage
+	cancel()
+
+	// Give the stages a moment to observe ctx.Done() and return
+	for i := 0; i < 100 && runtime.NumGoroutine() > before; i++ {
+		time.Sleep(time.Millisecond)
+	}
+	fmt.Printf("Goroutines after cancel:  %d (baseline %d)\n",
+		runtime.NumGoroutine(), before)
+}
+
+// Result carries either a value or the error that produced it.
+// Errors flow downstream like any other item, so the consumer sees
+// them in order and decides whether to stop.
+type Result[T any] struct {
+	Value T
+	Err   error
+}
+
+// errorPropagation runs generate -> parseInts -> squareResults and
+// stops at the first error, cancelling whatever is still upstream
+func errorPropagation(input []string) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	results := squareResults(ctx, parseInts(ctx, generate(ctx, input)))
+
+	fmt.Printf("Input: %q\n", input)
+	for r := range results {
+		if r.Err != nil {
+			fmt.Printf("Pipeline failed: %v\n", r.Err)
+			cancel() // short-circuit: stop every stage still running
+			break
+		}
+		fmt.Printf("  squared: %d\n", r.Value)
+	}
+}
+
+// sendStats records how long a stage spent blocked on send, i.e.
+// how much backpressure reached it from downstream
+type sendStats struct {
+	name    string
+	sends   int
+	blocked time.Duration
+}
+
+// timedSend sends v on out and charges the wait to st
+func timedSend[T any](ctx context.Context, out chan<- T, v T, st *sendStats) bool {
+	start := time.Now()
+	select {
+	case out <- v:
+		st.sends++
+		st.blocked += time.Since(start)
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// backpressureDemo runs source -> double -> format -> slow sink with
+// one buffer size per stage. Because the sink is slow, every stage
+// eventually blocks on send; buffers only change how early that
+// happens and how far ahead the fast stages can run.
+func backpressureDemo(buffers []int) {
+	const items = 20
+	const sinkDelay = 10 * time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	srcStats := &sendStats{name: "source"}
+	dblStats := &sendStats{name: "double"}
+	fmtStats := &sendStats{name: "format"}
+
+	src := make(chan int, buffers[0])
+	go func() {
+		defer close(src)
+		for i := 1; i <= items; i++ {
+			if !timedSend(ctx, src, i, srcStats) {
+				return
+			}
+		}
+	}()
+
+	doubled := make(chan int, buffers[1])
+	go func() {
+		defer close(doubled)
+		for n := range src {
+			if !timedSend(ctx, doubled, n*2, dblStats) {
+				return
+			}
+		}
+	}()
+
+	formatted := make(chan string, buffers[2])
+	go func() {
+		defer close(formatted)
+		for n := range doubled {
+			if !timedSend(ctx, formatted, fmt.Sprintf("item-%d", n), fmtStats) {
+				return
+			}
+		}
+	}()
+
+	// The sink is the bottleneck
+	start := time.Now()
+	for range formatted {
+		time.Sleep(sinkDelay)
+	}
+	total := time.Since(start)
+
+	// All stage goroutines have closed their outputs, so reading the
+	// stats here is safe
+	fmt.Printf("Buffers %v, sink %v/item, total %v\n",
+		buffers, sinkDelay, total.Round(time.Millisecond))
+	fmt.Printf("  %-8s %6s %14s %14s\n", "stage", "sends", "blocked total", "blocked/send")
+	for _, st := range []*sendStats{srcStats, dblStats, fmtStats} {
+		var perSend time.Duration
+		if st.sends > 0 {
+			perSend = st.blocked / time.Duration(st.sends)
+		}
+		fmt.Printf("  %-8s %6d %14v %14v\n", st.name, st.sends,
+			st.blocked.Round(time.Millisecond), perSend.Round(time.Microsecond))
+	}
+	fmt.Println("  (total time is set by the sink either way; buffers only")
+	fmt.Println("   let fast stages run ahead before they start blocking)")
+}
+
+// teeAndRouteDemo duplicates a stream to two consumers, then
+// partitions another stream by key onto three channels
+func teeAndRouteDemo() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// Tee: every number goes to both the summer and the maximum finder
+	//
+	//                    +--> [sum]
+	//  [numbers] --> [tee]
+	//                    +--> [max]
+	//
+	branches := tee(ctx, generateNumbers(ctx, 1, 10), 2)
+
+	var wg sync.WaitGroup
+	var sum, maxVal int
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for n := range branches[0] {
+			sum += n
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for n := range branches[1] {
+			maxVal = max(maxVal, n)
+		}
+	}()
+	wg.Wait()
+	fmt.Printf("Tee: sum=%d max=%d (both branches saw all 10 numbers)\n", sum, maxVal)
+
+	// Route: partition words by length onto short/medium/long channels
+	words := []string{"go", "channel", "select", "context", "a", "goroutine", "mutex", "pipeline", "fan"}
+	partitions := route(ctx, generate(ctx, words), 3, func(w string) int {
+		switch {
+		case len(w) <= 3:
+			return 0
+		case len(w) <= 6:
+			return 1
+		default:
+			return 2
+		}
+	})
+
+	names := []string{"short", "medium", "long"}
+	collected := make([][]string, len(partitions))
+	for i, ch := range partitions {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for w := range ch {
+				collected[i] = append(collected[i], w)
+			}
+		}()
+	}
+	wg.Wait()
+	for i, ws := range collected {
+		fmt.Printf("Route %-6s: %v\n", names[i], ws)
+	}
+}
+
+// windowDemo aggregates the same kinds of stream with count-based and
+// time-based, tumbling and sliding windows
+func windowDemo() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	fmt.Println("Tumbling, 4 items (numbers 1..10):")
+	for w := range tumblingCount(ctx, generateNumbers(ctx, 1, 10), 4) {
+		fmt.Printf("  %v\n", w)
+	}
+
+	fmt.Println("Sliding, 4 items every 2 (numbers 1..10):")
+	for w := range slidingCount(ctx, generateNumbers(ctx, 1, 10), 4, 2) {
+		fmt.Printf("  %v\n", w)
+	}
+
+	// One reading every 10ms for ~300ms
+	fmt.Println("Tumbling, 100ms (one reading per 10ms):")
+	for w := range tumblingTime(ctx, tickingNumbers(ctx, 30, 10*time.Millisecond), 100*time.Millisecond) {
+		fmt.Printf("  %v\n", w)
+	}
+
+	fmt.Println("Sliding, 100ms every 50ms (one reading per 10ms):")
+	for w := range slidingTime(ctx, tickingNumbers(ctx, 30, 10*time.Millisecond), 100*time.Millisecond, 50*time.Millisecond) {
+		fmt.Printf("  %v\n", w)
+	}
+}
+
+// instrumentationDemo wraps each stage function with instrument and
+// prints where the time went, so the slow stage stands out
+func instrumentationDemo() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	parse := &StageStats{Name: "parse"}
+	enrich := &StageStats{Name: "enrich"}
+	format := &StageStats{Name: "format"}
+
+	start := time.Now()
+
+	ids := generateNumbers(ctx, 1, 50)
+	parsed := mapStage(ctx, ids, instrument(parse, func(n int) int {
+		return n * 10
+	}))
+	enriched := mapStage(ctx, parsed, instrument(enrich, func(n int) int {
+		time.Sleep(2 * time.Millisecond) // simulated lookup: the bottleneck
+		return n + 1
+	}))
+	formatted := mapStage(ctx, enriched, instrument(format, func(n int) string {
+		time.Sleep(200 * time.Microsecond)
+		return strconv.Itoa(n)
+	}))
+
+	for range formatted {
+	}
+
+	reportStages(time.Since(start), parse, enrich, format)
+}
+
+// builderDemo declares the first two sections' pipelines with the
+// builder instead of wiring channels by hand
+func builderDemo() {
+	ctx := context.Background()
+
+	words, err := NewPipeline(ctx, []string{"  hello world  ", "  GO IS AWESOME  "}).
+		Then(strings.TrimSpace).
+		Then(strings.ToLower).
+		Then(func(s string) string { return ">> " + s }).
+		Collect()
+	fmt.Printf("Strings: %q (err=%v)\n", words, err)
+
+	squares, err := NewPipeline(ctx, []int{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}).
+		FanOut(3, func(n int) int { return n * n }).
+		Collect()
+	fmt.Printf("Squares (order may vary): %v (err=%v)\n", squares, err)
+
+	// A failing stage cancels everything and Collect reports why
+	parsed, err := NewPipeline(ctx, []string{"1", "2", "three", "4"}).
+		ThenErr(func(s string) (string, error) {
+			if _, err := strconv.Atoi(s); err != nil {
+				return "", fmt.Errorf("parse %q: %w", s, err)
+			}
+			return s, nil
+		}).
+		Collect()
+	fmt.Printf("Parsed: %q (err=%v)\n", parsed, err)
+}
+
+// parseBuffers parses "a,b,c" into the three per-stage buffer sizes
+func parseBuffers(arg string) ([]int, error) {
+	parts := strings.Split(arg, ",")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("need 3 buffer sizes (source,double,format), got %q", arg)
+	}
+
+	buffers := make([]int, len(parts))
+	for i, p := range parts {
+		n, err := strconv.Atoi(strings.TrimSpace(p))
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid buffer size %q", p)
+		}
+		buffers[i] = n
+	}
+	return buffers, nil
 }
 
 // generate creates a channel and sends strings from a slice
-func generate(values []string) <-chan string {
+func generate(ctx context.Context, values []string) <-chan string {
 	out := make(chan string)
 	go func() {
 		defer close(out)
 		for _, v := range values {
-			out <- v
+			select {
+			case out <- v:
+			case <-ctx.Done():
+				return
+			}
 		}
 	}()
 	return out
 }
 
 // trim removes leading/trailing whitespace
-func trim(in <-chan string) <-chan string {
+func trim(ctx context.Context, in <-chan string) <-chan string {
 	out := make(chan string)
 	go func() {
 		defer close(out)
 		for s := range in {
-			out <- strings.TrimSpace(s)
+			select {
+			case out <- strings.TrimSpace(s):
+			case <-ctx.Done():
+				return
+			}
 		}
 	}()
 	return out
 }
 
 // lowercase converts strings to lowercase
-func lowercase(in <-chan string) <-chan string {
+func lowercase(ctx context.Context, in <-chan string) <-chan string {
 	out := make(chan string)
 	go func() {
 		defer close(out)
 		for s := range in {
-			out <- strings.ToLower(s)
+			select {
+			case out <- strings.ToLower(s):
+			case <-ctx.Done():
+				return
+			}
 		}
 	}()
 	return out
 }
 
 // addPrefix adds a prefix to each string
-func addPrefix(in <-chan string, prefix string) <-chan string {
+func addPrefix(ctx context.Context, in <-chan string, prefix string) <-chan string {
 	out := make(chan string)
 	go func() {
 		defer close(out)
 		for s := range in {
-			out <- prefix + s
+			select {
+			case out <- prefix + s:
+			case <-ctx.Done():
+				return
+			}
 		}
 	}()
 	return out
 }
 
 // generateNumbers creates a channel of numbers
-func generateNumbers(start, count int) <-chan int {
+func generateNumbers(ctx context.Context, start, count int) <-chan int {
 	out := make(chan int)
 	go func() {
 		defer close(out)
 		for i := start; i < start+count; i++ {
-			out <- i
+			select {
+			case out <- i:
+			case <-ctx.Done():
+				return
+			}
 		}
 	}()
 	return out
 }
 
 // square reads from in, squares each number, sends to out
-func square(in <-chan int) <-chan int {
+func square(ctx context.Context, in <-chan int) <-chan int {
 	out := make(chan int)
 	go func() {
 		defer close(out)
 		for n := range in {
-			out <- n * n
+			select {
+			case out <- n * n:
+			case <-ctx.Done():
+				return
+			}
 		}
 	}()
 	return out
 }
 
 // fanIn merges multiple channels into one
-func fanIn(channels ...<-chan int) <-chan int {
+func fanIn(ctx context.Context, channels ...<-chan int) <-chan int {
 	out := make(chan int)
 	var wg sync.WaitGroup
 
@@ -167,7 +585,11 @@ func fanIn(channels ...<-chan int) <-chan int {
 		go func(c <-chan int) {
 			defer wg.Done()
 			for n := range c {
-				out <- n
+				select {
+				case out <- n:
+				case <-ctx.Done():
+					return
+				}
 			}
 		}(ch)
 	}
@@ -180,3 +602,576 @@ func fanIn(channels ...<-chan int) <-chan int {
 
 	return out
 }
+
+// take forwards at most n values from in, then closes its output.
+// The caller cancels ctx afterwards to release the upstream stages.
+func take(ctx context.Context, in <-chan int, n int) <-chan int {
+	out := make(chan int)
+	go func() {
+		defer close(out)
+		for i := 0; i < n; i++ {
+			select {
+			case v, ok := <-in:
+				if !ok {
+					return
+				}
+				select {
+				case out <- v:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// parseInts converts strings to ints. On the first parse error it
+// sends the error downstream and stops: there is no point parsing
+// the rest of a stream the consumer is going to reject.
+func parseInts(ctx context.Context, in <-chan string) <-chan Result[int] {
+	out := make(chan Result[int])
+	go func() {
+		defer close(out)
+		for s := range in {
+			n, err := strconv.Atoi(s)
+			r := Result[int]{Value: n}
+			if err != nil {
+				r = Result[int]{Err: fmt.Errorf("parse %q: %w", s, err)}
+			}
+
+			select {
+			case out <- r:
+			case <-ctx.Done():
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// squareResults squares successful values and forwards errors as-is
+func squareResults(ctx context.Context, in <-chan Result[int]) <-chan Result[int] {
+	out := make(chan Result[int])
+	go func() {
+		defer close(out)
+		for r := range in {
+			if r.Err == nil {
+				r.Value *= r.Value
+			}
+			select {
+			case out <- r:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// tee duplicates every item from in onto n outputs. An item is
+// delivered to every output before the next one is read, so the
+// slowest branch paces all of them. All outputs close together when
+// in closes or ctx is cancelled.
+func tee[T any](ctx context.Context, in <-chan T, n int) []<-chan T {
+	outs := make([]chan T, n)
+	result := make([]<-chan T, n)
+	for i := range outs {
+		outs[i] = make(chan T)
+		result[i] = outs[i]
+	}
+
+	go func() {
+		defer func() {
+			for _, out := range outs {
+				close(out)
+			}
+		}()
+		for v := range in {
+			for _, out := range outs {
+				select {
+				case out <- v:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return result
+}
+
+// route sends each item to exactly one of n outputs, chosen by
+// key(item) in [0, n). Like tee, a blocked partition stalls the rest,
+// and every output closes when in closes or ctx is cancelled.
+func route[T any](ctx context.Context, in <-chan T, n int, key func(T) int) []<-chan T {
+	outs := make([]chan T, n)
+	result := make([]<-chan T, n)
+	for i := range outs {
+		outs[i] = make(chan T)
+		result[i] = outs[i]
+	}
+
+	go func() {
+		defer func() {
+			for _, out := range outs {
+				close(out)
+			}
+		}()
+		for v := range in {
+			select {
+			case outs[key(v)] <- v:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return result
+}
+
+// Number is the set of types the window stages can aggregate
+type Number interface {
+	~int | ~int32 | ~int64 | ~float32 | ~float64
+}
+
+// WindowSummary aggregates the items that fell into one window.
+// Start and End are only set for time-based windows.
+type WindowSummary struct {
+	Seq        int
+	Start, End time.Time
+	Count      int
+	Sum        float64
+}
+
+// Avg returns the mean of the window, or 0 for an empty window
+func (w WindowSummary) Avg() float64 {
+	if w.Count == 0 {
+		return 0
+	}
+	return w.Sum / float64(w.Count)
+}
+
+func (w WindowSummary) String() string {
+	return fmt.Sprintf("window #%d: count=%d sum=%.0f avg=%.2f",
+		w.Seq, w.Count, w.Sum, w.Avg())
+}
+
+// summarize builds a summary over a slice of window contents
+func summarize[T Number](seq int, items []T) WindowSummary {
+	w := WindowSummary{Seq: seq, Count: len(items)}
+	for _, v := range items {
+		w.Sum += float64(v)
+	}
+	return w
+}
+
+// tumblingCount emits a summary for every size consecutive items.
+// Windows don't overlap; a final partial window is flushed on close.
+func tumblingCount[T Number](ctx context.Context, in <-chan T, size int) <-chan WindowSummary {
+	out := make(chan WindowSummary)
+	go func() {
+		defer close(out)
+		seq := 0
+		buf := make([]T, 0, size)
+		for v := range in {
+			buf = append(buf, v)
+			if len(buf) < size {
+				continue
+			}
+			seq++
+			select {
+			case out <- summarize(seq, buf):
+			case <-ctx.Done():
+				return
+			}
+			buf = buf[:0]
+		}
+		if len(buf) > 0 {
+			select {
+			case out <- summarize(seq+1, buf):
+			case <-ctx.Done():
+			}
+		}
+	}()
+	return out
+}
+
+// slidingCount emits a summary of the last size items every step
+// items, so consecutive windows overlap by size-step items
+func slidingCount[T Number](ctx context.Context, in <-chan T, size, step int) <-chan WindowSummary {
+	out := make(chan WindowSummary)
+	go func() {
+		defer close(out)
+		seq := 0
+		var window []T
+		sinceEmit := 0
+		for v := range in {
+			window = append(window, v)
+			if len(window) > size {
+				window = window[1:]
+			}
+			sinceEmit++
+
+			// Wait for the first full window, then emit every step items
+			if len(window) < size || sinceEmit < step {
+				continue
+			}
+			sinceEmit = 0
+			seq++
+			select {
+			case out <- summarize(seq, window):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// tumblingTime emits a summary of everything that arrived during each
+// interval d. Empty intervals are skipped; the open window is flushed
+// when in closes.
+func tumblingTime[T Number](ctx context.Context, in <-chan T, d time.Duration) <-chan WindowSummary {
+	out := make(chan WindowSummary)
+	go func() {
+		defer close(out)
+		ticker := time.NewTicker(d)
+		defer ticker.Stop()
+
+		seq := 0
+		start := time.Now()
+		var buf []T
+
+		emit := func(end time.Time) bool {
+			if len(buf) == 0 {
+				start = end
+				return true
+			}
+			seq++
+			w := summarize(seq, buf)
+			w.Start, w.End = start, end
+			buf, start = buf[:0], end
+			select {
+			case out <- w:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+
+		for {
+			select {
+			case v, ok := <-in:
+				if !ok {
+					emit(time.Now())
+					return
+				}
+				buf = append(buf, v)
+			case now := <-ticker.C:
+				if !emit(now) {
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// slidingTime emits, every interval, a summary of the items that
+// arrived within the last size. Items are timestamped on arrival
+// and evicted once they fall out of the window.
+func slidingTime[T Number](ctx context.Context, in <-chan T, size, every time.Duration) <-chan WindowSummary {
+	type stamped struct {
+		at time.Time
+		v  T
+	}
+
+	out := make(chan WindowSummary)
+	go func() {
+		defer close(out)
+		ticker := time.NewTicker(every)
+		defer ticker.Stop()
+
+		seq := 0
+		var window []stamped
+
+		for {
+			select {
+			case v, ok := <-in:
+				if !ok {
+					return
+				}
+				window = append(window, stamped{time.Now(), v})
+			case now := <-ticker.C:
+				// Evict items older than the window
+				cutoff := now.Add(-size)
+				i := 0
+				for i < len(window) && window[i].at.Before(cutoff) {
+					i++
+				}
+				window = window[i:]
+
+				values := make([]T, len(window))
+				for j, s := range window {
+					values[j] = s.v
+				}
+				seq++
+				w := summarize(seq, values)
+				w.Start, w.End = cutoff, now
+				select {
+				case out <- w:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// tickingNumbers emits 1..count, one every interval, simulating a
+// sensor or metrics feed for the time-based windows
+func tickingNumbers(ctx context.Context, count int, interval time.Duration) <-chan int {
+	out := make(chan int)
+	go func() {
+		defer close(out)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for i := 1; i <= count; i++ {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case out <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// mapStage applies fn to every item: the generic shape of trim,
+// lowercase and square, which lets instrument wrap any of them
+func mapStage[In, Out any](ctx context.Context, in <-chan In, fn func(In) Out) <-chan Out {
+	out := make(chan Out)
+	go func() {
+		defer close(out)
+		for v := range in {
+			select {
+			case out <- fn(v):
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out
+}
+
+// StageStats is what instrument records about one stage. It is
+// mutex-protected so fanned-out copies of a stage can share it.
+type StageStats struct {
+	Name string
+
+	mu       sync.Mutex
+	items    int
+	busy     time.Duration // total time spent inside the stage function
+	lastDone time.Time
+	gapTotal time.Duration // sum of gaps between consecutive outputs
+	gapMax   time.Duration
+}
+
+// instrument decorates a stage function so every call is counted and
+// timed. Busy time shows how much work the stage does per item; the
+// gap between outputs shows the rate it actually achieved, which is
+// capped by whichever stage is slowest.
+func instrument[In, Out any](st *StageStats, fn func(In) Out) func(In) Out {
+	return func(v In) Out {
+		start := time.Now()
+		out := fn(v)
+		done := time.Now()
+
+		st.mu.Lock()
+		st.items++
+		st.busy += done.Sub(start)
+		if !st.lastDone.IsZero() {
+			gap := done.Sub(st.lastDone)
+			st.gapTotal += gap
+			st.gapMax = max(st.gapMax, gap)
+		}
+		st.lastDone = done
+		st.mu.Unlock()
+
+		return out
+	}
+}
+
+// Capacity is the items/sec the stage could sustain if it never waited
+// on its neighbours: the lowest capacity marks the bottleneck
+func (st *StageStats) Capacity() float64 {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if st.busy == 0 {
+		return 0
+	}
+	return float64(st.items) / st.busy.Seconds()
+}
+
+// reportStages prints one row per stage and names the bottleneck
+func reportStages(elapsed time.Duration, stages ...*StageStats) {
+	fmt.Printf("  %-8s %6s %10s %12s %12s %14s\n",
+		"stage", "items", "busy", "avg gap", "max gap", "capacity/s")
+
+	var slowest *StageStats
+	for _, st := range stages {
+		capacity := st.Capacity()
+
+		st.mu.Lock()
+		var avgGap time.Duration
+		if st.items > 1 {
+			avgGap = st.gapTotal / time.Duration(st.items-1)
+		}
+		fmt.Printf("  %-8s %6d %10v %12v %12v %14.0f\n",
+			st.Name, st.items, st.busy.Round(time.Millisecond),
+			avgGap.Round(time.Microsecond), st.gapMax.Round(time.Microsecond), capacity)
+		st.mu.Unlock()
+
+		if slowest == nil || capacity < slowest.Capacity() {
+			slowest = st
+		}
+	}
+
+	if slowest != nil && stages[0].items > 0 {
+		fmt.Printf("  actual throughput: %.0f items/s, bottleneck: %s\n",
+			float64(stages[0].items)/elapsed.Seconds(), slowest.Name)
+	}
+}
+
+// Pipeline declares a chain of stages over items of type T. Nothing
+// runs until Collect, which wires one channel per stage, starts the
+// goroutines, and tears everything down on the first error.
+//
+// Go methods can't introduce new type parameters, so every stage maps
+// T to T; use the channel functions above when types change.
+type Pipeline[T any] struct {
+	ctx    context.Context
+	source []T
+	stages []builderStage[T]
+}
+
+type builderStage[T any] struct {
+	workers int
+	fn      func(T) (T, error)
+}
+
+// NewPipeline starts a pipeline that will emit source in order
+func NewPipeline[T any](ctx context.Context, source []T) *Pipeline[T] {
+	return &Pipeline[T]{ctx: ctx, source: source}
+}
+
+// Then appends a stage that cannot fail
+func (p *Pipeline[T]) Then(fn func(T) T) *Pipeline[T] {
+	return p.FanOut(1, fn)
+}
+
+// ThenErr appends a stage whose error stops the whole pipeline
+func (p *Pipeline[T]) ThenErr(fn func(T) (T, error)) *Pipeline[T] {
+	p.stages = append(p.stages, builderStage[T]{workers: 1, fn: fn})
+	return p
+}
+
+// FanOut appends a stage run by n goroutines. Output order is no
+// longer guaranteed after a fan-out.
+func (p *Pipeline[T]) FanOut(n int, fn func(T) T) *Pipeline[T] {
+	p.stages = append(p.stages, builderStage[T]{
+		workers: n,
+		fn:      func(v T) (T, error) { return fn(v), nil },
+	})
+	return p
+}
+
+// Collect runs the pipeline and returns every item that reached the
+// end, or the first error any stage returned
+func (p *Pipeline[T]) Collect() ([]T, error) {
+	ctx, cancel := context.WithCancel(p.ctx)
+	defer cancel()
+
+	var (
+		errOnce  sync.Once
+		firstErr error
+	)
+	fail := func(err error) {
+		errOnce.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+
+	// Source
+	src := make(chan T)
+	go func() {
+		defer close(src)
+		for _, v := range p.source {
+			select {
+			case src <- v:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	// One output channel per stage, closed when all its workers exit
+	var in <-chan T = src
+	for _, st := range p.stages {
+		out := make(chan T)
+		var wg sync.WaitGroup
+		for w := 0; w < st.workers; w++ {
+			wg.Add(1)
+			go func(in <-chan T) {
+				defer wg.Done()
+				for v := range in {
+					res, err := st.fn(v)
+					if err != nil {
+						fail(err)
+						return
+					}
+					select {
+					case out <- res:
+					case <-ctx.Done():
+						return
+					}
+				}
+			}(in)
+		}
+		go func() {
+			wg.Wait()
+			close(out)
+		}()
+		in = out
+	}
+
+	var results []T
+	for v := range in {
+		results = append(results, v)
+	}
+
+	// Every stage has exited once the last channel closes, so firstErr
+	// is settled; a cancelled parent context counts as an error too
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	if err := p.ctx.Err(); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
@@ -0,0 +1,638 @@
+// Pipeline Tests - Proving the stages tear down cleanly
+//
+// A consumer that stops reading early must be able to cancel the
+// context and get every stage goroutine back. These tests compare
+// runtime.NumGoroutine() before and after to catch leaks.
+//
+// The benchmarks at the end measure what the pattern costs: channel
+// handoff with and without buffers, a ring-buffer handoff, and one
+// goroutine per stage versus several.
+//
+// Usage:
+//   go test -v pipeline.go pipeline_test.go
+//   go test -run=^$ -bench=. -benchmem pipeline.go pipeline_test.go
+package main
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// waitForGoroutines polls until the goroutine count drops back to
+// want, failing the test if it never does
+func waitForGoroutines(t *testing.T, want int) {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		if runtime.NumGoroutine() <= want {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	buf := make([]byte, 1<<16)
+	n := runtime.Stack(buf, true)
+	t.Fatalf("goroutine leak: have %d, want %d\n%s",
+		runtime.NumGoroutine(), want, buf[:n])
+}
+
+func TestEarlyTerminationDoesNotLeak(t *testing.T) {
+	tests := []struct {
+		name    string
+		take    int
+		workers int
+	}{
+		{"first result", 1, 1},
+		{"a few results", 5, 3},
+		{"many workers", 10, 8},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := runtime.NumGoroutine()
+
+			ctx, cancel := context.WithCancel(context.Background())
+
+			numbers := generateNumbers(ctx, 1, 1_000_000)
+			channels := make([]<-chan int, tt.workers)
+			for i := range channels {
+				channels[i] = square(ctx, numbers)
+			}
+
+			got := 0
+			for range take(ctx, fanIn(ctx, channels...), tt.take) {
+				got++
+			}
+			if got != tt.take {
+				t.Errorf("took %d values; want %d", got, tt.take)
+			}
+
+			cancel()
+			waitForGoroutines(t, before)
+		})
+	}
+}
+
+func TestStringStagesCancelMidStream(t *testing.T) {
+	before := runtime.NumGoroutine()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	input := make([]string, 1000)
+	for i := range input {
+		input[i] = "  VALUE  "
+	}
+	out := addPrefix(ctx, lowercase(ctx, trim(ctx, generate(ctx, input))), ">> ")
+
+	// Read one value, then walk away without draining
+	if got, want := <-out, ">> value"; got != want {
+		t.Errorf("first value = %q; want %q", got, want)
+	}
+
+	cancel()
+	waitForGoroutines(t, before)
+}
+
+func TestFullDrainWithoutCancel(t *testing.T) {
+	before := runtime.NumGoroutine()
+
+	ctx := context.Background()
+
+	sum := 0
+	for n := range fanIn(ctx, square(ctx, generateNumbers(ctx, 1, 10))) {
+		sum += n
+	}
+	if sum != 385 {
+		t.Errorf("sum of squares 1..10 = %d; want 385", sum)
+	}
+
+	// Stages close their outputs when input runs out, so a full drain
+	// cleans up even with a context that is never cancelled
+	waitForGoroutines(t, before)
+}
+
+func TestErrorShortCircuits(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     []string
+		wantVals  []int
+		wantError bool
+	}{
+		{"all valid", []string{"1", "2", "3"}, []int{1, 4, 9}, false},
+		{"error in the middle", []string{"1", "x", "3"}, []int{1}, true},
+		{"error first", []string{"x", "2"}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := runtime.NumGoroutine()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+
+			var vals []int
+			var err error
+			for r := range squareResults(ctx, parseInts(ctx, generate(ctx, tt.input))) {
+				if r.Err != nil {
+					err = r.Err
+					cancel()
+					break
+				}
+				vals = append(vals, r.Value)
+			}
+
+			if len(vals) != len(tt.wantVals) {
+				t.Fatalf("values = %v; want %v", vals, tt.wantVals)
+			}
+			for i := range vals {
+				if vals[i] != tt.wantVals[i] {
+					t.Errorf("values[%d] = %d; want %d", i, vals[i], tt.wantVals[i])
+				}
+			}
+
+			if tt.wantError {
+				// The consumer sees the original strconv error through the wrap
+				if !errors.Is(err, strconv.ErrSyntax) {
+					t.Errorf("err = %v; want wrapped strconv.ErrSyntax", err)
+				}
+			} else if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+
+			cancel()
+			waitForGoroutines(t, before)
+		})
+	}
+}
+
+// drainAll reads every channel concurrently, as independent branch
+// consumers would, and returns what each one received
+func drainAll[T any](chans []<-chan T) [][]T {
+	got := make([][]T, len(chans))
+
+	var wg sync.WaitGroup
+	for i, ch := range chans {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for v := range ch {
+				got[i] = append(got[i], v)
+			}
+		}()
+	}
+	wg.Wait()
+	return got
+}
+
+func TestTeeDeliversToEveryBranch(t *testing.T) {
+	for _, n := range []int{1, 2, 5} {
+		t.Run(strconv.Itoa(n)+" branches", func(t *testing.T) {
+			before := runtime.NumGoroutine()
+			ctx := context.Background()
+
+			got := drainAll(tee(ctx, generateNumbers(ctx, 1, 100), n))
+			for i, vals := range got {
+				if len(vals) != 100 {
+					t.Errorf("branch %d got %d items; want 100", i, len(vals))
+				}
+				for j, v := range vals {
+					if v != j+1 {
+						t.Errorf("branch %d item %d = %d; want %d", i, j, v, j+1)
+						break
+					}
+				}
+			}
+			waitForGoroutines(t, before)
+		})
+	}
+}
+
+func TestRoutePartitionsByKey(t *testing.T) {
+	before := runtime.NumGoroutine()
+	ctx := context.Background()
+
+	got := drainAll(route(ctx, generateNumbers(ctx, 0, 30), 3, func(n int) int { return n % 3 }))
+
+	for i, vals := range got {
+		if len(vals) != 10 {
+			t.Errorf("partition %d got %d items; want 10", i, len(vals))
+		}
+		for _, v := range vals {
+			if v%3 != i {
+				t.Errorf("partition %d received %d", i, v)
+			}
+		}
+	}
+	waitForGoroutines(t, before)
+}
+
+func TestTeeAndRouteShutDownOnCancel(t *testing.T) {
+	before := runtime.NumGoroutine()
+
+	ctx, cancel := context.WithCancel(context.Background())
+
+	branches := tee(ctx, generateNumbers(ctx, 1, 1_000_000), 2)
+	partitions := route(ctx, branches[0], 2, func(n int) int { return n % 2 })
+
+	// Read a little from one branch only, then give up
+	<-partitions[1]
+	cancel()
+
+	// Every output must still close so the branch consumers finish
+	drainAll(append(partitions, branches[1]))
+	waitForGoroutines(t, before)
+}
+
+func TestCountWindows(t *testing.T) {
+	tests := []struct {
+		name    string
+		windows func(context.Context, <-chan int) <-chan WindowSummary
+		want    []WindowSummary
+	}{
+		{
+			name: "tumbling 4 flushes partial window",
+			windows: func(ctx context.Context, in <-chan int) <-chan WindowSummary {
+				return tumblingCount(ctx, in, 4)
+			},
+			want: []WindowSummary{
+				{Seq: 1, Count: 4, Sum: 10},
+				{Seq: 2, Count: 4, Sum: 26},
+				{Seq: 3, Count: 2, Sum: 19},
+			},
+		},
+		{
+			name: "sliding 4 step 2",
+			windows: func(ctx context.Context, in <-chan int) <-chan WindowSummary {
+				return slidingCount(ctx, in, 4, 2)
+			},
+			want: []WindowSummary{
+				{Seq: 1, Count: 4, Sum: 10}, // 1..4
+				{Seq: 2, Count: 4, Sum: 18}, // 3..6
+				{Seq: 3, Count: 4, Sum: 26}, // 5..8
+				{Seq: 4, Count: 4, Sum: 34}, // 7..10
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			var got []WindowSummary
+			for w := range tt.windows(ctx, generateNumbers(ctx, 1, 10)) {
+				got = append(got, w)
+			}
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d windows; want %d: %v", len(got), len(tt.want), got)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("window %d = %+v; want %+v", i, got[i], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestTumblingTimeKeepsEveryItem(t *testing.T) {
+	ctx := context.Background()
+
+	count, sum := 0, 0.0
+	for w := range tumblingTime(ctx, tickingNumbers(ctx, 20, time.Millisecond), 5*time.Millisecond) {
+		count += w.Count
+		sum += w.Sum
+	}
+
+	// Window boundaries depend on timing, but nothing may be lost
+	if count != 20 || sum != 210 {
+		t.Errorf("windows covered count=%d sum=%.0f; want count=20 sum=210", count, sum)
+	}
+}
+
+func TestInstrumentFindsBottleneck(t *testing.T) {
+	ctx := context.Background()
+
+	fast := &StageStats{Name: "fast"}
+	slow := &StageStats{Name: "slow"}
+
+	out := mapStage(ctx, generateNumbers(ctx, 1, 20), instrument(fast, func(n int) int {
+		return n
+	}))
+	out = mapStage(ctx, out, instrument(slow, func(n int) int {
+		time.Sleep(time.Millisecond)
+		return n
+	}))
+	for range out {
+	}
+
+	for _, st := range []*StageStats{fast, slow} {
+		if st.items != 20 {
+			t.Errorf("%s counted %d items; want 20", st.Name, st.items)
+		}
+	}
+	if fast.Capacity() <= slow.Capacity() {
+		t.Errorf("capacity fast=%.0f slow=%.0f; want fast > slow",
+			fast.Capacity(), slow.Capacity())
+	}
+	// Gaps are measured between outputs, so the fast stage is paced by
+	// the slow one and still shows roughly millisecond gaps
+	if fast.gapMax < time.Millisecond/2 {
+		t.Errorf("fast stage max gap = %v; want it paced by the slow stage", fast.gapMax)
+	}
+}
+
+func TestPipelineBuilder(t *testing.T) {
+	errBoom := errors.New("boom")
+
+	tests := []struct {
+		name    string
+		build   func(context.Context) *Pipeline[int]
+		want    []int // compared as a multiset when sorted is false
+		sorted  bool
+		wantErr error
+	}{
+		{
+			name: "sequential stages keep order",
+			build: func(ctx context.Context) *Pipeline[int] {
+				return NewPipeline(ctx, []int{1, 2, 3}).
+					Then(func(n int) int { return n + 1 }).
+					Then(func(n int) int { return n * 10 })
+			},
+			want:   []int{20, 30, 40},
+			sorted: true,
+		},
+		{
+			name: "fan-out processes every item",
+			build: func(ctx context.Context) *Pipeline[int] {
+				return NewPipeline(ctx, []int{1, 2, 3, 4, 5}).
+					FanOut(4, func(n int) int { return n * n })
+			},
+			want: []int{1, 4, 9, 16, 25},
+		},
+		{
+			name: "error stops the pipeline",
+			build: func(ctx context.Context) *Pipeline[int] {
+				return NewPipeline(ctx, make([]int, 10_000)).
+					ThenErr(func(n int) (int, error) { return 0, errBoom }).
+					FanOut(2, func(n int) int { return n })
+			},
+			wantErr: errBoom,
+		},
+		{
+			name: "no stages passes the source through",
+			build: func(ctx context.Context) *Pipeline[int] {
+				return NewPipeline(ctx, []int{7, 8})
+			},
+			want:   []int{7, 8},
+			sorted: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := runtime.NumGoroutine()
+
+			got, err := tt.build(context.Background()).Collect()
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("err = %v; want %v", err, tt.wantErr)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %v; want %v", got, tt.want)
+			}
+
+			if tt.sorted {
+				for i := range got {
+					if got[i] != tt.want[i] {
+						t.Errorf("got %v; want %v", got, tt.want)
+						break
+					}
+				}
+			} else {
+				counts := make(map[int]int)
+				for _, v := range got {
+					counts[v]++
+				}
+				for _, v := range tt.want {
+					counts[v]--
+				}
+				for v, c := range counts {
+					if c != 0 {
+						t.Errorf("value %d count off by %d in %v", v, c, got)
+					}
+				}
+			}
+
+			waitForGoroutines(t, before)
+		})
+	}
+}
+
+func TestPipelineBuilderParentCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := NewPipeline(ctx, []int{1, 2, 3}).Then(func(n int) int { return n }).Collect()
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("err = %v; want context.Canceled", err)
+	}
+}
+
+// ============================================================
+// Benchmarks
+// ============================================================
+
+const benchItems = 100_000
+
+// chanStage is a CPU-light stage with a configurable output buffer
+func chanStage(in <-chan int, buf int, fn func(int) int) <-chan int {
+	out := make(chan int, buf)
+	go func() {
+		defer close(out)
+		for v := range in {
+			out <- fn(v)
+		}
+	}()
+	return out
+}
+
+// runChanPipeline pushes benchItems through generate -> +1 -> *2 -> sum
+func runChanPipeline(buf int) int {
+	src := make(chan int, buf)
+	go func() {
+		defer close(src)
+		for i := 0; i < benchItems; i++ {
+			src <- i
+		}
+	}()
+
+	out := chanStage(chanStage(src, buf, func(v int) int { return v + 1 }), buf,
+		func(v int) int { return v * 2 })
+
+	sum := 0
+	for v := range out {
+		sum += v
+	}
+	return sum
+}
+
+// ring is a single-producer single-consumer ring buffer. Each side
+// owns one index and only reads the other, so two atomics replace the
+// lock and the goroutine parking a channel needs. When full or empty
+// it spins with runtime.Gosched, trading CPU for latency.
+type ring struct {
+	buf    []int
+	mask   uint64
+	head   atomic.Uint64 // next slot to read, owned by the consumer
+	tail   atomic.Uint64 // next slot to write, owned by the producer
+	closed atomic.Bool
+}
+
+func newRing(size int) *ring {
+	// size must be a power of two so mask can replace modulo
+	return &ring{buf: make([]int, size), mask: uint64(size - 1)}
+}
+
+func (r *ring) push(v int) {
+	t := r.tail.Load()
+	for t-r.head.Load() == uint64(len(r.buf)) {
+		runtime.Gosched()
+	}
+	r.buf[t&r.mask] = v
+	r.tail.Store(t + 1)
+}
+
+func (r *ring) pop() (int, bool) {
+	h := r.head.Load()
+	for h == r.tail.Load() {
+		if r.closed.Load() && h == r.tail.Load() {
+			return 0, false
+		}
+		runtime.Gosched()
+	}
+	v := r.buf[h&r.mask]
+	r.head.Store(h + 1)
+	return v, true
+}
+
+func (r *ring) close() { r.closed.Store(true) }
+
+// runRingPipeline is runChanPipeline with rings instead of channels
+func runRingPipeline(size int) int {
+	src, mid, out := newRing(size), newRing(size), newRing(size)
+
+	go func() {
+		defer src.close()
+		for i := 0; i < benchItems; i++ {
+			src.push(i)
+		}
+	}()
+	go func() {
+		defer mid.close()
+		for v, ok := src.pop(); ok; v, ok = src.pop() {
+			mid.push(v + 1)
+		}
+	}()
+	go func() {
+		defer out.close()
+		for v, ok := mid.pop(); ok; v, ok = mid.pop() {
+			out.push(v * 2)
+		}
+	}()
+
+	sum := 0
+	for v, ok := out.pop(); ok; v, ok = out.pop() {
+		sum += v
+	}
+	return sum
+}
+
+func BenchmarkPipelineHandoff(b *testing.B) {
+	// sum of 2*(i+1) for i in [0, benchItems)
+	want := benchItems * (benchItems + 1)
+
+	cases := []struct {
+		name string
+		run  func() int
+	}{
+		{"unbuffered", func() int { return runChanPipeline(0) }},
+		{"buffered=64", func() int { return runChanPipeline(64) }},
+		{"buffered=1024", func() int { return runChanPipeline(1024) }},
+		{"ring=1024", func() int { return runRingPipeline(1024) }},
+	}
+
+	for _, c := range cases {
+		b.Run(c.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if got := c.run(); got != want {
+					b.Fatalf("sum = %d; want %d", got, want)
+				}
+			}
+			b.ReportMetric(float64(benchItems*b.N)/b.Elapsed().Seconds(), "items/s")
+		})
+	}
+}
+
+// spin does a fixed amount of arithmetic so a stage has real work
+func spin(v, rounds int) int {
+	for i := 0; i < rounds; i++ {
+		v = v*31 + i
+	}
+	return v
+}
+
+// runFannedStage runs one stage on workers goroutines and merges them
+func runFannedStage(workers, rounds int) int {
+	src := make(chan int, 64)
+	go func() {
+		defer close(src)
+		for i := 0; i < benchItems/10; i++ {
+			src <- i
+		}
+	}()
+
+	outs := make([]<-chan int, workers)
+	for w := range outs {
+		outs[w] = chanStage(src, 64, func(v int) int { return spin(v, rounds) })
+	}
+	merged := fanIn(context.Background(), outs...)
+
+	n := 0
+	for range merged {
+		n++
+	}
+	return n
+}
+
+func BenchmarkPipelineStageWorkers(b *testing.B) {
+	workerCounts := []struct {
+		name string
+		n    int
+	}{
+		{"workers=1", 1},
+		{"workers=NumCPU", runtime.NumCPU()},
+	}
+
+	// With light work the extra goroutines only add handoff cost; with
+	// heavier work they let the stage use more than one core
+	for _, rounds := range []int{10, 10_000} {
+		for _, w := range workerCounts {
+			b.Run("work="+strconv.Itoa(rounds)+"/"+w.name, func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					if got := runFannedStage(w.n, rounds); got != benchItems/10 {
+						b.Fatalf("got %d items; want %d", got, benchItems/10)
+					}
+				}
+				b.ReportMetric(float64(benchItems/10*b.N)/b.Elapsed().Seconds(), "items/s")
+			})
+		}
+	}
+}
@@ -0,0 +1,440 @@
+// Pub/Sub Bus - Topic-based fan-out inside one process
+//
+// A Bus[T] delivers every message published on a topic to every
+// subscriber of that topic. Each subscriber reads from its own buffered
+// channel, so the interesting question is what happens when one of them
+// falls behind. Each Subscription picks a policy:
+// - Block: the publisher waits for room. Nothing is lost, but one slow
+//   reader slows every publisher on the topic (and every other reader)
+// - DropOldest: the oldest buffered message is discarded to make room.
+//   The reader always sees the latest state: prices, positions, gauges
+// - DropNewest: the new message is discarded. The reader keeps what it
+//   already has, in order, with a gap after it: logs, audit trails
+//
+// Unsubscribe may be called at any time, also while a publisher is
+// blocked sending to that subscriber; the publisher is released and the
+// subscriber's channel is closed, so a range loop over it ends.
+//
+// The SSE and WebSocket examples have one goroutine per connection
+// reading from a channel; a Subscription is exactly that channel.
+//
+// Usage:
+//   go run pubsub.go
+//   go test -v pubsub.go pubsub_test.go
+//   go test -run=^$ -bench=. -benchmem pubsub.go pubsub_test.go
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ============================================================
+// Bus
+// ============================================================
+
+// Policy says what Publish does when a subscriber's buffer is full
+type Policy int
+
+const (
+	Block Policy = iota
+	DropOldest
+	DropNewest
+)
+
+func (p Policy) String() string {
+	switch p {
+	case Block:
+		return "block"
+	case DropOldest:
+		return "drop-oldest"
+	case DropNewest:
+		return "drop-newest"
+	}
+	return fmt.Sprintf("Policy(%d)", int(p))
+}
+
+var ErrBusClosed = errors.New("pubsub: bus closed")
+
+// Bus routes messages of type T by topic
+//
+// Each topic's subscribers are a slice that is never modified, only
+// replaced (copy on write): Publish takes the current slice under the
+// read lock and sends outside it, so a blocked send never stops
+// Subscribe or Unsubscribe, and Publish allocates nothing. Subscribers
+// get messages in the order they subscribed
+type Bus[T any] struct {
+	mu     sync.RWMutex
+	topics map[string][]*Subscription[T]
+	closed bool
+}
+
+func NewBus[T any]() *Bus[T] {
+	return &Bus[T]{topics: make(map[string][]*Subscription[T])}
+}
+
+// Subscription is one reader of one topic
+type Subscription[T any] struct {
+	bus    *Bus[T]
+	topic  string
+	policy Policy
+
+	// mu serializes sends with each other and with close, so a message
+	// is never sent on a closed channel. done is closed first, without
+	// mu, to release a publisher blocked in a send while holding mu
+	mu       sync.Mutex
+	ch       chan T
+	done     chan struct{}
+	stopOnce sync.Once
+	closed   bool
+
+	delivered atomic.Int64
+	dropped   atomic.Int64
+}
+
+// Subscribe registers a reader of topic with a buffer of size messages
+func (b *Bus[T]) Subscribe(topic string, size int, policy Policy) (*Subscription[T], error) {
+	if policy == DropOldest && size < 1 {
+		return nil, errors.New("pubsub: drop-oldest needs a buffer of at least 1")
+	}
+	s := &Subscription[T]{
+		bus:    b,
+		topic:  topic,
+		policy: policy,
+		ch:     make(chan T, size),
+		done:   make(chan struct{}),
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		return nil, ErrBusClosed
+	}
+	b.topics[topic] = append(slices.Clip(b.topics[topic]), s)
+	return s, nil
+}
+
+// C is where the messages arrive. It is closed by Unsubscribe and by
+// Bus.Close
+func (s *Subscription[T]) C() <-chan T { return s.ch }
+
+func (s *Subscription[T]) Topic() string    { return s.topic }
+func (s *Subscription[T]) Delivered() int64 { return s.delivered.Load() }
+func (s *Subscription[T]) Dropped() int64   { return s.dropped.Load() }
+func (s *Subscription[T]) Policy() Policy   { return s.policy }
+
+// Unsubscribe stops delivery and closes C. Messages already buffered
+// can still be read. Safe to call more than once and from any goroutine
+func (s *Subscription[T]) Unsubscribe() {
+	s.bus.mu.Lock()
+	if subs := slices.DeleteFunc(slices.Clone(s.bus.topics[s.topic]),
+		func(x *Subscription[T]) bool { return x == s }); len(subs) > 0 {
+		s.bus.topics[s.topic] = subs
+	} else {
+		delete(s.bus.topics, s.topic)
+	}
+	s.bus.mu.Unlock()
+	s.stop()
+}
+
+func (s *Subscription[T]) stop() {
+	s.stopOnce.Do(func() {
+		close(s.done)
+		s.mu.Lock()
+		s.closed = true
+		close(s.ch)
+		s.mu.Unlock()
+	})
+}
+
+// deliver hands msg to s according to its policy. It returns false if
+// msg did not arrive, and ctx's error if a Block send gave up
+func (s *Subscription[T]) deliver(ctx context.Context, msg T) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return false, nil
+	}
+	switch s.policy {
+	case DropNewest:
+		select {
+		case s.ch <- msg:
+		default:
+			s.dropped.Add(1)
+			return false, nil
+		}
+	case DropOldest:
+		for sent := false; !sent; {
+			select {
+			case s.ch <- msg:
+				sent = true
+			default:
+				// Full: throw away the head. The reader may empty the
+				// buffer between the two selects, so loop rather than
+				// assume the receive succeeds
+				select {
+				case <-s.ch:
+					s.dropped.Add(1)
+				default:
+				}
+			}
+		}
+	default:
+		select {
+		case s.ch <- msg:
+		case <-s.done:
+			return false, nil
+		case <-ctx.Done():
+			return false, ctx.Err()
+		}
+	}
+	s.delivered.Add(1)
+	return true, nil
+}
+
+// Publish sends msg to every subscriber of topic and returns how many
+// got it. Only Block subscribers can make it wait, for as long as ctx
+// allows; when ctx ends, subscribers not yet reached are skipped and
+// ctx's error returned. A subscriber removed during a Publish may still
+// be offered the message, and refuses it, being closed
+func (b *Bus[T]) Publish(ctx context.Context, topic string, msg T) (int, error) {
+	b.mu.RLock()
+	if b.closed {
+		b.mu.RUnlock()
+		return 0, ErrBusClosed
+	}
+	subs := b.topics[topic]
+	b.mu.RUnlock()
+
+	n := 0
+	for _, s := range subs {
+		ok, err := s.deliver(ctx, msg)
+		if err != nil {
+			return n, err
+		}
+		if ok {
+			n++
+		}
+	}
+	return n, nil
+}
+
+// Subscribers is the number of subscribers of topic
+func (b *Bus[T]) Subscribers(topic string) int {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	return len(b.topics[topic])
+}
+
+// Close unsubscribes everyone; Publish and Subscribe then fail
+func (b *Bus[T]) Close() {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return
+	}
+	b.closed = true
+	topics := b.topics
+	b.topics = nil
+	b.mu.Unlock()
+	for _, subs := range topics {
+		for _, s := range subs {
+			s.stop()
+		}
+	}
+}
+
+// ============================================================
+// Demo: a price feed with readers of different speeds
+// ============================================================
+
+type Quote struct {
+	Symbol string
+	Seq    int
+	Price  float64
+}
+
+// reader consumes sub, spending work on each message, and records
+// what it saw
+type reader struct {
+	name   string
+	policy Policy
+	work   time.Duration
+
+	sub    *Subscription[Quote]
+	seen   []int
+	maxLag time.Duration
+}
+
+func (r *reader) run(wg *sync.WaitGroup, sent *sync.Map) {
+	defer wg.Done()
+	for q := range r.sub.C() {
+		if at, ok := sent.Load(q.Seq); ok {
+			r.maxLag = max(r.maxLag, time.Since(at.(time.Time)))
+		}
+		r.seen = append(r.seen, q.Seq)
+		time.Sleep(r.work)
+	}
+}
+
+// runs shows a sequence of seq numbers as ranges: "0-8 41-49"
+func runs(seq []int) string {
+	var out []string
+	for i := 0; i < len(seq); {
+		j := i
+		for j+1 < len(seq) && seq[j+1] == seq[j]+1 {
+			j++
+		}
+		if i == j {
+			out = append(out, fmt.Sprint(seq[i]))
+		} else {
+			out = append(out, fmt.Sprintf("%d-%d", seq[i], seq[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(out, " ")
+}
+
+// priceFeed publishes quotes in bursts of 40, as fast as Publish
+// returns, with a pause after each. Readers have a buffer of 8 and
+// spend work on each quote
+func priceFeed(readers []*reader) {
+	bus := NewBus[Quote]()
+	const bursts, perBurst = 3, 40
+	for _, r := range readers {
+		sub, err := bus.Subscribe("ACME", 8, r.policy)
+		if err != nil {
+			panic(err)
+		}
+		r.sub = sub
+	}
+
+	var wg sync.WaitGroup
+	var sent sync.Map // seq -> publish time
+	for _, r := range readers {
+		wg.Add(1)
+		go r.run(&wg, &sent)
+	}
+
+	rng := rand.New(rand.NewSource(1))
+	price := 100.0
+	start := time.Now()
+	var slowest time.Duration
+	for seq := range bursts * perBurst {
+		price += rng.Float64() - 0.5
+		sent.Store(seq, time.Now())
+		t := time.Now()
+		bus.Publish(context.Background(), "ACME", Quote{"ACME", seq, price})
+		slowest = max(slowest, time.Since(t))
+		if seq%perBurst == perBurst-1 {
+			time.Sleep(30 * time.Millisecond)
+		}
+	}
+	fmt.Printf("  published %d bursts of %d in %v, slowest Publish %v\n", bursts, perBurst,
+		time.Since(start).Round(time.Millisecond), slowest.Round(10*time.Microsecond))
+	bus.Close()
+	wg.Wait()
+
+	for _, r := range readers {
+		fmt.Printf("  %-4s %-11v got %3d, dropped %3d, max lag %6v: %s\n",
+			r.name, r.sub.Policy(), len(r.seen), r.sub.Dropped(),
+			r.maxLag.Round(100*time.Microsecond), runs(r.seen))
+	}
+}
+
+// ============================================================
+// Demo: publish deadlines and unsubscribing a stuck reader
+// ============================================================
+
+func stuckReader() {
+	bus := NewBus[string]()
+	stuck, _ := bus.Subscribe("chat", 2, Block)
+	ok, _ := bus.Subscribe("chat", 16, Block)
+	go func() {
+		for range ok.C() {
+		}
+	}()
+
+	// stuck never reads: its 2 slots fill, then Publish waits
+	for i := range 4 {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Millisecond)
+		n, err := bus.Publish(ctx, "chat", fmt.Sprint("msg ", i))
+		cancel()
+		fmt.Printf("  Publish(msg %d): delivered to %d, err %v\n", i, n, err)
+	}
+
+	// A publisher without a deadline is stuck until the reader goes
+	// away; Unsubscribe releases it
+	released := make(chan int)
+	go func() {
+		n, _ := bus.Publish(context.Background(), "chat", "msg 4")
+		released <- n
+	}()
+	time.Sleep(20 * time.Millisecond)
+	stuck.Unsubscribe()
+	fmt.Printf("  after stuck.Unsubscribe(), the blocked Publish returns: delivered to %d\n", <-released)
+
+	var left []string
+	for m := range stuck.C() { // buffered messages survive, then the range ends
+		left = append(left, m)
+	}
+	fmt.Printf("  stuck can still drain its buffer: %q\n", left)
+	fmt.Printf("  subscribers of chat now: %d\n", bus.Subscribers("chat"))
+	bus.Close()
+	if _, err := bus.Publish(context.Background(), "chat", "late"); err != nil {
+		fmt.Printf("  Publish after Close: %v\n", err)
+	}
+}
+
+// ============================================================
+// Demo: topics
+// ============================================================
+
+func topics() {
+	bus := NewBus[Quote]()
+	acme, _ := bus.Subscribe("ACME", 4, DropOldest)
+	both := []*Subscription[Quote]{}
+	for _, t := range []string{"ACME", "INIT"} {
+		s, _ := bus.Subscribe(t, 4, DropOldest)
+		both = append(both, s)
+	}
+	n1, _ := bus.Publish(context.Background(), "ACME", Quote{"ACME", 1, 101})
+	n2, _ := bus.Publish(context.Background(), "INIT", Quote{"INIT", 1, 42})
+	n3, _ := bus.Publish(context.Background(), "NOPE", Quote{"NOPE", 1, 0})
+	fmt.Printf("  ACME reached %d, INIT %d, NOPE (no subscribers) %d\n", n1, n2, n3)
+	fmt.Printf("  acme-only subscriber got %v\n", <-acme.C())
+	fmt.Printf("  the two-topic reader has one Subscription per topic: %v, %v\n", <-both[0].C(), <-both[1].C())
+	bus.Close()
+}
+
+func main() {
+	fmt.Println("=== Price feed: a fast reader and two slow ones that drop ===")
+	priceFeed([]*reader{
+		{name: "fast", policy: Block},
+		{name: "slow", policy: DropOldest, work: 2 * time.Millisecond},
+		{name: "slow", policy: DropNewest, work: 2 * time.Millisecond},
+	})
+	fmt.Println("  drop-oldest keeps the end of each burst: the latest prices")
+	fmt.Println("  drop-newest keeps the start of each burst and loses the rest")
+
+	fmt.Println("\n=== The same, plus one slow reader that blocks ===")
+	priceFeed([]*reader{
+		{name: "fast", policy: Block},
+		{name: "slow", policy: DropOldest, work: 2 * time.Millisecond},
+		{name: "slow", policy: Block, work: 2 * time.Millisecond},
+	})
+	fmt.Println("  nothing is lost by the blocking reader, but every burst now takes")
+	fmt.Println("  as long as it does to read, and so do the fast reader's quotes")
+
+	fmt.Println("\n=== A reader that never reads ===")
+	stuckReader()
+
+	fmt.Println("\n=== Topics ===")
+	topics()
+}
@@ -0,0 +1,294 @@
+// Pub/Sub Tests - Buffer policies, teardown, and what fan-out costs
+//
+// The policy tests fill a subscriber's buffer without reading it and
+// check which messages survive. The teardown tests check that
+// Unsubscribe and Close release blocked publishers and end readers'
+// range loops, with no goroutines left behind.
+//
+// The benchmarks publish to 1..1000 subscribers to show that Publish
+// costs one channel send per subscriber, and what each policy adds.
+//
+// Usage:
+//   go test -v pubsub.go pubsub_test.go
+//   go test -run=^$ -bench=. -benchmem pubsub.go pubsub_test.go
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// publishN publishes 0..n-1 on topic
+func publishN(t testing.TB, bus *Bus[int], topic string, n int) {
+	t.Helper()
+	for i := range n {
+		if _, err := bus.Publish(context.Background(), topic, i); err != nil {
+			t.Fatalf("Publish(%d): %v", i, err)
+		}
+	}
+}
+
+// drain reads what is buffered in sub without waiting for more
+func drain(sub *Subscription[int]) []int {
+	var got []int
+	for {
+		select {
+		case v, ok := <-sub.C():
+			if !ok {
+				return got
+			}
+			got = append(got, v)
+		default:
+			return got
+		}
+	}
+}
+
+func TestPolicies(t *testing.T) {
+	tests := []struct {
+		policy  Policy
+		want    []int
+		dropped int64
+	}{
+		{DropOldest, []int{6, 7, 8, 9}, 6},
+		{DropNewest, []int{0, 1, 2, 3}, 6},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy.String(), func(t *testing.T) {
+			bus := NewBus[int]()
+			sub, err := bus.Subscribe("t", 4, tt.policy)
+			if err != nil {
+				t.Fatal(err)
+			}
+			publishN(t, bus, "t", 10)
+			if got := drain(sub); !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+			if sub.Dropped() != tt.dropped {
+				t.Errorf("Dropped() = %d, want %d", sub.Dropped(), tt.dropped)
+			}
+		})
+	}
+}
+
+func TestBlockWaitsForReader(t *testing.T) {
+	bus := NewBus[int]()
+	sub, _ := bus.Subscribe("t", 1, Block)
+	publishN(t, bus, "t", 1) // fills the buffer
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if n, err := bus.Publish(ctx, "t", 1); n != 0 || !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Publish to a full Block subscriber = %d, %v; want 0, deadline exceeded", n, err)
+	}
+
+	// With a reader, nothing is lost and order holds
+	done := make(chan []int)
+	go func() {
+		var got []int
+		for v := range sub.C() {
+			got = append(got, v)
+		}
+		done <- got
+	}()
+	for i := 1; i < 100; i++ {
+		if _, err := bus.Publish(context.Background(), "t", i); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sub.Unsubscribe()
+	got := <-done
+	if len(got) != 100 || !slices.IsSorted(got) {
+		t.Errorf("reader got %d messages (sorted %v), want 0..99 in order", len(got), slices.IsSorted(got))
+	}
+}
+
+func TestUnsubscribeReleasesBlockedPublisher(t *testing.T) {
+	bus := NewBus[int]()
+	stuck, _ := bus.Subscribe("t", 1, Block)
+	other, _ := bus.Subscribe("t", 4, DropNewest)
+	publishN(t, bus, "t", 1)
+
+	result := make(chan int)
+	go func() {
+		n, _ := bus.Publish(context.Background(), "t", 1)
+		result <- n
+	}()
+	time.Sleep(10 * time.Millisecond) // let it block on stuck
+	stuck.Unsubscribe()
+	stuck.Unsubscribe() // twice is fine
+
+	select {
+	case n := <-result:
+		if n != 1 {
+			t.Errorf("blocked Publish delivered to %d, want 1 (other)", n)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Publish still blocked after Unsubscribe")
+	}
+	if got := drain(stuck); !slices.Equal(got, []int{0}) {
+		t.Errorf("stuck's buffer after Unsubscribe = %v, want [0]", got)
+	}
+	if _, ok := <-stuck.C(); ok {
+		t.Error("C() still open after Unsubscribe")
+	}
+	if got := drain(other); !slices.Equal(got, []int{0, 1}) {
+		t.Errorf("other got %v, want [0 1]", got)
+	}
+	if n := bus.Subscribers("t"); n != 1 {
+		t.Errorf("Subscribers = %d, want 1", n)
+	}
+}
+
+func TestTopicsAreSeparate(t *testing.T) {
+	bus := NewBus[int]()
+	a, _ := bus.Subscribe("a", 4, DropNewest)
+	b, _ := bus.Subscribe("b", 4, DropNewest)
+	if n, _ := bus.Publish(context.Background(), "a", 1); n != 1 {
+		t.Errorf("Publish(a) reached %d, want 1", n)
+	}
+	if n, _ := bus.Publish(context.Background(), "c", 1); n != 0 {
+		t.Errorf("Publish(c) reached %d, want 0", n)
+	}
+	if len(drain(a)) != 1 || len(drain(b)) != 0 {
+		t.Error("message leaked across topics")
+	}
+}
+
+func TestCloseEndsEverything(t *testing.T) {
+	before := runtime.NumGoroutine()
+	bus := NewBus[int]()
+	var wg sync.WaitGroup
+	for i := range 20 {
+		sub, _ := bus.Subscribe(fmt.Sprint("t", i%3), 2, Policy(i%3))
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for range sub.C() {
+				time.Sleep(time.Millisecond)
+			}
+		}()
+	}
+	for i := range 3 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; ; j++ {
+				if _, err := bus.Publish(context.Background(), fmt.Sprint("t", i), j); err != nil {
+					return
+				}
+			}
+		}()
+	}
+	time.Sleep(20 * time.Millisecond)
+	bus.Close()
+	bus.Close()
+	wg.Wait()
+
+	if _, err := bus.Subscribe("t0", 1, Block); !errors.Is(err, ErrBusClosed) {
+		t.Errorf("Subscribe after Close: %v, want ErrBusClosed", err)
+	}
+	if after := runtime.NumGoroutine(); after > before {
+		t.Errorf("%d goroutines before, %d after Close", before, after)
+	}
+}
+
+func TestConcurrentSubscribeUnsubscribe(t *testing.T) {
+	// Run with -race: subscribers come and go while publishers run
+	bus := NewBus[int]()
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; ctx.Err() == nil; j++ {
+				bus.Publish(ctx, "t", j)
+			}
+		}()
+	}
+	for i := range 50 {
+		sub, _ := bus.Subscribe("t", 1, Policy(i%3))
+		go func() {
+			for range sub.C() {
+			}
+		}()
+		bus.Publish(ctx, "t", -1)
+		sub.Unsubscribe()
+	}
+	cancel()
+	wg.Wait()
+	if n := bus.Subscribers("t"); n != 0 {
+		t.Errorf("Subscribers = %d after all unsubscribed", n)
+	}
+}
+
+// ============================================================
+// Benchmarks
+// ============================================================
+
+// BenchmarkFanOut publishes one message to n subscribers, each drained
+// by its own goroutine
+func BenchmarkFanOut(b *testing.B) {
+	for _, policy := range []Policy{Block, DropOldest, DropNewest} {
+		for _, n := range []int{1, 10, 100, 1000} {
+			b.Run(fmt.Sprintf("%v/%d", policy, n), func(b *testing.B) {
+				bus := NewBus[int]()
+				var wg sync.WaitGroup
+				for range n {
+					sub, _ := bus.Subscribe("t", 64, policy)
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						for range sub.C() {
+						}
+					}()
+				}
+				ctx := context.Background()
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := range b.N {
+					bus.Publish(ctx, "t", i)
+				}
+				b.StopTimer()
+				bus.Close()
+				wg.Wait()
+			})
+		}
+	}
+}
+
+// BenchmarkParallelPublish has many publishers on one topic. They share
+// the read lock and contend on each subscriber's mutex
+func BenchmarkParallelPublish(b *testing.B) {
+	for _, n := range []int{1, 10} {
+		b.Run(fmt.Sprint(n, "subs"), func(b *testing.B) {
+			bus := NewBus[int]()
+			var wg sync.WaitGroup
+			for range n {
+				sub, _ := bus.Subscribe("t", 256, DropNewest)
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for range sub.C() {
+					}
+				}()
+			}
+			ctx := context.Background()
+			b.RunParallel(func(pb *testing.PB) {
+				for i := 0; pb.Next(); i++ {
+					bus.Publish(ctx, "t", i)
+				}
+			})
+			b.StopTimer()
+			bus.Close()
+			wg.Wait()
+		})
+	}
+}
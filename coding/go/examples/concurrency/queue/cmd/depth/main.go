@@ -0,0 +1,199 @@
+// depth - A producer and a consumer through a BlockingQueue, per policy
+//
+// The consumer works at a steady 1000 items/s. The producer follows a
+// script that outruns it and then falls behind:
+//
+//   0.0s  steady   800/s   the queue stays near empty
+//   0.5s  burst   1400/s   the queue fills, 400/s faster than it drains
+//   1.0s  quiet    600/s   the consumer catches up
+//
+// One item in ten is high priority, three are normal, six are low. For
+// each policy it samples the queue depth every 100ms and then shows
+// how long each priority waited. Things to look for:
+// - Block: the queue sits at capacity through the burst and the
+//   producer is held back, so it offers fewer items than the script
+//   asked for; nothing is lost
+// - DropNewest: the same depth, but the producer never waits and the
+//   overflow is lost, whatever its priority
+// - DropLowest: the losses are all low priority, so more high and
+//   normal items get through than under DropNewest
+// - Reject: like DropNewest, but the producer is told, and counts it
+// - Every policy: high-priority items jump the queue, so while it is
+//   full they wait a fraction of what low-priority ones do
+//
+// Usage:
+//   go run ./cmd/depth
+//   go run ./cmd/depth -capacity 20 -policy drop-lowest
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bellistech/labs/coding/go/examples/concurrency/queue"
+)
+
+type phase struct {
+	name   string
+	length time.Duration
+	rate   int // items per second
+}
+
+var script = []phase{
+	{"steady", 500 * time.Millisecond, 800},
+	{"burst", 500 * time.Millisecond, 1400},
+	{"quiet", 500 * time.Millisecond, 600},
+}
+
+const (
+	tick        = 10 * time.Millisecond
+	consumeRate = 1000
+)
+
+var prioNames = []string{"low", "normal", "high"}
+
+type job struct {
+	prio     int
+	enqueued time.Time
+}
+
+// waits is what the consumer saw for one priority
+type waits struct {
+	taken      int
+	total, max time.Duration
+}
+
+type result struct {
+	offered, refused int
+	byPrio           [3]waits
+	stats            queue.Stats
+}
+
+func run(policy queue.Policy, capacity int) result {
+	q := queue.New[job](queue.Config{Capacity: capacity, Policy: policy})
+	ctx := context.Background()
+	var res result
+	var wg sync.WaitGroup
+
+	// Consumer: consumeRate/s, in batches per tick, until closed and empty
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		t := time.NewTicker(tick)
+		defer t.Stop()
+		for range t.C {
+			for range consumeRate * int(tick) / int(time.Second) {
+				j, err := q.Take(ctx)
+				if errors.Is(err, queue.ErrClosed) {
+					return
+				}
+				w := &res.byPrio[j.prio]
+				d := time.Since(j.enqueued)
+				w.taken++
+				w.total += d
+				w.max = max(w.max, d)
+			}
+		}
+	}()
+
+	// Sampler: depth every 100ms while the script runs
+	stop := make(chan struct{})
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		t := time.NewTicker(100 * time.Millisecond)
+		defer t.Stop()
+		start := time.Now()
+		for {
+			select {
+			case <-stop:
+				return
+			case now := <-t.C:
+				elapsed := now.Sub(start)
+				n := q.Len()
+				fmt.Printf("    %4.1fs %-6s %4d |%-30s|\n", elapsed.Seconds(), phaseAt(elapsed),
+					n, strings.Repeat("#", n*30/capacity))
+			}
+		}
+	}()
+
+	// Producer: follows the script, a batch per tick. Under Block a Put
+	// can wait, and the ticks it misses are not made up
+	rng := rand.New(rand.NewPCG(1, 2))
+	t := time.NewTicker(tick)
+	for _, ph := range script {
+		end := time.Now().Add(ph.length)
+		for now := range t.C {
+			if now.After(end) {
+				break
+			}
+			for range ph.rate * int(tick) / int(time.Second) {
+				prio := 0 // 6 in 10
+				switch r := rng.IntN(10); {
+				case r == 0:
+					prio = 2
+				case r < 4:
+					prio = 1
+				}
+				res.offered++
+				if err := q.Put(ctx, job{prio, time.Now()}, prio); errors.Is(err, queue.ErrFull) {
+					res.refused++
+				}
+			}
+		}
+	}
+	t.Stop()
+	close(stop)
+	q.Close()
+	wg.Wait()
+	res.stats = q.Stats()
+	return res
+}
+
+func phaseAt(d time.Duration) string {
+	for _, ph := range script {
+		if d < ph.length {
+			return ph.name
+		}
+		d -= ph.length
+	}
+	return "drain"
+}
+
+func main() {
+	capacity := flag.Int("capacity", 100, "queue capacity")
+	only := flag.String("policy", "", "run one policy: block, drop-newest, drop-lowest or reject")
+	flag.Parse()
+
+	asked := 0
+	for _, ph := range script {
+		asked += ph.rate * int(ph.length) / int(time.Second)
+	}
+	for _, p := range []queue.Policy{queue.Block, queue.DropNewest, queue.DropLowest, queue.Reject} {
+		if *only != "" && p.String() != *only {
+			continue
+		}
+		fmt.Printf("=== %s, capacity %d ===\n", p, *capacity)
+		res := run(p, *capacity)
+		st := res.stats
+		fmt.Printf("  script asked for %d, producer offered %d: consumed %d, dropped %d, rejected %d (producer saw %d refusals)\n",
+			asked, res.offered, st.Taken, st.Dropped, st.Rejected, res.refused)
+		fmt.Printf("  high water %d; %d Puts had to wait\n", st.HighWater, st.Waited)
+		for prio := len(prioNames) - 1; prio >= 0; prio-- {
+			w := res.byPrio[prio]
+			mean := time.Duration(0)
+			if w.taken > 0 {
+				mean = w.total / time.Duration(w.taken)
+			}
+			fmt.Printf("  %-6s %5d taken, waited %8v on average, %8v at most\n", prioNames[prio], w.taken,
+				mean.Round(10*time.Microsecond), w.max.Round(10*time.Microsecond))
+		}
+		fmt.Println()
+	}
+}
@@ -0,0 +1,289 @@
+// Package queue is a bounded producer-consumer queue with priorities
+// and a choice of what happens when it is full.
+//
+// A buffered channel is a bounded FIFO whose only full-queue behaviour
+// is to block (or, with select and default, to fail). A BlockingQueue
+// adds what a channel can't do:
+//   - Priorities: Take returns the highest-priority item, oldest first
+//     among equals, so urgent work doesn't wait behind a backlog.
+//   - A Policy for a full queue. Block applies backpressure to the
+//     producer; DropNewest and DropLowest shed load and count it;
+//     Reject hands ErrFull back to the producer to decide (retry, 503).
+//   - Stats with the high-water mark, so the capacity is chosen from
+//     data rather than guessed.
+//
+// Which policy: Block when every item must be processed and producers
+// can be slowed down. Drop when the items are samples and fresher ones
+// are coming (metrics, telemetry). Reject when the producer is serving
+// a caller who can be told to come back later.
+package queue
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+type Policy int
+
+const (
+	Block      Policy = iota // Put waits for room
+	DropNewest               // Put discards its item
+	DropLowest               // Put evicts the lowest-priority item, or discards its own if none is lower
+	Reject                   // Put returns ErrFull
+)
+
+func (p Policy) String() string {
+	switch p {
+	case Block:
+		return "block"
+	case DropNewest:
+		return "drop-newest"
+	case DropLowest:
+		return "drop-lowest"
+	case Reject:
+		return "reject"
+	}
+	return fmt.Sprintf("Policy(%d)", int(p))
+}
+
+var (
+	// ErrFull is returned by Put under the Reject policy
+	ErrFull = errors.New("queue: full")
+	// ErrClosed is returned by Put after Close, and by Take once the
+	// queue is closed and empty
+	ErrClosed = errors.New("queue: closed")
+)
+
+type Config struct {
+	// Capacity is how many items the queue holds (1024)
+	Capacity int
+	Policy   Policy
+}
+
+// Stats counts what the queue has done since New
+type Stats struct {
+	Len       int // now
+	HighWater int // the most it has held
+	Put       uint64
+	Taken     uint64
+	Dropped   uint64 // discarded by DropNewest or DropLowest
+	Rejected  uint64 // refused with ErrFull
+	Waited    uint64 // Puts that found the queue full and blocked
+}
+
+type item[T any] struct {
+	v    T
+	prio int
+	seq  uint64 // arrival order, for FIFO among equal priorities
+}
+
+// itemHeap keeps the highest priority, then the oldest, on top
+type itemHeap[T any] []item[T]
+
+func (h itemHeap[T]) Len() int { return len(h) }
+func (h itemHeap[T]) Less(i, j int) bool {
+	if h[i].prio != h[j].prio {
+		return h[i].prio > h[j].prio
+	}
+	return h[i].seq < h[j].seq
+}
+func (h itemHeap[T]) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h *itemHeap[T]) Push(x any)   { *h = append(*h, x.(item[T])) }
+func (h *itemHeap[T]) Pop() any {
+	old := *h
+	it := old[len(old)-1]
+	old[len(old)-1] = item[T]{} // don't keep the value reachable
+	*h = old[:len(old)-1]
+	return it
+}
+
+// BlockingQueue is safe for concurrent use by any number of producers
+// and consumers
+type BlockingQueue[T any] struct {
+	cfg Config
+
+	mu     sync.Mutex
+	items  itemHeap[T]
+	seq    uint64
+	closed bool
+	stats  Stats
+	// Each is closed, and replaced, to wake every waiter of its kind.
+	// Waking them all for one item is simple and fine for a handful of
+	// waiters; a queue with thousands would keep a list and wake one.
+	// The flags say someone is waiting, so that a queue nobody waits on
+	// doesn't make a channel per operation
+	added, removed      chan struct{}
+	takeWaits, putWaits bool
+}
+
+func New[T any](cfg Config) *BlockingQueue[T] {
+	if cfg.Capacity <= 0 {
+		cfg.Capacity = 1024
+	}
+	return &BlockingQueue[T]{
+		cfg:     cfg,
+		items:   make(itemHeap[T], 0, cfg.Capacity),
+		added:   make(chan struct{}),
+		removed: make(chan struct{}),
+	}
+}
+
+// Put adds v with priority prio; higher is taken sooner. What happens
+// when the queue is full depends on the Policy: only Block waits, and
+// only Block returns ctx's error. A dropped item is not an error; it
+// shows in Stats
+func (q *BlockingQueue[T]) Put(ctx context.Context, v T, prio int) error {
+	waited := false
+	for {
+		q.mu.Lock()
+		if q.closed {
+			q.mu.Unlock()
+			return ErrClosed
+		}
+		if len(q.items) < q.cfg.Capacity {
+			q.push(item[T]{v: v, prio: prio})
+			q.mu.Unlock()
+			return nil
+		}
+		switch q.cfg.Policy {
+		case DropNewest:
+			q.stats.Dropped++
+			q.mu.Unlock()
+			return nil
+		case DropLowest:
+			if i := q.lowest(); q.items[i].prio < prio {
+				heap.Remove(&q.items, i)
+				q.push(item[T]{v: v, prio: prio})
+			}
+			q.stats.Dropped++ // one item was lost either way
+			q.mu.Unlock()
+			return nil
+		case Reject:
+			q.stats.Rejected++
+			q.mu.Unlock()
+			return ErrFull
+		}
+		if !waited {
+			waited = true
+			q.stats.Waited++
+		}
+		removed := q.removed
+		q.putWaits = true
+		q.mu.Unlock()
+		select {
+		case <-removed:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// push adds it and wakes takers; q.mu held
+func (q *BlockingQueue[T]) push(it item[T]) {
+	it.seq = q.seq
+	q.seq++
+	heap.Push(&q.items, it)
+	q.stats.Put++
+	q.stats.HighWater = max(q.stats.HighWater, len(q.items))
+	if q.takeWaits {
+		close(q.added)
+		q.added = make(chan struct{})
+		q.takeWaits = false
+	}
+}
+
+// lowest finds the item DropLowest would evict: lowest priority, and
+// newest among those, so older items at that priority keep their
+// place. It is a leaf, but any leaf can be it, so it is a scan; q.mu
+// held
+func (q *BlockingQueue[T]) lowest() int {
+	low := len(q.items) / 2 // the first leaf
+	for i := low + 1; i < len(q.items); i++ {
+		a, b := q.items[i], q.items[low]
+		if a.prio < b.prio || a.prio == b.prio && a.seq > b.seq {
+			low = i
+		}
+	}
+	return low
+}
+
+// Take removes and returns the highest-priority item, waiting for one
+// if the queue is empty. Once the queue is closed, Take returns what is
+// left and then ErrClosed
+func (q *BlockingQueue[T]) Take(ctx context.Context) (T, error) {
+	for {
+		q.mu.Lock()
+		if len(q.items) > 0 {
+			v := q.pop()
+			q.mu.Unlock()
+			return v, nil
+		}
+		if q.closed {
+			q.mu.Unlock()
+			var zero T
+			return zero, ErrClosed
+		}
+		added := q.added
+		q.takeWaits = true
+		q.mu.Unlock()
+		select {
+		case <-added:
+		case <-ctx.Done():
+			var zero T
+			return zero, ctx.Err()
+		}
+	}
+}
+
+// TryTake is Take without the wait
+func (q *BlockingQueue[T]) TryTake() (T, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if len(q.items) == 0 {
+		var zero T
+		return zero, false
+	}
+	return q.pop(), true
+}
+
+// pop removes the top item and wakes blocked producers; q.mu held
+func (q *BlockingQueue[T]) pop() T {
+	it := heap.Pop(&q.items).(item[T])
+	q.stats.Taken++
+	if q.putWaits && !q.closed { // after Close, removed stays closed
+		close(q.removed)
+		q.removed = make(chan struct{})
+		q.putWaits = false
+	}
+	return it.v
+}
+
+// Close stops Puts. Items already queued can still be taken; waiting
+// Puts return ErrClosed, and waiting Takes do once the queue is empty
+func (q *BlockingQueue[T]) Close() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.closed {
+		return
+	}
+	q.closed = true
+	close(q.added)
+	close(q.removed)
+}
+
+func (q *BlockingQueue[T]) Len() int {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return len(q.items)
+}
+
+func (q *BlockingQueue[T]) Stats() Stats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	st := q.stats
+	st.Len = len(q.items)
+	return st
+}
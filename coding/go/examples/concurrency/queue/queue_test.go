@@ -0,0 +1,254 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+type put struct {
+	v    string
+	prio int
+}
+
+// fill puts items into q in order, failing t on any error
+func fill(t *testing.T, q *BlockingQueue[string], items ...put) {
+	t.Helper()
+	for _, it := range items {
+		if err := q.Put(context.Background(), it.v, it.prio); err != nil {
+			t.Fatalf("Put(%s): %v", it.v, err)
+		}
+	}
+}
+
+// drain takes everything queued, without waiting
+func drain(q *BlockingQueue[string]) []string {
+	var got []string
+	for {
+		v, ok := q.TryTake()
+		if !ok {
+			return got
+		}
+		got = append(got, v)
+	}
+}
+
+func TestPriorityOrder(t *testing.T) {
+	q := New[string](Config{})
+	fill(t, q,
+		put{"low-1", 0}, put{"high-1", 9}, put{"mid-1", 5},
+		put{"low-2", 0}, put{"high-2", 9}, put{"mid-2", 5}, put{"neg", -1},
+	)
+	want := []string{"high-1", "high-2", "mid-1", "mid-2", "low-1", "low-2", "neg"}
+	if got := drain(q); !slices.Equal(got, want) {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestFullPolicies(t *testing.T) {
+	// A queue of 3 holding low-a (0), mid (5), low-b (0) gets one more
+	tests := []struct {
+		policy   Policy
+		incoming put
+		err      error
+		want     []string
+		dropped  uint64
+	}{
+		{DropNewest, put{"new", 9}, nil, []string{"mid", "low-a", "low-b"}, 1},
+		// The newest of the lowest goes, so low-a keeps its place
+		{DropLowest, put{"new", 9}, nil, []string{"new", "mid", "low-a"}, 1},
+		// Nothing lower than the newcomer: it is the one dropped
+		{DropLowest, put{"new", 0}, nil, []string{"mid", "low-a", "low-b"}, 1},
+		{Reject, put{"new", 9}, ErrFull, []string{"mid", "low-a", "low-b"}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s/prio-%d", tt.policy, tt.incoming.prio), func(t *testing.T) {
+			q := New[string](Config{Capacity: 3, Policy: tt.policy})
+			fill(t, q, put{"low-a", 0}, put{"mid", 5}, put{"low-b", 0})
+			if err := q.Put(context.Background(), tt.incoming.v, tt.incoming.prio); !errors.Is(err, tt.err) {
+				t.Errorf("Put = %v, want %v", err, tt.err)
+			}
+			st := q.Stats()
+			if st.Dropped != tt.dropped || st.Len != 3 {
+				t.Errorf("stats %+v, want %d dropped and 3 queued", st, tt.dropped)
+			}
+			if got := drain(q); !slices.Equal(got, tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBlockWaitsForRoom(t *testing.T) {
+	q := New[string](Config{Capacity: 1})
+	fill(t, q, put{"first", 0})
+
+	done := make(chan error)
+	go func() { done <- q.Put(context.Background(), "second", 0) }()
+	select {
+	case err := <-done:
+		t.Fatalf("Put into a full queue returned %v without waiting", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	if v, _ := q.Take(context.Background()); v != "first" {
+		t.Errorf("Take = %q, want first", v)
+	}
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if v, _ := q.Take(context.Background()); v != "second" {
+		t.Errorf("Take = %q, want second", v)
+	}
+	if st := q.Stats(); st.Waited != 1 || st.HighWater != 1 {
+		t.Errorf("stats %+v, want 1 wait and a high water of 1", st)
+	}
+}
+
+func TestContextCancel(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	q := New[string](Config{Capacity: 1})
+	if _, err := q.Take(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Take on empty = %v, want DeadlineExceeded", err)
+	}
+	fill(t, q, put{"x", 0})
+	if err := q.Put(ctx, "y", 0); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Put on full = %v, want DeadlineExceeded", err)
+	}
+	if n := q.Len(); n != 1 {
+		t.Errorf("Len = %d, want 1", n)
+	}
+}
+
+func TestClose(t *testing.T) {
+	q := New[string](Config{Capacity: 2})
+	fill(t, q, put{"a", 0}, put{"b", 0})
+
+	blockedPut := make(chan error)
+	go func() { blockedPut <- q.Put(context.Background(), "c", 0) }()
+	time.Sleep(10 * time.Millisecond)
+	q.Close()
+	q.Close() // twice is fine
+	if err := <-blockedPut; !errors.Is(err, ErrClosed) {
+		t.Errorf("waiting Put = %v, want ErrClosed", err)
+	}
+
+	// What was queued is still delivered, then ErrClosed
+	for _, want := range []string{"a", "b"} {
+		if v, err := q.Take(context.Background()); v != want || err != nil {
+			t.Errorf("Take = %q, %v; want %q", v, err, want)
+		}
+	}
+	if _, err := q.Take(context.Background()); !errors.Is(err, ErrClosed) {
+		t.Errorf("Take on closed and empty = %v, want ErrClosed", err)
+	}
+	if err := q.Put(context.Background(), "d", 0); !errors.Is(err, ErrClosed) {
+		t.Errorf("Put after Close = %v, want ErrClosed", err)
+	}
+}
+
+func TestCloseWakesTakers(t *testing.T) {
+	q := New[string](Config{})
+	errs := make(chan error, 3)
+	for range 3 {
+		go func() {
+			_, err := q.Take(context.Background())
+			errs <- err
+		}()
+	}
+	time.Sleep(10 * time.Millisecond)
+	q.Close()
+	for range 3 {
+		if err := <-errs; !errors.Is(err, ErrClosed) {
+			t.Errorf("Take = %v, want ErrClosed", err)
+		}
+	}
+}
+
+func TestConcurrent(t *testing.T) {
+	// Run with -race. A small queue keeps producers blocking
+	const producers, consumers, each = 4, 3, 2000
+	q := New[int](Config{Capacity: 8})
+	var pwg, cwg sync.WaitGroup
+	for p := range producers {
+		pwg.Add(1)
+		go func() {
+			defer pwg.Done()
+			for i := range each {
+				if err := q.Put(context.Background(), p*each+i, i%3); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}()
+	}
+	seen := make([][]int, consumers)
+	for c := range consumers {
+		cwg.Add(1)
+		go func() {
+			defer cwg.Done()
+			for {
+				v, err := q.Take(context.Background())
+				if err != nil {
+					return
+				}
+				seen[c] = append(seen[c], v)
+			}
+		}()
+	}
+	pwg.Wait()
+	q.Close()
+	cwg.Wait()
+
+	all := slices.Concat(seen...)
+	slices.Sort(all)
+	for i, v := range all {
+		if v != i {
+			t.Fatalf("took %d items, want each of %d exactly once", len(all), producers*each)
+		}
+	}
+	if len(all) != producers*each {
+		t.Errorf("took %d items, want %d", len(all), producers*each)
+	}
+	if st := q.Stats(); st.Put != producers*each || st.Taken != producers*each || st.HighWater > 8 {
+		t.Errorf("stats %+v", st)
+	}
+}
+
+// ============================================================
+// Benchmarks
+// ============================================================
+
+// BenchmarkPutTake is one producer and one consumer through the queue,
+// against a buffered channel of the same size: the price of priorities
+// and policies over a plain FIFO
+func BenchmarkPutTake(b *testing.B) {
+	const size = 64
+	b.Run("queue", func(b *testing.B) {
+		q := New[int](Config{Capacity: size})
+		ctx := context.Background()
+		go func() {
+			for i := range b.N {
+				q.Put(ctx, i, i%4)
+			}
+		}()
+		for range b.N {
+			q.Take(ctx)
+		}
+	})
+	b.Run("chan", func(b *testing.B) {
+		ch := make(chan int, size)
+		go func() {
+			for i := range b.N {
+				ch <- i
+			}
+		}()
+		for range b.N {
+			<-ch
+		}
+	})
+}
@@ -0,0 +1,76 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// TokenBucket holds up to burst tokens and refills at rate tokens per
+// second. Each event spends one. Tokens are not topped up by a timer:
+// the refill since the last call is worked out from the clock, so an
+// idle bucket costs nothing.
+type TokenBucket struct {
+	rate  float64 // tokens per second
+	burst float64
+	now   func() time.Time
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+// NewTokenBucket returns a full bucket. rate is events per second on
+// average, burst the most allowed at once.
+func NewTokenBucket(rate float64, burst int) *TokenBucket {
+	return newTokenBucket(rate, burst, time.Now)
+}
+
+func newTokenBucket(rate float64, burst int, now func() time.Time) *TokenBucket {
+	if rate <= 0 || burst <= 0 {
+		panic("ratelimit: rate and burst must be positive")
+	}
+	return &TokenBucket{rate: rate, burst: float64(burst), now: now, tokens: float64(burst), last: now()}
+}
+
+// Every converts an interval into a rate: Every(100*time.Millisecond)
+// is 10 per second
+func Every(interval time.Duration) float64 {
+	return float64(time.Second) / float64(interval)
+}
+
+func (b *TokenBucket) Limit() int { return int(b.burst) }
+
+// refill adds what has dripped in since last; b.mu held
+func (b *TokenBucket) refill(now time.Time) {
+	if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = math.Min(b.burst, b.tokens+elapsed.Seconds()*b.rate)
+	}
+	b.last = now
+}
+
+func (b *TokenBucket) Take(n int) Result {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill(b.now())
+
+	need := float64(n)
+	if need > b.burst {
+		return Result{RetryAfter: -1} // never; WaitN checks Limit first
+	}
+	if b.tokens >= need {
+		b.tokens -= need
+		return Result{Allowed: true, Remaining: int(b.tokens)}
+	}
+	missing := need - b.tokens
+	wait := time.Duration(math.Ceil(missing / b.rate * float64(time.Second)))
+	return Result{Remaining: int(b.tokens), RetryAfter: wait}
+}
+
+// Tokens reports the tokens available now, for metrics and headers
+func (b *TokenBucket) Tokens() float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill(b.now())
+	return b.tokens
+}
@@ -0,0 +1,143 @@
+package ratelimit
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"time"
+)
+
+// Keyed holds a limiter per key, made on first use by newLimiter.
+//
+// Without eviction every IP that ever sent a request keeps a limiter
+// forever, and an attacker with many source addresses can fill memory.
+// Two limits stop that:
+//   - maxKeys caps the map; adding one more drops the least recently
+//     used key
+//   - idle keys (unused for ttl) are dropped by Sweep
+//
+// Dropping a key forgets its history, so the next request from it gets
+// a fresh, full limiter. That is only harmless if the old one would
+// have refilled by then: keep ttl at least burst/rate for a TokenBucket
+// and 2*window for a SlidingWindow. A too-small maxKeys has the same
+// problem under load, which is the price of bounding memory.
+type Keyed[L Limiter] struct {
+	newLimiter func() L
+	maxKeys    int
+	ttl        time.Duration
+	now        func() time.Time
+
+	mu    sync.Mutex
+	keys  map[string]*list.Element
+	order *list.List // of *keyedEntry, most recently used at the front
+
+	evicted int
+}
+
+type keyedEntry[L Limiter] struct {
+	key      string
+	limiter  L
+	lastUsed time.Time
+}
+
+// NewKeyed returns a Keyed of at most maxKeys limiters that drops keys
+// unused for ttl. maxKeys <= 0 means no cap, ttl <= 0 no idle expiry.
+func NewKeyed[L Limiter](newLimiter func() L, maxKeys int, ttl time.Duration) *Keyed[L] {
+	return &Keyed[L]{
+		newLimiter: newLimiter,
+		maxKeys:    maxKeys,
+		ttl:        ttl,
+		now:        time.Now,
+		keys:       make(map[string]*list.Element),
+		order:      list.New(),
+	}
+}
+
+// Get returns key's limiter, making it if needed, and marks it used
+func (k *Keyed[L]) Get(key string) L {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	now := k.now()
+	if el, ok := k.keys[key]; ok {
+		e := el.Value.(*keyedEntry[L])
+		e.lastUsed = now
+		k.order.MoveToFront(el)
+		return e.limiter
+	}
+	if k.maxKeys > 0 && len(k.keys) >= k.maxKeys {
+		k.removeLocked(k.order.Back())
+	}
+	e := &keyedEntry[L]{key: key, limiter: k.newLimiter(), lastUsed: now}
+	k.keys[key] = k.order.PushFront(e)
+	return e.limiter
+}
+
+// Take is Get(key).Take(n)
+func (k *Keyed[L]) Take(key string, n int) Result {
+	return k.Get(key).Take(n)
+}
+
+// Allow is Get(key).Take(1).Allowed
+func (k *Keyed[L]) Allow(key string) bool {
+	return k.Take(key, 1).Allowed
+}
+
+// Wait blocks until key's limiter allows one event or ctx is done
+func (k *Keyed[L]) Wait(ctx context.Context, key string) error {
+	return WaitN(ctx, k.Get(key), 1)
+}
+
+func (k *Keyed[L]) removeLocked(el *list.Element) {
+	e := k.order.Remove(el).(*keyedEntry[L])
+	delete(k.keys, e.key)
+	k.evicted++
+}
+
+// Sweep drops keys unused for ttl and returns how many. The list is in
+// use order, so it walks from the back and stops at the first live key
+func (k *Keyed[L]) Sweep() int {
+	if k.ttl <= 0 {
+		return 0
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	cutoff := k.now().Add(-k.ttl)
+	n := 0
+	for el := k.order.Back(); el != nil; el = k.order.Back() {
+		if el.Value.(*keyedEntry[L]).lastUsed.After(cutoff) {
+			break
+		}
+		k.removeLocked(el)
+		n++
+	}
+	return n
+}
+
+// SweepEvery runs Sweep every d until ctx is done. Run it in its own
+// goroutine
+func (k *Keyed[L]) SweepEvery(ctx context.Context, d time.Duration) {
+	t := time.NewTicker(d)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			k.Sweep()
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Len is the number of keys held
+func (k *Keyed[L]) Len() int {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return len(k.keys)
+}
+
+// Evicted is how many keys have been dropped, by the cap or by Sweep
+func (k *Keyed[L]) Evicted() int {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	return k.evicted
+}
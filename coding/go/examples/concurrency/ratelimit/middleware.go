@@ -0,0 +1,80 @@
+package ratelimit
+
+import (
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+)
+
+// ClientIP is the default key for Middleware: the peer's address
+// without the port. Behind a reverse proxy every request comes from the
+// proxy, so pass a key function that reads X-Forwarded-For instead -
+// but only from a proxy you trust, since clients can set it too
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// Middleware answers 429 Too Many Requests when key(r)'s limiter says
+// no, and passes the request on otherwise. key nil means ClientIP.
+// Every response gets X-RateLimit-Remaining; 429s also get Retry-After
+// in whole seconds, rounded up so a client that obeys it succeeds
+func Middleware[L Limiter](k *Keyed[L], key func(*http.Request) string, next http.Handler) http.Handler {
+	if key == nil {
+		key = ClientIP
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		res := k.Take(key(r), 1)
+		w.Header().Set("X-RateLimit-Remaining", strconv.Itoa(res.Remaining))
+		if !res.Allowed {
+			secs := int(math.Ceil(res.RetryAfter.Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(max(1, secs)))
+			http.Error(w, "rate limit exceeded", http.StatusTooManyRequests)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// Listener limits how often each remote IP may connect. Connections
+// over the limit are closed straight after accept, before the server
+// sees them, which is all a TCP server can do: the handshake has
+// already happened in the kernel
+type Listener[L Limiter] struct {
+	net.Listener
+	Keyed *Keyed[L]
+	// Rejected, if set, is called with each connection before it is
+	// closed, e.g. to log it or write a "busy" line
+	Rejected func(net.Conn)
+}
+
+func (l *Listener[L]) Accept() (net.Conn, error) {
+	for {
+		c, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+		if l.Keyed.Allow(remoteIP(c.RemoteAddr())) {
+			return c, nil
+		}
+		if l.Rejected != nil {
+			l.Rejected(c)
+		}
+		c.Close()
+	}
+}
+
+func remoteIP(a net.Addr) string {
+	if tcp, ok := a.(*net.TCPAddr); ok {
+		return tcp.IP.String()
+	}
+	host, _, err := net.SplitHostPort(a.String())
+	if err != nil {
+		return a.String()
+	}
+	return host
+}
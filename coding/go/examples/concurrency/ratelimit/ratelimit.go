@@ -0,0 +1,86 @@
+// Package ratelimit limits how often something may happen: requests
+// per client, connections per IP, messages per user.
+//
+// Two algorithms, behind one interface:
+//   - TokenBucket allows bursts up to a size, then a steady rate. Good
+//     for APIs: a client that was quiet may catch up a little.
+//   - SlidingWindow allows at most N events in any window of length W,
+//     approximated from two fixed windows so it needs no per-event log.
+//     Good for quotas stated as "100 per minute".
+//
+// Keyed holds one limiter per key (IP, user, API token) and evicts the
+// ones that have gone idle, so a flood of distinct keys can't grow it
+// without bound. Middleware and Listener plug a Keyed into net/http and
+// net.Listener.
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// Result is the outcome of a Take
+type Result struct {
+	Allowed bool
+	// Remaining is how many more events would be allowed right now
+	Remaining int
+	// RetryAfter is how long until the same request would be allowed;
+	// zero when Allowed. It is what a 429's Retry-After header wants
+	RetryAfter time.Duration
+}
+
+// Limiter is what TokenBucket and SlidingWindow have in common
+type Limiter interface {
+	// Take asks for n events now and consumes them if allowed
+	Take(n int) Result
+	// Limit is the most events one Take can ever be granted
+	Limit() int
+}
+
+var (
+	// ErrExceedsLimit means the request is larger than the limiter
+	// could ever grant, so waiting is pointless
+	ErrExceedsLimit = errors.New("ratelimit: request exceeds limiter capacity")
+	// ErrWouldExceedDeadline means the wait needed is longer than the
+	// context allows; returned at once instead of sleeping first
+	ErrWouldExceedDeadline = errors.New("ratelimit: wait would exceed context deadline")
+)
+
+// Allow is Take(1).Allowed
+func Allow(l Limiter) bool {
+	return l.Take(1).Allowed
+}
+
+// Wait blocks until l allows one event or ctx is done
+func Wait(ctx context.Context, l Limiter) error {
+	return WaitN(ctx, l, 1)
+}
+
+// WaitN blocks until l allows n events or ctx is done. Waiters are not
+// queued: when several wait on one limiter, whoever retries first after
+// tokens appear wins
+func WaitN(ctx context.Context, l Limiter, n int) error {
+	if n > l.Limit() {
+		return ErrExceedsLimit
+	}
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		r := l.Take(n)
+		if r.Allowed {
+			return nil
+		}
+		if dl, ok := ctx.Deadline(); ok && time.Until(dl) < r.RetryAfter {
+			return ErrWouldExceedDeadline
+		}
+		t := time.NewTimer(r.RetryAfter)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,332 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// clock stands in for time.Now: the limiters only ever ask it the
+// time, and a test moves it forward by exactly the refill or window
+// step it wants to check. The start is on a minute boundary, so a
+// one-minute window starts with the test instead of partway through.
+// Every fake-clock test runs on one goroutine, so there is no lock
+type clock struct{ t time.Time }
+
+func newClock() *clock {
+	return &clock{t: time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)}
+}
+
+func (c *clock) now() time.Time { return c.t }
+
+func (c *clock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func TestTokenBucket(t *testing.T) {
+	c := newClock()
+	b := newTokenBucket(10, 5, c.now) // 10/s, burst 5
+
+	// step is: advance the clock, Take(n), expect the outcome
+	steps := []struct {
+		advance    time.Duration
+		n          int
+		allowed    bool
+		remaining  int
+		retryAfter time.Duration
+	}{
+		{0, 1, true, 4, 0},
+		{0, 4, true, 0, 0},
+		{0, 1, false, 0, 100 * time.Millisecond},
+		{50 * time.Millisecond, 1, false, 0, 50 * time.Millisecond}, // half a token so far
+		{50 * time.Millisecond, 1, true, 0, 0},
+		{0, 3, false, 0, 300 * time.Millisecond},
+		{time.Hour, 5, true, 0, 0}, // refill stops at burst
+		{0, 6, false, 0, -1},       // more than burst: never
+	}
+	for i, s := range steps {
+		c.advance(s.advance)
+		got := b.Take(s.n)
+		want := Result{Allowed: s.allowed, Remaining: s.remaining, RetryAfter: s.retryAfter}
+		if got != want {
+			t.Errorf("step %d: Take(%d) = %+v, want %+v", i, s.n, got, want)
+		}
+	}
+}
+
+func TestTokenBucketRate(t *testing.T) {
+	// Over a long run the bucket lets through burst + rate*elapsed
+	c := newClock()
+	b := newTokenBucket(Every(100*time.Millisecond), 3, c.now)
+	allowed := 0
+	for range 1000 {
+		if Allow(b) {
+			allowed++
+		}
+		c.advance(10 * time.Millisecond)
+	}
+	// 10s at 10/s, plus the initial burst
+	if want := 3 + 100; allowed < want-1 || allowed > want {
+		t.Errorf("allowed %d in 10s, want about %d", allowed, want)
+	}
+}
+
+func TestSlidingWindow(t *testing.T) {
+	c := newClock()
+	w := newSlidingWindow(10, time.Minute, c.now)
+
+	for i := range 10 {
+		if !Allow(w) {
+			t.Fatalf("event %d of 10 refused", i+1)
+		}
+	}
+	r := w.Take(1)
+	// In the next window these 10 still count for 10*(1-t/60s), which
+	// leaves room for one more at t = 6s
+	if r.Allowed || r.RetryAfter != 66*time.Second {
+		t.Fatalf("11th event: %+v, want refused for 66s", r)
+	}
+
+	// A quarter into the next window, 3/4 of the previous 10 still count
+	c.advance(75 * time.Second)
+	r = w.Take(3)
+	if r.Allowed {
+		t.Fatalf("Take(3) with 7.5 of 10 used: %+v, want refused", r)
+	}
+	// 10*(1-t/60s) <= 7 at t = 18s, 3s from now
+	if r.RetryAfter != 3*time.Second {
+		t.Errorf("RetryAfter = %v, want 3s", r.RetryAfter)
+	}
+	c.advance(r.RetryAfter)
+	if r := w.Take(3); !r.Allowed {
+		t.Errorf("Take(3) after RetryAfter: %+v, want allowed", r)
+	}
+
+	// Idle for more than two windows forgets everything
+	c.advance(3 * time.Minute)
+	if r := w.Take(10); !r.Allowed || r.Remaining != 0 {
+		t.Errorf("Take(10) after idling: %+v, want allowed with 0 left", r)
+	}
+	if r := w.Take(11); r.Allowed || r.RetryAfter >= 0 {
+		t.Errorf("Take(11) on a limit of 10: %+v, want never", r)
+	}
+}
+
+func TestSlidingWindowNeverOverLimit(t *testing.T) {
+	// Check the property directly: at no point do more than limit
+	// events fall inside any window, wherever that window starts
+	c := newClock()
+	const limit, window = 20, time.Second
+	w := newSlidingWindow(limit, window, c.now)
+	var times []time.Time
+	for range 5000 {
+		if Allow(w) {
+			times = append(times, c.now())
+		}
+		c.advance(7 * time.Millisecond)
+	}
+	for i, start := range times {
+		n := 0
+		for _, t := range times[i:] {
+			if t.Sub(start) >= window {
+				break
+			}
+			n++
+		}
+		// The estimate assumes the previous window was evenly spread,
+		// so a burst at its end can let a little extra through
+		if n > limit+limit/4 {
+			t.Fatalf("%d events in the window starting at %v, limit %d", n, start, limit)
+		}
+	}
+}
+
+func TestWaitN(t *testing.T) {
+	b := NewTokenBucket(Every(20*time.Millisecond), 1)
+	Allow(b) // empty it
+
+	start := time.Now()
+	if err := Wait(context.Background(), b); err != nil {
+		t.Fatalf("Wait: %v", err)
+	}
+	if d := time.Since(start); d < 15*time.Millisecond {
+		t.Errorf("Wait returned after %v, want about 20ms", d)
+	}
+
+	if err := WaitN(context.Background(), b, 2); !errors.Is(err, ErrExceedsLimit) {
+		t.Errorf("WaitN(2) on burst 1 = %v, want ErrExceedsLimit", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	start = time.Now()
+	if err := Wait(ctx, b); !errors.Is(err, ErrWouldExceedDeadline) {
+		t.Errorf("Wait with a 5ms deadline = %v, want ErrWouldExceedDeadline", err)
+	}
+	if d := time.Since(start); d > 5*time.Millisecond {
+		t.Errorf("Wait took %v to give up, want at once", d)
+	}
+
+	ctx, cancel = context.WithCancel(context.Background())
+	cancel()
+	if err := Wait(ctx, b); !errors.Is(err, context.Canceled) {
+		t.Errorf("Wait on a canceled context = %v, want context.Canceled", err)
+	}
+}
+
+func TestKeyed(t *testing.T) {
+	c := newClock()
+	k := NewKeyed(func() *TokenBucket { return newTokenBucket(1, 2, c.now) }, 3, time.Minute)
+	k.now = c.now
+
+	// Each key has its own budget
+	for _, key := range []string{"a", "a", "b", "b"} {
+		if !k.Allow(key) {
+			t.Fatalf("%s refused within its burst", key)
+		}
+	}
+	if k.Allow("a") {
+		t.Fatal("a allowed past its burst")
+	}
+
+	// The cap drops the least recently used key: a was used after b
+	c.advance(time.Second)
+	k.Allow("a")
+	k.Allow("c")
+	k.Allow("d")
+	if k.Len() != 3 || k.Evicted() != 1 {
+		t.Fatalf("Len %d, Evicted %d; want 3 and 1", k.Len(), k.Evicted())
+	}
+	k.mu.Lock()
+	_, hasB := k.keys["b"]
+	k.mu.Unlock()
+	if hasB {
+		t.Error("b should have been evicted as least recently used")
+	}
+
+	// Sweep drops keys idle for the TTL and keeps the rest
+	c.advance(50 * time.Second)
+	k.Allow("d")
+	c.advance(20 * time.Second)
+	if n := k.Sweep(); n != 2 {
+		t.Errorf("Sweep dropped %d, want 2 (a and c)", n)
+	}
+	if k.Len() != 1 {
+		t.Errorf("Len after Sweep = %d, want 1", k.Len())
+	}
+}
+
+func TestKeyedConcurrent(t *testing.T) {
+	k := NewKeyed(func() *SlidingWindow { return NewSlidingWindow(100, time.Hour) }, 0, 0)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	allowed := map[string]int{}
+	for g := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range 500 {
+				key := fmt.Sprint("k", (g+i)%4)
+				if k.Allow(key) {
+					mu.Lock()
+					allowed[key]++
+					mu.Unlock()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	for key, n := range allowed {
+		if n != 100 {
+			t.Errorf("%s: %d allowed, want exactly 100", key, n)
+		}
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	k := NewKeyed(func() *TokenBucket { return NewTokenBucket(Every(time.Minute), 2) }, 0, 0)
+	h := Middleware(k, nil, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		remote     string
+		code       int
+		remaining  string
+		retryAfter string
+	}{
+		{"192.0.2.1:1000", http.StatusNoContent, "1", ""},
+		{"192.0.2.1:1001", http.StatusNoContent, "0", ""}, // other port, same client
+		{"192.0.2.1:1002", http.StatusTooManyRequests, "0", "60"},
+		{"192.0.2.2:1000", http.StatusNoContent, "1", ""},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = tt.remote
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, req)
+		if rec.Code != tt.code ||
+			rec.Header().Get("X-RateLimit-Remaining") != tt.remaining ||
+			rec.Header().Get("Retry-After") != tt.retryAfter {
+			t.Errorf("%s: %d remaining=%q retry-after=%q, want %d %q %q", tt.remote, rec.Code,
+				rec.Header().Get("X-RateLimit-Remaining"), rec.Header().Get("Retry-After"),
+				tt.code, tt.remaining, tt.retryAfter)
+		}
+	}
+}
+
+// ============================================================
+// Benchmarks
+// ============================================================
+
+func BenchmarkTokenBucket(b *testing.B) {
+	l := NewTokenBucket(1e9, 1e9)
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			l.Take(1)
+		}
+	})
+}
+
+func BenchmarkSlidingWindow(b *testing.B) {
+	l := NewSlidingWindow(1e9, time.Second)
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			l.Take(1)
+		}
+	})
+}
+
+// One shared lock for the whole map is the cost of Keyed; compare with
+// a single limiter above
+func BenchmarkKeyed(b *testing.B) {
+	for _, keys := range []int{1, 1000, 100_000} {
+		b.Run(fmt.Sprint(keys, "keys"), func(b *testing.B) {
+			k := NewKeyed(func() *TokenBucket { return NewTokenBucket(1e9, 1e9) }, keys, time.Minute)
+			names := make([]string, keys)
+			for i := range names {
+				names[i] = fmt.Sprint("10.0.", i/256, ".", i%256)
+			}
+			b.RunParallel(func(pb *testing.PB) {
+				i := 0
+				for pb.Next() {
+					k.Allow(names[i%keys])
+					i++
+				}
+			})
+		})
+	}
+}
+
+// A cap smaller than the number of clients makes every request evict
+// and allocate
+func BenchmarkKeyedChurn(b *testing.B) {
+	k := NewKeyed(func() *TokenBucket { return NewTokenBucket(10, 10) }, 100, time.Minute)
+	b.ReportAllocs()
+	for i := range b.N {
+		k.Allow(fmt.Sprint(i % 1000))
+	}
+}
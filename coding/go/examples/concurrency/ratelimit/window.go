@@ -0,0 +1,109 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+)
+
+// SlidingWindow allows at most limit events in any window of the
+// given length. Keeping every event's timestamp would be exact but
+// costs memory per event; instead it counts events in fixed windows
+// and estimates the sliding one as
+//
+//	previous * (time left of the sliding window inside previous) + current
+//
+// which assumes the previous window's events were spread evenly. The
+// error is small in practice and it never lets more than limit through
+// within one fixed window.
+type SlidingWindow struct {
+	limit  int
+	window time.Duration
+	now    func() time.Time
+
+	mu       sync.Mutex
+	start    time.Time // start of the current fixed window
+	current  int
+	previous int
+}
+
+func NewSlidingWindow(limit int, window time.Duration) *SlidingWindow {
+	return newSlidingWindow(limit, window, time.Now)
+}
+
+func newSlidingWindow(limit int, window time.Duration, now func() time.Time) *SlidingWindow {
+	if limit <= 0 || window <= 0 {
+		panic("ratelimit: limit and window must be positive")
+	}
+	return &SlidingWindow{limit: limit, window: window, now: now, start: now().Truncate(window)}
+}
+
+func (w *SlidingWindow) Limit() int { return w.limit }
+
+// advance rolls the fixed windows forward to now; w.mu held
+func (w *SlidingWindow) advance(now time.Time) {
+	elapsed := now.Sub(w.start)
+	switch {
+	case elapsed < w.window:
+		return
+	case elapsed < 2*w.window:
+		w.previous, w.current = w.current, 0
+		w.start = w.start.Add(w.window)
+	default:
+		// Idle for more than a whole window: nothing carries over
+		w.previous, w.current = 0, 0
+		w.start = now.Truncate(w.window)
+	}
+}
+
+// weight is the share of the previous window still inside the sliding
+// one
+func (w *SlidingWindow) weight(now time.Time) float64 {
+	return 1 - float64(now.Sub(w.start))/float64(w.window)
+}
+
+func (w *SlidingWindow) Take(n int) Result {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	now := w.now()
+	w.advance(now)
+	if n > w.limit {
+		return Result{RetryAfter: -1}
+	}
+
+	used := float64(w.previous)*w.weight(now) + float64(w.current)
+	if used+float64(n) <= float64(w.limit) {
+		w.current += n
+		return Result{Allowed: true, Remaining: w.limit - int(used) - n}
+	}
+	return Result{Remaining: max(0, w.limit-int(used)), RetryAfter: w.retryAfter(now, n)}
+}
+
+// retryAfter finds when n more events would fit. Within this window
+// only the previous window's share shrinks, linearly, so solve for it;
+// if even an empty previous share isn't enough, the answer is the
+// start of the next window, where current becomes previous
+func (w *SlidingWindow) retryAfter(now time.Time, n int) time.Duration {
+	free := w.limit - w.current - n
+	if w.previous > 0 && free >= 0 {
+		// previous * (1 - t/window) <= free  =>  t >= window * (1 - free/previous)
+		t := ceilFraction(w.window, w.previous-free, w.previous)
+		if d := w.start.Add(t).Sub(now); d > 0 {
+			return d
+		}
+		return time.Millisecond
+	}
+	next := w.start.Add(w.window)
+	// In the next window current is previous with weight 1 - t/window
+	free = w.limit - n
+	if w.current == 0 || free >= w.current {
+		return next.Sub(now)
+	}
+	t := ceilFraction(w.window, w.current-free, w.current)
+	return next.Add(t).Sub(now)
+}
+
+// ceilFraction is d*num/den rounded up, in integers so that waiting
+// exactly that long is always enough
+func ceilFraction(d time.Duration, num, den int) time.Duration {
+	return (d*time.Duration(num) + time.Duration(den) - 1) / time.Duration(den)
+}
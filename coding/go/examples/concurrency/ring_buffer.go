@@ -0,0 +1,307 @@
+// Lock-Free Ring Buffer - A single-producer, single-consumer queue on atomics
+//
+// A buffered channel is a queue guarded by a lock, with parking and
+// waking of goroutines built in. When exactly one goroutine writes and
+// exactly one reads, neither is needed: the producer owns the tail
+// index, the consumer owns the head, and each only reads the other's.
+// Two atomic loads and one atomic store per item, no lock, no CAS.
+//
+// - Capacity is a power of two, so index&mask replaces index%cap and
+//   the indexes can count up forever (a uint64 won't wrap)
+// - head and tail sit on separate cache lines. If they shared one,
+//   every store by one core would invalidate the other's copy: false
+//   sharing, which can cost more than the lock it replaced
+// - Each side caches the other's index and rereads it only when the
+//   cached value says full (or empty), which is rare when the two run
+//   at similar speeds
+// - Publishing is the atomic store: the producer writes the slot, then
+//   stores tail. Go's atomics are sequentially consistent, so a
+//   consumer that loads the new tail sees the slot's contents
+//
+// The MPMC queue at the end is a sketch of Dmitry Vyukov's bounded
+// queue for many producers and consumers: a sequence number per slot
+// and a CAS to claim it. It works, but it is where lock-free gets hard
+// (and where a channel is usually fast enough).
+//
+// When does it pay? The demo moves items through a channel and both
+// queues. With a real core for each side, the ring avoids the channel's
+// lock and its goroutine wakeups. With one P (GOMAXPROCS=1) it wins
+// too: the producer fills the ring, yields, and the consumer drains it,
+// in big batches. It loses, badly, when spinning goroutines outnumber
+// the CPUs: a side waiting for the other burns the time slice the other
+// needs, where a channel would park it. Run the demo with GOMAXPROCS
+// above your core count to watch that happen.
+//
+// Usage:
+//   go run ring_buffer.go
+//   GOMAXPROCS=1 go run ring_buffer.go
+//   GOMAXPROCS=64 go run ring_buffer.go
+//   go test -race -v ring_buffer.go ring_buffer_test.go
+//   go test -run=^$ -bench=. ring_buffer.go ring_buffer_test.go
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ============================================================
+// SPSC
+// ============================================================
+
+// cacheLinePad keeps what follows it off the preceding cache line. 64
+// bytes covers x86 and most arm64; Apple's M-series use 128
+type cacheLinePad [64]byte
+
+// SPSC is a bounded queue for exactly one producing goroutine and one
+// consuming goroutine. With more of either it corrupts silently
+type SPSC[T any] struct {
+	buf  []T
+	mask uint64
+
+	_          cacheLinePad
+	head       atomic.Uint64 // next slot to read; stored by the consumer
+	cachedTail uint64        // consumer's last look at tail
+	_          cacheLinePad
+	tail       atomic.Uint64 // next slot to write; stored by the producer
+	cachedHead uint64        // producer's last look at head
+	_          cacheLinePad
+}
+
+// NewSPSC returns a queue holding at least size items, rounded up to a
+// power of two
+func NewSPSC[T any](size int) *SPSC[T] {
+	n := 1
+	for n < size {
+		n <<= 1
+	}
+	return &SPSC[T]{buf: make([]T, n), mask: uint64(n - 1)}
+}
+
+// TryPush adds v, or reports false if the queue is full. Producer only
+func (q *SPSC[T]) TryPush(v T) bool {
+	tail := q.tail.Load() // our own index: no one else stores it
+	if tail-q.cachedHead == uint64(len(q.buf)) {
+		q.cachedHead = q.head.Load()
+		if tail-q.cachedHead == uint64(len(q.buf)) {
+			return false
+		}
+	}
+	q.buf[tail&q.mask] = v
+	q.tail.Store(tail + 1) // publishes the slot
+	return true
+}
+
+// TryPop removes the oldest item, or reports false if there is none.
+// Consumer only
+func (q *SPSC[T]) TryPop() (T, bool) {
+	head := q.head.Load()
+	if head == q.cachedTail {
+		q.cachedTail = q.tail.Load()
+		if head == q.cachedTail {
+			var zero T
+			return zero, false
+		}
+	}
+	v := q.buf[head&q.mask]
+	var zero T
+	q.buf[head&q.mask] = zero // don't keep a popped pointer alive
+	q.head.Store(head + 1)    // hands the slot back to the producer
+	return v, true
+}
+
+// Len is a snapshot; by the time it returns it may be wrong
+func (q *SPSC[T]) Len() int {
+	return int(q.tail.Load() - q.head.Load())
+}
+
+// backoff is how a side waits for the other: spin a few times, then
+// yield the processor. There is no parking, so a side that waits long
+// burns CPU; that is the price of never touching the scheduler
+type backoff int
+
+func (b *backoff) wait() {
+	if *b < 16 {
+		*b++
+		return
+	}
+	runtime.Gosched()
+}
+
+// Push adds v, waiting while the queue is full
+func (q *SPSC[T]) Push(v T) {
+	var b backoff
+	for !q.TryPush(v) {
+		b.wait()
+	}
+}
+
+// Pop removes the oldest item, waiting while the queue is empty
+func (q *SPSC[T]) Pop() T {
+	var b backoff
+	for {
+		if v, ok := q.TryPop(); ok {
+			return v
+		}
+		b.wait()
+	}
+}
+
+// ============================================================
+// MPMC (sketch)
+// ============================================================
+
+// mpmcSlot carries a sequence number saying whose turn it is: equal to
+// the position, it is free for the producer claiming that position;
+// position+1, it holds a value for the consumer claiming it
+type mpmcSlot[T any] struct {
+	seq atomic.Uint64
+	v   T
+}
+
+// MPMC is a bounded queue for any number of producers and consumers,
+// after Vyukov. Each side claims a position with a CAS on its index,
+// then waits for that slot's sequence number to say the slot is ready.
+// Left out, as a sketch: padding each slot, blocking with parking, and
+// a producer preempted mid-push, which stalls every consumer behind
+// its slot until it runs again (the reason this is not "wait-free")
+type MPMC[T any] struct {
+	slots []mpmcSlot[T]
+	mask  uint64
+	_     cacheLinePad
+	head  atomic.Uint64
+	_     cacheLinePad
+	tail  atomic.Uint64
+	_     cacheLinePad
+}
+
+func NewMPMC[T any](size int) *MPMC[T] {
+	n := 2
+	for n < size {
+		n <<= 1
+	}
+	q := &MPMC[T]{slots: make([]mpmcSlot[T], n), mask: uint64(n - 1)}
+	for i := range q.slots {
+		q.slots[i].seq.Store(uint64(i))
+	}
+	return q
+}
+
+func (q *MPMC[T]) TryPush(v T) bool {
+	for {
+		pos := q.tail.Load()
+		s := &q.slots[pos&q.mask]
+		switch seq := s.seq.Load(); {
+		case seq == pos: // free for us, if we claim it first
+			if q.tail.CompareAndSwap(pos, pos+1) {
+				s.v = v
+				s.seq.Store(pos + 1) // publish to the consumer of pos
+				return true
+			}
+		case seq < pos: // still holds the value from a lap ago: full
+			return false
+		}
+		// Another producer claimed pos; try again with the new tail
+	}
+}
+
+func (q *MPMC[T]) TryPop() (T, bool) {
+	for {
+		pos := q.head.Load()
+		s := &q.slots[pos&q.mask]
+		switch seq := s.seq.Load(); {
+		case seq == pos+1: // filled for us, if we claim it first
+			if q.head.CompareAndSwap(pos, pos+1) {
+				v := s.v
+				var zero T
+				s.v = zero
+				s.seq.Store(pos + uint64(len(q.slots))) // free for the next lap
+				return v, true
+			}
+		case seq < pos+1: // not filled yet: empty
+			var zero T
+			return zero, false
+		}
+	}
+}
+
+func (q *MPMC[T]) Push(v T) {
+	var b backoff
+	for !q.TryPush(v) {
+		b.wait()
+	}
+}
+
+func (q *MPMC[T]) Pop() T {
+	var b backoff
+	for {
+		if v, ok := q.TryPop(); ok {
+			return v
+		}
+		b.wait()
+	}
+}
+
+// ============================================================
+// Demo: one producer, one consumer, three queues
+// ============================================================
+
+// transfer sends n ints from one goroutine to another through push and
+// pop, checks they arrive in order, and returns the time per item
+func transfer(n int, push func(int), pop func() int) time.Duration {
+	var wg sync.WaitGroup
+	start := time.Now()
+	wg.Go(func() {
+		for i := range n {
+			push(i)
+		}
+	})
+	for i := range n {
+		if v := pop(); v != i {
+			panic(fmt.Sprintf("got %d, want %d", v, i))
+		}
+	}
+	wg.Wait()
+	return time.Since(start) / time.Duration(n)
+}
+
+func main() {
+	const n = 2_000_000
+	const size = 1024
+	fmt.Printf("=== %d ints, producer to consumer, capacity %d, GOMAXPROCS %d ===\n",
+		n, size, runtime.GOMAXPROCS(0))
+
+	ch := make(chan int, size)
+	chanTime := transfer(n, func(v int) { ch <- v }, func() int { return <-ch })
+	fmt.Printf("  %-22s %6v/item\n", "buffered channel", chanTime)
+
+	spsc := NewSPSC[int](size)
+	spscTime := transfer(n, spsc.Push, spsc.Pop)
+	fmt.Printf("  %-22s %6v/item  %.1fx the channel's speed\n", "SPSC ring", spscTime,
+		float64(chanTime)/float64(spscTime))
+
+	mpmc := NewMPMC[int](size)
+	mpmcTime := transfer(n, mpmc.Push, mpmc.Pop)
+	fmt.Printf("  %-22s %6v/item  %.1fx\n", "MPMC ring (1 and 1)", mpmcTime,
+		float64(chanTime)/float64(mpmcTime))
+
+	fmt.Println()
+	switch procs, cpus := runtime.GOMAXPROCS(0), runtime.NumCPU(); {
+	case procs == 1:
+		fmt.Println("  One P: the sides take turns, each running until the ring is full")
+		fmt.Println("  or empty, so items move in batches of up to the capacity.")
+	case procs > cpus:
+		fmt.Printf("  GOMAXPROCS %d, NumCPU %d: a side that spins holds a CPU the other side\n", procs, cpus)
+		fmt.Println("  needs. The channel parks the waiter instead, and wins.")
+	default:
+		fmt.Println("  A core each: both sides run at once and never enter the scheduler.")
+		fmt.Printf("  Try GOMAXPROCS=%d to oversubscribe the CPUs and see it fall apart.\n", 2*cpus)
+	}
+	fmt.Println("  Reach for a ring like this only when a profile shows channel")
+	fmt.Println("  operations on a hot path with one reader and one writer: audio and")
+	fmt.Println("  packet pipelines, tick data. Everywhere else, the channel's blocking,")
+	fmt.Println("  select and close are worth far more than the nanoseconds.")
+}
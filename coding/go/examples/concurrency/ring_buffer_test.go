@@ -0,0 +1,207 @@
+// Lock-Free Ring Buffer Tests - Ordering under -race, wraparound, channel benchmarks
+//
+// The race detector understands sync/atomic, so a missing publish (a
+// plain store where an atomic one is needed) shows up as a race on the
+// slot. Run these with -race; a pass without it proves much less.
+//
+// The benchmarks move b.N ints from one goroutine to another. Compare
+// -cpu values below and above the machine's core count: once spinning
+// goroutines outnumber the cores, the ranking flips.
+//
+// Usage:
+//   go test -race -v ring_buffer.go ring_buffer_test.go
+//   go test -run=^$ -bench=. -cpu=1,4 ring_buffer.go ring_buffer_test.go
+package main
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestSPSCFullAndEmpty(t *testing.T) {
+	q := NewSPSC[int](3) // rounds up to 4
+	if _, ok := q.TryPop(); ok {
+		t.Fatal("TryPop on an empty queue succeeded")
+	}
+	for i := range 4 {
+		if !q.TryPush(i) {
+			t.Fatalf("TryPush(%d) failed with room left", i)
+		}
+	}
+	if q.TryPush(4) {
+		t.Fatal("TryPush on a full queue succeeded")
+	}
+	if n := q.Len(); n != 4 {
+		t.Errorf("Len = %d, want 4", n)
+	}
+	// Around the ring several times, a slot freed and refilled each step
+	for i := range 20 {
+		if v, ok := q.TryPop(); !ok || v != i {
+			t.Fatalf("TryPop = %d, %v; want %d", v, ok, i)
+		}
+		if !q.TryPush(i + 4) {
+			t.Fatalf("TryPush(%d) failed after a pop", i+4)
+		}
+	}
+}
+
+func TestSPSCReleasesPopped(t *testing.T) {
+	q := NewSPSC[*int](2)
+	q.Push(new(int))
+	q.Pop()
+	if q.buf[0] != nil {
+		t.Error("popped pointer still held by the ring")
+	}
+}
+
+func TestSPSCOrder(t *testing.T) {
+	const n = 100_000
+	for _, size := range []int{1, 2, 64} { // 1: every item is a full/empty handoff
+		q := NewSPSC[int](size)
+		var wg sync.WaitGroup
+		wg.Go(func() {
+			for i := range n {
+				q.Push(i)
+			}
+		})
+		for i := range n {
+			if v := q.Pop(); v != i {
+				t.Fatalf("size %d: got %d, want %d", size, v, i)
+			}
+		}
+		wg.Wait()
+		if _, ok := q.TryPop(); ok {
+			t.Errorf("size %d: items left over", size)
+		}
+	}
+}
+
+func TestMPMCFullAndEmpty(t *testing.T) {
+	q := NewMPMC[int](4)
+	for i := range 4 {
+		if !q.TryPush(i) {
+			t.Fatalf("TryPush(%d) failed with room left", i)
+		}
+	}
+	if q.TryPush(4) {
+		t.Fatal("TryPush on a full queue succeeded")
+	}
+	for i := range 4 {
+		if v, ok := q.TryPop(); !ok || v != i {
+			t.Fatalf("TryPop = %d, %v; want %d", v, ok, i)
+		}
+	}
+	if _, ok := q.TryPop(); ok {
+		t.Fatal("TryPop on an empty queue succeeded")
+	}
+}
+
+func TestMPMCExactlyOnce(t *testing.T) {
+	// Every item pushed by any producer is popped by exactly one
+	// consumer, and each producer's items come out in its own order
+	const producers, consumers, each = 4, 4, 20_000
+	q := NewMPMC[int](16)
+
+	var wg sync.WaitGroup
+	for p := range producers {
+		wg.Go(func() {
+			for i := range each {
+				q.Push(p*each + i)
+			}
+		})
+	}
+	got := make([][]int, consumers)
+	var cwg sync.WaitGroup
+	for c := range consumers {
+		cwg.Go(func() {
+			for range producers * each / consumers {
+				got[c] = append(got[c], q.Pop())
+			}
+		})
+	}
+	wg.Wait()
+	cwg.Wait()
+
+	seen := make([]bool, producers*each)
+	for c, vs := range got {
+		last := make([]int, producers) // per producer, within this consumer
+		for p := range last {
+			last[p] = -1
+		}
+		for _, v := range vs {
+			if seen[v] {
+				t.Fatalf("%d popped twice", v)
+			}
+			seen[v] = true
+			p := v / each
+			if v <= last[p] {
+				t.Fatalf("consumer %d saw producer %d's %d after %d", c, p, v, last[p])
+			}
+			last[p] = v
+		}
+	}
+	for v, ok := range seen {
+		if !ok {
+			t.Fatalf("%d never popped", v)
+		}
+	}
+}
+
+// ============================================================
+// Benchmarks
+// ============================================================
+
+func benchTransfer(b *testing.B, push func(int), pop func() int) {
+	var wg sync.WaitGroup
+	wg.Go(func() {
+		for i := range b.N {
+			push(i)
+		}
+	})
+	for range b.N {
+		pop()
+	}
+	wg.Wait()
+}
+
+func BenchmarkTransfer(b *testing.B) {
+	const size = 1024
+	b.Run("chan", func(b *testing.B) {
+		ch := make(chan int, size)
+		benchTransfer(b, func(v int) { ch <- v }, func() int { return <-ch })
+	})
+	b.Run("spsc", func(b *testing.B) {
+		q := NewSPSC[int](size)
+		benchTransfer(b, q.Push, q.Pop)
+	})
+	b.Run("mpmc", func(b *testing.B) {
+		q := NewMPMC[int](size)
+		benchTransfer(b, q.Push, q.Pop)
+	})
+}
+
+// BenchmarkUncontended is one goroutine pushing then popping: the cost
+// of the operations themselves, with no other core in the way
+func BenchmarkUncontended(b *testing.B) {
+	b.Run("chan", func(b *testing.B) {
+		ch := make(chan int, 1)
+		for i := range b.N {
+			ch <- i
+			<-ch
+		}
+	})
+	b.Run("spsc", func(b *testing.B) {
+		q := NewSPSC[int](1)
+		for i := range b.N {
+			q.TryPush(i)
+			q.TryPop()
+		}
+	})
+	b.Run("mpmc", func(b *testing.B) {
+		q := NewMPMC[int](2)
+		for i := range b.N {
+			q.TryPush(i)
+			q.TryPop()
+		}
+	})
+}
@@ -0,0 +1,325 @@
+// Scatter-Gather - Partial results before a deadline
+//
+// A search page asks ten index shards the same question and merges the
+// answers. Waiting for all ten means every page is as slow as the
+// slowest shard, and one dead shard means no page at all. The usual
+// answer: give the whole query a deadline, take whatever has arrived by
+// then, and say which shards are missing so the caller can decide (show
+// "results may be incomplete", retry, or fail if too little came back).
+//
+// This example shows:
+// - Fan-out with one goroutine per backend into a buffered channel, so
+//   a straggler that answers after the deadline never blocks
+// - The deadline as a context: stragglers see it and stop work
+// - Each miss annotated: no answer, failed, or rejected (circuit open,
+//   overloaded), because they call for different reactions
+// - A quorum: below MinResults the answer is an error, not a partial
+// - Returning as soon as everyone has answered, not at the deadline
+// - A sweep over deadlines: how coverage and latency trade off over
+//   200 queries per deadline against backends with long-tail latency
+//
+// Usage:
+//   go run scatter_gather.go
+package main
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ============================================================
+// Simulated backends
+// ============================================================
+
+// Hit is one search result
+type Hit struct {
+	Doc   string
+	Score float64
+}
+
+// backend is one index shard. Its latency is log-normal around median,
+// which gives the long tail real services have; failRate of calls
+// return an error after a short delay
+type backend struct {
+	name     string
+	median   time.Duration
+	sigma    float64 // spread of the tail
+	failRate float64
+	down     bool
+
+	mu  sync.Mutex
+	rng *rand.Rand
+
+	abandoned atomic.Int64 // calls that saw the deadline and stopped
+}
+
+var errOverloaded = errors.New("overloaded")
+
+func (b *backend) draw() (time.Duration, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	d := time.Duration(float64(b.median) * math.Exp(b.rng.NormFloat64()*b.sigma))
+	return d, b.rng.Float64() < b.failRate
+}
+
+func (b *backend) Search(ctx context.Context, query string) ([]Hit, error) {
+	if b.down {
+		return nil, errOverloaded // fails fast, like an open breaker
+	}
+	d, fail := b.draw()
+	if fail {
+		d /= 4
+	}
+	select {
+	case <-time.After(d):
+	case <-ctx.Done():
+		b.abandoned.Add(1)
+		return nil, ctx.Err()
+	}
+	if fail {
+		return nil, fmt.Errorf("%s: index read error", b.name)
+	}
+	hits := make([]Hit, 3)
+	for i := range hits {
+		hits[i] = Hit{
+			Doc:   fmt.Sprintf("%s/doc-%d", b.name, len(query)*7+i),
+			Score: 1 / float64(i+1+len(b.name)%3),
+		}
+	}
+	return hits, nil
+}
+
+func newBackends(n int, seed int64) []*backend {
+	rng := rand.New(rand.NewSource(seed))
+	bs := make([]*backend, n)
+	for i := range bs {
+		bs[i] = &backend{
+			name:     fmt.Sprintf("shard-%02d", i),
+			median:   time.Duration(8+rng.Intn(8)) * time.Millisecond,
+			sigma:    0.6,
+			failRate: 0.03,
+			rng:      rand.New(rand.NewSource(seed + int64(i))),
+		}
+	}
+	return bs
+}
+
+// ============================================================
+// Scatter-gather
+// ============================================================
+
+type MissReason int
+
+const (
+	NoAnswer MissReason = iota // nothing by the deadline, or canceled
+	Failed                     // answered with an error
+	Rejected                   // refused without trying
+)
+
+func (r MissReason) String() string {
+	return [...]string{"no answer", "failed", "rejected"}[r]
+}
+
+type Miss struct {
+	Backend string
+	Reason  MissReason
+	Err     error
+}
+
+// Response is what the gather step returns: the merged hits plus an
+// account of who is missing
+type Response struct {
+	Hits      []Hit
+	Answered  []string
+	Missing   []Miss
+	Took      time.Duration
+	Responded int
+	Asked     int
+}
+
+func (r *Response) Partial() bool { return len(r.Missing) > 0 }
+
+var ErrTooFewResults = errors.New("scatter-gather: too few backends answered")
+
+type Query struct {
+	Text       string
+	Deadline   time.Duration
+	MinResults int // quorum; 0 means any number, even none
+}
+
+type reply struct {
+	backend string
+	hits    []Hit
+	err     error
+}
+
+func ScatterGather(ctx context.Context, backends []*backend, q Query) (*Response, error) {
+	start := time.Now()
+	ctx, cancel := context.WithTimeout(ctx, q.Deadline)
+	defer cancel() // stragglers see this and give up
+
+	// Buffered for every backend: a reply that arrives after we stop
+	// reading still has somewhere to go, so its goroutine can exit
+	replies := make(chan reply, len(backends))
+	for _, b := range backends {
+		go func() {
+			hits, err := b.Search(ctx, q.Text)
+			replies <- reply{b.name, hits, err}
+		}()
+	}
+
+	resp := &Response{Asked: len(backends)}
+	pending := make(map[string]bool, len(backends))
+	for _, b := range backends {
+		pending[b.name] = true
+	}
+
+gather:
+	for len(pending) > 0 {
+		select {
+		case r := <-replies:
+			delete(pending, r.backend)
+			switch {
+			case r.err == nil:
+				resp.Hits = append(resp.Hits, r.hits...)
+				resp.Answered = append(resp.Answered, r.backend)
+				resp.Responded++
+			case errors.Is(r.err, context.DeadlineExceeded):
+				// Raced the deadline and lost: same as not answering
+				resp.Missing = append(resp.Missing, Miss{r.backend, NoAnswer, r.err})
+			case errors.Is(r.err, errOverloaded):
+				resp.Missing = append(resp.Missing, Miss{r.backend, Rejected, r.err})
+			default:
+				resp.Missing = append(resp.Missing, Miss{r.backend, Failed, r.err})
+			}
+		case <-ctx.Done():
+			break gather
+		}
+	}
+	for name := range pending {
+		resp.Missing = append(resp.Missing, Miss{name, NoAnswer, ctx.Err()})
+	}
+	slices.SortFunc(resp.Missing, func(a, b Miss) int { return cmp.Compare(a.Backend, b.Backend) })
+	slices.SortFunc(resp.Hits, func(a, b Hit) int { return cmp.Compare(b.Score, a.Score) })
+	resp.Took = time.Since(start)
+
+	if resp.Responded < q.MinResults {
+		return resp, fmt.Errorf("%w: %d of %d, need %d", ErrTooFewResults, resp.Responded, resp.Asked, q.MinResults)
+	}
+	// The caller's own cancellation is not a partial result, it's an error
+	if err := context.Cause(ctx); err != nil && !errors.Is(err, context.DeadlineExceeded) {
+		return resp, err
+	}
+	return resp, nil
+}
+
+// ============================================================
+// Demos
+// ============================================================
+
+func describe(resp *Response, err error) {
+	status := "complete"
+	if resp.Partial() {
+		status = "PARTIAL"
+	}
+	if err != nil {
+		status = "ERROR: " + err.Error()
+	}
+	fmt.Printf("  %d of %d answered in %v, %d hits, %s\n",
+		resp.Responded, resp.Asked, resp.Took.Round(time.Millisecond), len(resp.Hits), status)
+	for _, m := range resp.Missing {
+		fmt.Printf("    missing %s: %v (%v)\n", m.Backend, m.Reason, m.Err)
+	}
+}
+
+func singleQueries() {
+	backends := newBackends(10, 1)
+	ctx := context.Background()
+
+	fmt.Println("--- generous deadline (200ms): everyone answers, returns early ---")
+	resp, err := ScatterGather(ctx, backends, Query{Text: "golang", Deadline: 200 * time.Millisecond})
+	describe(resp, err)
+
+	fmt.Println("--- tight deadline (12ms): the slow shards miss it ---")
+	resp, err = ScatterGather(ctx, backends, Query{Text: "golang", Deadline: 12 * time.Millisecond})
+	describe(resp, err)
+	time.Sleep(50 * time.Millisecond) // let stragglers notice
+	var abandoned int64
+	for _, b := range backends {
+		abandoned += b.abandoned.Load()
+	}
+	fmt.Printf("  stragglers that saw the deadline and stopped: %d\n", abandoned)
+
+	fmt.Println("--- two shards down, quorum 7 ---")
+	backends[3].down, backends[7].down = true, true
+	resp, err = ScatterGather(ctx, backends, Query{Text: "golang", Deadline: 50 * time.Millisecond, MinResults: 7})
+	describe(resp, err)
+
+	fmt.Println("--- same, with a 9ms deadline: below quorum ---")
+	resp, err = ScatterGather(ctx, backends, Query{Text: "golang", Deadline: 9 * time.Millisecond, MinResults: 7})
+	describe(resp, err)
+	if errors.Is(err, ErrTooFewResults) {
+		fmt.Println("  (the partial response is still returned, for logging or a degraded page)")
+	}
+
+	fmt.Println("--- caller cancels mid-query ---")
+	cctx, cancel := context.WithCancel(ctx)
+	time.AfterFunc(5*time.Millisecond, cancel)
+	resp, err = ScatterGather(cctx, backends, Query{Text: "golang", Deadline: 100 * time.Millisecond})
+	describe(resp, err)
+}
+
+// sweep runs many queries at each deadline and reports how complete the
+// answers were and how long they took
+func sweep() {
+	backends := newBackends(10, 2)
+	const queries = 200
+	fmt.Printf("  %-9s %-15s %-12s %-10s %s\n", "deadline", "avg coverage", "complete", "p50", "p99")
+	for _, deadline := range []time.Duration{10, 15, 20, 30, 50, 100} {
+		deadline *= time.Millisecond
+		var coverage float64
+		complete := 0
+		took := make([]time.Duration, 0, queries)
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		sem := make(chan struct{}, 20) // 20 queries in flight
+		for i := range queries {
+			sem <- struct{}{}
+			wg.Go(func() {
+				defer func() { <-sem }()
+				resp, _ := ScatterGather(context.Background(), backends,
+					Query{Text: fmt.Sprint("q", i), Deadline: deadline})
+				mu.Lock()
+				coverage += float64(resp.Responded) / float64(resp.Asked)
+				if !resp.Partial() {
+					complete++
+				}
+				took = append(took, resp.Took)
+				mu.Unlock()
+			})
+		}
+		wg.Wait()
+		slices.Sort(took)
+		fmt.Printf("  %-9v %5.1f%%          %5.1f%%       %-10v %v\n", deadline,
+			100*coverage/queries, 100*float64(complete)/queries,
+			took[len(took)/2].Round(time.Millisecond), took[len(took)*99/100].Round(time.Millisecond))
+	}
+	fmt.Println("  past about 50ms a longer deadline buys little coverage and costs p99;")
+	fmt.Println("  what's left missing are failures, which no deadline fixes")
+}
+
+func main() {
+	fmt.Println("=== Ten shards, one query ===")
+	singleQueries()
+
+	fmt.Println("\n=== Deadline sweep: 200 queries each ===")
+	sweep()
+}
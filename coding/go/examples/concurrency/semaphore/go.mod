@@ -0,0 +1,5 @@
+module github.com/bellistech/labs/coding/go/examples/concurrency/semaphore
+
+go 1.25.0
+
+require golang.org/x/sync v0.22.0
@@ -0,0 +1,372 @@
+// Weighted Semaphore - Limiting by cost, not by count
+//
+// A buffered channel is the usual Go semaphore: N slots, one per
+// goroutine. That limits how many jobs run, but not how much they use.
+// When jobs differ in cost (memory, connections, CPU cores), the limit
+// has to be weighted. This example runs image-resize jobs of different
+// sizes against a fixed memory budget and shows:
+// - A buffered-channel semaphore with 4 slots: 4 big jobs at once blow
+//   the budget, and 4 small ones leave most of it idle
+// - golang.org/x/sync/semaphore.Weighted: each job acquires its size
+//   in MB, so the budget holds however the sizes mix
+// - Acquire with a context timeout, and TryAcquire, for work that
+//   should give up instead of queueing forever
+// - Weighted is FIFO: a big waiter at the head blocks smaller ones
+//   behind it even when they would fit. That is what keeps big jobs
+//   from starving
+// - Acquiring more than the total blocks until the context ends
+// - A weighted semaphore built from a channel of tokens, and why
+//   taking tokens one at a time deadlocks without a lock around it
+// - What each costs per Acquire/Release pair
+//
+// golang.org/x/sync is outside the standard library, so this example is
+// a module of its own: go.mod and go.sum pin the version.
+//
+// Usage (from this directory):
+//   go run .
+package main
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/semaphore"
+)
+
+// ============================================================
+// Workload
+// ============================================================
+
+const budgetMB = 1024
+
+// job is an image to resize; sizeMB is the memory it needs while it
+// runs
+type job struct {
+	id     int
+	sizeMB int64
+}
+
+// makeJobs returns a mix: mostly thumbnails, some large scans
+func makeJobs(n int) []job {
+	rng := rand.New(rand.NewSource(7))
+	jobs := make([]job, n)
+	for i := range jobs {
+		size := int64(16 + rng.Intn(48))
+		if i%5 == 0 {
+			size = int64(300 + rng.Intn(200))
+		}
+		jobs[i] = job{id: i + 1, sizeMB: size}
+	}
+	return jobs
+}
+
+// meter tracks memory "in use" by running jobs
+type meter struct {
+	inUse   atomic.Int64
+	peak    atomic.Int64
+	running atomic.Int64
+	maxRun  atomic.Int64
+	over    atomic.Int64 // jobs that started while over budget
+}
+
+func raise(v *atomic.Int64, n int64) {
+	for {
+		old := v.Load()
+		if n <= old || v.CompareAndSwap(old, n) {
+			return
+		}
+	}
+}
+
+func (m *meter) run(j job) {
+	used := m.inUse.Add(j.sizeMB)
+	raise(&m.peak, used)
+	raise(&m.maxRun, m.running.Add(1))
+	if used > budgetMB {
+		m.over.Add(1)
+	}
+	// Bigger images take longer
+	time.Sleep(time.Duration(2+j.sizeMB/20) * time.Millisecond)
+	m.running.Add(-1)
+	m.inUse.Add(-j.sizeMB)
+}
+
+func (m *meter) report(name string, elapsed time.Duration) {
+	fmt.Printf("  %-22s peak %4d MB of %d, up to %2d jobs at once, %2d started over budget, %v\n",
+		name, m.peak.Load(), budgetMB, m.maxRun.Load(), m.over.Load(), elapsed.Round(time.Millisecond))
+}
+
+// ============================================================
+// Counting vs weighting
+// ============================================================
+
+func countingSemaphore(jobs []job, slots int) {
+	m := &meter{}
+	sem := make(chan struct{}, slots)
+	var wg sync.WaitGroup
+	start := time.Now()
+	for _, j := range jobs {
+		sem <- struct{}{} // acquire: blocks when all slots are taken
+		wg.Go(func() {
+			defer func() { <-sem }() // release
+			m.run(j)
+		})
+	}
+	wg.Wait()
+	m.report(fmt.Sprintf("chan, %d slots", slots), time.Since(start))
+}
+
+func weightedSemaphore(jobs []job) {
+	m := &meter{}
+	sem := semaphore.NewWeighted(budgetMB)
+	var wg sync.WaitGroup
+	start := time.Now()
+	for _, j := range jobs {
+		// Acquiring in the loop, not in the goroutine, keeps the number
+		// of goroutines bounded too
+		if err := sem.Acquire(context.Background(), j.sizeMB); err != nil {
+			panic(err) // only on ctx cancel, and Background never is
+		}
+		wg.Go(func() {
+			defer sem.Release(j.sizeMB)
+			m.run(j)
+		})
+	}
+	wg.Wait()
+	m.report("Weighted, 1024 MB", time.Since(start))
+}
+
+// ============================================================
+// Giving up: timeouts and TryAcquire
+// ============================================================
+
+func timeouts() {
+	sem := semaphore.NewWeighted(budgetMB)
+	// Something big is holding most of the budget for 200ms
+	sem.Acquire(context.Background(), 900)
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		sem.Release(900)
+	}()
+
+	for _, tc := range []struct {
+		size    int64
+		timeout time.Duration
+	}{{100, 50 * time.Millisecond}, {400, 50 * time.Millisecond}, {400, 500 * time.Millisecond}} {
+		ctx, cancel := context.WithTimeout(context.Background(), tc.timeout)
+		start := time.Now()
+		err := sem.Acquire(ctx, tc.size)
+		cancel()
+		if err != nil {
+			fmt.Printf("  Acquire(%3d MB, timeout %v): gave up after %v: %v\n",
+				tc.size, tc.timeout, time.Since(start).Round(10*time.Millisecond), err)
+			continue
+		}
+		fmt.Printf("  Acquire(%3d MB, timeout %v): got it after %v\n",
+			tc.size, tc.timeout, time.Since(start).Round(10*time.Millisecond))
+		sem.Release(tc.size)
+	}
+
+	// TryAcquire never waits: the answer for "reject now" (HTTP 503)
+	sem.Acquire(context.Background(), 900)
+	fmt.Printf("  TryAcquire(100 MB) with 124 free: %v\n", sem.TryAcquire(100))
+	fmt.Printf("  TryAcquire(200 MB) with  24 free: %v\n", sem.TryAcquire(200))
+	sem.Release(1000)
+}
+
+// ============================================================
+// FIFO order and its consequences
+// ============================================================
+
+func fifo() {
+	sem := semaphore.NewWeighted(10)
+	sem.Acquire(context.Background(), 6) // 4 free
+
+	bigGot := make(chan struct{})
+	go func() {
+		sem.Acquire(context.Background(), 8) // must wait for 8
+		close(bigGot)
+	}()
+	time.Sleep(20 * time.Millisecond) // let it queue
+
+	// 4 units are free and this needs 2, but the waiter for 8 is ahead
+	fmt.Printf("  6 of 10 held, a request for 8 queued: TryAcquire(2) = %v\n", sem.TryAcquire(2))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	err := sem.Acquire(ctx, 2)
+	cancel()
+	fmt.Printf("  Acquire(2) waits behind it too: %v\n", err)
+
+	sem.Release(6)
+	<-bigGot
+	fmt.Println("  after the 6 are released, the 8 gets in; small ones queue behind it")
+	fmt.Println("  (without FIFO, a stream of small jobs could keep the big one waiting forever)")
+	sem.Release(8)
+
+	// Asking for more than exists can never succeed; Acquire does not
+	// say so, it just waits for the context
+	ctx, cancel = context.WithTimeout(context.Background(), 30*time.Millisecond)
+	defer cancel()
+	fmt.Printf("  Acquire(11) on a semaphore of 10: %v\n", sem.Acquire(ctx, 11))
+}
+
+// ============================================================
+// A weighted semaphore from channels
+// ============================================================
+
+// chanWeighted hands out n tokens from a buffered channel. Taking
+// several tokens is not atomic, so acquirers take turns: without mu,
+// two big jobs can each take half the tokens and then wait forever
+// for the other half (hold-and-wait, a classic deadlock)
+type chanWeighted struct {
+	tokens chan struct{}
+	mu     chan struct{} // a mutex that works with select
+}
+
+func newChanWeighted(n int) *chanWeighted {
+	s := &chanWeighted{tokens: make(chan struct{}, n), mu: make(chan struct{}, 1)}
+	for range n {
+		s.tokens <- struct{}{}
+	}
+	return s
+}
+
+func (s *chanWeighted) Acquire(ctx context.Context, n int) error {
+	if n > cap(s.tokens) {
+		return fmt.Errorf("acquire %d: more than the total of %d", n, cap(s.tokens))
+	}
+	select {
+	case s.mu <- struct{}{}:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	defer func() { <-s.mu }()
+	for i := range n {
+		select {
+		case <-s.tokens:
+		case <-ctx.Done():
+			s.Release(i) // give back what we took
+			return ctx.Err()
+		}
+	}
+	return nil
+}
+
+func (s *chanWeighted) Release(n int) {
+	for range n {
+		s.tokens <- struct{}{}
+	}
+}
+
+func channelWeighted() {
+	// Two jobs of 6 against 10 tokens, taking tokens one at a time
+	// with no turn-taking: they interleave and both get stuck
+	tokens := make(chan struct{}, 10)
+	for range 10 {
+		tokens <- struct{}{}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	var stuck atomic.Int64
+	var wg sync.WaitGroup
+	gate := make(chan struct{})
+	for range 2 {
+		wg.Go(func() {
+			<-gate
+			for range 6 {
+				select {
+				case <-tokens:
+					time.Sleep(time.Millisecond) // a preemption at a bad time
+				case <-ctx.Done():
+					stuck.Add(1)
+					return
+				}
+			}
+		})
+	}
+	close(gate)
+	wg.Wait()
+	fmt.Printf("  naive, two jobs of 6 on 10 tokens: %d of 2 stuck until the timeout, %d tokens left\n",
+		stuck.Load(), len(tokens))
+
+	// With turn-taking the second job waits for the first to finish
+	s := newChanWeighted(10)
+	m := &meter{}
+	start := time.Now()
+	for _, size := range []int{6, 6, 3, 8, 2} {
+		if err := s.Acquire(context.Background(), size); err != nil {
+			panic(err)
+		}
+		wg.Go(func() {
+			defer s.Release(size)
+			m.run(job{sizeMB: int64(size) * 100})
+		})
+	}
+	wg.Wait()
+	fmt.Printf("  chanWeighted, jobs of 6,6,3,8,2 on 10 tokens: peak %d of 10, %v\n",
+		m.peak.Load()/100, time.Since(start).Round(time.Millisecond))
+	fmt.Printf("  chanWeighted.Acquire(11): %v\n", s.Acquire(context.Background(), 11))
+}
+
+// ============================================================
+// Cost
+// ============================================================
+
+func cost() {
+	const n = 200_000
+	measure := func(name string, workers int, acquire, release func()) {
+		var wg sync.WaitGroup
+		start := time.Now()
+		for range workers {
+			wg.Go(func() {
+				for range n / workers {
+					acquire()
+					release()
+				}
+			})
+		}
+		wg.Wait()
+		fmt.Printf("  %-28s %3d goroutines: %4d ns per pair\n", name, workers, time.Since(start).Nanoseconds()/n)
+	}
+
+	ch := make(chan struct{}, 4)
+	w := semaphore.NewWeighted(4)
+	cw := newChanWeighted(4)
+	ctx := context.Background()
+	for _, workers := range []int{1, 16} {
+		measure("buffered channel", workers, func() { ch <- struct{}{} }, func() { <-ch })
+		measure("semaphore.Weighted (1)", workers, func() { w.Acquire(ctx, 1) }, func() { w.Release(1) })
+		measure("chanWeighted (1)", workers, func() { cw.Acquire(ctx, 1) }, func() { cw.Release(1) })
+	}
+	fmt.Println("  Weighted pays for a mutex and a waiter list; use a channel when every")
+	fmt.Println("  acquirer costs the same, Weighted when they don't.")
+}
+
+func main() {
+	jobs := makeJobs(60)
+	var total int64
+	for _, j := range jobs {
+		total += j.sizeMB
+	}
+	fmt.Printf("=== %d resize jobs, %d MB in total, %d MB budget ===\n", len(jobs), total, budgetMB)
+	countingSemaphore(jobs, 4)
+	countingSemaphore(jobs, 12)
+	weightedSemaphore(jobs)
+
+	fmt.Println("\n=== Timeouts and TryAcquire ===")
+	timeouts()
+
+	fmt.Println("\n=== FIFO ===")
+	fifo()
+
+	fmt.Println("\n=== Weighted from channels ===")
+	channelWeighted()
+
+	fmt.Println("\n=== Cost per Acquire+Release ===")
+	cost()
+
+}
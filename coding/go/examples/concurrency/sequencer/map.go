@@ -0,0 +1,80 @@
+package sequencer
+
+import (
+	"context"
+	"sync"
+)
+
+// Result is one item's outcome from Map
+type Result[T any] struct {
+	Value T
+	Err   error
+}
+
+// Map runs fn on every item from in, on workers goroutines, and emits
+// the results in the order the items arrived. An error is a result
+// like any other: it comes out in its place and the rest carry on.
+//
+// The output is closed once in is closed and every result is out, or
+// soon after ctx is done. Cancelling ctx is also how a reader that
+// stops early releases Map's goroutines
+func Map[In, Out any](ctx context.Context, in <-chan In, workers int, cfg Config, fn func(context.Context, In) (Out, error)) <-chan Result[Out] {
+	if cfg.Window <= 0 {
+		cfg.Window = 2 * workers // room for every worker to run ahead once
+	}
+	seq := New[Result[Out]](cfg)
+
+	type job struct {
+		seq uint64
+		v   In
+	}
+	// One channel, one sender: workers receive jobs in sequence order,
+	// which is what keeps Put's blocking deadlock-free
+	jobs := make(chan job)
+	go func() {
+		defer close(jobs)
+		var n uint64
+		for v := range in {
+			select {
+			case jobs <- job{n, v}:
+				n++
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var wg sync.WaitGroup
+	for range workers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				v, err := fn(ctx, j.v)
+				if seq.Put(ctx, j.seq, Result[Out]{v, err}) != nil {
+					return // ctx is done
+				}
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		seq.Close()
+	}()
+
+	out := make(chan Result[Out])
+	go func() {
+		defer close(out)
+		for r := range seq.Out() {
+			select {
+			case out <- r:
+			case <-ctx.Done():
+				for range seq.Out() {
+					// nobody is reading: let the sequencer finish
+				}
+				return
+			}
+		}
+	}()
+	return out
+}
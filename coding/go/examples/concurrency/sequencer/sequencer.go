@@ -0,0 +1,299 @@
+// Package sequencer puts results back in order after parallel work.
+//
+// Fanning work out to N goroutines loses its order: item 7 can finish
+// before item 3. When order matters (lines of a file, frames of a
+// video, rows of a report) each item is tagged with a sequence number
+// on the way in, and a Sequencer holds results that arrive early until
+// everything before them has been emitted.
+//
+//	in --tag 0,1,2,...--> [worker] x N --Put(seq, v)--> Sequencer --> Out(), in order
+//
+// Two things go wrong with a naive reorder buffer:
+//   - One slow item holds up everything behind it, and the buffer grows
+//     without limit while it waits. A Sequencer holds at most Window
+//     items; Put for an item further ahead blocks until the gap closes,
+//     which slows the workers down instead of growing memory.
+//   - An item that is lost (a worker failed and dropped it) stalls the
+//     output for good. Workers report dropped items with Skip, and a
+//     gap that stays open longer than StallAfter is reported to
+//     OnStall, so a bug shows up as a log line instead of a hang.
+//
+// Map wires it all up for the common case: an ordered, parallel map
+// over a channel.
+package sequencer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrDuplicate means Put or Skip was given a sequence number that
+	// was already emitted or is already buffered
+	ErrDuplicate = errors.New("sequencer: duplicate sequence number")
+	// ErrClosed means Put or Skip was called after Close
+	ErrClosed = errors.New("sequencer: closed")
+)
+
+// GapError is what Err returns when Close left items that could not be
+// emitted because an earlier one never arrived
+type GapError struct {
+	Missing  uint64 // the first sequence number that never arrived
+	Buffered int    // items after it that were dropped
+}
+
+func (e *GapError) Error() string {
+	return fmt.Sprintf("sequencer: closed waiting for %d with %d items behind it", e.Missing, e.Buffered)
+}
+
+// Stall describes output held up by a missing item
+type Stall struct {
+	Waiting  uint64        // the sequence number everything waits for
+	Buffered int           // items ready behind it
+	For      time.Duration // how long they have been waiting
+}
+
+type Config struct {
+	// Window is how many items may be held out of order (64). It should
+	// be at least the number of workers, or they take turns waiting
+	Window int
+	// OutBuffer is the capacity of the Out channel (0)
+	OutBuffer int
+	// StallAfter, if set, is how long the output may wait for a missing
+	// item with others ready behind it before OnStall is called. It is
+	// called once per gap, from the Sequencer's goroutine
+	StallAfter time.Duration
+	OnStall    func(Stall)
+}
+
+type slot[T any] struct {
+	v    T
+	full bool
+	skip bool // arrived, but with nothing to emit
+}
+
+// Sequencer takes items tagged 0, 1, 2, ... in any order and emits
+// them on Out in order. Put, Skip and Close are safe for concurrent use
+type Sequencer[T any] struct {
+	cfg Config
+	out chan T
+
+	mu       sync.Mutex
+	ring     []slot[T] // slot for seq is ring[seq%Window]
+	next     uint64    // the next to emit
+	buffered int
+	closed   bool
+	// advanced is closed, and replaced, whenever next moves: a Put
+	// waiting for room watches it
+	advanced chan struct{}
+	// ready wakes the emitter: next has arrived, or Close
+	ready chan struct{}
+	// stuckSince is when the items now buffered started waiting
+	stuckSince time.Time
+	err        error
+	done       chan struct{} // closed when the emitter exits
+}
+
+func New[T any](cfg Config) *Sequencer[T] {
+	if cfg.Window <= 0 {
+		cfg.Window = 64
+	}
+	s := &Sequencer[T]{
+		cfg:      cfg,
+		out:      make(chan T, cfg.OutBuffer),
+		ring:     make([]slot[T], cfg.Window),
+		advanced: make(chan struct{}),
+		ready:    make(chan struct{}, 1),
+		done:     make(chan struct{}),
+	}
+	go s.emit()
+	return s
+}
+
+// Out delivers items in sequence order. It is closed after Close once
+// everything that can be emitted has been
+func (s *Sequencer[T]) Out() <-chan T { return s.out }
+
+// Put hands over item seq. If seq is Window or more ahead of the next
+// item due out, Put waits for room or for ctx.
+//
+// Items must be handed to workers in sequence order, as Map does. Then
+// the item everyone waits for is always held by a worker that can Put
+// it, and blocking can't deadlock
+func (s *Sequencer[T]) Put(ctx context.Context, seq uint64, v T) error {
+	return s.put(ctx, seq, slot[T]{v: v, full: true})
+}
+
+// Skip marks seq as done with nothing to emit, for an item that was
+// filtered out or failed. Without it the output waits for seq forever
+func (s *Sequencer[T]) Skip(ctx context.Context, seq uint64) error {
+	return s.put(ctx, seq, slot[T]{full: true, skip: true})
+}
+
+func (s *Sequencer[T]) put(ctx context.Context, seq uint64, sl slot[T]) error {
+	for {
+		s.mu.Lock()
+		if s.closed {
+			s.mu.Unlock()
+			return ErrClosed
+		}
+		if seq < s.next {
+			s.mu.Unlock()
+			return ErrDuplicate
+		}
+		if seq < s.next+uint64(s.cfg.Window) {
+			i := seq % uint64(s.cfg.Window)
+			if s.ring[i].full {
+				s.mu.Unlock()
+				return ErrDuplicate
+			}
+			if s.buffered == 0 {
+				s.stuckSince = time.Now()
+			}
+			s.ring[i] = sl
+			s.buffered++
+			if seq == s.next {
+				s.poke()
+			}
+			s.mu.Unlock()
+			return nil
+		}
+		wait := s.advanced
+		s.mu.Unlock()
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (s *Sequencer[T]) poke() {
+	select {
+	case s.ready <- struct{}{}:
+	default:
+	}
+}
+
+// Close says no more items are coming. Out is closed once everything
+// that can be emitted has been; anything stuck behind a gap is dropped
+// and reported by Err. Close does not wait for that; Wait does
+func (s *Sequencer[T]) Close() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.closed {
+		s.closed = true
+		close(s.advanced) // release waiting Puts; they see closed
+		s.poke()
+	}
+}
+
+// Wait blocks until Out is closed and returns Err. Out must be read
+// meanwhile, or this waits for ever
+func (s *Sequencer[T]) Wait() error {
+	<-s.done
+	return s.Err()
+}
+
+// Err reports a gap that Close left behind, once Out is closed
+func (s *Sequencer[T]) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Buffered is how many items are waiting for an earlier one
+func (s *Sequencer[T]) Buffered() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.buffered
+}
+
+// take removes the run of consecutive items from next, appending the
+// ones with a value to batch, and reports whether next moved; s.mu held
+func (s *Sequencer[T]) take(batch []T) ([]T, bool) {
+	moved := false
+	for {
+		i := s.next % uint64(s.cfg.Window)
+		sl := s.ring[i]
+		if !sl.full {
+			break
+		}
+		if !sl.skip {
+			batch = append(batch, sl.v)
+		}
+		s.ring[i] = slot[T]{}
+		s.next++
+		s.buffered--
+		moved = true
+	}
+	if moved {
+		s.stuckSince = time.Now() // the items left, if any, wait from now
+		if !s.closed {
+			close(s.advanced)
+			s.advanced = make(chan struct{})
+		}
+	}
+	return batch, moved
+}
+
+// stalled returns the current stall, if there is one; s.mu held
+func (s *Sequencer[T]) stalled() (Stall, bool) {
+	st := Stall{Waiting: s.next, Buffered: s.buffered, For: time.Since(s.stuckSince)}
+	return st, st.Buffered > 0 && st.For >= s.cfg.StallAfter
+}
+
+// emit is the one goroutine that sends on out. It takes ready items
+// under the lock and sends them without it, so a slow reader of Out
+// holds up only the output, not Puts that have room
+func (s *Sequencer[T]) emit() {
+	defer close(s.done)
+	defer close(s.out)
+
+	var check <-chan time.Time
+	if s.cfg.StallAfter > 0 && s.cfg.OnStall != nil {
+		t := time.NewTicker(max(s.cfg.StallAfter/4, time.Millisecond))
+		defer t.Stop()
+		check = t.C
+	}
+	reported := false // this gap
+	var batch []T
+	for {
+		select {
+		case <-s.ready:
+		case <-check:
+			s.mu.Lock()
+			st, ok := s.stalled()
+			s.mu.Unlock()
+			if ok && !reported {
+				reported = true
+				s.cfg.OnStall(st)
+			}
+			continue
+		}
+
+		s.mu.Lock()
+		batch, moved := s.take(batch[:0])
+		closed := s.closed
+		if closed && s.buffered > 0 {
+			// Nothing can arrive after Close, so this take saw all there
+			// will ever be: the rest is stuck behind a gap for good
+			s.err = &GapError{Missing: s.next, Buffered: s.buffered}
+		}
+		s.mu.Unlock()
+
+		if moved {
+			reported = false
+		}
+		for _, v := range batch {
+			s.out <- v
+		}
+		clear(batch) // don't keep sent items reachable
+		if closed {
+			return
+		}
+	}
+}
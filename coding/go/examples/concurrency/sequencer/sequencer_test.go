@@ -0,0 +1,385 @@
+package sequencer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"runtime"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// collect reads Out until it is closed
+func collect[T any](s *Sequencer[T]) <-chan []T {
+	done := make(chan []T, 1)
+	go func() {
+		var got []T
+		for v := range s.Out() {
+			got = append(got, v)
+		}
+		done <- got
+	}()
+	return done
+}
+
+func TestReorders(t *testing.T) {
+	tests := []struct {
+		name  string
+		order []uint64
+	}{
+		{"in order", []uint64{0, 1, 2, 3, 4}},
+		{"reversed", []uint64{4, 3, 2, 1, 0}},
+		{"shuffled", []uint64{2, 0, 4, 1, 3}},
+		{"head last", []uint64{1, 2, 3, 4, 0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New[string](Config{Window: 8})
+			got := collect(s)
+			for _, seq := range tt.order {
+				if err := s.Put(context.Background(), seq, fmt.Sprint(seq)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			s.Close()
+			if err := s.Wait(); err != nil {
+				t.Fatal(err)
+			}
+			if out, want := <-got, []string{"0", "1", "2", "3", "4"}; !slices.Equal(out, want) {
+				t.Errorf("got %v, want %v", out, want)
+			}
+		})
+	}
+}
+
+func TestSkip(t *testing.T) {
+	s := New[int](Config{})
+	got := collect(s)
+	ctx := context.Background()
+	s.Put(ctx, 2, 2)
+	s.Skip(ctx, 1) // filtered out
+	s.Put(ctx, 0, 0)
+	s.Close()
+	if err := s.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if out, want := <-got, []int{0, 2}; !slices.Equal(out, want) {
+		t.Errorf("got %v, want %v", out, want)
+	}
+}
+
+func TestErrors(t *testing.T) {
+	ctx := context.Background()
+	s := New[int](Config{Window: 4})
+	got := collect(s)
+	s.Put(ctx, 0, 0)
+	s.Put(ctx, 2, 2)
+	for _, tt := range []struct {
+		seq  uint64
+		want error
+	}{
+		{2, ErrDuplicate}, // buffered
+		{0, ErrDuplicate}, // emitted, once the emitter gets to it
+	} {
+		// seq 0 may still be in the ring rather than emitted; both are
+		// duplicates
+		if err := s.Put(ctx, tt.seq, -1); !errors.Is(err, tt.want) {
+			t.Errorf("Put(%d) = %v, want %v", tt.seq, err, tt.want)
+		}
+	}
+	s.Close()
+	if err := s.Put(ctx, 1, 1); !errors.Is(err, ErrClosed) {
+		t.Errorf("Put after Close = %v, want ErrClosed", err)
+	}
+	var gap *GapError
+	if err := s.Wait(); !errors.As(err, &gap) || gap.Missing != 1 || gap.Buffered != 1 {
+		t.Errorf("Wait = %v, want a gap at 1 with 1 item behind it", err)
+	}
+	if out, want := <-got, []int{0}; !slices.Equal(out, want) {
+		t.Errorf("got %v, want %v", out, want)
+	}
+}
+
+func TestWindowBlocksPut(t *testing.T) {
+	ctx := context.Background()
+	s := New[int](Config{Window: 4})
+	got := collect(s)
+	for seq := range uint64(4) {
+		if seq != 0 {
+			s.Put(ctx, seq, int(seq))
+		}
+	}
+	// 1..3 are buffered waiting for 0; 4 is outside the window
+	blocked := make(chan error)
+	go func() { blocked <- s.Put(ctx, 4, 4) }()
+	select {
+	case err := <-blocked:
+		t.Fatalf("Put beyond the window returned %v without waiting", err)
+	case <-time.After(20 * time.Millisecond):
+	}
+	if n := s.Buffered(); n != 3 {
+		t.Errorf("Buffered = %d, want 3", n)
+	}
+
+	// A waiting Put gives up with its context
+	short, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+	defer cancel()
+	if err := s.Put(short, 5, 5); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Put = %v, want DeadlineExceeded", err)
+	}
+
+	s.Put(ctx, 0, 0) // closes the gap, which makes room for 4
+	if err := <-blocked; err != nil {
+		t.Fatal(err)
+	}
+	s.Put(ctx, 5, 5)
+	s.Close()
+	if err := s.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if out, want := <-got, []int{0, 1, 2, 3, 4, 5}; !slices.Equal(out, want) {
+		t.Errorf("got %v, want %v", out, want)
+	}
+}
+
+func TestCloseReleasesWaitingPut(t *testing.T) {
+	s := New[int](Config{Window: 1})
+	got := collect(s)
+	blocked := make(chan error)
+	go func() { blocked <- s.Put(context.Background(), 5, 5) }()
+	time.Sleep(10 * time.Millisecond)
+	s.Close()
+	if err := <-blocked; !errors.Is(err, ErrClosed) {
+		t.Errorf("Put = %v, want ErrClosed", err)
+	}
+	<-got
+}
+
+func TestStall(t *testing.T) {
+	stalls := make(chan Stall, 10)
+	s := New[int](Config{StallAfter: 20 * time.Millisecond, OnStall: func(st Stall) { stalls <- st }})
+	got := collect(s)
+	ctx := context.Background()
+	s.Put(ctx, 1, 1)
+	s.Put(ctx, 2, 2)
+
+	select {
+	case st := <-stalls:
+		if st.Waiting != 0 || st.Buffered != 2 || st.For < 20*time.Millisecond {
+			t.Errorf("stall = %+v, want waiting for 0 with 2 behind, for 20ms or more", st)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no stall reported")
+	}
+	time.Sleep(50 * time.Millisecond)
+	if len(stalls) != 0 {
+		t.Error("the same gap was reported twice")
+	}
+
+	// Closing the gap resets; a new one is reported afresh
+	s.Put(ctx, 0, 0)
+	s.Put(ctx, 4, 4)
+	select {
+	case st := <-stalls:
+		if st.Waiting != 3 {
+			t.Errorf("second stall waits for %d, want 3", st.Waiting)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("second gap not reported")
+	}
+	s.Skip(ctx, 3)
+	s.Close()
+	if err := s.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if out, want := <-got, []int{0, 1, 2, 4}; !slices.Equal(out, want) {
+		t.Errorf("got %v, want %v", out, want)
+	}
+}
+
+func TestConcurrentWorkers(t *testing.T) {
+	// Run with -race. Items are handed out in order and finish in any
+	const n = 5000
+	s := New[int](Config{Window: 16})
+	got := collect(s)
+	jobs := make(chan uint64)
+	var wg sync.WaitGroup
+	for w := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rng := rand.New(rand.NewSource(int64(w)))
+			for seq := range jobs {
+				if rng.Intn(4) == 0 {
+					runtime.Gosched()
+				}
+				var err error
+				if seq%10 == 7 {
+					err = s.Skip(context.Background(), seq)
+				} else {
+					err = s.Put(context.Background(), seq, int(seq))
+				}
+				if err != nil {
+					t.Error(err)
+				}
+				if b := s.Buffered(); b > 16 {
+					t.Errorf("Buffered = %d, over the window", b)
+				}
+			}
+		}()
+	}
+	for seq := range uint64(n) {
+		jobs <- seq
+	}
+	close(jobs)
+	wg.Wait()
+	s.Close()
+	if err := s.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	out := <-got
+	if len(out) != n-n/10 || !slices.IsSorted(out) {
+		t.Errorf("%d items, sorted %v; want %d in order", len(out), slices.IsSorted(out), n-n/10)
+	}
+}
+
+func TestMap(t *testing.T) {
+	in := make(chan int)
+	go func() {
+		defer close(in)
+		for i := range 200 {
+			in <- i
+		}
+	}()
+	errOdd := errors.New("odd multiple of 7")
+	out := Map(context.Background(), in, 8, Config{}, func(_ context.Context, i int) (int, error) {
+		time.Sleep(time.Duration(rand.Intn(500)) * time.Microsecond)
+		if i%14 == 7 {
+			return 0, errOdd
+		}
+		return i * i, nil
+	})
+	i := 0
+	for r := range out {
+		switch {
+		case i%14 == 7:
+			if !errors.Is(r.Err, errOdd) {
+				t.Errorf("result %d: %+v, want its error in its place", i, r)
+			}
+		case r.Err != nil || r.Value != i*i:
+			t.Errorf("result %d: %+v, want %d", i, r, i*i)
+		}
+		i++
+	}
+	if i != 200 {
+		t.Errorf("%d results, want 200", i)
+	}
+}
+
+func TestMapCancel(t *testing.T) {
+	// A reader that stops early cancels; every goroutine must exit
+	before := runtime.NumGoroutine()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	in := make(chan int)
+	go func() {
+		defer close(in)
+		for i := 0; ; i++ {
+			select {
+			case in <- i:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	out := Map(ctx, in, 4, Config{}, func(_ context.Context, i int) (int, error) { return i, nil })
+	for r := range out {
+		if r.Value == 100 {
+			cancel()
+			break
+		}
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > before {
+		t.Errorf("%d goroutines left behind", n-before)
+	}
+}
+
+// ============================================================
+// Benchmarks
+// ============================================================
+
+// BenchmarkMap compares an ordered Map with the same fan-out left
+// unordered, for cheap and for uneven work. The gap is the price of
+// order: reorder bookkeeping, and workers that wait on a slow item once
+// the window is full. A wider window lets them run further ahead, for
+// more memory
+func BenchmarkMap(b *testing.B) {
+	work := map[string]func(int) int{
+		"cheap": func(i int) int { return i * i },
+		"uneven": func(i int) int {
+			if i%16 == 0 {
+				return spin(50_000) // one slow item in 16
+			}
+			return i
+		},
+	}
+	for _, name := range []string{"cheap", "uneven"} {
+		fn := work[name]
+		for _, window := range []int{8, 64} {
+			b.Run(fmt.Sprintf("%s/ordered-window-%d", name, window), func(b *testing.B) {
+				in := feed(b.N)
+				for range Map(context.Background(), in, 4, Config{Window: window}, func(_ context.Context, i int) (int, error) {
+					return fn(i), nil
+				}) {
+				}
+			})
+		}
+		b.Run(name+"/unordered", func(b *testing.B) {
+			in := feed(b.N)
+			out := make(chan int)
+			var wg sync.WaitGroup
+			for range 4 {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for i := range in {
+						out <- fn(i)
+					}
+				}()
+			}
+			go func() {
+				wg.Wait()
+				close(out)
+			}()
+			for range out {
+			}
+		})
+	}
+}
+
+// spin burns CPU, where a sleep would measure the timer instead
+func spin(n int) int {
+	x := 0
+	for i := range n {
+		x += i * i
+	}
+	return x
+}
+
+func feed(n int) <-chan int {
+	in := make(chan int, 64)
+	go func() {
+		defer close(in)
+		for i := range n {
+			in <- i
+		}
+	}()
+	return in
+}
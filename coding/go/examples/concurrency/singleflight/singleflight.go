@@ -0,0 +1,320 @@
+// Singleflight - Collapsing duplicate work into one call
+//
+// When many goroutines ask for the same thing at the same time (the
+// same user profile, the same config blob, the same cache key that just
+// expired), only one of them needs to do the work; the rest can wait
+// for its answer. That is what golang.org/x/sync/singleflight does. This
+// example shows:
+// - 100 goroutines looking up one key: 100 backend calls without
+//   coalescing, 1 with singleflight, counted on the backend
+// - A hand-rolled, generic version in 30 lines: a map of in-flight
+//   calls, each with a WaitGroup the duplicates wait on
+// - A cache stampede: a hot key expires under load and every request
+//   misses at once. The backend gets slower the more concurrent calls it
+//   has, so the stampede hurts twice: more calls, and each one slower
+// - The sharp edges: an error is shared by every waiter, a slow call
+//   holds up everyone (DoChan lets a caller stop waiting), and Forget
+//   lets the next caller start a fresh call
+//
+// golang.org/x/sync is outside the standard library, so this example is
+// a module of its own: go.mod and go.sum pin the version.
+//
+// Usage (from this directory):
+//   go run .
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+)
+
+// ============================================================
+// A backend that gets slower under load
+// ============================================================
+
+// backend stands in for a database: each lookup takes base latency
+// plus a bit more for every other lookup running at the same time
+type backend struct {
+	base     time.Duration
+	perCall  time.Duration
+	calls    atomic.Int64
+	inFlight atomic.Int64
+	peak     atomic.Int64
+	fail     atomic.Bool
+}
+
+func (b *backend) lookup(key string) (string, error) {
+	b.calls.Add(1)
+	n := b.inFlight.Add(1)
+	defer b.inFlight.Add(-1)
+	raise(&b.peak, n)
+	time.Sleep(b.base + time.Duration(n-1)*b.perCall)
+	if b.fail.Load() {
+		return "", errors.New("backend: connection reset")
+	}
+	return "value-of-" + key, nil
+}
+
+// raise sets v to n if n is larger
+func raise(v *atomic.Int64, n int64) {
+	for {
+		old := v.Load()
+		if n <= old || v.CompareAndSwap(old, n) {
+			return
+		}
+	}
+}
+
+func (b *backend) reset() {
+	b.calls.Store(0)
+	b.peak.Store(0)
+	b.fail.Store(false)
+}
+
+// ============================================================
+// Hand-rolled singleflight
+// ============================================================
+
+// call is one in-flight execution. Duplicates wait on wg and then read
+// val and err, which are written once before wg.Done
+type call[V any] struct {
+	wg   sync.WaitGroup
+	val  V
+	err  error
+	dups int
+}
+
+// flightGroup is x/sync/singleflight.Group without DoChan or Forget,
+// and with type parameters instead of interface{}
+type flightGroup[K comparable, V any] struct {
+	mu sync.Mutex
+	m  map[K]*call[V]
+}
+
+// Do runs fn once per key at a time; callers that arrive while it runs
+// get its result. shared reports whether the result went to more than
+// one caller
+func (g *flightGroup[K, V]) Do(key K, fn func() (V, error)) (v V, err error, shared bool) {
+	g.mu.Lock()
+	if g.m == nil {
+		g.m = make(map[K]*call[V])
+	}
+	if c, ok := g.m[key]; ok {
+		c.dups++
+		g.mu.Unlock()
+		c.wg.Wait()
+		return c.val, c.err, true
+	}
+	c := &call[V]{}
+	c.wg.Add(1)
+	g.m[key] = c
+	g.mu.Unlock()
+
+	c.val, c.err = fn()
+	c.wg.Done()
+
+	// Delete after Done: a caller arriving now starts a new call, which
+	// is what makes this "one at a time", not "once ever"
+	g.mu.Lock()
+	delete(g.m, key)
+	g.mu.Unlock()
+	return c.val, c.err, c.dups > 0
+}
+
+// ============================================================
+// Demo: 100 goroutines, one key
+// ============================================================
+
+// fanIn runs get from n goroutines released together and reports the
+// backend calls and how many callers got a shared result
+func fanIn(name string, be *backend, n int, get func() (shared bool)) {
+	be.reset()
+	var wg sync.WaitGroup
+	var sharedCount atomic.Int64
+	start := make(chan struct{})
+	for range n {
+		wg.Go(func() {
+			<-start
+			if get() {
+				sharedCount.Add(1)
+			}
+		})
+	}
+	t := time.Now()
+	close(start)
+	wg.Wait()
+	fmt.Printf("  %-24s %3d callers -> %3d backend calls, %3d shared results, peak %3d concurrent, %v\n",
+		name, n, be.calls.Load(), sharedCount.Load(), be.peak.Load(), time.Since(t).Round(time.Millisecond))
+}
+
+func oneKey() {
+	be := &backend{base: 20 * time.Millisecond, perCall: 100 * time.Microsecond}
+	var sf singleflight.Group
+	var hand flightGroup[string, string]
+
+	fanIn("no coalescing", be, 100, func() bool {
+		be.lookup("user:42")
+		return false
+	})
+	fanIn("x/sync singleflight", be, 100, func() bool {
+		_, _, shared := sf.Do("user:42", func() (any, error) { return be.lookup("user:42") })
+		return shared
+	})
+	fanIn("hand-rolled", be, 100, func() bool {
+		_, _, shared := hand.Do("user:42", func() (string, error) { return be.lookup("user:42") })
+		return shared
+	})
+	// Different keys don't coalesce: one call each
+	var next atomic.Int64
+	fanIn("hand-rolled, 10 keys", be, 100, func() bool {
+		key := fmt.Sprint("user:", next.Add(1)%10)
+		_, _, shared := hand.Do(key, func() (string, error) { return be.lookup(key) })
+		return shared
+	})
+}
+
+// ============================================================
+// Demo: cache stampede
+// ============================================================
+
+type entry struct {
+	val     string
+	expires time.Time
+}
+
+// cache is a TTL cache in front of the backend. With coalesce set,
+// misses for the same key share one load
+type cache struct {
+	be       *backend
+	ttl      time.Duration
+	coalesce bool
+
+	mu    sync.RWMutex
+	items map[string]entry
+	sf    flightGroup[string, string]
+}
+
+func (c *cache) Get(key string) (string, error) {
+	c.mu.RLock()
+	e, ok := c.items[key]
+	c.mu.RUnlock()
+	if ok && time.Now().Before(e.expires) {
+		return e.val, nil
+	}
+	load := func() (string, error) {
+		v, err := c.be.lookup(key)
+		if err == nil {
+			c.mu.Lock()
+			c.items[key] = entry{v, time.Now().Add(c.ttl)}
+			c.mu.Unlock()
+		}
+		return v, err
+	}
+	if !c.coalesce {
+		return load()
+	}
+	v, err, _ := c.sf.Do(key, load)
+	return v, err
+}
+
+// stampede keeps 200 clients hitting one hot key, each every 2ms, for
+// 300ms. The 100ms TTL makes the key expire twice under that load
+func stampede(coalesce bool) {
+	be := &backend{base: 10 * time.Millisecond, perCall: 200 * time.Microsecond}
+	c := &cache{be: be, ttl: 100 * time.Millisecond, coalesce: coalesce, items: map[string]entry{}}
+	c.Get("home-page") // warm
+
+	be.reset()
+	var wg sync.WaitGroup
+	var requests atomic.Int64
+	var slowest atomic.Int64
+	deadline := time.Now().Add(300 * time.Millisecond)
+	for range 200 {
+		wg.Go(func() {
+			for time.Now().Before(deadline) {
+				t := time.Now()
+				c.Get("home-page")
+				raise(&slowest, int64(time.Since(t)))
+				requests.Add(1)
+				time.Sleep(2 * time.Millisecond)
+			}
+		})
+	}
+	wg.Wait()
+	name := "plain cache"
+	if coalesce {
+		name = "cache + singleflight"
+	}
+	fmt.Printf("  %-21s %5d requests, %3d backend loads, peak %3d concurrent, slowest request %v\n",
+		name, requests.Load(), be.calls.Load(), be.peak.Load(),
+		time.Duration(slowest.Load()).Round(time.Millisecond))
+}
+
+// ============================================================
+// Demo: sharp edges
+// ============================================================
+
+func sharpEdges() {
+	be := &backend{base: 30 * time.Millisecond}
+	var sf singleflight.Group
+
+	// 1. An error is shared too: one failed call fails every waiter
+	be.fail.Store(true)
+	var failed atomic.Int64
+	var wg sync.WaitGroup
+	for range 20 {
+		wg.Go(func() {
+			if _, err, _ := sf.Do("k", func() (any, error) { return be.lookup("k") }); err != nil {
+				failed.Add(1)
+			}
+		})
+	}
+	wg.Wait()
+	fmt.Printf("  one failing call, 20 callers: %d errors from %d backend call(s)\n", failed.Load(), be.calls.Load())
+	be.reset()
+
+	// 2. Everyone waits as long as the slowest leader. DoChan returns a
+	//    channel, so a caller with a deadline can stop waiting (the call
+	//    itself carries on for the others)
+	be.base = 200 * time.Millisecond
+	go sf.Do("slow", func() (any, error) { return be.lookup("slow") })
+	time.Sleep(5 * time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	t := time.Now()
+	select {
+	case r := <-sf.DoChan("slow", func() (any, error) { return be.lookup("slow") }):
+		fmt.Printf("  DoChan: got %v\n", r.Val)
+	case <-ctx.Done():
+		fmt.Printf("  DoChan on a 200ms call with a 50ms deadline: gave up after %v\n",
+			time.Since(t).Round(10*time.Millisecond))
+	}
+
+	// 3. Forget: a caller that knows the in-flight result is stale (say
+	//    it just wrote the key) can start a new call instead of joining
+	sf.Forget("slow")
+	fresh := &backend{base: 10 * time.Millisecond}
+	v, _, shared := sf.Do("slow", func() (any, error) { return fresh.lookup("slow") })
+	fmt.Printf("  after Forget, Do starts a new call (%v, shared=%v) while the old one is still running: %v\n",
+		v, shared, be.inFlight.Load() == 1)
+}
+
+func main() {
+	fmt.Println("=== 100 goroutines, one key (backend: 20ms + 0.1ms per concurrent call) ===")
+	oneKey()
+
+	fmt.Println("\n=== Cache stampede: 200 clients, one hot key, 100ms TTL ===")
+	stampede(false)
+	stampede(true)
+	fmt.Println("  without coalescing every expiry sends all 200 clients to the backend;")
+	fmt.Println("  with it, one load per expiry and the rest wait for it")
+
+	fmt.Println("\n=== Sharp edges ===")
+	sharpEdges()
+}
@@ -0,0 +1,280 @@
+// sync.Pool - Reusing buffers on a hot path
+//
+// A request handler that serializes a record into a fresh bytes.Buffer
+// allocates on every call; at tens of thousands of calls a second that
+// garbage is what keeps the GC busy. sync.Pool keeps used buffers
+// around for the next caller instead. This example encodes log records
+// both ways and compares allocations, bytes allocated, and GC cycles
+// measured with runtime.MemStats. Then it walks through the pitfalls:
+// - Get returns whatever is there: a buffer of any size with old
+//   contents, or a new one. Always Reset
+// - The pool is emptied by the GC (one cycle of grace via the victim
+//   cache), so it is a cache, not a free list you can count on
+// - One huge buffer Put back stays huge and is handed to callers that
+//   need 100 bytes; cap what goes back
+// - A buffer must not be used after Put: another goroutine now owns it
+// - Pool pointers (*bytes.Buffer), not slices: putting a []byte in an
+//   interface allocates, which is what the pool was meant to avoid
+//
+// Usage:
+//   go run sync_pool.go
+//   go test -run=^$ -bench=. -benchmem sync_pool.go sync_pool_test.go
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"hash/crc32"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ============================================================
+// The hot path: encoding a record
+// ============================================================
+
+type Record struct {
+	Time    time.Time
+	Level   string
+	Service string
+	Msg     string
+	Fields  []Field // a slice, not a map, so the output order is stable
+}
+
+type Field struct{ Key, Value string }
+
+// encode writes r as a logfmt line. strconv.Append* write into the
+// buffer's spare capacity, so a warm buffer makes this allocation-free
+func encode(buf *bytes.Buffer, r *Record) {
+	b := buf.AvailableBuffer()
+	b = append(b, "ts="...)
+	b = r.Time.AppendFormat(b, time.RFC3339Nano)
+	b = append(b, " level="...)
+	b = append(b, r.Level...)
+	b = append(b, " svc="...)
+	b = append(b, r.Service...)
+	b = append(b, " msg="...)
+	b = strconv.AppendQuote(b, r.Msg)
+	for _, f := range r.Fields {
+		b = append(b, ' ')
+		b = append(b, f.Key...)
+		b = append(b, '=')
+		b = strconv.AppendQuote(b, f.Value)
+	}
+	b = append(b, '\n')
+	buf.Write(b)
+}
+
+// sink stands in for the network write: it only checksums
+var sink atomic.Uint32
+
+func emit(p []byte) {
+	sink.Add(crc32.ChecksumIEEE(p))
+}
+
+// handleAlloc makes a new buffer per call
+func handleAlloc(r *Record) {
+	var buf bytes.Buffer
+	encode(&buf, r)
+	emit(buf.Bytes())
+}
+
+// maxPooled is the largest buffer worth keeping. A rare giant record
+// would otherwise pin its buffer in the pool for good
+const maxPooled = 64 << 10
+
+var bufPool = sync.Pool{
+	New: func() any { return new(bytes.Buffer) },
+}
+
+// handlePooled borrows a buffer and gives it back
+func handlePooled(r *Record) {
+	buf := bufPool.Get().(*bytes.Buffer)
+	buf.Reset() // whatever the last user left
+	encode(buf, r)
+	emit(buf.Bytes())
+	if buf.Cap() <= maxPooled {
+		bufPool.Put(buf)
+	}
+}
+
+func sampleRecord(i int) *Record {
+	return &Record{
+		Time:    time.Unix(1_700_000_000, int64(i)).UTC(),
+		Level:   "info",
+		Service: "checkout",
+		Msg:     "order placed for customer " + strconv.Itoa(i%1000),
+		Fields:  []Field{{"order", strconv.Itoa(i)}, {"region", "eu-west-1"}, {"latency", "12ms"}},
+	}
+}
+
+// ============================================================
+// Demo: allocation and GC pressure
+// ============================================================
+
+type memDelta struct {
+	mallocs, bytes uint64
+	gcs            uint32
+	pause          time.Duration
+	elapsed        time.Duration
+}
+
+// measure runs fn from workers goroutines, n calls in total, and
+// returns what the runtime allocated meanwhile
+func measure(workers, n int, fn func(*Record)) memDelta {
+	records := make([]*Record, 256)
+	for i := range records {
+		records[i] = sampleRecord(i)
+	}
+	runtime.GC()
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+	var wg sync.WaitGroup
+	for w := range workers {
+		wg.Go(func() {
+			for i := w; i < n; i += workers {
+				fn(records[i%len(records)])
+			}
+		})
+	}
+	wg.Wait()
+	elapsed := time.Since(start)
+	runtime.ReadMemStats(&after)
+	return memDelta{
+		mallocs: after.Mallocs - before.Mallocs,
+		bytes:   after.TotalAlloc - before.TotalAlloc,
+		gcs:     after.NumGC - before.NumGC,
+		pause:   time.Duration(after.PauseTotalNs - before.PauseTotalNs),
+		elapsed: elapsed,
+	}
+}
+
+func pressure() {
+	const n = 500_000
+	for _, workers := range []int{1, 8} {
+		for _, c := range []struct {
+			name string
+			fn   func(*Record)
+		}{{"new buffer per call", handleAlloc}, {"sync.Pool", handlePooled}} {
+			d := measure(workers, n, c.fn)
+			fmt.Printf("  %-20s %d workers: %5.2f allocs/op, %4d B/op, %3d GCs (%v paused), %v\n",
+				c.name, workers, float64(d.mallocs)/n, d.bytes/n, d.gcs,
+				d.pause.Round(time.Microsecond), d.elapsed.Round(time.Millisecond))
+		}
+	}
+}
+
+// ============================================================
+// Demo: pitfalls
+// ============================================================
+
+// countingPool reports how often New had to run, which is how often
+// Get found the pool empty
+func countingPool() (*sync.Pool, *atomic.Int64) {
+	var news atomic.Int64
+	return &sync.Pool{New: func() any {
+		news.Add(1)
+		return new(bytes.Buffer)
+	}}, &news
+}
+
+func pitfalls() {
+	// 1. No size or content guarantee
+	p, news := countingPool()
+	b := p.Get().(*bytes.Buffer)
+	b.WriteString("secret from the previous request")
+	p.Put(b)
+	b = p.Get().(*bytes.Buffer)
+	fmt.Printf("  1. Get after Put, no Reset: %q (cap %d)\n", b.String(), b.Cap())
+	p.Put(b)
+
+	// 2. The GC empties the pool. Objects survive one cycle in the
+	//    victim cache and are gone after the second
+	fmt.Print("  2. Put 100, run the GC, Get 100:")
+	for gcs := range 3 {
+		p, news = countingPool()
+		for range 100 {
+			p.Put(new(bytes.Buffer))
+		}
+		for range gcs {
+			runtime.GC()
+		}
+		for range 100 {
+			p.Get()
+		}
+		fmt.Printf(" %d GCs -> New ran %d times;", gcs, news.Load())
+	}
+	fmt.Println()
+
+	// 3. Big buffers stay big. One 4 MB record makes a 4 MB buffer; put
+	//    back without a cap, it is handed out for tiny records after
+	uncapped := &sync.Pool{New: func() any { return new(bytes.Buffer) }}
+	big := uncapped.Get().(*bytes.Buffer)
+	big.Write(make([]byte, 4<<20))
+	uncapped.Put(big)
+	var retained int
+	for range 10 {
+		b := uncapped.Get().(*bytes.Buffer)
+		b.Reset()
+		b.WriteString("small record")
+		retained = max(retained, b.Cap())
+		uncapped.Put(b)
+	}
+	fmt.Printf("  3. after one 4 MB record, small records get a buffer of %d KB (handlePooled drops buffers over %d KB)\n",
+		retained>>10, maxPooled>>10)
+
+	// 4. Use after Put. The slice still points into the buffer, which
+	//    the next Get hands to someone else
+	p, _ = countingPool()
+	b = p.Get().(*bytes.Buffer)
+	b.WriteString("order=1001 status=paid")
+	view := b.Bytes()
+	p.Put(b)
+	b2 := p.Get().(*bytes.Buffer) // same P, so the same buffer
+	b2.Reset()
+	b2.WriteString("order=2002 status=void")
+	fmt.Printf("  4. a slice kept after Put now reads %q; copy out before Put\n", view)
+	p.Put(b2)
+
+	// 5. Values vs pointers
+	slicePool := sync.Pool{New: func() any { return make([]byte, 0, 512) }}
+	allocs := testingAllocs(func() {
+		s := slicePool.Get().([]byte)
+		slicePool.Put(s[:0]) // the slice header escapes into an interface
+	})
+	ptrAllocs := testingAllocs(func() {
+		b := bufPool.Get().(*bytes.Buffer)
+		bufPool.Put(b)
+	})
+	fmt.Printf("  5. Get+Put of a []byte: %.0f alloc; of a *bytes.Buffer: %.0f\n", allocs, ptrAllocs)
+}
+
+// testingAllocs is testing.AllocsPerRun without importing testing into
+// a main package
+func testingAllocs(fn func()) float64 {
+	const runs = 1000
+	fn() // warm up
+	runtime.GC()
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	for range runs {
+		fn()
+	}
+	runtime.ReadMemStats(&after)
+	return float64(after.Mallocs-before.Mallocs) / runs
+}
+
+func main() {
+	var line bytes.Buffer
+	encode(&line, sampleRecord(7))
+	fmt.Printf("=== Encoding %d-byte log lines ===\n", line.Len())
+	fmt.Print("  ", line.String())
+	pressure()
+
+	fmt.Println("\n=== Pitfalls ===")
+	pitfalls()
+}
@@ -0,0 +1,105 @@
+// sync.Pool Tests - Same output either way, and what reuse saves
+//
+// The test checks that pooled and per-call encoding produce the same
+// bytes, including when a pooled buffer still holds a previous, longer
+// record. Allocation counts are left to the benchmarks: under -race
+// the pool drops a share of Puts on purpose, so they would be flaky as
+// a test. The benchmarks compare allocation per call against the pool,
+// serially and in parallel, and a pool of []byte against one of
+// *bytes.Buffer. Run with -benchmem; the B/op and allocs/op columns are
+// the point.
+//
+// Usage:
+//   go test -v sync_pool.go sync_pool_test.go
+//   go test -run=^$ -bench=. -benchmem sync_pool.go sync_pool_test.go
+package main
+
+import (
+	"bytes"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestPooledMatchesFresh(t *testing.T) {
+	long := sampleRecord(1)
+	long.Msg = strings.Repeat("x", 10_000)
+	for i, r := range []*Record{long, sampleRecord(2), sampleRecord(3)} {
+		var want bytes.Buffer
+		encode(&want, r)
+
+		buf := bufPool.Get().(*bytes.Buffer)
+		buf.Reset()
+		encode(buf, r)
+		if !bytes.Equal(buf.Bytes(), want.Bytes()) {
+			t.Errorf("record %d: pooled %q, want %q", i, buf.Bytes(), want.Bytes())
+		}
+		bufPool.Put(buf)
+	}
+}
+
+func BenchmarkEncode(b *testing.B) {
+	r := sampleRecord(42)
+	b.Run("alloc", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			handleAlloc(r)
+		}
+	})
+	b.Run("pool", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			handlePooled(r)
+		}
+	})
+	// One buffer reused by a single goroutine is the floor the pool is
+	// trying to get close to
+	b.Run("one-buffer", func(b *testing.B) {
+		b.ReportAllocs()
+		var buf bytes.Buffer
+		for b.Loop() {
+			buf.Reset()
+			encode(&buf, r)
+			emit(buf.Bytes())
+		}
+	})
+}
+
+func BenchmarkEncodeParallel(b *testing.B) {
+	r := sampleRecord(42)
+	for _, c := range []struct {
+		name string
+		fn   func(*Record)
+	}{{"alloc", handleAlloc}, {"pool", handlePooled}} {
+		b.Run(c.name, func(b *testing.B) {
+			b.ReportAllocs()
+			b.RunParallel(func(pb *testing.PB) {
+				for pb.Next() {
+					c.fn(r)
+				}
+			})
+		})
+	}
+}
+
+func BenchmarkPoolValueVsPointer(b *testing.B) {
+	slices := sync.Pool{New: func() any { return make([]byte, 0, 512) }}
+	buffers := sync.Pool{New: func() any { return bytes.NewBuffer(make([]byte, 0, 512)) }}
+	b.Run("[]byte", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			s := slices.Get().([]byte)
+			s = append(s[:0], "payload"...)
+			slices.Put(s)
+		}
+	})
+	b.Run("*bytes.Buffer", func(b *testing.B) {
+		b.ReportAllocs()
+		for b.Loop() {
+			buf := buffers.Get().(*bytes.Buffer)
+			buf.Reset()
+			buf.WriteString("payload")
+			buffers.Put(buf)
+		}
+	})
+}
@@ -0,0 +1,261 @@
+// Package timerwheel schedules large numbers of coarse timeouts in
+// constant time.
+//
+// A server with a million connections has a million idle deadlines,
+// nearly all of which are pushed back (activity) or cancelled (the
+// connection closed) long before they fire. Go's runtime timers are a
+// heap per P: every add, stop and reset is O(log n), and each timer is
+// precise to the nanosecond. A timing wheel trades the precision away:
+// time is cut into ticks, and a timer is dropped into the slot for its
+// tick, like a clock face with a list hanging from each hour.
+//
+//	level 0:  64 slots of 1 tick      now -> [ ][x][ ][x][x] ... [ ]
+//	level 1:  64 slots of 64 ticks          [x][ ][ ] ... [x]
+//	level 2:  64 slots of 4096 ticks        ...
+//
+// Adding or stopping a timer is a linked-list insert or unlink, O(1)
+// whatever the number of timers. A timer too far out for level 0 goes
+// in a coarser level, and is moved down (cascaded) when the wheel comes
+// round to its slot, each timer moving at most once per level. Five
+// levels of 64 slots cover 2^30 ticks, 12 days at 1ms; anything later
+// waits at the top level and is re-filed until it is in range.
+//
+// The cost is precision: a timer fires on the first tick at or after
+// its deadline, never early, up to one tick late, plus however far
+// behind the wheel's goroutine is running. That is what idle deadlines
+// and retry backoff need, and not what a 100µs protocol timer needs.
+package timerwheel
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	slotBits = 6
+	slots    = 1 << slotBits // per level
+	levels   = 5
+	// maxDelta is the furthest ahead, in ticks, the levels can file a
+	// timer exactly; later ones are clamped and re-filed
+	maxDelta = 1<<(slotBits*levels) - 1
+)
+
+// Timer is a pending call of a function. Its methods mirror time.Timer
+type Timer struct {
+	w          *Wheel
+	fn         func()
+	expiry     uint64 // the tick it fires on
+	prev, next *Timer // in its slot's list; nil when not pending
+	slot       *Timer // its slot's list head, which marks it pending
+	level      int
+}
+
+// Wheel is safe for concurrent use
+type Wheel struct {
+	tick  time.Duration
+	start time.Time
+	now   func() time.Time
+
+	mu      sync.Mutex
+	current uint64               // ticks since start, processed
+	wheel   [levels][slots]Timer // list heads (sentinels)
+	counts  [levels]int          // timers filed at each level
+	pending int
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// New returns a running wheel that advances every tick. Timers' fns
+// run on the wheel's goroutine, one after another, so they must be
+// quick: set a flag, close a connection, send on a buffered channel.
+// Start a goroutine from fn for anything slower
+func New(tick time.Duration) *Wheel {
+	w := newWheel(tick, time.Now)
+	go w.run()
+	return w
+}
+
+// newWheel returns a wheel that moves only when advance is called
+func newWheel(tick time.Duration, now func() time.Time) *Wheel {
+	if tick <= 0 {
+		panic("timerwheel: tick must be positive")
+	}
+	w := &Wheel{tick: tick, start: now(), now: now, stop: make(chan struct{}), done: make(chan struct{})}
+	for l := range w.wheel {
+		for s := range w.wheel[l] {
+			head := &w.wheel[l][s]
+			head.prev, head.next = head, head
+		}
+	}
+	return w
+}
+
+// AfterFunc calls fn, on the wheel's goroutine, once d has passed
+func (w *Wheel) AfterFunc(d time.Duration, fn func()) *Timer {
+	t := &Timer{w: w, fn: fn}
+	w.mu.Lock()
+	w.schedule(t, d)
+	w.mu.Unlock()
+	return t
+}
+
+// Stop prevents the timer from firing. It reports whether it did: false
+// means the timer had already fired, or been stopped
+func (t *Timer) Stop() bool {
+	t.w.mu.Lock()
+	defer t.w.mu.Unlock()
+	if t.slot == nil {
+		return false
+	}
+	t.w.unlink(t)
+	return true
+}
+
+// Reset makes the timer fire d from now, whether or not it is pending,
+// and reports whether it was. This is the idle-deadline operation: one
+// Reset per read pushes the deadline back
+func (t *Timer) Reset(d time.Duration) bool {
+	t.w.mu.Lock()
+	defer t.w.mu.Unlock()
+	was := t.slot != nil
+	if was {
+		t.w.unlink(t)
+	}
+	t.w.schedule(t, d)
+	return was
+}
+
+// Len is the number of pending timers
+func (w *Wheel) Len() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.pending
+}
+
+// Stop halts the wheel. Pending timers never fire
+func (w *Wheel) Stop() {
+	select {
+	case <-w.stop:
+	default:
+		close(w.stop)
+	}
+	<-w.done
+}
+
+func (w *Wheel) run() {
+	defer close(w.done)
+	t := time.NewTicker(w.tick)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			w.advance()
+		case <-w.stop:
+			return
+		}
+	}
+}
+
+// schedule files t to fire d from now; w.mu held
+func (w *Wheel) schedule(t *Timer, d time.Duration) {
+	// Round up: a timer may fire late by up to a tick, never early. And
+	// at least the next tick, since this one's slot has been processed
+	at := w.now().Sub(w.start) + d
+	t.expiry = max(uint64((at+w.tick-1)/w.tick), w.current+1)
+	w.file(t)
+	w.pending++
+}
+
+// file puts t in the slot for its expiry; w.mu held
+func (w *Wheel) file(t *Timer) {
+	delta := t.expiry - w.current // may be 0 while cascading: fires this tick
+	expiry := t.expiry
+	if delta > maxDelta {
+		delta = maxDelta
+		expiry = w.current + maxDelta // re-filed when the wheel gets there
+	}
+	l := 0
+	for delta >= slots && l < levels-1 {
+		delta >>= slotBits
+		l++
+	}
+	head := &w.wheel[l][(expiry>>(slotBits*l))&(slots-1)]
+	t.slot, t.level = head, l
+	w.counts[l]++
+	t.prev, t.next = head.prev, head
+	head.prev.next = t
+	head.prev = t
+}
+
+// unlink takes t out of its slot; w.mu held
+func (w *Wheel) unlink(t *Timer) {
+	t.prev.next = t.next
+	t.next.prev = t.prev
+	t.prev, t.next, t.slot = nil, nil, nil
+	w.counts[t.level]--
+	w.pending--
+}
+
+// advance processes every tick up to now and runs what fell due, after
+// releasing the lock, so fns can add, stop and reset timers
+func (w *Wheel) advance() {
+	target := uint64(w.now().Sub(w.start) / w.tick)
+	var due []*Timer
+	w.mu.Lock()
+	for w.current < target {
+		// With nothing filed below level l, no tick before the next
+		// level-l boundary can do anything: jump to just before it. A
+		// wheel that slept through an hour catches up in a few steps
+		// instead of 3.6 million
+		l := 0
+		for l < levels && w.counts[l] == 0 {
+			l++
+		}
+		skip := target
+		if l < levels {
+			span := uint64(1) << (slotBits * l)
+			skip = (w.current/span+1)*span - 1
+		}
+		if skip > w.current {
+			w.current = min(skip, target)
+			continue
+		}
+		w.current++
+		due = w.step(due)
+	}
+	w.mu.Unlock()
+	for _, t := range due {
+		t.fn()
+	}
+}
+
+// step handles the tick just reached: cascade each coarser level whose
+// slot boundary this is, then collect level 0's slot, all of which is
+// due now; w.mu held
+func (w *Wheel) step(due []*Timer) []*Timer {
+	for l := levels - 1; l >= 1; l-- {
+		if w.current&(1<<(slotBits*l)-1) != 0 {
+			continue // not a boundary for this level
+		}
+		head := &w.wheel[l][(w.current>>(slotBits*l))&(slots-1)]
+		for t := head.next; t != head; {
+			next := t.next
+			w.counts[l]--
+			w.file(t) // links into a finer level, never back into head
+			t = next
+		}
+		head.prev, head.next = head, head
+	}
+	head := &w.wheel[0][w.current&(slots-1)]
+	for t := head.next; t != head; {
+		next := t.next
+		t.prev, t.next, t.slot = nil, nil, nil
+		w.counts[0]--
+		w.pending--
+		due = append(due, t)
+		t = next
+	}
+	head.prev, head.next = head, head
+	return due
+}
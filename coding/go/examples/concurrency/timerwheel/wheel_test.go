@@ -0,0 +1,323 @@
+package timerwheel
+
+import (
+	"math/rand/v2"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// clock is the time a test wheel sees. Nothing moves it but step,
+// and the wheel runs due fns inside advance, so a fake-clock test
+// stays on one goroutine and the clock needs no lock
+type clock struct{ t time.Time }
+
+func newClock() *clock { return &clock{t: time.Date(2025, 11, 3, 8, 0, 0, 0, time.UTC)} }
+
+func (c *clock) now() time.Time { return c.t }
+
+// step moves the clock and the wheel together, by d in increments of
+// at most inc, as a wheel on a real ticker would see it
+func step(c *clock, w *Wheel, d, inc time.Duration) {
+	for d > 0 {
+		s := min(d, inc)
+		c.t = c.t.Add(s)
+		w.advance()
+		d -= s
+	}
+}
+
+func TestFiresOnTime(t *testing.T) {
+	const tick = time.Millisecond
+	tests := []struct {
+		d    time.Duration
+		want time.Duration // when it fires, after the start
+	}{
+		{0, 1 * tick}, // the next tick, never the current one
+		{1 * tick, 1 * tick},
+		{1500 * time.Microsecond, 2 * tick}, // rounded up, not down
+		{63 * tick, 63 * tick},              // the last slot of level 0
+		{64 * tick, 64 * tick},              // the first of level 1
+		{65 * tick, 65 * tick},
+		{4095 * tick, 4095 * tick},
+		{4096 * tick, 4096 * tick}, // level 2
+		{100_000 * tick, 100_000 * tick},
+		{5_000_000 * tick, 5_000_000 * tick}, // level 3
+	}
+	for _, tt := range tests {
+		c := newClock()
+		w := newWheel(tick, c.now)
+		start := c.now()
+		var fired time.Duration = -1
+		w.AfterFunc(tt.d, func() { fired = c.now().Sub(start) })
+		// Walk up to the deadline a tick at a time near it, in big
+		// jumps before, which is how a wheel that fell behind sees it
+		if far := tt.want - 10*tick; far > 0 {
+			step(c, w, far, 997*tick)
+		}
+		step(c, w, tt.want-c.now().Sub(start)-tick, tick)
+		if fired != -1 {
+			t.Errorf("AfterFunc(%v) fired early, at %v", tt.d, fired)
+			continue
+		}
+		step(c, w, tick, tick)
+		if fired != tt.want {
+			t.Errorf("AfterFunc(%v) fired at %v, want %v", tt.d, fired, tt.want)
+		}
+		if n := w.Len(); n != 0 {
+			t.Errorf("AfterFunc(%v): %d still pending", tt.d, n)
+		}
+	}
+}
+
+func TestBeyondTheLevels(t *testing.T) {
+	// Past 2^30 ticks a timer is clamped and re-filed, possibly more than
+	// once. A one-second tick makes that 34 years; the wheel jumps
+	c := newClock()
+	w := newWheel(time.Second, c.now)
+	start := c.now()
+	d := time.Duration(maxDelta+12345) * 3 * time.Second
+	var fired time.Time
+	w.AfterFunc(d, func() { fired = c.now() })
+	step(c, w, d-time.Second, 1<<20*time.Second)
+	if !fired.IsZero() {
+		t.Fatalf("fired early, after %v of %v", fired.Sub(start), d)
+	}
+	step(c, w, time.Second, time.Second)
+	if got := fired.Sub(start); got != d {
+		t.Errorf("fired after %v, want %v", got, d)
+	}
+}
+
+func TestStopAndReset(t *testing.T) {
+	c := newClock()
+	w := newWheel(time.Millisecond, c.now)
+	var fired atomic.Int32
+	tm := w.AfterFunc(10*time.Millisecond, func() { fired.Add(1) })
+
+	if !tm.Stop() {
+		t.Error("Stop on a pending timer = false")
+	}
+	if tm.Stop() {
+		t.Error("second Stop = true")
+	}
+	step(c, w, 20*time.Millisecond, time.Millisecond)
+	if fired.Load() != 0 {
+		t.Fatal("stopped timer fired")
+	}
+
+	// Reset revives a stopped timer; repeated Resets keep pushing it back
+	if tm.Reset(10 * time.Millisecond) {
+		t.Error("Reset on a stopped timer = true")
+	}
+	for range 5 {
+		step(c, w, 8*time.Millisecond, time.Millisecond)
+		if !tm.Reset(10 * time.Millisecond) {
+			t.Error("Reset on a pending timer = false")
+		}
+	}
+	if fired.Load() != 0 {
+		t.Fatal("fired despite being pushed back")
+	}
+	step(c, w, 10*time.Millisecond, time.Millisecond)
+	if fired.Load() != 1 {
+		t.Errorf("fired %d times, want once", fired.Load())
+	}
+	if tm.Stop() {
+		t.Error("Stop after firing = true")
+	}
+}
+
+func TestFnCanUseTheWheel(t *testing.T) {
+	// fns run without the lock held: a retry can schedule its next try
+	c := newClock()
+	w := newWheel(time.Millisecond, c.now)
+	var tries []time.Duration
+	start := c.now()
+	var retry func()
+	retry = func() {
+		tries = append(tries, c.now().Sub(start))
+		if len(tries) < 4 {
+			w.AfterFunc(time.Duration(len(tries))*10*time.Millisecond, retry) // backoff
+		}
+	}
+	w.AfterFunc(10*time.Millisecond, retry)
+	step(c, w, time.Second, time.Millisecond)
+	want := []time.Duration{10, 20, 40, 70}
+	for i := range want {
+		want[i] *= time.Millisecond
+	}
+	if len(tries) != len(want) {
+		t.Fatalf("tries at %v, want %v", tries, want)
+	}
+	for i := range want {
+		if tries[i] != want[i] {
+			t.Fatalf("tries at %v, want %v", tries, want)
+		}
+	}
+}
+
+func TestManyRandom(t *testing.T) {
+	// Many timers, random deadlines across every level, random stops:
+	// each unstopped one fires exactly once, on its tick
+	c := newClock()
+	w := newWheel(time.Millisecond, c.now)
+	start := c.now()
+	rng := rand.New(rand.NewPCG(1, 2))
+	const n = 20_000
+	due := make([]time.Duration, n)
+	firedAt := make([]time.Duration, n)
+	timers := make([]*Timer, n)
+	for i := range n {
+		due[i] = time.Duration(1+rng.IntN(300_000)) * time.Millisecond
+		timers[i] = w.AfterFunc(due[i], func() {
+			if firedAt[i] != 0 {
+				t.Errorf("timer %d fired twice", i)
+			}
+			firedAt[i] = c.now().Sub(start)
+		})
+	}
+	stopped := map[int]bool{}
+	for range n / 4 {
+		i := rng.IntN(n)
+		stopped[i] = true
+		timers[i].Stop()
+	}
+	if got := w.Len(); got != n-len(stopped) {
+		t.Errorf("Len = %d, want %d", got, n-len(stopped))
+	}
+	step(c, w, 301*time.Second, 7*time.Millisecond) // a wheel running behind
+	for i := range n {
+		switch {
+		case stopped[i] && firedAt[i] != 0:
+			t.Errorf("timer %d fired after Stop", i)
+		case !stopped[i] && (firedAt[i] < due[i] || firedAt[i] >= due[i]+7*time.Millisecond):
+			t.Errorf("timer %d due at %v fired at %v", i, due[i], firedAt[i])
+		}
+	}
+	if n := w.Len(); n != 0 {
+		t.Errorf("%d still pending", n)
+	}
+}
+
+func TestRealClock(t *testing.T) {
+	w := New(time.Millisecond)
+	defer w.Stop()
+	fired := make(chan time.Time, 1)
+	start := time.Now()
+	w.AfterFunc(20*time.Millisecond, func() { fired <- time.Now() })
+	select {
+	case at := <-fired:
+		if at.Sub(start) < 20*time.Millisecond {
+			t.Errorf("fired after %v, before its deadline", at.Sub(start))
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("never fired")
+	}
+	w.Stop() // twice is fine
+}
+
+func TestConcurrentUse(t *testing.T) {
+	// Run with -race: timers added, reset and stopped from many
+	// goroutines while the wheel turns
+	w := New(time.Millisecond)
+	defer w.Stop()
+	var fired atomic.Int64
+	var wg sync.WaitGroup
+	for g := range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rng := rand.New(rand.NewPCG(uint64(g), 0))
+			for range 500 {
+				tm := w.AfterFunc(time.Duration(rng.IntN(5))*time.Millisecond, func() { fired.Add(1) })
+				switch rng.IntN(3) {
+				case 0:
+					tm.Stop()
+				case 1:
+					tm.Reset(time.Millisecond)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	deadline := time.Now().Add(2 * time.Second)
+	for w.Len() > 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if n := w.Len(); n != 0 {
+		t.Errorf("%d timers never fired", n)
+	}
+}
+
+// ============================================================
+// Benchmarks
+// ============================================================
+
+// BenchmarkAddStop is the life of most idle deadlines: set, then
+// cancelled. The pending column is how many other timers are waiting,
+// which costs the runtime's heap a log factor and the wheel nothing
+func BenchmarkAddStop(b *testing.B) {
+	for _, pending := range []int{0, 100_000, 1_000_000} {
+		b.Run("wheel/pending-"+itoa(pending), func(b *testing.B) {
+			w := New(time.Millisecond)
+			defer w.Stop()
+			for i := range pending {
+				w.AfterFunc(time.Hour+time.Duration(i), func() {})
+			}
+			b.ResetTimer()
+			for range b.N {
+				w.AfterFunc(time.Minute, func() {}).Stop()
+			}
+		})
+		b.Run("time.AfterFunc/pending-"+itoa(pending), func(b *testing.B) {
+			timers := make([]*time.Timer, pending)
+			for i := range timers {
+				timers[i] = time.AfterFunc(time.Hour+time.Duration(i), func() {})
+			}
+			defer func() {
+				for _, t := range timers {
+					t.Stop()
+				}
+			}()
+			b.ResetTimer()
+			for range b.N {
+				time.AfterFunc(time.Minute, func() {}).Stop()
+			}
+		})
+	}
+}
+
+// BenchmarkReset is an idle deadline pushed back on every read. With
+// one timer the runtime wins: its Reset marks the timer and fixes the
+// heap later, while the wheel pays for time.Now and a lock every time
+func BenchmarkReset(b *testing.B) {
+	b.Run("wheel", func(b *testing.B) {
+		w := New(time.Millisecond)
+		defer w.Stop()
+		tm := w.AfterFunc(time.Minute, func() {})
+		for range b.N {
+			tm.Reset(time.Minute)
+		}
+	})
+	b.Run("time.Timer", func(b *testing.B) {
+		tm := time.AfterFunc(time.Minute, func() {})
+		defer tm.Stop()
+		for range b.N {
+			tm.Reset(time.Minute)
+		}
+	})
+}
+
+func itoa(n int) string {
+	switch n {
+	case 0:
+		return "0"
+	case 100_000:
+		return "100k"
+	case 1_000_000:
+		return "1M"
+	}
+	return "?"
+}
@@ -6,14 +6,25 @@
 // - Each job is independent
 // - You want to limit concurrent operations
 //
+// The pool supports two shutdown modes:
+// - Close(): stop accepting jobs, finish everything already queued
+// - Abort(): stop accepting jobs, drop the queue, cancel in-flight jobs
+//
 // Usage:
 //   go run worker_pool.go
+//   (Press Ctrl+C once to drain, twice to abort)
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"math/rand"
+	"os"
+	"os/signal"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 )
 
@@ -28,73 +39,209 @@ type Result struct {
 	JobID    int
 	Output   string
 	Duration time.Duration
+	Err      error // context.Canceled if the job was aborted mid-flight
 }
 
-func main() {
-	// Configuration
-	numWorkers := 3
-	numJobs := 10
+// ErrPoolClosed is returned by Submit after Close or Abort
+var ErrPoolClosed = errors.New("pool closed")
 
-	// Create channels
-	jobs := make(chan Job, numJobs)
-	results := make(chan Result, numJobs)
+// Pool runs submitted jobs on a fixed number of workers.
+//
+// Guarantees about the Results channel:
+//   - It is closed exactly once, after every worker has exited,
+//     whichever of Close or Abort is called (or both).
+//   - After Close, every job accepted by Submit produces one Result.
+//   - After Abort, queued jobs that never started produce no Result;
+//     jobs already running produce a Result with Err set.
+//
+// The caller must keep reading Results until it is closed, otherwise
+// workers block on send and shutdown never completes.
+type Pool struct {
+	jobs    chan Job
+	results chan Result
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu        sync.RWMutex // guards closed against concurrent Submit
+	closed    bool
+	closeJobs sync.Once
+	dropped   atomic.Int64
+}
 
-	// Start workers
-	var wg sync.WaitGroup
-	for w := 1; w <= numWorkers; w++ {
-		wg.Add(1)
-		go worker(w, jobs, results, &wg)
+// NewPool starts numWorkers workers reading from a queue of queueSize
+func NewPool(numWorkers, queueSize int) *Pool {
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &Pool{
+		jobs:    make(chan Job, queueSize),
+		results: make(chan Result),
+		ctx:     ctx,
+		cancel:  cancel,
 	}
 
-	// Send jobs
-	for j := 1; j <= numJobs; j++ {
-		jobs <- Job{
-			ID:      j,
-			Payload: fmt.Sprintf("data-%d", j),
-		}
+	for w := 1; w <= numWorkers; w++ {
+		p.wg.Add(1)
+		go p.worker(w)
 	}
-	close(jobs) // No more jobs
 
-	// Wait for workers to finish
+	// Close results once all workers are gone
 	go func() {
-		wg.Wait()
-		close(results)
+		p.wg.Wait()
+		close(p.results)
 	}()
 
-	// Collect results
-	fmt.Println("Results:")
-	fmt.Println("--------")
-	for result := range results {
-		fmt.Printf("Job %d: %s (took %v)\n",
-			result.JobID, result.Output, result.Duration)
+	return p
+}
+
+// Submit queues a job, blocking while the queue is full
+func (p *Pool) Submit(job Job) error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.closed {
+		return ErrPoolClosed
+	}
+
+	select {
+	case p.jobs <- job:
+		return nil
+	case <-p.ctx.Done():
+		return ErrPoolClosed
 	}
 }
 
-func worker(id int, jobs <-chan Job, results chan<- Result, wg *sync.WaitGroup) {
-	defer wg.Done()
+// Results returns the channel on which job results are delivered
+func (p *Pool) Results() <-chan Result {
+	return p.results
+}
+
+// Close stops accepting jobs and lets workers drain the queue.
+// It returns immediately; Results is closed when the drain completes.
+func (p *Pool) Close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.closed = true
+	p.closeJobs.Do(func() { close(p.jobs) })
+}
+
+// Abort stops accepting jobs, drops everything still queued and
+// cancels jobs that are currently running.
+func (p *Pool) Abort() {
+	// Cancel first so a Submit blocked on a full queue lets go of mu
+	p.cancel()
+
+	p.mu.Lock()
+	p.closed = true
+	p.closeJobs.Do(func() { close(p.jobs) })
+	p.mu.Unlock()
+
+	// Drain whatever the workers haven't picked up
+	for range p.jobs {
+		p.dropped.Add(1)
+	}
+}
+
+// Dropped reports how many queued jobs were discarded by Abort
+func (p *Pool) Dropped() int64 {
+	return p.dropped.Load()
+}
+
+func (p *Pool) worker(id int) {
+	defer p.wg.Done()
+
+	for job := range p.jobs {
+		// A job dequeued after Abort is dropped, not started
+		if p.ctx.Err() != nil {
+			p.dropped.Add(1)
+			continue
+		}
 
-	for job := range jobs {
 		fmt.Printf("Worker %d started job %d\n", id, job.ID)
 		start := time.Now()
 
 		// Simulate work
-		output := processJob(job)
+		output, err := processJob(p.ctx, job)
 
 		duration := time.Since(start)
 		fmt.Printf("Worker %d finished job %d\n", id, job.ID)
 
-		results <- Result{
+		p.results <- Result{
 			JobID:    job.ID,
 			Output:   output,
 			Duration: duration,
+			Err:      err,
+		}
+	}
+}
+
+func main() {
+	// Configuration
+	numWorkers := 3
+	numJobs := 20
+
+	pool := NewPool(numWorkers, numJobs)
+
+	// First Ctrl+C drains the queue, second one aborts
+	sigChan := make(chan os.Signal, 2)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+
+	go func() {
+		<-sigChan
+		fmt.Println("\nSignal received: draining queued jobs (Ctrl+C again to abort)")
+		pool.Close()
+
+		<-sigChan
+		fmt.Println("\nSecond signal: aborting")
+		pool.Abort()
+	}()
+
+	// Send jobs
+	go func() {
+		for j := 1; j <= numJobs; j++ {
+			err := pool.Submit(Job{
+				ID:      j,
+				Payload: fmt.Sprintf("data-%d", j),
+			})
+			if err != nil {
+				fmt.Printf("Job %d not submitted: %v\n", j, err)
+				return
+			}
+		}
+		pool.Close() // No more jobs
+	}()
+
+	// Collect results until the pool closes the channel
+	var completed, cancelled int
+	for result := range pool.Results() {
+		if result.Err != nil {
+			cancelled++
+			fmt.Printf("Job %d: cancelled after %v (%v)\n",
+				result.JobID, result.Duration, result.Err)
+			continue
 		}
+		completed++
+		fmt.Printf("Job %d: %s (took %v)\n",
+			result.JobID, result.Output, result.Duration)
 	}
+
+	fmt.Println()
+	fmt.Println("Summary:")
+	fmt.Println("--------")
+	fmt.Printf("Completed: %d\n", completed)
+	fmt.Printf("Cancelled: %d\n", cancelled)
+	fmt.Printf("Dropped:   %d\n", pool.Dropped())
 }
 
-func processJob(job Job) string {
+func processJob(ctx context.Context, job Job) (string, error) {
 	// Simulate variable processing time
 	sleepTime := time.Duration(100+rand.Intn(400)) * time.Millisecond
-	time.Sleep(sleepTime)
 
-	return fmt.Sprintf("processed(%s)", job.Payload)
+	select {
+	case <-time.After(sleepTime):
+		return fmt.Sprintf("processed(%s)", job.Payload), nil
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
 }
@@ -0,0 +1,160 @@
+// Worker Pool Benchmarks - When does a pool actually help?
+//
+// These benchmarks push the same batch of jobs through several
+// execution strategies:
+// - A fixed pool with 1, NumCPU and 4×NumCPU workers
+// - One goroutine per job (unbounded)
+// - One goroutine per job, NumCPU at a time (a channel semaphore)
+//
+// Each strategy runs two workloads:
+// - cpu: hashing, so extra workers beyond NumCPU only add overhead
+// - io:  sleeping, so more concurrency hides latency
+//
+// Usage:
+//   go test -bench=. -benchmem worker_pool.go worker_pool_test.go
+package main
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+// cpuWork burns CPU by repeatedly hashing the payload
+func cpuWork(job Job) string {
+	sum := sha256.Sum256([]byte(job.Payload))
+	for i := 0; i < 50; i++ {
+		sum = sha256.Sum256(sum[:])
+	}
+	return fmt.Sprintf("%x", sum[:4])
+}
+
+// ioWork simulates waiting on a network or disk call
+func ioWork(job Job) string {
+	time.Sleep(50 * time.Microsecond)
+	return job.Payload
+}
+
+func makeJobs(n int) []Job {
+	jobs := make([]Job, n)
+	for i := range jobs {
+		jobs[i] = Job{ID: i + 1, Payload: fmt.Sprintf("data-%d", i+1)}
+	}
+	return jobs
+}
+
+// runPool is the same fixed-size pool as Pool, minus the logging and
+// shutdown modes
+func runPool(numWorkers int, jobs []Job, process func(Job) string) []Result {
+	jobCh := make(chan Job, len(jobs))
+	resultCh := make(chan Result, len(jobs))
+
+	var wg sync.WaitGroup
+	for w := 0; w < numWorkers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for job := range jobCh {
+				start := time.Now()
+				output := process(job)
+				resultCh <- Result{JobID: job.ID, Output: output, Duration: time.Since(start)}
+			}
+		}()
+	}
+
+	for _, job := range jobs {
+		jobCh <- job
+	}
+	close(jobCh)
+
+	wg.Wait()
+	close(resultCh)
+
+	results := make([]Result, 0, len(jobs))
+	for r := range resultCh {
+		results = append(results, r)
+	}
+	return results
+}
+
+// runUnbounded starts one goroutine per job - no pool at all
+func runUnbounded(jobs []Job, process func(Job) string) []Result {
+	results := make([]Result, len(jobs))
+
+	var wg sync.WaitGroup
+	for i, job := range jobs {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			start := time.Now()
+			output := process(job)
+			results[i] = Result{JobID: job.ID, Output: output, Duration: time.Since(start)}
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+// runSemaphore starts a goroutine per job but lets only limit of them
+// run at once: a send on sem takes a slot, blocking while all are
+// taken, and a receive gives it back
+func runSemaphore(limit int, jobs []Job, process func(Job) string) []Result {
+	results := make([]Result, len(jobs))
+	sem := make(chan struct{}, limit)
+
+	var wg sync.WaitGroup
+	for i, job := range jobs {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			start := time.Now()
+			output := process(job)
+			results[i] = Result{JobID: job.ID, Output: output, Duration: time.Since(start)}
+		}()
+	}
+	wg.Wait()
+	return results
+}
+
+func BenchmarkPool(b *testing.B) {
+	workloads := []struct {
+		name    string
+		numJobs int
+		process func(Job) string
+	}{
+		{"cpu", 1000, cpuWork},
+		{"io", 200, ioWork},
+	}
+
+	numCPU := runtime.NumCPU()
+	strategies := []struct {
+		name string
+		run  func([]Job, func(Job) string) []Result
+	}{
+		{"workers=1", func(j []Job, p func(Job) string) []Result { return runPool(1, j, p) }},
+		{"workers=NumCPU", func(j []Job, p func(Job) string) []Result { return runPool(numCPU, j, p) }},
+		{"workers=4xNumCPU", func(j []Job, p func(Job) string) []Result { return runPool(4*numCPU, j, p) }},
+		{"unbounded", runUnbounded},
+		{"semaphore=NumCPU", func(j []Job, p func(Job) string) []Result { return runSemaphore(numCPU, j, p) }},
+	}
+
+	for _, w := range workloads {
+		jobs := makeJobs(w.numJobs)
+		for _, s := range strategies {
+			b.Run(w.name+"/"+s.name, func(b *testing.B) {
+				b.ReportAllocs()
+				for i := 0; i < b.N; i++ {
+					if got := s.run(jobs, w.process); len(got) != len(jobs) {
+						b.Fatalf("got %d results; want %d", len(got), len(jobs))
+					}
+				}
+				// Throughput in jobs per second across all iterations
+				b.ReportMetric(float64(len(jobs)*b.N)/b.Elapsed().Seconds(), "jobs/s")
+			})
+		}
+	}
+}
@@ -0,0 +1,725 @@
+// Authoritative DNS Server - A real wire protocol over UDP and TCP
+//
+// binary_protocol.go parses a made-up header. This example applies the
+// same techniques (big-endian fields, bit flags, length prefixes) to
+// DNS as defined in RFC 1035, and serves a small zone:
+// - A, AAAA and TXT answers, with the AA (authoritative) bit set
+// - NXDOMAIN for names that don't exist, NODATA (NOERROR, no answers)
+//   for names that exist without that type, both with the zone's SOA
+//   so resolvers can cache the negative answer
+// - REFUSED for names outside the zone: we're not a resolver
+// - Name compression: answers point back at the question's name
+// - UDP with the classic 512-byte limit; oversized answers set the TC
+//   (truncated) bit and the client retries over TCP, where each
+//   message carries a 2-byte length prefix
+//
+// Usage:
+//   go run dns_server.go                      # server + demo queries
+//   go run dns_server.go server               # server only
+//   go run dns_server.go query www.example.test A
+//   go run dns_server.go -zone my.zone server # load your own zone
+//
+// Zone file format (one record per line, a tiny subset of RFC 1035):
+//   www.example.test.  300  A     192.0.2.10
+//   www.example.test.  300  AAAA  2001:db8::10
+//   example.test.      300  TXT   "v=spf1 -all"
+//
+// Test with dig while the server runs:
+//   dig @127.0.0.1 -p 5353 www.example.test A
+//   dig @127.0.0.1 -p 5353 big.example.test TXT     (watch it retry over TCP)
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/netip"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const listenAddr = "127.0.0.1:5353"
+
+// maxUDPSize is the payload limit for DNS over UDP without EDNS(0)
+const maxUDPSize = 512
+
+// Record types and class from RFC 1035 (AAAA from RFC 3596)
+const (
+	TypeA    uint16 = 1
+	TypeSOA  uint16 = 6
+	TypeTXT  uint16 = 16
+	TypeAAAA uint16 = 28
+	ClassIN  uint16 = 1
+)
+
+var typeNames = map[uint16]string{TypeA: "A", TypeSOA: "SOA", TypeTXT: "TXT", TypeAAAA: "AAAA"}
+
+// Response codes (the low 4 bits of the flags)
+const (
+	RcodeSuccess  = 0
+	RcodeFormErr  = 1
+	RcodeNXDomain = 3
+	RcodeNotImp   = 4
+	RcodeRefused  = 5
+)
+
+var rcodeNames = map[int]string{0: "NOERROR", 1: "FORMERR", 3: "NXDOMAIN", 4: "NOTIMP", 5: "REFUSED"}
+
+// ============================================================
+// Wire format
+// ============================================================
+
+// DNS header (12 bytes):
+//   0  1  2  3  4  5  6  7  8  9 10 11 12 13 14 15
+//  +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+//  |                      ID                       |
+//  +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+//  |QR|   Opcode  |AA|TC|RD|RA|   Z    |   RCODE   |
+//  +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+//  |          QDCOUNT / ANCOUNT / NSCOUNT / ARCOUNT |
+//  +--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+--+
+
+// Header flag bits
+const (
+	FlagQR uint16 = 1 << 15 // response
+	FlagAA uint16 = 1 << 10 // authoritative answer
+	FlagTC uint16 = 1 << 9  // truncated
+	FlagRD uint16 = 1 << 8  // recursion desired (echoed back)
+)
+
+// Header is the fixed 12-byte start of every DNS message
+type Header struct {
+	ID      uint16
+	Flags   uint16
+	QDCount uint16
+	ANCount uint16
+	NSCount uint16
+	ARCount uint16
+}
+
+func (h Header) Rcode() int { return int(h.Flags & 0xF) }
+
+// Question is what is being asked: name, type, class
+type Question struct {
+	Name  string // fully qualified, lower case, with trailing dot
+	Type  uint16
+	Class uint16
+}
+
+// Record is a resource record; Data is the type-specific RDATA
+type Record struct {
+	Name string
+	Type uint16
+	TTL  uint32
+	Data []byte
+}
+
+// Message is a whole query or response
+type Message struct {
+	Header     Header
+	Questions  []Question
+	Answers    []Record
+	Authority  []Record
+	Additional []Record
+}
+
+var errShort = errors.New("dns: message too short")
+
+// appendName encodes www.example.test. as 3www7example4test0. If the
+// name equals the first question's, it writes a 2-byte compression
+// pointer to offset 12 (right after the header) instead.
+func appendName(b []byte, name string, questionName string) []byte {
+	if questionName != "" && name == questionName {
+		return binary.BigEndian.AppendUint16(b, 0xC000|12)
+	}
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		if label == "" {
+			continue
+		}
+		b = append(b, byte(len(label)))
+		b = append(b, label...)
+	}
+	return append(b, 0)
+}
+
+// checkName rejects names appendName can't encode: a label must be 1
+// to 63 bytes, since a length byte with the top two bits set reads as
+// a compression pointer, and the whole name at most 255 bytes on the
+// wire, which is its dotted form plus one
+func checkName(name string) error {
+	if !strings.HasSuffix(name, ".") {
+		return fmt.Errorf("%q is not fully qualified", name)
+	}
+	if name == "." {
+		return nil
+	}
+	if n := len(name) + 1; n > 255 {
+		return fmt.Errorf("%q is %d bytes on the wire, over 255", name, n)
+	}
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		if label == "" || len(label) > 63 {
+			return fmt.Errorf("%q has a %d-byte label, want 1 to 63", name, len(label))
+		}
+	}
+	return nil
+}
+
+// readName decodes a possibly-compressed name starting at off and
+// returns it with the offset just past it in the original position
+func readName(msg []byte, off int) (string, int, error) {
+	var labels []string
+	end := -1 // where parsing resumes once we've followed a pointer
+	for jumps := 0; ; {
+		if off >= len(msg) {
+			return "", 0, errShort
+		}
+		n := int(msg[off])
+		switch {
+		case n == 0:
+			if end < 0 {
+				end = off + 1
+			}
+			return strings.ToLower(strings.Join(labels, ".")) + ".", end, nil
+		case n&0xC0 == 0xC0: // pointer: top two bits set
+			if off+1 >= len(msg) {
+				return "", 0, errShort
+			}
+			if end < 0 {
+				end = off + 2
+			}
+			// A malicious packet can make pointers loop; cap the jumps
+			if jumps++; jumps > 10 {
+				return "", 0, errors.New("dns: compression loop")
+			}
+			off = int(binary.BigEndian.Uint16(msg[off:]) & 0x3FFF)
+		default:
+			if off+1+n > len(msg) {
+				return "", 0, errShort
+			}
+			labels = append(labels, string(msg[off+1:off+1+n]))
+			off += 1 + n
+		}
+	}
+}
+
+// Pack serializes the message
+func (m *Message) Pack() []byte {
+	b := make([]byte, 12, maxUDPSize)
+	h := m.Header
+	h.QDCount, h.ANCount = uint16(len(m.Questions)), uint16(len(m.Answers))
+	h.NSCount, h.ARCount = uint16(len(m.Authority)), uint16(len(m.Additional))
+	binary.BigEndian.PutUint16(b[0:], h.ID)
+	binary.BigEndian.PutUint16(b[2:], h.Flags)
+	binary.BigEndian.PutUint16(b[4:], h.QDCount)
+	binary.BigEndian.PutUint16(b[6:], h.ANCount)
+	binary.BigEndian.PutUint16(b[8:], h.NSCount)
+	binary.BigEndian.PutUint16(b[10:], h.ARCount)
+
+	qname := ""
+	for i, q := range m.Questions {
+		b = appendName(b, q.Name, "")
+		b = binary.BigEndian.AppendUint16(b, q.Type)
+		b = binary.BigEndian.AppendUint16(b, q.Class)
+		if i == 0 {
+			qname = q.Name
+		}
+	}
+	for _, sec := range [][]Record{m.Answers, m.Authority, m.Additional} {
+		for _, r := range sec {
+			b = appendName(b, r.Name, qname)
+			b = binary.BigEndian.AppendUint16(b, r.Type)
+			b = binary.BigEndian.AppendUint16(b, ClassIN)
+			b = binary.BigEndian.AppendUint32(b, r.TTL)
+			b = binary.BigEndian.AppendUint16(b, uint16(len(r.Data)))
+			b = append(b, r.Data...)
+		}
+	}
+	return b
+}
+
+// Unpack parses a message. RDATA is kept raw; SOA RDATA contains
+// names that may be compressed, so it is only meaningful alongside msg.
+func Unpack(msg []byte) (*Message, error) {
+	if len(msg) < 12 {
+		return nil, errShort
+	}
+	m := &Message{Header: Header{
+		ID:      binary.BigEndian.Uint16(msg[0:]),
+		Flags:   binary.BigEndian.Uint16(msg[2:]),
+		QDCount: binary.BigEndian.Uint16(msg[4:]),
+		ANCount: binary.BigEndian.Uint16(msg[6:]),
+		NSCount: binary.BigEndian.Uint16(msg[8:]),
+		ARCount: binary.BigEndian.Uint16(msg[10:]),
+	}}
+	off := 12
+	for range m.Header.QDCount {
+		name, next, err := readName(msg, off)
+		if err != nil {
+			return nil, err
+		}
+		if next+4 > len(msg) {
+			return nil, errShort
+		}
+		m.Questions = append(m.Questions, Question{
+			Name:  name,
+			Type:  binary.BigEndian.Uint16(msg[next:]),
+			Class: binary.BigEndian.Uint16(msg[next+2:]),
+		})
+		off = next + 4
+	}
+
+	readRecords := func(count uint16) ([]Record, error) {
+		var rrs []Record
+		for range count {
+			name, next, err := readName(msg, off)
+			if err != nil {
+				return nil, err
+			}
+			if next+10 > len(msg) {
+				return nil, errShort
+			}
+			rdlen := int(binary.BigEndian.Uint16(msg[next+8:]))
+			if next+10+rdlen > len(msg) {
+				return nil, errShort
+			}
+			rrs = append(rrs, Record{
+				Name: name,
+				Type: binary.BigEndian.Uint16(msg[next:]),
+				TTL:  binary.BigEndian.Uint32(msg[next+4:]),
+				Data: msg[next+10 : next+10+rdlen],
+			})
+			off = next + 10 + rdlen
+		}
+		return rrs, nil
+	}
+	var err error
+	if m.Answers, err = readRecords(m.Header.ANCount); err != nil {
+		return nil, err
+	}
+	if m.Authority, err = readRecords(m.Header.NSCount); err != nil {
+		return nil, err
+	}
+	// A truncated UDP reply may end early; keep what was parsed
+	if m.Additional, err = readRecords(m.Header.ARCount); err != nil && m.Header.Flags&FlagTC == 0 {
+		return nil, err
+	}
+	return m, nil
+}
+
+// ============================================================
+// Zone
+// ============================================================
+
+// Zone holds the records we are authoritative for
+type Zone struct {
+	Origin  string
+	SOA     Record
+	Records map[string][]Record // by owner name
+}
+
+const defaultZone = `
+example.test.        300  TXT   "v=spf1 -all"
+www.example.test.    300  A     192.0.2.10
+www.example.test.    300  A     192.0.2.11
+www.example.test.    300  AAAA  2001:db8::10
+mail.example.test.   300  A     192.0.2.25
+v4only.example.test. 300  A     192.0.2.40
+`
+
+// ParseZone reads the tiny zone format described at the top
+func ParseZone(r io.Reader, origin string) (*Zone, error) {
+	origin = strings.ToLower(origin)
+	if err := checkName(origin); err != nil {
+		return nil, fmt.Errorf("zone origin: %w", err)
+	}
+	z := &Zone{Origin: origin, Records: map[string][]Record{}}
+
+	// A fixed SOA; its last field (minimum TTL) is how long resolvers
+	// may cache NXDOMAIN/NODATA answers (RFC 2308)
+	soa := appendName(nil, "ns1."+origin, "")
+	soa = appendName(soa, "hostmaster."+origin, "")
+	for _, v := range []uint32{2025010101, 3600, 600, 86400, 60} { // serial, refresh, retry, expire, minimum
+		soa = binary.BigEndian.AppendUint32(soa, v)
+	}
+	z.SOA = Record{Name: origin, Type: TypeSOA, TTL: 300, Data: soa}
+
+	sc := bufio.NewScanner(r)
+	for line := 1; sc.Scan(); line++ {
+		text := strings.TrimSpace(sc.Text())
+		if text == "" || strings.HasPrefix(text, ";") {
+			continue
+		}
+		fields := strings.Fields(text)
+		if len(fields) < 4 {
+			return nil, fmt.Errorf("zone line %d: want NAME TTL TYPE DATA", line)
+		}
+		name := strings.ToLower(fields[0])
+		if err := checkName(name); err != nil {
+			return nil, fmt.Errorf("zone line %d: %w", line, err)
+		}
+		// A suffix match alone would put badexample.test. in
+		// example.test.: the name must end at a label boundary
+		if name != origin && !strings.HasSuffix(name, "."+origin) {
+			return nil, fmt.Errorf("zone line %d: %s is not in %s", line, name, origin)
+		}
+		ttl, err := strconv.ParseUint(fields[1], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("zone line %d: bad TTL: %w", line, err)
+		}
+
+		rec := Record{Name: name, TTL: uint32(ttl)}
+		data := strings.Join(fields[3:], " ")
+		switch strings.ToUpper(fields[2]) {
+		case "A", "AAAA":
+			ip, err := netip.ParseAddr(data)
+			if err != nil {
+				return nil, fmt.Errorf("zone line %d: %w", line, err)
+			}
+			rec.Type = TypeA
+			if !ip.Is4() {
+				rec.Type = TypeAAAA
+			}
+			if strings.ToUpper(fields[2]) == "A" != ip.Is4() {
+				return nil, fmt.Errorf("zone line %d: %s is wrong for a %s record", line, ip, fields[2])
+			}
+			rec.Data = ip.AsSlice()
+		case "TXT":
+			s, err := strconv.Unquote(data)
+			if err != nil {
+				return nil, fmt.Errorf("zone line %d: TXT data must be quoted: %w", line, err)
+			}
+			rec.Type, rec.Data = TypeTXT, packTXT(s)
+		default:
+			return nil, fmt.Errorf("zone line %d: unsupported type %s", line, fields[2])
+		}
+		z.Records[name] = append(z.Records[name], rec)
+	}
+	return z, sc.Err()
+}
+
+// packTXT splits s into <=255-byte character-strings, each prefixed
+// with its length
+func packTXT(s string) []byte {
+	var b []byte
+	for {
+		n := min(len(s), 255)
+		b = append(b, byte(n))
+		b = append(b, s[:n]...)
+		s = s[n:]
+		if s == "" {
+			return b
+		}
+	}
+}
+
+// Answer builds the response to one query
+func (z *Zone) Answer(q *Message) *Message {
+	resp := &Message{
+		Header:    Header{ID: q.Header.ID, Flags: FlagQR | q.Header.Flags&FlagRD},
+		Questions: q.Questions,
+	}
+	if opcode := q.Header.Flags >> 11 & 0xF; opcode != 0 {
+		resp.Header.Flags |= RcodeNotImp
+		return resp
+	}
+	if len(q.Questions) != 1 {
+		resp.Header.Flags |= RcodeFormErr
+		return resp
+	}
+
+	question := q.Questions[0]
+	if question.Name != z.Origin && !strings.HasSuffix(question.Name, "."+z.Origin) {
+		// Not our zone. A recursive resolver would go find the answer;
+		// an authoritative server just says no.
+		resp.Header.Flags |= RcodeRefused
+		return resp
+	}
+
+	resp.Header.Flags |= FlagAA
+	records, exists := z.Records[question.Name]
+	if question.Name == z.Origin {
+		exists = true // the apex always exists: it owns the SOA
+		if question.Type == TypeSOA {
+			resp.Answers = append(resp.Answers, z.SOA)
+			return resp
+		}
+	}
+	if !exists {
+		resp.Header.Flags |= RcodeNXDomain
+		resp.Authority = []Record{z.SOA}
+		return resp
+	}
+	for _, r := range records {
+		if r.Type == question.Type {
+			resp.Answers = append(resp.Answers, r)
+		}
+	}
+	if len(resp.Answers) == 0 {
+		resp.Authority = []Record{z.SOA} // NODATA: name exists, type doesn't
+	}
+	return resp
+}
+
+// ============================================================
+// Server
+// ============================================================
+
+func serveUDP(conn net.PacketConn, z *Zone) {
+	buf := make([]byte, 65535)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			log.Printf("udp: %v", err)
+			return
+		}
+		q, err := Unpack(buf[:n])
+		if err != nil {
+			continue // not worth answering garbage
+		}
+		resp := z.Answer(q)
+		out := resp.Pack()
+		if len(out) > maxUDPSize {
+			// Too big for UDP: send the question with TC set and no
+			// records; the client is expected to retry over TCP
+			resp.Header.Flags |= FlagTC
+			resp.Answers, resp.Authority, resp.Additional = nil, nil, nil
+			out = resp.Pack()
+		}
+		logQuery("udp", addr, q, resp)
+		conn.WriteTo(out, addr)
+	}
+}
+
+func serveTCP(ln net.Listener, z *Zone) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			log.Printf("tcp: %v", err)
+			return
+		}
+		go func() {
+			defer conn.Close()
+			// A TCP client may send several queries on one connection
+			for {
+				conn.SetDeadline(time.Now().Add(10 * time.Second))
+				q, err := readTCPMessage(conn)
+				if err != nil {
+					return
+				}
+				resp := z.Answer(q)
+				logQuery("tcp", conn.RemoteAddr(), q, resp)
+				if err := writeTCPMessage(conn, resp.Pack()); err != nil {
+					return
+				}
+			}
+		}()
+	}
+}
+
+// Over TCP every message is preceded by its length as a uint16
+func readTCPMessage(r io.Reader) (*Message, error) {
+	var lenBuf [2]byte
+	if _, err := io.ReadFull(r, lenBuf[:]); err != nil {
+		return nil, err
+	}
+	msg := make([]byte, binary.BigEndian.Uint16(lenBuf[:]))
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, err
+	}
+	return Unpack(msg)
+}
+
+func writeTCPMessage(w io.Writer, msg []byte) error {
+	_, err := w.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(msg))), msg...))
+	return err
+}
+
+func logQuery(proto string, from net.Addr, q, resp *Message) {
+	if len(q.Questions) == 0 {
+		return
+	}
+	tc := ""
+	if resp.Header.Flags&FlagTC != 0 {
+		tc = " (truncated)"
+	}
+	log.Printf("%s %s %s %s -> %s, %d answer(s)%s", proto, from, q.Questions[0].Name,
+		typeNames[q.Questions[0].Type], rcodeNames[resp.Header.Rcode()], len(resp.Answers), tc)
+}
+
+func startServer(z *Zone) {
+	pc, err := net.ListenPacket("udp", listenAddr)
+	if err != nil {
+		log.Fatalf("listen udp: %v", err)
+	}
+	ln, err := net.Listen("tcp", listenAddr)
+	if err != nil {
+		log.Fatalf("listen tcp: %v", err)
+	}
+	go serveUDP(pc, z)
+	go serveTCP(ln, z)
+	log.Printf("authoritative for %s on %s (udp+tcp)", z.Origin, listenAddr)
+}
+
+// ============================================================
+// Client
+// ============================================================
+
+// Query asks server for name/qtype over UDP and falls back to TCP if
+// the answer comes back truncated
+func Query(server, name string, qtype uint16) (*Message, string, error) {
+	if !strings.HasSuffix(name, ".") {
+		name += "."
+	}
+	q := &Message{
+		Header:    Header{ID: uint16(time.Now().UnixNano()), Flags: FlagRD},
+		Questions: []Question{{Name: strings.ToLower(name), Type: qtype, Class: ClassIN}},
+	}
+
+	conn, err := net.Dial("udp", server)
+	if err != nil {
+		return nil, "", err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(2 * time.Second))
+	if _, err := conn.Write(q.Pack()); err != nil {
+		return nil, "", err
+	}
+	buf := make([]byte, maxUDPSize)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return nil, "", err
+	}
+	resp, err := Unpack(buf[:n])
+	if err != nil {
+		return nil, "", err
+	}
+	// Always match the ID: anyone can send a UDP packet to our port
+	if resp.Header.ID != q.Header.ID {
+		return nil, "", errors.New("dns: response ID mismatch")
+	}
+	if resp.Header.Flags&FlagTC == 0 {
+		return resp, "udp", nil
+	}
+
+	tcp, err := net.DialTimeout("tcp", server, 2*time.Second)
+	if err != nil {
+		return nil, "", err
+	}
+	defer tcp.Close()
+	tcp.SetDeadline(time.Now().Add(2 * time.Second))
+	if err := writeTCPMessage(tcp, q.Pack()); err != nil {
+		return nil, "", err
+	}
+	resp, err = readTCPMessage(tcp)
+	return resp, "udp, truncated -> tcp", err
+}
+
+// formatRData renders the record data for printing
+func formatRData(r Record) string {
+	switch r.Type {
+	case TypeA, TypeAAAA:
+		ip, _ := netip.AddrFromSlice(r.Data)
+		return ip.String()
+	case TypeTXT:
+		var parts []string
+		for d := r.Data; len(d) > 0 && int(d[0]) < len(d); d = d[1+int(d[0]):] {
+			parts = append(parts, strconv.Quote(string(d[1:1+int(d[0])])))
+		}
+		if len(r.Data) > 64 {
+			return fmt.Sprintf("%.20s...\" (%d strings, %d bytes)", parts[0], len(parts), len(r.Data))
+		}
+		return strings.Join(parts, " ")
+	default:
+		return fmt.Sprintf("(%d bytes)", len(r.Data))
+	}
+}
+
+func printResponse(name string, qtype uint16, resp *Message, via string) {
+	fmt.Printf("%-22s %-4s %-8s AA=%-5v via %s\n", name, typeNames[qtype], rcodeNames[resp.Header.Rcode()],
+		resp.Header.Flags&FlagAA != 0, via)
+	for _, r := range resp.Answers {
+		fmt.Printf("    %s %d %s %s\n", r.Name, r.TTL, typeNames[r.Type], formatRData(r))
+	}
+	for _, r := range resp.Authority {
+		fmt.Printf("    authority: %s %s (negative answers cacheable per its minimum TTL)\n", r.Name, typeNames[r.Type])
+	}
+}
+
+var typeByName = map[string]uint16{"A": TypeA, "AAAA": TypeAAAA, "TXT": TypeTXT, "SOA": TypeSOA}
+
+func main() {
+	zoneFile := flag.String("zone", "", "zone file (default: built-in example.test zone)")
+	origin := flag.String("origin", "example.test.", "zone origin")
+	flag.Parse()
+
+	var src io.Reader = strings.NewReader(defaultZone)
+	if *zoneFile != "" {
+		f, err := os.Open(*zoneFile)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer f.Close()
+		src = f
+	}
+	zone, err := ParseZone(src, *origin)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if *zoneFile == "" {
+		// One name whose TXT answer can't fit in 512 bytes
+		big := Record{Name: "big." + zone.Origin, Type: TypeTXT, TTL: 300, Data: packTXT(strings.Repeat("x", 600))}
+		zone.Records[big.Name] = []Record{big}
+	}
+
+	switch flag.Arg(0) {
+	case "server":
+		startServer(zone)
+		select {}
+
+	case "query":
+		if flag.NArg() != 3 {
+			log.Fatal("usage: query NAME TYPE")
+		}
+		qtype, ok := typeByName[strings.ToUpper(flag.Arg(2))]
+		if !ok {
+			log.Fatalf("unsupported type %s", flag.Arg(2))
+		}
+		resp, via, err := Query(listenAddr, flag.Arg(1), qtype)
+		if err != nil {
+			log.Fatal(err)
+		}
+		printResponse(flag.Arg(1), qtype, resp, via)
+
+	default:
+		startServer(zone)
+		log.SetOutput(io.Discard) // keep the demo output readable
+		fmt.Println()
+		queries := []struct {
+			name  string
+			qtype uint16
+		}{
+			{"www.example.test", TypeA},
+			{"www.example.test", TypeAAAA},
+			{"example.test", TypeTXT},
+			{"v4only.example.test", TypeAAAA}, // NODATA
+			{"nope.example.test", TypeA},      // NXDOMAIN
+			{"www.google.com", TypeA},         // REFUSED
+			{"big.example.test", TypeTXT},     // truncated, retried over TCP
+		}
+		for _, q := range queries {
+			resp, via, err := Query(listenAddr, q.name, q.qtype)
+			if err != nil {
+				fmt.Printf("%-22s error: %v\n", q.name, err)
+				continue
+			}
+			printResponse(q.name, q.qtype, resp, via)
+		}
+	}
+}
@@ -0,0 +1,595 @@
+// Static File Server - Ranges, conditional GETs, listings, throttling
+//
+// Serves a directory over HTTP the way a download server should:
+// - Range requests (206 Partial Content), so interrupted downloads
+//   resume instead of starting over; If-Range makes a resume fall
+//   back to the full file if it changed in between
+// - Conditional GETs: an ETag and Last-Modified on every file, and
+//   304 Not Modified for If-None-Match / If-Modified-Since
+// - Safe paths: ".." is refused outright, dotfiles are hidden, and
+//   files are opened through os.Root, so even a symlink inside the
+//   directory can't reach a file outside it
+// - Directory listings from an html/template (or index.html if there
+//   is one); -nolist turns them off
+// - Per-connection bandwidth throttling with a token bucket on the
+//   connection's writes
+//
+// Range and conditional handling come from http.ServeContent; this
+// file decides what may be served and with which validators.
+//
+// Usage:
+//   go run file_server.go                      # demo against a temp dir
+//   go run file_server.go -dir ./public -addr :8080 -rate 512KB
+//
+//   curl -i localhost:8080/big.bin -r 0-99
+//   curl -i localhost:8080/big.bin -H 'If-None-Match: "<etag>"'
+//   curl -C - -O localhost:8080/big.bin          # resume a download
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ============================================================
+// File server
+// ============================================================
+
+type FileServer struct {
+	root     *os.Root
+	listings bool
+}
+
+// NewFileServer serves dir. The os.Root is opened once; every lookup
+// goes through it and can't escape it.
+func NewFileServer(dir string, listings bool) (*FileServer, error) {
+	root, err := os.OpenRoot(dir)
+	if err != nil {
+		return nil, err
+	}
+	return &FileServer{root: root, listings: listings}, nil
+}
+
+func (s *FileServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Refuse rather than clean: "/a/../b" is never a link we made, so
+	// it is either a mistake or someone probing. (The URL is already
+	// percent-decoded, so %2e%2e arrives here as ".." too.)
+	for seg := range strings.SplitSeq(r.URL.Path, "/") {
+		if seg == ".." {
+			http.Error(w, "invalid path", http.StatusBadRequest)
+			return
+		}
+		if strings.HasPrefix(seg, ".") && seg != "." {
+			http.NotFound(w, r) // .git, .env and friends
+			return
+		}
+	}
+	name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+	if name == "" {
+		name = "."
+	}
+
+	f, err := s.root.Open(name)
+	if err != nil {
+		s.openError(w, r, err)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		s.openError(w, r, err)
+		return
+	}
+
+	if info.IsDir() {
+		// Relative links in a listing only work with the slash
+		if !strings.HasSuffix(r.URL.Path, "/") {
+			http.Redirect(w, r, r.URL.Path+"/", http.StatusMovedPermanently)
+			return
+		}
+		if index, err := s.root.Open(path.Join(name, "index.html")); err == nil {
+			defer index.Close()
+			if ii, err := index.Stat(); err == nil && ii.Mode().IsRegular() {
+				s.serveFile(w, r, index, ii)
+				return
+			}
+		}
+		if !s.listings {
+			http.Error(w, "directory listing disabled", http.StatusForbidden)
+			return
+		}
+		s.serveListing(w, r, f, name)
+		return
+	}
+	if !info.Mode().IsRegular() {
+		http.NotFound(w, r) // devices, sockets, pipes
+		return
+	}
+	if strings.HasSuffix(r.URL.Path, "/") {
+		http.Redirect(w, r, strings.TrimSuffix(r.URL.Path, "/"), http.StatusMovedPermanently)
+		return
+	}
+	s.serveFile(w, r, f, info)
+}
+
+// openError maps lookup failures to statuses without telling the
+// client anything about what lies outside the root
+func (s *FileServer) openError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		http.NotFound(w, r)
+	case errors.Is(err, fs.ErrPermission):
+		http.Error(w, "forbidden", http.StatusForbidden)
+	default:
+		// Including "path escapes from parent" for a symlink pointing
+		// out of the root: log it, but answer as if nothing were there
+		log.Printf("open %s: %v", r.URL.Path, err)
+		http.NotFound(w, r)
+	}
+}
+
+// serveFile sets the validators and lets ServeContent handle Range,
+// If-Range, If-None-Match, If-Modified-Since and HEAD
+func (s *FileServer) serveFile(w http.ResponseWriter, r *http.Request, f *os.File, info fs.FileInfo) {
+	// A strong ETag from size and mtime: cheap, and it changes
+	// whenever the file is rewritten. Hashing the content would be
+	// more exact but means reading every file once.
+	w.Header().Set("ETag", fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size()))
+	// Cache it, but check back each time: that is what makes the 304s
+	w.Header().Set("Cache-Control", "no-cache")
+	http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+}
+
+// ============================================================
+// Directory listing
+// ============================================================
+
+var listingTmpl = template.Must(template.New("listing").Funcs(template.FuncMap{
+	"size": humanSize,
+}).Parse(`<!doctype html>
+<meta charset="utf-8">
+<title>Index of {{.Path}}</title>
+<h1>Index of {{.Path}}</h1>
+<table>
+<tr><th>Name</th><th>Size</th><th>Modified</th></tr>
+{{if ne .Path "/"}}<tr><td><a href="../">../</a></td><td></td><td></td></tr>
+{{end}}{{range .Entries}}<tr><td><a href="{{.Href}}">{{.Name}}{{if .Dir}}/{{end}}</a></td><td>{{if not .Dir}}{{size .Size}}{{end}}</td><td>{{.ModTime.Format "2006-01-02 15:04"}}</td></tr>
+{{end}}</table>
+`))
+
+type listingEntry struct {
+	Name    string
+	Href    string
+	Dir     bool
+	Size    int64
+	ModTime time.Time
+}
+
+func (s *FileServer) serveListing(w http.ResponseWriter, r *http.Request, dir *os.File, name string) {
+	entries, err := dir.ReadDir(-1)
+	if err != nil {
+		http.Error(w, "cannot read directory", http.StatusInternalServerError)
+		return
+	}
+	var list []listingEntry
+	for _, e := range entries {
+		if strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		// Stat through the root: it follows symlinks that stay inside
+		// and fails for ones that don't, which then aren't listed
+		info, err := s.root.Stat(path.Join(name, e.Name()))
+		if err != nil {
+			continue
+		}
+		// Escape the name for the href: a file called "a#b" or "x?y"
+		// must not turn into a fragment or query. The "./" keeps
+		// "c:foo" from looking like a URL scheme.
+		href := "./" + url.PathEscape(e.Name())
+		if info.IsDir() {
+			href += "/"
+		}
+		list = append(list, listingEntry{Name: e.Name(), Href: href, Dir: info.IsDir(), Size: info.Size(), ModTime: info.ModTime()})
+	}
+	// Directories first, then by name
+	slices.SortFunc(list, func(a, b listingEntry) int {
+		if a.Dir != b.Dir {
+			if a.Dir {
+				return -1
+			}
+			return 1
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+
+	var buf bytes.Buffer
+	if err := listingTmpl.Execute(&buf, struct {
+		Path    string
+		Entries []listingEntry
+	}{"/" + strings.TrimPrefix(name+"/", "./"), list}); err != nil {
+		http.Error(w, "template error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Write(buf.Bytes())
+}
+
+func humanSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+// ============================================================
+// Per-connection throttling
+// ============================================================
+
+// throttledListener wraps every accepted connection in a token
+// bucket. The limit is per connection: a client that opens four
+// connections gets four times the rate. (Wrapping the conn also
+// disables sendfile, since it no longer implements io.ReaderFrom.)
+type throttledListener struct {
+	net.Listener
+	rate int // bytes per second
+}
+
+func (l *throttledListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	burst := max(l.rate/20, 1) // 50ms worth
+	return &throttledConn{Conn: conn, rate: float64(l.rate), burst: burst, tokens: float64(burst), last: time.Now()}, nil
+}
+
+type throttledConn struct {
+	net.Conn
+	mu     sync.Mutex
+	rate   float64
+	burst  int
+	tokens float64
+	last   time.Time
+}
+
+// Write sends p in burst-sized pieces, sleeping whenever the bucket
+// runs dry
+func (c *throttledConn) Write(p []byte) (int, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	written := 0
+	for len(p) > 0 {
+		n := min(len(p), c.burst)
+		now := time.Now()
+		c.tokens = min(c.tokens+now.Sub(c.last).Seconds()*c.rate, float64(c.burst))
+		c.last = now
+		if need := float64(n) - c.tokens; need > 0 {
+			time.Sleep(time.Duration(need / c.rate * float64(time.Second)))
+			c.tokens, c.last = float64(n), time.Now()
+		}
+		c.tokens -= float64(n)
+		m, err := c.Conn.Write(p[:n])
+		written += m
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// parseBytes reads "512KB", "2MB" or a plain byte count
+func parseBytes(s string) (int, error) {
+	mult := 1
+	for _, u := range []struct {
+		suffix string
+		mult   int
+	}{{"KB", 1 << 10}, {"MB", 1 << 20}, {"GB", 1 << 30}, {"B", 1}} {
+		if rest, ok := strings.CutSuffix(strings.ToUpper(s), u.suffix); ok {
+			s, mult = rest, u.mult
+			break
+		}
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(s))
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %q", s)
+	}
+	return n * mult, nil
+}
+
+// ============================================================
+// Logging
+// ============================================================
+
+type loggingWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *loggingWriter) WriteHeader(code int) {
+	w.status = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *loggingWriter) Write(p []byte) (int, error) {
+	n, err := w.ResponseWriter.Write(p)
+	w.bytes += int64(n)
+	return n, err
+}
+
+func logging(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		lw := &loggingWriter{ResponseWriter: w, status: 200}
+		next.ServeHTTP(lw, r)
+		extra := ""
+		if rg := r.Header.Get("Range"); rg != "" {
+			extra = " range=" + rg
+		}
+		log.Printf("%s %s %d %dB %v%s", r.Method, r.URL.Path, lw.status, lw.bytes, time.Since(start).Round(time.Millisecond), extra)
+	})
+}
+
+// ============================================================
+// Demo
+// ============================================================
+
+func demo() error {
+	dir, err := os.MkdirTemp("", "fileserver")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	outside, err := os.MkdirTemp("", "outside")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(outside)
+
+	big := bytes.Repeat([]byte("0123456789abcdef"), 16<<10) // 256KB
+	files := map[string][]byte{
+		"big.bin":         big,
+		"hello.txt":       []byte("hello, world\n"),
+		"docs/guide.txt":  []byte("read me\n"),
+		"docs/a#b?c.txt":  []byte("awkward name\n"),
+		".env":            []byte("SECRET=hunter2\n"),
+		"site/index.html": []byte("<h1>welcome</h1>\n"),
+		"site/style.css":  []byte("h1 { color: teal }\n"),
+	}
+	for name, data := range files {
+		p := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(p, data, 0o644); err != nil {
+			return err
+		}
+	}
+	os.WriteFile(filepath.Join(outside, "secrets"), []byte("outside the root\n"), 0o644)
+	// A symlink inside the served directory that points out of it
+	if err := os.Symlink(filepath.Join(outside, "secrets"), filepath.Join(dir, "docs", "escape.txt")); err != nil {
+		return err
+	}
+
+	fsrv, err := NewFileServer(dir, true)
+	if err != nil {
+		return err
+	}
+	handler := logging(fsrv)
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return err
+	}
+	defer ln.Close()
+	go http.Serve(ln, handler)
+	base := "http://" + ln.Addr().String()
+	log.SetFlags(log.Lmicroseconds)
+	log.SetPrefix("  server: ")
+
+	client := &http.Client{
+		// Show redirects instead of following them
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	get := func(p string, hdr ...string) (*http.Response, []byte) {
+		req, _ := http.NewRequest("GET", base+p, nil)
+		for i := 0; i+1 < len(hdr); i += 2 {
+			req.Header.Set(hdr[i], hdr[i+1])
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp, body
+	}
+
+	fmt.Println("=== Full download and validators ===")
+	resp, body := get("/big.bin")
+	etag, lastMod := resp.Header.Get("ETag"), resp.Header.Get("Last-Modified")
+	fmt.Printf("%s  %d bytes  ETag %s  Accept-Ranges %s\n", resp.Status, len(body), etag, resp.Header.Get("Accept-Ranges"))
+
+	fmt.Println()
+	fmt.Println("=== Conditional GETs ===")
+	for _, tc := range []struct {
+		name string
+		hdr  []string
+	}{
+		{"If-None-Match: same ETag", []string{"If-None-Match", etag}},
+		{"If-None-Match: other ETag", []string{"If-None-Match", `"stale"`}},
+		{"If-Modified-Since: Last-Modified", []string{"If-Modified-Since", lastMod}},
+		{"If-Modified-Since: a day earlier", []string{"If-Modified-Since", time.Now().Add(-24 * time.Hour).UTC().Format(http.TimeFormat)}},
+	} {
+		resp, body := get("/big.bin", tc.hdr...)
+		fmt.Printf("%-34s -> %s, %d body bytes\n", tc.name, resp.Status, len(body))
+	}
+
+	fmt.Println()
+	fmt.Println("=== Range requests ===")
+	for _, rg := range []string{"bytes=0-15", "bytes=262128-", "bytes=-8", "bytes=0-3,32-35", "bytes=999999-"} {
+		resp, body := get("/big.bin", "Range", rg)
+		desc := fmt.Sprintf("%q", body)
+		if strings.HasPrefix(resp.Header.Get("Content-Type"), "multipart/") {
+			desc = fmt.Sprintf("multipart/byteranges, %d bytes", len(body))
+		}
+		fmt.Printf("%-16s -> %s  %-24s %s\n", rg, resp.Status, resp.Header.Get("Content-Range"), desc)
+	}
+
+	fmt.Println()
+	fmt.Println("=== Resuming an interrupted download ===")
+	// The first attempt "fails" after 100KB; the second asks for the
+	// rest, but only if the file is still the one it started on
+	resp, part := get("/big.bin", "Range", "bytes=0-102399")
+	fmt.Printf("first attempt:   %s, got %d bytes\n", resp.Status, len(part))
+	resp, rest := get("/big.bin", "Range", fmt.Sprintf("bytes=%d-", len(part)), "If-Range", etag)
+	fmt.Printf("resume:          %s %s, got %d bytes, complete and identical: %v\n",
+		resp.Status, resp.Header.Get("Content-Range"), len(rest), bytes.Equal(append(part, rest...), big))
+	// Rewrite the file: the same resume must now get the whole new
+	// file, not a tail glued onto the old head
+	newer := bytes.ToUpper(big)
+	os.WriteFile(filepath.Join(dir, "big.bin"), newer, 0o644)
+	os.Chtimes(filepath.Join(dir, "big.bin"), time.Now(), time.Now().Add(time.Second))
+	resp, rest = get("/big.bin", "Range", fmt.Sprintf("bytes=%d-", len(part)), "If-Range", etag)
+	fmt.Printf("after a change:  %s, got %d bytes (whole new file: %v)\n", resp.Status, len(rest), bytes.Equal(rest, newer))
+
+	fmt.Println()
+	fmt.Println("=== Path safety ===")
+	// Go's client cleans ".." out of URLs, so send these by hand
+	raw := func(target string) string {
+		conn, err := net.Dial("tcp", ln.Addr().String())
+		if err != nil {
+			return err.Error()
+		}
+		defer conn.Close()
+		fmt.Fprintf(conn, "GET %s HTTP/1.1\r\nHost: x\r\nConnection: close\r\n\r\n", target)
+		status, _ := io.ReadAll(conn)
+		line, _, _ := strings.Cut(string(status), "\r\n")
+		return line
+	}
+	for _, target := range []string{"/../../etc/passwd", "/docs/%2e%2e/%2e%2e/etc/passwd", "/.env", "/docs/escape.txt", "/docs/guide.txt"} {
+		fmt.Printf("%-32s -> %s\n", target, raw(target))
+	}
+
+	fmt.Println()
+	fmt.Println("=== Directories ===")
+	resp, _ = get("/docs")
+	fmt.Printf("/docs   -> %s to %s\n", resp.Status, resp.Header.Get("Location"))
+	resp, body = get("/site/")
+	fmt.Printf("/site/  -> %s, index.html: %q\n", resp.Status, body)
+	resp, body = get("/docs/")
+	fmt.Printf("/docs/  -> %s, listing:\n", resp.Status)
+	for line := range strings.SplitSeq(string(body), "\n") {
+		if strings.Contains(line, "<a href") {
+			fmt.Println("   ", line)
+		}
+	}
+	resp, body = get("/docs/a%23b%3Fc.txt")
+	fmt.Printf("following the escaped link -> %s %q\n", resp.Status, body)
+
+	fmt.Println()
+	fmt.Println("=== Throttling: 256KB file at 512KB/s per connection ===")
+	tln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return err
+	}
+	defer tln.Close()
+	go http.Serve(&throttledListener{Listener: tln, rate: 512 << 10}, fsrv) // no logging here
+	download := func() (int, time.Duration) {
+		t0 := time.Now()
+		// A fresh Transport per download, so each gets its own connection
+		c := &http.Client{Transport: &http.Transport{}}
+		resp, err := c.Get("http://" + tln.Addr().String() + "/big.bin")
+		if err != nil {
+			return 0, 0
+		}
+		defer resp.Body.Close()
+		n, _ := io.Copy(io.Discard, resp.Body)
+		return int(n), time.Since(t0)
+	}
+	n, d := download()
+	fmt.Printf("one download:           %d bytes in %v (%.0f KB/s)\n", n, d.Round(10*time.Millisecond), float64(n)/1024/d.Seconds())
+	var wg sync.WaitGroup
+	t0 := time.Now()
+	for i := range 3 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			n, d := download()
+			fmt.Printf("parallel download %d:    %d bytes in %v\n", i+1, n, d.Round(10*time.Millisecond))
+		}()
+	}
+	wg.Wait()
+	fmt.Printf("three at once took %v: the limit is per connection, not per client\n", time.Since(t0).Round(10*time.Millisecond))
+	return nil
+}
+
+func main() {
+	dir := flag.String("dir", "", "directory to serve (empty: run the demo)")
+	addr := flag.String("addr", "127.0.0.1:8080", "listen address")
+	rate := flag.String("rate", "0", "per-connection limit, e.g. 512KB (0: unlimited)")
+	noList := flag.Bool("nolist", false, "disable directory listings")
+	flag.Parse()
+
+	if *dir == "" {
+		if err := demo(); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	limit, err := parseBytes(*rate)
+	if err != nil {
+		log.Fatal(err)
+	}
+	fsrv, err := NewFileServer(*dir, !*noList)
+	if err != nil {
+		log.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", *addr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if limit > 0 {
+		ln = &throttledListener{Listener: ln, rate: limit}
+	}
+	srv := &http.Server{
+		Handler:           logging(fsrv),
+		ReadHeaderTimeout: 10 * time.Second,
+		IdleTimeout:       2 * time.Minute,
+		// No WriteTimeout: a big file on a slow (or throttled) link
+		// legitimately takes a long time
+	}
+	log.Printf("serving %s on http://%s (rate limit %s/s per connection)", *dir, ln.Addr(), *rate)
+	log.Fatal(srv.Serve(ln))
+}
@@ -0,0 +1,579 @@
+// Gossip - Peer-to-peer membership and state over UDP
+//
+// No leader, no central registry: every round each node picks a few
+// random peers and swaps what it knows with them. News spreads like
+// an epidemic - in about log(N) rounds everyone has it - and there is
+// no single point of failure:
+// - Membership: each node bumps its own heartbeat counter every round
+//   and gossips everyone's counters. A node whose counter stops
+//   rising is suspect after a few rounds and dead after more; a dead
+//   node that restarts comes back with a new incarnation number,
+//   which beats any counter from its previous life
+// - Anti-entropy: a three-way push-pull exchange. The initiator sends
+//   a digest (which version of each key it has), the peer answers
+//   with the entries it has newer plus a list of keys it wants, and
+//   the initiator sends those. Nodes converge even after missing
+//   messages, since every round repairs whatever differs
+// - Key/value state with last-writer-wins versions (a Lamport clock,
+//   ties broken by node address), so concurrent writes to one key end
+//   up the same everywhere
+// Failure detection compares counters against local time only: no
+// clocks need to agree across machines.
+//
+// Usage:
+//   go run gossip.go                 # spawns 5 node processes, kills and restarts one
+//   go run gossip.go cluster -n 8
+//
+//   # or by hand, one terminal each; type "set k v", "get k", "members", "kv":
+//   go run gossip.go node -addr 127.0.0.1:7946
+//   go run gossip.go node -addr 127.0.0.1:7947 -seeds 127.0.0.1:7946
+//   go run gossip.go node -addr 127.0.0.1:7948 -seeds 127.0.0.1:7946 -set color=blue
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net"
+	"os"
+	"os/exec"
+	"os/signal"
+	"slices"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	gossipInterval = 300 * time.Millisecond
+	fanout         = 2                   // peers contacted per round
+	suspectAfter   = 5 * gossipInterval  // no heartbeat progress for this long
+	deadAfter      = 15 * gossipInterval // ...and for this long
+	forgetAfter    = 60 * time.Second    // dead members are dropped after this
+	maxEntries     = 16                  // entries per packet, to stay well under MTU-ish sizes
+)
+
+// ============================================================
+// State
+// ============================================================
+
+type Status int
+
+const (
+	Alive Status = iota
+	Suspect
+	Dead
+)
+
+func (s Status) String() string {
+	return [...]string{"alive", "suspect", "dead"}[s]
+}
+
+// Beat is a member's liveness: the incarnation changes when a node
+// restarts, the heartbeat ticks every round within one incarnation
+type Beat struct {
+	Inc int64  `json:"i"`
+	HB  uint64 `json:"h"`
+}
+
+func (b Beat) newer(o Beat) bool {
+	return b.Inc > o.Inc || (b.Inc == o.Inc && b.HB > o.HB)
+}
+
+type member struct {
+	beat       Beat
+	lastChange time.Time // local time the beat last went up
+	status     Status
+}
+
+// Version orders writes to a key: the higher clock wins, and equal
+// clocks (concurrent writes) are broken by origin so every node picks
+// the same winner
+type Version struct {
+	Clock  uint64 `json:"c"`
+	Origin string `json:"o"`
+}
+
+func (v Version) newer(o Version) bool {
+	return v.Clock > o.Clock || (v.Clock == o.Clock && v.Origin > o.Origin)
+}
+
+type Entry struct {
+	Key   string  `json:"k"`
+	Value string  `json:"v"`
+	Ver   Version `json:"ver"`
+}
+
+// Message is every packet on the wire. The exchange is:
+//   SYN:  Members + Digest           initiator -> peer
+//   ACK:  Members + Entries + Want   peer -> initiator
+//   ACK2: Entries                    initiator -> peer
+type Message struct {
+	Type    string             `json:"t"`
+	From    string             `json:"f"`
+	Members map[string]Beat    `json:"m,omitempty"`
+	Digest  map[string]Version `json:"d,omitempty"`
+	Entries []Entry            `json:"e,omitempty"`
+	Want    []string           `json:"w,omitempty"`
+}
+
+// ============================================================
+// Node
+// ============================================================
+
+type Node struct {
+	addr string
+	conn *net.UDPConn
+
+	mu      sync.Mutex
+	self    Beat
+	members map[string]*member // not including ourselves
+	kv      map[string]Entry
+	clock   uint64
+
+	logger *log.Logger
+}
+
+func NewNode(addr string, seeds []string, logger *log.Logger) (*Node, error) {
+	laddr, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenUDP("udp", laddr)
+	if err != nil {
+		return nil, err
+	}
+	// Heartbeats start at 1: 0 marks a seed not heard from yet
+	n := &Node{
+		addr:    conn.LocalAddr().String(),
+		conn:    conn,
+		self:    Beat{Inc: time.Now().UnixNano(), HB: 1},
+		members: map[string]*member{},
+		kv:      map[string]Entry{},
+		logger:  logger,
+	}
+	// Seeds start as members with no heartbeat yet, just so the first
+	// rounds have someone to talk to
+	for _, s := range seeds {
+		if s != n.addr {
+			n.members[s] = &member{lastChange: time.Now()}
+		}
+	}
+	go n.readLoop()
+	go n.gossipLoop()
+	return n, nil
+}
+
+func (n *Node) Set(key, value string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.clock++
+	n.kv[key] = Entry{Key: key, Value: value, Ver: Version{Clock: n.clock, Origin: n.addr}}
+}
+
+func (n *Node) Get(key string) (Entry, bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	e, ok := n.kv[key]
+	return e, ok
+}
+
+func (n *Node) Close() { n.conn.Close() }
+
+// ============================================================
+// Gossip rounds
+// ============================================================
+
+func (n *Node) gossipLoop() {
+	ticker := time.NewTicker(gossipInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		n.mu.Lock()
+		n.self.HB++
+		n.detectFailures()
+		peers := n.pickPeers()
+		syn := Message{Type: "SYN", Members: n.memberDigest(), Digest: n.kvDigest()}
+		n.mu.Unlock()
+		for _, p := range peers {
+			if err := n.send(p, syn); errors.Is(err, net.ErrClosed) {
+				return
+			}
+		}
+	}
+}
+
+// pickPeers chooses fanout random live members. Dead ones are left
+// alone: if they come back, they will talk to us.
+func (n *Node) pickPeers() []string {
+	var live []string
+	for addr, m := range n.members {
+		if m.status != Dead {
+			live = append(live, addr)
+		}
+	}
+	rand.Shuffle(len(live), func(i, j int) { live[i], live[j] = live[j], live[i] })
+	return live[:min(fanout, len(live))]
+}
+
+// detectFailures runs once per round with n.mu held
+func (n *Node) detectFailures() {
+	now := time.Now()
+	for addr, m := range n.members {
+		age := now.Sub(m.lastChange)
+		switch {
+		case m.status == Alive && age > suspectAfter && m.beat.HB > 0:
+			m.status = Suspect
+			n.logger.Printf("%s is SUSPECT (no heartbeat progress for %v)", addr, age.Round(time.Millisecond))
+		case m.status == Suspect && age > deadAfter:
+			m.status = Dead
+			n.logger.Printf("%s is DEAD", addr)
+		case m.status == Dead && age > forgetAfter:
+			delete(n.members, addr)
+		}
+	}
+}
+
+func (n *Node) memberDigest() map[string]Beat {
+	d := map[string]Beat{n.addr: n.self}
+	for addr, m := range n.members {
+		if m.beat.HB > 0 && m.status != Dead {
+			d[addr] = m.beat
+		}
+	}
+	return d
+}
+
+func (n *Node) kvDigest() map[string]Version {
+	d := make(map[string]Version, len(n.kv))
+	for k, e := range n.kv {
+		d[k] = e.Ver
+	}
+	return d
+}
+
+// ============================================================
+// Handling messages
+// ============================================================
+
+func (n *Node) readLoop() {
+	buf := make([]byte, 64<<10)
+	for {
+		size, from, err := n.conn.ReadFromUDP(buf)
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		var msg Message
+		if err := json.Unmarshal(buf[:size], &msg); err != nil {
+			continue // not ours, or damaged: UDP has no guarantees
+		}
+		n.handle(from.String(), msg)
+	}
+}
+
+func (n *Node) handle(from string, msg Message) {
+	n.mu.Lock()
+	n.mergeMembers(msg.Members)
+	n.mergeEntries(msg.Entries, from)
+
+	var reply *Message
+	switch msg.Type {
+	case "SYN":
+		// Send what we have newer, ask for what they have newer
+		ack := Message{Type: "ACK", Members: n.memberDigest()}
+		for k, e := range n.kv {
+			if theirs, ok := msg.Digest[k]; !ok || e.Ver.newer(theirs) {
+				ack.Entries = append(ack.Entries, e)
+			}
+		}
+		for k, v := range msg.Digest {
+			if mine, ok := n.kv[k]; !ok || v.newer(mine.Ver) {
+				ack.Want = append(ack.Want, k)
+			}
+		}
+		ack.Entries = capEntries(ack.Entries)
+		reply = &ack
+	case "ACK":
+		if len(msg.Want) > 0 {
+			ack2 := Message{Type: "ACK2"}
+			for _, k := range msg.Want {
+				if e, ok := n.kv[k]; ok {
+					ack2.Entries = append(ack2.Entries, e)
+				}
+			}
+			ack2.Entries = capEntries(ack2.Entries)
+			reply = &ack2
+		}
+	}
+	n.mu.Unlock()
+	if reply != nil {
+		n.send(from, *reply)
+	}
+}
+
+// capEntries keeps a packet small. Whatever doesn't fit goes in a
+// later round: anti-entropy doesn't need everything at once.
+func capEntries(es []Entry) []Entry {
+	if len(es) <= maxEntries {
+		return es
+	}
+	rand.Shuffle(len(es), func(i, j int) { es[i], es[j] = es[j], es[i] })
+	return es[:maxEntries]
+}
+
+func (n *Node) mergeMembers(beats map[string]Beat) {
+	now := time.Now()
+	for addr, b := range beats {
+		if addr == n.addr {
+			continue
+		}
+		m, ok := n.members[addr]
+		if !ok {
+			n.members[addr] = &member{beat: b, lastChange: now}
+			n.logger.Printf("%s joined", addr)
+			continue
+		}
+		if !b.newer(m.beat) {
+			continue
+		}
+		switch {
+		case m.beat.HB == 0:
+			n.logger.Printf("%s joined", addr) // a seed we had only heard of
+		case b.Inc != m.beat.Inc:
+			n.logger.Printf("%s restarted (new incarnation)", addr)
+		case m.status != Alive:
+			n.logger.Printf("%s is alive again (was %s)", addr, m.status)
+		}
+		m.beat, m.lastChange, m.status = b, now, Alive
+	}
+}
+
+func (n *Node) mergeEntries(entries []Entry, from string) {
+	for _, e := range entries {
+		// Lamport clock: never fall behind a version we have seen, so
+		// our next write orders after it
+		n.clock = max(n.clock, e.Ver.Clock)
+		if mine, ok := n.kv[e.Key]; ok && !e.Ver.newer(mine.Ver) {
+			continue
+		}
+		n.kv[e.Key] = e
+		n.logger.Printf("learned %s=%s (written by %s, clock %d) via %s", e.Key, e.Value, e.Ver.Origin, e.Ver.Clock, from)
+	}
+}
+
+func (n *Node) send(to string, msg Message) error {
+	msg.From = n.addr
+	addr, err := net.ResolveUDPAddr("udp", to)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+	_, err = n.conn.WriteToUDP(data, addr)
+	return err
+}
+
+// ============================================================
+// Inspection
+// ============================================================
+
+func (n *Node) printMembers(w io.Writer) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	fmt.Fprintf(w, "  %-21s %-8s %s\n", n.addr, "self", fmt.Sprintf("hb=%d", n.self.HB))
+	addrs := make([]string, 0, len(n.members))
+	for a := range n.members {
+		addrs = append(addrs, a)
+	}
+	slices.Sort(addrs)
+	for _, a := range addrs {
+		m := n.members[a]
+		fmt.Fprintf(w, "  %-21s %-8s hb=%d, last progress %v ago\n", a, m.status, m.beat.HB, time.Since(m.lastChange).Round(time.Millisecond))
+	}
+}
+
+func (n *Node) printKV(w io.Writer) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	entries := make([]Entry, 0, len(n.kv))
+	for _, e := range n.kv {
+		entries = append(entries, e)
+	}
+	slices.SortFunc(entries, func(a, b Entry) int { return cmp.Compare(a.Key, b.Key) })
+	for _, e := range entries {
+		fmt.Fprintf(w, "  %s=%s (by %s, clock %d)\n", e.Key, e.Value, e.Ver.Origin, e.Ver.Clock)
+	}
+}
+
+// ============================================================
+// Node process
+// ============================================================
+
+func runNode(args []string) {
+	fs := flag.NewFlagSet("node", flag.ExitOnError)
+	addr := fs.String("addr", "127.0.0.1:7946", "UDP address to listen on")
+	seeds := fs.String("seeds", "", "comma-separated addresses of nodes to join through")
+	set := fs.String("set", "", "comma-separated key=value pairs to write at startup")
+	fs.Parse(args)
+
+	logger := log.New(os.Stdout, *addr+" ", log.Lmicroseconds)
+	var seedList []string
+	if *seeds != "" {
+		seedList = strings.Split(*seeds, ",")
+	}
+	n, err := NewNode(*addr, seedList, logger)
+	if err != nil {
+		log.Fatal(err)
+	}
+	for kv := range strings.SplitSeq(*set, ",") {
+		if k, v, ok := strings.Cut(kv, "="); ok {
+			n.Set(k, v)
+			logger.Printf("set %s=%s", k, v)
+		}
+	}
+	logger.Printf("gossiping every %v, fanout %d", gossipInterval, fanout)
+
+	// Commands on stdin, when there is a terminal to type them
+	go func() {
+		sc := bufio.NewScanner(os.Stdin)
+		for sc.Scan() {
+			f := strings.Fields(sc.Text())
+			switch {
+			case len(f) == 3 && f[0] == "set":
+				n.Set(f[1], f[2])
+			case len(f) == 2 && f[0] == "get":
+				if e, ok := n.Get(f[1]); ok {
+					fmt.Printf("  %s (by %s, clock %d)\n", e.Value, e.Ver.Origin, e.Ver.Clock)
+				} else {
+					fmt.Println("  (not found)")
+				}
+			case len(f) == 1 && f[0] == "members":
+				n.printMembers(os.Stdout)
+			case len(f) == 1 && f[0] == "kv":
+				n.printKV(os.Stdout)
+			case len(f) > 0:
+				fmt.Println("  commands: set KEY VALUE | get KEY | members | kv")
+			}
+		}
+	}()
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	<-sig
+	fmt.Println(*addr + " final state:")
+	n.printMembers(os.Stdout)
+	n.printKV(os.Stdout)
+	n.Close()
+}
+
+// ============================================================
+// Cluster launcher
+// ============================================================
+
+// runCluster starts n copies of this program as separate node
+// processes, then kills one and later restarts it
+func runCluster(args []string) {
+	fs := flag.NewFlagSet("cluster", flag.ExitOnError)
+	size := fs.Int("n", 5, "number of node processes")
+	basePort := fs.Int("port", 7946, "first UDP port")
+	fs.Parse(args)
+	if *size < 3 {
+		log.Fatal("need at least 3 nodes")
+	}
+
+	self, err := os.Executable()
+	if err != nil {
+		log.Fatal(err)
+	}
+	addrOf := func(i int) string { return fmt.Sprintf("127.0.0.1:%d", *basePort+i) }
+	var outMu sync.Mutex // keep lines from different processes whole
+	type proc struct {
+		cmd    *exec.Cmd
+		output sync.WaitGroup // the pipe must be drained before Wait
+	}
+	start := func(i int, set string) *proc {
+		// Everyone joins through node 0; it is only a seed, not special
+		cmd := exec.Command(self, "node", "-addr", addrOf(i), "-seeds", addrOf(0), "-set", set)
+		stdout, _ := cmd.StdoutPipe()
+		cmd.Stderr = os.Stderr
+		if err := cmd.Start(); err != nil {
+			log.Fatal(err)
+		}
+		p := &proc{cmd: cmd}
+		p.output.Add(1)
+		go func() {
+			defer p.output.Done()
+			sc := bufio.NewScanner(stdout)
+			for sc.Scan() {
+				outMu.Lock()
+				fmt.Println(sc.Text())
+				outMu.Unlock()
+			}
+		}()
+		return p
+	}
+	wait := func(p *proc) {
+		p.output.Wait()
+		p.cmd.Wait()
+	}
+	banner := func(s string) {
+		outMu.Lock()
+		fmt.Printf("\n=== %s ===\n", s)
+		outMu.Unlock()
+	}
+
+	victim := *size - 1
+	banner(fmt.Sprintf("starting %d nodes; each writes one key, nodes 1 and 2 both write 'color'", *size))
+	nodes := make([]*proc, *size)
+	for i := range *size {
+		set := fmt.Sprintf("key%d=from-node%d", i, i)
+		if i == 1 || i == 2 {
+			set += fmt.Sprintf(",color=%s", []string{"", "red", "green"}[i])
+		}
+		nodes[i] = start(i, set)
+	}
+	time.Sleep(3 * time.Second)
+
+	banner(fmt.Sprintf("killing %s with SIGKILL: no goodbye, it just goes quiet", addrOf(victim)))
+	nodes[victim].cmd.Process.Kill()
+	wait(nodes[victim])
+	time.Sleep(deadAfter + 2*time.Second)
+
+	banner(fmt.Sprintf("restarting %s with a new key", addrOf(victim)))
+	nodes[victim] = start(victim, "late=arrival")
+	time.Sleep(3 * time.Second)
+
+	banner("stopping; every node should list the same keys and see all members alive")
+	for _, p := range nodes {
+		p.cmd.Process.Signal(os.Interrupt)
+	}
+	for _, p := range nodes {
+		wait(p)
+	}
+}
+
+func main() {
+	cmd, args := "cluster", os.Args[1:]
+	if len(args) > 0 && !strings.HasPrefix(args[0], "-") {
+		cmd, args = args[0], args[1:]
+	}
+	switch cmd {
+	case "cluster":
+		runCluster(args)
+	case "node":
+		runNode(args)
+	default:
+		log.Fatalf("unknown command %q (cluster, node)", cmd)
+	}
+}
@@ -0,0 +1,195 @@
+// gRPC Users Client - Calling unary, server-streaming and bidi RPCs
+//
+// Walks through every RPC in proto/users/v1/users.proto:
+// - Unary calls, with deadlines and status-code error handling
+// - Reading a server stream until io.EOF
+// - A bidirectional stream: one goroutine sends while the main one
+//   receives, because neither side waits for the other
+// - A client interceptor that attaches the auth token to every call
+//
+// Usage (start the server first; see server/main.go):
+//   go run ./client
+//   go run ./client -token wrong     # watch every call fail with Unauthenticated
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	usersv1 "github.com/bellistech/labs/coding/go/examples/networking/grpc_users/gen/users/v1"
+)
+
+// withToken returns unary and stream interceptors that add the bearer
+// token to outgoing metadata. (grpc.WithPerRPCCredentials does the
+// same, but insists on TLS - right for production, not for a demo.)
+func withToken(token string) []grpc.DialOption {
+	attach := func(ctx context.Context) context.Context {
+		return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+	}
+	unary := func(ctx context.Context, method string, req, reply any, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		return invoker(attach(ctx), method, req, reply, cc, opts...)
+	}
+	stream := func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		return streamer(attach(ctx), desc, cc, method, opts...)
+	}
+	return []grpc.DialOption{
+		grpc.WithChainUnaryInterceptor(unary),
+		grpc.WithChainStreamInterceptor(stream),
+	}
+}
+
+func main() {
+	addr := flag.String("addr", "localhost:50051", "server address")
+	token := flag.String("token", "demo-token", "bearer token to send")
+	flag.Parse()
+
+	// NewClient doesn't connect yet; the first RPC does
+	opts := append([]grpc.DialOption{
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	}, withToken(*token)...)
+	conn, err := grpc.NewClient(*addr, opts...)
+	if err != nil {
+		log.Fatalf("client: %v", err)
+	}
+	defer conn.Close()
+
+	client := usersv1.NewUsersServiceClient(conn)
+
+	fmt.Println("=== Unary ===")
+	unaryCalls(client)
+
+	fmt.Println()
+	fmt.Println("=== Server streaming ===")
+	listUsers(client, "Al")
+
+	fmt.Println()
+	fmt.Println("=== Bidirectional streaming ===")
+	bulkCreate(client)
+}
+
+func unaryCalls(client usersv1.UsersServiceClient) {
+	// Every call gets a deadline. It travels to the server as the
+	// grpc-timeout header, so the server's ctx expires too.
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	u, err := client.CreateUser(ctx, &usersv1.CreateUserRequest{Name: "Carol", Email: "carol@example.com"})
+	if err != nil {
+		printStatus("CreateUser", err)
+		return
+	}
+	fmt.Printf("created  #%d %s <%s>\n", u.GetId(), u.GetName(), u.GetEmail())
+
+	u, err = client.GetUser(ctx, &usersv1.GetUserRequest{Id: u.GetId()})
+	if err != nil {
+		printStatus("GetUser", err)
+		return
+	}
+	fmt.Printf("fetched  #%d %s, created %s\n", u.GetId(), u.GetName(), u.GetCreatedAt().AsTime().Format(time.RFC3339))
+
+	// Errors carry a code and a message; switch on the code, never
+	// on the text
+	_, err = client.GetUser(ctx, &usersv1.GetUserRequest{Id: 999})
+	printStatus("GetUser(999)", err)
+
+	_, err = client.CreateUser(ctx, &usersv1.CreateUserRequest{Name: "NoEmail"})
+	printStatus("CreateUser(no email)", err)
+}
+
+// printStatus unpacks a gRPC error into its code and message
+func printStatus(call string, err error) {
+	st := status.Convert(err)
+	switch st.Code() {
+	case codes.OK:
+		fmt.Printf("%-22s ok\n", call)
+	case codes.NotFound, codes.InvalidArgument:
+		fmt.Printf("%-22s %s: %s (our mistake, don't retry)\n", call, st.Code(), st.Message())
+	case codes.Unavailable, codes.DeadlineExceeded:
+		fmt.Printf("%-22s %s: %s (transient, safe to retry)\n", call, st.Code(), st.Message())
+	default:
+		fmt.Printf("%-22s %s: %s\n", call, st.Code(), st.Message())
+	}
+}
+
+func listUsers(client usersv1.UsersServiceClient, prefix string) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := client.ListUsers(ctx, &usersv1.ListUsersRequest{NamePrefix: prefix})
+	if err != nil {
+		printStatus("ListUsers", err)
+		return
+	}
+	for {
+		u, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return // the server returned nil: stream finished cleanly
+		}
+		if err != nil {
+			printStatus("ListUsers", err)
+			return
+		}
+		fmt.Printf("%s  #%d %s\n", time.Now().Format("15:04:05.000"), u.GetId(), u.GetName())
+	}
+}
+
+func bulkCreate(client usersv1.UsersServiceClient) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	stream, err := client.BulkCreateUsers(ctx)
+	if err != nil {
+		printStatus("BulkCreateUsers", err)
+		return
+	}
+
+	rows := []*usersv1.CreateUserRequest{
+		{Name: "Dan", Email: "dan@example.com"},
+		{Name: "", Email: "ghost@example.com"},
+		{Name: "Eve", Email: "not-an-email"},
+		{Name: "Fay", Email: "fay@example.com"},
+	}
+
+	// Sender: streams requests, then CloseSend tells the server no
+	// more are coming (it sees io.EOF). Send is safe to call from one
+	// goroutine while another calls Recv.
+	go func() {
+		for _, r := range rows {
+			if err := stream.Send(r); err != nil {
+				return // Recv below will report the real error
+			}
+			time.Sleep(50 * time.Millisecond)
+		}
+		stream.CloseSend()
+	}()
+
+	// Receiver: results arrive as the server produces them, while the
+	// sender is still sending
+	for {
+		res, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return
+		}
+		if err != nil {
+			printStatus("BulkCreateUsers", err)
+			return
+		}
+		switch r := res.GetResult().(type) {
+		case *usersv1.CreateUserResult_User:
+			fmt.Printf("row %d: created #%d %s\n", res.GetIndex(), r.User.GetId(), r.User.GetName())
+		case *usersv1.CreateUserResult_Error:
+			fmt.Printf("row %d: rejected: %s\n", res.GetIndex(), r.Error)
+		}
+	}
+}
@@ -0,0 +1,17 @@
+// Package usersv1 holds the code protoc generates from
+// proto/users/v1/users.proto: message types (users.pb.go) and the
+// client and server stubs (users_grpc.pb.go).
+//
+// The generated files are checked in, so the server and client build
+// with nothing but the Go toolchain. After changing the .proto,
+// regenerate them with the plugin versions they were made with (see
+// the header of each file) and commit the result:
+//   go install google.golang.org/protobuf/cmd/protoc-gen-go@v1.36.6
+//   go install google.golang.org/grpc/cmd/protoc-gen-go-grpc@v1.5.1
+//   go generate ./...
+//
+// protoc itself comes from your package manager (protobuf-compiler)
+// or https://github.com/protocolbuffers/protobuf/releases.
+package usersv1
+
+//go:generate protoc -I ../../../proto --go_out=../.. --go_opt=paths=source_relative --go-grpc_out=../.. --go-grpc_opt=paths=source_relative users/v1/users.proto
@@ -0,0 +1,284 @@
+// HTTP/2 and h2c - One handler, three protocols
+//
+// This example serves the same handler three ways and inspects what
+// the client actually negotiated:
+// - HTTP/1.1 over plain TCP
+// - HTTP/2 over TLS (negotiated with ALPN during the TLS handshake)
+// - h2c: HTTP/2 over plain TCP, "prior knowledge" - the client just
+//   starts speaking HTTP/2 (used behind load balancers and for gRPC)
+//
+// Then it shows what HTTP/2 changes in practice:
+// - Multiplexing: 10 concurrent requests share one connection on
+//   HTTP/2, but need up to 10 connections on HTTP/1.1
+// - Flow control: a client that stops reading makes the server's
+//   writes block once the stream's receive window is full
+//
+// Everything runs in one process on loopback ports, with a
+// self-signed certificate generated at startup. Requires Go 1.24+
+// (http.Protocols); no golang.org/x/net needed.
+//
+// Usage:
+//   go run http2_demo.go
+//
+// Try the servers with curl while it waits at the end:
+//   curl -sk --http2 https://localhost:8443/        (HTTP/2 via ALPN)
+//   curl -s --http2-prior-knowledge http://localhost:8082/   (h2c)
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"io"
+	"log"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// handler reports which protocol the request arrived on
+func handler(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/slow" {
+		time.Sleep(200 * time.Millisecond)
+	}
+	tlsInfo := "no TLS"
+	if r.TLS != nil {
+		tlsInfo = "ALPN=" + r.TLS.NegotiatedProtocol
+	}
+	fmt.Fprintf(w, "%s from %s (%s)\n", r.Proto, r.RemoteAddr, tlsInfo)
+}
+
+// bigHandler streams 1MB in 16KB chunks and records how far it got,
+// so the flow-control demo can watch the writes stall
+func bigHandler(progress *atomic.Int64) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		chunk := make([]byte, 16<<10)
+		for range 64 {
+			if _, err := w.Write(chunk); err != nil {
+				return
+			}
+			// Write blocks once the client's window is used up and
+			// unblocks only when the client reads (sends WINDOW_UPDATE)
+			progress.Add(int64(len(chunk)))
+		}
+	}
+}
+
+// selfSignedCert creates a throwaway certificate for localhost
+func selfSignedCert() (tls.Certificate, *x509.CertPool, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(24 * time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+	leaf, err := x509.ParseCertificate(der)
+	if err != nil {
+		return tls.Certificate{}, nil, err
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(leaf)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: leaf}, pool, nil
+}
+
+// protocols is a small helper to build an http.Protocols value
+func protocols(http1, http2, h2c bool) *http.Protocols {
+	p := new(http.Protocols)
+	p.SetHTTP1(http1)
+	p.SetHTTP2(http2)
+	p.SetUnencryptedHTTP2(h2c)
+	return p
+}
+
+// serve starts srv on addr in the background
+func serve(srv *http.Server, addr string, useTLS bool) {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Fatalf("listen %s: %v", addr, err)
+	}
+	go func() {
+		var err error
+		if useTLS {
+			err = srv.ServeTLS(ln, "", "") // cert comes from srv.TLSConfig
+		} else {
+			err = srv.Serve(ln)
+		}
+		if err != http.ErrServerClosed {
+			log.Printf("serve %s: %v", addr, err)
+		}
+	}()
+}
+
+// connCounter uses httptrace to count distinct connections
+type connCounter struct {
+	mu    sync.Mutex
+	conns map[string]int // local address -> requests served on it
+}
+
+func (c *connCounter) trace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			c.mu.Lock()
+			defer c.mu.Unlock()
+			c.conns[info.Conn.LocalAddr().String()]++
+		},
+	}
+}
+
+// fetchOnce prints the negotiated protocol for one request
+func fetchOnce(label string, client *http.Client, url string) {
+	resp, err := client.Get(url)
+	if err != nil {
+		fmt.Printf("%-10s error: %v\n", label, err)
+		return
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(resp.Body)
+	alpn := "-"
+	if resp.TLS != nil {
+		alpn = resp.TLS.NegotiatedProtocol
+	}
+	fmt.Printf("%-10s resp.Proto=%-8s ALPN=%-3s server saw: %s", label, resp.Proto, alpn, body)
+}
+
+// multiplex fires n concurrent slow requests and reports how many
+// TCP connections they needed
+func multiplex(label string, client *http.Client, url string, n int) {
+	counter := &connCounter{conns: map[string]int{}}
+	start := time.Now()
+
+	var wg sync.WaitGroup
+	for range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req, _ := http.NewRequest(http.MethodGet, url+"/slow", nil)
+			req = req.WithContext(httptrace.WithClientTrace(req.Context(), counter.trace()))
+			resp, err := client.Do(req)
+			if err != nil {
+				log.Printf("%s: %v", label, err)
+				return
+			}
+			io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}()
+	}
+	wg.Wait()
+	fmt.Printf("%-10s %d requests over %d connection(s) in %v\n",
+		label, n, len(counter.conns), time.Since(start).Round(10*time.Millisecond))
+}
+
+func main() {
+	cert, pool, err := selfSignedCert()
+	if err != nil {
+		log.Fatalf("certificate: %v", err)
+	}
+
+	var progress atomic.Int64
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", handler)
+	mux.HandleFunc("/big", bigHandler(&progress))
+
+	// HTTP/1.1 only
+	h1 := &http.Server{Handler: mux, Protocols: protocols(true, false, false)}
+	serve(h1, "127.0.0.1:8081", false)
+
+	// HTTPS: HTTP/2 is on by default for a TLS server; the client picks
+	// it through ALPN ("h2"), falling back to "http/1.1"
+	h2 := &http.Server{
+		Handler:   mux,
+		TLSConfig: &tls.Config{Certificates: []tls.Certificate{cert}},
+		HTTP2: &http.HTTP2Config{
+			MaxConcurrentStreams: 100,
+		},
+	}
+	serve(h2, "127.0.0.1:8443", true)
+
+	// h2c: accept HTTP/2 without TLS alongside HTTP/1.1. Only do this
+	// where the network path is trusted (e.g. behind a TLS-terminating
+	// proxy) - h2c has no encryption.
+	h2c := &http.Server{Handler: mux, Protocols: protocols(true, false, true)}
+	serve(h2c, "127.0.0.1:8082", false)
+
+	// One client per style. Transport.Protocols says what the client may
+	// speak; with only UnencryptedHTTP2 set it uses h2c prior knowledge.
+	h1Client := &http.Client{Transport: &http.Transport{}}
+	h2Client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{RootCAs: pool},
+		Protocols:       protocols(true, true, false),
+	}}
+	h2cClient := &http.Client{Transport: &http.Transport{
+		Protocols: protocols(false, false, true),
+	}}
+
+	fmt.Println("=== Negotiated protocol ===")
+	fetchOnce("http/1.1", h1Client, "http://127.0.0.1:8081/")
+	fetchOnce("h2 (TLS)", h2Client, "https://127.0.0.1:8443/")
+	fetchOnce("h2c", h2cClient, "http://127.0.0.1:8082/")
+	// Plain HTTP/1.1 still works against the h2c server
+	fetchOnce("h1 to h2c", h1Client, "http://127.0.0.1:8082/")
+
+	fmt.Println()
+	fmt.Println("=== Multiplexing: 10 concurrent 200ms requests ===")
+	// HTTP/1.1 can have one request in flight per connection, so the
+	// transport opens more; HTTP/2 interleaves all of them as streams
+	// on a single connection
+	multiplex("http/1.1", h1Client, "http://127.0.0.1:8081", 10)
+	multiplex("h2 (TLS)", h2Client, "https://127.0.0.1:8443", 10)
+	multiplex("h2c", h2cClient, "http://127.0.0.1:8082", 10)
+
+	fmt.Println()
+	fmt.Println("=== Flow control: a client that stops reading ===")
+	// A small per-stream receive window on the client: the server may
+	// send this much before it has to wait for a WINDOW_UPDATE
+	slowReader := &http.Client{Transport: &http.Transport{
+		Protocols: protocols(false, false, true),
+		HTTP2: &http.HTTP2Config{
+			MaxReceiveBufferPerStream:     64 << 10,
+			MaxReceiveBufferPerConnection: 1 << 20,
+		},
+	}}
+	resp, err := slowReader.Get("http://127.0.0.1:8082/big")
+	if err != nil {
+		log.Fatalf("big: %v", err)
+	}
+	for i := range 3 {
+		time.Sleep(300 * time.Millisecond)
+		fmt.Printf("not reading, t=%dms: server has written %3d KB of 1024\n", (i+1)*300, progress.Load()>>10)
+	}
+	n, _ := io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+	fmt.Printf("after reading:        server has written %3d KB, client got %d KB\n", progress.Load()>>10, n>>10)
+	// The stall is backpressure, end to end: the slow consumer throttles
+	// the producer without either side buffering the whole response.
+	// TCP does the same per connection; HTTP/2 adds it per stream so one
+	// slow stream can't starve the others sharing the connection.
+
+	fmt.Println()
+	fmt.Println("Servers still running for curl; Ctrl+C to exit")
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	<-sig
+}
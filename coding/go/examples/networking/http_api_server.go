@@ -4,12 +4,12 @@
 // - HTTP routing with net/http
 // - JSON encoding/decoding
 // - Middleware pattern
-// - Error handling
+// - Error handling (domain errors mapped to statuses in http_errors.go)
 // - Request context
 // - Graceful shutdown
 //
-// Usage:
-//   go run http_api_server.go
+// Usage (the error mapping lives in http_errors.go, so name it too):
+//   go run http_api_server.go http_errors.go
 //
 // Test endpoints:
 //   curl http://localhost:8080/health
@@ -206,7 +206,7 @@ func (s *APIServer) handleUser(w http.ResponseWriter, r *http.Request) {
 	idStr := strings.TrimPrefix(r.URL.Path, "/api/users/")
 	id, err := strconv.Atoi(idStr)
 	if err != nil {
-		s.jsonError(w, http.StatusBadRequest, "invalid user ID")
+		s.jsonError(w, &ValidationError{Field: "id", Message: "must be an integer"})
 		return
 	}
 	
@@ -232,12 +232,16 @@ func (s *APIServer) createUser(w http.ResponseWriter, r *http.Request) {
 	}
 	
 	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
-		s.jsonError(w, http.StatusBadRequest, "invalid JSON")
+		s.jsonError(w, fmt.Errorf("%w: malformed JSON body: %v", ErrInvalidInput, err))
 		return
 	}
 	
-	if input.Name == "" || input.Email == "" {
-		s.jsonError(w, http.StatusBadRequest, "name and email required")
+	if input.Name == "" {
+		s.jsonError(w, &ValidationError{Field: "name", Message: "required"})
+		return
+	}
+	if input.Email == "" {
+		s.jsonError(w, &ValidationError{Field: "email", Message: "required"})
 		return
 	}
 	
@@ -248,7 +252,7 @@ func (s *APIServer) createUser(w http.ResponseWriter, r *http.Request) {
 func (s *APIServer) getUser(w http.ResponseWriter, r *http.Request, id int) {
 	user, ok := s.store.Get(id)
 	if !ok {
-		s.jsonError(w, http.StatusNotFound, "user not found")
+		s.jsonError(w, fmt.Errorf("get user %d: %w", id, ErrNotFound))
 		return
 	}
 	s.jsonResponse(w, http.StatusOK, user)
@@ -256,7 +260,7 @@ func (s *APIServer) getUser(w http.ResponseWriter, r *http.Request, id int) {
 
 func (s *APIServer) deleteUser(w http.ResponseWriter, r *http.Request, id int) {
 	if !s.store.Delete(id) {
-		s.jsonError(w, http.StatusNotFound, "user not found")
+		s.jsonError(w, fmt.Errorf("delete user %d: %w", id, ErrNotFound))
 		return
 	}
 	w.WriteHeader(http.StatusNoContent)
@@ -272,15 +276,25 @@ func (s *APIServer) jsonResponse(w http.ResponseWriter, status int, data interfa
 	json.NewEncoder(w).Encode(data)
 }
 
-func (s *APIServer) jsonError(w http.ResponseWriter, status int, message string) {
-	s.jsonResponse(w, status, ErrorResponse{
-		Error: message,
-		Code:  status,
+// jsonError turns any error into a JSON error response. The status
+// and message come from ClassifyError, so handlers only decide what
+// went wrong, never how it looks on the wire.
+func (s *APIServer) jsonError(w http.ResponseWriter, err error) {
+	he := ClassifyError(err)
+	if he.Status >= http.StatusInternalServerError {
+		// Our fault: the full error goes to the log, not the client
+		log.Printf("internal error: %v", err)
+	}
+
+	s.jsonResponse(w, he.Status, ErrorResponse{
+		Error:   he.Message,
+		Code:    he.Status,
+		Details: he.Details,
 	})
 }
 
 func (s *APIServer) methodNotAllowed(w http.ResponseWriter) {
-	s.jsonError(w, http.StatusMethodNotAllowed, "method not allowed")
+	s.jsonError(w, ErrMethodNotAllowed)
 }
 
 // ============================================================
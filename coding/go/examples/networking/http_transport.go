@@ -0,0 +1,394 @@
+// HTTP Transport Tuning - Why connection reuse matters
+//
+// http.Client is only as good as its Transport, the part that dials,
+// pools and reuses TCP connections. This example hammers a local
+// server with bursts of concurrent requests through differently
+// configured transports, and uses net/http/httptrace to count how
+// many requests got a reused connection and how many dialed anew:
+// - A new Transport per request: every request dials, nothing pools
+// - http.DefaultTransport: MaxIdleConnsPerHost is 2, so after each
+//   burst of concurrent requests all but 2 connections are closed and
+//   the next burst dials again - churn that also piles up sockets in
+//   TIME_WAIT
+// - Tuned: an idle pool as big as the concurrency, so connections
+//   stay open and get reused
+// - Closing a big body before EOF: the connection can't be reused
+//   (Close drains up to 256KB itself, so small bodies are forgiven)
+// - MaxConnsPerHost: a hard cap; extra requests queue for a connection
+// - DisableKeepAlives: one connection per request, on purpose
+// The "open" column is what each leaves behind: idle connections the
+// server keeps a socket and a goroutine for.
+// It then traces one request step by step, and shows what the
+// Transport and Client timeouts do against a server that accepts
+// connections but never answers.
+//
+// Usage:
+//   go run http_transport.go
+//   go run http_transport.go -c 64 -n 5000
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ============================================================
+// Tracing
+// ============================================================
+
+// connStats counts what httptrace reports across many requests
+type connStats struct {
+	requests atomic.Int64
+	reused   atomic.Int64 // GotConn with Reused: no dial needed
+	dials    atomic.Int64 // ConnectDone: a new TCP connection
+	dialTime atomic.Int64 // nanoseconds spent dialing
+}
+
+// trace returns hooks for one request. ConnectStart and ConnectDone
+// fire on the goroutine doing the dial, which may finish after the
+// request has already been handed a different, freed-up connection -
+// so dials and non-reused requests don't always match one to one.
+func (s *connStats) trace() *httptrace.ClientTrace {
+	var dialStart time.Time
+	return &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			s.requests.Add(1)
+			if info.Reused {
+				s.reused.Add(1)
+			}
+		},
+		ConnectStart: func(network, addr string) { dialStart = time.Now() },
+		ConnectDone: func(network, addr string, err error) {
+			if err == nil {
+				s.dials.Add(1)
+				s.dialTime.Add(int64(time.Since(dialStart)))
+			}
+		},
+	}
+}
+
+// ============================================================
+// Load generator
+// ============================================================
+
+type scenario struct {
+	name string
+	// client returns the client for one request; most scenarios share
+	// one, the anti-pattern builds a new one every time
+	client func() *http.Client
+	// query is added to the URL, to ask for a bigger body
+	query string
+	// drain reads the body to EOF before closing it; otherwise only
+	// the first kilobyte is read
+	drain bool
+}
+
+type result struct {
+	elapsed  time.Duration
+	p50, p99 time.Duration
+	errors   int64
+	stats    *connStats
+}
+
+// run sends total requests in bursts of concurrency, with a short
+// pause between bursts - the shape of a service fanning out calls per
+// incoming request, and the shape that punishes a small idle pool
+func run(sc scenario, url string, concurrency, total int) result {
+	stats := &connStats{}
+	var (
+		errs      atomic.Int64
+		mu        sync.Mutex
+		latencies = make([]time.Duration, 0, total)
+	)
+	start := time.Now()
+	for sent := 0; sent < total; sent += concurrency {
+		var wg sync.WaitGroup
+		for range min(concurrency, total-sent) {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				t0 := time.Now()
+				if err := fetch(sc, url+sc.query, stats); err != nil {
+					errs.Add(1)
+					return
+				}
+				d := time.Since(t0)
+				mu.Lock()
+				latencies = append(latencies, d)
+				mu.Unlock()
+			}()
+		}
+		wg.Wait()
+		time.Sleep(2 * time.Millisecond)
+	}
+	res := result{elapsed: time.Since(start), errors: errs.Load(), stats: stats}
+	slices.Sort(latencies)
+	if n := len(latencies); n > 0 {
+		res.p50, res.p99 = latencies[n/2], latencies[n*99/100]
+	}
+	return res
+}
+
+func fetch(sc scenario, url string, stats *connStats) error {
+	ctx := httptrace.WithClientTrace(context.Background(), stats.trace())
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := sc.client().Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if !sc.drain {
+		_, err = io.CopyN(io.Discard, resp.Body, 1<<10)
+		return err
+	}
+	// Reading to EOF is what tells the Transport the connection is
+	// clean and can go back to the pool
+	_, err = io.Copy(io.Discard, resp.Body)
+	return err
+}
+
+// ============================================================
+// Transports
+// ============================================================
+
+// tunedTransport is a Transport for talking to one busy backend.
+// Every timeout here is one a production client should set: the zero
+// value for each is "wait forever".
+func tunedTransport(concurrency int) *http.Transport {
+	dialer := &net.Dialer{
+		Timeout:   2 * time.Second,  // TCP connect
+		KeepAlive: 30 * time.Second, // TCP keepalive probes on idle conns
+	}
+	return &http.Transport{
+		Proxy:                 http.ProxyFromEnvironment,
+		DialContext:           dialer.DialContext,
+		MaxIdleConns:          200,         // across all hosts
+		MaxIdleConnsPerHost:   concurrency, // the default of 2 is the trap
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   5 * time.Second,
+		ResponseHeaderTimeout: 5 * time.Second,
+		ExpectContinueTimeout: time.Second,
+		ForceAttemptHTTP2:     true,
+	}
+}
+
+// ============================================================
+// Step-by-step trace of a single request
+// ============================================================
+
+func traceOne(client *http.Client, url string) {
+	start := time.Now()
+	step := func(format string, args ...any) {
+		fmt.Printf("  %8s  %s\n", time.Since(start).Round(time.Microsecond), fmt.Sprintf(format, args...))
+	}
+	trace := &httptrace.ClientTrace{
+		GetConn:      func(hostPort string) { step("GetConn %s", hostPort) },
+		ConnectStart: func(network, addr string) { step("ConnectStart %s %s", network, addr) },
+		ConnectDone: func(network, addr string, err error) {
+			step("ConnectDone err=%v", err)
+		},
+		TLSHandshakeStart: func() { step("TLSHandshakeStart") },
+		TLSHandshakeDone: func(cs tls.ConnectionState, err error) {
+			step("TLSHandshakeDone err=%v", err)
+		},
+		GotConn: func(info httptrace.GotConnInfo) {
+			step("GotConn reused=%v wasIdle=%v idleTime=%v local=%s",
+				info.Reused, info.WasIdle, info.IdleTime.Round(time.Millisecond), info.Conn.LocalAddr())
+		},
+		WroteRequest:         func(info httptrace.WroteRequestInfo) { step("WroteRequest err=%v", info.Err) },
+		GotFirstResponseByte: func() { step("GotFirstResponseByte") },
+		PutIdleConn: func(err error) {
+			step("PutIdleConn err=%v (back in the pool)", err)
+		},
+	}
+	for i := 1; i <= 2; i++ {
+		fmt.Printf(" request %d:\n", i)
+		start = time.Now()
+		req, _ := http.NewRequestWithContext(httptrace.WithClientTrace(context.Background(), trace), "GET", url, nil)
+		resp, err := client.Do(req)
+		if err != nil {
+			fmt.Println("  error:", err)
+			return
+		}
+		io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// blackHole accepts TCP connections and never answers them, like a
+// wedged backend whose kernel still completes handshakes
+func blackHole() (net.Listener, error) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		var held []net.Conn
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				for _, c := range held {
+					c.Close()
+				}
+				return
+			}
+			held = append(held, conn)
+		}
+	}()
+	return ln, nil
+}
+
+func main() {
+	concurrency := flag.Int("c", 32, "concurrent workers")
+	total := flag.Int("n", 3000, "requests per scenario")
+	flag.Parse()
+
+	// A server with a little latency. The body is 8KB unless ?size=
+	// asks for more.
+	var accepted, open atomic.Int64
+	srv := &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			time.Sleep(time.Millisecond)
+			size, err := strconv.Atoi(r.URL.Query().Get("size"))
+			if err != nil {
+				size = 8 << 10
+			}
+			chunk := strings.Repeat("x", 32<<10)
+			for ; size > 0; size -= len(chunk) {
+				if _, err := io.WriteString(w, chunk[:min(size, len(chunk))]); err != nil {
+					return
+				}
+			}
+		}),
+		ConnState: func(c net.Conn, s http.ConnState) {
+			switch s {
+			case http.StateNew:
+				accepted.Add(1)
+				open.Add(1)
+			case http.StateClosed, http.StateHijacked:
+				open.Add(-1)
+			}
+		},
+		IdleTimeout: time.Minute,
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		log.Fatal(err)
+	}
+	go srv.Serve(ln)
+	url := "http://" + ln.Addr().String() + "/"
+
+	// Every Transport made is tracked, so its idle connections can be
+	// closed before the next scenario starts
+	var (
+		transportsMu sync.Mutex
+		transports   []*http.Transport
+	)
+	track := func(t *http.Transport) *http.Transport {
+		transportsMu.Lock()
+		defer transportsMu.Unlock()
+		transports = append(transports, t)
+		return t
+	}
+	shared := func(t *http.Transport) func() *http.Client {
+		c := &http.Client{Transport: track(t), Timeout: 10 * time.Second}
+		return func() *http.Client { return c }
+	}
+	with := func(f func(t *http.Transport)) *http.Transport {
+		t := tunedTransport(*concurrency)
+		f(t)
+		return t
+	}
+
+	scenarios := []scenario{
+		{name: "new Transport per request", drain: true, client: func() *http.Client {
+			return &http.Client{Transport: track(tunedTransport(*concurrency)), Timeout: 10 * time.Second}
+		}},
+		{name: "DefaultTransport (2 idle/host)", drain: true,
+			client: shared(http.DefaultTransport.(*http.Transport).Clone())},
+		{name: "tuned (idle/host = workers)", drain: true, client: shared(tunedTransport(*concurrency))},
+		{name: "tuned, 1MB body closed early", query: "?size=1048576",
+			client: shared(tunedTransport(*concurrency))},
+		{name: "tuned, MaxConnsPerHost=4", drain: true,
+			client: shared(with(func(t *http.Transport) { t.MaxConnsPerHost = 4 }))},
+		{name: "DisableKeepAlives", drain: true,
+			client: shared(with(func(t *http.Transport) { t.DisableKeepAlives = true }))},
+	}
+
+	fmt.Printf("=== %d requests per scenario, in bursts of %d ===\n", *total, *concurrency)
+	fmt.Printf("%-31s %7s %8s %8s %6s %7s %9s %5s\n", "scenario", "req/s", "p50", "p99", "dials", "reused", "dial avg", "open")
+	for _, sc := range scenarios {
+		before := accepted.Load()
+		r := run(sc, url, *concurrency, *total)
+		s := r.stats
+		dialAvg := time.Duration(0)
+		if n := s.dials.Load(); n > 0 {
+			dialAvg = time.Duration(s.dialTime.Load() / n)
+		}
+		time.Sleep(50 * time.Millisecond) // let the server notice closes
+		fmt.Printf("%-31s %7.0f %8s %8s %6d %6.1f%% %9s %5d",
+			sc.name, float64(*total)/r.elapsed.Seconds(),
+			r.p50.Round(10*time.Microsecond), r.p99.Round(10*time.Microsecond),
+			accepted.Load()-before, 100*float64(s.reused.Load())/float64(max(s.requests.Load(), 1)),
+			dialAvg.Round(time.Microsecond), open.Load())
+		if r.errors > 0 {
+			fmt.Printf("  (%d errors)", r.errors)
+		}
+		fmt.Println()
+
+		transportsMu.Lock()
+		for _, t := range transports {
+			t.CloseIdleConnections()
+		}
+		transportsMu.Unlock()
+		time.Sleep(50 * time.Millisecond)
+	}
+	fmt.Println("(dials counts connections the server accepted; on a real network")
+	fmt.Println(" each one also costs a round trip, and a TLS handshake on top.")
+	fmt.Println(" A Transport per request leaves every connection open until")
+	fmt.Println(" IdleConnTimeout, since nothing will ever use or close them.)")
+
+	fmt.Println()
+	fmt.Println("=== One request traced, then a second on the same Transport ===")
+	traceOne(&http.Client{Transport: tunedTransport(4)}, url)
+
+	fmt.Println()
+	fmt.Println("=== Timeouts against a server that never answers ===")
+	hole, err := blackHole()
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer hole.Close()
+	holeURL := "http://" + hole.Addr().String() + "/"
+	guarded := tunedTransport(4)
+	guarded.ResponseHeaderTimeout = 300 * time.Millisecond
+	for _, tc := range []struct {
+		name   string
+		client *http.Client
+	}{
+		{"ResponseHeaderTimeout 300ms", &http.Client{Transport: guarded}},
+		{"Client.Timeout 500ms", &http.Client{Transport: tunedTransport(4), Timeout: 500 * time.Millisecond}},
+	} {
+		t0 := time.Now()
+		_, err := tc.client.Get(holeURL)
+		fmt.Printf("%-28s failed after %v: %v\n", tc.name, time.Since(t0).Round(10*time.Millisecond), err)
+	}
+	fmt.Println("(with neither, and DefaultTransport, this request would hang forever)")
+}
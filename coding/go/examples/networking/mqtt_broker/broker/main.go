@@ -0,0 +1,360 @@
+// MQTT Broker - Long-lived pub/sub connections over TCP
+//
+// Unlike request/response protocols, an MQTT client connects once
+// and stays connected; the broker remembers who it is and what it
+// subscribed to, and pushes messages to it whenever they arrive.
+// This broker speaks a QoS 0 subset of MQTT 3.1.1:
+// - Topic subscriptions with + and # wildcards
+// - QoS 0 delivery: at most once, no acknowledgements. QoS 1
+//   publishes are acknowledged but delivered onward at QoS 0
+// - Retained messages: the last retained message on a topic is sent
+//   to every new subscriber, so they get the current state at once
+// - Keepalive: a client silent for 1.5x its keepalive is dropped
+// - Client ID takeover: a second connection with the same ID kicks
+//   the first one off
+// - Slow subscribers can't stall publishers: each client has a
+//   bounded outbound queue, and QoS 0 messages that don't fit are
+//   dropped for that client only
+//
+// Usage (from the mqtt_broker directory):
+//   go run ./broker
+//   go run ./sub -t 'sensors/#'
+//   go run ./pub -t sensors/kitchen/temp -m 21.5 -r
+//
+// mosquitto_sub / mosquitto_pub work too; see package mqtt.
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bellistech/labs/coding/go/examples/networking/mqtt_broker/mqtt"
+)
+
+// outboundQueue is how many messages may wait for a slow client
+const outboundQueue = 256
+
+// client is one connected session
+type client struct {
+	id   string
+	conn net.Conn
+	out  chan []byte   // encoded packets for the writer goroutine
+	done chan struct{} // closed when the session ends
+	once sync.Once
+
+	dropped atomic.Int64
+}
+
+func (c *client) close() {
+	c.once.Do(func() {
+		close(c.done)
+		c.conn.Close()
+	})
+}
+
+// enqueue queues a packet without blocking. Control packets (acks,
+// pongs) go through the same queue so they stay in order.
+func (c *client) enqueue(pkt []byte) bool {
+	select {
+	case c.out <- pkt:
+		return true
+	case <-c.done:
+		return false
+	default:
+		c.dropped.Add(1)
+		return false
+	}
+}
+
+// writeLoop is the only goroutine that writes to the connection
+func (c *client) writeLoop() {
+	w := bufio.NewWriter(c.conn)
+	for {
+		select {
+		case <-c.done:
+			return
+		case pkt := <-c.out:
+			w.Write(pkt)
+			// Batch: drain whatever else is queued, then flush once
+			for n := len(c.out); n > 0; n-- {
+				w.Write(<-c.out)
+			}
+			c.conn.SetWriteDeadline(time.Now().Add(10 * time.Second))
+			if err := w.Flush(); err != nil {
+				c.close()
+				return
+			}
+		}
+	}
+}
+
+// Broker holds sessions, subscriptions and retained messages
+type Broker struct {
+	mu       sync.RWMutex
+	clients  map[string]*client
+	subs     map[string]map[*client]struct{} // filter -> subscribers
+	retained map[string]*mqtt.Publish        // topic -> last retained message
+
+	published, delivered atomic.Int64
+}
+
+func NewBroker() *Broker {
+	return &Broker{
+		clients:  map[string]*client{},
+		subs:     map[string]map[*client]struct{}{},
+		retained: map[string]*mqtt.Publish{},
+	}
+}
+
+func (b *Broker) Serve(ln net.Listener) error {
+	var n atomic.Int64
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		go b.handle(conn, fmt.Sprintf("auto-%d", n.Add(1)))
+	}
+}
+
+func (b *Broker) handle(conn net.Conn, autoID string) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	// The first packet must be CONNECT, and it must come quickly
+	conn.SetReadDeadline(time.Now().Add(10 * time.Second))
+	p, err := mqtt.ReadPacket(r)
+	connect, ok := p.(*mqtt.Connect)
+	if errors.Is(err, mqtt.ErrProtocolLevel) {
+		// MQTT 5 clients, say: tell them before hanging up
+		conn.Write((&mqtt.Connack{ReturnCode: mqtt.RefusedProtocol}).Encode())
+		return
+	}
+	if err != nil || !ok {
+		return
+	}
+	if connect.ClientID == "" {
+		if !connect.CleanSession {
+			// A persistent session needs an ID to find it again
+			conn.Write((&mqtt.Connack{ReturnCode: mqtt.RefusedIdentifier}).Encode())
+			return
+		}
+		connect.ClientID = autoID
+	}
+
+	c := &client{id: connect.ClientID, conn: conn, out: make(chan []byte, outboundQueue), done: make(chan struct{})}
+	b.register(c)
+	defer b.unregister(c)
+	go c.writeLoop()
+	c.enqueue((&mqtt.Connack{ReturnCode: mqtt.Accepted}).Encode())
+	log.Printf("%s connected from %s (keepalive %ds)", c.id, conn.RemoteAddr(), connect.KeepAlive)
+
+	// Keepalive: the spec allows 1.5x before the broker gives up
+	timeout := time.Duration(connect.KeepAlive) * time.Second * 3 / 2
+	reason := "disconnected"
+	defer func() {
+		log.Printf("%s %s (%d messages dropped for slowness)", c.id, reason, c.dropped.Load())
+	}()
+	for {
+		if timeout > 0 {
+			conn.SetReadDeadline(time.Now().Add(timeout))
+		} else {
+			conn.SetReadDeadline(time.Time{})
+		}
+		p, err := mqtt.ReadPacket(r)
+		var netErr net.Error
+		switch {
+		case errors.As(err, &netErr) && netErr.Timeout():
+			reason = "timed out (no packets within 1.5x keepalive)"
+			return
+		case errors.Is(err, io.EOF):
+			reason = "went away without DISCONNECT"
+			return
+		case err != nil:
+			select {
+			case <-c.done:
+				reason = "was taken over by a new connection"
+			default:
+				reason = "dropped: " + err.Error()
+			}
+			return
+		}
+
+		switch p := p.(type) {
+		case *mqtt.Publish:
+			if p.QoS == 2 {
+				reason = "dropped: QoS 2 not supported"
+				return
+			}
+			if !mqtt.ValidTopic(p.Topic) {
+				reason = "dropped: invalid topic " + p.Topic
+				return
+			}
+			if p.QoS == 1 {
+				c.enqueue((&mqtt.Puback{PacketID: p.PacketID}).Encode())
+			}
+			b.publish(p)
+		case *mqtt.Subscribe:
+			codes := b.subscribe(c, p.Subscriptions)
+			c.enqueue((&mqtt.Suback{PacketID: p.PacketID, ReturnCodes: codes}).Encode())
+			b.sendRetained(c, p.Subscriptions, codes)
+		case *mqtt.Unsubscribe:
+			b.unsubscribe(c, p.Filters)
+			c.enqueue((&mqtt.Unsuback{PacketID: p.PacketID}).Encode())
+		case *mqtt.Pingreq:
+			c.enqueue((&mqtt.Pingresp{}).Encode())
+		case *mqtt.Disconnect:
+			reason = "disconnected cleanly"
+			return
+		default:
+			reason = fmt.Sprintf("dropped: unexpected %T", p)
+			return
+		}
+	}
+}
+
+// register adds c, kicking off any existing session with the same ID
+func (b *Broker) register(c *client) {
+	b.mu.Lock()
+	old := b.clients[c.id]
+	b.clients[c.id] = c
+	b.mu.Unlock()
+	if old != nil {
+		old.close()
+	}
+}
+
+func (b *Broker) unregister(c *client) {
+	c.close()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.clients[c.id] == c { // not if a newer session replaced us
+		delete(b.clients, c.id)
+	}
+	// Clean sessions only: subscriptions end with the connection
+	for filter, subs := range b.subs {
+		delete(subs, c)
+		if len(subs) == 0 {
+			delete(b.subs, filter)
+		}
+	}
+}
+
+func (b *Broker) subscribe(c *client, subs []mqtt.Subscription) []byte {
+	codes := make([]byte, len(subs))
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for i, s := range subs {
+		if !mqtt.ValidFilter(s.Filter) {
+			codes[i] = 0x80
+			continue
+		}
+		if b.subs[s.Filter] == nil {
+			b.subs[s.Filter] = map[*client]struct{}{}
+		}
+		b.subs[s.Filter][c] = struct{}{}
+		codes[i] = 0 // granted QoS 0, whatever was asked
+	}
+	return codes
+}
+
+func (b *Broker) unsubscribe(c *client, filters []string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, f := range filters {
+		delete(b.subs[f], c)
+		if len(b.subs[f]) == 0 {
+			delete(b.subs, f)
+		}
+	}
+}
+
+// publish stores retained messages and fans the message out
+func (b *Broker) publish(p *mqtt.Publish) {
+	b.published.Add(1)
+	if p.Retain {
+		b.mu.Lock()
+		if len(p.Payload) == 0 {
+			delete(b.retained, p.Topic) // empty retained message clears it
+		} else {
+			b.retained[p.Topic] = &mqtt.Publish{Topic: p.Topic, Payload: p.Payload, Retain: true}
+		}
+		b.mu.Unlock()
+	}
+
+	// Messages to current subscribers have the retain flag cleared; it
+	// only marks "this is stored state" for new subscribers
+	pkt := (&mqtt.Publish{Topic: p.Topic, Payload: p.Payload}).Encode()
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	// A client whose filters overlap (a/# and a/+) gets one copy
+	sent := map[*client]bool{}
+	for filter, subs := range b.subs {
+		if !mqtt.Match(filter, p.Topic) {
+			continue
+		}
+		for c := range subs {
+			if !sent[c] {
+				sent[c] = true
+				if c.enqueue(pkt) {
+					b.delivered.Add(1)
+				}
+			}
+		}
+	}
+}
+
+// sendRetained delivers the stored state for newly granted filters
+func (b *Broker) sendRetained(c *client, subs []mqtt.Subscription, codes []byte) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for i, s := range subs {
+		if codes[i] == 0x80 {
+			continue
+		}
+		for topic, msg := range b.retained {
+			if mqtt.Match(s.Filter, topic) {
+				c.enqueue(msg.Encode())
+			}
+		}
+	}
+}
+
+// stats logs a line every interval while there's traffic
+func (b *Broker) stats(interval time.Duration) {
+	var lastPub int64
+	for range time.Tick(interval) {
+		pub := b.published.Load()
+		if pub == lastPub {
+			continue
+		}
+		lastPub = pub
+		b.mu.RLock()
+		log.Printf("stats: %d clients, %d filters, %d retained, %d published, %d delivered",
+			len(b.clients), len(b.subs), len(b.retained), pub, b.delivered.Load())
+		b.mu.RUnlock()
+	}
+}
+
+func main() {
+	addr := flag.String("addr", ":1883", "listen address")
+	flag.Parse()
+
+	ln, err := net.Listen("tcp", *addr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	b := NewBroker()
+	go b.stats(10 * time.Second)
+	log.Printf("MQTT broker listening on %s", ln.Addr())
+	log.Fatal(b.Serve(ln))
+}
@@ -0,0 +1,3 @@
+module github.com/bellistech/labs/coding/go/examples/networking/mqtt_broker
+
+go 1.24
@@ -0,0 +1,243 @@
+package mqtt
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+)
+
+// Client is a minimal QoS 0 client, enough for the pub and sub
+// programs
+type Client struct {
+	conn      net.Conn
+	keepAlive time.Duration
+
+	writeMu sync.Mutex // one packet at a time on the wire
+
+	mu      sync.Mutex
+	nextID  uint16
+	pending map[uint16]chan Packet // waiting for SUBACK/UNSUBACK
+	pong    chan struct{}
+
+	// Messages delivers incoming PUBLISH packets. It is closed when
+	// the connection ends; Err then says why.
+	Messages chan *Publish
+	done     chan struct{}
+	err      error
+}
+
+// ErrClosed is returned by calls on a closed client
+var ErrClosed = errors.New("mqtt: client closed")
+
+// Dial connects, sends CONNECT and waits for CONNACK
+func Dial(addr, clientID string, keepAlive time.Duration) (*Client, error) {
+	conn, err := net.DialTimeout("tcp", addr, 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	c := &Client{
+		conn:      conn,
+		keepAlive: keepAlive,
+		pending:   map[uint16]chan Packet{},
+		pong:      make(chan struct{}, 1),
+		Messages:  make(chan *Publish, 64),
+		done:      make(chan struct{}),
+	}
+
+	connect := &Connect{ClientID: clientID, KeepAlive: uint16(keepAlive / time.Second), CleanSession: true}
+	if _, err := conn.Write(connect.Encode()); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	r := bufio.NewReader(conn)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	p, err := ReadPacket(r)
+	conn.SetReadDeadline(time.Time{})
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("mqtt: waiting for CONNACK: %w", err)
+	}
+	ack, ok := p.(*Connack)
+	if !ok || ack.ReturnCode != Accepted {
+		conn.Close()
+		return nil, fmt.Errorf("mqtt: connection refused: %+v", p)
+	}
+
+	go c.readLoop(r)
+	if keepAlive > 0 {
+		go c.pingLoop()
+	}
+	return c, nil
+}
+
+func (c *Client) send(p Packet) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	select {
+	case <-c.done:
+		return ErrClosed
+	default:
+	}
+	_, err := c.conn.Write(p.Encode())
+	return err
+}
+
+// readLoop owns the read side: it routes each packet to whoever is
+// waiting for it
+func (c *Client) readLoop(r *bufio.Reader) {
+	var err error
+	defer func() {
+		c.shutdown(err)
+		close(c.Messages) // only the sender closes a channel
+	}()
+	for {
+		var p Packet
+		p, err = ReadPacket(r)
+		if err != nil {
+			return
+		}
+		switch p := p.(type) {
+		case *Publish:
+			select {
+			case c.Messages <- p:
+			case <-c.done:
+				return
+			}
+		case *Suback:
+			c.complete(p.PacketID, p)
+		case *Unsuback:
+			c.complete(p.PacketID, p)
+		case *Pingresp:
+			select {
+			case c.pong <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+func (c *Client) complete(id uint16, p Packet) {
+	c.mu.Lock()
+	ch := c.pending[id]
+	delete(c.pending, id)
+	c.mu.Unlock()
+	if ch != nil {
+		ch <- p
+	}
+}
+
+// pingLoop sends PINGREQ every keepAlive and gives up if the broker
+// doesn't answer within another keepAlive. (Strictly, a client only
+// needs to ping when it has sent nothing else; always pinging is
+// simpler and costs two bytes.)
+func (c *Client) pingLoop() {
+	ticker := time.NewTicker(c.keepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+		}
+		if err := c.send(&Pingreq{}); err != nil {
+			return
+		}
+		select {
+		case <-c.pong:
+		case <-time.After(c.keepAlive):
+			c.conn.Close() // readLoop sees the error and shuts down
+			return
+		case <-c.done:
+			return
+		}
+	}
+}
+
+func (c *Client) shutdown(err error) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	select {
+	case <-c.done:
+		return
+	default:
+	}
+	c.err = err
+	close(c.done)
+	c.conn.Close() // unblocks readLoop, which closes Messages
+}
+
+// Err reports why the connection ended, once Messages is closed
+func (c *Client) Err() error {
+	<-c.done
+	return c.err
+}
+
+// request sends a packet with a fresh packet ID and waits for the
+// acknowledgement carrying the same ID
+func (c *Client) request(build func(id uint16) Packet) (Packet, error) {
+	c.mu.Lock()
+	c.nextID++
+	if c.nextID == 0 { // 0 is not a valid packet ID
+		c.nextID++
+	}
+	id := c.nextID
+	ch := make(chan Packet, 1)
+	c.pending[id] = ch
+	c.mu.Unlock()
+
+	if err := c.send(build(id)); err != nil {
+		return nil, err
+	}
+	select {
+	case p := <-ch:
+		return p, nil
+	case <-c.done:
+		return nil, ErrClosed
+	case <-time.After(5 * time.Second):
+		return nil, errors.New("mqtt: timed out waiting for acknowledgement")
+	}
+}
+
+// Subscribe subscribes to filters at QoS 0
+func (c *Client) Subscribe(filters ...string) error {
+	p, err := c.request(func(id uint16) Packet {
+		sub := &Subscribe{PacketID: id}
+		for _, f := range filters {
+			sub.Subscriptions = append(sub.Subscriptions, Subscription{Filter: f})
+		}
+		return sub
+	})
+	if err != nil {
+		return err
+	}
+	for i, code := range p.(*Suback).ReturnCodes {
+		if code == 0x80 && i < len(filters) {
+			return fmt.Errorf("mqtt: subscription to %q refused", filters[i])
+		}
+	}
+	return nil
+}
+
+// Unsubscribe removes subscriptions
+func (c *Client) Unsubscribe(filters ...string) error {
+	_, err := c.request(func(id uint16) Packet {
+		return &Unsubscribe{PacketID: id, Filters: filters}
+	})
+	return err
+}
+
+// Publish sends a QoS 0 message: fire and forget, no acknowledgement
+func (c *Client) Publish(topic string, payload []byte, retain bool) error {
+	return c.send(&Publish{Topic: topic, Payload: payload, Retain: retain})
+}
+
+// Close sends DISCONNECT, which tells the broker this was a clean
+// goodbye, and closes the connection
+func (c *Client) Close() error {
+	err := c.send(&Disconnect{})
+	c.shutdown(nil)
+	return err
+}
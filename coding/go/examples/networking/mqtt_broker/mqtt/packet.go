@@ -0,0 +1,391 @@
+// Package mqtt implements the subset of MQTT 3.1.1 that the broker,
+// pub and sub programs need: QoS 0 publish/subscribe, retained
+// messages and keepalive pings.
+//
+// The wire format is real MQTT, so mosquitto_pub and mosquitto_sub
+// work against the broker too:
+//   mosquitto_sub -p 1883 -t 'sensors/#' -v
+//   mosquitto_pub -p 1883 -t sensors/kitchen/temp -m 21.5 -r
+//
+// Every packet starts with a fixed header:
+//   +-----------------+-----------------+----------------------+
+//   | type:4 | flags:4| remaining length (1-4 bytes, varint)   |
+//   +-----------------+-----------------+----------------------+
+// followed by "remaining length" bytes of variable header and
+// payload. Strings are a 2-byte big-endian length and UTF-8 bytes.
+package mqtt
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Packet types (the high nibble of the first byte)
+const (
+	CONNECT     byte = 1
+	CONNACK     byte = 2
+	PUBLISH     byte = 3
+	PUBACK      byte = 4
+	SUBSCRIBE   byte = 8
+	SUBACK      byte = 9
+	UNSUBSCRIBE byte = 10
+	UNSUBACK    byte = 11
+	PINGREQ     byte = 12
+	PINGRESP    byte = 13
+	DISCONNECT  byte = 14
+)
+
+// CONNACK return codes
+const (
+	Accepted             byte = 0
+	RefusedProtocol      byte = 1
+	RefusedIdentifier    byte = 2
+	RefusedNotAuthorized byte = 5
+)
+
+// MaxPacketSize bounds what we accept, well below the 256MB the
+// varint can express
+const MaxPacketSize = 1 << 20
+
+var (
+	ErrMalformed = errors.New("mqtt: malformed packet")
+	ErrTooLarge  = errors.New("mqtt: packet too large")
+	// ErrProtocolLevel means a CONNECT for another MQTT version; the
+	// broker answers it with RefusedProtocol
+	ErrProtocolLevel = errors.New("mqtt: unsupported protocol level")
+)
+
+// Packet is one decoded control packet
+type Packet interface {
+	Encode() []byte
+}
+
+// Connect opens a session. Will messages and passwords are parsed
+// past but not used.
+type Connect struct {
+	ClientID     string
+	KeepAlive    uint16 // seconds; 0 disables
+	CleanSession bool
+	Username     string
+}
+
+// Connack answers Connect
+type Connack struct {
+	SessionPresent bool
+	ReturnCode     byte
+}
+
+// Publish carries an application message
+type Publish struct {
+	Topic    string
+	Payload  []byte
+	QoS      byte
+	Retain   bool
+	Dup      bool
+	PacketID uint16 // only for QoS > 0
+}
+
+// Puback acknowledges a QoS 1 Publish
+type Puback struct{ PacketID uint16 }
+
+// Subscription is one topic filter in a Subscribe
+type Subscription struct {
+	Filter string
+	QoS    byte
+}
+
+type Subscribe struct {
+	PacketID      uint16
+	Subscriptions []Subscription
+}
+
+// Suback has one return code per requested filter: the granted QoS,
+// or 0x80 for failure
+type Suback struct {
+	PacketID    uint16
+	ReturnCodes []byte
+}
+
+type Unsubscribe struct {
+	PacketID uint16
+	Filters  []string
+}
+
+type Unsuback struct{ PacketID uint16 }
+type Pingreq struct{}
+type Pingresp struct{}
+type Disconnect struct{}
+
+// ============================================================
+// Reading
+// ============================================================
+
+// ReadPacket reads and decodes one packet
+func ReadPacket(r *bufio.Reader) (Packet, error) {
+	first, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	length, err := readVarint(r)
+	if err != nil {
+		return nil, err
+	}
+	if length > MaxPacketSize {
+		return nil, ErrTooLarge
+	}
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	d := &decoder{buf: body}
+	typ, flags := first>>4, first&0x0F
+
+	var p Packet
+	switch typ {
+	case CONNECT:
+		p, err = decodeConnect(d)
+	case CONNACK:
+		flags := d.byte()
+		p = &Connack{SessionPresent: flags&1 == 1, ReturnCode: d.byte()}
+	case PUBLISH:
+		pub := &Publish{Dup: flags&0x08 != 0, QoS: flags >> 1 & 0x03, Retain: flags&0x01 != 0}
+		pub.Topic = d.string()
+		if pub.QoS > 0 {
+			pub.PacketID = d.uint16()
+		}
+		pub.Payload = d.rest()
+		if pub.QoS > 2 {
+			d.err = ErrMalformed
+		}
+		p = pub
+	case PUBACK:
+		p = &Puback{PacketID: d.uint16()}
+	case SUBSCRIBE:
+		sub := &Subscribe{PacketID: d.uint16()}
+		for d.err == nil && d.more() {
+			sub.Subscriptions = append(sub.Subscriptions, Subscription{Filter: d.string(), QoS: d.byte()})
+		}
+		if len(sub.Subscriptions) == 0 {
+			d.err = ErrMalformed // at least one filter is required
+		}
+		p = sub
+	case SUBACK:
+		p = &Suback{PacketID: d.uint16(), ReturnCodes: d.rest()}
+	case UNSUBSCRIBE:
+		unsub := &Unsubscribe{PacketID: d.uint16()}
+		for d.err == nil && d.more() {
+			unsub.Filters = append(unsub.Filters, d.string())
+		}
+		p = unsub
+	case UNSUBACK:
+		p = &Unsuback{PacketID: d.uint16()}
+	case PINGREQ:
+		p = &Pingreq{}
+	case PINGRESP:
+		p = &Pingresp{}
+	case DISCONNECT:
+		p = &Disconnect{}
+	default:
+		return nil, fmt.Errorf("%w: unsupported packet type %d", ErrMalformed, typ)
+	}
+	if err == nil {
+		err = d.err
+	}
+	if err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// readVarint decodes the remaining length: 7 bits per byte, low
+// bits first, high bit set on every byte but the last
+func readVarint(r io.ByteReader) (int, error) {
+	value, shift := 0, 0
+	for i := 0; i < 4; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		value |= int(b&0x7F) << shift
+		if b&0x80 == 0 {
+			return value, nil
+		}
+		shift += 7
+	}
+	return 0, fmt.Errorf("%w: remaining length over 4 bytes", ErrMalformed)
+}
+
+func decodeConnect(d *decoder) (*Connect, error) {
+	if proto := d.string(); proto != "MQTT" && d.err == nil {
+		return nil, fmt.Errorf("%w: protocol %q", ErrMalformed, proto)
+	}
+	if level := d.byte(); level != 4 && d.err == nil {
+		return nil, fmt.Errorf("%w %d", ErrProtocolLevel, level)
+	}
+	flags := d.byte()
+	c := &Connect{KeepAlive: d.uint16(), CleanSession: flags&0x02 != 0}
+	c.ClientID = d.string()
+	if flags&0x04 != 0 { // will flag: topic and message follow
+		d.string()
+		d.string()
+	}
+	if flags&0x80 != 0 {
+		c.Username = d.string()
+	}
+	if flags&0x40 != 0 {
+		d.string() // password
+	}
+	return c, d.err
+}
+
+// decoder reads fields from a packet body, remembering the first
+// error so callers can check once at the end
+type decoder struct {
+	buf []byte
+	err error
+}
+
+func (d *decoder) more() bool { return len(d.buf) > 0 }
+
+func (d *decoder) take(n int) []byte {
+	if d.err != nil {
+		return nil
+	}
+	if len(d.buf) < n {
+		d.err = ErrMalformed
+		return nil
+	}
+	b := d.buf[:n]
+	d.buf = d.buf[n:]
+	return b
+}
+
+func (d *decoder) byte() byte {
+	if b := d.take(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (d *decoder) uint16() uint16 {
+	if b := d.take(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (d *decoder) string() string {
+	return string(d.take(int(d.uint16())))
+}
+
+func (d *decoder) rest() []byte {
+	b := d.buf
+	d.buf = nil
+	return b
+}
+
+// ============================================================
+// Writing
+// ============================================================
+
+// packet assembles the fixed header in front of body
+func packet(typ, flags byte, body []byte) []byte {
+	out := []byte{typ<<4 | flags}
+	n := len(body)
+	for {
+		b := byte(n & 0x7F)
+		n >>= 7
+		if n > 0 {
+			b |= 0x80
+		}
+		out = append(out, b)
+		if n == 0 {
+			break
+		}
+	}
+	return append(out, body...)
+}
+
+func appendString(b []byte, s string) []byte {
+	b = binary.BigEndian.AppendUint16(b, uint16(len(s)))
+	return append(b, s...)
+}
+
+func (c *Connect) Encode() []byte {
+	flags := byte(0)
+	if c.CleanSession {
+		flags |= 0x02
+	}
+	if c.Username != "" {
+		flags |= 0x80
+	}
+	b := appendString(nil, "MQTT")
+	b = append(b, 4, flags)
+	b = binary.BigEndian.AppendUint16(b, c.KeepAlive)
+	b = appendString(b, c.ClientID)
+	if c.Username != "" {
+		b = appendString(b, c.Username)
+	}
+	return packet(CONNECT, 0, b)
+}
+
+func (c *Connack) Encode() []byte {
+	sp := byte(0)
+	if c.SessionPresent {
+		sp = 1
+	}
+	return packet(CONNACK, 0, []byte{sp, c.ReturnCode})
+}
+
+func (p *Publish) Encode() []byte {
+	flags := p.QoS << 1
+	if p.Retain {
+		flags |= 0x01
+	}
+	if p.Dup {
+		flags |= 0x08
+	}
+	b := appendString(nil, p.Topic)
+	if p.QoS > 0 {
+		b = binary.BigEndian.AppendUint16(b, p.PacketID)
+	}
+	return packet(PUBLISH, flags, append(b, p.Payload...))
+}
+
+func (p *Puback) Encode() []byte {
+	return packet(PUBACK, 0, binary.BigEndian.AppendUint16(nil, p.PacketID))
+}
+
+func (s *Subscribe) Encode() []byte {
+	b := binary.BigEndian.AppendUint16(nil, s.PacketID)
+	for _, sub := range s.Subscriptions {
+		b = appendString(b, sub.Filter)
+		b = append(b, sub.QoS)
+	}
+	// The spec requires these flag bits on SUBSCRIBE and UNSUBSCRIBE
+	return packet(SUBSCRIBE, 0x02, b)
+}
+
+func (s *Suback) Encode() []byte {
+	b := binary.BigEndian.AppendUint16(nil, s.PacketID)
+	return packet(SUBACK, 0, append(b, s.ReturnCodes...))
+}
+
+func (u *Unsubscribe) Encode() []byte {
+	b := binary.BigEndian.AppendUint16(nil, u.PacketID)
+	for _, f := range u.Filters {
+		b = appendString(b, f)
+	}
+	return packet(UNSUBSCRIBE, 0x02, b)
+}
+
+func (u *Unsuback) Encode() []byte {
+	return packet(UNSUBACK, 0, binary.BigEndian.AppendUint16(nil, u.PacketID))
+}
+
+func (*Pingreq) Encode() []byte    { return packet(PINGREQ, 0, nil) }
+func (*Pingresp) Encode() []byte   { return packet(PINGRESP, 0, nil) }
+func (*Disconnect) Encode() []byte { return packet(DISCONNECT, 0, nil) }
@@ -0,0 +1,54 @@
+package mqtt
+
+import "strings"
+
+// Topics are "/"-separated levels: sensors/kitchen/temp. Filters may
+// use two wildcards:
+//   +  matches exactly one level:     sensors/+/temp
+//   #  matches any number of levels, including none; it must be last:
+//      sensors/#  matches sensors, sensors/kitchen, sensors/kitchen/temp
+// Topics starting with "$" (like $SYS/...) are reserved for the
+// broker and are not matched by a filter starting with a wildcard.
+
+// ValidTopic reports whether topic can be published to
+func ValidTopic(topic string) bool {
+	return topic != "" && !strings.ContainsAny(topic, "+#\x00")
+}
+
+// ValidFilter reports whether filter can be subscribed to
+func ValidFilter(filter string) bool {
+	if filter == "" || strings.ContainsRune(filter, 0) {
+		return false
+	}
+	levels := strings.Split(filter, "/")
+	for i, level := range levels {
+		switch {
+		case level == "#" && i != len(levels)-1:
+			return false // # only at the end
+		case level != "#" && level != "+" && strings.ContainsAny(level, "+#"):
+			return false // a wildcard must be a whole level: "sensor+" is invalid
+		}
+	}
+	return true
+}
+
+// Match reports whether topic matches filter. Both are assumed valid.
+func Match(filter, topic string) bool {
+	if strings.HasPrefix(topic, "$") && (strings.HasPrefix(filter, "+") || strings.HasPrefix(filter, "#")) {
+		return false
+	}
+	f := strings.Split(filter, "/")
+	t := strings.Split(topic, "/")
+	for i, level := range f {
+		if level == "#" {
+			return true // matches the rest, even nothing ("a/#" matches "a")
+		}
+		if i == len(t) {
+			return false // filter is longer than topic
+		}
+		if level != "+" && level != t[i] {
+			return false
+		}
+	}
+	return len(f) == len(t)
+}
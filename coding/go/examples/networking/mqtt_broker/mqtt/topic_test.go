@@ -0,0 +1,94 @@
+package mqtt
+
+import (
+	"bufio"
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		filter, topic string
+		want          bool
+	}{
+		{"sensors/kitchen/temp", "sensors/kitchen/temp", true},
+		{"sensors/kitchen/temp", "sensors/kitchen", false},
+		{"sensors/+/temp", "sensors/kitchen/temp", true},
+		{"sensors/+/temp", "sensors/kitchen/humidity", false},
+		{"sensors/+", "sensors/kitchen/temp", false},
+		{"sensors/#", "sensors/kitchen/temp", true},
+		{"sensors/#", "sensors", true}, // # also matches the parent level
+		{"#", "anything/at/all", true},
+		{"+/+", "a/b", true},
+		{"+", "/finance", false}, // a leading "/" makes an empty first level
+		{"+/finance", "/finance", true},
+		{"#", "$SYS/broker/clients", false}, // wildcards don't match $ topics
+		{"$SYS/#", "$SYS/broker/clients", true},
+	}
+	for _, tt := range tests {
+		if got := Match(tt.filter, tt.topic); got != tt.want {
+			t.Errorf("Match(%q, %q) = %v, want %v", tt.filter, tt.topic, got, tt.want)
+		}
+	}
+}
+
+func TestValidFilter(t *testing.T) {
+	tests := []struct {
+		filter string
+		want   bool
+	}{
+		{"a/b", true},
+		{"a/+/c", true},
+		{"a/#", true},
+		{"#", true},
+		{"a/#/c", false},
+		{"a/b#", false},
+		{"a+/b", false},
+		{"", false},
+	}
+	for _, tt := range tests {
+		if got := ValidFilter(tt.filter); got != tt.want {
+			t.Errorf("ValidFilter(%q) = %v, want %v", tt.filter, got, tt.want)
+		}
+	}
+}
+
+func TestPacketRoundTrip(t *testing.T) {
+	packets := []Packet{
+		&Connect{ClientID: "sensor-1", KeepAlive: 30, CleanSession: true, Username: "alice"},
+		&Connack{ReturnCode: Accepted},
+		&Publish{Topic: "a/b", Payload: []byte("hello"), Retain: true},
+		&Publish{Topic: "a/b", Payload: bytes.Repeat([]byte("x"), 300), QoS: 1, PacketID: 7}, // 2-byte length
+		&Subscribe{PacketID: 1, Subscriptions: []Subscription{{"a/#", 0}, {"b/+", 0}}},
+		&Suback{PacketID: 1, ReturnCodes: []byte{0, 0x80}},
+		&Unsubscribe{PacketID: 2, Filters: []string{"a/#"}},
+		&Unsuback{PacketID: 2},
+		&Pingreq{},
+		&Pingresp{},
+		&Disconnect{},
+	}
+	for _, p := range packets {
+		got, err := ReadPacket(bufio.NewReader(bytes.NewReader(p.Encode())))
+		if err != nil {
+			t.Errorf("%T: %v", p, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, p) {
+			t.Errorf("round trip: got %+v, want %+v", got, p)
+		}
+	}
+}
+
+func TestReadPacketMalformed(t *testing.T) {
+	tests := map[string][]byte{
+		"truncated string":    {PUBLISH << 4, 3, 0, 5, 'a'},
+		"varint too long":     {PUBLISH << 4, 0xFF, 0xFF, 0xFF, 0xFF, 0x01},
+		"subscribe, no topic": {SUBSCRIBE<<4 | 2, 2, 0, 1},
+	}
+	for name, data := range tests {
+		if _, err := ReadPacket(bufio.NewReader(bytes.NewReader(data))); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+// MQTT Publisher - Send one message or a stream of them
+//
+// Publishes at QoS 0 (fire and forget). With -n it keeps the
+// connection open and publishes repeatedly, substituting the counter
+// for {n} in the message - handy for watching several subscribers.
+//
+// Usage (from the mqtt_broker directory):
+//   go run ./pub -t sensors/kitchen/temp -m 21.5 -r       # retained
+//   go run ./pub -t sensors/kitchen/temp -m '' -r         # clear the retained value
+//   go run ./pub -t sensors/hall/motion -m 'event {n}' -n 10 -i 500ms
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bellistech/labs/coding/go/examples/networking/mqtt_broker/mqtt"
+)
+
+func main() {
+	addr := flag.String("addr", "localhost:1883", "broker address")
+	id := flag.String("id", fmt.Sprintf("pub-%d", os.Getpid()), "client ID")
+	topic := flag.String("t", "", "topic")
+	message := flag.String("m", "", "message; {n} is replaced by the counter")
+	retain := flag.Bool("r", false, "retain: the broker keeps it for future subscribers")
+	count := flag.Int("n", 1, "number of messages")
+	interval := flag.Duration("i", time.Second, "interval between messages")
+	flag.Parse()
+	if !mqtt.ValidTopic(*topic) {
+		log.Fatalf("invalid topic %q (wildcards are for subscribing)", *topic)
+	}
+
+	c, err := mqtt.Dial(*addr, *id, 30*time.Second)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer c.Close()
+
+	for i := 1; i <= *count; i++ {
+		if i > 1 {
+			time.Sleep(*interval)
+		}
+		payload := strings.ReplaceAll(*message, "{n}", strconv.Itoa(i))
+		if err := c.Publish(*topic, []byte(payload), *retain); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("published %q to %s", payload, *topic)
+	}
+	// QoS 0 has no ack, so there is no way to know the broker got it;
+	// Close sends DISCONNECT after it on the same connection, and TCP
+	// keeps the order
+}
@@ -0,0 +1,70 @@
+// MQTT Subscriber - Print messages matching topic filters
+//
+// Connects, subscribes, and prints every message until interrupted.
+// Retained messages arrive first, straight after SUBACK; they show
+// the last known value of each topic before any new publish.
+//
+// Usage (from the mqtt_broker directory):
+//   go run ./sub -t 'sensors/#'
+//   go run ./sub -t 'sensors/+/temp' -t 'alerts/#' -k 5
+//
+// Stop the broker while this runs to see keepalive notice the silence.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/bellistech/labs/coding/go/examples/networking/mqtt_broker/mqtt"
+)
+
+// filterList collects repeated -t flags
+type filterList []string
+
+func (f *filterList) String() string     { return strings.Join(*f, ",") }
+func (f *filterList) Set(v string) error { *f = append(*f, v); return nil }
+
+func main() {
+	var filters filterList
+	addr := flag.String("addr", "localhost:1883", "broker address")
+	id := flag.String("id", fmt.Sprintf("sub-%d", os.Getpid()), "client ID")
+	keepAlive := flag.Duration("k", 30*time.Second, "keepalive interval")
+	flag.Var(&filters, "t", "topic filter (repeatable)")
+	flag.Parse()
+	if len(filters) == 0 {
+		filters = filterList{"#"}
+	}
+
+	c, err := mqtt.Dial(*addr, *id, *keepAlive)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := c.Subscribe(filters...); err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("subscribed to %s as %s", filters.String(), *id)
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt)
+	for {
+		select {
+		case msg, ok := <-c.Messages:
+			if !ok {
+				log.Fatalf("connection lost: %v", c.Err())
+			}
+			retained := ""
+			if msg.Retain {
+				retained = " (retained)"
+			}
+			fmt.Printf("%s %s %s%s\n", time.Now().Format("15:04:05.000"), msg.Topic, msg.Payload, retained)
+		case <-sig:
+			c.Close()
+			return
+		}
+	}
+}
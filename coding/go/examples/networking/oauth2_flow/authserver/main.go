@@ -0,0 +1,463 @@
+// OAuth2 Authorization Server - Codes, tokens and refresh
+//
+// The server half of the authorization-code flow (RFC 6749) with PKCE
+// (RFC 7636), small enough to read in one sitting:
+// - /authorize shows a login and consent page, then redirects back to
+//   the client with a one-time code. The redirect URI must match a
+//   registered one exactly, or the code could be sent to an attacker
+// - /token swaps the code for tokens. The client proves it is the
+//   one that started the flow by sending the PKCE code_verifier whose
+//   SHA-256 it sent earlier, so a stolen code is useless on its own
+// - Codes live for a minute and work once; replaying one revokes the
+//   tokens it already produced
+// - Refresh tokens rotate: each use returns a new one. Using an old
+//   one again means it was copied, so the whole family is revoked
+// - /userinfo is a protected resource that accepts the access token
+//
+// Tokens are opaque random strings looked up in memory, unlike a
+// self-contained JWT: they can be revoked at once, at the price of a
+// lookup on every request.
+//
+// Usage (from the oauth2_flow directory):
+//   go run ./authserver
+//   go run ./clientapp          # then open http://localhost:8080
+//
+// Users: alice / wonderland, bob / builder
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ============================================================
+// Registered clients and users
+// ============================================================
+
+type Client struct {
+	ID           string
+	Secret       string
+	Name         string
+	RedirectURIs []string
+	Scopes       []string // what it may ask for
+}
+
+var clients = map[string]*Client{
+	"demo-app": {
+		ID:           "demo-app",
+		Secret:       "demo-secret",
+		Name:         "Demo App",
+		RedirectURIs: []string{"http://localhost:8080/callback"},
+		Scopes:       []string{"profile", "email"},
+	},
+}
+
+type User struct {
+	ID, Name, Email, Password string
+}
+
+// Plaintext passwords keep the demo short; store bcrypt or argon2
+// hashes in anything real
+var users = map[string]*User{
+	"alice": {ID: "u-1001", Name: "Alice Liddell", Email: "alice@example.com", Password: "wonderland"},
+	"bob":   {ID: "u-1002", Name: "Bob Builder", Email: "bob@example.com", Password: "builder"},
+}
+
+// ============================================================
+// Grants and tokens
+// ============================================================
+
+// authCode is what a code stands for until it is exchanged
+type authCode struct {
+	clientID     string
+	redirectURI  string
+	userID       string
+	scope        string
+	challenge    string
+	expires      time.Time
+	used         bool
+	issuedFamily string // refresh-token family created by the exchange
+}
+
+type accessToken struct {
+	clientID, userID, scope string
+	family                  string
+	expires                 time.Time
+}
+
+type refreshToken struct {
+	clientID, userID, scope string
+	family                  string
+	used                    bool // rotated away: seeing it again is an alarm
+}
+
+type Server struct {
+	accessTTL time.Duration
+
+	mu       sync.Mutex
+	codes    map[string]*authCode
+	access   map[string]*accessToken
+	refresh  map[string]*refreshToken
+	families map[string]bool // live refresh-token families
+}
+
+func NewServer(accessTTL time.Duration) *Server {
+	return &Server{
+		accessTTL: accessTTL,
+		codes:     map[string]*authCode{},
+		access:    map[string]*accessToken{},
+		refresh:   map[string]*refreshToken{},
+		families:  map[string]bool{},
+	}
+}
+
+func randomToken() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// issue creates an access and refresh token pair in family; s.mu held
+func (s *Server) issue(clientID, userID, scope, family string) map[string]any {
+	at, rt := randomToken(), randomToken()
+	s.access[at] = &accessToken{clientID: clientID, userID: userID, scope: scope, family: family, expires: time.Now().Add(s.accessTTL)}
+	s.refresh[rt] = &refreshToken{clientID: clientID, userID: userID, scope: scope, family: family}
+	s.families[family] = true
+	return map[string]any{
+		"access_token":  at,
+		"token_type":    "Bearer",
+		"expires_in":    int(s.accessTTL.Seconds()),
+		"refresh_token": rt,
+		"scope":         scope,
+	}
+}
+
+// revokeFamily kills every token descended from one code; s.mu held
+func (s *Server) revokeFamily(family string) {
+	delete(s.families, family)
+	for k, t := range s.access {
+		if t.family == family {
+			delete(s.access, k)
+		}
+	}
+	for k, t := range s.refresh {
+		if t.family == family {
+			delete(s.refresh, k)
+		}
+	}
+}
+
+// ============================================================
+// /authorize
+// ============================================================
+
+var consentPage = template.Must(template.New("consent").Parse(`<!doctype html>
+<meta charset="utf-8">
+<title>Sign in</title>
+<style>body{font-family:sans-serif;max-width:28em;margin:3em auto}input{display:block;margin:.4em 0}</style>
+<h2>Sign in to continue to {{.Client.Name}}</h2>
+{{with .Error}}<p style="color:#b00">{{.}}</p>{{end}}
+<p>{{.Client.Name}} is asking for: <b>{{.Scope}}</b></p>
+<form method="post" action="/authorize">
+  {{range $k, $v := .Params}}<input type="hidden" name="{{$k}}" value="{{$v}}">
+  {{end}}<input name="username" placeholder="username (alice or bob)" autofocus>
+  <input name="password" type="password" placeholder="password">
+  <button name="decision" value="allow">Allow</button>
+  <button name="decision" value="deny">Deny</button>
+</form>
+`))
+
+// authorizeParams are the request parameters carried from the GET
+// through the login form to the POST
+var authorizeParams = []string{"response_type", "client_id", "redirect_uri", "scope", "state", "code_challenge", "code_challenge_method"}
+
+func (s *Server) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "bad request", http.StatusBadRequest)
+		return
+	}
+	q := r.Form
+
+	// Until client and redirect URI check out, errors are shown here:
+	// redirecting to an unverified URI would make this an open
+	// redirector
+	client := clients[q.Get("client_id")]
+	if client == nil {
+		http.Error(w, "unknown client_id", http.StatusBadRequest)
+		return
+	}
+	redirectURI := q.Get("redirect_uri")
+	if !slices.Contains(client.RedirectURIs, redirectURI) {
+		http.Error(w, "redirect_uri is not registered for this client", http.StatusBadRequest)
+		return
+	}
+
+	// From here on, errors go back to the client app
+	fail := func(code, desc string) {
+		u, _ := url.Parse(redirectURI)
+		v := u.Query()
+		v.Set("error", code)
+		v.Set("error_description", desc)
+		if st := q.Get("state"); st != "" {
+			v.Set("state", st)
+		}
+		u.RawQuery = v.Encode()
+		http.Redirect(w, r, u.String(), http.StatusFound)
+	}
+	if q.Get("response_type") != "code" {
+		fail("unsupported_response_type", "only the code flow is supported")
+		return
+	}
+	// PKCE is required, and only S256: "plain" would send the
+	// verifier itself through the browser
+	if q.Get("code_challenge_method") != "S256" || len(q.Get("code_challenge")) != 43 {
+		fail("invalid_request", "PKCE with code_challenge_method=S256 is required")
+		return
+	}
+	scope := q.Get("scope")
+	for sc := range strings.FieldsSeq(scope) {
+		if !slices.Contains(client.Scopes, sc) {
+			fail("invalid_scope", "scope "+sc+" is not allowed")
+			return
+		}
+	}
+
+	params := map[string]string{}
+	for _, k := range authorizeParams {
+		params[k] = q.Get(k)
+	}
+	show := func(errMsg string) {
+		// The consent page must not be framed by another site, or a
+		// click on "Allow" could be hijacked
+		w.Header().Set("X-Frame-Options", "DENY")
+		w.Header().Set("Cache-Control", "no-store")
+		consentPage.Execute(w, map[string]any{"Client": client, "Scope": scope, "Params": params, "Error": errMsg})
+	}
+	if r.Method == http.MethodGet {
+		show("")
+		return
+	}
+
+	if q.Get("decision") != "allow" {
+		fail("access_denied", "the user said no")
+		return
+	}
+	user := users[q.Get("username")]
+	if user == nil || subtle.ConstantTimeCompare([]byte(user.Password), []byte(q.Get("password"))) != 1 {
+		show("Wrong username or password.")
+		return
+	}
+
+	code := randomToken()
+	s.mu.Lock()
+	s.codes[code] = &authCode{
+		clientID:    client.ID,
+		redirectURI: redirectURI,
+		userID:      q.Get("username"),
+		scope:       scope,
+		challenge:   q.Get("code_challenge"),
+		expires:     time.Now().Add(time.Minute),
+	}
+	s.mu.Unlock()
+	log.Printf("authorize: %s approved %s for %q, code issued", q.Get("username"), client.ID, scope)
+
+	u, _ := url.Parse(redirectURI)
+	v := u.Query()
+	v.Set("code", code)
+	v.Set("state", q.Get("state")) // echoed untouched; the client checks it
+	u.RawQuery = v.Encode()
+	http.Redirect(w, r, u.String(), http.StatusFound)
+}
+
+// ============================================================
+// /token
+// ============================================================
+
+// tokenError writes an RFC 6749 section 5.2 error
+func tokenError(w http.ResponseWriter, status int, code, desc string) {
+	if status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Basic realm="token"`)
+	}
+	writeJSON(w, status, map[string]string{"error": code, "error_description": desc})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store") // tokens must never be cached
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// authenticateClient accepts client_secret_basic or client_secret_post
+func authenticateClient(r *http.Request) *Client {
+	id, secret, ok := r.BasicAuth()
+	if ok {
+		// Basic credentials are form-encoded before base64
+		id, _ = url.QueryUnescape(id)
+		secret, _ = url.QueryUnescape(secret)
+	} else {
+		id, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	c := clients[id]
+	if c == nil || subtle.ConstantTimeCompare([]byte(c.Secret), []byte(secret)) != 1 {
+		return nil
+	}
+	return c
+}
+
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		tokenError(w, http.StatusMethodNotAllowed, "invalid_request", "POST only")
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		tokenError(w, http.StatusBadRequest, "invalid_request", "malformed form")
+		return
+	}
+	client := authenticateClient(r)
+	if client == nil {
+		tokenError(w, http.StatusUnauthorized, "invalid_client", "client authentication failed")
+		return
+	}
+
+	switch r.PostForm.Get("grant_type") {
+	case "authorization_code":
+		s.exchangeCode(w, r, client)
+	case "refresh_token":
+		s.refreshGrant(w, r, client)
+	default:
+		tokenError(w, http.StatusBadRequest, "unsupported_grant_type", "")
+	}
+}
+
+func (s *Server) exchangeCode(w http.ResponseWriter, r *http.Request, client *Client) {
+	f := r.PostForm
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	code := s.codes[f.Get("code")]
+	switch {
+	case code == nil || code.clientID != client.ID:
+		tokenError(w, http.StatusBadRequest, "invalid_grant", "unknown code")
+		return
+	case code.used:
+		// A code that comes back was intercepted somewhere: whatever it
+		// already bought is now suspect too (RFC 6749 section 4.1.2)
+		s.revokeFamily(code.issuedFamily)
+		log.Printf("token: code replayed by %s; revoked the tokens it had issued", client.ID)
+		tokenError(w, http.StatusBadRequest, "invalid_grant", "code already used")
+		return
+	case time.Now().After(code.expires):
+		tokenError(w, http.StatusBadRequest, "invalid_grant", "code expired")
+		return
+	case f.Get("redirect_uri") != code.redirectURI:
+		tokenError(w, http.StatusBadRequest, "invalid_grant", "redirect_uri does not match the authorization request")
+		return
+	}
+
+	// PKCE: BASE64URL(SHA256(verifier)) must equal the challenge from
+	// /authorize. Only the app that made the verifier can know it.
+	sum := sha256.Sum256([]byte(f.Get("code_verifier")))
+	computed := base64.RawURLEncoding.EncodeToString(sum[:])
+	if subtle.ConstantTimeCompare([]byte(computed), []byte(code.challenge)) != 1 {
+		tokenError(w, http.StatusBadRequest, "invalid_grant", "code_verifier does not match code_challenge")
+		return
+	}
+
+	code.used = true
+	code.issuedFamily = randomToken()
+	log.Printf("token: exchanged code for %s / %s (PKCE verified)", client.ID, code.userID)
+	writeJSON(w, http.StatusOK, s.issue(client.ID, code.userID, code.scope, code.issuedFamily))
+}
+
+func (s *Server) refreshGrant(w http.ResponseWriter, r *http.Request, client *Client) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	rt := s.refresh[r.PostForm.Get("refresh_token")]
+	switch {
+	case rt == nil || rt.clientID != client.ID || !s.families[rt.family]:
+		tokenError(w, http.StatusBadRequest, "invalid_grant", "unknown or revoked refresh token")
+		return
+	case rt.used:
+		// Only one party should hold the latest token. If an old one
+		// shows up, two parties have copies: end the session for both.
+		s.revokeFamily(rt.family)
+		log.Printf("token: rotated-out refresh token reused for %s; family revoked", rt.userID)
+		tokenError(w, http.StatusBadRequest, "invalid_grant", "refresh token reuse detected")
+		return
+	}
+	rt.used = true
+	log.Printf("token: refreshed for %s / %s (old refresh token rotated out)", client.ID, rt.userID)
+	writeJSON(w, http.StatusOK, s.issue(client.ID, rt.userID, rt.scope, rt.family))
+}
+
+// ============================================================
+// Protected resource
+// ============================================================
+
+func (s *Server) handleUserinfo(w http.ResponseWriter, r *http.Request) {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	s.mu.Lock()
+	at := s.access[token]
+	s.mu.Unlock()
+	if !ok || at == nil || time.Now().After(at.expires) {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_token"})
+		return
+	}
+	u := users[at.userID]
+	info := map[string]any{"sub": u.ID, "name": u.Name, "scope": at.scope}
+	// The token only opens what the user agreed to
+	if slices.Contains(strings.Fields(at.scope), "email") {
+		info["email"] = u.Email
+	}
+	writeJSON(w, http.StatusOK, info)
+}
+
+// sweep drops expired codes and access tokens now and then
+func (s *Server) sweep() {
+	for range time.Tick(time.Minute) {
+		now := time.Now()
+		s.mu.Lock()
+		for k, c := range s.codes {
+			if now.After(c.expires.Add(10 * time.Minute)) { // kept a while to catch replays
+				delete(s.codes, k)
+			}
+		}
+		for k, t := range s.access {
+			if now.After(t.expires) {
+				delete(s.access, k)
+			}
+		}
+		s.mu.Unlock()
+	}
+}
+
+func main() {
+	addr := flag.String("addr", "localhost:9000", "listen address")
+	accessTTL := flag.Duration("access-ttl", 30*time.Second, "access token lifetime (short, to see refreshes)")
+	flag.Parse()
+
+	s := NewServer(*accessTTL)
+	go s.sweep()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/authorize", s.handleAuthorize)
+	mux.HandleFunc("/token", s.handleToken)
+	mux.HandleFunc("/userinfo", s.handleUserinfo)
+
+	log.Printf("authorization server on http://%s (access tokens last %v)", *addr, *accessTTL)
+	log.Fatal(http.ListenAndServe(*addr, mux))
+}
@@ -0,0 +1,398 @@
+// OAuth2 Client App - Authorization code flow with PKCE
+//
+// A web app that signs users in through the authorization server and
+// then calls its /userinfo API on their behalf:
+// - /login makes a random state and PKCE code_verifier, keeps them in
+//   the server-side session and sends the browser to /authorize with
+//   the state and SHA-256 of the verifier
+// - /callback checks the state against the session (so an attacker
+//   cannot splice their own code into the victim's session), then
+//   exchanges the code plus verifier for tokens over a back channel,
+//   authenticating with the client secret
+// - / shows the profile. The access token is refreshed a little before
+//   it expires, or when the API answers 401, and the refresh token
+//   rotates every time
+// - Tokens never reach the browser: it only holds a session cookie
+//
+// Usage (from the oauth2_flow directory):
+//   go run ./authserver
+//   go run ./clientapp          # then open http://localhost:8080
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ============================================================
+// Configuration
+// ============================================================
+
+type Config struct {
+	ClientID     string
+	ClientSecret string
+	RedirectURI  string
+	AuthURL      string
+	TokenURL     string
+	UserinfoURL  string
+	Scope        string
+}
+
+// ============================================================
+// Sessions
+// ============================================================
+
+// Session is everything the app remembers about one browser
+type Session struct {
+	mu sync.Mutex // held across token calls so refreshes do not race
+
+	// Pending login, cleared as soon as the callback arrives
+	State    string
+	Verifier string
+
+	// Tokens after login
+	AccessToken  string
+	RefreshToken string
+	Expiry       time.Time
+	Refreshes    int
+}
+
+type SessionStore struct {
+	mu       sync.Mutex
+	sessions map[string]*Session
+}
+
+const sessionCookie = "sid"
+
+func randomString(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// get returns the browser's session, creating one (and its cookie) if
+// needed
+func (st *SessionStore) get(w http.ResponseWriter, r *http.Request) *Session {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+	if c, err := r.Cookie(sessionCookie); err == nil {
+		if s, ok := st.sessions[c.Value]; ok {
+			return s
+		}
+	}
+	id := randomString(32)
+	s := &Session{}
+	st.sessions[id] = s
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    id,
+		Path:     "/",
+		HttpOnly: true, // scripts cannot read it
+		// Lax still sends the cookie on the top-level redirect back
+		// from the authorization server, which Strict would not
+		SameSite: http.SameSiteLaxMode,
+	})
+	return s
+}
+
+func (st *SessionStore) destroy(w http.ResponseWriter, r *http.Request) {
+	if c, err := r.Cookie(sessionCookie); err == nil {
+		st.mu.Lock()
+		delete(st.sessions, c.Value)
+		st.mu.Unlock()
+	}
+	http.SetCookie(w, &http.Cookie{Name: sessionCookie, Path: "/", MaxAge: -1})
+}
+
+// ============================================================
+// Token endpoint client
+// ============================================================
+
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token"`
+	Scope        string `json:"scope"`
+
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description"`
+}
+
+// errSessionRevoked means the server refused the refresh token: the
+// user has to sign in again
+var errSessionRevoked = errors.New("session revoked by authorization server")
+
+type App struct {
+	cfg      Config
+	sessions *SessionStore
+	http     *http.Client
+}
+
+func (a *App) tokenRequest(form url.Values) (*tokenResponse, error) {
+	req, err := http.NewRequest(http.MethodPost, a.cfg.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(a.cfg.ClientID), url.QueryEscape(a.cfg.ClientSecret))
+
+	resp, err := a.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var tr tokenResponse
+	if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(&tr); err != nil {
+		return nil, fmt.Errorf("token endpoint: %s: %w", resp.Status, err)
+	}
+	if tr.Error == "invalid_grant" {
+		return nil, fmt.Errorf("%w: %s", errSessionRevoked, tr.ErrorDescription)
+	}
+	if tr.Error != "" || resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token endpoint: %s: %s %s", resp.Status, tr.Error, tr.ErrorDescription)
+	}
+	if !strings.EqualFold(tr.TokenType, "Bearer") {
+		return nil, fmt.Errorf("token endpoint: unexpected token_type %q", tr.TokenType)
+	}
+	return &tr, nil
+}
+
+func (s *Session) store(tr *tokenResponse) {
+	s.AccessToken = tr.AccessToken
+	s.Expiry = time.Now().Add(time.Duration(tr.ExpiresIn) * time.Second)
+	if tr.RefreshToken != "" {
+		s.RefreshToken = tr.RefreshToken
+	}
+}
+
+func (a *App) refresh(s *Session) error {
+	tr, err := a.tokenRequest(url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {s.RefreshToken},
+	})
+	if err != nil {
+		return err
+	}
+	s.store(tr)
+	s.Refreshes++
+	log.Printf("refreshed access token (#%d), valid until %s", s.Refreshes, s.Expiry.Format(time.TimeOnly))
+	return nil
+}
+
+// fetchUserinfo calls the API, refreshing the token first if it is
+// about to expire and once more if the API still says 401 (it may have
+// been revoked early, or the clocks disagree)
+func (a *App) fetchUserinfo(s *Session) (map[string]any, error) {
+	if time.Until(s.Expiry) < 5*time.Second {
+		if err := a.refresh(s); err != nil {
+			return nil, err
+		}
+	}
+	for attempt := 0; ; attempt++ {
+		req, _ := http.NewRequest(http.MethodGet, a.cfg.UserinfoURL, nil)
+		req.Header.Set("Authorization", "Bearer "+s.AccessToken)
+		resp, err := a.http.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode == http.StatusUnauthorized && attempt == 0 {
+			resp.Body.Close()
+			if err := a.refresh(s); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			return nil, fmt.Errorf("userinfo: %s", resp.Status)
+		}
+		var info map[string]any
+		return info, json.NewDecoder(resp.Body).Decode(&info)
+	}
+}
+
+// ============================================================
+// Handlers
+// ============================================================
+
+var homePage = template.Must(template.New("home").Parse(`<!doctype html>
+<meta charset="utf-8">
+<title>Demo App</title>
+<style>body{font-family:sans-serif;max-width:36em;margin:3em auto}code{font-size:.85em}form{display:inline}</style>
+<h2>Demo App</h2>
+{{with .Error}}<p style="color:#b00">{{.}}</p>{{end}}
+{{if .User}}
+  <p>Signed in as <b>{{.User.name}}</b>{{with .User.email}} &lt;{{.}}&gt;{{end}}</p>
+  <p>Subject <code>{{.User.sub}}</code>, scope <code>{{.User.scope}}</code></p>
+  <p>Access token <code>{{.Token}}…</code> expires in {{.ExpiresIn}}; refreshed {{.Refreshes}} time(s)</p>
+  <form method="post" action="/refresh"><button>Refresh now</button></form>
+  <form method="post" action="/logout"><button>Sign out</button></form>
+{{else}}
+  <p>You are not signed in.</p>
+  <a href="/login">Sign in with the authorization server</a>
+{{end}}
+`))
+
+func (a *App) handleHome(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+	s := a.sessions.get(w, r)
+	data := map[string]any{"Error": r.URL.Query().Get("error")}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.RefreshToken != "" {
+		info, err := a.fetchUserinfo(s)
+		switch {
+		case errors.Is(err, errSessionRevoked):
+			s.AccessToken, s.RefreshToken = "", ""
+			data["Error"] = "Your session was revoked, please sign in again."
+		case err != nil:
+			data["Error"] = err.Error()
+		default:
+			data["User"] = info
+			data["Token"] = s.AccessToken[:8]
+			data["ExpiresIn"] = time.Until(s.Expiry).Round(time.Second)
+			data["Refreshes"] = s.Refreshes
+		}
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	homePage.Execute(w, data)
+}
+
+func (a *App) handleLogin(w http.ResponseWriter, r *http.Request) {
+	s := a.sessions.get(w, r)
+
+	// The verifier stays here; only its hash travels through the
+	// browser. 32 random bytes give a 43-character verifier, the RFC
+	// 7636 minimum.
+	verifier := randomString(32)
+	sum := sha256.Sum256([]byte(verifier))
+	state := randomString(16)
+	s.mu.Lock()
+	s.State, s.Verifier = state, verifier
+	s.mu.Unlock()
+
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {a.cfg.ClientID},
+		"redirect_uri":          {a.cfg.RedirectURI},
+		"scope":                 {a.cfg.Scope},
+		"state":                 {state},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(sum[:])},
+		"code_challenge_method": {"S256"},
+	}
+	http.Redirect(w, r, a.cfg.AuthURL+"?"+q.Encode(), http.StatusFound)
+}
+
+func (a *App) handleCallback(w http.ResponseWriter, r *http.Request) {
+	s := a.sessions.get(w, r)
+	q := r.URL.Query()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	state, verifier := s.State, s.Verifier
+	// A state is good for one callback only
+	s.State, s.Verifier = "", ""
+
+	if state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(q.Get("state"))) != 1 {
+		log.Printf("callback: state mismatch, ignoring code")
+		http.Error(w, "invalid state: this login was not started here", http.StatusBadRequest)
+		return
+	}
+	if e := q.Get("error"); e != "" {
+		http.Redirect(w, r, "/?error="+url.QueryEscape(e+": "+q.Get("error_description")), http.StatusFound)
+		return
+	}
+
+	tr, err := a.tokenRequest(url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {q.Get("code")},
+		"redirect_uri":  {a.cfg.RedirectURI},
+		"code_verifier": {verifier},
+	})
+	if err != nil {
+		log.Printf("callback: %v", err)
+		http.Redirect(w, r, "/?error="+url.QueryEscape(err.Error()), http.StatusFound)
+		return
+	}
+	s.store(tr)
+	log.Printf("callback: signed in, scope %q, token valid until %s", tr.Scope, s.Expiry.Format(time.TimeOnly))
+	// Redirect so the code does not linger in the address bar or history
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+func (a *App) handleRefresh(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	s := a.sessions.get(w, r)
+	s.mu.Lock()
+	var err error
+	if s.RefreshToken != "" {
+		err = a.refresh(s)
+	}
+	s.mu.Unlock()
+	if err != nil {
+		http.Redirect(w, r, "/?error="+url.QueryEscape(err.Error()), http.StatusFound)
+		return
+	}
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+func (a *App) handleLogout(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	a.sessions.destroy(w, r)
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+func main() {
+	addr := flag.String("addr", "localhost:8080", "listen address")
+	issuer := flag.String("issuer", "http://localhost:9000", "authorization server base URL")
+	flag.Parse()
+
+	app := &App{
+		cfg: Config{
+			ClientID:     "demo-app",
+			ClientSecret: "demo-secret",
+			RedirectURI:  "http://" + *addr + "/callback",
+			AuthURL:      *issuer + "/authorize",
+			TokenURL:     *issuer + "/token",
+			UserinfoURL:  *issuer + "/userinfo",
+			Scope:        "profile email",
+		},
+		sessions: &SessionStore{sessions: map[string]*Session{}},
+		http:     &http.Client{Timeout: 10 * time.Second},
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", app.handleHome)
+	mux.HandleFunc("/login", app.handleLogin)
+	mux.HandleFunc("/callback", app.handleCallback)
+	mux.HandleFunc("/refresh", app.handleRefresh)
+	mux.HandleFunc("/logout", app.handleLogout)
+
+	log.Printf("client app on http://%s (authorization server %s)", *addr, *issuer)
+	log.Fatal(http.ListenAndServe(*addr, mux))
+}
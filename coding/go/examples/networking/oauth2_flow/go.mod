@@ -0,0 +1,3 @@
+module github.com/bellistech/labs/coding/go/examples/networking/oauth2_flow
+
+go 1.24
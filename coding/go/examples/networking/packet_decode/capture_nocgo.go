@@ -0,0 +1,74 @@
+//go:build !cgo
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+)
+
+// Without cgo there is no libpcap: no live capture, and BPF filters
+// fall back to a tiny subset matched on decoded layers
+
+func openLive(iface, filter string) (gopacket.PacketDataSource, layers.LinkType, error) {
+	return nil, 0, errors.New("live capture needs libpcap: build with CGO_ENABLED=1")
+}
+
+// compileFilter understands terms joined by "and": tcp, udp, icmp,
+// port N, host ADDR
+func compileFilter(link layers.LinkType, snaplen int, expr string) (func(gopacket.CaptureInfo, []byte) bool, error) {
+	var terms []func(gopacket.Packet) bool
+	words := strings.Fields(expr)
+	for i := 0; i < len(words); i++ {
+		switch w := words[i]; w {
+		case "and":
+		case "tcp", "udp", "icmp":
+			lt := map[string]gopacket.LayerType{
+				"tcp": layers.LayerTypeTCP, "udp": layers.LayerTypeUDP, "icmp": layers.LayerTypeICMPv4,
+			}[w]
+			terms = append(terms, func(p gopacket.Packet) bool { return p.Layer(lt) != nil })
+		case "port", "host":
+			if i+1 == len(words) {
+				return nil, fmt.Errorf("filter: %s needs a value", w)
+			}
+			i++
+			arg := words[i]
+			if w == "port" {
+				if _, err := strconv.ParseUint(arg, 10, 16); err != nil {
+					return nil, fmt.Errorf("filter: bad port %q", arg)
+				}
+				terms = append(terms, func(p gopacket.Packet) bool {
+					t := p.TransportLayer()
+					return t != nil && slices.Contains([]string{t.TransportFlow().Src().String(), t.TransportFlow().Dst().String()}, arg)
+				})
+			} else {
+				ip := net.ParseIP(arg)
+				if ip == nil {
+					return nil, fmt.Errorf("filter: bad host %q", arg)
+				}
+				terms = append(terms, func(p gopacket.Packet) bool {
+					n := p.NetworkLayer()
+					return n != nil && (ip.Equal(net.IP(n.NetworkFlow().Src().Raw())) || ip.Equal(net.IP(n.NetworkFlow().Dst().Raw())))
+				})
+			}
+		default:
+			return nil, fmt.Errorf("filter: %q needs libpcap (build with CGO_ENABLED=1)", w)
+		}
+	}
+	return func(ci gopacket.CaptureInfo, data []byte) bool {
+		p := gopacket.NewPacket(data, link, gopacket.DecodeOptions{Lazy: true, NoCopy: true})
+		for _, t := range terms {
+			if !t(p) {
+				return false
+			}
+		}
+		return true
+	}, nil
+}
@@ -0,0 +1,35 @@
+//go:build cgo
+
+package main
+
+import (
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcap"
+)
+
+// openLive starts a capture on iface. Snaplen 65535 keeps whole
+// packets; promiscuous mode also shows traffic not addressed to us
+func openLive(iface, filter string) (gopacket.PacketDataSource, layers.LinkType, error) {
+	h, err := pcap.OpenLive(iface, 65535, true, pcap.BlockForever)
+	if err != nil {
+		return nil, 0, err
+	}
+	if filter != "" {
+		if err := h.SetBPFFilter(filter); err != nil {
+			h.Close()
+			return nil, 0, err
+		}
+	}
+	return h, h.LinkType(), nil
+}
+
+// compileFilter compiles a BPF expression with libpcap and runs it on
+// each packet in user space, the way tcpdump -r does
+func compileFilter(link layers.LinkType, snaplen int, expr string) (func(gopacket.CaptureInfo, []byte) bool, error) {
+	bpf, err := pcap.NewBPF(link, snaplen, expr)
+	if err != nil {
+		return nil, err
+	}
+	return bpf.Matches, nil
+}
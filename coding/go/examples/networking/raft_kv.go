@@ -0,0 +1,1002 @@
+// Raft KV - A toy replicated key-value store
+//
+// A cluster of nodes that agree on one ordered log of writes using a
+// simplified Raft, talking net/rpc over TCP:
+// - Leader election: a follower that hears nothing from a leader for
+//   a randomized timeout becomes a candidate and asks for votes; a
+//   majority makes it leader for that term
+// - Log replication: clients write to the leader, which appends to
+//   its log and sends the entries to every follower; once a majority
+//   has an entry it is committed and applied to each node's map
+// - Safety: a node only votes for candidates whose log is at least as
+//   up to date as its own, and a leader only counts replicas for
+//   entries from its own term - so a committed write is never lost
+// - Reads from followers are allowed and may be stale
+// - Partitions: any node can be told to drop traffic to and from
+//   chosen peers; a minority side keeps its old leader but can't
+//   commit anything, and rejoins cleanly when healed
+//
+// Simplified: no persistence (a restarted node rejoins empty and is
+// caught up by the leader, which real Raft forbids since it forgets
+// its vote), no snapshots, no membership changes, and no pre-vote - a
+// node cut off on its own keeps raising its term, and forces a new
+// election when it comes back.
+//
+// Usage:
+//   go run raft_kv.go                     # 5 nodes in one process, with a partition
+//
+//   # or one process per node:
+//   C=127.0.0.1:7001,127.0.0.1:7002,127.0.0.1:7003
+//   go run raft_kv.go node -cluster $C -id 1    # and -id 2, -id 3
+//   go run raft_kv.go put -cluster $C color blue
+//   go run raft_kv.go get -cluster $C -id 3 color
+//   go run raft_kv.go status -cluster $C
+//   go run raft_kv.go partition -cluster $C -id 1 -block 2,3   # -block "" heals
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand/v2"
+	"net"
+	"net/rpc"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	heartbeatInterval = 75 * time.Millisecond
+	electionTimeout   = 300 * time.Millisecond // randomized up to 2x
+	rpcTimeout        = 150 * time.Millisecond
+	commitTimeout     = 2 * time.Second
+)
+
+// ============================================================
+// Log and RPC messages
+// ============================================================
+
+type Command struct {
+	Op    string // "put", "delete", or "noop" (a new leader's first entry)
+	Key   string
+	Value string
+}
+
+type Entry struct {
+	Term int
+	Cmd  Command
+}
+
+type RequestVoteArgs struct {
+	Term         int
+	CandidateID  int
+	LastLogIndex int
+	LastLogTerm  int
+}
+
+type RequestVoteReply struct {
+	Term        int
+	VoteGranted bool
+}
+
+type AppendEntriesArgs struct {
+	Term         int
+	LeaderID     int
+	PrevLogIndex int // the entry just before Entries...
+	PrevLogTerm  int // ...and its term, which the follower must have
+	Entries      []Entry
+	LeaderCommit int
+}
+
+type AppendEntriesReply struct {
+	Term    int
+	Success bool
+	// ConflictIndex is where the leader should retry from after a
+	// mismatch: the start of the follower's conflicting term, or the
+	// end of its log. Saves backing up one entry per round trip.
+	ConflictIndex int
+}
+
+type PutArgs struct {
+	Key, Value string
+	Delete     bool
+}
+
+type PutReply struct {
+	NotLeader bool
+	Leader    int // a hint when NotLeader; 0 if unknown
+	Index     int // log index the write committed at
+}
+
+type GetArgs struct{ Key string }
+
+type GetReply struct {
+	Value string
+	Found bool
+	Status
+}
+
+type Status struct {
+	ID          int
+	Role        string
+	Term        int
+	Leader      int
+	LogLength   int
+	CommitIndex int
+	Blocked     []int
+	Data        map[string]string
+}
+
+type PartitionArgs struct{ Block []int }
+
+// ============================================================
+// Node
+// ============================================================
+
+type Role int
+
+const (
+	Follower Role = iota
+	Candidate
+	Leader
+)
+
+func (r Role) String() string {
+	return [...]string{"follower", "candidate", "leader"}[r]
+}
+
+type Node struct {
+	id    int
+	peers map[int]string // id -> address, not including this node
+
+	mu          sync.Mutex
+	role        Role
+	term        int
+	votedFor    int // 0: nobody this term (IDs start at 1)
+	leader      int
+	log         []Entry // log[0] is a sentinel, so real entries start at 1
+	commitIndex int
+	lastApplied int
+	nextIndex   map[int]int // leader only: next entry to send each peer
+	matchIndex  map[int]int // leader only: highest entry known replicated
+	deadline    time.Time   // election fires if nothing resets it by then
+	kv          map[string]string
+	waiters     map[int]chan Entry // Put calls waiting for an index to apply
+	blocked     map[int]bool
+	applyCond   *sync.Cond
+
+	clientsMu sync.Mutex
+	clients   map[int]*rpc.Client
+
+	kick chan struct{} // wakes the leader's replication early
+	ln   net.Listener
+	done chan struct{}
+}
+
+func NewNode(id int, peers map[int]string, ln net.Listener) *Node {
+	n := &Node{
+		id:      id,
+		peers:   peers,
+		log:     []Entry{{}},
+		kv:      map[string]string{},
+		waiters: map[int]chan Entry{},
+		blocked: map[int]bool{},
+		clients: map[int]*rpc.Client{},
+		kick:    make(chan struct{}, 1),
+		ln:      ln,
+		done:    make(chan struct{}),
+	}
+	n.applyCond = sync.NewCond(&n.mu)
+	n.resetDeadline()
+
+	srv := rpc.NewServer()
+	srv.RegisterName("Raft", &RaftRPC{n})
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go srv.ServeConn(conn)
+		}
+	}()
+	go n.ticker()
+	go n.applier()
+	return n
+}
+
+func (n *Node) logf(format string, args ...any) {
+	log.Printf("n%d T%d %-9s "+format, append([]any{n.id, n.term, n.role}, args...)...)
+}
+
+func (n *Node) majority() int { return (len(n.peers)+1)/2 + 1 }
+
+func (n *Node) lastLog() (index, term int) {
+	return len(n.log) - 1, n.log[len(n.log)-1].Term
+}
+
+// resetDeadline picks a new random election timeout. Randomizing is
+// what breaks ties: after a split vote, one node usually times out
+// well before the others and wins the next round.
+func (n *Node) resetDeadline() {
+	n.deadline = time.Now().Add(electionTimeout + rand.N(electionTimeout))
+}
+
+// becomeFollower steps down. A higher term always wins: whoever sees
+// one adopts it and forgets its vote from the old term.
+func (n *Node) becomeFollower(term int) {
+	if term > n.term {
+		n.term = term
+		n.votedFor = 0
+	}
+	if n.role != Follower {
+		n.role = Follower
+		n.logf("stepped down")
+		// Writes waiting on this node as leader may never commit now
+		for idx, ch := range n.waiters {
+			close(ch)
+			delete(n.waiters, idx)
+		}
+	}
+}
+
+func (n *Node) ticker() {
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+	check := time.NewTicker(10 * time.Millisecond)
+	defer check.Stop()
+	for {
+		send := false
+		select {
+		case <-n.done:
+			return
+		case <-heartbeat.C:
+			send = true
+		case <-n.kick:
+			send = true
+		case <-check.C:
+		}
+		n.mu.Lock()
+		switch {
+		case n.role == Leader:
+			n.mu.Unlock()
+			if send {
+				n.replicateAll()
+			}
+		case time.Now().After(n.deadline):
+			n.startElection()
+			n.mu.Unlock()
+		default:
+			n.mu.Unlock()
+		}
+	}
+}
+
+// ============================================================
+// Elections
+// ============================================================
+
+// startElection runs with n.mu held
+func (n *Node) startElection() {
+	n.role = Candidate
+	n.term++
+	n.votedFor = n.id
+	n.leader = 0
+	n.resetDeadline()
+	n.logf("election timeout, asking for votes")
+	lastIndex, lastTerm := n.lastLog()
+	args := RequestVoteArgs{Term: n.term, CandidateID: n.id, LastLogIndex: lastIndex, LastLogTerm: lastTerm}
+	votes := 1
+	for peer := range n.peers {
+		go func() {
+			var reply RequestVoteReply
+			if !n.call(peer, "Raft.RequestVote", &args, &reply) {
+				return
+			}
+			n.mu.Lock()
+			defer n.mu.Unlock()
+			if reply.Term > n.term {
+				n.becomeFollower(reply.Term)
+				return
+			}
+			// Ignore late answers from an election we already gave up on
+			if n.role != Candidate || n.term != args.Term || !reply.VoteGranted {
+				return
+			}
+			votes++
+			if votes == n.majority() {
+				n.becomeLeader()
+			}
+		}()
+	}
+}
+
+// becomeLeader runs with n.mu held
+func (n *Node) becomeLeader() {
+	n.role = Leader
+	n.leader = n.id
+	n.nextIndex, n.matchIndex = map[int]int{}, map[int]int{}
+	for peer := range n.peers {
+		n.nextIndex[peer] = len(n.log)
+		n.matchIndex[peer] = 0
+	}
+	// A leader may only count replicas for entries of its own term, so
+	// entries left over from earlier terms can't commit until something
+	// from this term does. An empty entry gets that going at once.
+	n.log = append(n.log, Entry{Term: n.term, Cmd: Command{Op: "noop"}})
+	n.logf("won the election with a majority of %d", n.majority())
+	n.poke()
+}
+
+func (n *Node) poke() {
+	select {
+	case n.kick <- struct{}{}:
+	default:
+	}
+}
+
+func (n *Node) handleRequestVote(args *RequestVoteArgs, reply *RequestVoteReply) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if args.Term > n.term {
+		n.becomeFollower(args.Term)
+	}
+	reply.Term = n.term
+	if args.Term < n.term || (n.votedFor != 0 && n.votedFor != args.CandidateID) {
+		return
+	}
+	// Only vote for a log at least as up to date as ours: later last
+	// term wins, same term then longer log wins. Any majority that
+	// elects a leader overlaps the majority that committed each entry,
+	// so the winner has every committed entry.
+	lastIndex, lastTerm := n.lastLog()
+	if args.LastLogTerm < lastTerm || (args.LastLogTerm == lastTerm && args.LastLogIndex < lastIndex) {
+		return
+	}
+	n.votedFor = args.CandidateID
+	reply.VoteGranted = true
+	n.resetDeadline()
+}
+
+// ============================================================
+// Replication
+// ============================================================
+
+func (n *Node) replicateAll() {
+	for peer := range n.peers {
+		go n.replicate(peer)
+	}
+}
+
+// replicate sends peer everything it is missing, or an empty
+// AppendEntries as a heartbeat when it is up to date
+func (n *Node) replicate(peer int) {
+	n.mu.Lock()
+	if n.role != Leader {
+		n.mu.Unlock()
+		return
+	}
+	next := n.nextIndex[peer]
+	args := AppendEntriesArgs{
+		Term:         n.term,
+		LeaderID:     n.id,
+		PrevLogIndex: next - 1,
+		PrevLogTerm:  n.log[next-1].Term,
+		Entries:      slices.Clone(n.log[next:min(len(n.log), next+100)]),
+		LeaderCommit: n.commitIndex,
+	}
+	n.mu.Unlock()
+
+	var reply AppendEntriesReply
+	if !n.call(peer, "Raft.AppendEntries", &args, &reply) {
+		return
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if reply.Term > n.term {
+		n.becomeFollower(reply.Term)
+		return
+	}
+	if n.role != Leader || n.term != args.Term {
+		return
+	}
+	if !reply.Success {
+		n.nextIndex[peer] = max(1, reply.ConflictIndex)
+		n.poke()
+		return
+	}
+	if match := args.PrevLogIndex + len(args.Entries); match > n.matchIndex[peer] {
+		n.matchIndex[peer] = match
+		n.nextIndex[peer] = match + 1
+	}
+	n.advanceCommit()
+	if n.nextIndex[peer] < len(n.log) {
+		n.poke() // more to send
+	}
+}
+
+// advanceCommit commits the highest entry from this term that a
+// majority holds; everything before it commits with it
+func (n *Node) advanceCommit() {
+	for idx := len(n.log) - 1; idx > n.commitIndex; idx-- {
+		if n.log[idx].Term != n.term {
+			break // older terms only commit indirectly
+		}
+		count := 1
+		for _, m := range n.matchIndex {
+			if m >= idx {
+				count++
+			}
+		}
+		if count >= n.majority() {
+			n.commitIndex = idx
+			n.applyCond.Broadcast()
+			return
+		}
+	}
+}
+
+func (n *Node) handleAppendEntries(args *AppendEntriesArgs, reply *AppendEntriesReply) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	reply.Term = n.term
+	if args.Term < n.term {
+		return // a deposed leader; the reply's term tells it so
+	}
+	n.becomeFollower(args.Term)
+	if n.leader != args.LeaderID {
+		n.leader = args.LeaderID
+		n.logf("following n%d", args.LeaderID)
+	}
+	n.resetDeadline()
+	reply.Term = n.term
+
+	// Our log must contain the leader's previous entry, else the
+	// leader backs up and tries again
+	if args.PrevLogIndex >= len(n.log) {
+		reply.ConflictIndex = len(n.log)
+		return
+	}
+	if t := n.log[args.PrevLogIndex].Term; t != args.PrevLogTerm {
+		i := args.PrevLogIndex
+		for i > 1 && n.log[i-1].Term == t {
+			i--
+		}
+		reply.ConflictIndex = i
+		return
+	}
+
+	// Append, cutting off our log at the first entry that disagrees
+	// with the leader's. Entries we already have are left alone: this
+	// may be an old, reordered request.
+	for i, e := range args.Entries {
+		idx := args.PrevLogIndex + 1 + i
+		if idx < len(n.log) && n.log[idx].Term == e.Term {
+			continue
+		}
+		if idx < len(n.log) {
+			n.logf("discarding %d uncommitted entries from index %d", len(n.log)-idx, idx)
+			n.log = n.log[:idx]
+		}
+		n.log = append(n.log, args.Entries[i:]...)
+		break
+	}
+	if args.LeaderCommit > n.commitIndex {
+		n.commitIndex = min(args.LeaderCommit, args.PrevLogIndex+len(args.Entries))
+		n.applyCond.Broadcast()
+	}
+	reply.Success = true
+}
+
+// applier feeds committed entries to the state machine, in order
+func (n *Node) applier() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for {
+		for n.lastApplied >= n.commitIndex {
+			select {
+			case <-n.done:
+				return
+			default:
+			}
+			n.applyCond.Wait()
+		}
+		n.lastApplied++
+		e := n.log[n.lastApplied]
+		switch e.Cmd.Op {
+		case "put":
+			n.kv[e.Cmd.Key] = e.Cmd.Value
+		case "delete":
+			delete(n.kv, e.Cmd.Key)
+		}
+		if ch, ok := n.waiters[n.lastApplied]; ok {
+			ch <- e
+			delete(n.waiters, n.lastApplied)
+		}
+	}
+}
+
+// ============================================================
+// Client operations
+// ============================================================
+
+func (n *Node) handlePut(args *PutArgs, reply *PutReply) error {
+	n.mu.Lock()
+	if n.role != Leader {
+		reply.NotLeader, reply.Leader = true, n.leader
+		n.mu.Unlock()
+		return nil
+	}
+	cmd := Command{Op: "put", Key: args.Key, Value: args.Value}
+	if args.Delete {
+		cmd.Op = "delete"
+	}
+	entry := Entry{Term: n.term, Cmd: cmd}
+	n.log = append(n.log, entry)
+	idx := len(n.log) - 1
+	ch := make(chan Entry, 1)
+	n.waiters[idx] = ch
+	n.poke()
+	n.mu.Unlock()
+
+	select {
+	case applied, ok := <-ch:
+		// A different entry at our index means a new leader overwrote
+		// ours before it committed
+		if !ok || applied != entry {
+			return errors.New("lost leadership before the write committed")
+		}
+		reply.Index = idx
+		return nil
+	case <-time.After(commitTimeout):
+		n.mu.Lock()
+		delete(n.waiters, idx)
+		n.mu.Unlock()
+		return errors.New("not committed in time: is this leader cut off from the majority?")
+	}
+}
+
+func (n *Node) status() Status {
+	blocked := []int{}
+	for id := range n.blocked {
+		blocked = append(blocked, id)
+	}
+	slices.Sort(blocked)
+	data := make(map[string]string, len(n.kv))
+	for k, v := range n.kv {
+		data[k] = v
+	}
+	return Status{ID: n.id, Role: n.role.String(), Term: n.term, Leader: n.leader,
+		LogLength: len(n.log) - 1, CommitIndex: n.commitIndex, Blocked: blocked, Data: data}
+}
+
+// ============================================================
+// Transport: net/rpc with a partition switch
+// ============================================================
+
+// RaftRPC is the net/rpc face of a Node. Traffic to or from a blocked
+// peer is dropped in both directions, which is what a partition looks
+// like from inside: requests that just never get an answer.
+type RaftRPC struct{ n *Node }
+
+var errPartitioned = errors.New("partitioned")
+
+func (r *RaftRPC) RequestVote(args *RequestVoteArgs, reply *RequestVoteReply) error {
+	if r.n.isBlocked(args.CandidateID) {
+		return errPartitioned
+	}
+	r.n.handleRequestVote(args, reply)
+	return nil
+}
+
+func (r *RaftRPC) AppendEntries(args *AppendEntriesArgs, reply *AppendEntriesReply) error {
+	if r.n.isBlocked(args.LeaderID) {
+		return errPartitioned
+	}
+	r.n.handleAppendEntries(args, reply)
+	return nil
+}
+
+func (r *RaftRPC) Put(args *PutArgs, reply *PutReply) error { return r.n.handlePut(args, reply) }
+
+func (r *RaftRPC) Get(args *GetArgs, reply *GetReply) error {
+	r.n.mu.Lock()
+	defer r.n.mu.Unlock()
+	reply.Value, reply.Found = r.n.kv[args.Key]
+	reply.Status = r.n.status()
+	return nil
+}
+
+func (r *RaftRPC) Status(_ *struct{}, reply *Status) error {
+	r.n.mu.Lock()
+	defer r.n.mu.Unlock()
+	*reply = r.n.status()
+	return nil
+}
+
+func (r *RaftRPC) Partition(args *PartitionArgs, reply *Status) error {
+	r.n.mu.Lock()
+	defer r.n.mu.Unlock()
+	r.n.blocked = map[int]bool{}
+	for _, id := range args.Block {
+		r.n.blocked[id] = true
+	}
+	*reply = r.n.status()
+	return nil
+}
+
+func (n *Node) isBlocked(peer int) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.blocked[peer]
+}
+
+// call makes one RPC to a peer, giving up after rpcTimeout
+func (n *Node) call(peer int, method string, args, reply any) bool {
+	if n.isBlocked(peer) {
+		return false
+	}
+	c, err := n.client(peer)
+	if err != nil {
+		return false
+	}
+	call := c.Go(method, args, reply, make(chan *rpc.Call, 1))
+	select {
+	case <-call.Done:
+		var serverErr rpc.ServerError
+		if call.Error != nil && !errors.As(call.Error, &serverErr) {
+			n.dropClient(peer, c) // the connection broke; redial next time
+		}
+		return call.Error == nil
+	case <-time.After(rpcTimeout):
+		return false
+	case <-n.done:
+		return false
+	}
+}
+
+func (n *Node) client(peer int) (*rpc.Client, error) {
+	n.clientsMu.Lock()
+	defer n.clientsMu.Unlock()
+	if c := n.clients[peer]; c != nil {
+		return c, nil
+	}
+	conn, err := net.DialTimeout("tcp", n.peers[peer], rpcTimeout)
+	if err != nil {
+		return nil, err
+	}
+	c := rpc.NewClient(conn)
+	n.clients[peer] = c
+	return c, nil
+}
+
+func (n *Node) dropClient(peer int, c *rpc.Client) {
+	n.clientsMu.Lock()
+	defer n.clientsMu.Unlock()
+	if n.clients[peer] == c {
+		delete(n.clients, peer)
+		c.Close()
+	}
+}
+
+func (n *Node) Close() {
+	close(n.done)
+	n.ln.Close()
+	n.mu.Lock()
+	n.applyCond.Broadcast()
+	n.mu.Unlock()
+	n.clientsMu.Lock()
+	for _, c := range n.clients {
+		c.Close()
+	}
+	n.clientsMu.Unlock()
+}
+
+// ============================================================
+// Client
+// ============================================================
+
+// Client writes to whichever node is leader, following hints, and
+// reads from any node the caller picks
+type Client struct {
+	addrs  map[int]string
+	leader int
+}
+
+func (c *Client) rpc(id int, method string, args, reply any) error {
+	conn, err := net.DialTimeout("tcp", c.addrs[id], time.Second)
+	if err != nil {
+		return err
+	}
+	client := rpc.NewClient(conn)
+	defer client.Close()
+	return client.Call(method, args, reply)
+}
+
+// Put retries until some node accepts the write as leader and
+// commits it, or the deadline passes
+func (c *Client) Put(key, value string, del bool) (int, int, error) {
+	ids := make([]int, 0, len(c.addrs))
+	for id := range c.addrs {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	try := c.leader
+	if try == 0 {
+		try = ids[0]
+	}
+	deadline := time.Now().Add(10 * time.Second)
+	var lastErr error
+	for attempt := 0; time.Now().Before(deadline); attempt++ {
+		var reply PutReply
+		err := c.rpc(try, "Raft.Put", &PutArgs{Key: key, Value: value, Delete: del}, &reply)
+		switch {
+		case err == nil && !reply.NotLeader:
+			c.leader = try
+			return try, reply.Index, nil
+		case err == nil && reply.Leader != 0 && reply.Leader != try:
+			try = reply.Leader // follow the hint
+			continue
+		case err != nil:
+			lastErr = fmt.Errorf("n%d: %w", try, err)
+		}
+		// No leader known (mid-election) or the node failed: next one
+		try = ids[(slices.Index(ids, try)+1)%len(ids)]
+		time.Sleep(50 * time.Millisecond)
+	}
+	return 0, 0, fmt.Errorf("no leader committed the write: %v", lastErr)
+}
+
+func (c *Client) Get(id int, key string) (GetReply, error) {
+	var reply GetReply
+	err := c.rpc(id, "Raft.Get", &GetArgs{Key: key}, &reply)
+	return reply, err
+}
+
+func (c *Client) Status(id int) (Status, error) {
+	var st Status
+	err := c.rpc(id, "Raft.Status", &struct{}{}, &st)
+	return st, err
+}
+
+func (c *Client) Partition(id int, block []int) error {
+	var st Status
+	return c.rpc(id, "Raft.Partition", &PartitionArgs{Block: block}, &st)
+}
+
+func (c *Client) printStatus() {
+	ids := make([]int, 0, len(c.addrs))
+	for id := range c.addrs {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	fmt.Printf("  %-4s %-9s %-5s %-6s %-4s %-7s %-9s %s\n", "node", "role", "term", "leader", "log", "commit", "blocked", "data")
+	for _, id := range ids {
+		st, err := c.Status(id)
+		if err != nil {
+			fmt.Printf("  n%-3d unreachable: %v\n", id, err)
+			continue
+		}
+		keys := make([]string, 0, len(st.Data))
+		for k := range st.Data {
+			keys = append(keys, k)
+		}
+		slices.Sort(keys)
+		var data []string
+		for _, k := range keys {
+			data = append(data, k+"="+st.Data[k])
+		}
+		fmt.Printf("  n%-3d %-9s %-5d n%-5d %-4d %-7d %-9s %s\n", id, st.Role, st.Term, st.Leader,
+			st.LogLength, st.CommitIndex, fmt.Sprint(st.Blocked), strings.Join(data, " "))
+	}
+}
+
+// ============================================================
+// Demo
+// ============================================================
+
+func demo() error {
+	const size = 5
+	var lns []net.Listener
+	addrs := map[int]string{}
+	for id := 1; id <= size; id++ {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			return err
+		}
+		lns = append(lns, ln)
+		addrs[id] = ln.Addr().String()
+	}
+	log.SetFlags(log.Lmicroseconds)
+	log.SetPrefix("  ")
+	var nodes []*Node
+	for id := 1; id <= size; id++ {
+		nodes = append(nodes, NewNode(id, peersOf(addrs, id), lns[id-1]))
+	}
+	defer func() {
+		for _, n := range nodes {
+			n.Close()
+		}
+	}()
+	c := &Client{addrs: addrs}
+
+	fmt.Println("=== Electing a leader ===")
+	waitForLeader(c)
+	fmt.Println()
+
+	fmt.Println("=== Writes through the leader, reads from followers ===")
+	for _, kv := range [][2]string{{"x", "1"}, {"y", "2"}, {"z", "3"}} {
+		leader, idx, err := c.Put(kv[0], kv[1], false)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("put %s=%s -> committed at index %d by n%d\n", kv[0], kv[1], idx, leader)
+	}
+	time.Sleep(2 * heartbeatInterval) // followers learn the commit index with the next heartbeat
+	for id := 1; id <= size; id++ {
+		r, _ := c.Get(id, "y")
+		fmt.Printf("get y from n%d (%s) -> %q\n", id, r.Role, r.Value)
+	}
+	fmt.Println()
+
+	// Cut the leader and one follower off from the other three
+	oldLeader := c.leader
+	buddy := oldLeader%size + 1
+	minority := []int{oldLeader, buddy}
+	var majority []int
+	for id := 1; id <= size; id++ {
+		if !slices.Contains(minority, id) {
+			majority = append(majority, id)
+		}
+	}
+	fmt.Printf("=== Partition: %v | %v ===\n", minority, majority)
+	for _, id := range minority {
+		c.Partition(id, majority)
+	}
+	for _, id := range majority {
+		c.Partition(id, minority)
+	}
+
+	fmt.Printf("put x=OLD via n%d, the old leader (it still thinks it leads)...\n", oldLeader)
+	start := time.Now()
+	var reply PutReply
+	err := c.rpc(oldLeader, "Raft.Put", &PutArgs{Key: "x", Value: "OLD"}, &reply)
+	fmt.Printf("  -> after %v: %v\n", time.Since(start).Round(100*time.Millisecond), err)
+
+	fmt.Println("meanwhile the majority side elects its own leader:")
+	c.leader = majority[0]
+	leader, idx, err := c.Put("x", "NEW", false)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("put x=NEW -> committed at index %d by n%d\n", idx, leader)
+	time.Sleep(2 * heartbeatInterval)
+	r, _ := c.Get(buddy, "x")
+	fmt.Printf("get x from n%d, on the minority side -> %q (stale: it can't hear the new leader)\n", buddy, r.Value)
+	r, _ = c.Get(majority[len(majority)-1], "x")
+	fmt.Printf("get x from n%d, on the majority side -> %q\n", majority[len(majority)-1], r.Value)
+	c.printStatus()
+	fmt.Println()
+
+	fmt.Println("=== Healing the partition ===")
+	for id := 1; id <= size; id++ {
+		c.Partition(id, nil)
+	}
+	time.Sleep(5 * heartbeatInterval)
+	fmt.Printf("n%d saw the higher term, stepped down and dropped its uncommitted x=OLD:\n", oldLeader)
+	c.printStatus()
+	return nil
+}
+
+func waitForLeader(c *Client) {
+	for {
+		for id := range c.addrs {
+			if st, err := c.Status(id); err == nil && st.Role == "leader" {
+				c.leader = id
+				return
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func peersOf(addrs map[int]string, self int) map[int]string {
+	peers := map[int]string{}
+	for id, addr := range addrs {
+		if id != self {
+			peers[id] = addr
+		}
+	}
+	return peers
+}
+
+// ============================================================
+// Main
+// ============================================================
+
+func main() {
+	if len(os.Args) < 2 || os.Args[1] == "demo" {
+		if err := demo(); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	cmd := os.Args[1]
+	fs := flag.NewFlagSet(cmd, flag.ExitOnError)
+	cluster := fs.String("cluster", "127.0.0.1:7001,127.0.0.1:7002,127.0.0.1:7003", "comma-separated node addresses; node IDs are positions from 1")
+	id := fs.Int("id", 1, "node ID")
+	block := fs.String("block", "", "partition: comma-separated peer IDs to cut off")
+	fs.Parse(os.Args[2:])
+
+	addrs := map[int]string{}
+	for i, addr := range strings.Split(*cluster, ",") {
+		addrs[i+1] = strings.TrimSpace(addr)
+	}
+	if _, ok := addrs[*id]; !ok {
+		log.Fatalf("no node %d in a cluster of %d", *id, len(addrs))
+	}
+	c := &Client{addrs: addrs}
+
+	switch cmd {
+	case "node":
+		ln, err := net.Listen("tcp", addrs[*id])
+		if err != nil {
+			log.Fatal(err)
+		}
+		NewNode(*id, peersOf(addrs, *id), ln)
+		log.Printf("n%d listening on %s", *id, addrs[*id])
+		select {}
+	case "put", "delete":
+		args := fs.Args()
+		if len(args) != 2 && !(cmd == "delete" && len(args) == 1) {
+			log.Fatalf("usage: %s -cluster ... KEY VALUE", cmd)
+		}
+		value := ""
+		if len(args) == 2 {
+			value = args[1]
+		}
+		leader, idx, err := c.Put(args[0], value, cmd == "delete")
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("committed at index %d by n%d\n", idx, leader)
+	case "get":
+		if fs.NArg() != 1 {
+			log.Fatal("usage: get -cluster ... -id N KEY")
+		}
+		r, err := c.Get(*id, fs.Arg(0))
+		if err != nil {
+			log.Fatal(err)
+		}
+		if !r.Found {
+			fmt.Printf("(not found on n%d, %s, commit index %d)\n", *id, r.Role, r.CommitIndex)
+			return
+		}
+		fmt.Printf("%s (from n%d, %s, commit index %d)\n", r.Value, *id, r.Role, r.CommitIndex)
+	case "status":
+		c.printStatus()
+	case "partition":
+		var ids []int
+		for f := range strings.SplitSeq(*block, ",") {
+			if f = strings.TrimSpace(f); f != "" {
+				n, err := strconv.Atoi(f)
+				if err != nil {
+					log.Fatalf("bad peer ID %q", f)
+				}
+				ids = append(ids, n)
+			}
+		}
+		if err := c.Partition(*id, ids); err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("n%d now drops traffic to and from %v\n", *id, ids)
+	default:
+		log.Fatalf("unknown command %q (demo, node, put, delete, get, status, partition)", cmd)
+	}
+}
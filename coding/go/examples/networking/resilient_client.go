@@ -0,0 +1,542 @@
+// Resilient HTTP Client - Timeouts, retries, circuit breaking, hedging
+//
+// A wrapper around http.Client for calling services that sometimes
+// fail or stall, run against a local server that injects exactly that:
+// - Timeouts: an overall deadline per call, and a shorter one per
+//   attempt so one hung attempt can't eat the whole budget
+// - Retries with jittered exponential backoff, only for errors worth
+//   retrying (network errors, 429/502/503/504) and only for requests
+//   that are safe to repeat; Retry-After is honoured
+// - A retry budget: retries may add at most 20% on top of the real
+//   traffic, so a struggling server isn't hit with 3x the load
+// - A circuit breaker: after repeated failures, fail fast for a while
+//   instead of waiting on a server that is down, then let one probe
+//   through to see if it recovered
+// - Hedged requests: if an idempotent request is slower than usual,
+//   send a second copy and take whichever answers first - cuts tail
+//   latency for the price of a few extra requests
+//
+// Usage:
+//   go run resilient_client.go
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ============================================================
+// Circuit breaker
+// ============================================================
+
+type breakerState int
+
+const (
+	stateClosed   breakerState = iota // normal: requests flow
+	stateOpen                         // failing fast
+	stateHalfOpen                     // letting one probe through
+)
+
+func (s breakerState) String() string {
+	return [...]string{"closed", "open", "half-open"}[s]
+}
+
+// ErrCircuitOpen is returned without touching the network while the
+// breaker is open
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// Breaker opens after Threshold consecutive failures and stays open
+// for Cooldown
+type Breaker struct {
+	Threshold int
+	Cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    breakerState
+	failures int
+	openedAt time.Time
+	probing  bool // a half-open probe is in flight
+}
+
+// Allow reports whether a request may go out
+func (b *Breaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	switch b.state {
+	case stateOpen:
+		if time.Since(b.openedAt) < b.Cooldown {
+			return ErrCircuitOpen
+		}
+		b.setState(stateHalfOpen)
+		fallthrough
+	case stateHalfOpen:
+		// One probe at a time; everyone else keeps failing fast
+		if b.probing {
+			return ErrCircuitOpen
+		}
+		b.probing = true
+	}
+	return nil
+}
+
+// Record reports the outcome of a request that Allow let through
+func (b *Breaker) Record(ok bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+	if ok {
+		b.failures = 0
+		if b.state != stateClosed {
+			b.setState(stateClosed)
+		}
+		return
+	}
+	b.failures++
+	if b.state == stateHalfOpen || b.failures >= b.Threshold {
+		b.openedAt = time.Now()
+		b.setState(stateOpen)
+	}
+}
+
+func (b *Breaker) setState(s breakerState) {
+	log.Printf("breaker: %s -> %s", b.state, s)
+	b.state = s
+}
+
+// ============================================================
+// Retry budget
+// ============================================================
+
+// RetryBudget caps retries as a fraction of requests. Each request
+// deposits Ratio tokens, each retry spends one. The balance is capped
+// so a quiet spell can't save up for a retry storm.
+type RetryBudget struct {
+	Ratio float64
+
+	mu     sync.Mutex
+	tokens float64
+}
+
+func (rb *RetryBudget) deposit() {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	rb.tokens = min(rb.tokens+rb.Ratio, 10) // cap the savings
+}
+
+func (rb *RetryBudget) withdraw() bool {
+	rb.mu.Lock()
+	defer rb.mu.Unlock()
+	if rb.tokens < 1 {
+		return false
+	}
+	rb.tokens--
+	return true
+}
+
+// ============================================================
+// Client
+// ============================================================
+
+// Config holds the knobs; the zero value of a field disables it
+type Config struct {
+	AttemptTimeout time.Duration // per attempt
+	MaxAttempts    int           // including the first
+	BaseDelay      time.Duration // backoff before the first retry
+	MaxDelay       time.Duration // backoff ceiling
+	HedgeAfter     time.Duration // send a second copy after this long
+}
+
+// Client wraps an http.Client with the resilience features
+type Client struct {
+	HTTP    *http.Client
+	Config  Config
+	Breaker *Breaker
+	Budget  *RetryBudget
+
+	// Counters for the demo output
+	attempts, retries, hedges, budgetDenied atomic.Int64
+}
+
+// Do sends req, retrying and hedging as configured. The request's
+// context bounds the whole call, retries included.
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	if c.Budget != nil {
+		c.Budget.deposit()
+	}
+	var lastErr error
+	for attempt := 1; ; attempt++ {
+		if c.Breaker != nil {
+			if err := c.Breaker.Allow(); err != nil {
+				return nil, err
+			}
+		}
+		resp, err := c.attempt(req)
+		retryable, wait := classify(resp, err)
+		if c.Breaker != nil {
+			// Only server-side trouble counts against the server; a 404
+			// is a healthy server saying no
+			c.Breaker.Record(!retryable)
+		}
+		if !retryable {
+			return resp, err
+		}
+
+		lastErr = err
+		if err == nil {
+			lastErr = fmt.Errorf("server returned %s", resp.Status)
+		}
+		if attempt >= c.Config.MaxAttempts || !replayable(req) {
+			return resp, err // give the caller the last real answer
+		}
+		if c.Budget != nil && !c.Budget.withdraw() {
+			c.budgetDenied.Add(1)
+			return resp, err
+		}
+		if resp != nil {
+			// Drain so the connection can be reused, then discard
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+			resp.Body.Close()
+		}
+
+		if wait == 0 {
+			wait = c.backoff(attempt)
+		}
+		c.retries.Add(1)
+		select {
+		case <-time.After(wait):
+		case <-req.Context().Done():
+			return nil, fmt.Errorf("giving up after %d attempts: %w (last error: %v)", attempt, req.Context().Err(), lastErr)
+		}
+	}
+}
+
+// backoff is "full jitter": a random delay between 0 and the capped
+// exponential. Without jitter, every client that failed at the same
+// moment retries at the same moment too, and the spikes never end.
+func (c *Client) backoff(attempt int) time.Duration {
+	ceiling := min(c.Config.BaseDelay<<(attempt-1), c.Config.MaxDelay)
+	return rand.N(ceiling + 1)
+}
+
+// attempt sends one try, hedged if configured
+func (c *Client) attempt(req *http.Request) (*http.Response, error) {
+	if c.Config.HedgeAfter <= 0 || !replayable(req) {
+		return c.send(req)
+	}
+
+	type result struct {
+		resp *http.Response
+		err  error
+	}
+	ctx, cancel := context.WithCancel(req.Context())
+	results := make(chan result, 2)
+	launch := func() {
+		resp, err := c.send(req.WithContext(ctx))
+		results <- result{resp, err}
+	}
+
+	go launch()
+	inflight := 1
+	hedge := time.NewTimer(c.Config.HedgeAfter)
+	defer hedge.Stop()
+
+	var first result
+	for {
+		select {
+		case <-hedge.C:
+			c.hedges.Add(1)
+			inflight++
+			go launch()
+			continue
+		case r := <-results:
+			inflight--
+			if r.err == nil || inflight == 0 {
+				first = r
+			} else {
+				continue // one copy failed; wait for the other
+			}
+		}
+		break
+	}
+
+	// The copies share ctx, so cancelling it now would abort the
+	// winner's body too: the loser is cancelled when the winner's body
+	// is closed, and a goroutine closes whatever the loser returns.
+	if inflight > 0 {
+		go func() {
+			for range inflight {
+				if r := <-results; r.resp != nil {
+					r.resp.Body.Close()
+				}
+			}
+		}()
+	}
+	if first.resp == nil {
+		cancel()
+		return nil, first.err
+	}
+	first.resp.Body = &cancelOnClose{ReadCloser: first.resp.Body, cancel: cancel}
+	return first.resp, first.err
+}
+
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelOnClose) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
+
+// send performs one HTTP request with the per-attempt timeout
+func (c *Client) send(req *http.Request) (*http.Response, error) {
+	c.attempts.Add(1)
+	r := req.Clone(req.Context())
+	if req.Body != nil && req.GetBody != nil {
+		// A body can only be read once; GetBody returns a fresh copy
+		// for each attempt (NewRequest sets it for common body types)
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		r.Body = body
+	}
+	if c.Config.AttemptTimeout <= 0 {
+		return c.HTTP.Do(r)
+	}
+	ctx, cancel := context.WithTimeout(r.Context(), c.Config.AttemptTimeout)
+	resp, err := c.HTTP.Do(r.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// classify decides whether a result is worth retrying, and for how
+// long the server asked us to wait
+func classify(resp *http.Response, err error) (retry bool, wait time.Duration) {
+	if err != nil {
+		// The caller's own deadline or cancel: retrying can't help
+		if errors.Is(err, context.Canceled) {
+			return false, 0
+		}
+		// Per-attempt timeouts and connection errors are retryable
+		var netErr net.Error
+		return errors.As(err, &netErr) || errors.Is(err, context.DeadlineExceeded) || errors.Is(err, io.ErrUnexpectedEOF), 0
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusServiceUnavailable:
+		if secs, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil {
+			wait = time.Duration(secs) * time.Second
+		}
+		return true, wait
+	case http.StatusBadGateway, http.StatusGatewayTimeout:
+		return true, 0
+	}
+	return false, 0
+}
+
+// replayable reports whether sending req twice is safe. GET, HEAD,
+// PUT, DELETE and OPTIONS are idempotent by definition; a POST is
+// only if the server deduplicates it by an Idempotency-Key header.
+func replayable(req *http.Request) bool {
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false // we couldn't resend the body anyway
+	}
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodPut, http.MethodDelete, http.MethodOptions:
+		return true
+	}
+	return req.Header.Get("Idempotency-Key") != ""
+}
+
+// ============================================================
+// Flaky test server
+// ============================================================
+
+// flakyServer fails and stalls on command:
+//   /flaky?fail=0.3   30% of requests answer 503
+//   /slow?p=0.1       10% of requests take 500ms instead of 10ms
+//   /down             toggled by the demo: 503 or 200
+//   /ratelimited      first request 429 with Retry-After: 1
+func flakyServer(down *atomic.Bool) http.Handler {
+	var ratelimitHits atomic.Int64
+	mux := http.NewServeMux()
+	mux.HandleFunc("/flaky", func(w http.ResponseWriter, r *http.Request) {
+		p, _ := strconv.ParseFloat(r.URL.Query().Get("fail"), 64)
+		if rand.Float64() < p {
+			http.Error(w, "injected failure", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("/slow", func(w http.ResponseWriter, r *http.Request) {
+		p, _ := strconv.ParseFloat(r.URL.Query().Get("p"), 64)
+		delay := 10 * time.Millisecond
+		if rand.Float64() < p {
+			delay = 500 * time.Millisecond
+		}
+		select {
+		case <-time.After(delay):
+			fmt.Fprintln(w, "ok")
+		case <-r.Context().Done(): // the client gave up (hedge loser)
+		}
+	})
+	mux.HandleFunc("/down", func(w http.ResponseWriter, r *http.Request) {
+		if down.Load() {
+			http.Error(w, "down for maintenance", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("/ratelimited", func(w http.ResponseWriter, r *http.Request) {
+		if ratelimitHits.Add(1) == 1 {
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, "slow down", http.StatusTooManyRequests)
+			return
+		}
+		fmt.Fprintln(w, "ok")
+	})
+	return mux
+}
+
+// ============================================================
+// Demo
+// ============================================================
+
+func get(c *Client, url string, timeout time.Duration) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	resp, err := c.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	return resp.StatusCode, nil
+}
+
+// percentile returns the p-th percentile (0-100) of sorted durations
+func percentile(sorted []time.Duration, p int) time.Duration {
+	return sorted[(len(sorted)-1)*p/100]
+}
+
+func main() {
+	var down atomic.Bool
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		log.Fatal(err)
+	}
+	go http.Serve(ln, flakyServer(&down))
+	base := "http://" + ln.Addr().String()
+	log.SetFlags(log.Ltime | log.Lmicroseconds)
+
+	newClient := func(cfg Config) *Client {
+		return &Client{HTTP: &http.Client{}, Config: cfg}
+	}
+	retrying := Config{AttemptTimeout: time.Second, MaxAttempts: 4, BaseDelay: 20 * time.Millisecond, MaxDelay: 500 * time.Millisecond}
+
+	fmt.Println("=== Retries: 100 requests, 30% injected failures ===")
+	for _, tc := range []struct {
+		name string
+		cfg  Config
+	}{
+		{"no retries", Config{MaxAttempts: 1}},
+		{"4 attempts", retrying},
+	} {
+		c := newClient(tc.cfg)
+		ok := 0
+		for range 100 {
+			if status, err := get(c, base+"/flaky?fail=0.3", 5*time.Second); err == nil && status == 200 {
+				ok++
+			}
+		}
+		fmt.Printf("%-12s %3d/100 succeeded, %d attempts\n", tc.name, ok, c.attempts.Load())
+	}
+
+	fmt.Println()
+	fmt.Println("=== Retry budget: the server is 90% broken ===")
+	// Without a budget each request makes up to 4 attempts: the
+	// clients quadruple the load on a server that is already failing.
+	// The budget holds retries to ~20% of requests instead.
+	for _, budget := range []*RetryBudget{nil, {Ratio: 0.2}} {
+		c := newClient(retrying)
+		c.Config.BaseDelay, c.Config.MaxDelay = time.Millisecond, 5*time.Millisecond
+		c.Budget = budget
+		for range 100 {
+			get(c, base+"/flaky?fail=0.9", 5*time.Second)
+		}
+		name := "no budget"
+		if budget != nil {
+			name = "20% budget"
+		}
+		fmt.Printf("%-12s 100 requests -> %3d attempts sent (%d retries refused by budget)\n",
+			name, c.attempts.Load(), c.budgetDenied.Load())
+	}
+
+	fmt.Println()
+	fmt.Println("=== Retry-After ===")
+	c := newClient(retrying)
+	start := time.Now()
+	status, err := get(c, base+"/ratelimited", 5*time.Second)
+	fmt.Printf("status %d err=%v after %v and %d attempts (waited as told, not our backoff)\n",
+		status, err, time.Since(start).Round(100*time.Millisecond), c.attempts.Load())
+
+	fmt.Println()
+	fmt.Println("=== Circuit breaker: the server goes down, then recovers ===")
+	c = newClient(Config{AttemptTimeout: time.Second, MaxAttempts: 1})
+	c.Breaker = &Breaker{Threshold: 3, Cooldown: 300 * time.Millisecond}
+	down.Store(true)
+	for i := range 16 {
+		if i == 8 {
+			down.Store(false)
+			fmt.Println("   (server recovers)")
+		}
+		status, err := get(c, base+"/down", time.Second)
+		if errors.Is(err, ErrCircuitOpen) {
+			fmt.Printf("   request %2d: failed fast, no network call\n", i)
+		} else {
+			fmt.Printf("   request %2d: status %d\n", i, status)
+		}
+		time.Sleep(60 * time.Millisecond)
+	}
+	fmt.Printf("   16 requests, %d reached the server\n", c.attempts.Load())
+
+	fmt.Println()
+	fmt.Println("=== Hedging: 10% of requests take 500ms instead of 10ms ===")
+	for _, hedgeAfter := range []time.Duration{0, 50 * time.Millisecond} {
+		c := newClient(Config{MaxAttempts: 1, HedgeAfter: hedgeAfter})
+		var latencies []time.Duration
+		for range 200 {
+			start := time.Now()
+			get(c, base+"/slow?p=0.1", 5*time.Second)
+			latencies = append(latencies, time.Since(start))
+		}
+		slices.Sort(latencies)
+		name := "no hedging"
+		if hedgeAfter > 0 {
+			name = "hedge@50ms"
+		}
+		fmt.Printf("%-11s p50=%-6v p99=%-6v max=%-6v extra requests: %d\n", name,
+			percentile(latencies, 50).Round(time.Millisecond), percentile(latencies, 99).Round(time.Millisecond),
+			latencies[len(latencies)-1].Round(time.Millisecond), c.hedges.Load())
+	}
+	// Hedge at roughly the p95 of normal latency: late enough that few
+	// requests are duplicated, early enough to hide the slow tail.
+}
@@ -0,0 +1,637 @@
+// RESP Key-Value Server - A tiny Redis speaking the real protocol
+//
+// An in-memory key-value server that redis-cli can talk to:
+// - RESP2 parsing: commands arrive as arrays of bulk strings
+//   ("*2\r\n$3\r\nGET\r\n$3\r\nfoo\r\n"), or as plain "inline" lines
+//   when you type into nc/telnet
+// - Replies in all five RESP types: simple string, error, integer,
+//   bulk string (nil included) and array
+// - GET SET DEL EXISTS INCR INCRBY DECR EXPIRE PEXPIRE TTL PTTL
+//   PERSIST DBSIZE PING ECHO FLUSHALL, with SET's EX/PX/NX/XX options
+// - Per-key expiry, done the way Redis does it: lazily when a key is
+//   touched, plus an active sweeper that samples keys with a TTL so
+//   expired keys nobody reads still get freed
+// - Pipelining for free: replies are buffered and flushed only when
+//   no more commands are waiting in the read buffer
+//
+// Usage:
+//   go run resp_kv_server.go           # server + demo client
+//   go run resp_kv_server.go server    # server only
+//
+// Test with redis-cli (port 6380 so it won't clash with a real Redis):
+//   redis-cli -p 6380 set greeting hello EX 10
+//   redis-cli -p 6380 ttl greeting
+//   redis-cli -p 6380 incr hits
+// Or by hand, using inline commands:
+//   printf 'SET a 1\r\nINCR a\r\nGET a\r\n' | nc localhost 6380
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const listenAddr = "127.0.0.1:6380"
+
+// Limits that stop a client from making us allocate unbounded memory
+const (
+	maxArgs     = 1024
+	maxBulkSize = 512 << 20 // Redis's own limit
+	maxInline   = 64 << 10
+)
+
+// ============================================================
+// Store
+// ============================================================
+
+type entry struct {
+	value    string
+	expireAt time.Time // zero means no expiry
+}
+
+func (e entry) expired(now time.Time) bool {
+	return !e.expireAt.IsZero() && !now.Before(e.expireAt)
+}
+
+// Store is the keyspace. One mutex is plenty here: every operation is
+// a map access, far cheaper than the network round trip around it.
+type Store struct {
+	mu       sync.Mutex
+	data     map[string]entry
+	volatile map[string]struct{} // keys with a TTL, for the sweeper
+	now      func() time.Time
+}
+
+func NewStore() *Store {
+	return &Store{data: map[string]entry{}, volatile: map[string]struct{}{}, now: time.Now}
+}
+
+// lookup returns a live entry, deleting it first if it has expired
+// (lazy expiry). Caller holds s.mu.
+func (s *Store) lookup(key string) (entry, bool) {
+	e, ok := s.data[key]
+	if ok && e.expired(s.now()) {
+		s.remove(key)
+		return entry{}, false
+	}
+	return e, ok
+}
+
+func (s *Store) remove(key string) {
+	delete(s.data, key)
+	delete(s.volatile, key)
+}
+
+func (s *Store) put(key string, e entry) {
+	s.data[key] = e
+	if e.expireAt.IsZero() {
+		delete(s.volatile, key)
+	} else {
+		s.volatile[key] = struct{}{}
+	}
+}
+
+// Sweep is one round of active expiry, the Redis algorithm: sample
+// up to 20 keys that have a TTL, delete the expired ones, and go
+// again while more than a quarter of the sample had expired.
+func (s *Store) Sweep() (removed int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for {
+		sampled, expired := 0, 0
+		now := s.now()
+		// Map iteration order is randomized, which makes this a
+		// (cheap, not perfectly uniform) random sample
+		for key := range s.volatile {
+			if sampled == 20 {
+				break
+			}
+			sampled++
+			if s.data[key].expired(now) {
+				s.remove(key)
+				expired++
+			}
+		}
+		removed += expired
+		if sampled == 0 || expired*4 <= sampled {
+			return removed
+		}
+	}
+}
+
+// RunSweeper calls Sweep on a ticker until stop is closed
+func (s *Store) RunSweeper(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			s.Sweep()
+		}
+	}
+}
+
+// ============================================================
+// RESP protocol
+// ============================================================
+
+var errProtocol = errors.New("protocol error")
+
+// readCommand reads one command: a RESP array of bulk strings, or an
+// inline command (a line of space-separated words)
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := readLine(r)
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, nil // empty inline line: ignore
+	}
+	if line[0] != '*' {
+		return strings.Fields(line), nil
+	}
+
+	n, err := strconv.Atoi(line[1:])
+	if err != nil || n < 0 || n > maxArgs {
+		return nil, fmt.Errorf("%w: invalid multibulk length", errProtocol)
+	}
+	args := make([]string, 0, n)
+	for range n {
+		line, err := readLine(r)
+		if err != nil {
+			return nil, err
+		}
+		if len(line) == 0 || line[0] != '$' {
+			return nil, fmt.Errorf("%w: expected '$', got %q", errProtocol, line)
+		}
+		size, err := strconv.Atoi(line[1:])
+		if err != nil || size < 0 || size > maxBulkSize {
+			return nil, fmt.Errorf("%w: invalid bulk length", errProtocol)
+		}
+		// Bulk strings are length-prefixed, so they may contain \r\n:
+		// read exactly size bytes plus the trailing CRLF
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		if string(buf[size:]) != "\r\n" {
+			return nil, fmt.Errorf("%w: bulk string not terminated by CRLF", errProtocol)
+		}
+		args = append(args, string(buf[:size]))
+	}
+	return args, nil
+}
+
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadSlice('\n')
+	if errors.Is(err, bufio.ErrBufferFull) || len(line) > maxInline {
+		return "", fmt.Errorf("%w: line too long", errProtocol)
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(string(line), "\r\n"), nil
+}
+
+// Writers for each reply type
+func writeSimple(w *bufio.Writer, s string) { fmt.Fprintf(w, "+%s\r\n", s) }
+func writeError(w *bufio.Writer, s string)  { fmt.Fprintf(w, "-%s\r\n", s) }
+func writeInt(w *bufio.Writer, n int64)     { fmt.Fprintf(w, ":%d\r\n", n) }
+func writeNil(w *bufio.Writer)              { w.WriteString("$-1\r\n") }
+func writeBulk(w *bufio.Writer, s string)   { fmt.Fprintf(w, "$%d\r\n%s\r\n", len(s), s) }
+
+// ============================================================
+// Commands
+// ============================================================
+
+const (
+	errWrongArgs = "ERR wrong number of arguments for '%s' command"
+	errNotInt    = "ERR value is not an integer or out of range"
+	errSyntax    = "ERR syntax error"
+)
+
+// Execute runs one command and writes its reply
+func (s *Store) Execute(w *bufio.Writer, args []string) {
+	cmd := strings.ToUpper(args[0])
+	arity := func(n int) bool { // exact number of arguments, counting the command
+		if len(args) != n {
+			writeError(w, fmt.Sprintf(errWrongArgs, strings.ToLower(cmd)))
+			return false
+		}
+		return true
+	}
+
+	switch cmd {
+	case "PING":
+		if len(args) > 1 {
+			writeBulk(w, args[1])
+		} else {
+			writeSimple(w, "PONG")
+		}
+	case "ECHO":
+		if arity(2) {
+			writeBulk(w, args[1])
+		}
+	case "COMMAND":
+		// redis-cli asks for command docs when it starts; an empty
+		// array just means "no hints"
+		w.WriteString("*0\r\n")
+
+	case "GET":
+		if !arity(2) {
+			return
+		}
+		s.mu.Lock()
+		e, ok := s.lookup(args[1])
+		s.mu.Unlock()
+		if ok {
+			writeBulk(w, e.value)
+		} else {
+			writeNil(w)
+		}
+
+	case "SET":
+		s.set(w, args)
+
+	case "DEL", "EXISTS":
+		if len(args) < 2 {
+			writeError(w, fmt.Sprintf(errWrongArgs, strings.ToLower(cmd)))
+			return
+		}
+		s.mu.Lock()
+		var n int64
+		for _, key := range args[1:] {
+			if _, ok := s.lookup(key); ok {
+				n++
+				if cmd == "DEL" {
+					s.remove(key)
+				}
+			}
+		}
+		s.mu.Unlock()
+		writeInt(w, n)
+
+	case "INCR", "DECR", "INCRBY":
+		delta := map[string]int64{"INCR": 1, "DECR": -1}[cmd]
+		if cmd == "INCRBY" {
+			if !arity(3) {
+				return
+			}
+			var err error
+			if delta, err = strconv.ParseInt(args[2], 10, 64); err != nil {
+				writeError(w, errNotInt)
+				return
+			}
+		} else if !arity(2) {
+			return
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		// Read-modify-write under one lock: this is what makes INCR
+		// atomic, where GET then SET from two clients would lose updates
+		e, _ := s.lookup(args[1])
+		n, err := strconv.ParseInt(orDefault(e.value, "0"), 10, 64)
+		if err != nil {
+			writeError(w, errNotInt)
+			return
+		}
+		if (delta > 0 && n > maxInt64-delta) || (delta < 0 && n < minInt64-delta) {
+			writeError(w, "ERR increment or decrement would overflow")
+			return
+		}
+		n += delta
+		e.value = strconv.FormatInt(n, 10) // keeps any existing TTL
+		s.put(args[1], e)
+		writeInt(w, n)
+
+	case "EXPIRE", "PEXPIRE":
+		if !arity(3) {
+			return
+		}
+		n, err := strconv.ParseInt(args[2], 10, 64)
+		if err != nil {
+			writeError(w, errNotInt)
+			return
+		}
+		unit := time.Second
+		if cmd == "PEXPIRE" {
+			unit = time.Millisecond
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		e, ok := s.lookup(args[1])
+		if !ok {
+			writeInt(w, 0)
+			return
+		}
+		if n <= 0 {
+			s.remove(args[1]) // a TTL in the past deletes the key
+		} else {
+			e.expireAt = s.now().Add(time.Duration(n) * unit)
+			s.put(args[1], e)
+		}
+		writeInt(w, 1)
+
+	case "TTL", "PTTL":
+		if !arity(2) {
+			return
+		}
+		s.mu.Lock()
+		e, ok := s.lookup(args[1])
+		now := s.now()
+		s.mu.Unlock()
+		switch {
+		case !ok:
+			writeInt(w, -2) // no such key
+		case e.expireAt.IsZero():
+			writeInt(w, -1) // key exists, no TTL
+		case cmd == "TTL":
+			// Round up, as Redis does: 1.5s left reports 2, not 1
+			writeInt(w, int64((e.expireAt.Sub(now)+time.Second-1)/time.Second))
+		default:
+			writeInt(w, e.expireAt.Sub(now).Milliseconds())
+		}
+
+	case "PERSIST":
+		if !arity(2) {
+			return
+		}
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		e, ok := s.lookup(args[1])
+		if !ok || e.expireAt.IsZero() {
+			writeInt(w, 0)
+			return
+		}
+		e.expireAt = time.Time{}
+		s.put(args[1], e)
+		writeInt(w, 1)
+
+	case "DBSIZE":
+		s.mu.Lock()
+		n := len(s.data) // may count expired keys not yet swept, like Redis
+		s.mu.Unlock()
+		writeInt(w, int64(n))
+
+	case "FLUSHALL":
+		s.mu.Lock()
+		s.data, s.volatile = map[string]entry{}, map[string]struct{}{}
+		s.mu.Unlock()
+		writeSimple(w, "OK")
+
+	default:
+		writeError(w, fmt.Sprintf("ERR unknown command '%s'", args[0]))
+	}
+}
+
+const (
+	maxInt64 = 1<<63 - 1
+	minInt64 = -1 << 63
+)
+
+// orDefault returns s, or def if s is empty
+func orDefault(s, def string) string {
+	if s == "" {
+		return def
+	}
+	return s
+}
+
+// set handles SET key value [EX seconds | PX milliseconds] [NX | XX]
+func (s *Store) set(w *bufio.Writer, args []string) {
+	if len(args) < 3 {
+		writeError(w, fmt.Sprintf(errWrongArgs, "set"))
+		return
+	}
+	key, e := args[1], entry{value: args[2]}
+	var nx, xx bool
+	for i := 3; i < len(args); i++ {
+		switch opt := strings.ToUpper(args[i]); opt {
+		case "NX":
+			nx = true
+		case "XX":
+			xx = true
+		case "EX", "PX":
+			if i+1 == len(args) || !e.expireAt.IsZero() {
+				writeError(w, errSyntax)
+				return
+			}
+			n, err := strconv.ParseInt(args[i+1], 10, 64)
+			if err != nil || n <= 0 {
+				writeError(w, "ERR invalid expire time in 'set' command")
+				return
+			}
+			unit := time.Second
+			if opt == "PX" {
+				unit = time.Millisecond
+			}
+			e.expireAt = s.now().Add(time.Duration(n) * unit)
+			i++
+		default:
+			writeError(w, errSyntax)
+			return
+		}
+	}
+	if nx && xx {
+		writeError(w, errSyntax)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	// NX (only if absent) is the building block for simple locks:
+	// SET lock token NX PX 30000
+	if _, exists := s.lookup(key); (nx && exists) || (xx && !exists) {
+		writeNil(w)
+		return
+	}
+	s.put(key, e) // a plain SET clears any previous TTL
+	writeSimple(w, "OK")
+}
+
+// ============================================================
+// Server
+// ============================================================
+
+func serve(ln net.Listener, store *Store) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			log.Printf("accept: %v", err)
+			return
+		}
+		go handleConn(conn, store)
+	}
+}
+
+func handleConn(conn net.Conn, store *Store) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+	for {
+		args, err := readCommand(r)
+		if errors.Is(err, errProtocol) {
+			// Like Redis: report it, then drop the connection, since we
+			// no longer know where the next command starts
+			writeError(w, "ERR "+err.Error())
+			w.Flush()
+			return
+		}
+		if err != nil {
+			return
+		}
+		if len(args) == 0 {
+			continue
+		}
+		if strings.EqualFold(args[0], "QUIT") {
+			writeSimple(w, "OK")
+			w.Flush()
+			return
+		}
+		store.Execute(w, args)
+
+		// Pipelining: if the client sent several commands at once they
+		// are already buffered; answer them all, then flush once
+		if r.Buffered() == 0 {
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// ============================================================
+// Demo client
+// ============================================================
+
+// client is the minimum needed to send commands and read replies
+type client struct {
+	conn net.Conn
+	r    *bufio.Reader
+}
+
+func (c *client) send(args ...string) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, a := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(a), a)
+	}
+	c.conn.Write([]byte(b.String()))
+}
+
+// reply reads one reply and renders it the way redis-cli does
+func (c *client) reply() string {
+	line, err := readLine(c.r)
+	if err != nil {
+		return "read error: " + err.Error()
+	}
+	switch line[0] {
+	case '+':
+		return line[1:]
+	case '-':
+		return "(error) " + line[1:]
+	case ':':
+		return "(integer) " + line[1:]
+	case '$':
+		n, _ := strconv.Atoi(line[1:])
+		if n < 0 {
+			return "(nil)"
+		}
+		buf := make([]byte, n+2)
+		io.ReadFull(c.r, buf)
+		return strconv.Quote(string(buf[:n]))
+	case '*':
+		n, _ := strconv.Atoi(line[1:])
+		items := make([]string, n)
+		for i := range n {
+			items[i] = c.reply()
+		}
+		return "[" + strings.Join(items, ", ") + "]"
+	}
+	return "unexpected reply " + strconv.Quote(line)
+}
+
+func (c *client) do(args ...string) {
+	c.send(args...)
+	fmt.Printf("> %-32s %s\n", strings.Join(args, " "), c.reply())
+}
+
+func demo() {
+	conn, err := net.Dial("tcp", listenAddr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer conn.Close()
+	c := &client{conn: conn, r: bufio.NewReader(conn)}
+
+	fmt.Println("=== Strings and counters ===")
+	c.do("PING")
+	c.do("SET", "greeting", "hello world")
+	c.do("GET", "greeting")
+	c.do("GET", "missing")
+	c.do("INCR", "hits")
+	c.do("INCRBY", "hits", "41")
+	c.do("INCR", "greeting")
+	c.do("SET", "lock", "me", "NX")
+	c.do("SET", "lock", "you", "NX")
+	c.do("EXISTS", "greeting", "lock", "missing")
+	c.do("DEL", "greeting", "missing")
+	c.do("FROB")
+
+	fmt.Println()
+	fmt.Println("=== Expiry ===")
+	c.do("SET", "session", "abc", "PX", "300")
+	c.do("PTTL", "session")
+	c.do("TTL", "hits")
+	c.do("EXPIRE", "hits", "100")
+	c.do("TTL", "hits")
+	c.do("PERSIST", "hits")
+	c.do("TTL", "hits")
+	time.Sleep(400 * time.Millisecond)
+	c.do("GET", "session")
+	c.do("TTL", "session")
+
+	fmt.Println()
+	fmt.Println("=== Active expiry: keys nobody reads again ===")
+	for i := range 1000 {
+		c.send("SET", fmt.Sprintf("tmp:%d", i), "x", "PX", strconv.Itoa(50+rand.IntN(100)))
+	}
+	for range 1000 {
+		c.reply() // all 1000 were pipelined: one write, replies read after
+	}
+	c.do("DBSIZE")
+	time.Sleep(500 * time.Millisecond)
+	c.do("DBSIZE") // the sweeper freed them without anyone calling GET
+}
+
+func main() {
+	store := NewStore()
+	stop := make(chan struct{})
+	defer close(stop)
+	go store.RunSweeper(100*time.Millisecond, stop)
+
+	ln, err := net.Listen("tcp", listenAddr)
+	if err != nil {
+		log.Fatal(err)
+	}
+	log.Printf("RESP server on %s (try: redis-cli -p 6380)", listenAddr)
+
+	if len(os.Args) > 1 && os.Args[1] == "server" {
+		serve(ln, store)
+		return
+	}
+	go serve(ln, store)
+	demo()
+}
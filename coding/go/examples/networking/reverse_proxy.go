@@ -0,0 +1,298 @@
+// Reverse Proxy - Load balancing with health checks
+//
+// A load balancer in front of three toy backends, built on
+// net/http/httputil.ReverseProxy:
+// - Two strategies: round-robin, and least-connections (send each
+//   request to the backend with the fewest in flight)
+// - Active health checks: poll /health, eject a backend after it
+//   fails, readmit it when it recovers
+// - Passive health checks: a failed proxied request ejects at once
+// - Header rewriting: X-Forwarded-For/-Host/-Proto so backends see
+//   the real client, plus a header identifying the proxy
+//
+// Backend 3 is deliberately slow. Under round-robin it still gets a
+// third of the traffic and requests queue on it; least-connections
+// notices it's busy and sends it less.
+//
+// Usage:
+//   go run reverse_proxy.go                      # round-robin
+//   go run reverse_proxy.go -strategy leastconn  # least-connections
+//
+// The demo drives traffic itself, kills and revives backend 2, then
+// keeps serving so you can try:
+//   curl -H 'X-Forwarded-For: 203.0.113.7' http://localhost:8080/
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"os/signal"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ============================================================
+// Backends and pool
+// ============================================================
+
+// Backend is one upstream server as the proxy sees it
+type Backend struct {
+	URL   *url.URL
+	proxy *httputil.ReverseProxy
+
+	alive  atomic.Bool
+	active atomic.Int64 // requests in flight right now
+	served atomic.Int64 // requests completed, for the demo output
+}
+
+// Pool picks a live backend for each request
+type Pool struct {
+	backends []*Backend
+	strategy string
+	next     atomic.Uint64 // round-robin cursor
+}
+
+func NewPool(strategy string, targets ...string) (*Pool, error) {
+	p := &Pool{strategy: strategy}
+	for _, t := range targets {
+		u, err := url.Parse(t)
+		if err != nil {
+			return nil, err
+		}
+		b := &Backend{URL: u}
+		b.alive.Store(true)
+		b.proxy = &httputil.ReverseProxy{
+			// Rewrite (Go 1.20+) replaces the older Director hook. The
+			// inbound request is read-only; we edit the outbound copy.
+			Rewrite: func(r *httputil.ProxyRequest) {
+				r.SetURL(u)
+				// With Rewrite, incoming X-Forwarded-* headers are already
+				// stripped from r.Out - a client can put anything there.
+				// SetXForwarded sets them from what the proxy saw: the
+				// client IP, the original Host and the scheme. Behind a
+				// trusted proxy, copy r.In's X-Forwarded-For first to
+				// append to it instead.
+				r.SetXForwarded()
+				r.Out.Header.Set("X-Proxy", "go-labs-lb")
+				r.Out.Host = r.In.Host // keep the original Host header
+			},
+			// Passive health check: if the backend can't be reached,
+			// take it out now rather than at the next poll. A client
+			// hanging up cancels the request too, and that says nothing
+			// about the backend
+			ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+				clientGone := errors.Is(err, context.Canceled) || r.Context().Err() != nil
+				if !clientGone && b.alive.Swap(false) {
+					log.Printf("backend %s failed a request, ejecting: %v", u.Host, err)
+				}
+				http.Error(w, "bad gateway", http.StatusBadGateway)
+			},
+		}
+		p.backends = append(p.backends, b)
+	}
+	return p, nil
+}
+
+// pick returns a live backend, or nil if all are down
+func (p *Pool) pick() *Backend {
+	switch p.strategy {
+	case "leastconn":
+		var best *Backend
+		for _, b := range p.backends {
+			if b.alive.Load() && (best == nil || b.active.Load() < best.active.Load()) {
+				best = b
+			}
+		}
+		return best
+	default: // roundrobin: start after the last pick, skip dead ones
+		n := uint64(len(p.backends))
+		start := p.next.Add(1)
+		for i := range n {
+			b := p.backends[(start+i)%n]
+			if b.alive.Load() {
+				return b
+			}
+		}
+		return nil
+	}
+}
+
+func (p *Pool) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	b := p.pick()
+	if b == nil {
+		http.Error(w, "no healthy backends", http.StatusServiceUnavailable)
+		return
+	}
+	b.active.Add(1)
+	defer func() {
+		b.active.Add(-1)
+		b.served.Add(1)
+	}()
+	b.proxy.ServeHTTP(w, r)
+}
+
+// HealthCheck polls every backend's /health until ctx is done. It's
+// what brings an ejected backend back.
+func (p *Pool) HealthCheck(ctx context.Context, interval time.Duration) {
+	client := &http.Client{Timeout: interval / 2}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		for _, b := range p.backends {
+			ok := false
+			resp, err := client.Get(b.URL.JoinPath("/health").String())
+			if err == nil {
+				ok = resp.StatusCode == http.StatusOK
+				resp.Body.Close()
+			}
+			if was := b.alive.Swap(ok); was != ok {
+				log.Printf("backend %s is now %s", b.URL.Host, map[bool]string{true: "UP", false: "DOWN"}[ok])
+			}
+		}
+	}
+}
+
+// ============================================================
+// Toy backends
+// ============================================================
+
+// startBackend runs a backend on addr that answers after delay. It
+// returns the server so the demo can stop it.
+func startBackend(name, addr string, delay time.Duration) *http.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(delay)
+		fmt.Fprintf(w, "%s: path=%s host=%s xff=%q proxy=%q\n", name, r.URL.Path, r.Host,
+			r.Header.Get("X-Forwarded-For"), r.Header.Get("X-Proxy"))
+	})
+
+	srv := &http.Server{Addr: addr, Handler: mux}
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		log.Fatalf("backend %s: %v", name, err)
+	}
+	go func() {
+		if err := srv.Serve(ln); !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("backend %s: %v", name, err)
+		}
+	}()
+	return srv
+}
+
+// ============================================================
+// Demo
+// ============================================================
+
+// drive sends n requests, concurrency at a time, and prints how many
+// each backend served
+func drive(label, proxyURL string, pool *Pool, n, concurrency int) {
+	before := make([]int64, len(pool.backends))
+	for i, b := range pool.backends {
+		before[i] = b.served.Load()
+	}
+
+	var failed atomic.Int64
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	start := time.Now()
+	for range n {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			resp, err := http.Get(proxyURL)
+			if err != nil || resp.StatusCode != http.StatusOK {
+				failed.Add(1)
+			}
+			if err == nil {
+				resp.Body.Close()
+			}
+		}()
+	}
+	wg.Wait()
+
+	fmt.Printf("%-28s", label)
+	for i, b := range pool.backends {
+		fmt.Printf(" %s=%-3d", b.URL.Port(), b.served.Load()-before[i])
+	}
+	fmt.Printf(" failed=%d  (%v)\n", failed.Load(), time.Since(start).Round(10*time.Millisecond))
+}
+
+func main() {
+	strategy := flag.String("strategy", "roundrobin", "roundrobin or leastconn")
+	flag.Parse()
+
+	startBackend("backend-1", "127.0.0.1:9001", 10*time.Millisecond)
+	b2 := startBackend("backend-2", "127.0.0.1:9002", 10*time.Millisecond)
+	startBackend("backend-3", "127.0.0.1:9003", 100*time.Millisecond) // the slow one
+
+	pool, err := NewPool(*strategy, "http://127.0.0.1:9001", "http://127.0.0.1:9002", "http://127.0.0.1:9003")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	go pool.HealthCheck(ctx, time.Second)
+
+	proxy := &http.Server{Addr: "127.0.0.1:8080", Handler: pool}
+	go func() {
+		if err := proxy.ListenAndServe(); !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal(err)
+		}
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	const proxyURL = "http://127.0.0.1:8080/"
+	fmt.Printf("strategy: %s\n\n", *strategy)
+
+	drive("all healthy:", proxyURL, pool, 90, 6)
+
+	// Kill backend 2. The first request routed to it fails and the
+	// passive check ejects it; the active check would catch it within
+	// a second anyway.
+	b2.Close()
+	drive("backend 2 killed:", proxyURL, pool, 60, 6)
+	drive("backend 2 ejected:", proxyURL, pool, 60, 6)
+
+	// Bring it back on the same port; the next health poll readmits it
+	startBackend("backend-2", "127.0.0.1:9002", 10*time.Millisecond)
+	time.Sleep(1500 * time.Millisecond)
+	drive("backend 2 revived:", proxyURL, pool, 60, 6)
+
+	// One request with a spoofed X-Forwarded-For: SetXForwarded
+	// replaces it with the address the proxy actually saw
+	req, _ := http.NewRequest(http.MethodGet, proxyURL+"whoami", nil)
+	req.Header.Set("X-Forwarded-For", "203.0.113.7")
+	if resp, err := http.DefaultClient.Do(req); err == nil {
+		var buf [256]byte
+		n, _ := resp.Body.Read(buf[:])
+		resp.Body.Close()
+		fmt.Printf("\nheaders seen by backend: %s", buf[:n])
+	}
+
+	fmt.Println("\nProxy running on http://localhost:8080; Ctrl+C to exit")
+	<-ctx.Done()
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	proxy.Shutdown(shutdownCtx)
+}
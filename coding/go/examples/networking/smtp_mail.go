@@ -0,0 +1,487 @@
+// SMTP - Sending mail, MX lookup and a debug sink
+//
+// SMTP (RFC 5321) is a line-based text protocol: the client sends a
+// command, the server answers with a 3-digit code. This example shows
+// it from three angles:
+// - A debug sink: an SMTP server that accepts everything and prints
+//   the messages instead of delivering them, for testing
+// - A hand-rolled client that speaks the dialogue over a raw TCP
+//   connection, printing every line (C: client, S: server)
+// - The same send through net/smtp, the way you'd do it in real code
+// - MX lookup: which servers accept mail for a domain, in preference
+//   order, with the RFC 5321 fallbacks (no MX -> use the A record;
+//   "null MX" -> the domain accepts no mail)
+//
+// Usage:
+//   go run smtp_mail.go                     # sink + both clients + MX lookup
+//   go run smtp_mail.go sink                # just the sink on :2525
+//   go run smtp_mail.go mx gmail.com        # MX lookup
+//   go run smtp_mail.go send -to bob@example.test -subject hi -body 'hello'
+//
+// Point any mail-sending app at localhost:2525 to see what it sends,
+// or talk to the sink yourself:
+//   nc localhost 2525
+//
+// Sending to real MX hosts (send -mx) needs outbound port 25, which
+// most ISPs and cloud providers block; use a provider's submission
+// port (587, with STARTTLS and AUTH) for real mail.
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"encoding/base64"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"net/smtp"
+	"os"
+	"slices"
+	"strings"
+	"time"
+)
+
+const sinkAddr = "127.0.0.1:2525"
+
+// maxMessageSize is advertised with the SIZE extension and enforced
+const maxMessageSize = 1 << 20
+
+// ============================================================
+// Debug sink server
+// ============================================================
+
+// Mail is one accepted message
+type Mail struct {
+	From string
+	To   []string
+	Data string
+}
+
+// Sink accepts mail and hands it to OnMail instead of delivering it
+type Sink struct {
+	Hostname string
+	OnMail   func(Mail)
+}
+
+func (s *Sink) ListenAndServe(addr string) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				log.Printf("sink: %v", err)
+				return
+			}
+			go s.handle(conn)
+		}
+	}()
+	return nil
+}
+
+// handle runs one SMTP session. The states are implicit in which
+// fields are set: greeted, then a sender, then recipients, then DATA.
+func (s *Sink) handle(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(code int, lines ...string) {
+		// Multi-line replies use "250-" on every line but the last
+		for i, l := range lines {
+			sep := "-"
+			if i == len(lines)-1 {
+				sep = " "
+			}
+			fmt.Fprintf(conn, "%d%s%s\r\n", code, sep, l)
+		}
+	}
+
+	reply(220, s.Hostname+" ESMTP debug sink ready")
+	greeted := false
+	var mail *Mail
+	for {
+		conn.SetReadDeadline(time.Now().Add(5 * time.Minute))
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+		verb, arg, _ := strings.Cut(line, " ")
+
+		switch strings.ToUpper(verb) {
+		case "HELO":
+			greeted = true
+			reply(250, s.Hostname)
+		case "EHLO":
+			// EHLO lists the extensions we support, one per line
+			greeted = true
+			reply(250, s.Hostname+" greets "+arg, fmt.Sprintf("SIZE %d", maxMessageSize), "8BITMIME", "AUTH PLAIN")
+		case "AUTH":
+			// AUTH PLAIN <base64("\x00user\x00pass")>. A sink takes any
+			// credentials; it only decodes them to show what was sent.
+			mech, resp, _ := strings.Cut(arg, " ")
+			creds, err := base64.StdEncoding.DecodeString(resp)
+			parts := strings.Split(string(creds), "\x00")
+			if !strings.EqualFold(mech, "PLAIN") || err != nil || len(parts) != 3 {
+				reply(504, "5.5.4 only AUTH PLAIN with an initial response")
+				continue
+			}
+			log.Printf("sink: AUTH PLAIN as %q", parts[1])
+			reply(235, "2.7.0 authentication successful")
+		case "MAIL":
+			if !greeted {
+				reply(503, "5.5.1 say HELO/EHLO first")
+				continue
+			}
+			from, ok := parsePath(arg, "FROM:")
+			if !ok {
+				reply(501, "5.5.4 syntax: MAIL FROM:<address>")
+				continue
+			}
+			mail = &Mail{From: from}
+			reply(250, "2.1.0 sender ok")
+		case "RCPT":
+			if mail == nil {
+				reply(503, "5.5.1 need MAIL first")
+				continue
+			}
+			to, ok := parsePath(arg, "TO:")
+			if !ok || to == "" {
+				reply(501, "5.5.4 syntax: RCPT TO:<address>")
+				continue
+			}
+			mail.To = append(mail.To, to)
+			reply(250, "2.1.5 recipient ok")
+		case "DATA":
+			if mail == nil || len(mail.To) == 0 {
+				reply(503, "5.5.1 need RCPT first")
+				continue
+			}
+			reply(354, "end data with <CR><LF>.<CR><LF>")
+			data, err := readData(r)
+			if errors.Is(err, errTooBig) {
+				reply(552, "5.3.4 message too big")
+				mail = nil
+				continue
+			}
+			if err != nil {
+				return
+			}
+			mail.Data = data
+			if s.OnMail != nil {
+				s.OnMail(*mail)
+			}
+			reply(250, "2.0.0 queued (not really: this is a sink)")
+			mail = nil
+		case "RSET":
+			mail = nil
+			reply(250, "2.0.0 reset")
+		case "NOOP":
+			reply(250, "2.0.0 ok")
+		case "QUIT":
+			reply(221, "2.0.0 bye")
+			return
+		default:
+			reply(502, "5.5.2 command not implemented")
+		}
+	}
+}
+
+// parsePath extracts the address from "FROM:<a@b> SIZE=123"
+func parsePath(arg, prefix string) (string, bool) {
+	if len(arg) < len(prefix) || !strings.EqualFold(arg[:len(prefix)], prefix) {
+		return "", false
+	}
+	rest := strings.TrimSpace(arg[len(prefix):])
+	start, end := strings.IndexByte(rest, '<'), strings.IndexByte(rest, '>')
+	if start != 0 || end < 0 {
+		return "", false
+	}
+	return rest[1:end], true // "" is valid for FROM: the null sender, used by bounces
+}
+
+var errTooBig = errors.New("message too big")
+
+// readData reads the message body up to the lone "." line, undoing
+// dot-stuffing: the client doubles any leading "." so a line that is
+// just "." inside the message can't end it early
+func readData(r *bufio.Reader) (string, error) {
+	var b strings.Builder
+	tooBig := false
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return "", err
+		}
+		if line == ".\r\n" || line == ".\n" {
+			break
+		}
+		line = strings.TrimPrefix(line, ".")
+		if b.Len()+len(line) > maxMessageSize {
+			tooBig = true // keep reading to the end so the session stays in sync
+			continue
+		}
+		b.WriteString(line)
+	}
+	if tooBig {
+		return "", errTooBig
+	}
+	return b.String(), nil
+}
+
+func printMail(m Mail) {
+	fmt.Printf("----- sink received: from=<%s> to=%v -----\n", m.From, m.To)
+	fmt.Print(strings.ReplaceAll(m.Data, "\r\n", "\n"))
+	fmt.Println("-----")
+}
+
+// ============================================================
+// Building a message
+// ============================================================
+
+// buildMessage writes the headers and body. The envelope (MAIL FROM,
+// RCPT TO) decides delivery; these headers are only what the reader's
+// mail client displays - that is why Bcc never appears here.
+func buildMessage(from string, to []string, subject, body string) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\n", from)
+	fmt.Fprintf(&b, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&b, "Subject: %s\r\n", subject)
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&b, "Message-ID: <%d@go-labs.example>\r\n", time.Now().UnixNano())
+	b.WriteString("MIME-Version: 1.0\r\n")
+	b.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	b.WriteString("\r\n") // blank line: headers end, body starts
+	// SMTP lines end in CRLF, whatever the body used
+	b.WriteString(strings.ReplaceAll(strings.ReplaceAll(body, "\r\n", "\n"), "\n", "\r\n"))
+	b.WriteString("\r\n")
+	return []byte(b.String())
+}
+
+// ============================================================
+// Hand-rolled client
+// ============================================================
+
+// rawSend speaks SMTP over a plain TCP connection and prints the
+// whole dialogue
+func rawSend(addr, from string, to []string, msg []byte) error {
+	conn, err := net.DialTimeout("tcp", addr, 5*time.Second)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(30 * time.Second))
+	r := bufio.NewReader(conn)
+
+	// expect reads one reply (all of its lines) and checks the code
+	expect := func(want int) error {
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return err
+			}
+			line = strings.TrimRight(line, "\r\n")
+			fmt.Println("S:", line)
+			var code int
+			if _, err := fmt.Sscanf(line, "%3d", &code); err != nil {
+				return fmt.Errorf("bad reply %q", line)
+			}
+			if len(line) > 3 && line[3] == '-' {
+				continue // more lines follow
+			}
+			if code != want {
+				return fmt.Errorf("expected %d, got %q", want, line)
+			}
+			return nil
+		}
+	}
+	send := func(cmd string, want int) error {
+		fmt.Println("C:", cmd)
+		fmt.Fprintf(conn, "%s\r\n", cmd)
+		return expect(want)
+	}
+
+	if err := expect(220); err != nil {
+		return err
+	}
+	type step struct {
+		cmd  string
+		want int
+	}
+	steps := []step{{"EHLO client.example", 250}, {"MAIL FROM:<" + from + ">", 250}}
+	for _, rcpt := range to {
+		steps = append(steps, step{"RCPT TO:<" + rcpt + ">", 250})
+	}
+	steps = append(steps, step{"DATA", 354})
+	for _, s := range steps {
+		if err := send(s.cmd, s.want); err != nil {
+			return err
+		}
+	}
+
+	// Body, dot-stuffed, then the terminating "."
+	for _, line := range strings.SplitAfter(string(msg), "\r\n") {
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, ".") {
+			line = "." + line
+		}
+		fmt.Println("C:", strings.TrimRight(line, "\r\n"))
+		conn.Write([]byte(line))
+	}
+	if err := send(".", 250); err != nil {
+		return err
+	}
+	return send("QUIT", 221)
+}
+
+// ============================================================
+// MX lookup
+// ============================================================
+
+// mailHosts returns the hosts to try for domain, best first
+func mailHosts(domain string) ([]string, error) {
+	mxs, err := net.LookupMX(domain)
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) && dnsErr.IsNotFound {
+		// No MX records: RFC 5321 says use the domain itself (its A/AAAA)
+		if _, err := net.LookupHost(domain); err != nil {
+			return nil, fmt.Errorf("%s has no MX and no address: %w", domain, err)
+		}
+		return []string{domain}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	// A single MX of "." is a "null MX" (RFC 7505): no mail, ever
+	if len(mxs) == 1 && mxs[0].Host == "." {
+		return nil, fmt.Errorf("%s does not accept mail (null MX)", domain)
+	}
+	// Lower preference wins. LookupMX already sorts, but the order
+	// among equal preferences is random, which spreads the load.
+	slices.SortStableFunc(mxs, func(a, b *net.MX) int { return cmp.Compare(a.Pref, b.Pref) })
+	hosts := make([]string, len(mxs))
+	for i, mx := range mxs {
+		hosts[i] = strings.TrimSuffix(mx.Host, ".")
+	}
+	return hosts, nil
+}
+
+func printMX(domain string) {
+	mxs, err := net.LookupMX(domain)
+	if err != nil {
+		fmt.Printf("LookupMX(%s): %v\n", domain, err)
+	}
+	for _, mx := range mxs {
+		fmt.Printf("  pref %-3d %s\n", mx.Pref, mx.Host)
+	}
+	hosts, err := mailHosts(domain)
+	if err != nil {
+		fmt.Printf("  -> %v\n", err)
+		return
+	}
+	fmt.Printf("  -> would try, in order: %s (port 25)\n", strings.Join(hosts, ", "))
+}
+
+// ============================================================
+// main
+// ============================================================
+
+func main() {
+	if len(os.Args) < 2 {
+		demo()
+		return
+	}
+	switch os.Args[1] {
+	case "sink":
+		sink := &Sink{Hostname: "sink.localhost", OnMail: printMail}
+		if err := sink.ListenAndServe(sinkAddr); err != nil {
+			log.Fatal(err)
+		}
+		log.Printf("debug SMTP sink on %s", sinkAddr)
+		select {}
+	case "mx":
+		if len(os.Args) != 3 {
+			log.Fatal("usage: mx DOMAIN")
+		}
+		printMX(os.Args[2])
+	case "send":
+		sendCmd(os.Args[2:])
+	default:
+		log.Fatalf("unknown command %q (want sink, mx or send)", os.Args[1])
+	}
+}
+
+func sendCmd(args []string) {
+	fs := flag.NewFlagSet("send", flag.ExitOnError)
+	server := fs.String("server", sinkAddr, "SMTP server host:port")
+	viaMX := fs.Bool("mx", false, "deliver directly to the recipient domain's MX on port 25")
+	from := fs.String("from", "alice@example.test", "envelope sender")
+	to := fs.String("to", "bob@example.test", "recipient")
+	subject := fs.String("subject", "Hello from Go", "subject")
+	body := fs.String("body", "Sent with net/smtp.", "body text")
+	fs.Parse(args)
+
+	addr := *server
+	if *viaMX {
+		_, domain, ok := strings.Cut(*to, "@")
+		if !ok {
+			log.Fatalf("bad recipient %q", *to)
+		}
+		hosts, err := mailHosts(domain)
+		if err != nil {
+			log.Fatal(err)
+		}
+		addr = net.JoinHostPort(hosts[0], "25") // real MTAs fall back to the next host on failure
+	}
+
+	msg := buildMessage(*from, []string{*to}, *subject, *body)
+	if err := smtp.SendMail(addr, nil, *from, []string{*to}, msg); err != nil {
+		log.Fatalf("send via %s: %v", addr, err)
+	}
+	fmt.Printf("sent to %s via %s\n", *to, addr)
+}
+
+func demo() {
+	sink := &Sink{Hostname: "sink.localhost", OnMail: printMail}
+	if err := sink.ListenAndServe(sinkAddr); err != nil {
+		log.Fatal(err)
+	}
+	log.SetOutput(os.Stdout)
+
+	fmt.Println("=== The SMTP dialogue, by hand ===")
+	msg := buildMessage("alice@example.test", []string{"bob@example.test"}, "Raw SMTP",
+		"Hi Bob,\n.\nThat dot above is dot-stuffed on the wire.\n")
+	if err := rawSend(sinkAddr, "alice@example.test", []string{"bob@example.test"}, msg); err != nil {
+		log.Fatalf("raw send: %v", err)
+	}
+
+	fmt.Println()
+	fmt.Println("=== net/smtp ===")
+	// smtp.SendMail does EHLO, STARTTLS if offered, AUTH if given,
+	// MAIL/RCPT/DATA and dot-stuffing. PlainAuth refuses to send the
+	// password over an unencrypted connection unless the server is
+	// localhost - the sink is, so this works here.
+	auth := smtp.PlainAuth("", "alice", "secret", "127.0.0.1")
+	to := []string{"bob@example.test", "carol@example.test"}
+	msg = buildMessage("alice@example.test", to, "Via net/smtp", "Two recipients, one DATA.\n")
+	if err := smtp.SendMail(sinkAddr, auth, "alice@example.test", to, msg); err != nil {
+		log.Fatalf("SendMail: %v", err)
+	}
+
+	// Errors come back as *textproto.Error carrying the reply code
+	err := smtp.SendMail(sinkAddr, nil, "alice@example.test", []string{""}, msg)
+	fmt.Printf("bad recipient: %v\n", err)
+
+	fmt.Println()
+	fmt.Println("=== MX lookup ===")
+	// Needs working DNS; in a sandbox without network these just fail
+	for _, domain := range []string{"gmail.com", "example.com"} {
+		fmt.Printf("%s:\n", domain)
+		printMX(domain)
+	}
+}
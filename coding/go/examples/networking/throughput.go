@@ -0,0 +1,508 @@
+// Throughput Tester - An iperf-like bandwidth measurement tool
+//
+// A client streams data to a server for a fixed time and both report
+// what got through:
+// - TCP mode: send as fast as the connection allows and measure
+//   goodput (application bytes delivered per second). Retransmits and
+//   headers are invisible here - TCP hides them, which is the point
+// - UDP mode: send at a fixed bitrate; every datagram carries a
+//   sequence number and a send timestamp, so the server can count
+//   loss and reordering and compute jitter the way RTP does (RFC 3550)
+// - Adjustable write size (-l) and socket buffers (-w), the two knobs
+//   that matter most for throughput
+// - Per-interval reports while running, and a summary from both ends
+//
+// Usage:
+//   go run throughput.go                            # server + TCP and UDP runs on loopback
+//   go run throughput.go server                     # on the receiving host
+//   go run throughput.go client -c HOST             # TCP, 10s
+//   go run throughput.go client -c HOST -u -b 50M   # UDP at 50 Mbit/s
+//   go run throughput.go client -c HOST -l 1K -w 64K -t 5s
+//
+// Loopback numbers mostly measure memory bandwidth and syscall cost;
+// run the two ends on different hosts to measure a network.
+package main
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultPort = "5201" // same as iperf3
+
+// Report is what the server sends back at the end of a run
+type Report struct {
+	Bytes    int64         `json:"bytes"`
+	Duration time.Duration `json:"duration"`
+
+	// UDP only
+	Packets    int64   `json:"packets,omitempty"`
+	Lost       int64   `json:"lost,omitempty"`
+	OutOfOrder int64   `json:"out_of_order,omitempty"`
+	JitterMs   float64 `json:"jitter_ms,omitempty"`
+}
+
+// ============================================================
+// Units
+// ============================================================
+
+// parseSize reads 128K, 1M, 2G (powers of 1024) or plain bytes
+func parseSize(s string) (int64, error) {
+	if s == "" {
+		return 0, errors.New("empty size")
+	}
+	mult := int64(1)
+	switch strings.ToUpper(s[len(s)-1:]) {
+	case "K":
+		mult = 1 << 10
+	case "M":
+		mult = 1 << 20
+	case "G":
+		mult = 1 << 30
+	}
+	if mult > 1 {
+		s = s[:len(s)-1]
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	return n * mult, err
+}
+
+// parseRate reads 100M, 1G, 500K as bits per second. Network rates
+// use powers of 1000, unlike sizes.
+func parseRate(s string) (float64, error) {
+	if s == "" {
+		return 0, errors.New("empty rate")
+	}
+	mult := 1.0
+	switch strings.ToUpper(s[len(s)-1:]) {
+	case "K":
+		mult = 1e3
+	case "M":
+		mult = 1e6
+	case "G":
+		mult = 1e9
+	}
+	if mult > 1 {
+		s = s[:len(s)-1]
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	return n * mult, err
+}
+
+func mbps(bytes int64, d time.Duration) float64 {
+	return float64(bytes) * 8 / d.Seconds() / 1e6
+}
+
+func mbytes(bytes int64) float64 { return float64(bytes) / (1 << 20) }
+
+// ============================================================
+// Server
+// ============================================================
+
+func runServer(addr string, window int) error {
+	ln, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	pc, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return err
+	}
+	if window > 0 {
+		pc.(*net.UDPConn).SetReadBuffer(window)
+	}
+	log.Printf("server listening on %s (tcp and udp)", addr)
+
+	go serveUDP(pc)
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			return err
+		}
+		if window > 0 {
+			// The receive buffer bounds the TCP window the server
+			// advertises: too small and the sender sits idle waiting for
+			// ACKs on any link with real latency (bandwidth x delay)
+			conn.(*net.TCPConn).SetReadBuffer(window)
+		}
+		go serveTCP(conn)
+	}
+}
+
+// serveTCP reads until the client half-closes, then replies with a
+// JSON report on the same connection
+func serveTCP(conn net.Conn) {
+	defer conn.Close()
+	start := time.Now()
+	n, err := io.CopyBuffer(io.Discard, conn, make([]byte, 128<<10))
+	if err != nil {
+		log.Printf("tcp %s: %v", conn.RemoteAddr(), err)
+		return
+	}
+	rep := Report{Bytes: n, Duration: time.Since(start)}
+	log.Printf("tcp %s: received %.1f MB in %v = %.1f Mbit/s", conn.RemoteAddr(),
+		mbytes(rep.Bytes), rep.Duration.Round(time.Millisecond), mbps(rep.Bytes, rep.Duration))
+	json.NewEncoder(conn).Encode(rep)
+}
+
+// UDP datagram layout:
+//   0       8          16
+//   +-------+----------+-------------...
+//   |  seq  | sent(ns) | padding
+//   +-------+----------+-------------...
+// seq == finSeq marks the end of a run; the server answers it with
+// the report.
+const (
+	udpHeader = 16
+	finSeq    = math.MaxUint64
+)
+
+// udpStats tracks one sender
+type udpStats struct {
+	start, last time.Time
+	bytes       int64
+	packets     int64
+	maxSeq      uint64
+	outOfOrder  int64
+	jitter      float64 // seconds, smoothed
+	prevTransit float64
+	haveTransit bool
+}
+
+// add folds in one datagram. Jitter is the RFC 3550 estimator: the
+// mean deviation of the difference in transit time between
+// consecutive packets. Clock offset between hosts cancels out, since
+// only differences of transit times are used.
+func (s *udpStats) add(seq uint64, sent time.Time, size int, now time.Time) {
+	if s.packets == 0 {
+		s.start = now
+	}
+	s.last = now
+	s.packets++
+	s.bytes += int64(size)
+	if seq < s.maxSeq {
+		s.outOfOrder++
+	} else {
+		s.maxSeq = seq
+	}
+
+	transit := now.Sub(sent).Seconds()
+	if s.haveTransit {
+		d := math.Abs(transit - s.prevTransit)
+		s.jitter += (d - s.jitter) / 16
+	}
+	s.prevTransit, s.haveTransit = transit, true
+}
+
+func (s *udpStats) report() Report {
+	expected := int64(s.maxSeq) + 1
+	return Report{
+		Bytes:      s.bytes,
+		Duration:   s.last.Sub(s.start),
+		Packets:    s.packets,
+		Lost:       max(expected-s.packets, 0),
+		OutOfOrder: s.outOfOrder,
+		JitterMs:   s.jitter * 1000,
+	}
+}
+
+func serveUDP(pc net.PacketConn) {
+	senders := map[string]*udpStats{}
+	buf := make([]byte, 64<<10)
+	for {
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			log.Printf("udp: %v", err)
+			return
+		}
+		if n < udpHeader {
+			continue
+		}
+		now := time.Now()
+		seq := binary.BigEndian.Uint64(buf[0:])
+		sent := time.Unix(0, int64(binary.BigEndian.Uint64(buf[8:])))
+
+		key := addr.String()
+		st := senders[key]
+		if seq == finSeq {
+			// The client repeats FIN until it hears back, so answer
+			// late duplicates too, from the saved stats
+			if st == nil {
+				continue
+			}
+			rep := st.report()
+			data, _ := json.Marshal(rep)
+			pc.WriteTo(data, addr)
+			log.Printf("udp %s: %d packets, %d lost, jitter %.3f ms", key, rep.Packets, rep.Lost, rep.JitterMs)
+			continue
+		}
+		if st == nil || (seq == 0 && st.packets > 0) { // a new run from a reused port
+			st = &udpStats{}
+			senders[key] = st
+		}
+		st.add(seq, sent, n, now)
+	}
+}
+
+// ============================================================
+// Client
+// ============================================================
+
+// intervalReporter prints bytes sent per interval until stopped
+type intervalReporter struct {
+	mu    sync.Mutex
+	bytes int64
+}
+
+func (r *intervalReporter) add(n int) {
+	r.mu.Lock()
+	r.bytes += int64(n)
+	r.mu.Unlock()
+}
+
+func (r *intervalReporter) run(interval time.Duration, done <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	start, prev, prevBytes := time.Now(), time.Now(), int64(0)
+	for {
+		select {
+		case <-done:
+			return
+		case now := <-ticker.C:
+			r.mu.Lock()
+			total := r.bytes
+			r.mu.Unlock()
+			fmt.Printf("  [%4.1f-%4.1fs] %8.1f MB  %9.1f Mbit/s\n", prev.Sub(start).Seconds(), now.Sub(start).Seconds(),
+				mbytes(total-prevBytes), mbps(total-prevBytes, now.Sub(prev)))
+			prev, prevBytes = now, total
+		}
+	}
+}
+
+func runTCP(addr string, duration time.Duration, length, window int) (sent int64, rep Report, err error) {
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		return 0, rep, err
+	}
+	defer conn.Close()
+	tcp := conn.(*net.TCPConn)
+	if window > 0 {
+		tcp.SetWriteBuffer(window)
+	}
+
+	reporter := &intervalReporter{}
+	done := make(chan struct{})
+	go reporter.run(time.Second, done)
+
+	buf := make([]byte, length)
+	deadline := time.Now().Add(duration)
+	for time.Now().Before(deadline) {
+		n, err := tcp.Write(buf)
+		sent += int64(n)
+		reporter.add(n)
+		if err != nil {
+			close(done)
+			return sent, rep, err
+		}
+	}
+	close(done)
+
+	// Half-close: tells the server we're done, while leaving our read
+	// side open for its report
+	tcp.CloseWrite()
+	err = json.NewDecoder(bufio.NewReader(tcp)).Decode(&rep)
+	return sent, rep, err
+}
+
+func runUDP(addr string, duration time.Duration, length, window int, bitsPerSec float64) (sent int64, rep Report, err error) {
+	if length < udpHeader {
+		return 0, rep, fmt.Errorf("UDP length must be at least %d bytes", udpHeader)
+	}
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return 0, rep, err
+	}
+	defer conn.Close()
+	if window > 0 {
+		conn.(*net.UDPConn).SetWriteBuffer(window)
+	}
+
+	reporter := &intervalReporter{}
+	done := make(chan struct{})
+	go reporter.run(time.Second, done)
+
+	// Pace by the clock rather than sleeping a fixed gap per packet:
+	// sleeps overshoot, and this catches up after each one
+	gap := time.Duration(float64(length*8) / bitsPerSec * float64(time.Second))
+	buf := make([]byte, length)
+	start := time.Now()
+	var seq uint64
+	for time.Since(start) < duration {
+		if due := start.Add(time.Duration(seq) * gap); time.Until(due) > time.Millisecond {
+			time.Sleep(time.Until(due))
+		}
+		binary.BigEndian.PutUint64(buf[0:], seq)
+		binary.BigEndian.PutUint64(buf[8:], uint64(time.Now().UnixNano()))
+		if _, err := conn.Write(buf); err != nil {
+			// ENOBUFS and friends: the local queue is full. UDP has no
+			// backpressure, so a too-high -b shows up as loss
+			continue
+		}
+		seq++
+		sent += int64(length)
+		reporter.add(length)
+	}
+	close(done)
+
+	// FIN, repeated until the report arrives (FIN itself can be lost)
+	binary.BigEndian.PutUint64(buf[0:], finSeq)
+	reply := make([]byte, 4096)
+	for range 10 {
+		conn.Write(buf[:udpHeader])
+		conn.SetReadDeadline(time.Now().Add(250 * time.Millisecond))
+		n, err := conn.Read(reply)
+		if err == nil {
+			return sent, rep, json.Unmarshal(reply[:n], &rep)
+		}
+	}
+	return sent, rep, errors.New("no report from server")
+}
+
+func printSummary(proto string, sent int64, duration time.Duration, rep Report) {
+	fmt.Printf("  sender:   %8.1f MB  %9.1f Mbit/s\n", mbytes(sent), mbps(sent, duration))
+	fmt.Printf("  receiver: %8.1f MB  %9.1f Mbit/s\n", mbytes(rep.Bytes), mbps(rep.Bytes, rep.Duration))
+	if proto == "udp" {
+		lossPct := 0.0
+		if total := rep.Packets + rep.Lost; total > 0 {
+			lossPct = float64(rep.Lost) / float64(total) * 100
+		}
+		fmt.Printf("  datagrams: %d received, %d lost (%.2f%%), %d out of order, jitter %.3f ms\n",
+			rep.Packets, rep.Lost, lossPct, rep.OutOfOrder, rep.JitterMs)
+	}
+}
+
+// ============================================================
+// main
+// ============================================================
+
+type clientOptions struct {
+	addr     string
+	udp      bool
+	duration time.Duration
+	length   int
+	window   int
+	rate     float64
+}
+
+func runClient(o clientOptions) error {
+	proto := "tcp"
+	if o.udp {
+		proto = "udp"
+	}
+	fmt.Printf("%s to %s for %v, %d-byte writes", strings.ToUpper(proto), o.addr, o.duration, o.length)
+	if o.udp {
+		fmt.Printf(", target %.0f Mbit/s", o.rate/1e6)
+	}
+	fmt.Println()
+
+	var (
+		sent int64
+		rep  Report
+		err  error
+	)
+	if o.udp {
+		sent, rep, err = runUDP(o.addr, o.duration, o.length, o.window, o.rate)
+	} else {
+		sent, rep, err = runTCP(o.addr, o.duration, o.length, o.window)
+	}
+	if err != nil {
+		return err
+	}
+	printSummary(proto, sent, o.duration, rep)
+	return nil
+}
+
+func main() {
+	if len(os.Args) < 2 {
+		demo()
+		return
+	}
+
+	fs := flag.NewFlagSet(os.Args[1], flag.ExitOnError)
+	port := fs.String("p", defaultPort, "port")
+	host := fs.String("c", "127.0.0.1", "server host (client)")
+	udp := fs.Bool("u", false, "use UDP")
+	duration := fs.Duration("t", 10*time.Second, "test duration (client)")
+	length := fs.String("l", "", "write size (default 128K for TCP, 1400 for UDP)")
+	window := fs.String("w", "0", "socket buffer size, e.g. 256K (0 = OS default)")
+	rate := fs.String("b", "100M", "UDP target bitrate in bits/s")
+	fs.Parse(os.Args[2:])
+
+	win, err := parseSize(*window)
+	if err != nil {
+		log.Fatalf("-w: %v", err)
+	}
+	switch os.Args[1] {
+	case "server":
+		log.Fatal(runServer(net.JoinHostPort("", *port), int(win)))
+	case "client":
+		l := *length
+		if l == "" {
+			// 1400 fits a typical 1500-byte MTU with IP and UDP headers,
+			// so datagrams aren't fragmented
+			l = map[bool]string{false: "128K", true: "1400"}[*udp]
+		}
+		n, err := parseSize(l)
+		if err != nil {
+			log.Fatalf("-l: %v", err)
+		}
+		bps, err := parseRate(*rate)
+		if err != nil {
+			log.Fatalf("-b: %v", err)
+		}
+		err = runClient(clientOptions{
+			addr: net.JoinHostPort(*host, *port), udp: *udp, duration: *duration,
+			length: int(n), window: int(win), rate: bps,
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+	default:
+		log.Fatalf("unknown mode %q (want server or client)", os.Args[1])
+	}
+}
+
+func demo() {
+	addr := "127.0.0.1:" + defaultPort
+	go func() { log.Fatal(runServer(addr, 0)) }()
+	time.Sleep(100 * time.Millisecond)
+	log.SetOutput(io.Discard) // the client output tells the story
+
+	runs := []clientOptions{
+		{addr: addr, duration: 2 * time.Second, length: 128 << 10},
+		// Small writes: same bytes, many more syscalls
+		{addr: addr, duration: 2 * time.Second, length: 512},
+		{addr: addr, udp: true, duration: 2 * time.Second, length: 1400, rate: 100e6},
+	}
+	for i, o := range runs {
+		if i > 0 {
+			fmt.Println()
+		}
+		if err := runClient(o); err != nil {
+			fmt.Println("  error:", err)
+		}
+	}
+}
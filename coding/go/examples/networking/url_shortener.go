@@ -0,0 +1,789 @@
+// URL Shortener - A small end-to-end service
+//
+// The classic teaching app, tying the API-server patterns together:
+// - POST /api/links creates a short code: base62 of a counter (short,
+//   but sequential and so guessable) or of a hash of the URL (the
+//   same URL always gets the same code); custom aliases too
+// - GET /{code} redirects: 302 by default, 301 for links marked
+//   permanent - browsers cache a 301 and stop asking, so those hits
+//   go uncounted after the first visit
+// - Hit counts and last-hit times per link
+// - A JSON admin API (list, stats, delete) behind a bearer token
+// - A pluggable Store: in memory, or a JSON file that survives
+//   restarts and batches hit-count writes
+// - Domain errors mapped to statuses by http_errors.go
+//
+// Usage (the error mapping lives in http_errors.go, so name it too):
+//   go run url_shortener.go http_errors.go -demo
+//   go run url_shortener.go http_errors.go -codes hash -store links.json
+//
+// Test endpoints:
+//   curl -d '{"url":"https://go.dev/doc/"}' http://localhost:8080/api/links
+//   curl -d '{"url":"https://pkg.go.dev","code":"pkg","permanent":true}' http://localhost:8080/api/links
+//   curl -i http://localhost:8080/pkg
+//   curl -H "Authorization: Bearer $TOKEN" http://localhost:8080/api/links
+package main
+
+import (
+	"cmp"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ============================================================
+// Models
+// ============================================================
+
+type Link struct {
+	Code      string     `json:"code"`
+	URL       string     `json:"url"`
+	Permanent bool       `json:"permanent"`
+	Hits      int64      `json:"hits"`
+	CreatedAt time.Time  `json:"created_at"`
+	LastHit   *time.Time `json:"last_hit,omitempty"`
+}
+
+type ErrorResponse struct {
+	Error   string `json:"error"`
+	Code    int    `json:"code"`
+	Details string `json:"details,omitempty"`
+}
+
+// ============================================================
+// Codes
+// ============================================================
+
+const base62Alphabet = "0123456789abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+func base62(n uint64) string {
+	if n == 0 {
+		return "0"
+	}
+	var b []byte
+	for n > 0 {
+		b = append(b, base62Alphabet[n%62])
+		n /= 62
+	}
+	slices.Reverse(b)
+	return string(b)
+}
+
+// hashCode derives a code from the URL. length lets the caller ask
+// for a longer code when the short one is taken by a different URL.
+func hashCode(rawURL string, length int) string {
+	sum := sha256.Sum256([]byte(rawURL))
+	code := base62(binary.BigEndian.Uint64(sum[:8])) + base62(binary.BigEndian.Uint64(sum[8:16]))
+	return code[:min(length, len(code))]
+}
+
+// reserved codes would shadow the service's own routes
+var reserved = map[string]bool{"api": true, "health": true, "favicon.ico": true}
+
+func validCode(code string) error {
+	if len(code) < 3 || len(code) > 32 {
+		return &ValidationError{Field: "code", Message: "must be 3 to 32 characters"}
+	}
+	for _, c := range code {
+		if !strings.ContainsRune(base62Alphabet+"-_", c) {
+			return &ValidationError{Field: "code", Message: "may only contain letters, digits, - and _"}
+		}
+	}
+	if reserved[code] {
+		return &ValidationError{Field: "code", Message: "is reserved"}
+	}
+	return nil
+}
+
+// validURL accepts absolute http(s) URLs only: no javascript:, no
+// relative paths that would redirect back into this service
+func validURL(raw string) error {
+	if len(raw) > 2048 {
+		return &ValidationError{Field: "url", Message: "too long"}
+	}
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return &ValidationError{Field: "url", Message: "must be an absolute http or https URL"}
+	}
+	return nil
+}
+
+// ============================================================
+// Stores
+// ============================================================
+
+// Store is what the service needs from persistence. Methods return
+// copies, so callers can't race with later updates.
+type Store interface {
+	Create(l *Link) error // ErrAlreadyExists if the code is taken
+	Get(code string) (*Link, error)
+	RecordHit(code string) (*Link, error)
+	List() ([]*Link, error)
+	Delete(code string) error
+	NextID() (uint64, error) // for counter codes
+}
+
+type MemoryStore struct {
+	mu     sync.RWMutex
+	links  map[string]*Link
+	nextID uint64
+}
+
+func NewMemoryStore() *MemoryStore {
+	// Start at the first three-character code, the shortest a custom
+	// alias may be too
+	return &MemoryStore{links: make(map[string]*Link), nextID: 62 * 62}
+}
+
+func (s *MemoryStore) Create(l *Link) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.links[l.Code]; ok {
+		return fmt.Errorf("code %q: %w", l.Code, ErrAlreadyExists)
+	}
+	c := *l
+	s.links[l.Code] = &c
+	return nil
+}
+
+func (s *MemoryStore) Get(code string) (*Link, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	l, ok := s.links[code]
+	if !ok {
+		return nil, fmt.Errorf("code %q: %w", code, ErrNotFound)
+	}
+	c := *l
+	return &c, nil
+}
+
+func (s *MemoryStore) RecordHit(code string) (*Link, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l, ok := s.links[code]
+	if !ok {
+		return nil, fmt.Errorf("code %q: %w", code, ErrNotFound)
+	}
+	now := time.Now()
+	l.Hits++
+	l.LastHit = &now
+	c := *l
+	return &c, nil
+}
+
+func (s *MemoryStore) List() ([]*Link, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	links := make([]*Link, 0, len(s.links))
+	for _, l := range s.links {
+		c := *l
+		links = append(links, &c)
+	}
+	return links, nil
+}
+
+func (s *MemoryStore) Delete(code string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.links[code]; !ok {
+		return fmt.Errorf("code %q: %w", code, ErrNotFound)
+	}
+	delete(s.links, code)
+	return nil
+}
+
+func (s *MemoryStore) NextID() (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.nextID++
+	return s.nextID, nil
+}
+
+// FileStore keeps everything in memory and mirrors it to a JSON file.
+// Creates and deletes are written at once; hits only mark the store
+// dirty and are written every flushEvery, since a popular link would
+// otherwise rewrite the file on every redirect. A crash loses at most
+// that window of hit counts, never a link.
+type FileStore struct {
+	*MemoryStore
+	path  string
+	saveM sync.Mutex // serializes writes to the file
+
+	dirtyMu sync.Mutex
+	dirty   bool
+	done    chan struct{}
+	wg      sync.WaitGroup
+}
+
+type fileState struct {
+	NextID uint64  `json:"next_id"`
+	Links  []*Link `json:"links"`
+}
+
+func OpenFileStore(path string, flushEvery time.Duration) (*FileStore, error) {
+	s := &FileStore{MemoryStore: NewMemoryStore(), path: path, done: make(chan struct{})}
+	data, err := os.ReadFile(path)
+	switch {
+	case errors.Is(err, os.ErrNotExist):
+		// First run
+	case err != nil:
+		return nil, err
+	default:
+		var st fileState
+		if err := json.Unmarshal(data, &st); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		s.nextID = max(st.NextID, s.nextID)
+		for _, l := range st.Links {
+			s.links[l.Code] = l
+		}
+	}
+	s.wg.Add(1)
+	go s.flushLoop(flushEvery)
+	return s, nil
+}
+
+func (s *FileStore) Create(l *Link) error {
+	if err := s.MemoryStore.Create(l); err != nil {
+		return err
+	}
+	return s.save()
+}
+
+func (s *FileStore) Delete(code string) error {
+	if err := s.MemoryStore.Delete(code); err != nil {
+		return err
+	}
+	return s.save()
+}
+
+func (s *FileStore) NextID() (uint64, error) {
+	id, _ := s.MemoryStore.NextID()
+	// Persist the counter before handing the ID out, or a restart could
+	// issue it again
+	return id, s.save()
+}
+
+func (s *FileStore) RecordHit(code string) (*Link, error) {
+	l, err := s.MemoryStore.RecordHit(code)
+	if err == nil {
+		s.dirtyMu.Lock()
+		s.dirty = true
+		s.dirtyMu.Unlock()
+	}
+	return l, err
+}
+
+func (s *FileStore) flushLoop(every time.Duration) {
+	defer s.wg.Done()
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-s.done:
+			return
+		}
+		s.dirtyMu.Lock()
+		dirty := s.dirty
+		s.dirty = false
+		s.dirtyMu.Unlock()
+		if dirty {
+			if err := s.save(); err != nil {
+				log.Printf("store: flush: %v", err)
+			}
+		}
+	}
+}
+
+// save writes a snapshot to a temp file and renames it over the old
+// one, so a crash mid-write leaves the previous version intact
+func (s *FileStore) save() error {
+	s.saveM.Lock()
+	defer s.saveM.Unlock()
+	s.mu.RLock()
+	st := fileState{NextID: s.nextID}
+	for _, l := range s.links {
+		st.Links = append(st.Links, l)
+	}
+	slices.SortFunc(st.Links, func(a, b *Link) int { return a.CreatedAt.Compare(b.CreatedAt) })
+	data, err := json.MarshalIndent(st, "", "  ")
+	s.mu.RUnlock()
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
+
+// Close stops the flusher and writes any pending hits
+func (s *FileStore) Close() error {
+	close(s.done)
+	s.wg.Wait()
+	return s.save()
+}
+
+// ============================================================
+// Service
+// ============================================================
+
+type Shortener struct {
+	store      Store
+	hashCodes  bool   // codes from a hash of the URL instead of a counter
+	adminToken string // required for the admin API
+	router     *http.ServeMux
+}
+
+func NewShortener(store Store, hashCodes bool, adminToken string) *Shortener {
+	s := &Shortener{store: store, hashCodes: hashCodes, adminToken: adminToken, router: http.NewServeMux()}
+	s.routes()
+	return s
+}
+
+func (s *Shortener) routes() {
+	s.router.HandleFunc("/health", s.handleHealth)
+	s.router.HandleFunc("/api/links", s.handleLinks)
+	s.router.HandleFunc("/api/links/", s.handleLink)
+	s.router.HandleFunc("/", s.handleRedirect)
+}
+
+// ServeHTTP implements http.Handler
+func (s *Shortener) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.loggingMiddleware(s.router).ServeHTTP(w, r)
+}
+
+// shorten stores a link under the requested code, or a generated one
+func (s *Shortener) shorten(rawURL, code string, permanent bool) (*Link, bool, error) {
+	if err := validURL(rawURL); err != nil {
+		return nil, false, err
+	}
+	link := &Link{URL: rawURL, Permanent: permanent, CreatedAt: time.Now().UTC()}
+
+	if code != "" {
+		if err := validCode(code); err != nil {
+			return nil, false, err
+		}
+		link.Code = code
+		return link, true, s.store.Create(link)
+	}
+
+	if s.hashCodes {
+		// Grow the code one character at a time until it is free or
+		// already points at this very URL
+		for length := 7; length <= 16; length++ {
+			link.Code = hashCode(rawURL, length)
+			existing, err := s.store.Get(link.Code)
+			if errors.Is(err, ErrNotFound) {
+				return link, true, s.store.Create(link)
+			}
+			if err != nil {
+				return nil, false, err
+			}
+			if existing.URL == rawURL {
+				return existing, false, nil
+			}
+		}
+		return nil, false, errors.New("hash codes exhausted")
+	}
+
+	// Counter codes: a custom alias may already hold the next one, so
+	// skip ahead until one is free
+	for {
+		id, err := s.store.NextID()
+		if err != nil {
+			return nil, false, err
+		}
+		link.Code = base62(id)
+		err = s.store.Create(link)
+		if !errors.Is(err, ErrAlreadyExists) {
+			return link, true, err
+		}
+	}
+}
+
+// ============================================================
+// Middleware
+// ============================================================
+
+func (s *Shortener) loggingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		wrapped := &responseWriter{ResponseWriter: w, status: 200}
+		next.ServeHTTP(wrapped, r)
+		log.Printf("%s %s %d %v", r.Method, r.URL.Path, wrapped.status, time.Since(start))
+	})
+}
+
+type responseWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *responseWriter) WriteHeader(code int) {
+	w.status = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+// requireAdmin checks the bearer token in constant time, so response
+// timing doesn't reveal how much of a guess was right
+func (s *Shortener) requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(s.adminToken)) != 1 {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+		s.jsonError(w, ErrUnauthorized)
+		return false
+	}
+	return true
+}
+
+// ============================================================
+// Handlers
+// ============================================================
+
+func (s *Shortener) handleHealth(w http.ResponseWriter, r *http.Request) {
+	s.jsonResponse(w, http.StatusOK, map[string]string{"status": "healthy"})
+}
+
+func (s *Shortener) handleLinks(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		s.createLink(w, r)
+	case http.MethodGet:
+		if s.requireAdmin(w, r) {
+			s.listLinks(w, r)
+		}
+	default:
+		s.jsonError(w, ErrMethodNotAllowed)
+	}
+}
+
+func (s *Shortener) handleLink(w http.ResponseWriter, r *http.Request) {
+	code := strings.TrimPrefix(r.URL.Path, "/api/links/")
+	if !s.requireAdmin(w, r) {
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+		link, err := s.store.Get(code)
+		if err != nil {
+			s.jsonError(w, err)
+			return
+		}
+		s.jsonResponse(w, http.StatusOK, link)
+	case http.MethodDelete:
+		if err := s.store.Delete(code); err != nil {
+			s.jsonError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		s.jsonError(w, ErrMethodNotAllowed)
+	}
+}
+
+func (s *Shortener) createLink(w http.ResponseWriter, r *http.Request) {
+	var input struct {
+		URL       string `json:"url"`
+		Code      string `json:"code"`
+		Permanent bool   `json:"permanent"`
+	}
+	dec := json.NewDecoder(io.LimitReader(r.Body, 8<<10))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&input); err != nil {
+		s.jsonError(w, fmt.Errorf("%w: malformed JSON body: %v", ErrInvalidInput, err))
+		return
+	}
+
+	link, created, err := s.shorten(input.URL, input.Code, input.Permanent)
+	if err != nil {
+		s.jsonError(w, err)
+		return
+	}
+	status := http.StatusOK // hash code for a URL we already had
+	if created {
+		status = http.StatusCreated
+	}
+	short := "http://" + r.Host + "/" + link.Code
+	w.Header().Set("Location", short)
+	s.jsonResponse(w, status, struct {
+		*Link
+		ShortURL string `json:"short_url"`
+	}{link, short})
+}
+
+func (s *Shortener) listLinks(w http.ResponseWriter, r *http.Request) {
+	links, err := s.store.List()
+	if err != nil {
+		s.jsonError(w, err)
+		return
+	}
+	// Most visited first
+	slices.SortFunc(links, func(a, b *Link) int {
+		if c := cmp.Compare(b.Hits, a.Hits); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Code, b.Code)
+	})
+	s.jsonResponse(w, http.StatusOK, links)
+}
+
+func (s *Shortener) handleRedirect(w http.ResponseWriter, r *http.Request) {
+	code := strings.TrimPrefix(r.URL.Path, "/")
+	if code == "" {
+		s.jsonResponse(w, http.StatusOK, map[string]string{"service": "url shortener", "create": "POST /api/links"})
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		s.jsonError(w, ErrMethodNotAllowed)
+		return
+	}
+
+	// Only GETs count: HEAD is what link checkers and unfurlers send.
+	// (Plenty of them GET anyway, so hit counts are always a bit high.)
+	var link *Link
+	var err error
+	if r.Method == http.MethodGet {
+		link, err = s.store.RecordHit(code)
+	} else {
+		link, err = s.store.Get(code)
+	}
+	if errors.Is(err, ErrNotFound) {
+		http.Error(w, "short link not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		s.jsonError(w, err)
+		return
+	}
+
+	status := http.StatusFound
+	if link.Permanent {
+		// Browsers and proxies cache a 301 indefinitely unless told
+		// otherwise; a day keeps a deleted link from living forever
+		status = http.StatusMovedPermanently
+		w.Header().Set("Cache-Control", "public, max-age=86400")
+	} else {
+		w.Header().Set("Cache-Control", "private, no-cache")
+	}
+	http.Redirect(w, r, link.URL, status)
+}
+
+// ============================================================
+// Response helpers
+// ============================================================
+
+func (s *Shortener) jsonResponse(w http.ResponseWriter, status int, data any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(data)
+}
+
+// jsonError turns any error into a JSON error response via
+// ClassifyError, logging the ones that are our fault
+func (s *Shortener) jsonError(w http.ResponseWriter, err error) {
+	he := ClassifyError(err)
+	if he.Status >= http.StatusInternalServerError {
+		log.Printf("internal error: %v", err)
+	}
+	s.jsonResponse(w, he.Status, ErrorResponse{Error: he.Message, Code: he.Status, Details: he.Details})
+}
+
+// ============================================================
+// Demo
+// ============================================================
+
+func demo() error {
+	log.SetOutput(io.Discard) // the demo prints what matters itself
+	token := "demo-token"
+
+	serve := func(store Store, hashCodes bool) (string, func()) {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			log.Fatal(err)
+		}
+		srv := &http.Server{Handler: NewShortener(store, hashCodes, token)}
+		go srv.Serve(ln)
+		return "http://" + ln.Addr().String(), func() { srv.Close() }
+	}
+	client := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+	}
+	call := func(method, u, body string, admin bool) (*http.Response, string) {
+		req, _ := http.NewRequest(method, u, strings.NewReader(body))
+		if admin {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer resp.Body.Close()
+		b, _ := io.ReadAll(resp.Body)
+		return resp, strings.TrimSpace(string(b))
+	}
+	codeOf := func(body string) string {
+		var l Link
+		json.Unmarshal([]byte(body), &l)
+		return l.Code
+	}
+
+	base, stop := serve(NewMemoryStore(), false)
+	fmt.Println("=== Creating links (counter codes) ===")
+	var codes []string
+	for _, body := range []string{
+		`{"url":"https://go.dev/doc/effective_go"}`,
+		`{"url":"https://pkg.go.dev/net/http"}`,
+		`{"url":"https://go.dev/blog","code":"blog","permanent":true}`,
+		`{"url":"javascript:alert(1)"}`,
+		`{"url":"https://example.com","code":"api"}`,
+		`{"url":"https://example.com","code":"blog"}`,
+		`{"url":"https://example.com","tracking":true}`,
+	} {
+		resp, out := call("POST", base+"/api/links", body, false)
+		fmt.Printf("%-50s -> %d %s\n", body, resp.StatusCode, out)
+		if resp.StatusCode == http.StatusCreated {
+			codes = append(codes, codeOf(out))
+		}
+	}
+
+	fmt.Println()
+	fmt.Println("=== Redirects ===")
+	for _, code := range append(codes, codes[0], codes[0], "nope") {
+		resp, _ := call("GET", base+"/"+code, "", false)
+		fmt.Printf("GET /%-6s -> %d Location: %s  Cache-Control: %s\n",
+			code, resp.StatusCode, resp.Header.Get("Location"), resp.Header.Get("Cache-Control"))
+	}
+	resp, _ := call("HEAD", base+"/"+codes[1], "", false)
+	fmt.Printf("HEAD /%-5s -> %d (not counted)\n", codes[1], resp.StatusCode)
+
+	fmt.Println()
+	fmt.Println("=== Admin API ===")
+	resp, out := call("GET", base+"/api/links", "", false)
+	fmt.Printf("list without token -> %d %s\n", resp.StatusCode, out)
+	resp, out = call("GET", base+"/api/links", "", true)
+	var links []*Link
+	json.Unmarshal([]byte(out), &links)
+	fmt.Printf("list with token    -> %d\n", resp.StatusCode)
+	for _, l := range links {
+		fmt.Printf("   %-6s %2d hits  %s\n", l.Code, l.Hits, l.URL)
+	}
+	resp, _ = call("DELETE", base+"/api/links/"+codes[1], "", true)
+	fmt.Printf("delete %s          -> %d\n", codes[1], resp.StatusCode)
+	resp, _ = call("GET", base+"/"+codes[1], "", false)
+	fmt.Printf("GET /%s afterwards -> %d\n", codes[1], resp.StatusCode)
+	stop()
+
+	fmt.Println()
+	fmt.Println("=== Hash codes: the same URL gets the same code ===")
+	base, stop = serve(NewMemoryStore(), true)
+	for _, u := range []string{"https://go.dev/", "https://go.dev/", "https://go.dev/play"} {
+		resp, out := call("POST", base+"/api/links", `{"url":"`+u+`"}`, false)
+		fmt.Printf("%-22s -> %d code %s\n", u, resp.StatusCode, codeOf(out))
+	}
+	stop()
+
+	fmt.Println()
+	fmt.Println("=== File store: links and hits survive a restart ===")
+	dir, err := os.MkdirTemp("", "shortener")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "links.json")
+	store, err := OpenFileStore(path, 100*time.Millisecond)
+	if err != nil {
+		return err
+	}
+	base, stop = serve(store, false)
+	_, out = call("POST", base+"/api/links", `{"url":"https://go.dev/ref/spec"}`, false)
+	code := codeOf(out)
+	for range 3 {
+		call("GET", base+"/"+code, "", false)
+	}
+	stop()
+	store.Close()
+	fmt.Printf("first run:  created %s, followed it 3 times, closed the store\n", code)
+
+	store, err = OpenFileStore(path, 100*time.Millisecond)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	base, stop = serve(store, false)
+	defer stop()
+	_, out = call("GET", base+"/api/links/"+code, "", true)
+	fmt.Printf("second run: %s\n", out)
+	_, out = call("POST", base+"/api/links", `{"url":"https://go.dev/ref/mem"}`, false)
+	fmt.Printf("next code continues the counter: %s\n", codeOf(out))
+	return nil
+}
+
+// ============================================================
+// Main
+// ============================================================
+
+func main() {
+	addr := flag.String("addr", ":8080", "listen address")
+	storePath := flag.String("store", "", "JSON file to keep links in (default: memory only)")
+	codes := flag.String("codes", "counter", "code style: counter or hash")
+	runDemo := flag.Bool("demo", false, "run a scripted walk-through and exit")
+	flag.Parse()
+
+	if *runDemo {
+		if err := demo(); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if *codes != "counter" && *codes != "hash" {
+		log.Fatalf("-codes must be counter or hash, not %q", *codes)
+	}
+
+	token := os.Getenv("ADMIN_TOKEN")
+	if token == "" {
+		b := make([]byte, 16)
+		rand.Read(b)
+		token = hex.EncodeToString(b)
+		log.Printf("admin token (set ADMIN_TOKEN to choose one): %s", token)
+	}
+
+	var store Store = NewMemoryStore()
+	if *storePath != "" {
+		fs, err := OpenFileStore(*storePath, 5*time.Second)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer fs.Close()
+		store = fs
+	}
+
+	srv := &http.Server{
+		Addr:              *addr,
+		Handler:           NewShortener(store, *codes == "hash", token),
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	log.Printf("URL shortener listening on %s (%s codes)", *addr, *codes)
+	if err := srv.ListenAndServe(); err != nil {
+		log.Print(err)
+	}
+}
@@ -0,0 +1,469 @@
+// WebRTC Chat - Peer-to-peer messages over a data channel with pion
+//
+// Two programs behind different NATs talk directly, with no server
+// relaying their messages. WebRTC puts three pieces together:
+// - Signaling: the peers swap session descriptions (SDP) once, by any
+//   means. Here that is copy and paste between two terminals, which
+//   shows there's no magic server involved
+// - ICE: each side gathers candidate addresses (its local ones, and
+//   its public address as a STUN server sees it), then both probe
+//   every pair until one gets through the NATs
+// - DTLS and SCTP: the winning path is encrypted with keys checked
+//   against the certificate fingerprints in the SDP, and SCTP on top
+//   gives ordered, reliable messages - the data channel
+//
+// Candidates are gathered before the description is printed (no
+// trickle ICE), so one paste in each direction is all it takes.
+//
+// This directory is its own module (it needs github.com/pion/webrtc);
+// go.mod and go.sum pin the versions.
+//
+// Usage (from webrtc_chat):
+//   go run . offer               # terminal 1: prints an offer, waits for the answer
+//   go run . answer              # terminal 2: paste the offer, prints an answer
+//   go run . local               # both peers in one process, no pasting
+//   go run . -stun "" offer      # host candidates only (same network)
+//
+// In the chat, /ping measures the round trip and /quit leaves.
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pion/webrtc/v4"
+)
+
+// ============================================================
+// Signaling by copy and paste
+// ============================================================
+
+// encode turns a description into one line that survives a terminal
+// paste: JSON, then base64
+func encode(sd *webrtc.SessionDescription) string {
+	b, err := json.Marshal(sd)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return base64.StdEncoding.EncodeToString(b)
+}
+
+func decode(s string) (webrtc.SessionDescription, error) {
+	var sd webrtc.SessionDescription
+	b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(s))
+	if err != nil {
+		return sd, fmt.Errorf("not a pasted description: %w", err)
+	}
+	return sd, json.Unmarshal(b, &sd)
+}
+
+// readPaste reads one non-empty line. bufio.Reader rather than
+// Scanner, which gives up on lines over 64KB
+func readPaste(r *bufio.Reader, prompt string) (webrtc.SessionDescription, error) {
+	fmt.Fprintln(os.Stderr, prompt)
+	for {
+		line, err := r.ReadString('\n')
+		if strings.TrimSpace(line) != "" {
+			return decode(line)
+		}
+		if err != nil {
+			return webrtc.SessionDescription{}, err
+		}
+	}
+}
+
+// fingerprint pulls the DTLS certificate fingerprint out of an SDP.
+// The peer must present a certificate with this hash, so whoever
+// relays the SDP (here: you) vouches for the encryption keys
+func fingerprint(sdp string) string {
+	for line := range strings.SplitSeq(sdp, "\n") {
+		if v, ok := strings.CutPrefix(strings.TrimSpace(line), "a=fingerprint:"); ok {
+			return v
+		}
+	}
+	return "(none)"
+}
+
+// ============================================================
+// Peer
+// ============================================================
+
+type Peer struct {
+	name string
+	pc   *webrtc.PeerConnection
+	dc   chan *webrtc.DataChannel // the open channel, once
+	in   chan message
+	done chan struct{}
+	once sync.Once
+}
+
+// message is what travels on the channel. Chat text and pings share
+// one channel; the type says which
+type message struct {
+	Type string    `json:"type"` // chat, ping or pong
+	From string    `json:"from,omitempty"`
+	Text string    `json:"text,omitempty"`
+	Sent time.Time `json:"sent,omitzero"`
+}
+
+func NewPeer(name string, stun string) (*Peer, error) {
+	var cfg webrtc.Configuration
+	if stun != "" {
+		cfg.ICEServers = []webrtc.ICEServer{{URLs: []string{stun}}}
+	}
+	pc, err := webrtc.NewPeerConnection(cfg)
+	if err != nil {
+		return nil, err
+	}
+	p := &Peer{
+		name: name,
+		pc:   pc,
+		dc:   make(chan *webrtc.DataChannel, 1),
+		in:   make(chan message, 16),
+		done: make(chan struct{}),
+	}
+
+	pc.OnICEConnectionStateChange(func(s webrtc.ICEConnectionState) {
+		log.Printf("[%s] ICE %s", name, s)
+	})
+	pc.OnConnectionStateChange(func(s webrtc.PeerConnectionState) {
+		log.Printf("[%s] connection %s", name, s)
+		switch s {
+		case webrtc.PeerConnectionStateConnected:
+			p.logPath()
+		case webrtc.PeerConnectionStateFailed, webrtc.PeerConnectionStateClosed:
+			// Failed usually means no candidate pair got through: both
+			// peers behind symmetric NATs need a TURN relay
+			p.close()
+		}
+	})
+	// The answering side learns about the channel from the offer
+	pc.OnDataChannel(p.attach)
+	return p, nil
+}
+
+// close is called from pion's callbacks, possibly more than once
+func (p *Peer) close() {
+	p.once.Do(func() { close(p.done) })
+}
+
+// logPath shows which candidate pair ICE settled on: host means a
+// direct local address, srflx an address a NAT mapped (what STUN
+// discovered), relay a TURN server in the middle
+func (p *Peer) logPath() {
+	sctp := p.pc.SCTP()
+	if sctp == nil {
+		return
+	}
+	pair, err := sctp.Transport().ICETransport().GetSelectedCandidatePair()
+	if err != nil || pair == nil {
+		return
+	}
+	log.Printf("[%s] path: %s %s:%d (%s) <-> %s:%d (%s)", p.name,
+		pair.Local.Protocol, pair.Local.Address, pair.Local.Port, pair.Local.Typ,
+		pair.Remote.Address, pair.Remote.Port, pair.Remote.Typ)
+}
+
+// attach wires up a data channel, whichever side created it
+func (p *Peer) attach(dc *webrtc.DataChannel) {
+	dc.OnOpen(func() {
+		log.Printf("[%s] data channel %q open (ordered=%v)", p.name, dc.Label(), dc.Ordered())
+		p.dc <- dc
+	})
+	dc.OnClose(func() {
+		log.Printf("[%s] data channel closed", p.name)
+		p.close()
+	})
+	dc.OnMessage(func(raw webrtc.DataChannelMessage) {
+		var m message
+		if err := json.Unmarshal(raw.Data, &m); err != nil {
+			log.Printf("[%s] bad message: %v", p.name, err)
+			return
+		}
+		if m.Type == "ping" {
+			// Answer at once, from the callback, so the RTT doesn't
+			// include the chat loop
+			b, _ := json.Marshal(message{Type: "pong", Sent: m.Sent})
+			dc.Send(b)
+			return
+		}
+		p.in <- m
+	})
+}
+
+// describe sets a local description and waits for ICE gathering to
+// finish, so the returned SDP carries every candidate
+func (p *Peer) describe(sd webrtc.SessionDescription) (*webrtc.SessionDescription, error) {
+	gathered := webrtc.GatheringCompletePromise(p.pc)
+	if err := p.pc.SetLocalDescription(sd); err != nil {
+		return nil, err
+	}
+	select {
+	case <-gathered:
+	case <-time.After(10 * time.Second):
+		return nil, errors.New("ICE gathering timed out (is the STUN server reachable?)")
+	}
+	return p.pc.LocalDescription(), nil
+}
+
+// Offer creates the data channel (the offerer decides what channels
+// exist) and returns the offer to send to the other side
+func (p *Peer) Offer() (*webrtc.SessionDescription, error) {
+	dc, err := p.pc.CreateDataChannel("chat", nil) // reliable and ordered by default
+	if err != nil {
+		return nil, err
+	}
+	p.attach(dc)
+	offer, err := p.pc.CreateOffer(nil)
+	if err != nil {
+		return nil, err
+	}
+	return p.describe(offer)
+}
+
+// Answer takes the remote offer and returns the answer for it
+func (p *Peer) Answer(offer webrtc.SessionDescription) (*webrtc.SessionDescription, error) {
+	if offer.Type != webrtc.SDPTypeOffer {
+		return nil, fmt.Errorf("expected an offer, got %s", offer.Type)
+	}
+	if err := p.pc.SetRemoteDescription(offer); err != nil {
+		return nil, err
+	}
+	answer, err := p.pc.CreateAnswer(nil)
+	if err != nil {
+		return nil, err
+	}
+	return p.describe(answer)
+}
+
+// Accept completes the offerer's side with the remote answer
+func (p *Peer) Accept(answer webrtc.SessionDescription) error {
+	if answer.Type != webrtc.SDPTypeAnswer {
+		return fmt.Errorf("expected an answer, got %s", answer.Type)
+	}
+	return p.pc.SetRemoteDescription(answer)
+}
+
+// waitOpen blocks until the data channel is usable
+func (p *Peer) waitOpen(timeout time.Duration) (*webrtc.DataChannel, error) {
+	select {
+	case dc := <-p.dc:
+		return dc, nil
+	case <-p.done:
+		return nil, errors.New("connection failed before the channel opened")
+	case <-time.After(timeout):
+		return nil, errors.New("timed out waiting for the data channel")
+	}
+}
+
+// ============================================================
+// Chat
+// ============================================================
+
+func send(dc *webrtc.DataChannel, m message) error {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+	return dc.Send(b)
+}
+
+// chat copies lines from r to the peer and prints what comes back,
+// until /quit, EOF or the connection drops
+func (p *Peer) chat(dc *webrtc.DataChannel, r *bufio.Reader) {
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+		for {
+			line, err := r.ReadString('\n')
+			if s := strings.TrimSpace(line); s != "" {
+				lines <- s
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	fmt.Fprintln(os.Stderr, "Connected. Type messages; /ping, /quit.")
+	for {
+		select {
+		case line, ok := <-lines:
+			if !ok || line == "/quit" {
+				return
+			}
+			m := message{Type: "chat", From: p.name, Text: line}
+			if line == "/ping" {
+				m = message{Type: "ping", Sent: time.Now()}
+			}
+			if err := send(dc, m); err != nil {
+				log.Printf("send: %v", err)
+				return
+			}
+		case m := <-p.in:
+			switch m.Type {
+			case "pong":
+				fmt.Printf("pong: round trip %v\n", time.Since(m.Sent).Round(10*time.Microsecond))
+			case "chat":
+				fmt.Printf("<%s> %s\n", m.From, m.Text)
+			}
+		case <-p.done:
+			fmt.Println("peer left")
+			return
+		}
+	}
+}
+
+// ============================================================
+// Roles
+// ============================================================
+
+func runOffer(name, stun string, stdin *bufio.Reader) error {
+	p, err := NewPeer(name, stun)
+	if err != nil {
+		return err
+	}
+	defer p.pc.Close()
+	offer, err := p.Offer()
+	if err != nil {
+		return err
+	}
+	log.Printf("our DTLS fingerprint: %s", fingerprint(offer.SDP))
+	fmt.Fprintln(os.Stderr, "Send this offer to the other peer:")
+	fmt.Println(encode(offer))
+
+	answer, err := readPaste(stdin, "\nPaste the answer and press Enter:")
+	if err != nil {
+		return err
+	}
+	log.Printf("their DTLS fingerprint: %s", fingerprint(answer.SDP))
+	if err := p.Accept(answer); err != nil {
+		return err
+	}
+	dc, err := p.waitOpen(30 * time.Second)
+	if err != nil {
+		return err
+	}
+	p.chat(dc, stdin)
+	return nil
+}
+
+func runAnswer(name, stun string, stdin *bufio.Reader) error {
+	p, err := NewPeer(name, stun)
+	if err != nil {
+		return err
+	}
+	defer p.pc.Close()
+	offer, err := readPaste(stdin, "Paste the offer and press Enter:")
+	if err != nil {
+		return err
+	}
+	log.Printf("their DTLS fingerprint: %s", fingerprint(offer.SDP))
+	answer, err := p.Answer(offer)
+	if err != nil {
+		return err
+	}
+	log.Printf("our DTLS fingerprint: %s", fingerprint(answer.SDP))
+	fmt.Fprintln(os.Stderr, "Send this answer back:")
+	fmt.Println(encode(answer))
+
+	dc, err := p.waitOpen(30 * time.Second)
+	if err != nil {
+		return err
+	}
+	p.chat(dc, stdin)
+	return nil
+}
+
+// runLocal connects two peers in one process, passing the descriptions
+// directly, then sends a few messages both ways
+func runLocal(stun string) error {
+	alice, err := NewPeer("alice", stun)
+	if err != nil {
+		return err
+	}
+	defer alice.pc.Close()
+	bob, err := NewPeer("bob", stun)
+	if err != nil {
+		return err
+	}
+	defer bob.pc.Close()
+
+	offer, err := alice.Offer()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("offer: %d bytes of SDP, %d candidates\n", len(offer.SDP), strings.Count(offer.SDP, "a=candidate:"))
+	answer, err := bob.Answer(*offer)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("answer: %d bytes of SDP, %d candidates\n", len(answer.SDP), strings.Count(answer.SDP, "a=candidate:"))
+	if err := alice.Accept(*answer); err != nil {
+		return err
+	}
+
+	adc, err := alice.waitOpen(10 * time.Second)
+	if err != nil {
+		return err
+	}
+	bdc, err := bob.waitOpen(10 * time.Second)
+	if err != nil {
+		return err
+	}
+
+	send(adc, message{Type: "chat", From: "alice", Text: "hi bob, no server in between"})
+	fmt.Printf("bob got: %s\n", (<-bob.in).Text)
+	send(bdc, message{Type: "chat", From: "bob", Text: "hi alice, and it's encrypted"})
+	fmt.Printf("alice got: %s\n", (<-alice.in).Text)
+	for range 3 {
+		send(adc, message{Type: "ping", Sent: time.Now()})
+		fmt.Printf("alice ping: %v\n", time.Since((<-alice.in).Sent).Round(10*time.Microsecond))
+	}
+	return nil
+}
+
+func main() {
+	name := flag.String("name", "", "name shown to the other peer (default: the role)")
+	stun := flag.String("stun", "stun:stun.l.google.com:19302", "STUN server; empty for local candidates only")
+	flag.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: go run . [-name n] [-stun url] offer|answer|local")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	role := flag.Arg(0)
+	if *name == "" {
+		*name = role
+	}
+
+	stdin := bufio.NewReader(os.Stdin)
+	var err error
+	switch role {
+	case "offer":
+		err = runOffer(*name, *stun, stdin)
+	case "answer":
+		err = runAnswer(*name, *stun, stdin)
+	case "local":
+		err = runLocal(*stun)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil && !errors.Is(err, io.EOF) {
+		log.Fatal(err)
+	}
+}
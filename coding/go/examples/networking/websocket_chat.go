@@ -0,0 +1,601 @@
+// WebSocket Chat Server - Real-time messaging with rooms
+//
+// This example builds a chat server on WebSockets (RFC 6455) using
+// only the standard library, so the protocol is visible end to end:
+// - The HTTP Upgrade handshake and Sec-WebSocket-Accept
+// - Frame parsing: FIN bit, opcodes, masking, extended lengths
+// - A hub goroutine that owns all shared state (register,
+//   unregister, broadcast) - no locks needed
+// - Per-client read and write pumps; only the write pump writes
+// - Ping/pong keepalive with read deadlines to drop dead peers
+// - Rooms: /join <room> moves you, messages go to your room only
+//
+// Production code would normally use a library such as
+// github.com/coder/websocket or github.com/gorilla/websocket; the
+// hub and pump structure stays the same.
+//
+// Usage:
+//   go run websocket_chat.go
+//   Open http://localhost:8080 in two browser tabs
+//
+// Chat commands:
+//   /name alice      change your display name
+//   /join ops        switch to room "ops" (everyone starts in "lobby")
+//   /who             list who is in your room
+package main
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	// Time allowed to write a frame to the peer
+	writeWait = 10 * time.Second
+
+	// Time allowed between pongs before the peer is considered dead
+	pongWait = 60 * time.Second
+
+	// Ping this often; must be less than pongWait
+	pingPeriod = pongWait * 9 / 10
+
+	// Largest message accepted from a client
+	maxMessageSize = 64 << 10
+
+	// Outgoing frames buffered per client before it's dropped as slow
+	sendBuffer = 64
+)
+
+// websocketGUID is the fixed string from RFC 6455 section 1.3
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// Opcodes from RFC 6455 section 5.2
+const (
+	opContinuation = 0x0
+	opText         = 0x1
+	opBinary       = 0x2
+	opClose        = 0x8
+	opPing         = 0x9
+	opPong         = 0xA
+)
+
+// ============================================================
+// Framing
+// ============================================================
+
+// frame is one outgoing WebSocket frame
+type frame struct {
+	op      byte
+	payload []byte
+}
+
+var errMessageTooBig = errors.New("websocket: message too big")
+
+// Wire format of a frame (section 5.2):
+//
+//   0                   1                   2                   3
+//   0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
+//  +-+-+-+-+-------+-+-------------+-------------------------------+
+//  |F|R|R|R| opcode|M| Payload len |    Extended payload length    |
+//  |I|S|S|S|  (4)  |A|     (7)     |            (16/64)            |
+//  |N|V|V|V|       |S|             |   (if payload len==126/127)   |
+//  +-+-+-+-+-------+-+-------------+-------------------------------+
+//  |     Masking key (4 bytes, only if MASK is set)                |
+//  +---------------------------------------------------------------+
+//  |     Payload data                                              |
+//  +---------------------------------------------------------------+
+
+// readFrame reads one raw frame. Client-to-server frames must be
+// masked; the server XORs the payload with the 4-byte key.
+func readFrame(r *bufio.Reader) (fin bool, op byte, payload []byte, err error) {
+	var hdr [2]byte
+	if _, err = io.ReadFull(r, hdr[:]); err != nil {
+		return
+	}
+	fin = hdr[0]&0x80 != 0
+	op = hdr[0] & 0x0F
+	masked := hdr[1]&0x80 != 0
+	length := uint64(hdr[1] & 0x7F)
+
+	if hdr[0]&0x70 != 0 {
+		return fin, op, nil, errors.New("websocket: reserved bits set")
+	}
+	if !masked {
+		return fin, op, nil, errors.New("websocket: client frame not masked")
+	}
+
+	switch length {
+	case 126:
+		var ext [2]byte
+		if _, err = io.ReadFull(r, ext[:]); err != nil {
+			return
+		}
+		length = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err = io.ReadFull(r, ext[:]); err != nil {
+			return
+		}
+		length = binary.BigEndian.Uint64(ext[:])
+	}
+	if length > maxMessageSize {
+		return fin, op, nil, errMessageTooBig
+	}
+
+	var mask [4]byte
+	if _, err = io.ReadFull(r, mask[:]); err != nil {
+		return
+	}
+	payload = make([]byte, length)
+	if _, err = io.ReadFull(r, payload); err != nil {
+		return
+	}
+	for i := range payload {
+		payload[i] ^= mask[i%4]
+	}
+	return fin, op, payload, nil
+}
+
+// readMessage returns the next complete data message, reassembling
+// fragments and answering control frames that arrive in between
+func readMessage(r *bufio.Reader, onControl func(op byte, payload []byte) error) ([]byte, error) {
+	var msg []byte
+	started := false
+	for {
+		fin, op, payload, err := readFrame(r)
+		if err != nil {
+			return nil, err
+		}
+
+		// Control frames may be interleaved with a fragmented message
+		if op >= opClose {
+			if err := onControl(op, payload); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		switch {
+		case op == opContinuation && !started:
+			return nil, errors.New("websocket: continuation without a start")
+		case op != opContinuation && started:
+			return nil, errors.New("websocket: new message inside a fragmented one")
+		}
+		started = true
+		msg = append(msg, payload...)
+		if len(msg) > maxMessageSize {
+			return nil, errMessageTooBig
+		}
+		if fin {
+			return msg, nil
+		}
+	}
+}
+
+// writeFrame writes a single, unfragmented frame. Server-to-client
+// frames are never masked.
+func writeFrame(w io.Writer, op byte, payload []byte) error {
+	hdr := make([]byte, 2, 10)
+	hdr[0] = 0x80 | op // FIN + opcode
+	switch n := len(payload); {
+	case n < 126:
+		hdr[1] = byte(n)
+	case n <= 0xFFFF:
+		hdr[1] = 126
+		hdr = binary.BigEndian.AppendUint16(hdr, uint16(n))
+	default:
+		hdr[1] = 127
+		hdr = binary.BigEndian.AppendUint64(hdr, uint64(n))
+	}
+	if _, err := w.Write(hdr); err != nil {
+		return err
+	}
+	_, err := w.Write(payload)
+	return err
+}
+
+// ============================================================
+// Handshake
+// ============================================================
+
+// acceptKey proves to the browser that the server speaks WebSocket
+func acceptKey(key string) string {
+	h := sha1.Sum([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(h[:])
+}
+
+// headerContains reports whether a comma-separated header has token
+func headerContains(h http.Header, name, token string) bool {
+	for _, v := range h.Values(name) {
+		for _, part := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(part), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// upgrade validates the handshake, takes over the TCP connection
+// from net/http and sends the 101 response
+func upgrade(w http.ResponseWriter, r *http.Request) (net.Conn, *bufio.ReadWriter, error) {
+	if r.Method != http.MethodGet ||
+		!headerContains(r.Header, "Connection", "upgrade") ||
+		!headerContains(r.Header, "Upgrade", "websocket") {
+		http.Error(w, "expected a WebSocket upgrade", http.StatusBadRequest)
+		return nil, nil, errors.New("not a websocket handshake")
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		w.Header().Set("Sec-WebSocket-Version", "13")
+		http.Error(w, "unsupported WebSocket version", http.StatusUpgradeRequired)
+		return nil, nil, errors.New("unsupported version")
+	}
+	key := r.Header.Get("Sec-WebSocket-Key")
+	if key == "" {
+		http.Error(w, "missing Sec-WebSocket-Key", http.StatusBadRequest)
+		return nil, nil, errors.New("missing key")
+	}
+	// A real server must also check Origin here: browsers send
+	// cookies with WebSocket handshakes from any site.
+
+	// Hijack hands us the raw connection; net/http forgets about it,
+	// so it won't be closed (or tracked) by Server.Shutdown
+	conn, rw, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		http.Error(w, "hijack failed", http.StatusInternalServerError)
+		return nil, nil, err
+	}
+
+	fmt.Fprintf(rw, "HTTP/1.1 101 Switching Protocols\r\n"+
+		"Upgrade: websocket\r\n"+
+		"Connection: Upgrade\r\n"+
+		"Sec-WebSocket-Accept: %s\r\n\r\n", acceptKey(key))
+	if err := rw.Flush(); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	return conn, rw, nil
+}
+
+// ============================================================
+// Hub
+// ============================================================
+
+// Client is one connected browser tab
+type Client struct {
+	hub  *Hub
+	conn net.Conn
+	rw   *bufio.ReadWriter
+	send chan frame // owned by the hub: only the hub closes it
+
+	// Written only by the hub goroutine
+	name string
+	room string
+}
+
+// roomMessage is a broadcast request from a client's read pump
+type roomMessage struct {
+	from *Client
+	text string
+}
+
+// command is a /join, /name or /who request
+type command struct {
+	client *Client
+	verb   string
+	arg    string
+}
+
+// Hub owns the room membership. Every change goes through one of its
+// channels and is applied by run(), a single goroutine, so the maps
+// below are never touched concurrently.
+type Hub struct {
+	register   chan *Client
+	unregister chan *Client
+	broadcast  chan roomMessage
+	commands   chan command
+
+	rooms map[string]map[*Client]bool
+}
+
+func NewHub() *Hub {
+	return &Hub{
+		register:   make(chan *Client),
+		unregister: make(chan *Client),
+		broadcast:  make(chan roomMessage),
+		commands:   make(chan command),
+		rooms:      make(map[string]map[*Client]bool),
+	}
+}
+
+func (h *Hub) run() {
+	for {
+		select {
+		case c := <-h.register:
+			h.join(c, "lobby")
+
+		case c := <-h.unregister:
+			if h.rooms[c.room][c] {
+				h.leave(c)
+				close(c.send) // tells the write pump to send Close and exit
+			}
+
+		// A client dropped for being slow may still have a message in
+		// flight from its read pump; ignore it rather than re-adding it
+		case m := <-h.broadcast:
+			if h.rooms[m.from.room][m.from] {
+				h.announce(m.from.room, fmt.Sprintf("%s: %s", m.from.name, m.text))
+			}
+
+		case cmd := <-h.commands:
+			if h.rooms[cmd.client.room][cmd.client] {
+				h.handle(cmd)
+			}
+		}
+	}
+}
+
+func (h *Hub) handle(cmd command) {
+	c := cmd.client
+	switch cmd.verb {
+	case "/join":
+		if cmd.arg == "" || cmd.arg == c.room {
+			h.deliver(c, "usage: /join <other room>")
+			return
+		}
+		h.leave(c)
+		h.join(c, cmd.arg)
+	case "/name":
+		if cmd.arg == "" {
+			h.deliver(c, "usage: /name <new name>")
+			return
+		}
+		old := c.name
+		c.name = cmd.arg
+		h.announce(c.room, fmt.Sprintf("* %s is now %s", old, c.name))
+	case "/who":
+		var names []string
+		for m := range h.rooms[c.room] {
+			names = append(names, m.name)
+		}
+		slices.Sort(names)
+		h.deliver(c, fmt.Sprintf("in #%s: %s", c.room, strings.Join(names, ", ")))
+	default:
+		h.deliver(c, "commands: /name <name>, /join <room>, /who")
+	}
+}
+
+func (h *Hub) join(c *Client, room string) {
+	if h.rooms[room] == nil {
+		h.rooms[room] = make(map[*Client]bool)
+	}
+	h.rooms[room][c] = true
+	c.room = room
+	h.announce(room, fmt.Sprintf("* %s joined #%s (%d here)", c.name, room, len(h.rooms[room])))
+}
+
+func (h *Hub) leave(c *Client) {
+	delete(h.rooms[c.room], c)
+	if len(h.rooms[c.room]) == 0 {
+		delete(h.rooms, c.room)
+	} else {
+		h.announce(c.room, fmt.Sprintf("* %s left #%s", c.name, c.room))
+	}
+}
+
+// announce sends text to everyone in room
+func (h *Hub) announce(room, text string) {
+	for c := range h.rooms[room] {
+		h.deliver(c, text)
+	}
+}
+
+// deliver queues text for one client without ever blocking the hub.
+// A client whose buffer is full is too slow to keep up; it's dropped
+// rather than allowed to stall every other client.
+func (h *Hub) deliver(c *Client, text string) {
+	select {
+	case c.send <- frame{op: opText, payload: []byte(text)}:
+	default:
+		log.Printf("%s: send buffer full, dropping client", c.conn.RemoteAddr())
+		h.leave(c)
+		close(c.send)
+	}
+}
+
+// ============================================================
+// Pumps
+// ============================================================
+
+// readPump reads frames until the connection fails or the peer
+// closes it. It never writes to the socket: pongs and close replies
+// are queued for writePump like any other frame.
+func (c *Client) readPump(pongs chan<- frame) {
+	defer func() {
+		c.hub.unregister <- c
+		c.conn.Close()
+	}()
+
+	c.conn.SetReadDeadline(time.Now().Add(pongWait))
+
+	onControl := func(op byte, payload []byte) error {
+		switch op {
+		case opPong:
+			// Proof of life: push the deadline out again
+			c.conn.SetReadDeadline(time.Now().Add(pongWait))
+		case opPing:
+			select {
+			case pongs <- frame{op: opPong, payload: payload}:
+			default: // a pong is already pending; one is enough
+			}
+		case opClose:
+			return io.EOF
+		}
+		return nil
+	}
+
+	for {
+		msg, err := readMessage(c.rw.Reader, onControl)
+		if err != nil {
+			if !errors.Is(err, io.EOF) {
+				log.Printf("%s: read: %v", c.conn.RemoteAddr(), err)
+			}
+			return
+		}
+
+		text := strings.TrimSpace(string(msg))
+		if text == "" {
+			continue
+		}
+		if strings.HasPrefix(text, "/") {
+			verb, arg, _ := strings.Cut(text, " ")
+			c.hub.commands <- command{client: c, verb: verb, arg: strings.TrimSpace(arg)}
+			continue
+		}
+		c.hub.broadcast <- roomMessage{from: c, text: text}
+	}
+}
+
+// writePump is the only goroutine that writes to the connection. It
+// sends queued messages, answers pings, and pings the peer itself.
+func (c *Client) writePump(pongs <-chan frame) {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close() // unblocks readPump if it's still reading
+	}()
+
+	write := func(op byte, payload []byte) error {
+		c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+		if err := writeFrame(c.rw.Writer, op, payload); err != nil {
+			return err
+		}
+		return c.rw.Flush()
+	}
+
+	for {
+		select {
+		case f, ok := <-c.send:
+			if !ok {
+				// The hub closed the channel: say goodbye (1000 = normal)
+				write(opClose, binary.BigEndian.AppendUint16(nil, 1000))
+				return
+			}
+			if err := write(f.op, f.payload); err != nil {
+				return
+			}
+		case f := <-pongs:
+			if err := write(f.op, f.payload); err != nil {
+				return
+			}
+		case <-ticker.C:
+			if err := write(opPing, nil); err != nil {
+				return
+			}
+		}
+	}
+}
+
+// ============================================================
+// HTTP
+// ============================================================
+
+var guestID atomic.Int64
+
+func serveWS(hub *Hub, w http.ResponseWriter, r *http.Request) {
+	conn, rw, err := upgrade(w, r)
+	if err != nil {
+		log.Printf("%s: upgrade: %v", r.RemoteAddr, err)
+		return
+	}
+
+	c := &Client{
+		hub:  hub,
+		conn: conn,
+		rw:   rw,
+		send: make(chan frame, sendBuffer),
+		name: fmt.Sprintf("guest%d", guestID.Add(1)),
+	}
+	hub.register <- c
+
+	pongs := make(chan frame, 1)
+	go c.writePump(pongs)
+	go c.readPump(pongs)
+}
+
+func main() {
+	hub := NewHub()
+	go hub.run()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		io.WriteString(w, indexHTML)
+	})
+	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
+		serveWS(hub, w, r)
+	})
+
+	srv := &http.Server{
+		Addr:              ":8080",
+		Handler:           mux,
+		ReadHeaderTimeout: 5 * time.Second,
+	}
+	log.Println("Chat server listening on http://localhost:8080")
+	log.Fatal(srv.ListenAndServe())
+}
+
+// indexHTML is the whole client: the browser's WebSocket API does
+// the handshake, framing and masking for us
+const indexHTML = `<!doctype html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>Go WebSocket Chat</title>
+<style>
+  body { font-family: sans-serif; max-width: 40em; margin: 2em auto; }
+  #log { border: 1px solid #ccc; height: 24em; overflow-y: auto; padding: .5em; white-space: pre-wrap; }
+  #msg { width: 80%; }
+  .sys { color: #888; }
+</style>
+</head>
+<body>
+<h1>Chat</h1>
+<div id="log"></div>
+<form id="form"><input id="msg" autocomplete="off" autofocus placeholder="message, or /join room, /name you, /who"> <button>Send</button></form>
+<script>
+const log = document.getElementById("log");
+const msg = document.getElementById("msg");
+function append(text) {
+  const line = document.createElement("div");
+  if (text.startsWith("*") || text.startsWith("in #")) line.className = "sys";
+  line.textContent = text; // textContent, never innerHTML: chat text is untrusted
+  log.appendChild(line);
+  log.scrollTop = log.scrollHeight;
+}
+const scheme = location.protocol === "https:" ? "wss://" : "ws://";
+const ws = new WebSocket(scheme + location.host + "/ws");
+ws.onopen = () => append("* connected");
+ws.onmessage = (e) => append(e.data);
+ws.onclose = () => append("* disconnected");
+document.getElementById("form").onsubmit = (e) => {
+  e.preventDefault();
+  if (msg.value && ws.readyState === WebSocket.OPEN) ws.send(msg.value);
+  msg.value = "";
+};
+</script>
+</body>
+</html>
+`